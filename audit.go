@@ -0,0 +1,155 @@
+package zfs
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CommandRecord describes an invocation of a command by the library, as passed to the AuditHook.
+type CommandRecord struct {
+	// Command is the name of the command, such as "zfs" or "zpool".
+	Command string
+	Args    []string
+	Start   time.Time
+	// Duration is the time the command took to run, zero if it was skipped by dry-run mode.
+	Duration time.Duration
+	// ExitCode is the exit code of the command, -1 if it did not exit, e.g. because it could not be started.
+	ExitCode int
+	// Err is the error of a failed command, an *Error unless its context was done.
+	Err error
+	// Mutating is set for zfs and zpool commands which change a pool or dataset, see IsMutatingCommand.
+	Mutating bool
+	// DryRun is set for mutating commands which were not executed because of dry-run mode.
+	DryRun bool
+}
+
+// AuditHook is called with the record of every command the library runs, including those of helpers such as
+// udevadm or zdb, once the command completed. It is called from the goroutine which runs the command,
+// and may be called concurrently.
+type AuditHook func(*CommandRecord)
+
+var (
+	auditMu   sync.Mutex
+	auditHook AuditHook
+	dryRun    bool
+)
+
+// SetAuditHook sets the hook which is called with the record of every command, e.g. to keep an audit trail of
+// storage changes. A nil hook disables auditing.
+func SetAuditHook(h AuditHook) {
+	auditMu.Lock()
+	auditHook = h
+	auditMu.Unlock()
+}
+
+func audit(rec *CommandRecord) {
+	auditMu.Lock()
+	h := auditHook
+	auditMu.Unlock()
+	if h != nil {
+		h(rec)
+	}
+}
+
+// SetDryRun enables or disables dry-run mode for all commands whose context does not set it with WithDryRun.
+// In dry-run mode, mutating zfs and zpool commands are not run but reported to the AuditHook as DryRun. They
+// succeed with empty output, so functions which read back what they changed, such as CreateFilesystem, may fail.
+// Other commands are run as usual.
+func SetDryRun(enabled bool) {
+	auditMu.Lock()
+	dryRun = enabled
+	auditMu.Unlock()
+}
+
+type dryRunKey struct{}
+
+// WithDryRun returns a copy of ctx which enables or disables dry-run mode for the Context variants of the
+// library's functions, overriding SetDryRun.
+func WithDryRun(ctx context.Context, enabled bool) context.Context {
+	return context.WithValue(ctx, dryRunKey{}, enabled)
+}
+
+func dryRunFromContext(ctx context.Context) bool {
+	if enabled, ok := ctx.Value(dryRunKey{}).(bool); ok {
+		return enabled
+	}
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	return dryRun
+}
+
+// readOnlyCommands are the subcommands of zfs and zpool which never change a pool or dataset.
+var readOnlyCommands = map[string]map[string]bool{
+	"zfs": {
+		"list": true, "get": true, "version": true, "userspace": true, "groupspace": true, "projectspace": true,
+		"diff": true, "holds": true, "send": true, "wait": true,
+	},
+	"zpool": {
+		"list": true, "get": true, "status": true, "iostat": true, "history": true, "version": true, "wait": true,
+	},
+}
+
+// dryRunCommands are the subcommands of zfs and zpool which only report what they would do if given -n.
+var dryRunCommands = map[string]bool{
+	"create": true, "destroy": true, "receive": true, "recv": true, "program": true, "add": true, "split": true,
+	"remove": true, "import": true, "clear": true,
+}
+
+// IsMutatingCommand reports whether running the zfs or zpool command with the given arguments may change a pool
+// or dataset. Subcommands which only list, such as zfs mount or zpool import without arguments, and those given
+// -n to report what they would do, are not mutating. Commands other than zfs and zpool are never mutating.
+func IsMutatingCommand(command string, args []string) bool {
+	readOnly, ok := readOnlyCommands[command]
+	if !ok || len(args) == 0 {
+		return false
+	}
+	sub, rest := args[0], args[1:]
+	if readOnly[sub] {
+		return false
+	}
+	if dryRunCommands[sub] && hasShortFlag(rest, 'n') {
+		return false
+	}
+	switch command + " " + sub {
+	case "zfs mount":
+		return len(rest) > 0
+	case "zfs allow":
+		// with only a dataset the delegated permissions are printed
+		return len(rest) != 1
+	case "zpool events":
+		return hasShortFlag(rest, 'c')
+	case "zpool upgrade":
+		return len(rest) > 0 && !(len(rest) == 1 && rest[0] == "-v")
+	case "zpool import":
+		return hasShortFlag(rest, 'a') || len(positionalArgs(rest, "dcoTR")) > 0
+	}
+	return true
+}
+
+// hasShortFlag reports whether the flag is given in args, alone or grouped with others such as -nvp.
+func hasShortFlag(args []string, flag byte) bool {
+	for _, arg := range args {
+		if len(arg) > 1 && arg[0] == '-' && arg[1] != '-' && strings.IndexByte(arg[1:], flag) >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// positionalArgs returns the arguments which are not flags, skipping the values of the given flags.
+func positionalArgs(args []string, valueFlags string) []string {
+	var positional []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if len(arg) < 2 || arg[0] != '-' {
+			positional = append(positional, arg)
+			continue
+		}
+		if len(arg) == 2 && strings.IndexByte(valueFlags, arg[1]) >= 0 {
+			i++
+		}
+	}
+	return positional
+}
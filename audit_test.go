@@ -0,0 +1,132 @@
+package zfs
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestIsMutatingCommand(t *testing.T) {
+	for cmd, want := range map[string]bool{
+		"zfs list -Hp -o name":                 false,
+		"zfs get -Hp all tank":                 false,
+		"zfs create tank/fs":                   true,
+		"zfs destroy -nvp tank/fs@a":           false,
+		"zfs destroy -r tank/fs":               true,
+		"zfs mount":                            false,
+		"zfs mount tank/fs":                    true,
+		"zfs allow tank/fs":                    false,
+		"zfs allow -u bob mount tank/fs":       true,
+		"zfs send tank/fs@a":                   false,
+		"zfs receive -n -v tank/fs":            false,
+		"zpool status -v tank":                 false,
+		"zpool import":                         false,
+		"zpool import -d /dev/disk/by-id":      false,
+		"zpool import -d /dev/disk/by-id tank": true,
+		"zpool import -a":                      true,
+		"zpool upgrade":                        false,
+		"zpool upgrade -v":                     false,
+		"zpool upgrade tank":                   true,
+		"zpool events -H":                      false,
+		"zpool events -c":                      true,
+		"zpool scrub tank":                     true,
+		"zdb -l /dev/sda":                      false,
+	} {
+		args := strings.Fields(cmd)
+		if got := IsMutatingCommand(args[0], args[1:]); got != want {
+			t.Errorf("%s: want mutating %v, got %v", cmd, want, got)
+		}
+	}
+}
+
+func TestAuditHook(t *testing.T) {
+	var records []*CommandRecord
+	SetAuditHook(func(rec *CommandRecord) {
+		records = append(records, rec)
+	})
+	defer SetAuditHook(nil)
+
+	r := &fakeRunner{output: func(args []string) (string, error) {
+		if args[1] == "destroy" {
+			return "", exitError(1)
+		}
+		return "", nil
+	}}
+	ctx := WithRunner(context.Background(), r)
+	if err := zfs(ctx, "snapshot", "tank/fs@a"); err != nil {
+		t.Fatal(err)
+	}
+	err := zfs(ctx, "destroy", "tank/fs@b")
+	if err == nil {
+		t.Fatal("expected error")
+	}
+
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(records))
+	}
+	rec := records[0]
+	if rec.Command != "zfs" || strings.Join(rec.Args, " ") != "snapshot tank/fs@a" || !rec.Mutating || rec.DryRun ||
+		rec.ExitCode != 0 || rec.Err != nil || rec.Start.IsZero() {
+		t.Fatalf("unexpected record %+v", rec)
+	}
+	rec = records[1]
+	if rec.ExitCode != 1 || !errors.Is(rec.Err, err) {
+		t.Fatalf("unexpected record of failed command %+v", rec)
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	var records []*CommandRecord
+	SetAuditHook(func(rec *CommandRecord) {
+		records = append(records, rec)
+	})
+	defer SetAuditHook(nil)
+
+	ctx, r := withFakeRunner("tank\n")
+	ctx = WithDryRun(ctx, true)
+	if err := zfs(ctx, "destroy", "-r", "tank/fs"); err != nil {
+		t.Fatal(err)
+	}
+	out, err := zfsOutput(ctx, "list", "-H", "-o", "name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.calls) != 1 || r.calls[0][1] != "list" || len(out) != 1 {
+		t.Fatalf("expected only zfs list to run, got %q", r.calls)
+	}
+	if len(records) != 2 || !records[0].DryRun || records[0].Duration != 0 || records[1].DryRun {
+		t.Fatalf("unexpected records %+v", records)
+	}
+
+	SetDryRun(true)
+	defer SetDryRun(false)
+	if err := zfs(WithDryRun(ctx, false), "destroy", "tank/fs"); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.calls) != 2 {
+		t.Fatalf("expected WithDryRun to override SetDryRun, got %q", r.calls)
+	}
+}
+
+func TestDryRunConcurrent(t *testing.T) {
+	defer SetDryRun(false)
+	defer SetAuditHook(nil)
+
+	// run with -race to detect unsynchronized access
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				SetDryRun(j%2 == 0)
+				SetAuditHook(func(*CommandRecord) {})
+				dryRunFromContext(context.Background())
+				audit(&CommandRecord{Command: "zfs"})
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,347 @@
+// Package bootenv manages boot environments in the style of bectl: bootable root filesystems which are children of
+// a common root dataset, such as zroot/ROOT/default, one of which is booted by default as selected by the bootfs
+// property of its pool. This is the layout of FreeBSD and of Linux systems booted by ZFSBootMenu, built on go-zfs.
+//
+// Usage:
+//
+//	m := &bootenv.Manager{Root: "zroot/ROOT"}
+//	be, err := m.Create("upgrade", "")
+//	err = m.Mount("upgrade", "/mnt")
+//	// upgrade the system below /mnt
+//	err = m.Unmount("upgrade", false)
+//	err = m.Activate("upgrade")
+package bootenv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	zfs "github.com/mistifyio/go-zfs/v3"
+)
+
+// snapshotLayout is the format of the names of the snapshots Create clones boot environments from, as used by bectl.
+const snapshotLayout = "2006-01-02-15:04:05"
+
+// inheritedFromOrigin are the properties clones always take from their origin, which cannot be set on them.
+var inheritedFromOrigin = map[string]bool{
+	"encryption": true, "keyformat": true, "keylocation": true, "pbkdf2iters": true,
+}
+
+// Manager manages the boot environments below a root dataset.
+type Manager struct {
+	// Root is the dataset the boot environments are children of, e.g. zroot/ROOT.
+	Root string
+}
+
+// BootEnvironment is a boot environment, a child filesystem of the root dataset of a Manager.
+type BootEnvironment struct {
+	// Name is the name of the boot environment below the root, e.g. default.
+	Name string
+	// Dataset is the full name of its filesystem, e.g. zroot/ROOT/default.
+	Dataset string
+	// Origin is the snapshot the boot environment was cloned from, empty if it is not a clone.
+	Origin string
+	// Created is the time the filesystem was created.
+	Created time.Time
+	// Used is the space used by the filesystem and its descendents in bytes.
+	Used uint64
+	// Active is set for the boot environment booted by default, the bootfs of the pool.
+	Active bool
+	// Running is set for the boot environment mounted on /, usually the one the system was booted from.
+	Running bool
+	// Mountpoint is the directory the filesystem is mounted on, empty if it is not mounted.
+	Mountpoint string
+}
+
+// Discover returns a Manager of the boot environments of the running system, whose root is the parent of the
+// filesystem mounted on /.
+func Discover() (*Manager, error) {
+	return DiscoverContext(context.Background())
+}
+
+// DiscoverContext is like Discover but includes a context.
+func DiscoverContext(ctx context.Context) (*Manager, error) {
+	mounts, err := zfs.MountsContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for name, dir := range mounts {
+		if dir == "/" && strings.Contains(name, "/") {
+			return &Manager{Root: path.Dir(name)}, nil
+		}
+	}
+	return nil, errors.New("no boot environment is mounted on /")
+}
+
+func (m *Manager) pool() string {
+	return strings.SplitN(m.Root, "/", 2)[0]
+}
+
+func (m *Manager) dataset(name string) (string, error) {
+	if name == "" || strings.ContainsAny(name, "/@#") {
+		return "", fmt.Errorf("invalid boot environment name %q", name)
+	}
+	return m.Root + "/" + name, nil
+}
+
+// List returns the boot environments in order of their names.
+func (m *Manager) List() ([]*BootEnvironment, error) {
+	return m.ListContext(context.Background())
+}
+
+// ListContext is like List but includes a context.
+func (m *Manager) ListContext(ctx context.Context) ([]*BootEnvironment, error) {
+	if err := zfs.ValidateDatasetName(m.Root); err != nil {
+		return nil, err
+	}
+	datasets, err := zfs.ListDatasetsContext(ctx, zfs.ListOptions{
+		Root:       m.Root,
+		Depth:      1,
+		Types:      []string{zfs.DatasetFilesystem},
+		Properties: []string{"origin", "creation", "used"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	bootfs, err := (&zfs.Zpool{Name: m.pool()}).GetPropertyContext(ctx, "bootfs")
+	if err != nil {
+		return nil, err
+	}
+	mounts, err := zfs.MountsContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var envs []*BootEnvironment
+	for _, d := range datasets {
+		if d.Name == m.Root {
+			continue
+		}
+		envs = append(envs, &BootEnvironment{
+			Name:       path.Base(d.Name),
+			Dataset:    d.Name,
+			Origin:     d.Origin,
+			Created:    d.Creation,
+			Used:       d.Used,
+			Active:     d.Name == bootfs,
+			Running:    mounts[d.Name] == "/",
+			Mountpoint: mounts[d.Name],
+		})
+	}
+	return envs, nil
+}
+
+// Get returns the boot environment of the given name.
+func (m *Manager) Get(name string) (*BootEnvironment, error) {
+	return m.GetContext(context.Background(), name)
+}
+
+// GetContext is like Get but includes a context.
+func (m *Manager) GetContext(ctx context.Context, name string) (*BootEnvironment, error) {
+	if _, err := m.dataset(name); err != nil {
+		return nil, err
+	}
+	envs, err := m.ListContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, be := range envs {
+		if be.Name == name {
+			return be, nil
+		}
+	}
+	return nil, fmt.Errorf("boot environment %s does not exist", name)
+}
+
+// Create creates a boot environment cloned from source, which is either a boot environment, which is
+// snapshotted first, or a snapshot of one such as default@2024-01-01. If source is empty, the running boot
+// environment is cloned, or else the active one.
+//
+// The new boot environment has the local properties of its source, with canmount set to noauto so it is only
+// mounted when booted. Descendents of the source are not cloned.
+func (m *Manager) Create(name, source string) (*BootEnvironment, error) {
+	return m.CreateContext(context.Background(), name, source)
+}
+
+// CreateContext is like Create but includes a context.
+func (m *Manager) CreateContext(ctx context.Context, name, source string) (*BootEnvironment, error) {
+	dest, err := m.dataset(name)
+	if err != nil {
+		return nil, err
+	}
+	snapshot, err := m.sourceSnapshot(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+
+	fs, err := zfs.GetDatasetContext(ctx, strings.SplitN(snapshot, "@", 2)[0])
+	if err != nil {
+		return nil, err
+	}
+	props, err := fs.PropertiesContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	clone := map[string]string{}
+	for key, prop := range props.Raw {
+		if zfs.ParsePropertySource(prop.Source).Kind == zfs.SourceLocal && !inheritedFromOrigin[key] {
+			clone[key] = prop.Value
+		}
+	}
+	clone["canmount"] = "noauto"
+
+	if strings.HasSuffix(snapshot, "@") {
+		snap, err := fs.SnapshotContext(ctx, time.Now().UTC().Format(snapshotLayout), false)
+		if err != nil {
+			return nil, err
+		}
+		snapshot = snap.Name
+	}
+	snap := &zfs.Dataset{Name: snapshot, Type: zfs.DatasetSnapshot}
+	if _, err := snap.CloneContext(ctx, dest, clone); err != nil {
+		return nil, err
+	}
+	return m.GetContext(ctx, name)
+}
+
+// sourceSnapshot returns the full name of the snapshot of source, or the name of its filesystem followed by @ if
+// it is a boot environment to snapshot.
+func (m *Manager) sourceSnapshot(ctx context.Context, source string) (string, error) {
+	if strings.Contains(source, "@") {
+		parts := strings.SplitN(source, "@", 2)
+		if _, err := m.dataset(parts[0]); err != nil {
+			return "", err
+		}
+		return m.Root + "/" + source, nil
+	}
+	if source != "" {
+		fs, err := m.dataset(source)
+		return fs + "@", err
+	}
+
+	envs, err := m.ListContext(ctx)
+	if err != nil {
+		return "", err
+	}
+	var active *BootEnvironment
+	for _, be := range envs {
+		if be.Running {
+			return be.Dataset + "@", nil
+		}
+		if be.Active {
+			active = be
+		}
+	}
+	if active == nil {
+		return "", fmt.Errorf("no boot environment of %s is running or active", m.Root)
+	}
+	return active.Dataset + "@", nil
+}
+
+// Activate makes the boot environment the one booted by default, by setting the bootfs property of the pool.
+// A boot environment which is a clone is promoted, so the boot environment it was cloned from can be destroyed.
+func (m *Manager) Activate(name string) error {
+	return m.ActivateContext(context.Background(), name)
+}
+
+// ActivateContext is like Activate but includes a context.
+func (m *Manager) ActivateContext(ctx context.Context, name string) error {
+	be, err := m.GetContext(ctx, name)
+	if err != nil {
+		return err
+	}
+	if be.Origin != "" {
+		fs := &zfs.Dataset{Name: be.Dataset, Type: zfs.DatasetFilesystem}
+		if _, err := fs.PromoteContext(ctx); err != nil {
+			return err
+		}
+	}
+	return (&zfs.Zpool{Name: m.pool()}).SetPropertyContext(ctx, "bootfs", be.Dataset)
+}
+
+// Destroy destroys the boot environment and its snapshots. The active and the running boot environment cannot be
+// destroyed. If destroyOrigin is set, the snapshot the boot environment was cloned from is destroyed too.
+func (m *Manager) Destroy(name string, destroyOrigin bool) error {
+	return m.DestroyContext(context.Background(), name, destroyOrigin)
+}
+
+// DestroyContext is like Destroy but includes a context.
+func (m *Manager) DestroyContext(ctx context.Context, name string, destroyOrigin bool) error {
+	be, err := m.GetContext(ctx, name)
+	if err != nil {
+		return err
+	}
+	switch {
+	case be.Active:
+		return fmt.Errorf("cannot destroy the active boot environment %s", name)
+	case be.Running:
+		return fmt.Errorf("cannot destroy the running boot environment %s", name)
+	}
+	fs := &zfs.Dataset{Name: be.Dataset, Type: zfs.DatasetFilesystem}
+	if err := fs.DestroyContext(ctx, zfs.DestroyRecursive); err != nil {
+		return err
+	}
+	if destroyOrigin && be.Origin != "" {
+		origin := &zfs.Dataset{Name: be.Origin, Type: zfs.DatasetSnapshot}
+		return origin.DestroyContext(ctx, zfs.DestroyDefault)
+	}
+	return nil
+}
+
+// Rename renames the boot environment, the bootfs property of the pool follows the active one.
+func (m *Manager) Rename(name, newName string) error {
+	return m.RenameContext(context.Background(), name, newName)
+}
+
+// RenameContext is like Rename but includes a context.
+func (m *Manager) RenameContext(ctx context.Context, name, newName string) error {
+	dest, err := m.dataset(newName)
+	if err != nil {
+		return err
+	}
+	be, err := m.GetContext(ctx, name)
+	if err != nil {
+		return err
+	}
+	fs := &zfs.Dataset{Name: be.Dataset, Type: zfs.DatasetFilesystem}
+	if _, err := fs.RenameContext(ctx, dest, false, false); err != nil {
+		return err
+	}
+	if be.Active {
+		return (&zfs.Zpool{Name: m.pool()}).SetPropertyContext(ctx, "bootfs", dest)
+	}
+	return nil
+}
+
+// Mount mounts the boot environment on dir, e.g. to update it before activating it. See zfs.Dataset.MountAt.
+func (m *Manager) Mount(name, dir string) error {
+	return m.MountContext(context.Background(), name, dir)
+}
+
+// MountContext is like Mount but includes a context.
+func (m *Manager) MountContext(ctx context.Context, name, dir string) error {
+	fs, err := m.dataset(name)
+	if err != nil {
+		return err
+	}
+	return (&zfs.Dataset{Name: fs, Type: zfs.DatasetFilesystem}).MountAtContext(ctx, dir)
+}
+
+// Unmount unmounts the boot environment, optionally forcing it to be unmounted if it is busy.
+func (m *Manager) Unmount(name string, force bool) error {
+	return m.UnmountContext(context.Background(), name, force)
+}
+
+// UnmountContext is like Unmount but includes a context.
+func (m *Manager) UnmountContext(ctx context.Context, name string, force bool) error {
+	fs, err := m.dataset(name)
+	if err != nil {
+		return err
+	}
+	_, err = (&zfs.Dataset{Name: fs, Type: zfs.DatasetFilesystem}).UnmountContext(ctx, force)
+	return err
+}
@@ -0,0 +1,140 @@
+package bootenv
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	zfs "github.com/mistifyio/go-zfs/v3"
+	"github.com/mistifyio/go-zfs/v3/zfstest"
+)
+
+func ok(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func equals(t *testing.T, want, got interface{}) {
+	t.Helper()
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("want: %#v, got: %#v", want, got)
+	}
+}
+
+// mountRunner runs zfs and zpool with a backend and records the other commands, such as mount.
+type mountRunner struct {
+	*zfstest.Backend
+	commands [][]string
+}
+
+func (r *mountRunner) Run(ctx context.Context, name string, args ...string) ([]byte, []byte, error) {
+	if name != "zfs" && name != "zpool" {
+		r.commands = append(r.commands, append([]string{name}, args...))
+		return nil, nil, nil
+	}
+	return r.Backend.Run(ctx, name, args...)
+}
+
+// setup returns a context with the boot environment zroot/ROOT/default, which is active and mounted on /.
+func setup(t *testing.T) (context.Context, *mountRunner) {
+	t.Helper()
+	r := &mountRunner{Backend: zfstest.New()}
+	ctx := zfs.WithRunner(context.Background(), r)
+	_, err := zfs.CreateZpoolContext(ctx, "zroot", nil, "disk0")
+	ok(t, err)
+	_, err = zfs.CreateFilesystemContext(ctx, "zroot/ROOT", map[string]string{"canmount": "off", "mountpoint": "none"})
+	ok(t, err)
+	_, err = zfs.CreateFilesystemContext(ctx, "zroot/ROOT/default", map[string]string{"mountpoint": "/", "atime": "off"})
+	ok(t, err)
+	ok(t, (&zfs.Zpool{Name: "zroot"}).SetPropertyContext(ctx, "bootfs", "zroot/ROOT/default"))
+	return ctx, r
+}
+
+func names(envs []*BootEnvironment) []string {
+	var names []string
+	for _, be := range envs {
+		names = append(names, be.Name)
+	}
+	return names
+}
+
+func TestBootEnvironments(t *testing.T) {
+	ctx, _ := setup(t)
+	m, err := DiscoverContext(ctx)
+	ok(t, err)
+	equals(t, "zroot/ROOT", m.Root)
+
+	be, err := m.CreateContext(ctx, "upgrade", "")
+	ok(t, err)
+	equals(t, "zroot/ROOT/upgrade", be.Dataset)
+	if !strings.HasPrefix(be.Origin, "zroot/ROOT/default@") || be.Active || be.Running || be.Mountpoint != "" {
+		t.Fatalf("unexpected boot environment: %+v", be)
+	}
+	props, err := (&zfs.Dataset{Name: be.Dataset}).PropertiesContext(ctx)
+	ok(t, err)
+	if props.Mountpoint != "/" || props.CanMount != "noauto" || props.Atime {
+		t.Fatalf("expected local properties of the source, got: %+v", props)
+	}
+
+	// a snapshot of a boot environment is cloned as it is
+	_, err = (&zfs.Dataset{Name: "zroot/ROOT/default"}).SnapshotContext(ctx, "pre", false)
+	ok(t, err)
+	be, err = m.CreateContext(ctx, "old", "default@pre")
+	ok(t, err)
+	equals(t, "zroot/ROOT/default@pre", be.Origin)
+
+	envs, err := m.ListContext(ctx)
+	ok(t, err)
+	equals(t, []string{"default", "old", "upgrade"}, names(envs))
+	if !envs[0].Active || !envs[0].Running || envs[0].Mountpoint != "/" {
+		t.Fatalf("expected default to be active and running, got: %+v", envs[0])
+	}
+
+	ok(t, m.ActivateContext(ctx, "upgrade"))
+	be, err = m.GetContext(ctx, "upgrade")
+	ok(t, err)
+	if !be.Active || be.Origin != "" {
+		t.Fatalf("expected upgrade to be active and promoted, got: %+v", be)
+	}
+	ok(t, m.RenameContext(ctx, "upgrade", "next"))
+	be, err = m.GetContext(ctx, "next")
+	ok(t, err)
+	equals(t, true, be.Active)
+
+	if err := m.DestroyContext(ctx, "next", false); err == nil {
+		t.Fatal("expected error destroying the active boot environment")
+	}
+	if err := m.DestroyContext(ctx, "default", false); err == nil {
+		t.Fatal("expected error destroying the running boot environment")
+	}
+	ok(t, m.DestroyContext(ctx, "old", true))
+	envs, err = m.ListContext(ctx)
+	ok(t, err)
+	equals(t, []string{"default", "next"}, names(envs))
+	if _, err := zfs.GetDatasetContext(ctx, "zroot/ROOT/default@pre"); err == nil {
+		t.Fatal("expected origin snapshot to be destroyed")
+	}
+
+	if _, err := m.CreateContext(ctx, "a/b", ""); err == nil {
+		t.Fatal("expected error for invalid name")
+	}
+	if _, err := m.GetContext(ctx, "missing"); err == nil {
+		t.Fatal("expected error for missing boot environment")
+	}
+}
+
+func TestMount(t *testing.T) {
+	ctx, r := setup(t)
+	m := &Manager{Root: "zroot/ROOT"}
+	_, err := m.CreateContext(ctx, "upgrade", "default")
+	ok(t, err)
+	ok(t, m.MountContext(zfs.WithPlatform(ctx, zfs.LinuxPlatform{}), "upgrade", "/mnt"))
+	ok(t, m.MountContext(zfs.WithPlatform(ctx, zfs.FreeBSDPlatform{}), "upgrade", "/mnt"))
+	equals(t, [][]string{
+		{"mount", "-t", "zfs", "-o", "zfsutil", "zroot/ROOT/upgrade", "/mnt"},
+		{"mount", "-t", "zfs", "zroot/ROOT/upgrade", "/mnt"},
+	}, r.commands)
+}
@@ -0,0 +1,127 @@
+package zfs
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// commandCache holds the output of read-only commands, such as zpool list or zfs get, until it expires or a
+// mutating command is run on the same pool.
+type commandCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[cacheKey]*cacheEntry
+}
+
+type cacheKey struct {
+	runner Runner
+	args   string
+}
+
+type cacheEntry struct {
+	pool    string
+	stdout  []byte
+	expires time.Time
+}
+
+var (
+	cacheMu     sync.Mutex
+	activeCache *commandCache
+)
+
+// SetCacheTTL enables caching the output of the zfs and zpool commands which only read, such as those of ListZpools,
+// GetDataset or GetProperty, for ttl, so callers polling the same lookups do not run a command for every call.
+// Cached output is dropped once a mutating command is run on the same pool through the library, or on any pool
+// for the output of commands which do not act on a single pool, such as zpool list. Changes made by other
+// processes are only seen once the output expires. Output is cached per Runner.
+//
+// A zero ttl, the default, disables caching and drops all cached output. See WithoutCache to bypass the cache.
+func SetCacheTTL(ttl time.Duration) {
+	var c *commandCache
+	if ttl > 0 {
+		c = &commandCache{ttl: ttl, entries: map[cacheKey]*cacheEntry{}}
+	}
+	cacheMu.Lock()
+	activeCache = c
+	cacheMu.Unlock()
+}
+
+// InvalidateCache drops all cached output, e.g. after changing pools by other means than the library.
+func InvalidateCache() {
+	if c := currentCache(); c != nil {
+		c.mu.Lock()
+		c.entries = map[cacheKey]*cacheEntry{}
+		c.mu.Unlock()
+	}
+}
+
+func currentCache() *commandCache {
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	return activeCache
+}
+
+type noCacheKey struct{}
+
+// WithoutCache returns a copy of ctx which makes the Context variants of the library's functions run their
+// commands rather than return cached output. The output is still cached for later calls.
+func WithoutCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noCacheKey{}, true)
+}
+
+func cacheBypassed(ctx context.Context) bool {
+	bypass, _ := ctx.Value(noCacheKey{}).(bool)
+	return bypass
+}
+
+// key returns the key of the output of a command run by r, false if it is not cached.
+func (c *commandCache) key(r Runner, cmd *command, arg []string) (cacheKey, bool) {
+	if cmd.Command != "zfs" && cmd.Command != "zpool" || cmd.Stdin != nil || cmd.stream || len(arg) == 0 ||
+		arg[0] == "wait" || IsMutatingCommand(cmd.Command, arg) {
+		return cacheKey{}, false
+	}
+	// runners whose values cannot be compared, such as funcs, cannot tell apart their entries
+	if !reflect.TypeOf(r).Comparable() {
+		return cacheKey{}, false
+	}
+	return cacheKey{runner: r, args: cmd.Command + "\x00" + strings.Join(arg, "\x00")}, true
+}
+
+func (c *commandCache) get(key cacheKey) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(e.expires) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return e.stdout, true
+}
+
+func (c *commandCache) put(key cacheKey, pool string, stdout []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = &cacheEntry{pool: pool, stdout: stdout, expires: time.Now().Add(c.ttl)}
+}
+
+// invalidate drops the output of commands on the pool, and of those not acting on a single pool.
+// All output of r is dropped if pool is empty.
+func (c *commandCache) invalidate(r Runner, pool string) {
+	if !reflect.TypeOf(r).Comparable() {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, e := range c.entries {
+		if key.runner == r && (pool == "" || e.pool == "" || e.pool == pool) {
+			delete(c.entries, key)
+		}
+	}
+}
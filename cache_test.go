@@ -0,0 +1,69 @@
+package zfs
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	SetCacheTTL(time.Minute)
+	defer SetCacheTTL(0)
+
+	ctx, r := withFakeRunner("tank\tONLINE\n")
+	list := func(ctx context.Context) {
+		t.Helper()
+		out, err := zpoolOutput(ctx, "list", "-H", "-o", "name,health")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(out) != 1 || out[0][0] != "tank" {
+			t.Fatalf("unexpected output %q", out)
+		}
+	}
+	get := func(pool string) {
+		t.Helper()
+		if _, err := zpoolOutput(ctx, "get", "-Hp", "all", pool); err != nil {
+			t.Fatal(err)
+		}
+	}
+	count := func(want int) {
+		t.Helper()
+		if len(r.calls) != want {
+			t.Fatalf("expected %d commands, got %d: %q", want, len(r.calls), r.calls)
+		}
+	}
+
+	list(ctx)
+	list(ctx)
+	get("tank")
+	get("backup")
+	get("tank")
+	count(3)
+
+	list(WithoutCache(ctx))
+	count(4)
+	list(ctx)
+	count(4)
+
+	// a change of backup drops the output of its commands and of zpool list, but not that of tank
+	if err := zfs(ctx, "snapshot", "backup/fs@a"); err != nil {
+		t.Fatal(err)
+	}
+	count(5)
+	get("tank")
+	count(5)
+	get("backup")
+	list(ctx)
+	count(7)
+
+	InvalidateCache()
+	get("tank")
+	count(8)
+
+	SetCacheTTL(time.Nanosecond)
+	list(ctx)
+	time.Sleep(time.Millisecond)
+	list(ctx)
+	count(10)
+}
@@ -0,0 +1,213 @@
+package zfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrNotSupported is returned for operations the installed ZFS is known not to support, see DetectCapabilities.
+var ErrNotSupported = errors.New("not supported by this version of ZFS")
+
+// Version is a ZFS version as printed by zfs version, such as 2.1.5.
+type Version struct {
+	Major int
+	Minor int
+	Patch int
+	// Raw is the full version including any distribution suffix, e.g. 2.1.5-1ubuntu6~22.04.1.
+	Raw string
+}
+
+// AtLeast reports whether v is the given version or a later one.
+func (v Version) AtLeast(major, minor, patch int) bool {
+	if v.Major != major {
+		return v.Major > major
+	}
+	if v.Minor != minor {
+		return v.Minor > minor
+	}
+	return v.Patch >= patch
+}
+
+// IsZero reports whether the version is not known.
+func (v Version) IsZero() bool {
+	return v == Version{}
+}
+
+func (v Version) String() string {
+	if v.Raw != "" {
+		return v.Raw
+	}
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+var versionPattern = regexp.MustCompile(`^v?(\d+)\.(\d+)(?:\.(\d+))?`)
+
+// ParseVersion parses a version such as 2.1.5, 2.2.0-rc3 or 0.8.3-1ubuntu12.
+func ParseVersion(s string) (Version, error) {
+	m := versionPattern.FindStringSubmatch(s)
+	if m == nil {
+		return Version{}, fmt.Errorf("invalid version %q", s)
+	}
+	v := Version{Raw: s}
+	v.Major, _ = strconv.Atoi(m[1])
+	v.Minor, _ = strconv.Atoi(m[2])
+	if m[3] != "" {
+		v.Patch, _ = strconv.Atoi(m[3])
+	}
+	return v, nil
+}
+
+// Capabilities are the features of the installed ZFS which decide the syntax the library uses. The library
+// runs on ZFS on Linux 0.8 up to OpenZFS 2.3, where something is not supported it falls back to older syntax
+// or fails early with ErrNotSupported.
+type Capabilities struct {
+	// Userland is the version of the zfs and zpool commands, Kernel that of the loaded kernel module.
+	// Both are zero if zfs version is not supported, as before ZFS on Linux 0.8.
+	Userland Version
+	Kernel   Version
+	// JSON is set if zfs and zpool print JSON output with -j, since OpenZFS 2.3.
+	JSON bool
+	// RawSend is set if encrypted datasets can be sent raw (zfs send -w), since ZFS on Linux 0.8.
+	RawSend bool
+	// Draid is set if pools can be created with draid vdevs, since OpenZFS 2.1.
+	Draid bool
+	// Zstd is set if datasets can be compressed with zstd, since OpenZFS 2.0.
+	Zstd bool
+	// ResilverDefer is set if resilvers are deferred while one is in progress and can be restarted with zpool
+	// resilver, since ZFS on Linux 0.8.
+	ResilverDefer bool
+	// RaidzExpansion is set if raidz vdevs can be expanded by attaching devices, since OpenZFS 2.3.
+	RaidzExpansion bool
+	// Features are the names of the pool features supported, as listed by SupportedFeatures.
+	Features []string
+}
+
+// HasFeature reports whether the pool feature of the given name, such as encryption, is supported.
+func (c *Capabilities) HasFeature(name string) bool {
+	for _, f := range c.Features {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
+
+var capabilities sync.Map // Runner => *Capabilities
+
+// DetectCapabilities runs zfs version and zpool upgrade -v to find the capabilities of the installed ZFS.
+// The result is kept for the Runner, after which the library uses it to choose its syntax, e.g. whether to
+// request JSON output, and to reject raw sends or draid vdevs which are not supported before running any
+// command. Without a call to DetectCapabilities the library does not check for capabilities.
+//
+// Capabilities which cannot be probed are derived from the version, if that is not known they are assumed to
+// be missing.
+func DetectCapabilities() (*Capabilities, error) {
+	return DetectCapabilitiesContext(context.Background())
+}
+
+// DetectCapabilitiesContext is like DetectCapabilities but includes a context.
+func DetectCapabilitiesContext(ctx context.Context) (*Capabilities, error) {
+	caps := &Capabilities{}
+	out, err := zfsRawOutput(ctx, "version")
+	var zerr *Error
+	switch {
+	case err == nil:
+		if caps.Userland, caps.Kernel, err = parseVersions(out); err != nil {
+			return nil, err
+		}
+	case !errors.As(err, &zerr) || zerr.ExitCode <= 0:
+		// versions without zfs version reject it with a usage error, anything else is a failure to run zfs
+		return nil, err
+	}
+
+	if !caps.Userland.IsZero() {
+		caps.JSON = caps.Userland.AtLeast(2, 3, 0) && probeJSON(ctx)
+	}
+	features, err := SupportedFeaturesContext(ctx)
+	if err != nil && ctx.Err() != nil {
+		return nil, err
+	}
+	if err == nil {
+		for _, f := range features {
+			caps.Features = append(caps.Features, f.Name)
+		}
+		caps.RawSend = caps.HasFeature("encryption")
+		caps.Draid = caps.HasFeature("draid")
+		caps.Zstd = caps.HasFeature("zstd_compress")
+		caps.ResilverDefer = caps.HasFeature("resilver_defer")
+		caps.RaidzExpansion = caps.HasFeature("raidz_expansion")
+	} else {
+		caps.RawSend = caps.Userland.AtLeast(0, 8, 0)
+		caps.Draid = caps.Userland.AtLeast(2, 1, 0)
+		caps.Zstd = caps.Userland.AtLeast(2, 0, 0)
+		caps.ResilverDefer = caps.Userland.AtLeast(0, 8, 0)
+		caps.RaidzExpansion = caps.Userland.AtLeast(2, 3, 0)
+	}
+
+	if r := runnerFromContext(ctx); r != nil && reflect.TypeOf(r).Comparable() {
+		capabilities.Store(r, caps)
+		jsonSupport.Store(r, caps.JSON)
+	}
+	return caps, nil
+}
+
+// knownCapabilities returns the capabilities detected for the Runner of ctx, nil if they were not detected.
+func knownCapabilities(ctx context.Context) *Capabilities {
+	r := runnerFromContext(ctx)
+	if r == nil || !reflect.TypeOf(r).Comparable() {
+		return nil
+	}
+	if caps, ok := capabilities.Load(r); ok {
+		return caps.(*Capabilities)
+	}
+	return nil
+}
+
+// example input for parseVersions
+// zfs-2.1.5-1ubuntu6~22.04.1
+// zfs-kmod-2.1.5-1ubuntu6~22.04.1
+func parseVersions(out []byte) (userland, kernel Version, err error) {
+	for _, line := range strings.Split(string(out), "\n") {
+		line = strings.TrimSpace(line)
+		var v *Version
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "zfs-kmod-"):
+			v, line = &kernel, strings.TrimPrefix(line, "zfs-kmod-")
+		case strings.HasPrefix(line, "zfs-"):
+			v, line = &userland, strings.TrimPrefix(line, "zfs-")
+		default:
+			return Version{}, Version{}, fmt.Errorf("invalid zfs version output %q", line)
+		}
+		if *v, err = ParseVersion(line); err != nil {
+			return Version{}, Version{}, err
+		}
+	}
+	if userland.IsZero() {
+		return Version{}, Version{}, fmt.Errorf("invalid zfs version output %q", out)
+	}
+	return userland, kernel, nil
+}
+
+// requireDraid fails with ErrNotSupported if spec has draid vdevs but they are known not to be supported.
+func requireDraid(ctx context.Context, spec *VdevSpec) error {
+	caps := knownCapabilities(ctx)
+	if caps == nil || caps.Draid {
+		return nil
+	}
+	for _, groups := range [][]VdevGroup{spec.Data, spec.Special, spec.Dedup} {
+		for _, g := range groups {
+			if strings.HasPrefix(g.Type, "draid") {
+				return fmt.Errorf("%s vdevs: %w", g.Type, ErrNotSupported)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package zfs
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const upgradeFeatures = `This system supports ZFS pool feature flags.
+
+The following features are supported:
+
+FEAT DESCRIPTION
+-------------------------------------------------------------
+async_destroy                         (read-only compatible)
+     Destroy filesystems asynchronously.
+encryption
+     Support for dataset level encryption
+draid
+     Support for distributed spare RAID
+`
+
+// capabilitiesRunner answers the commands of DetectCapabilities with the given zfs version output, failing
+// with an exit code if version is empty.
+func capabilitiesRunner(version string) *fakeRunner {
+	return &fakeRunner{output: func(args []string) (string, error) {
+		switch strings.Join(args, " ") {
+		case "zfs version":
+			if version == "" {
+				return "", exitError(2)
+			}
+			return version, nil
+		case "zfs version -j":
+			return jsonVersion, nil
+		case "zpool upgrade -v":
+			return upgradeFeatures, nil
+		}
+		return "", nil
+	}}
+}
+
+func TestDetectCapabilities(t *testing.T) {
+	r := capabilitiesRunner("zfs-2.1.5-1ubuntu6~22.04.1\nzfs-kmod-2.1.5-1ubuntu6~22.04.1\n")
+	ctx := WithRunner(context.Background(), r)
+	caps, err := DetectCapabilitiesContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Capabilities{
+		Userland: Version{Major: 2, Minor: 1, Patch: 5, Raw: "2.1.5-1ubuntu6~22.04.1"},
+		Kernel:   Version{Major: 2, Minor: 1, Patch: 5, Raw: "2.1.5-1ubuntu6~22.04.1"},
+		RawSend:  true,
+		Draid:    true,
+		Features: []string{"async_destroy", "encryption", "draid"},
+	}
+	if !reflect.DeepEqual(want, caps) {
+		t.Fatalf("want: %+v, got: %+v", want, caps)
+	}
+	if knownCapabilities(ctx) != caps {
+		t.Fatal("expected capabilities to be kept for the runner")
+	}
+	// JSON is not probed before 2.3, and its detection is not repeated
+	if useJSON(ctx) {
+		t.Fatal("expected JSON output to be disabled")
+	}
+	wantCalls := [][]string{{"zfs", "version"}, {"zpool", "upgrade", "-v"}}
+	if !reflect.DeepEqual(wantCalls, r.calls) {
+		t.Fatalf("want calls: %q, got: %q", wantCalls, r.calls)
+	}
+
+	r = capabilitiesRunner("zfs-2.3.0-1\nzfs-kmod-2.2.7-1\n")
+	caps, err = DetectCapabilitiesContext(WithRunner(context.Background(), r))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !caps.JSON || !caps.Kernel.AtLeast(2, 2, 7) || caps.Kernel.AtLeast(2, 3, 0) {
+		t.Fatalf("unexpected capabilities: %+v", caps)
+	}
+}
+
+func TestDetectCapabilitiesWithoutVersion(t *testing.T) {
+	r := capabilitiesRunner("")
+	inner := r.output
+	r.output = func(args []string) (string, error) {
+		if args[1] == "upgrade" {
+			return "", exitError(1)
+		}
+		return inner(args)
+	}
+	caps, err := DetectCapabilitiesContext(WithRunner(context.Background(), r))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !caps.Userland.IsZero() || caps.RawSend || caps.Draid || caps.Zstd || caps.JSON {
+		t.Fatalf("expected no capabilities, got: %+v", caps)
+	}
+
+	r = &fakeRunner{output: func([]string) (string, error) { return "", errors.New("exec: not found") }}
+	if _, err := DetectCapabilitiesContext(WithRunner(context.Background(), r)); err == nil {
+		t.Fatal("expected error when zfs cannot be run")
+	}
+}
+
+func TestParseVersion(t *testing.T) {
+	for s, want := range map[string]Version{
+		"2.2.0-rc3":           {Major: 2, Minor: 2, Patch: 0, Raw: "2.2.0-rc3"},
+		"0.8.3-1ubuntu12":     {Major: 0, Minor: 8, Patch: 3, Raw: "0.8.3-1ubuntu12"},
+		"2.1.99-FreeBSD_g1a2": {Major: 2, Minor: 1, Patch: 99, Raw: "2.1.99-FreeBSD_g1a2"},
+		"v2.3":                {Major: 2, Minor: 3, Raw: "v2.3"},
+	} {
+		got, err := ParseVersion(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want != got {
+			t.Fatalf("want: %+v, got: %+v", want, got)
+		}
+	}
+	if _, err := ParseVersion("unknown"); err == nil {
+		t.Fatal("expected error for invalid version")
+	}
+	if !(Version{Major: 2, Minor: 1}).AtLeast(0, 8, 0) || (Version{Major: 0, Minor: 8, Patch: 6}).AtLeast(2, 0, 0) {
+		t.Fatal("unexpected version comparison")
+	}
+}
+
+func TestCapabilityGates(t *testing.T) {
+	r := capabilitiesRunner("zfs-0.8.6-1\nzfs-kmod-0.8.6-1\n")
+	inner := r.output
+	r.output = func(args []string) (string, error) {
+		if args[1] == "upgrade" {
+			return strings.Split(upgradeFeatures, "draid")[0], nil
+		}
+		return inner(args)
+	}
+	ctx := WithRunner(context.Background(), r)
+	caps, err := DetectCapabilitiesContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if caps.Draid || !caps.RawSend {
+		t.Fatalf("unexpected capabilities: %+v", caps)
+	}
+	calls := len(r.calls)
+
+	spec := VdevSpec{Data: []VdevGroup{Draid(1, 2, 0, "d0", "d1", "d2")}}
+	if _, err := CreateZpoolWithTopologyContext(ctx, "tank", nil, spec); !errors.Is(err, ErrNotSupported) {
+		t.Fatalf("want ErrNotSupported, got: %v", err)
+	}
+	if err := (&Zpool{Name: "tank"}).AddVdevsContext(ctx, spec, false); !errors.Is(err, ErrNotSupported) {
+		t.Fatalf("want ErrNotSupported, got: %v", err)
+	}
+	if len(r.calls) != calls {
+		t.Fatalf("expected no commands to be run, got: %q", r.calls[calls:])
+	}
+
+	caps.RawSend = false
+	snap := &Dataset{Name: "tank/fs@a", Type: DatasetSnapshot}
+	if err := snap.SendToContext(ctx, ioutil.Discard, SendOptions{Raw: true}); !errors.Is(err, ErrNotSupported) {
+		t.Fatalf("want ErrNotSupported, got: %v", err)
+	}
+}
@@ -0,0 +1,111 @@
+package zfs
+
+import (
+	"context"
+	"sync"
+)
+
+// ConcurrencyLimits restrict how the zfs and zpool commands of concurrent callers run, so they do not stack up
+// dozens of processes or interleave conflicting operations.
+//
+// The limits are shared by all callers within the process, regardless of their Runner.
+type ConcurrencyLimits struct {
+	// MaxCommands is the number of zfs and zpool commands which may run at the same time, unlimited if zero.
+	// Commands which do not change anything and stream their output, such as sends or WatchZpoolEvents, are not
+	// counted as they may run indefinitely.
+	MaxCommands int
+	// SerializePools runs the mutating commands of a pool one at a time, e.g. so a destroy waits for a receive
+	// into the same pool to complete. The pool of a command is told from its arguments as for StructuredLogger,
+	// commands whose pool is not known are not serialized.
+	SerializePools bool
+}
+
+// limiter enforces ConcurrencyLimits.
+type limiter struct {
+	limits ConcurrencyLimits
+	slots  chan struct{}
+
+	mu    sync.Mutex
+	pools map[string]chan struct{}
+}
+
+var (
+	limiterMu     sync.Mutex
+	activeLimiter *limiter
+)
+
+// SetConcurrencyLimits sets the limits of all commands which are started afterwards, commands running already
+// are not counted. The zero value, the default, removes all limits.
+func SetConcurrencyLimits(limits ConcurrencyLimits) {
+	var l *limiter
+	if limits.MaxCommands > 0 || limits.SerializePools {
+		l = &limiter{limits: limits, pools: map[string]chan struct{}{}}
+		if limits.MaxCommands > 0 {
+			l.slots = make(chan struct{}, limits.MaxCommands)
+		}
+	}
+	limiterMu.Lock()
+	activeLimiter = l
+	limiterMu.Unlock()
+}
+
+func currentLimiter() *limiter {
+	limiterMu.Lock()
+	defer limiterMu.Unlock()
+	return activeLimiter
+}
+
+// acquire waits until the command may run and returns the function releasing it, or the error of ctx if it
+// becomes done first. The pool lock is taken before a slot, so commands waiting for their pool do not hold slots.
+func (l *limiter) acquire(ctx context.Context, c *command, mutating bool, arg []string) (func(), error) {
+	if l == nil || (c.Command != "zfs" && c.Command != "zpool") {
+		return func() {}, nil
+	}
+	var pool chan struct{}
+	if l.limits.SerializePools && mutating {
+		if name, _ := commandTarget(c.Command, arg); name != "" {
+			pool = l.poolLock(name)
+		}
+	}
+	slots := l.slots
+	if c.stream && !mutating {
+		slots = nil
+	}
+
+	if pool != nil {
+		select {
+		case pool <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if slots != nil {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			if pool != nil {
+				<-pool
+			}
+			return nil, ctx.Err()
+		}
+	}
+	return func() {
+		if slots != nil {
+			<-slots
+		}
+		if pool != nil {
+			<-pool
+		}
+	}, nil
+}
+
+func (l *limiter) poolLock(name string) chan struct{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	lock, ok := l.pools[name]
+	if !ok {
+		lock = make(chan struct{}, 1)
+		l.pools[name] = lock
+	}
+	return lock
+}
@@ -0,0 +1,121 @@
+package zfs
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// countingRunner records the highest number of commands it runs at the same time, each taking delay.
+type countingRunner struct {
+	delay time.Duration
+
+	mu      sync.Mutex
+	running int
+	max     int
+}
+
+func (r *countingRunner) Run(ctx context.Context, name string, args ...string) ([]byte, []byte, error) {
+	r.mu.Lock()
+	r.running++
+	if r.running > r.max {
+		r.max = r.running
+	}
+	r.mu.Unlock()
+	time.Sleep(r.delay)
+	r.mu.Lock()
+	r.running--
+	r.mu.Unlock()
+	return nil, nil, nil
+}
+
+func runConcurrently(ctx context.Context, t *testing.T, commands ...[]string) {
+	t.Helper()
+	var wg sync.WaitGroup
+	errs := make(chan error, len(commands))
+	for _, args := range commands {
+		wg.Add(1)
+		go func(args []string) {
+			defer wg.Done()
+			c := command{Command: args[0]}
+			_, err := c.Run(ctx, args[1:]...)
+			errs <- err
+		}(args)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestMaxCommands(t *testing.T) {
+	SetConcurrencyLimits(ConcurrencyLimits{MaxCommands: 2})
+	defer SetConcurrencyLimits(ConcurrencyLimits{})
+
+	r := &countingRunner{delay: 5 * time.Millisecond}
+	ctx := WithRunner(context.Background(), r)
+	var commands [][]string
+	for i := 0; i < 8; i++ {
+		commands = append(commands, []string{"zpool", "status", "tank"})
+	}
+	runConcurrently(ctx, t, commands...)
+	if r.max != 2 {
+		t.Fatalf("expected at most 2 concurrent commands, got %d", r.max)
+	}
+}
+
+func TestSerializePools(t *testing.T) {
+	SetConcurrencyLimits(ConcurrencyLimits{SerializePools: true})
+	defer SetConcurrencyLimits(ConcurrencyLimits{})
+
+	r := &countingRunner{delay: 5 * time.Millisecond}
+	ctx := WithRunner(context.Background(), r)
+	runConcurrently(ctx, t,
+		[]string{"zfs", "destroy", "tank/a@1"},
+		[]string{"zfs", "destroy", "tank/b@1"},
+		[]string{"zfs", "snapshot", "tank/c@1"},
+	)
+	if r.max != 1 {
+		t.Fatalf("expected mutating commands of a pool to be serialized, got %d concurrent", r.max)
+	}
+
+	r.max = 0
+	runConcurrently(ctx, t,
+		[]string{"zfs", "destroy", "tank/a@1"},
+		[]string{"zfs", "destroy", "backup/a@1"},
+		[]string{"zfs", "list", "-Hp", "tank/a"},
+	)
+	if r.max < 2 {
+		t.Fatalf("expected commands of other pools and reads to run concurrently, got %d concurrent", r.max)
+	}
+}
+
+func TestConcurrencyLimitsContext(t *testing.T) {
+	SetConcurrencyLimits(ConcurrencyLimits{MaxCommands: 1})
+	defer SetConcurrencyLimits(ConcurrencyLimits{})
+
+	ctx := WithRunner(context.Background(), blockingRunner{})
+	running, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		_ = zpool(running, "status", "tank")
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// the slot is held by the blocking command, the second one gives up waiting
+	time.Sleep(5 * time.Millisecond)
+	waiting, cancelWaiting := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancelWaiting()
+	if err := zpool(waiting, "status", "tank"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected waiting command to time out, got %v", err)
+	}
+}
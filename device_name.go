@@ -0,0 +1,224 @@
+package zfs
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Device naming schemes, which select the names ResolveDeviceName resolves devices to.
+// Pools created or imported with stable names keep finding their devices when kernel names change between boots.
+const (
+	// DeviceNameKernel is the kernel name of the device, e.g. /dev/sda.
+	DeviceNameKernel = "kernel"
+	// DeviceNameByID is a name below /dev/disk/by-id derived from the model and serial number of the device,
+	// e.g. /dev/disk/by-id/ata-ST4000NM0033_Z1Z2ABCD.
+	DeviceNameByID = "by-id"
+	// DeviceNameByPath is a name below /dev/disk/by-path derived from the port the device is attached to,
+	// e.g. /dev/disk/by-path/pci-0000:00:1f.2-ata-1.
+	DeviceNameByPath = "by-path"
+	// DeviceNameWWN is the name below /dev/disk/by-id derived from the World Wide Name of the device,
+	// e.g. /dev/disk/by-id/wwn-0x5000c500a1b2c3d4.
+	DeviceNameWWN = "wwn"
+	// DeviceNameGPT is the GEOM label of a FreeBSD partition derived from its GPT label, e.g. /dev/gpt/zfs0.
+	DeviceNameGPT = "gpt"
+	// DeviceNameGPTID is the GEOM label of a FreeBSD partition derived from its GPT UUID,
+	// e.g. /dev/gptid/3d4b0b0e-8fde-11e9-9561-0cc47a6c3a2c.
+	DeviceNameGPTID = "gptid"
+	// DeviceNameDiskID is the GEOM label of a FreeBSD disk derived from its serial number,
+	// e.g. /dev/diskid/DISK-S3Z9NB0K123456.
+	DeviceNameDiskID = "diskid"
+)
+
+// DeviceLinks provides the names by which a device is known, such as the symlinks udev creates below /dev/disk.
+// Implementations other than UdevLinks may read them from another source of udev data, or from a test fixture.
+type DeviceLinks interface {
+	// DeviceLinks returns the kernel name of the device, e.g. /dev/sda, and all other paths which refer to it.
+	// The device may be given by any of those names.
+	DeviceLinks(ctx context.Context, device string) (kernel string, links []string, err error)
+}
+
+// UdevLinks is the default DeviceLinks, which queries udevadm info with the Runner of the context,
+// so the names are those of the host which runs the commands.
+type UdevLinks struct{}
+
+// DeviceLinks implements DeviceLinks.
+func (UdevLinks) DeviceLinks(ctx context.Context, device string) (string, []string, error) {
+	var out bytes.Buffer
+	c := command{Command: "udevadm", Stdout: &out}
+	if _, err := c.Run(ctx, "info", "--query=all", "--name="+device); err != nil {
+		return "", nil, err
+	}
+	return parseUdevInfo(out.Bytes())
+}
+
+// example input for parseUdevInfo
+// P: /devices/pci0000:00/0000:00:1f.2/ata1/host0/target0:0:0/0:0:0:0/block/sda
+// N: sda
+// S: disk/by-id/ata-ST4000NM0033_Z1Z2ABCD
+// S: disk/by-id/wwn-0x5000c500a1b2c3d4
+// S: disk/by-path/pci-0000:00:1f.2-ata-1
+// E: DEVNAME=/dev/sda
+// E: DEVTYPE=disk
+
+func parseUdevInfo(out []byte) (string, []string, error) {
+	kernel := ""
+	var links []string
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		line := sc.Text()
+		if len(line) < 3 || line[1:3] != ": " {
+			continue
+		}
+		value := path.Join("/dev", line[3:])
+		switch line[0] {
+		case 'N':
+			kernel = value
+		case 'S':
+			links = append(links, value)
+		}
+	}
+	if kernel == "" {
+		return "", nil, fmt.Errorf("invalid udev info %q", out)
+	}
+	return kernel, links, nil
+}
+
+// GeomLinks is the DeviceLinks of FreeBSD, which queries glabel status with the Runner of the context, so the
+// names are the GEOM labels of the host which runs the commands, such as /dev/gpt/zfs0. Devices without labels
+// are returned as they are given.
+type GeomLinks struct{}
+
+// DeviceLinks implements DeviceLinks.
+func (GeomLinks) DeviceLinks(ctx context.Context, device string) (string, []string, error) {
+	var out bytes.Buffer
+	c := command{Command: "glabel", Stdout: &out}
+	if _, err := c.Run(ctx, "status", "-s"); err != nil {
+		return "", nil, err
+	}
+	labels, err := parseGlabelStatus(out.Bytes())
+	if err != nil {
+		return "", nil, err
+	}
+	name := strings.TrimPrefix(device, "/dev/")
+	for component, names := range labels {
+		for _, label := range names {
+			if label == name {
+				name = component
+			}
+		}
+	}
+	var links []string
+	for _, label := range labels[name] {
+		links = append(links, path.Join("/dev", label))
+	}
+	return path.Join("/dev", name), links, nil
+}
+
+// example input for parseGlabelStatus
+// gptid/3d4b0b0e-8fde-11e9-9561-0cc47a6c3a2c  N/A  ada0p1
+//                           gpt/zfs0  N/A  ada0p2
+//             diskid/DISK-S3Z9NB0K123456  N/A  ada1
+
+// parseGlabelStatus returns the labels of the devices by their kernel names, e.g. ada0p2.
+func parseGlabelStatus(out []byte) (map[string][]string, error) {
+	labels := map[string][]string{}
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("invalid glabel status line %q", sc.Text())
+		}
+		labels[fields[2]] = append(labels[fields[2]], fields[0])
+	}
+	return labels, nil
+}
+
+// DeviceNameResolver resolves device names to those of a naming scheme.
+type DeviceNameResolver struct {
+	// Naming is one of the DeviceName constants.
+	Naming string
+	// Links provides the names of devices, those of the Platform of the context if nil.
+	Links DeviceLinks
+}
+
+// Resolve returns the name of the device, which may be given by any of its names, in the naming scheme of the
+// resolver. If the device has several such names, e.g. by-id names derived from both its ATA and SCSI identity,
+// the first in lexical order is returned. An error is returned if it has none.
+func (r *DeviceNameResolver) Resolve(device string) (string, error) {
+	return r.ResolveContext(context.Background(), device)
+}
+
+// ResolveContext is like Resolve but includes a context.
+func (r *DeviceNameResolver) ResolveContext(ctx context.Context, device string) (string, error) {
+	links := r.Links
+	if links == nil {
+		links = UdevLinks{}
+		if p := platformFromContext(ctx); p != nil {
+			links = p.DeviceLinks()
+		}
+	}
+	var match func(name string) bool
+	switch r.Naming {
+	case DeviceNameKernel:
+		// returned as is
+	case DeviceNameByID:
+		match = func(name string) bool {
+			return strings.HasPrefix(name, "/dev/disk/by-id/") && !strings.HasPrefix(path.Base(name), "wwn-")
+		}
+	case DeviceNameByPath:
+		match = func(name string) bool {
+			return strings.HasPrefix(name, "/dev/disk/by-path/")
+		}
+	case DeviceNameWWN:
+		match = func(name string) bool {
+			return strings.HasPrefix(name, "/dev/disk/by-id/wwn-")
+		}
+	case DeviceNameGPT, DeviceNameGPTID, DeviceNameDiskID:
+		prefix := "/dev/" + r.Naming + "/"
+		match = func(name string) bool {
+			return strings.HasPrefix(name, prefix)
+		}
+	default:
+		return "", fmt.Errorf("invalid device naming %q", r.Naming)
+	}
+
+	kernel, names, err := links.DeviceLinks(ctx, device)
+	if err != nil {
+		return "", err
+	}
+	if match == nil {
+		return kernel, nil
+	}
+	var matches []string
+	for _, name := range names {
+		if match(name) {
+			matches = append(matches, name)
+		}
+	}
+	if len(matches) == 0 {
+		return "", fmt.Errorf("device %s has no %s name", device, r.Naming)
+	}
+	sort.Strings(matches)
+	return matches[0], nil
+}
+
+// ResolveDeviceName returns the name of the device in the given naming scheme, one of the DeviceName constants,
+// using the names given by the Platform of the host which runs the commands, e.g. its udev data on Linux.
+// See DeviceNameResolver to use other data.
+func ResolveDeviceName(device, naming string) (string, error) {
+	return ResolveDeviceNameContext(context.Background(), device, naming)
+}
+
+// ResolveDeviceNameContext is like ResolveDeviceName but includes a context.
+func ResolveDeviceNameContext(ctx context.Context, device, naming string) (string, error) {
+	r := &DeviceNameResolver{Naming: naming}
+	return r.ResolveContext(ctx, device)
+}
@@ -0,0 +1,111 @@
+package zfs
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+const udevInfo = `P: /devices/pci0000:00/0000:00:1f.2/ata1/host0/target0:0:0/0:0:0:0/block/sda
+N: sda
+S: disk/by-path/pci-0000:00:1f.2-ata-1
+S: disk/by-id/wwn-0x5000c500a1b2c3d4
+S: disk/by-id/ata-ST4000NM0033_Z1Z2ABCD
+E: DEVNAME=/dev/sda
+E: DEVTYPE=disk
+`
+
+// fixtureLinks maps devices to their kernel name and links.
+type fixtureLinks map[string][]string
+
+func (f fixtureLinks) DeviceLinks(ctx context.Context, device string) (string, []string, error) {
+	links := f[device]
+	return links[0], links[1:], nil
+}
+
+func TestResolveDeviceName(t *testing.T) {
+	ctx, r := withFakeRunner(udevInfo)
+	for naming, want := range map[string]string{
+		DeviceNameKernel: "/dev/sda",
+		DeviceNameByID:   "/dev/disk/by-id/ata-ST4000NM0033_Z1Z2ABCD",
+		DeviceNameByPath: "/dev/disk/by-path/pci-0000:00:1f.2-ata-1",
+		DeviceNameWWN:    "/dev/disk/by-id/wwn-0x5000c500a1b2c3d4",
+	} {
+		got, err := ResolveDeviceNameContext(ctx, "/dev/disk/by-id/wwn-0x5000c500a1b2c3d4", naming)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Fatalf("want %s name: %s, got: %s", naming, want, got)
+		}
+	}
+	want := []string{"udevadm", "info", "--query=all", "--name=/dev/disk/by-id/wwn-0x5000c500a1b2c3d4"}
+	if !reflect.DeepEqual(want, r.calls[0]) {
+		t.Fatalf("want: %q, got: %q", want, r.calls[0])
+	}
+
+	if _, err := ResolveDeviceNameContext(ctx, "sda", "label"); err == nil {
+		t.Fatal("expected error for invalid naming")
+	}
+	if _, err := ResolveDeviceNameContext(WithRunner(context.Background(), &fakeRunner{}), "sda", DeviceNameKernel); err == nil {
+		t.Fatal("expected error for empty udev info")
+	}
+}
+
+func TestDeviceNameResolverLinks(t *testing.T) {
+	links := fixtureLinks{
+		"nvme0n1": {"/dev/nvme0n1", "/dev/disk/by-id/nvme-Samsung_SSD_970_S1", "/dev/disk/by-id/nvme-eui.0025385b71b2"},
+		"vda":     {"/dev/vda", "/dev/disk/by-path/virtio-pci-0000:00:05.0"},
+	}
+	r := &DeviceNameResolver{Naming: DeviceNameByID, Links: links}
+	got, err := r.Resolve("nvme0n1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "/dev/disk/by-id/nvme-Samsung_SSD_970_S1"; got != want {
+		t.Fatalf("want: %s, got: %s", want, got)
+	}
+	if _, err := r.Resolve("vda"); err == nil {
+		t.Fatal("expected error for device without by-id name")
+	}
+}
+
+const glabelStatus = `gptid/3d4b0b0e-8fde-11e9-9561-0cc47a6c3a2c  N/A  ada0p1
+                          gpt/zfs0  N/A  ada0p2
+gptid/4e5c1c1f-8fde-11e9-9561-0cc47a6c3a2c  N/A  ada0p2
+            diskid/DISK-S3Z9NB0K123456  N/A  ada1
+`
+
+func TestResolveGeomDeviceName(t *testing.T) {
+	ctx, r := withFakeRunner(glabelStatus)
+	ctx = WithPlatform(ctx, FreeBSDPlatform{})
+	for device, want := range map[string]map[string]string{
+		"/dev/gpt/zfs0": {
+			DeviceNameKernel: "/dev/ada0p2",
+			DeviceNameGPTID:  "/dev/gptid/4e5c1c1f-8fde-11e9-9561-0cc47a6c3a2c",
+		},
+		"ada1": {
+			DeviceNameKernel: "/dev/ada1",
+			DeviceNameDiskID: "/dev/diskid/DISK-S3Z9NB0K123456",
+		},
+	} {
+		for naming, name := range want {
+			got, err := ResolveDeviceNameContext(ctx, device, naming)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != name {
+				t.Fatalf("want %s name of %s: %s, got: %s", naming, device, name, got)
+			}
+		}
+	}
+	if want := []string{"glabel", "status", "-s"}; !reflect.DeepEqual(want, r.calls[0]) {
+		t.Fatalf("want: %q, got: %q", want, r.calls[0])
+	}
+	if _, err := ResolveDeviceNameContext(ctx, "ada1", DeviceNameGPT); err == nil {
+		t.Fatal("expected error for device without gpt label")
+	}
+	if _, err := parseGlabelStatus([]byte("gpt/zfs0 ada0p2\n")); err == nil {
+		t.Fatal("expected error for invalid glabel status")
+	}
+}
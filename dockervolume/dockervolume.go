@@ -0,0 +1,342 @@
+// Package dockervolume implements the Docker volume plugin API with ZFS filesystems, built on go-zfs.
+// Every volume is a child filesystem of a parent dataset, mounted while containers use it.
+//
+// Usage:
+//
+//	d := &dockervolume.Driver{Parent: "tank/docker"}
+//	l, err := net.Listen("unix", "/run/docker/plugins/zfs.sock")
+//	if err != nil {
+//		return err
+//	}
+//	err = http.Serve(l, d)
+//
+// Volumes are then created with docker volume create -d zfs -o quota=10G -o compression=lz4 data, or cloned from
+// a snapshot of another volume with -o from=data@nightly.
+package dockervolume
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	zfs "github.com/mistifyio/go-zfs/v3"
+)
+
+// Options of docker volume create, besides the properties of the Properties list.
+const (
+	// OptionFrom creates the volume as a clone of a snapshot of another volume, given as "volume@snapshot".
+	OptionFrom = "from"
+)
+
+// Properties are the properties which may be set with the options of docker volume create, e.g. -o quota=10G.
+var Properties = []string{"quota", "refquota", "reservation", "refreservation", "compression", "recordsize", "atime"}
+
+// Volume is a volume as reported to Docker.
+type Volume struct {
+	Name string `json:"Name"`
+	// Mountpoint is the path of the filesystem of the volume, empty if it is not mounted.
+	Mountpoint string `json:"Mountpoint,omitempty"`
+	// CreatedAt is the creation time in RFC 3339 format.
+	CreatedAt string `json:"CreatedAt,omitempty"`
+	// Status holds the name of the dataset and its used and quota properties in bytes, shown by
+	// docker volume inspect.
+	Status map[string]interface{} `json:"Status,omitempty"`
+}
+
+// Driver is a Docker volume driver creating volumes as filesystems below Parent. It implements the plugin
+// protocol with ServeHTTP, its methods may also be called directly.
+//
+// Docker mounts a volume once for every container using it, the filesystem is mounted for the first and unmounted
+// after the last of them. Mounts are only counted in memory, so volumes remain mounted if the driver restarts
+// while containers use them.
+type Driver struct {
+	// Parent is the filesystem the volumes are created below, e.g. "tank/docker". It must exist.
+	Parent string
+	// Runner runs the zfs commands, the Runner of the context of calls if nil.
+	Runner zfs.Runner
+
+	mu     sync.Mutex
+	mounts map[string]map[string]bool
+}
+
+func (d *Driver) context(ctx context.Context) context.Context {
+	if d.Runner == nil {
+		return ctx
+	}
+	return zfs.WithRunner(ctx, d.Runner)
+}
+
+// dataset returns the name of the dataset of a volume.
+func (d *Driver) dataset(name string) (string, error) {
+	if name == "" || strings.ContainsAny(name, "/@#") {
+		return "", fmt.Errorf("invalid volume name %q", name)
+	}
+	dataset := d.Parent + "/" + name
+	if err := zfs.ValidateDatasetName(dataset); err != nil {
+		return "", fmt.Errorf("invalid volume name %q: %w", name, err)
+	}
+	return dataset, nil
+}
+
+// Create creates a volume, or does nothing if it already exists. The options are properties of the Properties
+// list and OptionFrom.
+func (d *Driver) Create(ctx context.Context, name string, opts map[string]string) error {
+	ctx = d.context(ctx)
+	dataset, err := d.dataset(name)
+	if err != nil {
+		return err
+	}
+	// volumes are only mounted while they are used
+	props := map[string]string{"canmount": "noauto"}
+	from := ""
+	for k, v := range opts {
+		switch {
+		case k == OptionFrom:
+			from = v
+		case contains(Properties, k):
+			props[k] = v
+		default:
+			return fmt.Errorf("invalid option %q", k)
+		}
+	}
+
+	if _, err := zfs.GetDatasetContext(ctx, dataset); err == nil {
+		return nil
+	} else if !errors.Is(err, zfs.ErrDatasetNotFound) {
+		return err
+	}
+	if from == "" {
+		_, err = zfs.CreateFilesystemContext(ctx, dataset, props)
+		return err
+	}
+	i := strings.IndexByte(from, '@')
+	if i < 0 {
+		return fmt.Errorf("invalid option from=%s: must name a snapshot of a volume, e.g. data@nightly", from)
+	}
+	source, err := d.dataset(from[:i])
+	if err != nil {
+		return err
+	}
+	snap, err := zfs.GetDatasetContext(ctx, source+from[i:])
+	if err != nil {
+		return err
+	}
+	_, err = snap.CloneContext(ctx, dataset, props)
+	return err
+}
+
+// Remove destroys a volume, which must not be mounted by containers and must not have snapshots.
+func (d *Driver) Remove(ctx context.Context, name string) error {
+	ctx = d.context(ctx)
+	dataset, err := d.dataset(name)
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.mounts[name]) > 0 {
+		return fmt.Errorf("volume %s is in use by %d containers", name, len(d.mounts[name]))
+	}
+	ds := &zfs.Dataset{Name: dataset, Type: zfs.DatasetFilesystem}
+	if mounted, err := ds.MountedContext(ctx); err != nil {
+		return err
+	} else if mounted {
+		if _, err := ds.UnmountContext(ctx, false); err != nil {
+			return err
+		}
+	}
+	return ds.DestroyContext(ctx, zfs.DestroyDefault)
+}
+
+// Mount mounts a volume for the container with the given mount id and returns its mountpoint.
+func (d *Driver) Mount(ctx context.Context, name, id string) (string, error) {
+	ctx = d.context(ctx)
+	dataset, err := d.dataset(name)
+	if err != nil {
+		return "", err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	ds, err := zfs.GetDatasetContext(ctx, dataset)
+	if err != nil {
+		return "", err
+	}
+	mounted, err := ds.MountedContext(ctx)
+	if err != nil {
+		return "", err
+	}
+	if !mounted {
+		if ds, err = ds.MountContext(ctx, false, nil); err != nil {
+			return "", err
+		}
+	}
+	if d.mounts == nil {
+		d.mounts = map[string]map[string]bool{}
+	}
+	if d.mounts[name] == nil {
+		d.mounts[name] = map[string]bool{}
+	}
+	d.mounts[name][id] = true
+	return ds.Mountpoint, nil
+}
+
+// Unmount releases the mount of a volume by the container with the given mount id, and unmounts the volume if no
+// other container uses it.
+func (d *Driver) Unmount(ctx context.Context, name, id string) error {
+	ctx = d.context(ctx)
+	dataset, err := d.dataset(name)
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.mounts[name], id)
+	if len(d.mounts[name]) > 0 {
+		return nil
+	}
+	delete(d.mounts, name)
+	ds := &zfs.Dataset{Name: dataset, Type: zfs.DatasetFilesystem}
+	mounted, err := ds.MountedContext(ctx)
+	if err != nil || !mounted {
+		return err
+	}
+	_, err = ds.UnmountContext(ctx, false)
+	return err
+}
+
+// Path returns the mountpoint of a volume, or an empty string if it is not mounted.
+func (d *Driver) Path(ctx context.Context, name string) (string, error) {
+	v, err := d.Get(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	return v.Mountpoint, nil
+}
+
+// Get returns a volume.
+func (d *Driver) Get(ctx context.Context, name string) (*Volume, error) {
+	dataset, err := d.dataset(name)
+	if err != nil {
+		return nil, err
+	}
+	volumes, err := d.list(d.context(ctx), zfs.ListOptions{Root: dataset})
+	if err != nil {
+		return nil, err
+	}
+	if len(volumes) != 1 {
+		return nil, fmt.Errorf("volume %s: %w", name, zfs.ErrDatasetNotFound)
+	}
+	return volumes[0], nil
+}
+
+// List returns all volumes, ordered by name.
+func (d *Driver) List(ctx context.Context) ([]*Volume, error) {
+	return d.list(d.context(ctx), zfs.ListOptions{Root: d.Parent, Depth: 1})
+}
+
+func (d *Driver) list(ctx context.Context, opts zfs.ListOptions) ([]*Volume, error) {
+	opts.Types = []string{zfs.DatasetFilesystem}
+	opts.Properties = []string{"mountpoint", "mounted", "creation", "used", "quota"}
+	datasets, err := zfs.ListDatasetsContext(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	var volumes []*Volume
+	for _, ds := range datasets {
+		if !strings.HasPrefix(ds.Name, d.Parent+"/") {
+			continue
+		}
+		v := &Volume{
+			Name:      strings.TrimPrefix(ds.Name, d.Parent+"/"),
+			CreatedAt: ds.Creation.UTC().Format(time.RFC3339),
+			Status:    map[string]interface{}{"Dataset": ds.Name, "Used": ds.Used, "Quota": ds.Quota},
+		}
+		if ds.Mounted {
+			v.Mountpoint = ds.Mountpoint
+		}
+		volumes = append(volumes, v)
+	}
+	sort.Slice(volumes, func(i, j int) bool {
+		return volumes[i].Name < volumes[j].Name
+	})
+	return volumes, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+// request is the body of the requests of the plugin protocol.
+type request struct {
+	Name string            `json:"Name"`
+	Opts map[string]string `json:"Opts"`
+	ID   string            `json:"ID"`
+}
+
+// response is the body of the responses of the plugin protocol, Err is set if a request failed.
+type response struct {
+	Err          string            `json:"Err"`
+	Mountpoint   string            `json:"Mountpoint,omitempty"`
+	Volume       *Volume           `json:"Volume,omitempty"`
+	Volumes      []*Volume         `json:"Volumes,omitempty"`
+	Implements   []string          `json:"Implements,omitempty"`
+	Capabilities map[string]string `json:"Capabilities,omitempty"`
+}
+
+// ServeHTTP implements the Docker plugin protocol, with the endpoints of Plugin.Activate and the VolumeDriver API.
+func (d *Driver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req request
+	// some requests, such as Plugin.Activate and VolumeDriver.List, have no body
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	var resp response
+	var err error
+	switch r.URL.Path {
+	case "/Plugin.Activate":
+		resp.Implements = []string{"VolumeDriver"}
+	case "/VolumeDriver.Capabilities":
+		resp.Capabilities = map[string]string{"Scope": "local"}
+	case "/VolumeDriver.Create":
+		err = d.Create(ctx, req.Name, req.Opts)
+	case "/VolumeDriver.Remove":
+		err = d.Remove(ctx, req.Name)
+	case "/VolumeDriver.Mount":
+		resp.Mountpoint, err = d.Mount(ctx, req.Name, req.ID)
+	case "/VolumeDriver.Unmount":
+		err = d.Unmount(ctx, req.Name, req.ID)
+	case "/VolumeDriver.Path":
+		resp.Mountpoint, err = d.Path(ctx, req.Name)
+	case "/VolumeDriver.Get":
+		resp.Volume, err = d.Get(ctx, req.Name)
+	case "/VolumeDriver.List":
+		resp.Volumes, err = d.List(ctx)
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		resp = response{Err: err.Error()}
+	}
+	w.Header().Set("Content-Type", "application/vnd.docker.plugins.v1.2+json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,128 @@
+package dockervolume_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	zfs "github.com/mistifyio/go-zfs/v3"
+	"github.com/mistifyio/go-zfs/v3/dockervolume"
+	"github.com/mistifyio/go-zfs/v3/zfstest"
+)
+
+func ok(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func equals(t *testing.T, want, got interface{}) {
+	t.Helper()
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("want: %#v, got: %#v", want, got)
+	}
+}
+
+func setup(t *testing.T) (context.Context, *dockervolume.Driver) {
+	t.Helper()
+	b := zfstest.New()
+	ctx := zfs.WithRunner(context.Background(), b)
+	_, err := zfs.CreateZpoolContext(ctx, "tank", nil, "disk0")
+	ok(t, err)
+	_, err = zfs.CreateFilesystemContext(ctx, "tank/docker", nil)
+	ok(t, err)
+	return ctx, &dockervolume.Driver{Parent: "tank/docker", Runner: b}
+}
+
+func TestDriver(t *testing.T) {
+	ctx, d := setup(t)
+
+	ok(t, d.Create(ctx, "data", map[string]string{"quota": "1073741824", "compression": "lz4"}))
+	ok(t, d.Create(ctx, "data", nil))
+	if err := d.Create(ctx, "other", map[string]string{"mountpoint": "/etc"}); err == nil {
+		t.Fatal("expected error for unsupported option")
+	}
+	if err := d.Create(ctx, "a/b", nil); err == nil {
+		t.Fatal("expected error for nested volume name")
+	}
+
+	path, err := d.Path(ctx, "data")
+	ok(t, err)
+	equals(t, "", path)
+	mountpoint, err := d.Mount(ctx, "data", "c1")
+	ok(t, err)
+	equals(t, "/tank/docker/data", mountpoint)
+	_, err = d.Mount(ctx, "data", "c2")
+	ok(t, err)
+
+	ok(t, d.Unmount(ctx, "data", "c1"))
+	path, err = d.Path(ctx, "data")
+	ok(t, err)
+	equals(t, "/tank/docker/data", path)
+	if err := d.Remove(ctx, "data"); err == nil || !strings.Contains(err.Error(), "in use") {
+		t.Fatalf("expected error removing volume in use, got %v", err)
+	}
+	ok(t, d.Unmount(ctx, "data", "c2"))
+	path, err = d.Path(ctx, "data")
+	ok(t, err)
+	equals(t, "", path)
+
+	ds, err := zfs.GetDatasetContext(ctx, "tank/docker/data")
+	ok(t, err)
+	_, err = ds.SnapshotContext(ctx, "nightly", false)
+	ok(t, err)
+	ok(t, d.Create(ctx, "copy", map[string]string{dockervolume.OptionFrom: "data@nightly"}))
+	copied, err := zfs.GetDatasetContext(ctx, "tank/docker/copy")
+	ok(t, err)
+	equals(t, "tank/docker/data@nightly", copied.Origin)
+
+	volumes, err := d.List(ctx)
+	ok(t, err)
+	equals(t, 2, len(volumes))
+	equals(t, "copy", volumes[0].Name)
+	equals(t, "data", volumes[1].Name)
+	equals(t, uint64(1073741824), volumes[1].Status["Quota"])
+
+	ok(t, d.Remove(ctx, "copy"))
+	_, err = d.Get(ctx, "copy")
+	if err == nil {
+		t.Fatal("expected error getting removed volume")
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	_, d := setup(t)
+	srv := httptest.NewServer(d)
+	defer srv.Close()
+
+	call := func(endpoint string, req interface{}) map[string]interface{} {
+		t.Helper()
+		body, err := json.Marshal(req)
+		ok(t, err)
+		resp, err := http.Post(srv.URL+endpoint, "application/json", bytes.NewReader(body))
+		ok(t, err)
+		defer resp.Body.Close()
+		equals(t, http.StatusOK, resp.StatusCode)
+		var out map[string]interface{}
+		ok(t, json.NewDecoder(resp.Body).Decode(&out))
+		return out
+	}
+
+	equals(t, []interface{}{"VolumeDriver"}, call("/Plugin.Activate", nil)["Implements"])
+	equals(t, "", call("/VolumeDriver.Create", map[string]interface{}{"Name": "web", "Opts": map[string]string{"quota": "10737418240"}})["Err"])
+	equals(t, "/tank/docker/web", call("/VolumeDriver.Mount", map[string]string{"Name": "web", "ID": "c1"})["Mountpoint"])
+	volume := call("/VolumeDriver.Get", map[string]string{"Name": "web"})["Volume"].(map[string]interface{})
+	equals(t, "/tank/docker/web", volume["Mountpoint"])
+	equals(t, 1, len(call("/VolumeDriver.List", nil)["Volumes"].([]interface{})))
+	if err := call("/VolumeDriver.Remove", map[string]string{"Name": "web"})["Err"]; err == "" {
+		t.Fatal("expected error removing mounted volume")
+	}
+	equals(t, "", call("/VolumeDriver.Unmount", map[string]string{"Name": "web", "ID": "c1"})["Err"])
+	equals(t, "", call("/VolumeDriver.Remove", map[string]string{"Name": "web"})["Err"])
+}
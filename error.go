@@ -1,18 +1,87 @@
 package zfs
 
 import (
+	"errors"
 	"fmt"
+	"strings"
 )
 
+// Conditions which can be detected in an Error with errors.Is, based on the stderr output of the failed command.
+var (
+	ErrDatasetNotFound  = errors.New("dataset does not exist")
+	ErrDatasetExists    = errors.New("dataset already exists")
+	ErrDatasetBusy      = errors.New("dataset is busy")
+	ErrPoolNotFound     = errors.New("no such pool")
+	ErrPoolBusy         = errors.New("pool is busy")
+	ErrPermissionDenied = errors.New("permission denied")
+	// ErrPoolInUse is returned when importing a pool which was last imported by another system and not exported,
+	// which force imports, see PoolInUseBy.
+	ErrPoolInUse = errors.New("pool was previously in use from another system")
+	// ErrPoolActive is returned when importing a pool with the multihost property which another system is actively
+	// using, which cannot be forced, see PoolInUseBy.
+	ErrPoolActive = errors.New("pool is imported on another host")
+	// ErrHostIDNotSet is returned when importing a pool with the multihost property on a system without a hostid,
+	// see SetHostID.
+	ErrHostIDNotSet = errors.New("hostid is not set")
+	// ErrInvalidName is returned for invalid pool, dataset, snapshot or bookmark names, by the commands or by
+	// ParseDatasetName and the other name checks, which return a *NameError.
+	ErrInvalidName = errors.New("invalid name")
+	// ErrMismatchedReplication is returned when creating a pool or adding vdevs whose redundancy differs from that
+	// of the other vdevs, which can be forced, see CreateZpoolDryRun.
+	ErrMismatchedReplication = errors.New("mismatched replication level")
+)
+
+// errorPatterns maps the detectable conditions to the messages printed by the zfs and zpool commands.
+var errorPatterns = map[error][]string{
+	ErrDatasetNotFound:  {"dataset does not exist", "could not find any snapshots to destroy"},
+	ErrDatasetExists:    {"dataset already exists", "destination already exists"},
+	ErrDatasetBusy:      {"dataset is busy", "pool or dataset is busy"},
+	ErrPoolNotFound:     {"no such pool"},
+	ErrPoolBusy:         {"pool is busy", "pool or dataset is busy", "currently busy"},
+	ErrPermissionDenied: {"permission denied", "must be superuser", "operation not permitted"},
+	ErrPoolInUse:        {"pool was previously in use from another system"},
+	ErrPoolActive:       {"pool is imported on host"},
+	ErrHostIDNotSet:     {"hostid is not set"},
+	ErrInvalidName: {
+		"invalid character", "name is too long", "empty component", "leading slash", "trailing slash",
+		"multiple '@' and/or '#' delimiters", "invalid dataset name", "invalid pool name",
+	},
+	ErrMismatchedReplication: {"mismatched replication level"},
+}
+
 // Error is an error which is returned when the `zfs` or `zpool` shell
 // commands return with a non-zero exit code.
 type Error struct {
 	Err    error
 	Debug  string
 	Stderr string
+	// Args is the full command line of the failed command, including the command itself.
+	Args []string
+	// ExitCode is the exit code of the failed command, or -1 if it did not exit normally (e.g. was killed).
+	ExitCode int
 }
 
 // Error returns the string representation of an Error.
 func (e Error) Error() string {
 	return fmt.Sprintf("%s: %q => %s", e.Err, e.Debug, e.Stderr)
 }
+
+// Unwrap returns the underlying error, such as an *exec.ExitError or the error of a cancelled context.
+func (e Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether the error matches one of the detectable conditions, such as ErrDatasetNotFound.
+func (e Error) Is(target error) bool {
+	patterns, ok := errorPatterns[target]
+	if !ok {
+		return false
+	}
+	stderr := strings.ToLower(e.Stderr)
+	for _, p := range patterns {
+		if strings.Contains(stderr, p) {
+			return true
+		}
+	}
+	return false
+}
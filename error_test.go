@@ -1,8 +1,10 @@
 package zfs
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"reflect"
 	"testing"
 )
 
@@ -35,3 +37,56 @@ func TestError(t *testing.T) {
 		}
 	}
 }
+
+func TestErrorIs(t *testing.T) {
+	for _, test := range []struct {
+		stderr string
+		want   error
+	}{
+		{"cannot open 'tank/missing': dataset does not exist\n", ErrDatasetNotFound},
+		{"cannot create 'tank/fs': dataset already exists\n", ErrDatasetExists},
+		{"cannot destroy 'tank/fs': dataset is busy\n", ErrDatasetBusy},
+		{"cannot open 'nopool': no such pool\n", ErrPoolNotFound},
+		{"cannot export 'tank': pool is busy\n", ErrPoolBusy},
+		{"cannot create 'tank/fs': permission denied\n", ErrPermissionDenied},
+		{"cannot import 'tank': pool was previously in use from another system.\n", ErrPoolInUse},
+		{"cannot import 'tank': pool is imported on host 'node2' (hostid=1a2b3c4d).\n", ErrPoolActive},
+		{"cannot create 'tank/a*b': invalid character '*' in name\n", ErrInvalidName},
+		{"Cannot import 'tank': pool has the multihost property on and the\nsystem's hostid is not set.\n", ErrHostIDNotSet},
+		{"invalid vdev specification\nuse '-f' to override the following errors:\nmismatched replication level: both 2-way and 3-way mirror vdevs are present\n", ErrMismatchedReplication},
+	} {
+		err := error(&Error{Err: errors.New("exit status 1"), Stderr: test.stderr, ExitCode: 1})
+		if !errors.Is(err, test.want) {
+			t.Fatalf("expected %q to match %v", test.stderr, test.want)
+		}
+		for _, other := range []error{ErrDatasetNotFound, ErrDatasetExists, ErrPoolNotFound, ErrPermissionDenied} {
+			if other != test.want && errors.Is(err, other) {
+				t.Fatalf("did not expect %q to match %v", test.stderr, other)
+			}
+		}
+	}
+
+	wrapped := fmt.Errorf("creating filesystem: %w", &Error{Err: errors.New("exit status 1"), Stderr: "dataset already exists"})
+	if !errors.Is(wrapped, ErrDatasetExists) {
+		t.Fatal("expected wrapped error to match ErrDatasetExists")
+	}
+}
+
+func TestCommandRunError(t *testing.T) {
+	c := command{Command: "sh"}
+	_, err := c.Run(context.Background(), "-c", "echo 'cannot open foo: dataset does not exist' >&2; exit 2")
+
+	var zErr *Error
+	if !errors.As(err, &zErr) {
+		t.Fatalf("expected *Error, got %T", err)
+	}
+	if zErr.ExitCode != 2 {
+		t.Fatalf("expected exit code 2, got %d", zErr.ExitCode)
+	}
+	if want := []string{"sh", "-c", "echo 'cannot open foo: dataset does not exist' >&2; exit 2"}; !reflect.DeepEqual(want, zErr.Args) {
+		t.Fatalf("unexpected args: %q", zErr.Args)
+	}
+	if !errors.Is(err, ErrDatasetNotFound) {
+		t.Fatalf("expected error to match ErrDatasetNotFound: %v", err)
+	}
+}
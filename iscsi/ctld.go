@@ -0,0 +1,286 @@
+package iscsi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+
+	zfs "github.com/mistifyio/go-zfs/v3"
+)
+
+// CTLD is the Exporter of the FreeBSD CAM target layer, configured in the configuration file of ctld.
+// Targets and their LUNs are kept in the file as blocks of the form
+//
+//	target iqn.2012-06.org.example.storage1:vm-disk0 {
+//		auth-group no-authentication
+//		portal-group default
+//		lun 0 {
+//			path /dev/zvol/tank/vm/disk0
+//		}
+//	}
+//
+// and ctld is reloaded after every change. The rest of the file, including targets written by hand in this form,
+// is kept as is.
+type CTLD struct {
+	// Runner runs the commands which read and write the configuration and reload ctld, e.g. on a remote host,
+	// zfs.ExecRunner if nil. It must implement zfs.StreamRunner to write the configuration.
+	Runner zfs.Runner
+	// Config is the path of the configuration file, /etc/ctl.conf if empty.
+	Config string
+	// PortalGroup and AuthGroup are those of new targets, "default" and "no-authentication" if empty.
+	PortalGroup string
+	AuthGroup   string
+}
+
+var _ Exporter = (*CTLD)(nil)
+
+func (c *CTLD) config() string {
+	if c.Config == "" {
+		return "/etc/ctl.conf"
+	}
+	return c.Config
+}
+
+// read returns the lines of the configuration.
+func (c *CTLD) read(ctx context.Context) ([]string, error) {
+	out, err := run(ctx, c.Runner, "cat", c.config())
+	if err != nil {
+		return nil, err
+	}
+	return strings.SplitAfter(string(out), "\n"), nil
+}
+
+// write replaces the configuration with lines, through a temporary file so ctld never reads a partial one,
+// and reloads ctld.
+func (c *CTLD) write(ctx context.Context, lines []string) error {
+	r := c.Runner
+	if r == nil {
+		r = zfs.ExecRunner{}
+	}
+	sr, ok := r.(zfs.StreamRunner)
+	if !ok {
+		return errors.New("runner does not support streaming, which is required to write the ctld configuration")
+	}
+	tmp := c.config() + ".tmp"
+	if stderr, err := sr.RunStream(ctx, strings.NewReader(strings.Join(lines, "")), ioutil.Discard, "tee", tmp); err != nil {
+		return fmt.Errorf("tee %s: %w: %s", tmp, err, strings.TrimSpace(string(stderr)))
+	}
+	if _, err := run(ctx, r, "mv", tmp, c.config()); err != nil {
+		return err
+	}
+	_, err := run(ctx, r, "service", "ctld", "reload")
+	return err
+}
+
+// CreateTarget implements Exporter.
+func (c *CTLD) CreateTarget(ctx context.Context, target string) error {
+	if err := validateTarget(target); err != nil {
+		return err
+	}
+	lines, err := c.read(ctx)
+	if err != nil {
+		return err
+	}
+	if start, _ := findBlock(lines, 0, len(lines), "target "+target); start >= 0 {
+		return fmt.Errorf("target %s already exists", target)
+	}
+	portalGroup, authGroup := c.PortalGroup, c.AuthGroup
+	if portalGroup == "" {
+		portalGroup = "default"
+	}
+	if authGroup == "" {
+		authGroup = "no-authentication"
+	}
+	if n := len(lines); n > 0 && lines[n-1] != "" && !strings.HasSuffix(lines[n-1], "\n") {
+		lines[n-1] += "\n"
+	}
+	lines = append(lines,
+		"target "+target+" {\n",
+		"\tauth-group "+authGroup+"\n",
+		"\tportal-group "+portalGroup+"\n",
+		"}\n")
+	return c.write(ctx, lines)
+}
+
+// DeleteTarget implements Exporter.
+func (c *CTLD) DeleteTarget(ctx context.Context, target string) error {
+	if err := validateTarget(target); err != nil {
+		return err
+	}
+	lines, err := c.read(ctx)
+	if err != nil {
+		return err
+	}
+	start, end := findBlock(lines, 0, len(lines), "target "+target)
+	if start < 0 {
+		return fmt.Errorf("target %s does not exist", target)
+	}
+	return c.write(ctx, append(lines[:start:start], lines[end:]...))
+}
+
+// AddLUN implements Exporter.
+func (c *CTLD) AddLUN(ctx context.Context, target string, lun int, volume string) error {
+	if err := validateTarget(target); err != nil {
+		return err
+	}
+	if err := validateLUN(lun); err != nil {
+		return err
+	}
+	if err := validateVolume(volume); err != nil {
+		return err
+	}
+	lines, err := c.read(ctx)
+	if err != nil {
+		return err
+	}
+	start, end := findBlock(lines, 0, len(lines), "target "+target)
+	if start < 0 {
+		return fmt.Errorf("target %s does not exist", target)
+	}
+	if s, _ := findBlock(lines, start+1, end-1, "lun "+strconv.Itoa(lun)); s >= 0 {
+		return fmt.Errorf("target %s already has lun %d", target, lun)
+	}
+	block := []string{
+		"\tlun " + strconv.Itoa(lun) + " {\n",
+		"\t\tpath " + zfs.ZvolDevicePath(volume) + "\n",
+		"\t}\n",
+	}
+	// the LUN goes before the closing brace of the target
+	updated := append(append(append([]string{}, lines[:end-1]...), block...), lines[end-1:]...)
+	return c.write(ctx, updated)
+}
+
+// RemoveLUN implements Exporter.
+func (c *CTLD) RemoveLUN(ctx context.Context, target string, lun int) error {
+	if err := validateTarget(target); err != nil {
+		return err
+	}
+	lines, err := c.read(ctx)
+	if err != nil {
+		return err
+	}
+	start, end := findBlock(lines, 0, len(lines), "target "+target)
+	if start < 0 {
+		return fmt.Errorf("target %s does not exist", target)
+	}
+	s, e := findBlock(lines, start+1, end-1, "lun "+strconv.Itoa(lun))
+	if s < 0 {
+		return fmt.Errorf("target %s has no lun %d", target, lun)
+	}
+	return c.write(ctx, append(lines[:s:s], lines[e:]...))
+}
+
+// Exports implements Exporter. Only LUNs configured with a path within their target are listed.
+func (c *CTLD) Exports(ctx context.Context) ([]Export, error) {
+	lines, err := c.read(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return parseCTLConfig(lines)
+}
+
+// example input for parseCTLConfig
+// portal-group default {
+// 	listen 0.0.0.0
+// }
+//
+// target iqn.2012-06.org.example.storage1:vm-disk0 {
+// 	auth-group no-authentication
+// 	portal-group default
+// 	lun 0 {
+// 		path /dev/zvol/tank/vm/disk0
+// 	}
+// }
+
+func parseCTLConfig(lines []string) ([]Export, error) {
+	var exports []Export
+	for i := 0; i < len(lines); i++ {
+		f := statement(lines[i])
+		if len(f) != 3 || f[0] != "target" || f[2] != "{" {
+			continue
+		}
+		start, end := findBlock(lines, i, len(lines), "target "+f[1])
+		if start < 0 {
+			return nil, fmt.Errorf("unterminated target %s", f[1])
+		}
+		for j := start + 1; j < end-1; j++ {
+			l := statement(lines[j])
+			if len(l) != 3 || l[0] != "lun" || l[2] != "{" {
+				continue
+			}
+			n, err := strconv.Atoi(l[1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid lun %q of target %s", l[1], f[1])
+			}
+			s, e := findBlock(lines, j, end-1, "lun "+l[1])
+			if s < 0 {
+				return nil, fmt.Errorf("unterminated lun %d of target %s", n, f[1])
+			}
+			for k := s + 1; k < e-1; k++ {
+				if p := statement(lines[k]); len(p) == 2 && p[0] == "path" {
+					exports = append(exports, Export{Target: f[1], LUN: n, Device: p[1], Volume: volumeOf(p[1])})
+				}
+			}
+			j = e - 1
+		}
+		i = end - 1
+	}
+	sort.SliceStable(exports, func(i, j int) bool {
+		if exports[i].Target != exports[j].Target {
+			return exports[i].Target < exports[j].Target
+		}
+		return exports[i].LUN < exports[j].LUN
+	})
+	return exports, nil
+}
+
+// statement returns the words of a line of the configuration, without comments.
+func statement(line string) []string {
+	if i := strings.IndexByte(line, '#'); i >= 0 {
+		line = line[:i]
+	}
+	return strings.Fields(line)
+}
+
+// findBlock returns the range of lines of the block opened by "<header> {" between the lines from and to, with end
+// following its closing brace, or -1 if there is none.
+func findBlock(lines []string, from, to int, header string) (int, int) {
+	want := strings.Fields(header + " {")
+	for i := from; i < to; i++ {
+		if !equalWords(statement(lines[i]), want) {
+			continue
+		}
+		depth := 0
+		for j := i; j < to; j++ {
+			for _, w := range statement(lines[j]) {
+				switch w {
+				case "{":
+					depth++
+				case "}":
+					depth--
+				}
+			}
+			if depth == 0 {
+				return i, j + 1
+			}
+		}
+		return -1, -1
+	}
+	return -1, -1
+}
+
+func equalWords(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,105 @@
+// Package iscsi exports zvols over iSCSI, with LIO through targetcli on Linux or with ctld on FreeBSD, built on
+// go-zfs. Every LUN of a target is backed by the device of a zvol.
+//
+// Usage:
+//
+//	var e iscsi.Exporter = &iscsi.LIO{}
+//	target := "iqn.2003-01.org.linux-iscsi.storage1:vm-disk0"
+//	if err := e.CreateTarget(ctx, target); err != nil {
+//		return err
+//	}
+//	err := e.AddLUN(ctx, target, 0, "tank/vm/disk0")
+//	exports, err := e.Exports(ctx)
+package iscsi
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	zfs "github.com/mistifyio/go-zfs/v3"
+)
+
+// Export is a LUN of an iSCSI target.
+type Export struct {
+	// Target is the name of the target, e.g. "iqn.2003-01.org.linux-iscsi.storage1:vm-disk0".
+	Target string
+	LUN    int
+	// Device is the path of the device or file backing the LUN, e.g. /dev/zvol/tank/vm/disk0.
+	Device string
+	// Volume is the name of the zvol backing the LUN, empty if it is not backed by a zvol.
+	Volume string
+}
+
+// Exporter creates and removes iSCSI targets and their LUNs. Changes are persisted, so they survive a restart of
+// the target service.
+type Exporter interface {
+	// CreateTarget creates a target without LUNs.
+	CreateTarget(ctx context.Context, target string) error
+	// DeleteTarget deletes a target along with its LUNs.
+	DeleteTarget(ctx context.Context, target string) error
+	// AddLUN adds a LUN backed by the zvol named volume to the target.
+	AddLUN(ctx context.Context, target string, lun int, volume string) error
+	// RemoveLUN removes a LUN from the target, the zvol backing it is not changed.
+	RemoveLUN(ctx context.Context, target string, lun int) error
+	// Exports lists the LUNs of all targets, ordered by target and LUN.
+	Exports(ctx context.Context) ([]Export, error)
+}
+
+// validateTarget checks that target is an iSCSI name in the iqn., eui. or naa. format.
+func validateTarget(target string) error {
+	if !strings.HasPrefix(target, "iqn.") && !strings.HasPrefix(target, "eui.") && !strings.HasPrefix(target, "naa.") {
+		return fmt.Errorf("invalid target %q: must begin with iqn., eui. or naa.", target)
+	}
+	for _, r := range target {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', strings.ContainsRune("-.:", r):
+		default:
+			return fmt.Errorf("invalid target %q: invalid character %q", target, r)
+		}
+	}
+	return nil
+}
+
+func validateLUN(lun int) error {
+	if lun < 0 || lun > 16383 {
+		return fmt.Errorf("invalid lun %d", lun)
+	}
+	return nil
+}
+
+// validateVolume checks the name of a zvol, or of a snapshot of one whose device is visible.
+func validateVolume(volume string) error {
+	n, err := zfs.ParseDatasetName(volume)
+	if err != nil {
+		return err
+	}
+	if n.Bookmark != "" {
+		return fmt.Errorf("invalid volume %q", volume)
+	}
+	return nil
+}
+
+// volumeOf returns the name of the zvol of a device path, or an empty string if it is not one.
+func volumeOf(device string) string {
+	if strings.HasPrefix(device, "/dev/zvol/") {
+		return strings.TrimPrefix(device, "/dev/zvol/")
+	}
+	return ""
+}
+
+// run runs a command with r, or zfs.ExecRunner if nil, and includes its output in errors.
+func run(ctx context.Context, r zfs.Runner, name string, args ...string) ([]byte, error) {
+	if r == nil {
+		r = zfs.ExecRunner{}
+	}
+	stdout, stderr, err := r.Run(ctx, name, args...)
+	if err != nil {
+		msg := strings.TrimSpace(string(stderr))
+		if msg == "" {
+			msg = strings.TrimSpace(string(stdout))
+		}
+		return nil, fmt.Errorf("%s %s: %w: %s", name, strings.Join(args, " "), err, msg)
+	}
+	return stdout, nil
+}
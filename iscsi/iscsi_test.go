@@ -0,0 +1,207 @@
+package iscsi_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mistifyio/go-zfs/v3/iscsi"
+)
+
+func ok(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func equals(t *testing.T, want, got interface{}) {
+	t.Helper()
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("want: %#v, got: %#v", want, got)
+	}
+}
+
+// fakeRunner records commands, answers them with output and keeps the files written with tee.
+type fakeRunner struct {
+	calls  []string
+	output func(cmd string) string
+	files  map[string]string
+}
+
+func (r *fakeRunner) Run(ctx context.Context, name string, args ...string) ([]byte, []byte, error) {
+	cmd := strings.Join(append([]string{name}, args...), " ")
+	r.calls = append(r.calls, cmd)
+	switch name {
+	case "cat":
+		content, ok := r.files[args[0]]
+		if !ok {
+			return nil, []byte("No such file or directory"), errors.New("exit status 1")
+		}
+		return []byte(content), nil, nil
+	case "mv":
+		r.files[args[1]] = r.files[args[0]]
+		delete(r.files, args[0])
+	}
+	if r.output != nil {
+		return []byte(r.output(cmd)), nil, nil
+	}
+	return nil, nil, nil
+}
+
+func (r *fakeRunner) RunStream(ctx context.Context, stdin io.Reader, stdout io.Writer, name string, args ...string) ([]byte, error) {
+	r.calls = append(r.calls, strings.Join(append([]string{name}, args...), " "))
+	b, err := ioutil.ReadAll(stdin)
+	if err != nil {
+		return nil, err
+	}
+	r.files[args[0]] = string(b)
+	return nil, nil
+}
+
+const target = "iqn.2003-01.org.linux-iscsi.storage1:vm-disk0"
+
+const lioTree = `o- iscsi .............................................................................. [Targets: 2]
+  o- iqn.2003-01.org.linux-iscsi.storage1:vm-disk0 ......................................... [TPGs: 1]
+  | o- tpg1 .................................................................. [no-gen-acls, no-auth]
+  |   o- acls ............................................................................ [ACLs: 0]
+  |   o- luns ............................................................................ [LUNs: 2]
+  |   | o- lun1 ........................ [block/tank-vm-disk1 (/dev/zvol/tank/vm/disk1) (default_tg_pt_gp)]
+  |   | o- lun0 ........................ [block/tank-vm-disk0 (/dev/zvol/tank/vm/disk0) (default_tg_pt_gp)]
+  |   o- portals ...................................................................... [Portals: 1]
+  |     o- 0.0.0.0:3260 ........................................................................ [OK]
+  o- iqn.2003-01.org.linux-iscsi.storage1:files ............................................ [TPGs: 1]
+    o- tpg1 .................................................................. [no-gen-acls, no-auth]
+      o- acls ............................................................................ [ACLs: 0]
+      o- luns ............................................................................ [LUNs: 1]
+      | o- lun0 .................................. [fileio/image (/srv/image.img) (default_tg_pt_gp)]
+      o- portals ...................................................................... [Portals: 0]
+`
+
+func TestLIO(t *testing.T) {
+	r := &fakeRunner{output: func(cmd string) string {
+		if cmd == "targetcli ls /iscsi" {
+			return lioTree
+		}
+		return ""
+	}}
+	e := &iscsi.LIO{Runner: r}
+	ctx := context.Background()
+
+	exports, err := e.Exports(ctx)
+	ok(t, err)
+	equals(t, []iscsi.Export{
+		{Target: "iqn.2003-01.org.linux-iscsi.storage1:files", LUN: 0, Device: "/srv/image.img"},
+		{Target: target, LUN: 0, Device: "/dev/zvol/tank/vm/disk0", Volume: "tank/vm/disk0"},
+		{Target: target, LUN: 1, Device: "/dev/zvol/tank/vm/disk1", Volume: "tank/vm/disk1"},
+	}, exports)
+
+	r.calls = nil
+	ok(t, e.CreateTarget(ctx, target))
+	ok(t, e.AddLUN(ctx, target, 2, "tank/vm/disk2"))
+	ok(t, e.RemoveLUN(ctx, target, 1))
+	equals(t, []string{
+		"targetcli /iscsi create " + target,
+		"targetcli saveconfig",
+		"targetcli /backstores/block create name=tank-vm-disk2 dev=/dev/zvol/tank/vm/disk2",
+		"targetcli /iscsi/" + target + "/tpg1/luns create /backstores/block/tank-vm-disk2 lun=2",
+		"targetcli saveconfig",
+		"targetcli ls /iscsi",
+		"targetcli /iscsi/" + target + "/tpg1/luns delete lun=1",
+		"targetcli /backstores/block delete tank-vm-disk1",
+		"targetcli saveconfig",
+	}, r.calls)
+
+	r.calls = nil
+	ok(t, e.DeleteTarget(ctx, target))
+	equals(t, []string{
+		"targetcli ls /iscsi",
+		"targetcli /iscsi delete " + target,
+		"targetcli /backstores/block delete tank-vm-disk0",
+		"targetcli /backstores/block delete tank-vm-disk1",
+		"targetcli saveconfig",
+	}, r.calls)
+
+	if err := e.RemoveLUN(ctx, target, 7); err == nil {
+		t.Fatal("expected error removing missing lun")
+	}
+	for _, err := range []error{
+		e.CreateTarget(ctx, "storage1:disk0"),
+		e.CreateTarget(ctx, "iqn.2003-01.org.Example:disk0"),
+		e.AddLUN(ctx, target, -1, "tank/vm/disk0"),
+		e.AddLUN(ctx, target, 0, "tank/vm/disk 0*"),
+	} {
+		if err == nil {
+			t.Fatal("expected validation error")
+		}
+	}
+}
+
+const ctlConf = `# managed in part by go-zfs
+portal-group default {
+	listen 0.0.0.0
+}
+
+target iqn.2012-06.org.example.storage1:manual {
+	auth-group no-authentication
+	portal-group default
+	lun 0 {
+		path /dev/ada1 # a disk
+		size 1G
+	}
+}
+`
+
+func TestCTLD(t *testing.T) {
+	r := &fakeRunner{files: map[string]string{"/etc/ctl.conf": ctlConf}}
+	e := &iscsi.CTLD{Runner: r}
+	ctx := context.Background()
+	const target = "iqn.2012-06.org.example.storage1:vm-disk0"
+
+	ok(t, e.CreateTarget(ctx, target))
+	ok(t, e.AddLUN(ctx, target, 0, "tank/vm/disk0"))
+	ok(t, e.AddLUN(ctx, target, 1, "tank/vm/disk1"))
+	equals(t, ctlConf+`target `+target+` {
+	auth-group no-authentication
+	portal-group default
+	lun 0 {
+		path /dev/zvol/tank/vm/disk0
+	}
+	lun 1 {
+		path /dev/zvol/tank/vm/disk1
+	}
+}
+`, r.files["/etc/ctl.conf"])
+	equals(t, []string{"cat /etc/ctl.conf", "tee /etc/ctl.conf.tmp", "mv /etc/ctl.conf.tmp /etc/ctl.conf", "service ctld reload"}, r.calls[:4])
+
+	if err := e.CreateTarget(ctx, target); err == nil {
+		t.Fatal("expected error creating existing target")
+	}
+	if err := e.AddLUN(ctx, target, 1, "tank/vm/other"); err == nil {
+		t.Fatal("expected error adding existing lun")
+	}
+
+	exports, err := e.Exports(ctx)
+	ok(t, err)
+	equals(t, []iscsi.Export{
+		{Target: "iqn.2012-06.org.example.storage1:manual", LUN: 0, Device: "/dev/ada1"},
+		{Target: target, LUN: 0, Device: "/dev/zvol/tank/vm/disk0", Volume: "tank/vm/disk0"},
+		{Target: target, LUN: 1, Device: "/dev/zvol/tank/vm/disk1", Volume: "tank/vm/disk1"},
+	}, exports)
+
+	ok(t, e.RemoveLUN(ctx, target, 0))
+	exports, err = e.Exports(ctx)
+	ok(t, err)
+	equals(t, 2, len(exports))
+	equals(t, 1, exports[1].LUN)
+
+	ok(t, e.DeleteTarget(ctx, target))
+	equals(t, ctlConf, r.files["/etc/ctl.conf"])
+	if err := e.RemoveLUN(ctx, target, 0); err == nil {
+		t.Fatal("expected error removing lun of missing target")
+	}
+}
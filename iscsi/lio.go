@@ -0,0 +1,212 @@
+package iscsi
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	zfs "github.com/mistifyio/go-zfs/v3"
+)
+
+// LIO is the Exporter of the Linux kernel target, configured with targetcli. LUNs are added to the first target
+// portal group, tpg1, and backed by block backstores named after their zvol, see BackstoreName.
+// The configuration is saved with targetcli saveconfig after every change.
+type LIO struct {
+	// Runner runs targetcli, e.g. on a remote host, zfs.ExecRunner if nil.
+	Runner zfs.Runner
+}
+
+var _ Exporter = (*LIO)(nil)
+
+// BackstoreName returns the name of the block backstore LIO.AddLUN creates for a zvol, its name with slashes and
+// the "@" of snapshots replaced by dashes, e.g. "tank-vm-disk0".
+func BackstoreName(volume string) string {
+	return strings.NewReplacer("/", "-", "@", "-").Replace(volume)
+}
+
+func (l *LIO) targetcli(ctx context.Context, args ...string) ([]byte, error) {
+	return run(ctx, l.Runner, "targetcli", args...)
+}
+
+func (l *LIO) save(ctx context.Context) error {
+	_, err := l.targetcli(ctx, "saveconfig")
+	return err
+}
+
+// CreateTarget implements Exporter.
+func (l *LIO) CreateTarget(ctx context.Context, target string) error {
+	if err := validateTarget(target); err != nil {
+		return err
+	}
+	if _, err := l.targetcli(ctx, "/iscsi", "create", target); err != nil {
+		return err
+	}
+	return l.save(ctx)
+}
+
+// DeleteTarget implements Exporter. The backstores of its LUNs are deleted as well.
+func (l *LIO) DeleteTarget(ctx context.Context, target string) error {
+	if err := validateTarget(target); err != nil {
+		return err
+	}
+	luns, err := l.luns(ctx)
+	if err != nil {
+		return err
+	}
+	if _, err := l.targetcli(ctx, "/iscsi", "delete", target); err != nil {
+		return err
+	}
+	for _, lun := range luns {
+		if lun.Target == target && lun.backstore != "" {
+			if _, err := l.targetcli(ctx, "/backstores/block", "delete", lun.backstore); err != nil {
+				return err
+			}
+		}
+	}
+	return l.save(ctx)
+}
+
+// AddLUN implements Exporter.
+func (l *LIO) AddLUN(ctx context.Context, target string, lun int, volume string) error {
+	if err := validateTarget(target); err != nil {
+		return err
+	}
+	if err := validateLUN(lun); err != nil {
+		return err
+	}
+	if err := validateVolume(volume); err != nil {
+		return err
+	}
+	backstore := BackstoreName(volume)
+	if _, err := l.targetcli(ctx, "/backstores/block", "create", "name="+backstore, "dev="+zfs.ZvolDevicePath(volume)); err != nil {
+		return err
+	}
+	luns := "/iscsi/" + target + "/tpg1/luns"
+	if _, err := l.targetcli(ctx, luns, "create", "/backstores/block/"+backstore, "lun="+strconv.Itoa(lun)); err != nil {
+		// the backstore is of no use without the LUN
+		_, _ = l.targetcli(ctx, "/backstores/block", "delete", backstore)
+		return err
+	}
+	return l.save(ctx)
+}
+
+// RemoveLUN implements Exporter. The backstore of the LUN is deleted as well.
+func (l *LIO) RemoveLUN(ctx context.Context, target string, lun int) error {
+	if err := validateTarget(target); err != nil {
+		return err
+	}
+	luns, err := l.luns(ctx)
+	if err != nil {
+		return err
+	}
+	var found *lioLUN
+	for i := range luns {
+		if luns[i].Target == target && luns[i].LUN == lun {
+			found = &luns[i]
+		}
+	}
+	if found == nil {
+		return fmt.Errorf("target %s has no lun %d", target, lun)
+	}
+	if _, err := l.targetcli(ctx, "/iscsi/"+target+"/tpg1/luns", "delete", "lun="+strconv.Itoa(lun)); err != nil {
+		return err
+	}
+	if found.backstore != "" {
+		if _, err := l.targetcli(ctx, "/backstores/block", "delete", found.backstore); err != nil {
+			return err
+		}
+	}
+	return l.save(ctx)
+}
+
+// Exports implements Exporter.
+func (l *LIO) Exports(ctx context.Context) ([]Export, error) {
+	luns, err := l.luns(ctx)
+	if err != nil {
+		return nil, err
+	}
+	exports := make([]Export, len(luns))
+	for i, lun := range luns {
+		exports[i] = lun.Export
+	}
+	return exports, nil
+}
+
+// lioLUN is a LUN along with the block backstore backing it, empty for other kinds of backstores.
+type lioLUN struct {
+	Export
+	backstore string
+}
+
+func (l *LIO) luns(ctx context.Context) ([]lioLUN, error) {
+	out, err := l.targetcli(ctx, "ls", "/iscsi")
+	if err != nil {
+		return nil, err
+	}
+	return parseLIOTree(out)
+}
+
+var (
+	lioNodeRE = regexp.MustCompile(`^([ |]*)o- (\S+)(?: \.*)?(?: \[(.*)\])?$`)
+	lioLUNRE  = regexp.MustCompile(`^(\w+)/(\S+) \(([^)]*)\)`)
+)
+
+// example input for parseLIOTree
+// o- iscsi .............................................................................. [Targets: 1]
+//   o- iqn.2003-01.org.linux-iscsi.storage1:vm-disk0 ......................................... [TPGs: 1]
+//     o- tpg1 .................................................................. [no-gen-acls, no-auth]
+//       o- acls ............................................................................ [ACLs: 0]
+//       o- luns ............................................................................ [LUNs: 1]
+//       | o- lun0 ........................ [block/tank-vm-disk0 (/dev/zvol/tank/vm/disk0) (default_tg_pt_gp)]
+//       o- portals ...................................................................... [Portals: 1]
+//         o- 0.0.0.0:3260 ........................................................................ [OK]
+
+func parseLIOTree(out []byte) ([]lioLUN, error) {
+	var luns []lioLUN
+	var path []string
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		line := strings.TrimRight(sc.Text(), " ")
+		if line == "" {
+			continue
+		}
+		m := lioNodeRE.FindStringSubmatch(line)
+		if m == nil {
+			return nil, fmt.Errorf("unexpected targetcli output %q", line)
+		}
+		depth := len(m[1]) / 2
+		if depth > len(path) {
+			return nil, fmt.Errorf("unexpected indentation of targetcli output %q", line)
+		}
+		path = append(path[:depth], m[2])
+		// iscsi, target, tpg, luns, lun
+		if len(path) != 5 || path[3] != "luns" || !strings.HasPrefix(path[4], "lun") {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimPrefix(path[4], "lun"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid lun %q", path[4])
+		}
+		lun := lioLUN{Export: Export{Target: path[1], LUN: n}}
+		if b := lioLUNRE.FindStringSubmatch(m[3]); b != nil {
+			lun.Device = b[3]
+			lun.Volume = volumeOf(b[3])
+			if b[1] == "block" {
+				lun.backstore = b[2]
+			}
+		}
+		luns = append(luns, lun)
+	}
+	sort.SliceStable(luns, func(i, j int) bool {
+		if luns[i].Target != luns[j].Target {
+			return luns[i].Target < luns[j].Target
+		}
+		return luns[i].LUN < luns[j].LUN
+	})
+	return luns, nil
+}
@@ -0,0 +1,763 @@
+package zfs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// JSON output (-j) of zfs list, zpool list, zpool get and zpool status is available since OpenZFS 2.3.
+// It is preferred over the columnar text output where supported, which is detected once per Runner with zfs version -j.
+
+var (
+	jsonOutput  = true
+	jsonSupport sync.Map // Runner => bool
+)
+
+// SetJSONOutput sets whether the library uses the JSON output of OpenZFS 2.3 and later where it is available.
+// It is enabled by default, older versions always fall back to parsing the columnar text output.
+func SetJSONOutput(enabled bool) {
+	jsonOutput = enabled
+}
+
+// useJSON reports whether the Runner of ctx supports JSON output.
+func useJSON(ctx context.Context) bool {
+	if !jsonOutput {
+		return false
+	}
+	r := runnerFromContext(ctx)
+	if r == nil || !reflect.TypeOf(r).Comparable() {
+		return false
+	}
+	if supported, ok := jsonSupport.Load(r); ok {
+		return supported.(bool)
+	}
+
+	supported := probeJSON(ctx)
+	if ctx.Err() == nil {
+		jsonSupport.Store(r, supported)
+	}
+	return supported
+}
+
+// probeJSON runs zfs version -j to find whether JSON output is supported.
+func probeJSON(ctx context.Context) bool {
+	out, err := zfsRawOutput(ctx, "version", "-j")
+	var version jsonOutputVersion
+	return err == nil && json.Unmarshal(out, &version) == nil && version.OutputVersion != nil
+}
+
+// zfsRawOutput is a helper function to wrap calls to zfs whose output is not tab separated.
+func zfsRawOutput(ctx context.Context, arg ...string) ([]byte, error) {
+	var out bytes.Buffer
+	c := command{Command: "zfs", Stdout: &out}
+	if _, err := c.Run(ctx, arg...); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// jsonArgs turns the arguments of a command printing columnar text into one printing JSON:
+// -j is added after the subcommand and -H, which does not apply to JSON, is removed.
+func jsonArgs(arg []string) []string {
+	args := []string{arg[0], "-j"}
+	for i, a := range arg[1:] {
+		if strings.HasPrefix(a, "-") && strings.Contains(a, "H") && !isOptionValue(arg[:i+1]) {
+			a = strings.Replace(a, "H", "", 1)
+			if a == "-" {
+				continue
+			}
+		}
+		args = append(args, a)
+	}
+	return args
+}
+
+// isOptionValue reports whether the argument following prev is the value of an option, such as -o or -t.
+func isOptionValue(prev []string) bool {
+	last := prev[len(prev)-1]
+	return len(last) >= 2 && last[0] == '-' && strings.ContainsAny(last[len(last)-1:], "odstST")
+}
+
+// columns returns the value of the -o option in arg.
+func columns(arg []string) []string {
+	for i, a := range arg[:len(arg)-1] {
+		if a == "-o" {
+			return strings.Split(arg[i+1], ",")
+		}
+	}
+	return nil
+}
+
+// zfsListOutput runs zfs list with the given arguments, which must select the output columns with -o,
+// and returns one line per dataset, using JSON output where supported.
+func zfsListOutput(ctx context.Context, arg ...string) ([][]string, error) {
+	if !useJSON(ctx) {
+		return zfsOutput(ctx, arg...)
+	}
+	out, err := zfsRawOutput(ctx, jsonArgs(arg)...)
+	if err != nil {
+		return nil, err
+	}
+	return parseJSONList(out, "datasets", columns(arg))
+}
+
+// zpoolListOutput runs zpool list with the given arguments, which must select the output columns with -o,
+// and returns one line per pool, using JSON output where supported.
+func zpoolListOutput(ctx context.Context, arg ...string) ([][]string, error) {
+	if !useJSON(ctx) {
+		return zpoolOutput(ctx, arg...)
+	}
+	out, err := zpoolRawOutput(ctx, jsonArgs(arg)...)
+	if err != nil {
+		return nil, err
+	}
+	return parseJSONList(out, "pools", columns(arg))
+}
+
+// zpoolGetOutput runs zpool get with the given arguments and returns lines of pool name, property, value and source,
+// using JSON output where supported.
+func zpoolGetOutput(ctx context.Context, arg ...string) ([][]string, error) {
+	if !useJSON(ctx) {
+		return zpoolOutput(ctx, arg...)
+	}
+	out, err := zpoolRawOutput(ctx, jsonArgs(arg)...)
+	if err != nil {
+		return nil, err
+	}
+	return parseJSONGet(out)
+}
+
+type jsonOutputVersion struct {
+	OutputVersion *struct {
+		Command   string `json:"command"`
+		VersMajor int    `json:"vers_major"`
+		VersMinor int    `json:"vers_minor"`
+	} `json:"output_version"`
+}
+
+// jsonObject is a pool or dataset in JSON output.
+type jsonObject struct {
+	Name       string          `json:"name"`
+	Type       string          `json:"type"`
+	State      string          `json:"state"`
+	Properties json.RawMessage `json:"properties"`
+}
+
+type jsonProperty struct {
+	Value  json.RawMessage `json:"value"`
+	Source struct {
+		Type string `json:"type"`
+		Data string `json:"data"`
+	} `json:"source"`
+}
+
+// source returns the source of the property as printed in columnar output, e.g. "inherited from tank".
+func (p jsonProperty) source() string {
+	switch p.Source.Type {
+	case "", "NONE":
+		return "-"
+	case "INHERITED":
+		return "inherited from " + p.Source.Data
+	}
+	return strings.ToLower(p.Source.Type)
+}
+
+// jsonMembers decodes a JSON object and returns its keys in order along with their values.
+// A missing or null object has no members.
+func jsonMembers(raw json.RawMessage) ([]string, map[string]json.RawMessage, error) {
+	members := map[string]json.RawMessage{}
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, members, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil, nil, errors.New("expected JSON object")
+	}
+	var keys []string
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, nil, err
+		}
+		key, ok := tok.(string)
+		if !ok {
+			return nil, nil, errors.New("expected JSON object key")
+		}
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, nil, err
+		}
+		keys = append(keys, key)
+		members[key] = value
+	}
+	return keys, members, nil
+}
+
+// jsonValue returns a JSON string, number or boolean as it would be printed in columnar output.
+func jsonValue(raw json.RawMessage) string {
+	if len(raw) == 0 || string(raw) == "null" {
+		return "-"
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s
+	}
+	return string(raw)
+}
+
+// jsonUint returns a JSON string or number as an unsigned integer, with "-" or a missing value being 0.
+func jsonUint(raw json.RawMessage) (uint64, error) {
+	v := jsonValue(raw)
+	if v == "-" {
+		return 0, nil
+	}
+	return strconv.ParseUint(v, 10, 64)
+}
+
+// jsonObjects decodes the pools or datasets of JSON output in order.
+func jsonObjects(out []byte, key string) ([]*jsonObject, [][]byte, error) {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(out, &doc); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse JSON output: %w", err)
+	}
+	keys, members, err := jsonMembers(doc[key])
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse JSON output: %w", err)
+	}
+	objects := make([]*jsonObject, len(keys))
+	raw := make([][]byte, len(keys))
+	for i, k := range keys {
+		o := &jsonObject{Name: k}
+		if err := json.Unmarshal(members[k], o); err != nil {
+			return nil, nil, fmt.Errorf("failed to parse JSON output of %s: %w", k, err)
+		}
+		objects[i], raw[i] = o, members[k]
+	}
+	return objects, raw, nil
+}
+
+// example input for parseJSONList
+// {"output_version": {"command": "zfs list", "vers_major": 0, "vers_minor": 1},
+//  "datasets": {"tank": {"name": "tank", "type": "FILESYSTEM", "pool": "tank", "createtxg": "1",
+//   "properties": {"used": {"value": "1024", "source": {"type": "NONE", "data": "-"}}}}}}
+
+// parseJSONList converts the JSON output of zfs list or zpool list to the lines of the columnar output.
+func parseJSONList(out []byte, key string, columns []string) ([][]string, error) {
+	objects, _, err := jsonObjects(out, key)
+	if err != nil {
+		return nil, err
+	}
+	lines := make([][]string, len(objects))
+	for i, o := range objects {
+		_, props, err := jsonMembers(o.Properties)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse JSON properties of %s: %w", o.Name, err)
+		}
+		line := make([]string, len(columns))
+		for j, c := range columns {
+			raw, ok := props[c]
+			if !ok {
+				line[j] = o.column(c)
+				continue
+			}
+			var p jsonProperty
+			if err := json.Unmarshal(raw, &p); err != nil {
+				return nil, fmt.Errorf("failed to parse JSON property %s of %s: %w", c, o.Name, err)
+			}
+			line[j] = jsonValue(p.Value)
+		}
+		lines[i] = line
+	}
+	return lines, nil
+}
+
+// column returns the value of a column which is not reported as a property, but as a member of the object.
+func (o *jsonObject) column(name string) string {
+	switch {
+	case name == "name":
+		return o.Name
+	case name == "type" && o.Type != "":
+		return strings.ToLower(o.Type)
+	case name == "health" && o.State != "":
+		return o.State
+	}
+	return "-"
+}
+
+// example input for parseJSONGet
+// {"output_version": {"command": "zpool get", "vers_major": 0, "vers_minor": 1},
+//  "pools": {"tank": {"name": "tank", "type": "POOL", "state": "ONLINE",
+//   "properties": {"size": {"value": "10737418240", "source": {"type": "NONE", "data": "-"}}}}}}
+
+// parseJSONGet converts the JSON output of zpool get to lines of pool name, property, value and source.
+func parseJSONGet(out []byte) ([][]string, error) {
+	objects, _, err := jsonObjects(out, "pools")
+	if err != nil {
+		return nil, err
+	}
+	var lines [][]string
+	for _, o := range objects {
+		keys, props, err := jsonMembers(o.Properties)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse JSON properties of %s: %w", o.Name, err)
+		}
+		for _, k := range keys {
+			var p jsonProperty
+			if err := json.Unmarshal(props[k], &p); err != nil {
+				return nil, fmt.Errorf("failed to parse JSON property %s of %s: %w", k, o.Name, err)
+			}
+			lines = append(lines, []string{o.Name, k, jsonValue(p.Value), p.source()})
+		}
+	}
+	return lines, nil
+}
+
+type jsonPoolStatus struct {
+	Name       string          `json:"name"`
+	State      string          `json:"state"`
+	Status     string          `json:"status"`
+	Action     string          `json:"action"`
+	MoreInfo   string          `json:"moreinfo"`
+	MsgID      string          `json:"msgid"`
+	ScanStats  json.RawMessage `json:"scan_stats"`
+	Removal    json.RawMessage `json:"removal_stats"`
+	Expansion  json.RawMessage `json:"raidz_expand_stats"`
+	Vdevs      json.RawMessage `json:"vdevs"`
+	Logs       json.RawMessage `json:"logs"`
+	L2Cache    json.RawMessage `json:"l2cache"`
+	Spares     json.RawMessage `json:"spares"`
+	Special    json.RawMessage `json:"special"`
+	Dedup      json.RawMessage `json:"dedup"`
+	ErrorCount json.RawMessage `json:"error_count"`
+	Errors     json.RawMessage `json:"errors"`
+}
+
+type jsonVdev struct {
+	Name           string          `json:"name"`
+	Class          string          `json:"class"`
+	GUID           json.RawMessage `json:"guid"`
+	State          string          `json:"state"`
+	ReadErrors     json.RawMessage `json:"read_errors"`
+	WriteErrors    json.RawMessage `json:"write_errors"`
+	ChecksumErrors json.RawMessage `json:"checksum_errors"`
+	TrimNotSup     json.RawMessage `json:"trim_notsup"`
+	TrimState      string          `json:"trim_state"`
+	Trimmed        json.RawMessage `json:"trimmed"`
+	ToTrim         json.RawMessage `json:"to_trim"`
+	TrimTime       json.RawMessage `json:"trim_time"`
+	InitState      string          `json:"init_state"`
+	Initialized    json.RawMessage `json:"initialized"`
+	ToInitialize   json.RawMessage `json:"to_initialize"`
+	InitTime       json.RawMessage `json:"init_time"`
+	Vdevs          json.RawMessage `json:"vdevs"`
+}
+
+type jsonScanStats struct {
+	Function   string          `json:"function"`
+	State      string          `json:"state"`
+	StartTime  json.RawMessage `json:"start_time"`
+	EndTime    json.RawMessage `json:"end_time"`
+	ToExamine  json.RawMessage `json:"to_examine"`
+	Examined   json.RawMessage `json:"examined"`
+	Issued     json.RawMessage `json:"issued"`
+	Processed  json.RawMessage `json:"processed"`
+	Errors     json.RawMessage `json:"errors"`
+	ScrubPause json.RawMessage `json:"scrub_pause"`
+}
+
+// parseZpoolStatusJSON parses the output of zpool status -j.
+func parseZpoolStatusJSON(out []byte) ([]*ZpoolStatus, error) {
+	objects, raw, err := jsonObjects(out, "pools")
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]*ZpoolStatus, len(objects))
+	for i, o := range objects {
+		var js jsonPoolStatus
+		if err := json.Unmarshal(raw[i], &js); err != nil {
+			return nil, fmt.Errorf("failed to parse JSON status of pool %s: %w", o.Name, err)
+		}
+		s, err := js.status(o.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse JSON status of pool %s: %w", o.Name, err)
+		}
+		statuses[i] = s
+	}
+	return statuses, nil
+}
+
+func (js *jsonPoolStatus) status(name string) (*ZpoolStatus, error) {
+	s := &ZpoolStatus{
+		Name:   name,
+		State:  js.State,
+		Status: js.Status,
+		Action: js.Action,
+		See:    js.MoreInfo,
+	}
+	if s.See == "" && js.MsgID != "" {
+		s.See = "https://openzfs.github.io/openzfs-docs/msg/" + js.MsgID
+	}
+	for _, m := range errataRegex.FindAllStringSubmatch(s.Status, -1) {
+		n, _ := strconv.Atoi(m[1])
+		s.Errata = append(s.Errata, n)
+	}
+	if err := s.Scan.parseJSON(js.ScanStats); err != nil {
+		return nil, err
+	}
+	if err := s.Removal.parseJSON(js.Removal); err != nil {
+		return nil, err
+	}
+	if err := s.Expansion.parseJSON(js.Expansion); err != nil {
+		return nil, err
+	}
+
+	roots, err := parseJSONVdevs(js.Vdevs)
+	if err != nil {
+		return nil, err
+	}
+	for _, root := range roots {
+		// allocation classes other than normal are listed in their own sections of the columnar output
+		s.Config = root.vdev
+		s.Config.Children = nil
+		for _, child := range root.children {
+			switch child.class {
+			case "log":
+				s.Logs = append(s.Logs, child.vdev)
+			case "special":
+				s.Special = append(s.Special, child.vdev)
+			case "dedup":
+				s.Dedup = append(s.Dedup, child.vdev)
+			default:
+				s.Config.Children = append(s.Config.Children, child.vdev)
+			}
+		}
+	}
+	for _, section := range []struct {
+		raw   json.RawMessage
+		vdevs *[]*Vdev
+	}{{js.Logs, &s.Logs}, {js.L2Cache, &s.Cache}, {js.Spares, &s.Spares}, {js.Special, &s.Special}, {js.Dedup, &s.Dedup}} {
+		vdevs, err := parseJSONVdevs(section.raw)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range vdevs {
+			*section.vdevs = append(*section.vdevs, v.vdev)
+		}
+	}
+
+	if err := s.parseJSONErrors(js.ErrorCount, js.Errors); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// parsedVdev is a vdev of JSON output along with its allocation class.
+type parsedVdev struct {
+	vdev     *Vdev
+	class    string
+	children []*parsedVdev
+}
+
+// parseJSONVdevs parses an object of vdevs keyed by name, as found in zpool status -j.
+func parseJSONVdevs(raw json.RawMessage) ([]*parsedVdev, error) {
+	keys, members, err := jsonMembers(raw)
+	if err != nil {
+		return nil, err
+	}
+	vdevs := make([]*parsedVdev, len(keys))
+	for i, k := range keys {
+		jv := jsonVdev{Name: k}
+		if err := json.Unmarshal(members[k], &jv); err != nil {
+			return nil, fmt.Errorf("failed to parse vdev %q: %w", k, err)
+		}
+		v := &Vdev{Name: jv.Name, State: jv.State}
+		for _, field := range []struct {
+			raw   json.RawMessage
+			field *uint64
+		}{{jv.ReadErrors, &v.Read}, {jv.WriteErrors, &v.Write}, {jv.ChecksumErrors, &v.Checksum}} {
+			if *field.field, err = jsonUint(field.raw); err != nil {
+				return nil, fmt.Errorf("failed to parse error count of vdev %q: %w", k, err)
+			}
+		}
+		if v.GUID, err = jsonUint(jv.GUID); err != nil {
+			return nil, fmt.Errorf("failed to parse guid of vdev %q: %w", k, err)
+		}
+		if err := v.Trim.parseJSON(jv.TrimState, jv.Trimmed, jv.ToTrim, jv.TrimTime); err != nil {
+			return nil, fmt.Errorf("failed to parse trim progress of vdev %q: %w", k, err)
+		}
+		if jsonValue(jv.TrimNotSup) == "1" {
+			v.Trim.State = VdevProgressUnsupported
+		}
+		if err := v.Initialize.parseJSON(jv.InitState, jv.Initialized, jv.ToInitialize, jv.InitTime); err != nil {
+			return nil, fmt.Errorf("failed to parse initialize progress of vdev %q: %w", k, err)
+		}
+		children, err := parseJSONVdevs(jv.Vdevs)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range children {
+			v.Children = append(v.Children, c.vdev)
+		}
+		vdevs[i] = &parsedVdev{vdev: v, class: jv.Class, children: children}
+	}
+	return vdevs, nil
+}
+
+// parseJSON parses the scan_stats of zpool status -j.
+func (s *ScanStatus) parseJSON(raw json.RawMessage) error {
+	s.Raw = string(raw)
+	s.State = ScanStateNone
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+	var js jsonScanStats
+	if err := json.Unmarshal(raw, &js); err != nil {
+		return fmt.Errorf("failed to parse scan status: %w", err)
+	}
+	switch js.Function {
+	case "", "NONE":
+		return nil
+	case "RESILVER":
+		s.Function = ScanFunctionResilver
+	default:
+		s.Function = ScanFunctionScrub
+	}
+
+	var err error
+	if s.Start, err = jsonTime(js.StartTime); err != nil {
+		return err
+	}
+	if s.End, err = jsonTime(js.EndTime); err != nil {
+		return err
+	}
+	for _, field := range []struct {
+		raw   json.RawMessage
+		field *uint64
+	}{{js.ToExamine, &s.Total}, {js.Examined, &s.Scanned}, {js.Issued, &s.Issued}, {js.Processed, &s.Repaired}, {js.Errors, &s.Errors}} {
+		if *field.field, err = jsonUint(field.raw); err != nil {
+			return fmt.Errorf("failed to parse scan status: %w", err)
+		}
+	}
+
+	switch js.State {
+	case "SCANNING":
+		s.State = ScanStateInProgress
+		if jsonValue(js.ScrubPause) != "-" {
+			s.State = ScanStatePaused
+		}
+		s.End = time.Time{}
+		if s.Total > 0 {
+			s.PercentDone = 100 * float64(s.Issued) / float64(s.Total)
+		}
+	case "FINISHED":
+		s.State = ScanStateFinished
+		s.Duration = s.End.Sub(s.Start)
+	case "CANCELED":
+		s.State = ScanStateCanceled
+	default:
+		return fmt.Errorf("unknown scan state %q", js.State)
+	}
+	return nil
+}
+
+type jsonRemovalStats struct {
+	Name          string          `json:"name"`
+	State         string          `json:"state"`
+	StartTime     json.RawMessage `json:"start_time"`
+	EndTime       json.RawMessage `json:"end_time"`
+	ToCopy        json.RawMessage `json:"to_copy"`
+	Copied        json.RawMessage `json:"copied"`
+	MappingMemory json.RawMessage `json:"mapping_memory"`
+}
+
+// parseJSON parses the removal_stats of zpool status -j.
+func (r *RemovalStatus) parseJSON(raw json.RawMessage) error {
+	r.Raw = string(raw)
+	r.State = ScanStateNone
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+	var js jsonRemovalStats
+	if err := json.Unmarshal(raw, &js); err != nil {
+		return fmt.Errorf("failed to parse removal status: %w", err)
+	}
+	r.Device = js.Name
+
+	var err error
+	if r.Start, err = jsonTime(js.StartTime); err != nil {
+		return err
+	}
+	if r.End, err = jsonTime(js.EndTime); err != nil {
+		return err
+	}
+	for _, field := range []struct {
+		raw   json.RawMessage
+		field *uint64
+	}{{js.ToCopy, &r.Total}, {js.Copied, &r.Copied}, {js.MappingMemory, &r.MappingMemory}} {
+		if *field.field, err = jsonUint(field.raw); err != nil {
+			return fmt.Errorf("failed to parse removal status: %w", err)
+		}
+	}
+	if r.Total > 0 {
+		r.PercentDone = 100 * float64(r.Copied) / float64(r.Total)
+	}
+
+	switch js.State {
+	case "", "NONE":
+	case "SCANNING":
+		r.State = ScanStateInProgress
+		r.End = time.Time{}
+	case "FINISHED":
+		r.State = ScanStateFinished
+		r.Duration = r.End.Sub(r.Start)
+	case "CANCELED":
+		r.State = ScanStateCanceled
+	default:
+		return fmt.Errorf("unknown removal state %q", js.State)
+	}
+	return nil
+}
+
+type jsonExpansionStats struct {
+	Name               string          `json:"name"`
+	State              string          `json:"state"`
+	ExpandingVdev      json.RawMessage `json:"expanding_vdev"`
+	StartTime          json.RawMessage `json:"start_time"`
+	EndTime            json.RawMessage `json:"end_time"`
+	ToReflow           json.RawMessage `json:"to_reflow"`
+	Reflowed           json.RawMessage `json:"reflowed"`
+	WaitingForResilver json.RawMessage `json:"waiting_for_resilver"`
+}
+
+// parseJSON parses the raidz_expand_stats of zpool status -j.
+func (e *ExpansionStatus) parseJSON(raw json.RawMessage) error {
+	e.Raw = string(raw)
+	e.State = ScanStateNone
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+	var js jsonExpansionStats
+	if err := json.Unmarshal(raw, &js); err != nil {
+		return fmt.Errorf("failed to parse expansion status: %w", err)
+	}
+	e.Vdev = js.Name
+	if id := jsonValue(js.ExpandingVdev); id != "" && !strings.Contains(e.Vdev, "-") {
+		e.Vdev += "-" + id
+	}
+
+	var err error
+	if e.Start, err = jsonTime(js.StartTime); err != nil {
+		return err
+	}
+	if e.End, err = jsonTime(js.EndTime); err != nil {
+		return err
+	}
+	for _, field := range []struct {
+		raw   json.RawMessage
+		field *uint64
+	}{{js.ToReflow, &e.Total}, {js.Reflowed, &e.Copied}} {
+		if *field.field, err = jsonUint(field.raw); err != nil {
+			return fmt.Errorf("failed to parse expansion status: %w", err)
+		}
+	}
+	if e.Total > 0 {
+		e.PercentDone = 100 * float64(e.Copied) / float64(e.Total)
+	}
+
+	switch js.State {
+	case "", "NONE":
+	case "SCANNING":
+		e.State = ScanStateInProgress
+		if v := jsonValue(js.WaitingForResilver); v != "" && v != "0" {
+			e.State = ScanStatePaused
+		}
+		e.End = time.Time{}
+	case "FINISHED":
+		e.State = ScanStateFinished
+		e.Duration = e.End.Sub(e.Start)
+	default:
+		return fmt.Errorf("unknown expansion state %q", js.State)
+	}
+	return nil
+}
+
+// parseJSON parses the trim or initialize state and progress of a vdev of zpool status -j.
+func (p *VdevProgress) parseJSON(state string, done, total, at json.RawMessage) error {
+	switch state {
+	case "":
+		return nil
+	case "NONE", "CANCELED", "UNTRIMMED", "UNINITIALIZED":
+		p.State = VdevProgressNone
+		return nil
+	case "ACTIVE":
+		p.State = VdevProgressActive
+	case "SUSPENDED":
+		p.State = VdevProgressSuspended
+	case "COMPLETE":
+		p.State = VdevProgressComplete
+	default:
+		return fmt.Errorf("unknown state %q", state)
+	}
+
+	var err error
+	if p.Done, err = jsonUint(done); err != nil {
+		return err
+	}
+	if p.Total, err = jsonUint(total); err != nil {
+		return err
+	}
+	switch {
+	case p.State == VdevProgressComplete:
+		p.PercentDone = 100
+	case p.Total > 0:
+		p.PercentDone = 100 * float64(p.Done) / float64(p.Total)
+	}
+	p.Time, err = jsonTime(at)
+	return err
+}
+
+// jsonTime parses a timestamp of JSON output, which is either in seconds since the epoch, or formatted like
+// zpool status prints it. A missing value is the zero time.
+func jsonTime(raw json.RawMessage) (time.Time, error) {
+	v := strings.TrimSpace(jsonValue(raw))
+	if v == "-" || v == "" || v == "0" {
+		return time.Time{}, nil
+	}
+	if secs, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.Unix(secs, 0), nil
+	}
+	return parseStatusTime(v)
+}
+
+// parseJSONErrors sets the errors summary and files with permanent errors from zpool status -j.
+// The files are keyed by path in an object or listed in an array.
+func (z *ZpoolStatus) parseJSONErrors(count, errs json.RawMessage) error {
+	n, err := jsonUint(count)
+	if err != nil {
+		return fmt.Errorf("failed to parse error count: %w", err)
+	}
+	var files []string
+	if err := json.Unmarshal(errs, &files); err != nil {
+		if files, _, err = jsonMembers(errs); err != nil {
+			return fmt.Errorf("failed to parse error files: %w", err)
+		}
+	}
+	z.ErrorFiles = files
+	switch {
+	case len(files) > 0:
+		z.Errors = "Permanent errors have been detected in the following files:"
+	case n > 0:
+		z.Errors = fmt.Sprintf("%d data errors, use '-v' for a list", n)
+	default:
+		z.Errors = "No known data errors"
+	}
+	return nil
+}
@@ -0,0 +1,255 @@
+package zfs
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const jsonVersion = `{"output_version": {"command": "zfs version", "vers_major": 0, "vers_minor": 1},
+ "zfs_version": {"userland": "zfs-2.3.0-1", "kernel": "zfs-kmod-2.3.0-1"}}`
+
+const jsonDatasets = `{"output_version": {"command": "zfs list", "vers_major": 0, "vers_minor": 1},
+ "datasets": {
+  "tank": {"name": "tank", "type": "FILESYSTEM", "pool": "tank", "createtxg": "1",
+   "properties": {"used": {"value": "1024", "source": {"type": "NONE", "data": "-"}},
+    "mountpoint": {"value": "/tank", "source": {"type": "DEFAULT", "data": "-"}}}},
+  "tank/vol": {"name": "tank/vol", "type": "VOLUME", "pool": "tank", "createtxg": "7",
+   "properties": {"used": {"value": 2048, "source": {"type": "NONE", "data": "-"}},
+    "mountpoint": {"value": "-", "source": {"type": "NONE", "data": "-"}}}}}}`
+
+const jsonPoolGet = `{"output_version": {"command": "zpool get", "vers_major": 0, "vers_minor": 1},
+ "pools": {"tank": {"name": "tank", "type": "POOL", "state": "ONLINE",
+  "properties": {"size": {"value": "10737418240", "source": {"type": "NONE", "data": "-"}},
+   "comment": {"value": "hello world", "source": {"type": "LOCAL", "data": "-"}}}}}}`
+
+const jsonStatusOutput = `{"output_version": {"command": "zpool status", "vers_major": 0, "vers_minor": 1},
+ "pools": {"tank": {"name": "tank", "state": "DEGRADED", "pool_guid": "1234",
+  "status": "One or more devices could not be used because the label is missing or invalid.",
+  "action": "Replace the device using 'zpool replace'.", "msgid": "ZFS-8000-4J",
+  "scan_stats": {"function": "SCRUB", "state": "SCANNING", "start_time": "1627207200", "end_time": "0",
+   "to_examine": "10737418240", "examined": "1610612736", "issued": "536870912", "processed": "0",
+   "errors": "0", "scrub_pause": "-"},
+  "vdevs": {"tank": {"name": "tank", "vdev_type": "root", "state": "DEGRADED",
+   "read_errors": "0", "write_errors": "0", "checksum_errors": "0",
+   "vdevs": {
+    "mirror-0": {"name": "mirror-0", "vdev_type": "mirror", "class": "normal", "state": "DEGRADED",
+     "read_errors": "0", "write_errors": "0", "checksum_errors": "0",
+     "vdevs": {
+      "sda": {"name": "sda", "vdev_type": "disk", "guid": "5678", "class": "normal", "state": "ONLINE",
+       "read_errors": "0", "write_errors": "0", "checksum_errors": "3"},
+      "sdb": {"name": "sdb", "vdev_type": "disk", "guid": "9012", "class": "normal", "state": "UNAVAIL",
+       "read_errors": "0", "write_errors": "0", "checksum_errors": "0"}}},
+    "sdc": {"name": "sdc", "vdev_type": "disk", "class": "log", "state": "ONLINE",
+     "read_errors": "0", "write_errors": "0", "checksum_errors": "0"}}}},
+  "l2cache": {"sdd": {"name": "sdd", "vdev_type": "disk", "class": "l2cache", "state": "ONLINE",
+   "read_errors": "0", "write_errors": "0", "checksum_errors": "0"}},
+  "spares": {"sde": {"name": "sde", "vdev_type": "disk", "class": "spare", "state": "AVAIL"}},
+  "error_count": "2",
+  "errors": {"/tank/file": {}, "tank/fs@snap:/path": {}}}}}`
+
+func TestJSONArgs(t *testing.T) {
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		{[]string{"list", "-rHp", "-t", "all", "-o", "name,used"}, []string{"list", "-j", "-rp", "-t", "all", "-o", "name,used"}},
+		{[]string{"list", "-H", "-p", "-o", "name", "tank"}, []string{"list", "-j", "-p", "-o", "name", "tank"}},
+		{[]string{"get", "-Hp", "all", "tank"}, []string{"get", "-j", "-p", "all", "tank"}},
+		// the value of -o may contain an H, e.g. of a user property
+		{[]string{"list", "-Hp", "-o", "-H", "tank"}, []string{"list", "-j", "-p", "-o", "-H", "tank"}},
+	}
+	for _, tt := range tests {
+		if got := jsonArgs(tt.args); !reflect.DeepEqual(tt.want, got) {
+			t.Errorf("jsonArgs(%q): want: %q, got: %q", tt.args, tt.want, got)
+		}
+	}
+}
+
+func TestParseJSONList(t *testing.T) {
+	lines, err := parseJSONList([]byte(jsonDatasets), "datasets", []string{"name", "type", "used", "mountpoint", "origin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"tank", "filesystem", "1024", "/tank", "-"},
+		{"tank/vol", "volume", "2048", "-", "-"},
+	}
+	if !reflect.DeepEqual(want, lines) {
+		t.Fatalf("want: %q, got: %q", want, lines)
+	}
+
+	lines, err = parseJSONList([]byte(jsonPoolGet), "pools", []string{"name", "health", "size"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := [][]string{{"tank", "ONLINE", "10737418240"}}; !reflect.DeepEqual(want, lines) {
+		t.Fatalf("want: %q, got: %q", want, lines)
+	}
+
+	if _, err := parseJSONList([]byte("NAME USED\n"), "datasets", []string{"name"}); err == nil {
+		t.Fatal("expected error for non-JSON output")
+	}
+}
+
+func TestParseJSONGet(t *testing.T) {
+	lines, err := parseJSONGet([]byte(jsonPoolGet))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"tank", "size", "10737418240", "-"},
+		{"tank", "comment", "hello world", "local"},
+	}
+	if !reflect.DeepEqual(want, lines) {
+		t.Fatalf("want: %q, got: %q", want, lines)
+	}
+}
+
+func TestParseZpoolStatusJSON(t *testing.T) {
+	statuses, err := parseZpoolStatusJSON([]byte(jsonStatusOutput))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 1 {
+		t.Fatalf("want 1 status, got %d", len(statuses))
+	}
+	s := statuses[0]
+
+	if s.Name != "tank" || s.State != "DEGRADED" {
+		t.Fatalf("unexpected pool: %s %s", s.Name, s.State)
+	}
+	if want := "https://openzfs.github.io/openzfs-docs/msg/ZFS-8000-4J"; s.See != want {
+		t.Fatalf("want see: %q, got: %q", want, s.See)
+	}
+
+	if s.Scan.Function != ScanFunctionScrub || s.Scan.State != ScanStateInProgress {
+		t.Fatalf("unexpected scan: %s %s", s.Scan.Function, s.Scan.State)
+	}
+	if want := time.Unix(1627207200, 0); !s.Scan.Start.Equal(want) {
+		t.Fatalf("want start: %s, got: %s", want, s.Scan.Start)
+	}
+	if s.Scan.Total != 10737418240 || s.Scan.Scanned != 1610612736 || s.Scan.Issued != 536870912 {
+		t.Fatalf("unexpected scan progress: %+v", s.Scan)
+	}
+	if s.Scan.PercentDone != 5 {
+		t.Fatalf("want 5%% done, got %v", s.Scan.PercentDone)
+	}
+
+	mirror := &Vdev{Name: "mirror-0", State: "DEGRADED", Children: []*Vdev{
+		{Name: "sda", State: "ONLINE", GUID: 5678, Checksum: 3},
+		{Name: "sdb", State: "UNAVAIL", GUID: 9012},
+	}}
+	want := &Vdev{Name: "tank", State: "DEGRADED", Children: []*Vdev{mirror}}
+	if !reflect.DeepEqual(want, s.Config) {
+		t.Fatalf("want config: %+v, got: %+v", want, s.Config)
+	}
+	if len(s.Logs) != 1 || s.Logs[0].Name != "sdc" {
+		t.Fatalf("unexpected logs: %+v", s.Logs)
+	}
+	if len(s.Cache) != 1 || s.Cache[0].Name != "sdd" {
+		t.Fatalf("unexpected cache: %+v", s.Cache)
+	}
+	if len(s.Spares) != 1 || s.Spares[0].Name != "sde" || s.Spares[0].State != "AVAIL" {
+		t.Fatalf("unexpected spares: %+v", s.Spares)
+	}
+
+	if want := []string{"/tank/file", "tank/fs@snap:/path"}; !reflect.DeepEqual(want, s.ErrorFiles) {
+		t.Fatalf("want error files: %q, got: %q", want, s.ErrorFiles)
+	}
+}
+
+func TestParseZpoolStatusJSONFinished(t *testing.T) {
+	out := `{"pools": {"tank": {"name": "tank", "state": "ONLINE",
+  "scan_stats": {"function": "SCRUB", "state": "FINISHED", "start_time": "1627207200", "end_time": "1627210800",
+   "to_examine": "1024", "examined": "1024", "issued": "1024", "processed": "0", "errors": "0"},
+  "removal_stats": {"name": "sdb", "state": "SCANNING", "start_time": "1627207200", "end_time": "0",
+   "to_copy": "4096", "copied": "1024", "mapping_memory": "0"},
+  "raidz_expand_stats": {"name": "raidz1", "state": "SCANNING", "expanding_vdev": "0", "start_time": "1627207200",
+   "end_time": "0", "to_reflow": "4096", "reflowed": "2048", "waiting_for_resilver": "0"},
+  "vdevs": {"tank": {"name": "tank", "state": "ONLINE", "vdevs": {
+   "sda": {"name": "sda", "class": "normal", "state": "ONLINE"}}}},
+  "error_count": "0"}}}`
+	statuses, err := parseZpoolStatusJSON([]byte(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := statuses[0]
+	if s.Scan.State != ScanStateFinished || s.Scan.Duration != time.Hour {
+		t.Fatalf("unexpected scan: %s %s", s.Scan.State, s.Scan.Duration)
+	}
+	if r := s.Removal; r.State != ScanStateInProgress || r.Device != "sdb" || r.Copied != 1024 || r.PercentDone != 25 {
+		t.Fatalf("unexpected removal: %+v", r)
+	}
+	if e := s.Expansion; e.State != ScanStateInProgress || e.Vdev != "raidz1-0" || e.Copied != 2048 || e.PercentDone != 50 {
+		t.Fatalf("unexpected expansion: %+v", e)
+	}
+	if s.Errors != "No known data errors" || s.ErrorFiles != nil {
+		t.Fatalf("unexpected errors: %q %q", s.Errors, s.ErrorFiles)
+	}
+}
+
+func TestJSONDetection(t *testing.T) {
+	r := &fakeRunner{output: func(args []string) (string, error) {
+		switch {
+		case args[1] == "version":
+			return jsonVersion, nil
+		case args[1] == "list" && args[2] == "-j":
+			return jsonDatasets, nil
+		}
+		return "", errors.New("unexpected command " + strings.Join(args, " "))
+	}}
+	ctx := WithRunner(context.Background(), r)
+
+	for i := 0; i < 2; i++ {
+		out, err := zfsListOutput(ctx, "list", "-rHp", "-o", "name,used")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := [][]string{{"tank", "1024"}, {"tank/vol", "2048"}}; !reflect.DeepEqual(want, out) {
+			t.Fatalf("want: %q, got: %q", want, out)
+		}
+	}
+	want := [][]string{
+		{"zfs", "version", "-j"},
+		{"zfs", "list", "-j", "-rp", "-o", "name,used"},
+		{"zfs", "list", "-j", "-rp", "-o", "name,used"},
+	}
+	if !reflect.DeepEqual(want, r.calls) {
+		t.Fatalf("want calls: %q, got: %q", want, r.calls)
+	}
+}
+
+func TestJSONFallback(t *testing.T) {
+	r := &fakeRunner{output: func(args []string) (string, error) {
+		if args[1] == "version" {
+			return "", errors.New("invalid option 'j'")
+		}
+		return "tank\t1024\n", nil
+	}}
+	ctx := WithRunner(context.Background(), r)
+
+	out, err := zfsListOutput(ctx, "list", "-rHp", "-o", "name,used")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := [][]string{{"tank", "1024"}}; !reflect.DeepEqual(want, out) {
+		t.Fatalf("want: %q, got: %q", want, out)
+	}
+	if got := r.calls[len(r.calls)-1]; !reflect.DeepEqual([]string{"zfs", "list", "-rHp", "-o", "name,used"}, got) {
+		t.Fatalf("unexpected call: %q", got)
+	}
+
+	SetJSONOutput(false)
+	defer SetJSONOutput(true)
+	r = &fakeRunner{output: func([]string) (string, error) { return "tank\t1024\n", nil }}
+	if _, err := zfsListOutput(WithRunner(context.Background(), r), "list", "-Hp", "-o", "name,used"); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.calls) != 1 {
+		t.Fatalf("want no version probe when JSON output is disabled, got calls: %q", r.calls)
+	}
+}
@@ -0,0 +1,261 @@
+package zfs
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ArcStats is the state of the adaptive replacement cache (ARC) of the ZFS kernel module, its second level (L2ARC)
+// and the prefetcher (zfetch), as reported by the arcstats and zfetchstats kstats.
+// Counters are cumulative since the module was loaded.
+type ArcStats struct {
+	Hits                 uint64
+	Misses               uint64
+	DemandDataHits       uint64
+	DemandDataMisses     uint64
+	DemandMetadataHits   uint64
+	DemandMetadataMisses uint64
+	PrefetchDataHits     uint64
+	PrefetchDataMisses   uint64
+	PrefetchMetaHits     uint64
+	PrefetchMetaMisses   uint64
+	MRUHits              uint64
+	MFUHits              uint64
+	MRUGhostHits         uint64
+	MFUGhostHits         uint64
+	// Size is the current size of the ARC, Target is the size the ARC is adapting to, between Min and Max.
+	Size   uint64
+	Target uint64
+	Min    uint64
+	Max    uint64
+	// DataSize, MetadataSize, HeaderSize, DbufSize, DnodeSize and BonusSize break down Size.
+	DataSize     uint64
+	MetadataSize uint64
+	HeaderSize   uint64
+	DbufSize     uint64
+	DnodeSize    uint64
+	BonusSize    uint64
+	MRUSize      uint64
+	MFUSize      uint64
+	// MemoryThrottleCount is the number of times the ARC throttled writes because of memory pressure.
+	MemoryThrottleCount uint64
+	L2                  L2ArcStats
+	Zfetch              ZfetchStats
+	// Raw holds all values of the arcstats kstat by name, including those without a field.
+	Raw map[string]uint64
+}
+
+// L2ArcStats is the state of the second level of the ARC, which is stored on cache vdevs.
+type L2ArcStats struct {
+	Hits   uint64
+	Misses uint64
+	// Size is the size of the cached data, AllocatedSize is the space it takes on the cache vdevs after compression.
+	Size          uint64
+	AllocatedSize uint64
+	// HeaderSize is the space the headers of the cached data take in the ARC.
+	HeaderSize     uint64
+	ReadBytes      uint64
+	WriteBytes     uint64
+	WritesSent     uint64
+	WritesError    uint64
+	ChecksumErrors uint64
+	IOErrors       uint64
+	Feeds          uint64
+}
+
+// ZfetchStats is the state of the prefetcher of the ZFS kernel module.
+type ZfetchStats struct {
+	Hits       uint64
+	Misses     uint64
+	MaxStreams uint64
+	// Raw holds all values of the zfetchstats kstat by name, including those without a field.
+	Raw map[string]uint64
+}
+
+// HitRatio returns the ratio of ARC hits to lookups, or zero without lookups.
+func (s *ArcStats) HitRatio() float64 {
+	return ratio(s.Hits, s.Misses)
+}
+
+// DemandHitRatio returns the ratio of ARC hits to lookups of demand reads of data and metadata, or zero without lookups.
+func (s *ArcStats) DemandHitRatio() float64 {
+	return ratio(s.DemandDataHits+s.DemandMetadataHits, s.DemandDataMisses+s.DemandMetadataMisses)
+}
+
+// PrefetchHitRatio returns the ratio of ARC hits to lookups of prefetch reads of data and metadata, or zero without lookups.
+func (s *ArcStats) PrefetchHitRatio() float64 {
+	return ratio(s.PrefetchDataHits+s.PrefetchMetaHits, s.PrefetchDataMisses+s.PrefetchMetaMisses)
+}
+
+// HitRatio returns the ratio of L2ARC hits to lookups, or zero without lookups.
+func (s *L2ArcStats) HitRatio() float64 {
+	return ratio(s.Hits, s.Misses)
+}
+
+// HitRatio returns the ratio of prefetcher hits to lookups, or zero without lookups.
+func (s *ZfetchStats) HitRatio() float64 {
+	return ratio(s.Hits, s.Misses)
+}
+
+func ratio(hits, misses uint64) float64 {
+	if hits+misses == 0 {
+		return 0
+	}
+	return float64(hits) / float64(hits+misses)
+}
+
+// GetArcStats returns the state of the ARC, L2ARC and prefetcher.
+//
+// The statistics are read as given by the Platform of the context: on Linux from /proc/spl/kstat/zfs of the
+// local host, on FreeBSD from the kstat.zfs.misc sysctl tree.
+func GetArcStats() (*ArcStats, error) {
+	return GetArcStatsContext(context.Background())
+}
+
+// GetArcStatsContext is like GetArcStats but includes a context.
+func GetArcStatsContext(ctx context.Context) (*ArcStats, error) {
+	arc, err := KstatContext(ctx, "arcstats")
+	if err != nil {
+		return nil, err
+	}
+	zfetch, err := KstatContext(ctx, "zfetchstats")
+	if err != nil {
+		return nil, err
+	}
+	return newArcStats(arc, zfetch), nil
+}
+
+// Kstat returns the values of a kstat of the ZFS kernel module by name, e.g. "arcstats" or "dmu_tx".
+// Values which are not numbers are skipped, negative values are reported as zero.
+//
+// The kstat is read as given by the Platform of the context: on Linux from /proc/spl/kstat/zfs/<name> of the
+// local host, on FreeBSD from the kstat.zfs.misc.<name> sysctl tree.
+func Kstat(name string) (map[string]uint64, error) {
+	return KstatContext(context.Background(), name)
+}
+
+// KstatContext is like Kstat but includes a context.
+func KstatContext(ctx context.Context, name string) (map[string]uint64, error) {
+	if name == "" || strings.ContainsAny(name, "/. ") {
+		return nil, fmt.Errorf("invalid kstat name %q", name)
+	}
+	return readKstat(ctx, name)
+}
+
+func newArcStats(arc, zfetch map[string]uint64) *ArcStats {
+	return &ArcStats{
+		Hits:                 arc["hits"],
+		Misses:               arc["misses"],
+		DemandDataHits:       arc["demand_data_hits"],
+		DemandDataMisses:     arc["demand_data_misses"],
+		DemandMetadataHits:   arc["demand_metadata_hits"],
+		DemandMetadataMisses: arc["demand_metadata_misses"],
+		PrefetchDataHits:     arc["prefetch_data_hits"],
+		PrefetchDataMisses:   arc["prefetch_data_misses"],
+		PrefetchMetaHits:     arc["prefetch_metadata_hits"],
+		PrefetchMetaMisses:   arc["prefetch_metadata_misses"],
+		MRUHits:              arc["mru_hits"],
+		MFUHits:              arc["mfu_hits"],
+		MRUGhostHits:         arc["mru_ghost_hits"],
+		MFUGhostHits:         arc["mfu_ghost_hits"],
+		Size:                 arc["size"],
+		Target:               arc["c"],
+		Min:                  arc["c_min"],
+		Max:                  arc["c_max"],
+		DataSize:             arc["data_size"],
+		MetadataSize:         arc["metadata_size"],
+		HeaderSize:           arc["hdr_size"],
+		DbufSize:             arc["dbuf_size"],
+		DnodeSize:            arc["dnode_size"],
+		BonusSize:            arc["bonus_size"],
+		MRUSize:              arc["mru_size"],
+		MFUSize:              arc["mfu_size"],
+		MemoryThrottleCount:  arc["memory_throttle_count"],
+		L2: L2ArcStats{
+			Hits:           arc["l2_hits"],
+			Misses:         arc["l2_misses"],
+			Size:           arc["l2_size"],
+			AllocatedSize:  arc["l2_asize"],
+			HeaderSize:     arc["l2_hdr_size"],
+			ReadBytes:      arc["l2_read_bytes"],
+			WriteBytes:     arc["l2_write_bytes"],
+			WritesSent:     arc["l2_writes_sent"],
+			WritesError:    arc["l2_writes_error"],
+			ChecksumErrors: arc["l2_cksum_bad"],
+			IOErrors:       arc["l2_io_error"],
+			Feeds:          arc["l2_feeds"],
+		},
+		Zfetch: ZfetchStats{
+			Hits:       zfetch["hits"],
+			Misses:     zfetch["misses"],
+			MaxStreams: zfetch["max_streams"],
+			Raw:        zfetch,
+		},
+		Raw: arc,
+	}
+}
+
+// example input for parseKstat
+// 13 1 0x01 123 33456 1234567 12345678
+// name                            type data
+// hits                            4    12345
+// misses                          4    678
+
+// parseKstat parses a kstat of the SPL as printed in /proc/spl/kstat/zfs.
+func parseKstat(r io.Reader) (map[string]uint64, error) {
+	values := map[string]uint64{}
+	scanner := bufio.NewScanner(r)
+	for i := 0; scanner.Scan(); i++ {
+		fields := strings.Fields(scanner.Text())
+		if i < 2 || len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("invalid kstat line %q", scanner.Text())
+		}
+		setKstat(values, fields[0], strings.Join(fields[2:], " "))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// example input for parseSysctlKstat
+// kstat.zfs.misc.arcstats.hits: 12345
+// kstat.zfs.misc.arcstats.misses: 678
+
+// parseSysctlKstat parses a kstat as printed by sysctl kstat.zfs.misc.<name>.
+func parseSysctlKstat(r io.Reader, name string) (map[string]uint64, error) {
+	prefix := "kstat.zfs.misc." + name + "."
+	values := map[string]uint64{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		i := strings.Index(line, ": ")
+		if i < 0 || !strings.HasPrefix(line, prefix) {
+			return nil, fmt.Errorf("invalid kstat line %q", line)
+		}
+		setKstat(values, line[len(prefix):i], strings.TrimSpace(line[i+2:]))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// setKstat sets a value of a kstat, skipping values which are not numbers and reporting negative ones as zero.
+func setKstat(values map[string]uint64, name, value string) {
+	if v, err := strconv.ParseUint(value, 10, 64); err == nil {
+		values[name] = v
+	} else if _, err := strconv.ParseInt(value, 10, 64); err == nil {
+		values[name] = 0
+	}
+}
@@ -0,0 +1,35 @@
+package zfs
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestGetArcStats(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kstat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(dir string) { kstatDir = dir }(kstatDir)
+	kstatDir = dir
+	for name, out := range map[string]string{"arcstats": arcstatsOutput, "zfetchstats": zfetchstatsOutput} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(out), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s, err := GetArcStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Hits != 750 || s.Zfetch.Hits != 9 {
+		t.Fatalf("unexpected stats: %+v", s)
+	}
+	if _, err := Kstat("../arcstats"); err == nil {
+		t.Fatal("expected error for invalid kstat name")
+	}
+	if _, err := Kstat("dmu_tx"); err == nil {
+		t.Fatal("expected error for missing kstat")
+	}
+}
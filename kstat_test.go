@@ -0,0 +1,102 @@
+package zfs
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const arcstatsOutput = `13 1 0x01 123 33456 1234567 12345678
+name                            type data
+hits                            4    750
+misses                          4    250
+demand_data_hits                4    300
+demand_data_misses              4    100
+size                            4    1073741824
+c                               4    2147483648
+c_min                           4    33554432
+c_max                           4    4294967296
+memory_available_bytes          3    -4096
+l2_hits                         4    10
+l2_misses                       4    30
+l2_size                         4    8192
+`
+
+const zfetchstatsOutput = `4 1 0x01 3 144 1234 5678
+name                            type data
+hits                            4    9
+misses                          4    1
+max_streams                     4    2
+`
+
+func TestParseKstat(t *testing.T) {
+	arc, err := parseKstat(strings.NewReader(arcstatsOutput))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if arc["hits"] != 750 || arc["memory_available_bytes"] != 0 {
+		t.Fatalf("unexpected values: %v", arc)
+	}
+	zfetch, err := parseKstat(strings.NewReader(zfetchstatsOutput))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := newArcStats(arc, zfetch)
+	if s.Size != 1073741824 || s.Target != 2147483648 || s.Min != 33554432 || s.Max != 4294967296 {
+		t.Fatalf("unexpected sizes: %+v", s)
+	}
+	for _, r := range []struct {
+		name      string
+		want, got float64
+	}{
+		{"arc", 0.75, s.HitRatio()},
+		{"demand", 0.75, s.DemandHitRatio()},
+		{"prefetch", 0, s.PrefetchHitRatio()},
+		{"l2arc", 0.25, s.L2.HitRatio()},
+		{"zfetch", 0.9, s.Zfetch.HitRatio()},
+	} {
+		if r.want != r.got {
+			t.Fatalf("want %s hit ratio %v, got %v", r.name, r.want, r.got)
+		}
+	}
+	if want := (L2ArcStats{Hits: 10, Misses: 30, Size: 8192}); want != s.L2 {
+		t.Fatalf("want: %+v, got: %+v", want, s.L2)
+	}
+	if s.Zfetch.MaxStreams != 2 {
+		t.Fatalf("want 2 max streams, got %d", s.Zfetch.MaxStreams)
+	}
+
+	if _, err := parseKstat(strings.NewReader("header\nname type data\nhits\n")); err == nil {
+		t.Fatal("expected error for line without value")
+	}
+}
+
+func TestParseSysctlKstat(t *testing.T) {
+	out := "kstat.zfs.misc.arcstats.hits: 750\nkstat.zfs.misc.arcstats.misses: 250\nkstat.zfs.misc.arcstats.memory_available_bytes: -4096\n"
+	values, err := parseSysctlKstat(strings.NewReader(out), "arcstats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]uint64{"hits": 750, "misses": 250, "memory_available_bytes": 0}; !reflect.DeepEqual(want, values) {
+		t.Fatalf("want: %v, got: %v", want, values)
+	}
+
+	if _, err := parseSysctlKstat(strings.NewReader("kstat.zfs.misc.zfetchstats.hits: 1\n"), "arcstats"); err == nil {
+		t.Fatal("expected error for value of another kstat")
+	}
+}
+
+func TestPlatformKstat(t *testing.T) {
+	ctx, r := withFakeRunner("kstat.zfs.misc.dmu_tx.dmu_tx_assigned: 12\n")
+	values, err := KstatContext(WithPlatform(ctx, FreeBSDPlatform{}), "dmu_tx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]uint64{"dmu_tx_assigned": 12}; !reflect.DeepEqual(want, values) {
+		t.Fatalf("want: %v, got: %v", want, values)
+	}
+	if want := []string{"sysctl", "-q", "kstat.zfs.misc.dmu_tx"}; !reflect.DeepEqual(want, r.calls[0]) {
+		t.Fatalf("want: %q, got: %q", want, r.calls[0])
+	}
+}
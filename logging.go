@@ -0,0 +1,131 @@
+package zfs
+
+import (
+	"context"
+	"strings"
+)
+
+// Level is the severity of a structured log message. The levels have the values of those of log/slog,
+// so they convert to slog.Level.
+type Level int
+
+// Levels of structured log messages.
+const (
+	LevelDebug Level = -4
+	LevelInfo  Level = 0
+	LevelWarn  Level = 4
+	LevelError Level = 8
+)
+
+// Field is a key and value attached to a structured log message, such as the pool or dataset a command acts on.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// StructuredLogger receives leveled log messages with fields. Every completed command is logged with the fields
+// command, args, duration and exit_code, along with pool and dataset if they can be told from the arguments:
+// at LevelDebug if it succeeded, LevelInfo if it was skipped by dry-run mode and LevelWarn with the field stderr
+// if it failed. Failed commands are not logged at LevelError as they include expected failures, such as looking
+// up a dataset to find out whether it exists.
+//
+// NewSlogLogger adapts a *slog.Logger.
+type StructuredLogger interface {
+	// Enabled reports whether messages of the level are logged, so fields of others need not be collected.
+	Enabled(ctx context.Context, level Level) bool
+	LogFields(ctx context.Context, level Level, msg string, fields []Field)
+}
+
+var structuredLogger StructuredLogger
+
+type loggerKey struct{}
+
+// WithLogger returns a copy of ctx which makes the Context variants of the library's functions log to l instead
+// of the StructuredLogger set by SetLogger, e.g. to add fields identifying the client or request to its messages.
+func WithLogger(ctx context.Context, l StructuredLogger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+func loggerFromContext(ctx context.Context) StructuredLogger {
+	if l, ok := ctx.Value(loggerKey{}).(StructuredLogger); ok && l != nil {
+		return l
+	}
+	return structuredLogger
+}
+
+// logCommand logs the record of a completed command to the StructuredLogger of ctx.
+func logCommand(ctx context.Context, rec *CommandRecord, stderr []byte) {
+	l := loggerFromContext(ctx)
+	level, msg := LevelDebug, "command finished"
+	switch {
+	case rec.DryRun:
+		level, msg = LevelInfo, "command skipped by dry run"
+	case rec.Err != nil:
+		level, msg = LevelWarn, "command failed"
+	}
+	if l == nil || !l.Enabled(ctx, level) {
+		return
+	}
+
+	fields := []Field{
+		{"command", rec.Command},
+		{"args", strings.Join(rec.Args, " ")},
+	}
+	pool, dataset := commandTarget(rec.Command, rec.Args)
+	if pool != "" {
+		fields = append(fields, Field{"pool", pool})
+	}
+	if dataset != "" {
+		fields = append(fields, Field{"dataset", dataset})
+	}
+	fields = append(fields, Field{"duration", rec.Duration}, Field{"exit_code", rec.ExitCode})
+	if rec.Err != nil {
+		fields = append(fields, Field{"stderr", strings.TrimSpace(string(stderr))})
+	}
+	l.LogFields(ctx, level, msg, fields)
+}
+
+// commandTarget returns the pool and dataset a zfs or zpool command acts on, as far as they can be told from its
+// arguments: the last operand of zfs commands, and the first operand of zpool commands or the second for zpool
+// get and set, which are preceded by properties. Operands such as devices, given as absolute paths, and
+// properties are skipped.
+func commandTarget(command string, args []string) (pool, dataset string) {
+	if len(args) == 0 {
+		return "", ""
+	}
+	var operands []string
+	switch command {
+	case "zfs":
+		operands = commandOperands(args[1:], "otsSdOxVbe")
+	case "zpool":
+		operands = commandOperands(args[1:], "oOdcRTstm")
+	default:
+		return "", ""
+	}
+	if len(operands) == 0 {
+		return "", ""
+	}
+
+	if command == "zfs" {
+		dataset = operands[len(operands)-1]
+		return dataset[:strings.IndexAny(dataset+"/", "/@#")], dataset
+	}
+	if args[0] == "get" || args[0] == "set" {
+		operands = operands[1:]
+	}
+	if len(operands) == 0 {
+		return "", ""
+	}
+	return operands[0], ""
+}
+
+// commandOperands returns the operands of args which may name a pool or dataset.
+func commandOperands(args []string, valueFlags string) []string {
+	var operands []string
+	for _, arg := range positionalArgs(args, valueFlags) {
+		if arg != "-" && !strings.HasPrefix(arg, "/") && !strings.Contains(arg, "=") {
+			operands = append(operands, arg)
+		}
+	}
+	return operands
+}
@@ -0,0 +1,41 @@
+//go:build go1.21
+// +build go1.21
+
+package zfs
+
+import (
+	"context"
+	"log/slog"
+)
+
+// SlogLogger is a StructuredLogger which logs to a *slog.Logger. It also implements Logger, so it can be passed
+// to SetLogger, but ignores the command lines logged before commands are executed.
+type SlogLogger struct {
+	Logger *slog.Logger
+}
+
+// NewSlogLogger returns a StructuredLogger logging to l, or to slog.Default() if l is nil.
+func NewSlogLogger(l *slog.Logger) *SlogLogger {
+	if l == nil {
+		l = slog.Default()
+	}
+	return &SlogLogger{Logger: l}
+}
+
+// Log implements Logger.
+func (*SlogLogger) Log([]string) {
+}
+
+// Enabled implements StructuredLogger.
+func (s *SlogLogger) Enabled(ctx context.Context, level Level) bool {
+	return s.Logger.Enabled(ctx, slog.Level(level))
+}
+
+// LogFields implements StructuredLogger.
+func (s *SlogLogger) LogFields(ctx context.Context, level Level, msg string, fields []Field) {
+	attrs := make([]slog.Attr, len(fields))
+	for i, f := range fields {
+		attrs[i] = slog.Any(f.Key, f.Value)
+	}
+	s.Logger.LogAttrs(ctx, slog.Level(level), msg, attrs...)
+}
@@ -0,0 +1,26 @@
+//go:build go1.21
+// +build go1.21
+
+package zfs
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestSlogLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewSlogLogger(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	ctx, _ := withFakeRunner("")
+	if err := zfs(WithLogger(ctx, l), "snapshot", "tank/fs@a"); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, part := range []string{"level=DEBUG", `msg="command finished"`, "command=zfs", "pool=tank", "dataset=tank/fs@a"} {
+		if !strings.Contains(out, part) {
+			t.Fatalf("expected %q in %q", part, out)
+		}
+	}
+}
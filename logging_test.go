@@ -0,0 +1,86 @@
+package zfs
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// recordingLogger records the messages of levels from min up.
+type recordingLogger struct {
+	min      Level
+	messages []string
+	fields   []map[string]interface{}
+}
+
+func (l *recordingLogger) Enabled(_ context.Context, level Level) bool {
+	return level >= l.min
+}
+
+func (l *recordingLogger) LogFields(_ context.Context, _ Level, msg string, fields []Field) {
+	m := map[string]interface{}{}
+	for _, f := range fields {
+		m[f.Key] = f.Value
+	}
+	l.messages = append(l.messages, msg)
+	l.fields = append(l.fields, m)
+}
+
+func TestCommandTarget(t *testing.T) {
+	for cmd, want := range map[string][2]string{
+		"zfs get -Hp -o name,property,value,source all tank/fs":   {"tank", "tank/fs"},
+		"zfs snapshot -r tank/fs@a":                               {"tank", "tank/fs@a"},
+		"zfs set compression=lz4 tank/fs":                         {"tank", "tank/fs"},
+		"zfs list -Hp -o name -t snapshot":                        {"", ""},
+		"zpool create -o ashift=12 tank mirror /dev/sda /dev/sdb": {"tank", ""},
+		"zpool get -Hp all tank":                                  {"tank", ""},
+		"zpool status -v -P tank":                                 {"tank", ""},
+		"zpool labelclear -f /dev/sda":                            {"", ""},
+		"udevadm settle":                                          {"", ""},
+	} {
+		args := strings.Fields(cmd)
+		pool, dataset := commandTarget(args[0], args[1:])
+		if got := [2]string{pool, dataset}; got != want {
+			t.Errorf("%s: want %q, got %q", cmd, want, got)
+		}
+	}
+}
+
+func TestWithLogger(t *testing.T) {
+	l := &recordingLogger{min: LevelDebug}
+	r := &fakeRunner{output: func(args []string) (string, error) {
+		if args[1] == "destroy" {
+			return "", exitError(1)
+		}
+		return "", nil
+	}}
+	ctx := WithLogger(WithRunner(context.Background(), r), l)
+	if err := zfs(ctx, "snapshot", "tank/fs@a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := zfs(ctx, "destroy", "tank/fs@a"); err == nil {
+		t.Fatal("expected error")
+	}
+	if err := zfs(WithDryRun(ctx, true), "destroy", "tank/fs@a"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"command finished", "command failed", "command skipped by dry run"}
+	if strings.Join(l.messages, ",") != strings.Join(want, ",") {
+		t.Fatalf("want messages %q, got %q", want, l.messages)
+	}
+	f := l.fields[1]
+	if f["command"] != "zfs" || f["args"] != "destroy tank/fs@a" || f["pool"] != "tank" || f["dataset"] != "tank/fs@a" ||
+		f["exit_code"] != 1 || f["stderr"] != exitError(1).Error() {
+		t.Fatalf("unexpected fields %v", f)
+	}
+
+	l = &recordingLogger{min: LevelWarn}
+	ctx = WithLogger(ctx, l)
+	if err := zfs(ctx, "snapshot", "tank/fs@a"); err != nil {
+		t.Fatal(err)
+	}
+	if len(l.messages) != 0 {
+		t.Fatalf("expected no messages below warn level, got %q", l.messages)
+	}
+}
@@ -0,0 +1,480 @@
+// Package lzc provides a zfs.Runner which performs hot-path operations with libzfs_core ioctls rather than by
+// executing zfs, saving the overhead of a process per command, e.g. when creating thousands of snapshots per hour.
+//
+// The commands run natively are snapshot without -r, destroy of snapshots, hold and release without -r, full and
+// incremental sends of snapshots with -L, -e, -c and -w, and receives into a snapshot name with -F. All other
+// commands, including property lookups, which libzfs_core does not provide, and those with other flags are run by
+// the fallback Runner.
+//
+// libzfs_core is only used if the package is built with cgo and the lzc build tag, which requires its headers and
+// those of libnvpair, and if it can be initialized at runtime, see Available. Otherwise all commands fall back.
+//
+// Usage:
+//
+//	go build -tags lzc ./...
+//
+//	zfs.SetRunner(lzc.New(nil))
+//	snaps, err := zfs.CreateSnapshots([]string{"tank/a@auto", "tank/b@auto"}, false, nil)
+package lzc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"syscall"
+
+	zfs "github.com/mistifyio/go-zfs/v3"
+)
+
+// errNotBuilt is returned by the native functions if the package was built without libzfs_core.
+var errNotBuilt = errors.New("built without libzfs_core, build with cgo and the lzc tag")
+
+// Available reports whether commands are run with libzfs_core, or the error why they are not.
+func Available() error {
+	return nativeInit()
+}
+
+// Send flags of libzfs_core, which are those of enum lzc_send_flags.
+const (
+	sendEmbedData  = 1 << 0
+	sendLargeBlock = 1 << 1
+	sendCompress   = 1 << 2
+	sendRaw        = 1 << 3
+)
+
+// library performs the native operations, returning the name of the dataset an error is about if known.
+type library interface {
+	snapshot(snaps []string, props map[string]string) (string, error)
+	destroySnapshots(snaps []string, deferDestroy bool) (string, error)
+	hold(snaps []string, tag string) (string, error)
+	release(snaps []string, tag string) (string, error)
+	send(ctx context.Context, snap, from string, flags int, w io.Writer) error
+	receive(ctx context.Context, snap string, force, raw bool, r io.Reader) error
+}
+
+// Runner runs zfs commands with libzfs_core where possible and all others with its fallback.
+type Runner struct {
+	// Fallback runs the commands which are not run natively, zfs.ExecRunner if nil.
+	Fallback zfs.Runner
+
+	lib library
+}
+
+// New returns a Runner falling back to fallback, or zfs.ExecRunner if nil.
+func New(fallback zfs.Runner) *Runner {
+	return &Runner{Fallback: fallback}
+}
+
+func (r *Runner) fallback() zfs.Runner {
+	if r.Fallback != nil {
+		return r.Fallback
+	}
+	return zfs.ExecRunner{}
+}
+
+// library returns the library which runs native operations, nil if commands fall back.
+func (r *Runner) library() library {
+	if r.lib != nil {
+		return r.lib
+	}
+	if nativeInit() != nil {
+		return nil
+	}
+	return nativeLibrary{}
+}
+
+// Run implements zfs.Runner.
+func (r *Runner) Run(ctx context.Context, name string, args ...string) ([]byte, []byte, error) {
+	op := parseCommand(name, args)
+	lib := r.library()
+	if op == nil || lib == nil || op.kind == opReceive {
+		return r.fallback().Run(ctx, name, args...)
+	}
+	var stdout bytes.Buffer
+	stderr, err := op.run(ctx, lib, nil, &stdout)
+	return stdout.Bytes(), stderr, err
+}
+
+// RunStream implements zfs.StreamRunner. Commands which fall back are streamed if the fallback Runner
+// implements zfs.StreamRunner.
+func (r *Runner) RunStream(ctx context.Context, stdin io.Reader, stdout io.Writer, name string, args ...string) ([]byte, error) {
+	op := parseCommand(name, args)
+	lib := r.library()
+	if op == nil || lib == nil || (op.kind == opReceive && stdin == nil) {
+		return r.runStreamFallback(ctx, stdin, stdout, name, args...)
+	}
+	if stdout == nil {
+		stdout = ioutil.Discard
+	}
+	return op.run(ctx, lib, stdin, stdout)
+}
+
+func (r *Runner) runStreamFallback(ctx context.Context, stdin io.Reader, stdout io.Writer, name string, args ...string) ([]byte, error) {
+	fallback := r.fallback()
+	if sr, ok := fallback.(zfs.StreamRunner); ok {
+		return sr.RunStream(ctx, stdin, stdout, name, args...)
+	}
+	if stdin != nil {
+		return nil, errors.New("fallback runner does not support streaming stdin")
+	}
+	out, stderr, err := fallback.Run(ctx, name, args...)
+	if err == nil && stdout != nil {
+		_, err = stdout.Write(out)
+	}
+	return stderr, err
+}
+
+// Kinds of native operations.
+const (
+	opSnapshot = iota
+	opDestroy
+	opHold
+	opRelease
+	opSend
+	opReceive
+)
+
+// operation is a zfs command which can be run natively.
+type operation struct {
+	kind  int
+	snaps []string
+	props map[string]string
+	tag   string
+	// deferDestroy is set for destroy -d, force for receive -F.
+	deferDestroy bool
+	force        bool
+	from         string
+	sendFlags    int
+}
+
+// parseCommand returns the native operation of a zfs command, nil if it is run by the fallback.
+func parseCommand(name string, args []string) *operation {
+	if name != "zfs" || len(args) < 2 {
+		return nil
+	}
+	flags, operands, ok := splitFlags(args[1:])
+	if !ok || len(operands) == 0 {
+		return nil
+	}
+	op := &operation{}
+	switch args[0] {
+	case "snapshot", "snap":
+		op.kind = opSnapshot
+		for _, f := range flags {
+			if f[0] != "o" {
+				return nil
+			}
+			parts := strings.SplitN(f[1], "=", 2)
+			if len(parts) != 2 {
+				return nil
+			}
+			if op.props == nil {
+				op.props = map[string]string{}
+			}
+			op.props[parts[0]] = parts[1]
+		}
+		op.snaps = operands
+	case "destroy":
+		op.kind = opDestroy
+		for _, f := range flags {
+			if f[0] != "d" {
+				return nil
+			}
+			op.deferDestroy = true
+		}
+		if len(operands) != 1 {
+			return nil
+		}
+		op.snaps = expandSnapshots(operands[0])
+	case "hold", "release":
+		op.kind = opHold
+		if args[0] == "release" {
+			op.kind = opRelease
+		}
+		if len(flags) > 0 || len(operands) < 2 {
+			return nil
+		}
+		op.tag, op.snaps = operands[0], operands[1:]
+	case "send":
+		op.kind = opSend
+		for _, f := range flags {
+			switch f[0] {
+			case "L":
+				op.sendFlags |= sendLargeBlock
+			case "e":
+				op.sendFlags |= sendEmbedData
+			case "c":
+				op.sendFlags |= sendCompress
+			case "w":
+				op.sendFlags |= sendRaw
+			case "i":
+				op.from = f[1]
+			default:
+				return nil
+			}
+		}
+		if len(operands) != 1 {
+			return nil
+		}
+		op.snaps = operands
+		i := strings.IndexByte(operands[0], '@')
+		if i > 0 && (strings.HasPrefix(op.from, "@") || strings.HasPrefix(op.from, "#")) {
+			// the short form of an incremental source names a snapshot or bookmark of the sent dataset
+			op.from = operands[0][:i] + op.from
+		}
+	case "receive", "recv":
+		op.kind = opReceive
+		for _, f := range flags {
+			if f[0] != "F" {
+				return nil
+			}
+			op.force = true
+		}
+		if len(operands) != 1 {
+			return nil
+		}
+		op.snaps = operands
+	default:
+		return nil
+	}
+	for _, snap := range op.snaps {
+		if !strings.Contains(snap, "@") {
+			return nil
+		}
+	}
+	return op
+}
+
+// splitFlags splits args into flags, with the values of -o and -i, and operands. Grouped flags such as -Lec
+// are split. It returns false for arguments it does not understand, such as long options.
+func splitFlags(args []string) ([][2]string, []string, bool) {
+	var flags [][2]string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if len(arg) < 2 || arg[0] != '-' {
+			return flags, args[i:], true
+		}
+		if arg[1] == '-' {
+			return nil, nil, false
+		}
+		for j := 1; j < len(arg); j++ {
+			f := arg[j : j+1]
+			if f != "o" && f != "i" {
+				flags = append(flags, [2]string{f})
+				continue
+			}
+			value := arg[j+1:]
+			if value == "" {
+				if i+1 >= len(args) {
+					return nil, nil, false
+				}
+				i++
+				value = args[i]
+			}
+			flags = append(flags, [2]string{f, value})
+			break
+		}
+	}
+	return flags, nil, true
+}
+
+// expandSnapshots expands the comma separated snapshots of a dataset, such as tank/fs@a,b, to their full names.
+// Ranges such as tank/fs@a%c are not expanded.
+func expandSnapshots(name string) []string {
+	i := strings.IndexByte(name, '@')
+	if i < 0 || strings.Contains(name, "%") {
+		return []string{name}
+	}
+	var snaps []string
+	for _, s := range strings.Split(name[i+1:], ",") {
+		snaps = append(snaps, name[:i+1]+s)
+	}
+	return snaps
+}
+
+// run performs the operation with lib and returns the stderr zfs would print on failure.
+func (op *operation) run(ctx context.Context, lib library, stdin io.Reader, stdout io.Writer) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var name string
+	var err error
+	var action string
+	switch op.kind {
+	case opSnapshot:
+		action = "create snapshot"
+		name, err = lib.snapshot(op.snaps, op.props)
+	case opDestroy:
+		action = "destroy snapshot"
+		name, err = lib.destroySnapshots(op.snaps, op.deferDestroy)
+	case opHold:
+		action = "hold snapshot"
+		name, err = lib.hold(op.snaps, op.tag)
+	case opRelease:
+		action = "release hold from snapshot"
+		name, err = lib.release(op.snaps, op.tag)
+	case opSend:
+		action = "send"
+		err = lib.send(ctx, op.snaps[0], op.from, op.sendFlags, stdout)
+	case opReceive:
+		action = "receive"
+		br := bufio.NewReader(stdin)
+		var raw bool
+		if raw, err = rawStream(br); err == nil {
+			err = lib.receive(ctx, op.snaps[0], op.force, raw, br)
+		}
+	}
+	if err == nil {
+		return nil, nil
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if name == "" {
+		name = op.snaps[0]
+	}
+	var errno syscall.Errno
+	if !errors.As(err, &errno) {
+		return []byte(fmt.Sprintf("cannot %s '%s': %s\n", action, name, err)), &exitError{err: err}
+	}
+	return []byte(fmt.Sprintf("cannot %s '%s': %s\n", action, name, errnoMessage(errno))), &exitError{err: err}
+}
+
+// errnoMessage returns the message zfs prints for an errno, which zfs.Error matches its conditions against.
+func errnoMessage(errno syscall.Errno) string {
+	switch errno {
+	case syscall.EEXIST:
+		return "dataset already exists"
+	case syscall.ENOENT:
+		return "dataset does not exist"
+	case syscall.EBUSY:
+		return "dataset is busy"
+	case syscall.EPERM, syscall.EACCES:
+		return "permission denied"
+	}
+	return errno.Error()
+}
+
+// exitError is the error of a failed native operation, which reports the exit code zfs exits with.
+type exitError struct {
+	err error
+}
+
+func (e *exitError) Error() string {
+	return "exit status 1: " + e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
+// ExitCode returns 1, the exit code of zfs for failed commands.
+func (e *exitError) ExitCode() int {
+	return 1
+}
+
+// Fields of the begin record of a send stream.
+const (
+	streamMagic   = 0x2F5bacbac
+	featureRaw    = 1 << 24
+	beginRecordAt = 8
+)
+
+// rawStream reports whether the send stream of r is raw, from the feature flags of its begin record, which
+// libzfs_core must be told. The record is peeked, so r still returns the complete stream.
+func rawStream(r *bufio.Reader) (bool, error) {
+	header, err := r.Peek(beginRecordAt + 16)
+	if err != nil {
+		return false, fmt.Errorf("invalid send stream: %w", err)
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	if order.Uint64(header[beginRecordAt:]) != streamMagic {
+		order = binary.BigEndian
+		if order.Uint64(header[beginRecordAt:]) != streamMagic {
+			return false, errors.New("invalid send stream: bad magic number")
+		}
+	}
+	// the feature flags are bits 2 to 31 of the version info
+	features := order.Uint64(header[beginRecordAt+8:]) >> 2 & (1<<30 - 1)
+	return features&featureRaw != 0, nil
+}
+
+// nativeLibrary is the library of libzfs_core.
+type nativeLibrary struct{}
+
+func (nativeLibrary) snapshot(snaps []string, props map[string]string) (string, error) {
+	return nativeSnapshot(snaps, props)
+}
+
+func (nativeLibrary) destroySnapshots(snaps []string, deferDestroy bool) (string, error) {
+	return nativeDestroySnapshots(snaps, deferDestroy)
+}
+
+func (nativeLibrary) hold(snaps []string, tag string) (string, error) {
+	return nativeHold(snaps, tag)
+}
+
+func (nativeLibrary) release(snaps []string, tag string) (string, error) {
+	return nativeRelease(snaps, tag)
+}
+
+// send writes the stream to w through a pipe, whose read end is closed if ctx becomes done, failing the send.
+func (nativeLibrary) send(ctx context.Context, snap, from string, flags int, w io.Writer) error {
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	copied := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(w, pr)
+		// a writer which stopped early makes the send fail
+		_ = pr.Close()
+		copied <- err
+	}()
+	stop := closeOnDone(ctx, pr)
+	err = nativeSend(snap, from, flags, pw.Fd())
+	stop()
+	_ = pw.Close()
+	if cerr := <-copied; err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// receive reads the stream from r through a pipe, whose write end is closed if ctx becomes done.
+func (nativeLibrary) receive(ctx context.Context, snap string, force, raw bool, r io.Reader) error {
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	go func() {
+		// a failed receive stops reading, which fails the copy
+		_, _ = io.Copy(pw, r)
+		_ = pw.Close()
+	}()
+	stop := closeOnDone(ctx, pw)
+	err = nativeReceive(snap, force, raw, pr.Fd())
+	stop()
+	_ = pr.Close()
+	return err
+}
+
+// closeOnDone closes f once ctx becomes done, until the returned function is called.
+func closeOnDone(ctx context.Context, f *os.File) func() {
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = f.Close()
+		case <-done:
+		}
+	}()
+	return func() { close(done) }
+}
@@ -0,0 +1,189 @@
+package lzc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"syscall"
+	"testing"
+
+	zfs "github.com/mistifyio/go-zfs/v3"
+	"github.com/mistifyio/go-zfs/v3/zfstest"
+)
+
+func ok(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func equals(t *testing.T, want, got interface{}) {
+	t.Helper()
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("want: %#v, got: %#v", want, got)
+	}
+}
+
+// fakeLibrary performs the native operations with the zfs commands of a backend and records them.
+type fakeLibrary struct {
+	b     *zfstest.Backend
+	calls []string
+	err   error
+}
+
+func (l *fakeLibrary) run(op string, args ...string) (string, error) {
+	l.calls = append(l.calls, op)
+	if l.err != nil {
+		return args[len(args)-1], l.err
+	}
+	_, stderr, err := l.b.Run(context.Background(), "zfs", append([]string{op}, args...)...)
+	if err != nil {
+		return "", errors.New(string(stderr))
+	}
+	return "", nil
+}
+
+func (l *fakeLibrary) snapshot(snaps []string, props map[string]string) (string, error) {
+	return l.run("snapshot", snaps...)
+}
+
+func (l *fakeLibrary) destroySnapshots(snaps []string, deferDestroy bool) (string, error) {
+	for _, snap := range snaps {
+		if name, err := l.run("destroy", snap); err != nil {
+			return name, err
+		}
+	}
+	return "", nil
+}
+
+func (l *fakeLibrary) hold(snaps []string, tag string) (string, error) {
+	return l.run("hold", append([]string{tag}, snaps...)...)
+}
+
+func (l *fakeLibrary) release(snaps []string, tag string) (string, error) {
+	return l.run("release", append([]string{tag}, snaps...)...)
+}
+
+func (l *fakeLibrary) send(ctx context.Context, snap, from string, flags int, w io.Writer) error {
+	l.calls = append(l.calls, "send")
+	_, err := w.Write([]byte("stream of " + snap))
+	return err
+}
+
+func (l *fakeLibrary) receive(ctx context.Context, snap string, force, raw bool, r io.Reader) error {
+	l.calls = append(l.calls, "receive")
+	_, err := ioutil.ReadAll(r)
+	return err
+}
+
+func TestParseCommand(t *testing.T) {
+	for name, test := range map[string]struct {
+		args []string
+		want *operation
+	}{
+		"snapshots": {
+			args: []string{"snapshot", "-o", "com.example:tag=a", "tank/a@s", "tank/b@s"},
+			want: &operation{kind: opSnapshot, snaps: []string{"tank/a@s", "tank/b@s"}, props: map[string]string{"com.example:tag": "a"}},
+		},
+		"destroy batch": {
+			args: []string{"destroy", "-d", "tank/fs@a,b"},
+			want: &operation{kind: opDestroy, snaps: []string{"tank/fs@a", "tank/fs@b"}, deferDestroy: true},
+		},
+		"release": {
+			args: []string{"release", "keep", "tank/fs@a"},
+			want: &operation{kind: opRelease, tag: "keep", snaps: []string{"tank/fs@a"}},
+		},
+		"incremental send": {
+			args: []string{"send", "-Lc", "-i", "@a", "tank/fs@b"},
+			want: &operation{kind: opSend, snaps: []string{"tank/fs@b"}, from: "tank/fs@a", sendFlags: sendLargeBlock | sendCompress},
+		},
+		"receive": {
+			args: []string{"receive", "-F", "backup/fs@b"},
+			want: &operation{kind: opReceive, snaps: []string{"backup/fs@b"}, force: true},
+		},
+		"recursive snapshot":    {args: []string{"snapshot", "-r", "tank@s"}},
+		"destroy filesystem":    {args: []string{"destroy", "tank/fs"}},
+		"destroy dry run":       {args: []string{"destroy", "-nvp", "tank/fs@a"}},
+		"recursive hold":        {args: []string{"hold", "-r", "keep", "tank/fs@a"}},
+		"replication send":      {args: []string{"send", "-R", "tank/fs@a"}},
+		"intermediary send":     {args: []string{"send", "-I", "@a", "tank/fs@b"}},
+		"redacted send":         {args: []string{"send", "--redact", "book", "tank/fs@b"}},
+		"receive into dataset":  {args: []string{"receive", "backup/fs"}},
+		"receive with property": {args: []string{"receive", "-o", "readonly=on", "backup/fs@a"}},
+		"get":                   {args: []string{"get", "-Hp", "all", "tank/fs"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			equals(t, test.want, parseCommand("zfs", test.args))
+		})
+	}
+	equals(t, (*operation)(nil), parseCommand("zpool", []string{"destroy", "tank@a"}))
+}
+
+func TestRunner(t *testing.T) {
+	b := zfstest.New()
+	ctx := zfs.WithRunner(context.Background(), b)
+	_, err := zfs.CreateZpoolContext(ctx, "tank", nil, "disk0")
+	ok(t, err)
+	_, err = zfs.CreateFilesystemContext(ctx, "tank/fs", nil)
+	ok(t, err)
+
+	lib := &fakeLibrary{b: b}
+	ctx = zfs.WithRunner(ctx, &Runner{Fallback: b, lib: lib})
+	snaps, err := zfs.CreateSnapshotsContext(ctx, []string{"tank/fs@a", "tank/fs@b"}, false, nil)
+	ok(t, err)
+	equals(t, 2, len(snaps))
+	ok(t, snaps[0].HoldContext(ctx, "keep", false))
+	ok(t, snaps[0].ReleaseContext(ctx, "keep", false))
+	var stream bytes.Buffer
+	ok(t, snaps[1].SendToContext(ctx, &stream, zfs.SendOptions{From: "@a"}))
+	equals(t, "stream of tank/fs@b", stream.String())
+	ok(t, zfs.DestroySnapshotsBatchContext(ctx, []string{"tank/fs@a", "tank/fs@b"}))
+	equals(t, []string{"snapshot", "hold", "release", "send", "destroy", "destroy"}, lib.calls)
+
+	lib.err = syscall.EEXIST
+	_, err = zfs.CreateSnapshotsContext(ctx, []string{"tank/fs@a"}, false, nil)
+	if !errors.Is(err, zfs.ErrDatasetExists) {
+		t.Fatalf("expected native error to be detected as ErrDatasetExists, got %v", err)
+	}
+	var zerr *zfs.Error
+	if !errors.As(err, &zerr) || zerr.ExitCode != 1 {
+		t.Fatalf("expected zfs.Error with exit code 1, got %v", err)
+	}
+}
+
+func TestRunnerFallback(t *testing.T) {
+	b := zfstest.New()
+	ctx := zfs.WithRunner(context.Background(), New(b))
+	// without libzfs_core all commands are run by the fallback
+	_, err := zfs.CreateZpoolContext(ctx, "tank", nil, "disk0")
+	ok(t, err)
+	_, err = zfs.CreateSnapshotsContext(ctx, []string{"tank@a"}, false, nil)
+	ok(t, err)
+	if err := Available(); err == nil {
+		t.Skip("built with libzfs_core")
+	}
+}
+
+func TestRawStream(t *testing.T) {
+	header := func(order binary.ByteOrder, features uint64) *bufio.Reader {
+		b := make([]byte, 312)
+		order.PutUint64(b[8:], streamMagic)
+		order.PutUint64(b[16:], features<<2|1)
+		return bufio.NewReader(bytes.NewReader(b))
+	}
+	raw, err := rawStream(header(binary.LittleEndian, featureRaw|1<<19))
+	ok(t, err)
+	equals(t, true, raw)
+	raw, err = rawStream(header(binary.BigEndian, 1<<19))
+	ok(t, err)
+	equals(t, false, raw)
+	if _, err := rawStream(bufio.NewReader(bytes.NewReader(make([]byte, 312)))); err == nil {
+		t.Fatal("expected error for stream without magic number")
+	}
+}
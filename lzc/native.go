@@ -0,0 +1,151 @@
+//go:build linux && cgo && lzc
+// +build linux,cgo,lzc
+
+package lzc
+
+/*
+#cgo CFLAGS: -I/usr/include/libzfs -I/usr/include/libspl -D_LARGEFILE64_SOURCE
+#cgo LDFLAGS: -lzfs_core -lnvpair
+#include <stdlib.h>
+#include <libzfs_core.h>
+#include <libnvpair.h>
+*/
+import "C"
+
+import (
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	initOnce sync.Once
+	initErr  error
+)
+
+func nativeInit() error {
+	initOnce.Do(func() {
+		if rc := C.libzfs_core_init(); rc != 0 {
+			initErr = syscall.Errno(rc)
+		}
+	})
+	return initErr
+}
+
+// nameList returns an nvlist of the names as booleans, the form of the snapshot lists of libzfs_core.
+func nameList(names []string) *C.nvlist_t {
+	nvl := C.fnvlist_alloc()
+	for _, name := range names {
+		cname := C.CString(name)
+		C.fnvlist_add_boolean(nvl, cname)
+		C.free(unsafe.Pointer(cname))
+	}
+	return nvl
+}
+
+// stringList returns an nvlist mapping the keys to the string values.
+func stringList(values map[string]string) *C.nvlist_t {
+	nvl := C.fnvlist_alloc()
+	for k, v := range values {
+		ck, cv := C.CString(k), C.CString(v)
+		C.fnvlist_add_string(nvl, ck, cv)
+		C.free(unsafe.Pointer(ck))
+		C.free(unsafe.Pointer(cv))
+	}
+	return nvl
+}
+
+// listError returns the dataset and errno of the first entry of the error list of a failed operation,
+// or rc if there is none, and frees the list.
+func listError(rc C.int, errlist *C.nvlist_t) (string, error) {
+	if errlist != nil {
+		defer C.fnvlist_free(errlist)
+	}
+	if rc == 0 {
+		return "", nil
+	}
+	if errlist != nil {
+		if pair := C.nvlist_next_nvpair(errlist, nil); pair != nil {
+			var errno C.int32_t
+			if C.nvpair_value_int32(pair, &errno) == 0 {
+				return C.GoString(C.nvpair_name(pair)), syscall.Errno(errno)
+			}
+		}
+	}
+	return "", syscall.Errno(rc)
+}
+
+func boolean(b bool) C.boolean_t {
+	if b {
+		return C.B_TRUE
+	}
+	return C.B_FALSE
+}
+
+func nativeSnapshot(snaps []string, props map[string]string) (string, error) {
+	snapList, propList := nameList(snaps), stringList(props)
+	defer C.fnvlist_free(snapList)
+	defer C.fnvlist_free(propList)
+	var errlist *C.nvlist_t
+	rc := C.lzc_snapshot(snapList, propList, &errlist)
+	return listError(rc, errlist)
+}
+
+func nativeDestroySnapshots(snaps []string, deferDestroy bool) (string, error) {
+	snapList := nameList(snaps)
+	defer C.fnvlist_free(snapList)
+	var errlist *C.nvlist_t
+	rc := C.lzc_destroy_snaps(snapList, boolean(deferDestroy), &errlist)
+	return listError(rc, errlist)
+}
+
+func nativeHold(snaps []string, tag string) (string, error) {
+	holds := make(map[string]string, len(snaps))
+	for _, snap := range snaps {
+		holds[snap] = tag
+	}
+	holdList := stringList(holds)
+	defer C.fnvlist_free(holdList)
+	var errlist *C.nvlist_t
+	// without a cleanup descriptor the holds persist, as those of zfs hold
+	rc := C.lzc_hold(holdList, -1, &errlist)
+	return listError(rc, errlist)
+}
+
+func nativeRelease(snaps []string, tag string) (string, error) {
+	tags := nameList([]string{tag})
+	defer C.fnvlist_free(tags)
+	holdList := C.fnvlist_alloc()
+	defer C.fnvlist_free(holdList)
+	for _, snap := range snaps {
+		csnap := C.CString(snap)
+		C.fnvlist_add_nvlist(holdList, csnap, tags)
+		C.free(unsafe.Pointer(csnap))
+	}
+	var errlist *C.nvlist_t
+	rc := C.lzc_release(holdList, &errlist)
+	return listError(rc, errlist)
+}
+
+func nativeSend(snap, from string, flags int, fd uintptr) error {
+	csnap := C.CString(snap)
+	defer C.free(unsafe.Pointer(csnap))
+	var cfrom *C.char
+	if from != "" {
+		cfrom = C.CString(from)
+		defer C.free(unsafe.Pointer(cfrom))
+	}
+	if rc := C.lzc_send(csnap, cfrom, C.int(fd), C.enum_lzc_send_flags(flags)); rc != 0 {
+		return syscall.Errno(rc)
+	}
+	return nil
+}
+
+func nativeReceive(snap string, force, raw bool, fd uintptr) error {
+	csnap := C.CString(snap)
+	defer C.free(unsafe.Pointer(csnap))
+	if rc := C.lzc_receive(csnap, nil, nil, boolean(force), boolean(raw), C.int(fd)); rc != 0 {
+		return syscall.Errno(rc)
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+//go:build !linux || !cgo || !lzc
+// +build !linux !cgo !lzc
+
+package lzc
+
+func nativeInit() error {
+	return errNotBuilt
+}
+
+func nativeSnapshot([]string, map[string]string) (string, error) {
+	return "", errNotBuilt
+}
+
+func nativeDestroySnapshots([]string, bool) (string, error) {
+	return "", errNotBuilt
+}
+
+func nativeHold([]string, string) (string, error) {
+	return "", errNotBuilt
+}
+
+func nativeRelease([]string, string) (string, error) {
+	return "", errNotBuilt
+}
+
+func nativeSend(string, string, int, uintptr) error {
+	return errNotBuilt
+}
+
+func nativeReceive(string, bool, bool, uintptr) error {
+	return errNotBuilt
+}
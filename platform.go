@@ -0,0 +1,118 @@
+package zfs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Platform covers what differs between the operating systems ZFS runs on, such as how the kstats of the kernel
+// module are read and how devices are named. The Platform of the host the library is built for is used by default,
+// see SetPlatform or WithPlatform for Runners which run the commands on another host, e.g. over ssh.
+type Platform interface {
+	// Kstat returns the values of a kstat of the ZFS kernel module by name, as described for Kstat.
+	Kstat(ctx context.Context, name string) (map[string]uint64, error)
+	// DeviceLinks provides the names of devices, as used by DeviceNameResolver.
+	DeviceLinks() DeviceLinks
+	// Mount mounts a filesystem on dir regardless of its mountpoint property, with the given temporary mount
+	// options, as described for Dataset.MountAt.
+	Mount(ctx context.Context, filesystem, dir string, options []string) error
+}
+
+// LinuxPlatform is the Platform of Linux. Kstats are read from /proc/spl/kstat/zfs of the local host and the names
+// of devices are those created by udev.
+type LinuxPlatform struct{}
+
+// kstatDir is the directory of the kstats of the ZFS kernel module on Linux.
+var kstatDir = "/proc/spl/kstat/zfs"
+
+// Kstat implements Platform.
+func (LinuxPlatform) Kstat(_ context.Context, name string) (map[string]uint64, error) {
+	f, err := os.Open(filepath.Join(kstatDir, name))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseKstat(f)
+}
+
+// DeviceLinks implements Platform.
+func (LinuxPlatform) DeviceLinks() DeviceLinks {
+	return UdevLinks{}
+}
+
+// Mount implements Platform, with mount -t zfs -o zfsutil of the host which runs the commands.
+func (LinuxPlatform) Mount(ctx context.Context, filesystem, dir string, options []string) error {
+	return mount(ctx, filesystem, dir, append([]string{"zfsutil"}, options...))
+}
+
+// FreeBSDPlatform is the Platform of FreeBSD. Kstats are read from the kstat.zfs.misc sysctl tree and the names of
+// devices are their GEOM labels, both with the Runner of the context.
+type FreeBSDPlatform struct{}
+
+// Kstat implements Platform.
+func (FreeBSDPlatform) Kstat(ctx context.Context, name string) (map[string]uint64, error) {
+	var out bytes.Buffer
+	c := command{Command: "sysctl", Stdout: &out}
+	if _, err := c.Run(ctx, "-q", "kstat.zfs.misc."+name); err != nil {
+		return nil, err
+	}
+	return parseSysctlKstat(&out, name)
+}
+
+// DeviceLinks implements Platform.
+func (FreeBSDPlatform) DeviceLinks() DeviceLinks {
+	return GeomLinks{}
+}
+
+// Mount implements Platform, with mount -t zfs of the host which runs the commands.
+func (FreeBSDPlatform) Mount(ctx context.Context, filesystem, dir string, options []string) error {
+	return mount(ctx, filesystem, dir, options)
+}
+
+func mount(ctx context.Context, filesystem, dir string, options []string) error {
+	args := []string{"-t", "zfs"}
+	if len(options) > 0 {
+		args = append(args, "-o", strings.Join(options, ","))
+	}
+	c := command{Command: "mount"}
+	_, err := c.Run(ctx, append(args, filesystem, dir)...)
+	return err
+}
+
+// defaultPlatform is nil on operating systems without a Platform.
+var defaultPlatform = hostPlatform
+
+// SetPlatform sets the Platform used for all contexts which are not given one by WithPlatform.
+func SetPlatform(p Platform) {
+	if p != nil {
+		defaultPlatform = p
+	}
+}
+
+type platformKey struct{}
+
+// WithPlatform returns a copy of ctx which makes the Context variants of the library's functions use p,
+// e.g. together with a Runner of another host given to WithRunner.
+func WithPlatform(ctx context.Context, p Platform) context.Context {
+	return context.WithValue(ctx, platformKey{}, p)
+}
+
+func platformFromContext(ctx context.Context) Platform {
+	if p, ok := ctx.Value(platformKey{}).(Platform); ok && p != nil {
+		return p
+	}
+	return defaultPlatform
+}
+
+func readKstat(ctx context.Context, name string) (map[string]uint64, error) {
+	p := platformFromContext(ctx)
+	if p == nil {
+		return nil, fmt.Errorf("kstats are not supported on %s", runtime.GOOS)
+	}
+	return p.Kstat(ctx, name)
+}
@@ -0,0 +1,3 @@
+package zfs
+
+var hostPlatform Platform = FreeBSDPlatform{}
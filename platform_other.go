@@ -0,0 +1,6 @@
+//go:build !linux && !freebsd
+// +build !linux,!freebsd
+
+package zfs
+
+var hostPlatform Platform
@@ -0,0 +1,289 @@
+// Package replicate keeps a copy of a filesystem or volume up to date on another pool, possibly on a remote host,
+// by sending the snapshots the copy lacks, built on go-zfs.
+//
+// Usage:
+//
+//	remote, err := sshrunner.Dial("backup:22", config)
+//	r, err := replicate.Replicate("tank/data", "backup/data", replicate.Options{
+//		TargetRunner: remote,
+//		Intermediary: true,
+//		Resumable:    true,
+//		Prune:        &retention.Policy{Prefix: "auto-", Latest: 3, Daily: 7},
+//	})
+//	log.Printf("%s is at %s", "backup/data", r.Snapshot)
+package replicate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	zfs "github.com/mistifyio/go-zfs/v3"
+	"github.com/mistifyio/go-zfs/v3/retention"
+)
+
+// Options configure a replication.
+type Options struct {
+	// SourceRunner and TargetRunner run the commands on the source and on the target, such as an sshrunner.Runner
+	// for a remote host. If nil, the Runner of the context, or else the one set by zfs.SetRunner, is used.
+	SourceRunner zfs.Runner
+	TargetRunner zfs.Runner
+	// Intermediary sends all snapshots between the common snapshot and the most recent one, rather than only the
+	// most recent one. A target which does not exist yet receives all snapshots of the source.
+	Intermediary bool
+	// Compressed and LargeBlocks are passed to zfs.SendOptions.
+	Compressed  bool
+	LargeBlocks bool
+	// Raw sends encrypted datasets as they are stored on disk, so the target never needs their key,
+	// e.g. for backups on untrusted hosts. Incremental raw streams are checked with zfs.CheckRawIncremental first.
+	Raw bool
+	// Force rolls back changes made to the target since its most recent snapshot before receiving.
+	Force bool
+	// Resumable saves the state of an interrupted receive on the target, which the next replication resumes.
+	Resumable bool
+	// Progress is called with the bytes sent so far and the estimated size of each stream while it is sent.
+	Progress func(sent, total uint64)
+	// Prune destroys the source snapshots the policy does not keep after a successful replication,
+	// except for the most recent one, which the next replication is incremental from.
+	Prune *retention.Policy
+}
+
+// Result reports a replication.
+type Result struct {
+	// Snapshot is the most recent snapshot of the source, which the target holds after the replication.
+	Snapshot string
+	// From is the most recent snapshot the source and target had in common, empty if the target was created.
+	From string
+	// Resumed reports whether an interrupted receive into the target was resumed first.
+	Resumed bool
+	// Sent reports whether any stream was sent, it is false if the target was up to date.
+	Sent bool
+	// Pruned holds the names of the source snapshots destroyed by Options.Prune.
+	Pruned []string
+}
+
+// Replicate brings the target filesystem or volume up to date with the snapshots of the source.
+//
+// An interrupted resumable receive into the target is resumed first. The target is then sent an incremental stream
+// from the most recent snapshot it has in common with the source, identified by its guid, to the most recent snapshot
+// of the source. If the target does not exist, it is created with a full stream. A target without a snapshot in common
+// with the source is an error, as replicating would destroy its contents.
+func Replicate(source, target string, opts Options) (*Result, error) {
+	return ReplicateContext(context.Background(), source, target, opts)
+}
+
+// ReplicateContext is like Replicate but includes a context.
+func ReplicateContext(ctx context.Context, source, target string, opts Options) (*Result, error) {
+	for _, name := range []string{source, target} {
+		if name == "" || strings.ContainsAny(name, "@#") {
+			return nil, fmt.Errorf("invalid dataset %q", name)
+		}
+	}
+	srcCtx, dstCtx := withRunner(ctx, opts.SourceRunner), withRunner(ctx, opts.TargetRunner)
+	r := &Result{}
+
+	var err error
+	if r.Resumed, err = resume(srcCtx, dstCtx, target, opts); err != nil {
+		return nil, fmt.Errorf("cannot resume receive into %s: %w", target, err)
+	}
+
+	var props []string
+	if opts.Prune != nil && opts.Prune.KeepProperty != "" {
+		props = append(props, opts.Prune.KeepProperty)
+	}
+	srcSnaps, err := snapshots(srcCtx, source, props)
+	if err != nil {
+		return nil, err
+	}
+	if len(srcSnaps) == 0 {
+		return nil, fmt.Errorf("%s has no snapshots to replicate", source)
+	}
+	latest := srcSnaps[len(srcSnaps)-1]
+	r.Snapshot = latest.Name
+
+	dstSnaps, err := snapshots(dstCtx, target, nil)
+	if err != nil && !errors.Is(err, zfs.ErrDatasetNotFound) {
+		return nil, err
+	}
+	var common *zfs.SnapshotInfo
+	if matches := zfs.MatchSnapshots(srcSnaps, dstSnaps); len(matches) > 0 {
+		common = matches[len(matches)-1].Source
+	}
+	if common == nil && len(dstSnaps) > 0 {
+		return nil, fmt.Errorf("%s has no snapshot in common with %s", target, source)
+	}
+
+	if common == nil {
+		first := latest
+		if opts.Intermediary {
+			first = srcSnaps[0]
+		}
+		if err := send(srcCtx, dstCtx, first.Name, "", target, opts); err != nil {
+			return nil, err
+		}
+		r.Sent, common = true, first
+	} else {
+		r.From = common.Name
+		if opts.Raw && common != latest {
+			if err := checkRaw(srcCtx, dstCtx, source, target); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if common != latest {
+		if err := send(srcCtx, dstCtx, latest.Name, common.Name, target, opts); err != nil {
+			return nil, err
+		}
+		r.Sent = true
+	}
+
+	if opts.Prune != nil {
+		if r.Pruned, err = prune(srcCtx, srcSnaps, latest, opts.Prune); err != nil {
+			return r, fmt.Errorf("cannot prune %s: %w", source, err)
+		}
+	}
+	return r, nil
+}
+
+func withRunner(ctx context.Context, r zfs.Runner) context.Context {
+	if r == nil {
+		return ctx
+	}
+	return zfs.WithRunner(ctx, r)
+}
+
+// snapshots returns the snapshots of the dataset, excluding those of its descendents, oldest first.
+func snapshots(ctx context.Context, dataset string, props []string) ([]*zfs.SnapshotInfo, error) {
+	snaps, err := (&zfs.Dataset{Name: dataset}).SnapshotInfosContext(ctx, props)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(snaps, func(i, j int) bool {
+		return snaps[i].CreateTXG < snaps[j].CreateTXG
+	})
+	return snaps, nil
+}
+
+// resume completes an interrupted resumable receive into target, it reports whether there was one.
+func resume(srcCtx, dstCtx context.Context, target string, opts Options) (bool, error) {
+	ds, err := zfs.GetDatasetContext(dstCtx, target)
+	if errors.Is(err, zfs.ErrDatasetNotFound) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	token, err := ds.ResumeTokenContext(dstCtx)
+	if err != nil || token == "" {
+		return false, err
+	}
+	recv := zfs.ReceiveOptions{Force: opts.Force, Resumable: true, Progress: opts.Progress}
+	return true, transfer(func(w io.Writer) error {
+		return zfs.ResumeSendContext(srcCtx, token, w)
+	}, func(r io.Reader) error {
+		_, err := zfs.ReceiveFromContext(dstCtx, r, target, recv)
+		return err
+	})
+}
+
+// checkRaw returns an error if a raw incremental stream of source cannot be received into target.
+func checkRaw(srcCtx, dstCtx context.Context, source, target string) error {
+	src, err := (&zfs.Dataset{Name: source}).EncryptionContext(srcCtx)
+	if err != nil {
+		return err
+	}
+	dst, err := (&zfs.Dataset{Name: target}).EncryptionContext(dstCtx)
+	if err != nil {
+		return err
+	}
+	return zfs.CheckRawIncremental(src, dst)
+}
+
+// send sends snapshot, incremental from from if not empty, to target.
+func send(srcCtx, dstCtx context.Context, snapshot, from, target string, opts Options) error {
+	snap, err := zfs.GetDatasetContext(srcCtx, snapshot)
+	if err != nil {
+		return err
+	}
+	sendOpts := zfs.SendOptions{
+		From:         from,
+		Intermediary: opts.Intermediary && from != "",
+		Compressed:   opts.Compressed,
+		LargeBlocks:  opts.LargeBlocks,
+		Raw:          opts.Raw,
+		Progress:     opts.Progress,
+	}
+	recv := zfs.ReceiveOptions{Force: opts.Force, Resumable: opts.Resumable}
+	err = transfer(func(w io.Writer) error {
+		return snap.SendToContext(srcCtx, w, sendOpts)
+	}, func(r io.Reader) error {
+		_, err := zfs.ReceiveFromContext(dstCtx, r, target, recv)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("cannot replicate %s to %s: %w", snapshot, target, err)
+	}
+	return nil
+}
+
+// brokenPipe records whether writing to the pipe failed because its reader was closed.
+type brokenPipe struct {
+	*io.PipeWriter
+	broken bool
+}
+
+func (p *brokenPipe) Write(b []byte) (int, error) {
+	n, err := p.PipeWriter.Write(b)
+	if err != nil {
+		p.broken = true
+	}
+	return n, err
+}
+
+// transfer pipes what send writes into receive. If both fail, the error of the side which failed first is returned.
+func transfer(send func(io.Writer) error, receive func(io.Reader) error) error {
+	pr, pw := io.Pipe()
+	w := &brokenPipe{PipeWriter: pw}
+	sent := make(chan error, 1)
+	go func() {
+		err := send(w)
+		if err != nil {
+			pw.CloseWithError(err)
+		} else {
+			pw.Close()
+		}
+		sent <- err
+	}()
+	recvErr := receive(pr)
+	// stop the sender if the receiver returned early
+	pr.Close()
+	sendErr := <-sent
+
+	if recvErr != nil && (sendErr == nil || w.broken) {
+		return recvErr
+	}
+	return sendErr
+}
+
+// prune destroys the snapshots the policy does not keep, except for latest.
+func prune(ctx context.Context, snaps []*zfs.SnapshotInfo, latest *zfs.SnapshotInfo, policy *retention.Policy) ([]string, error) {
+	plan, err := policy.Select(snaps)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, s := range plan.Destroy {
+		if s.GUID != latest.GUID {
+			names = append(names, s.Name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+	if err := zfs.DestroySnapshotsBatchContext(ctx, names); err != nil {
+		return nil, err
+	}
+	return names, nil
+}
@@ -0,0 +1,210 @@
+package replicate_test
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	zfs "github.com/mistifyio/go-zfs/v3"
+	"github.com/mistifyio/go-zfs/v3/replicate"
+	"github.com/mistifyio/go-zfs/v3/retention"
+	"github.com/mistifyio/go-zfs/v3/zfstest"
+)
+
+func ok(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func equals(t *testing.T, want, got interface{}) {
+	t.Helper()
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("want: %#v, got: %#v", want, got)
+	}
+}
+
+// setup returns a source backend with the filesystem tank/data and the given snapshots of it,
+// and a target backend with an empty pool named backup.
+func setup(t *testing.T, snapshots ...string) (source, target *zfstest.Backend) {
+	t.Helper()
+	source, target = zfstest.New(), zfstest.New()
+	ctx := zfs.WithRunner(context.Background(), source)
+	_, err := zfs.CreateZpoolContext(ctx, "tank", nil, "disk0")
+	ok(t, err)
+	fs, err := zfs.CreateFilesystemContext(ctx, "tank/data", nil)
+	ok(t, err)
+	for _, name := range snapshots {
+		_, err := fs.SnapshotContext(ctx, name, false)
+		ok(t, err)
+	}
+	_, err = zfs.CreateZpoolContext(zfs.WithRunner(context.Background(), target), "backup", nil, "disk0")
+	ok(t, err)
+	return source, target
+}
+
+func snapshot(t *testing.T, b *zfstest.Backend, name string) {
+	t.Helper()
+	_, err := zfs.CreateSnapshotsContext(zfs.WithRunner(context.Background(), b), []string{name}, false, nil)
+	ok(t, err)
+}
+
+// guids returns the names after the @ of the snapshots of dataset, and their guids.
+func guids(t *testing.T, b *zfstest.Backend, dataset string) ([]string, []uint64) {
+	t.Helper()
+	snaps, err := zfs.SnapshotInfosContext(zfs.WithRunner(context.Background(), b), dataset, nil)
+	ok(t, err)
+	var names []string
+	var ids []uint64
+	for _, s := range snaps {
+		names = append(names, s.Name[strings.IndexByte(s.Name, '@')+1:])
+		ids = append(ids, s.GUID)
+	}
+	return names, ids
+}
+
+func TestReplicate(t *testing.T) {
+	source, target := setup(t, "a", "b")
+	opts := replicate.Options{SourceRunner: source, TargetRunner: target, Intermediary: true}
+
+	r, err := replicate.Replicate("tank/data", "backup/data", opts)
+	ok(t, err)
+	equals(t, &replicate.Result{Snapshot: "tank/data@b", Sent: true}, r)
+	names, ids := guids(t, source, "tank/data")
+	names2, ids2 := guids(t, target, "backup/data")
+	equals(t, []string{"a", "b"}, names)
+	equals(t, names, names2)
+	equals(t, ids, ids2)
+
+	r, err = replicate.Replicate("tank/data", "backup/data", opts)
+	ok(t, err)
+	equals(t, &replicate.Result{Snapshot: "tank/data@b", From: "tank/data@b"}, r)
+
+	snapshot(t, source, "tank/data@c")
+	snapshot(t, source, "tank/data@d")
+	opts.Intermediary = false
+	r, err = replicate.Replicate("tank/data", "backup/data", opts)
+	ok(t, err)
+	equals(t, &replicate.Result{Snapshot: "tank/data@d", From: "tank/data@b", Sent: true}, r)
+	names, _ = guids(t, target, "backup/data")
+	equals(t, []string{"a", "b", "d"}, names)
+}
+
+func TestReplicateLocal(t *testing.T) {
+	source, _ := setup(t, "a")
+	ctx := zfs.WithRunner(context.Background(), source)
+
+	// send and receive run concurrently on the same backend
+	r, err := replicate.ReplicateContext(ctx, "tank/data", "tank/copy", replicate.Options{})
+	ok(t, err)
+	equals(t, &replicate.Result{Snapshot: "tank/data@a", Sent: true}, r)
+	names, _ := guids(t, source, "tank/copy")
+	equals(t, []string{"a"}, names)
+}
+
+func TestReplicateNoCommonSnapshot(t *testing.T) {
+	source, target := setup(t, "a")
+	ctx := zfs.WithRunner(context.Background(), target)
+	fs, err := zfs.CreateFilesystemContext(ctx, "backup/data", nil)
+	ok(t, err)
+	_, err = fs.SnapshotContext(ctx, "a", false)
+	ok(t, err)
+
+	_, err = replicate.Replicate("tank/data", "backup/data", replicate.Options{SourceRunner: source, TargetRunner: target})
+	if err == nil || !strings.Contains(err.Error(), "no snapshot in common") {
+		t.Fatalf("expected error without common snapshot, got %v", err)
+	}
+
+	_, err = replicate.Replicate("tank/data", "backup/missing/data", replicate.Options{SourceRunner: source, TargetRunner: target})
+	if err == nil || !strings.Contains(err.Error(), "cannot replicate tank/data@a to backup/missing/data") {
+		t.Fatalf("expected error receiving into missing parent, got %v", err)
+	}
+}
+
+func TestReplicateResume(t *testing.T) {
+	source, target := setup(t, "a")
+	srcCtx, dstCtx := zfs.WithRunner(context.Background(), source), zfs.WithRunner(context.Background(), target)
+
+	// receive a stream which was cut short
+	snap, err := zfs.GetDatasetContext(srcCtx, "tank/data@a")
+	ok(t, err)
+	var stream bytes.Buffer
+	ok(t, snap.SendToContext(srcCtx, &stream, zfs.SendOptions{}))
+	partial := bytes.TrimSuffix(stream.Bytes(), []byte("end\n"))
+	_, err = zfs.ReceiveFromContext(dstCtx, bytes.NewReader(partial), "backup/data", zfs.ReceiveOptions{Resumable: true})
+	if err == nil {
+		t.Fatal("expected error receiving partial stream")
+	}
+
+	var progress []uint64
+	opts := replicate.Options{SourceRunner: source, TargetRunner: target, Resumable: true, Progress: func(sent, total uint64) {
+		progress = append(progress, sent)
+	}}
+	r, err := replicate.Replicate("tank/data", "backup/data", opts)
+	ok(t, err)
+	equals(t, &replicate.Result{Snapshot: "tank/data@a", From: "tank/data@a", Resumed: true}, r)
+	if len(progress) == 0 {
+		t.Fatal("expected progress of the resumed receive")
+	}
+	names, _ := guids(t, target, "backup/data")
+	equals(t, []string{"a"}, names)
+}
+
+func TestReplicatePrune(t *testing.T) {
+	source, target := setup(t, "auto-1", "auto-2", "manual", "auto-3")
+	opts := replicate.Options{
+		SourceRunner: source,
+		TargetRunner: target,
+		Intermediary: true,
+		Prune:        &retention.Policy{Prefix: "auto-", Latest: 1},
+	}
+
+	r, err := replicate.Replicate("tank/data", "backup/data", opts)
+	ok(t, err)
+	equals(t, []string{"tank/data@auto-2", "tank/data@auto-1"}, r.Pruned)
+	names, _ := guids(t, source, "tank/data")
+	equals(t, []string{"manual", "auto-3"}, names)
+	names, _ = guids(t, target, "backup/data")
+	equals(t, []string{"auto-1", "auto-2", "manual", "auto-3"}, names)
+
+}
+
+func TestReplicateRaw(t *testing.T) {
+	source, target := setup(t)
+	srcCtx, dstCtx := zfs.WithRunner(context.Background(), source), zfs.WithRunner(context.Background(), target)
+	for _, fs := range []struct {
+		ctx        context.Context
+		name, pass string
+	}{{srcCtx, "tank/secure", "correct horse"}, {dstCtx, "backup/enc", "battery staple"}} {
+		_, err := zfs.CreateFilesystemWithOptionsContext(fs.ctx, fs.name, zfs.CreateFilesystemOptions{
+			Encryption: &zfs.EncryptionOptions{Encryption: "on", KeyFormat: zfs.KeyFormatPassphrase, Key: strings.NewReader(fs.pass)},
+		})
+		ok(t, err)
+	}
+	snapshot(t, source, "tank/secure@a")
+	opts := replicate.Options{SourceRunner: source, TargetRunner: target, Raw: true}
+
+	_, err := replicate.Replicate("tank/secure", "backup/enc/secure", opts)
+	ok(t, err)
+	snapshot(t, source, "tank/secure@b")
+	r, err := replicate.Replicate("tank/secure", "backup/enc/secure", opts)
+	ok(t, err)
+	equals(t, &replicate.Result{Snapshot: "tank/secure@b", From: "tank/secure@a", Sent: true}, r)
+	copied, err := zfs.GetDatasetContext(dstCtx, "backup/enc/secure")
+	ok(t, err)
+	status, err := copied.KeyStatusContext(dstCtx)
+	ok(t, err)
+	equals(t, zfs.KeyStatusUnavailable, status)
+
+	// once the target inherits the key of its parent, raw streams of the source no longer apply to it
+	ok(t, copied.LoadKeyContext(dstCtx, zfs.LoadKeyOptions{Key: strings.NewReader("correct horse")}))
+	ok(t, copied.ChangeKeyContext(dstCtx, zfs.ChangeKeyOptions{Inherit: true}))
+	snapshot(t, source, "tank/secure@c")
+	_, err = replicate.Replicate("tank/secure", "backup/enc/secure", opts)
+	if err == nil || !strings.Contains(err.Error(), "does not correspond to encryption root tank/secure") {
+		t.Fatalf("expected error replicating raw into a different encryption root, got %v", err)
+	}
+}
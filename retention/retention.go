@@ -0,0 +1,231 @@
+// Package retention decides which snapshots to destroy under a policy keeping a number of hourly, daily, weekly,
+// monthly and yearly snapshots, in the style of sanoid or zfs-auto-snapshot, built on go-zfs.
+//
+// Usage:
+//
+//	policy := retention.Policy{Prefix: "auto-", Hourly: 24, Daily: 30, Monthly: 12, KeepProperty: "com.example:keep"}
+//	plans, err := retention.Plan("tank/data", true, policy)
+//	for _, p := range plans {
+//		log.Printf("%s: keeping %d, destroying %d snapshots", p.Dataset, len(p.Keep), len(p.Destroy))
+//	}
+//	err = retention.Apply(plans)
+package retention
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	zfs "github.com/mistifyio/go-zfs/v3"
+)
+
+// Reasons a snapshot is kept.
+const (
+	ReasonLatest   = "latest"
+	ReasonHourly   = "hourly"
+	ReasonDaily    = "daily"
+	ReasonWeekly   = "weekly"
+	ReasonMonthly  = "monthly"
+	ReasonYearly   = "yearly"
+	ReasonHeld     = "held"
+	ReasonProperty = "property"
+)
+
+// Policy selects the snapshots of a filesystem or volume to keep, all others matching Prefix are destroyed.
+type Policy struct {
+	// Latest keeps that many of the most recent snapshots, regardless of their age.
+	Latest int
+	// Hourly, Daily, Weekly, Monthly and Yearly keep the most recent snapshot of each of that many of the most recent
+	// hours, days, ISO weeks, months and years which have snapshots.
+	Hourly  int
+	Daily   int
+	Weekly  int
+	Monthly int
+	Yearly  int
+	// Prefix restricts the policy to the snapshots whose name after the @ starts with it, such as "auto-".
+	// Other snapshots are neither counted nor destroyed.
+	Prefix string
+	// KeepProperty names a user property, such as "com.example:keep", which keeps the snapshots it is set on
+	// to any value other than "off" or "false". As snapshots inherit user properties, setting it on a filesystem
+	// keeps all of its snapshots.
+	KeepProperty string
+	// Location is the time zone periods are delimited in, time.Local if nil.
+	Location *time.Location
+}
+
+func (p *Policy) validate() error {
+	counts := []int{p.Latest, p.Hourly, p.Daily, p.Weekly, p.Monthly, p.Yearly}
+	total := 0
+	for _, n := range counts {
+		if n < 0 {
+			return errors.New("retention counts cannot be negative")
+		}
+		total += n
+	}
+	if total == 0 {
+		return errors.New("retention policy keeps no snapshots")
+	}
+	return nil
+}
+
+// Snapshot is a snapshot with the reasons it is kept.
+type Snapshot struct {
+	*zfs.SnapshotInfo
+	// Reasons holds the Reason constants the snapshot is kept for, it is empty for snapshots to destroy.
+	Reasons []string
+}
+
+// DatasetPlan is the result of applying a Policy to the snapshots of a filesystem or volume.
+type DatasetPlan struct {
+	Dataset string
+	// Keep and Destroy hold the snapshots matching the Prefix of the policy, most recent first.
+	// Held snapshots are always kept, as they cannot be destroyed.
+	Keep    []*Snapshot
+	Destroy []*Snapshot
+}
+
+type period struct {
+	reason string
+	count  int
+	key    func(time.Time) string
+}
+
+// Select applies the policy to the snapshots of a single filesystem or volume, whose order does not matter.
+func (p *Policy) Select(snapshots []*zfs.SnapshotInfo) (*DatasetPlan, error) {
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	loc := p.Location
+	if loc == nil {
+		loc = time.Local
+	}
+
+	var candidates []*Snapshot
+	for _, s := range snapshots {
+		if i := strings.IndexByte(s.Name, '@'); i >= 0 && strings.HasPrefix(s.Name[i+1:], p.Prefix) {
+			candidates = append(candidates, &Snapshot{SnapshotInfo: s})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].CreateTXG > candidates[j].CreateTXG
+	})
+
+	periods := []*period{
+		{ReasonHourly, p.Hourly, func(t time.Time) string { return t.Format("2006-01-02T15") }},
+		{ReasonDaily, p.Daily, func(t time.Time) string { return t.Format("2006-01-02") }},
+		{ReasonWeekly, p.Weekly, func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-W%02d", year, week)
+		}},
+		{ReasonMonthly, p.Monthly, func(t time.Time) string { return t.Format("2006-01") }},
+		{ReasonYearly, p.Yearly, func(t time.Time) string { return t.Format("2006") }},
+	}
+	last := map[string]string{}
+
+	plan := &DatasetPlan{}
+	for i, s := range candidates {
+		if i == 0 {
+			plan.Dataset = s.Name[:strings.IndexByte(s.Name, '@')]
+		}
+		if i < p.Latest {
+			s.Reasons = append(s.Reasons, ReasonLatest)
+		}
+		created := s.Created.In(loc)
+		for _, pd := range periods {
+			if pd.count == 0 {
+				continue
+			}
+			// the most recent snapshot of each period is kept
+			if key := pd.key(created); key != last[pd.reason] {
+				last[pd.reason] = key
+				pd.count--
+				s.Reasons = append(s.Reasons, pd.reason)
+			}
+		}
+		if s.UserRefs > 0 {
+			s.Reasons = append(s.Reasons, ReasonHeld)
+		}
+		if p.KeepProperty != "" {
+			switch s.UserProperties[p.KeepProperty] {
+			case "", "-", "off", "false":
+			default:
+				s.Reasons = append(s.Reasons, ReasonProperty)
+			}
+		}
+
+		if len(s.Reasons) > 0 {
+			plan.Keep = append(plan.Keep, s)
+		} else {
+			plan.Destroy = append(plan.Destroy, s)
+		}
+	}
+	return plan, nil
+}
+
+// Plan applies the policy to the snapshots of the given filesystem or volume and, if recursive, of each of its
+// descendents, without destroying anything. Datasets without snapshots matching the Prefix of the policy are omitted.
+func Plan(dataset string, recursive bool, policy Policy) ([]*DatasetPlan, error) {
+	return PlanContext(context.Background(), dataset, recursive, policy)
+}
+
+// PlanContext is like Plan but includes a context.
+func PlanContext(ctx context.Context, dataset string, recursive bool, policy Policy) ([]*DatasetPlan, error) {
+	if err := policy.validate(); err != nil {
+		return nil, err
+	}
+	var props []string
+	if policy.KeepProperty != "" {
+		props = append(props, policy.KeepProperty)
+	}
+	snaps, err := zfs.SnapshotInfosContext(ctx, dataset, props)
+	if err != nil {
+		return nil, err
+	}
+
+	var datasets []string
+	byDataset := map[string][]*zfs.SnapshotInfo{}
+	for _, s := range snaps {
+		name := s.Name[:strings.IndexByte(s.Name, '@')]
+		if !recursive && name != dataset {
+			continue
+		}
+		if byDataset[name] == nil {
+			datasets = append(datasets, name)
+		}
+		byDataset[name] = append(byDataset[name], s)
+	}
+
+	var plans []*DatasetPlan
+	for _, name := range datasets {
+		plan, err := policy.Select(byDataset[name])
+		if err != nil {
+			return nil, err
+		}
+		if plan.Dataset != "" {
+			plans = append(plans, plan)
+		}
+	}
+	return plans, nil
+}
+
+// Apply destroys the snapshots the plans destroy, using zfs.DestroySnapshotsBatch.
+func Apply(plans []*DatasetPlan) error {
+	return ApplyContext(context.Background(), plans)
+}
+
+// ApplyContext is like Apply but includes a context.
+func ApplyContext(ctx context.Context, plans []*DatasetPlan) error {
+	var names []string
+	for _, plan := range plans {
+		for _, s := range plan.Destroy {
+			names = append(names, s.Name)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	return zfs.DestroySnapshotsBatchContext(ctx, names)
+}
@@ -0,0 +1,113 @@
+package retention_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	zfs "github.com/mistifyio/go-zfs/v3"
+	"github.com/mistifyio/go-zfs/v3/retention"
+	"github.com/mistifyio/go-zfs/v3/zfstest"
+)
+
+func ok(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func equals(t *testing.T, want, got interface{}) {
+	t.Helper()
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("want: %#v, got: %#v", want, got)
+	}
+}
+
+func names(snaps []*retention.Snapshot) []string {
+	var n []string
+	for _, s := range snaps {
+		n = append(n, s.Name)
+	}
+	return n
+}
+
+func TestSelect(t *testing.T) {
+	// a snapshot every 6 hours for 3 days, from 2022-01-01 00:00 to 2022-01-03 18:00
+	start := time.Date(2022, time.January, 1, 0, 0, 0, 0, time.UTC)
+	var snaps []*zfs.SnapshotInfo
+	for i := 0; i < 12; i++ {
+		created := start.Add(time.Duration(i) * 6 * time.Hour)
+		snaps = append(snaps, &zfs.SnapshotInfo{
+			Name:           "tank/fs@auto-" + created.Format("2006-01-02_15"),
+			Created:        created,
+			CreateTXG:      uint64(100 + i),
+			UserProperties: map[string]string{"com.example:keep": "-"},
+		})
+	}
+	snaps = append(snaps, &zfs.SnapshotInfo{Name: "tank/fs@manual", Created: start, CreateTXG: 99})
+	snaps[0].UserRefs = 1
+	snaps[1].UserProperties["com.example:keep"] = "yes"
+
+	policy := retention.Policy{Prefix: "auto-", Latest: 1, Hourly: 2, Daily: 2, KeepProperty: "com.example:keep", Location: time.UTC}
+	plan, err := policy.Select(snaps)
+	ok(t, err)
+	equals(t, "tank/fs", plan.Dataset)
+	equals(t, []string{
+		"tank/fs@auto-2022-01-03_18", "tank/fs@auto-2022-01-03_12", "tank/fs@auto-2022-01-02_18",
+		"tank/fs@auto-2022-01-01_06", "tank/fs@auto-2022-01-01_00",
+	}, names(plan.Keep))
+	equals(t, []string{retention.ReasonLatest, retention.ReasonHourly, retention.ReasonDaily}, plan.Keep[0].Reasons)
+	equals(t, []string{retention.ReasonHourly}, plan.Keep[1].Reasons)
+	equals(t, []string{retention.ReasonDaily}, plan.Keep[2].Reasons)
+	equals(t, []string{retention.ReasonProperty}, plan.Keep[3].Reasons)
+	equals(t, []string{retention.ReasonHeld}, plan.Keep[4].Reasons)
+	equals(t, 7, len(plan.Destroy))
+
+	if _, err := (&retention.Policy{}).Select(snaps); err == nil {
+		t.Fatal("expected error for a policy which keeps nothing")
+	}
+	if _, err := (&retention.Policy{Daily: -1}).Select(snaps); err == nil {
+		t.Fatal("expected error for a negative count")
+	}
+}
+
+func TestPlanAndApply(t *testing.T) {
+	b := zfstest.New()
+	ctx := zfs.WithRunner(context.Background(), b)
+	_, err := zfs.CreateZpoolContext(ctx, "tank", nil, "disk0")
+	ok(t, err)
+	fs, err := zfs.CreateFilesystemContext(ctx, "tank/fs", nil)
+	ok(t, err)
+	_, err = zfs.CreateFilesystemContext(ctx, "tank/fs/child", nil)
+	ok(t, err)
+	for _, name := range []string{"auto-1", "manual", "auto-2", "auto-3"} {
+		_, err := zfs.CreateSnapshotsContext(ctx, []string{"tank/fs@" + name}, true, nil)
+		ok(t, err)
+	}
+	held, err := zfs.GetDatasetContext(ctx, "tank/fs/child@auto-1")
+	ok(t, err)
+	ok(t, held.HoldContext(ctx, "replication", false))
+
+	policy := retention.Policy{Prefix: "auto-", Latest: 1}
+	plans, err := retention.PlanContext(ctx, "tank/fs", false, policy)
+	ok(t, err)
+	equals(t, 1, len(plans))
+	equals(t, []string{"tank/fs@auto-2", "tank/fs@auto-1"}, names(plans[0].Destroy))
+
+	plans, err = retention.PlanContext(ctx, "tank/fs", true, policy)
+	ok(t, err)
+	equals(t, 2, len(plans))
+	equals(t, "tank/fs/child", plans[1].Dataset)
+	equals(t, []string{"tank/fs/child@auto-3", "tank/fs/child@auto-1"}, names(plans[1].Keep))
+
+	ok(t, retention.ApplyContext(ctx, plans))
+	snaps, err := fs.SnapshotsContext(ctx)
+	ok(t, err)
+	var remaining []string
+	for _, s := range snaps {
+		remaining = append(remaining, s.Name)
+	}
+	equals(t, []string{"tank/fs@manual", "tank/fs@auto-3", "tank/fs/child@auto-1", "tank/fs/child@manual", "tank/fs/child@auto-3"}, remaining)
+}
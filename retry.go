@@ -0,0 +1,100 @@
+package zfs
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var commandTimeout time.Duration
+
+// SetCommandTimeout sets the longest time a command may run before it is killed, for all commands whose context
+// does not set it with WithCommandTimeout. Zero, the default, lets commands run until their context is done.
+//
+// The timeout applies to every attempt of a command. It does not apply to commands transferring streams, such
+// as sends and receives, following output, such as WatchZpoolEvents, which run as long as their context, or
+// waiting for activities with their own timeout, such as Zpool.Wait.
+// Commands which time out fail with an *Error wrapping context.DeadlineExceeded.
+func SetCommandTimeout(timeout time.Duration) {
+	commandTimeout = timeout
+}
+
+type timeoutKey struct{}
+
+// WithCommandTimeout returns a copy of ctx which makes the Context variants of the library's functions kill
+// commands running longer than timeout, overriding SetCommandTimeout. Zero disables the timeout.
+func WithCommandTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, timeoutKey{}, timeout)
+}
+
+func commandTimeoutFromContext(ctx context.Context) time.Duration {
+	if timeout, ok := ctx.Value(timeoutKey{}).(time.Duration); ok {
+		return timeout
+	}
+	return commandTimeout
+}
+
+// RetryPolicy controls how failed commands are retried. The zero value does not retry.
+//
+// Only commands without input, and whose output is not streamed, are retried: neither sends nor receives, nor
+// commands loading encryption keys. Every attempt is reported to the AuditHook.
+type RetryPolicy struct {
+	// MaxAttempts is the number of times a command is run at most, including the first attempt.
+	MaxAttempts int
+	// Backoff is the delay before the first retry, which doubles with every further retry up to MaxBackoff,
+	// if that is set.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Retryable reports whether a failed command is retried, IsTransient if nil.
+	Retryable func(error) bool
+}
+
+func (p *RetryPolicy) retryable(err error) bool {
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return IsTransient(err)
+}
+
+// delay returns the delay after the given failed attempt, counting from 1.
+func (p *RetryPolicy) delay(attempt int) time.Duration {
+	d := p.Backoff
+	for i := 1; i < attempt; i++ {
+		if p.MaxBackoff > 0 && d >= p.MaxBackoff {
+			break
+		}
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	return d
+}
+
+var retryPolicy RetryPolicy
+
+// SetRetryPolicy sets the retry policy of all commands whose context does not set one with WithRetryPolicy.
+func SetRetryPolicy(p RetryPolicy) {
+	retryPolicy = p
+}
+
+type retryKey struct{}
+
+// WithRetryPolicy returns a copy of ctx which makes the Context variants of the library's functions retry failed
+// commands as p specifies, overriding SetRetryPolicy.
+func WithRetryPolicy(ctx context.Context, p RetryPolicy) context.Context {
+	return context.WithValue(ctx, retryKey{}, p)
+}
+
+func retryPolicyFromContext(ctx context.Context) RetryPolicy {
+	if p, ok := ctx.Value(retryKey{}).(RetryPolicy); ok {
+		return p
+	}
+	return retryPolicy
+}
+
+// IsTransient reports whether a command failed because of a condition which is expected to clear, so it may
+// succeed when retried: ErrPoolBusy or ErrDatasetBusy, e.g. when destroying a snapshot while it is being sent.
+func IsTransient(err error) bool {
+	return errors.Is(err, ErrPoolBusy) || errors.Is(err, ErrDatasetBusy)
+}
@@ -0,0 +1,60 @@
+package zfs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	failures := 2
+	r := &fakeRunner{output: func(args []string) (string, error) {
+		if failures > 0 {
+			failures--
+			return "", errors.New("cannot destroy 'tank/fs': dataset is busy")
+		}
+		return "", nil
+	}}
+	ctx := WithRunner(context.Background(), r)
+	policy := RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}
+	if err := zfs(WithRetryPolicy(ctx, policy), "destroy", "tank/fs"); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.calls) != 3 {
+		t.Fatalf("expected 3 attempts, got %d", len(r.calls))
+	}
+
+	failures = 3
+	r.calls = nil
+	err := zfs(WithRetryPolicy(ctx, policy), "destroy", "tank/fs")
+	if !errors.Is(err, ErrDatasetBusy) || len(r.calls) != 3 {
+		t.Fatalf("expected busy error after 3 attempts, got %v after %d", err, len(r.calls))
+	}
+
+	r.output = func(args []string) (string, error) {
+		return "", errors.New("cannot open 'tank/fs': dataset does not exist")
+	}
+	r.calls = nil
+	if err := zfs(WithRetryPolicy(ctx, policy), "destroy", "tank/fs"); err == nil || len(r.calls) != 1 {
+		t.Fatalf("expected permanent error not to be retried, got %v after %d attempts", err, len(r.calls))
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	p := RetryPolicy{Backoff: time.Second, MaxBackoff: 5 * time.Second}
+	for attempt, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 5 * time.Second, 10: 5 * time.Second} {
+		if got := p.delay(attempt); got != want {
+			t.Errorf("attempt %d: want delay %v, got %v", attempt, want, got)
+		}
+	}
+}
+
+func TestCommandTimeout(t *testing.T) {
+	ctx := WithCommandTimeout(WithRunner(context.Background(), blockingRunner{}), 10*time.Millisecond)
+	err := zpool(ctx, "status", "tank")
+	var zerr *Error
+	if !errors.Is(err, context.DeadlineExceeded) || !errors.As(err, &zerr) {
+		t.Fatalf("expected command to time out, got %v", err)
+	}
+}
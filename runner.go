@@ -0,0 +1,202 @@
+package zfs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Runner executes the zfs and zpool commands on behalf of the library.
+// Implementations may run the commands locally, on a remote host, inside a container or chroot, via sudo,
+// or substitute a fake in tests.
+//
+// Run executes the named command with the given arguments and returns what it wrote to stdout and stderr.
+// A non-nil error must be returned if the command fails, errors providing an ExitCode() int method
+// (such as *exec.ExitError) have their exit code reported in Error.ExitCode.
+type Runner interface {
+	Run(ctx context.Context, name string, args ...string) (stdout, stderr []byte, err error)
+}
+
+// StreamRunner is an optional interface of a Runner which can stream stdin and stdout of a command,
+// as required by send and receive.
+//
+// Runners which do not implement StreamRunner can not receive streams, and buffer the complete output of sends.
+type StreamRunner interface {
+	Runner
+	RunStream(ctx context.Context, stdin io.Reader, stdout io.Writer, name string, args ...string) (stderr []byte, err error)
+}
+
+// ExecRunner is the default Runner, which executes commands on the local host with os/exec.
+// The zero value runs the commands found in PATH with the environment of the process, see NewExecRunner to
+// configure them.
+type ExecRunner struct {
+	opts *ExecOptions
+}
+
+// ExecOptions configure how an ExecRunner runs commands.
+type ExecOptions struct {
+	// Paths maps the names of commands, such as zfs, zpool or zdb, to the binaries run for them, e.g.
+	// /usr/local/sbin/zpool for installs outside of PATH. Other commands are looked up in PATH.
+	Paths map[string]string
+	// Wrapper is a command line the commands are run with, such as []string{"sudo", "-n"} to run them as root.
+	// The wrapper must pass on the environment for Env, CLocale and NoColor to apply.
+	Wrapper []string
+	// Env is the environment of the commands, that of the process if nil.
+	Env []string
+	// CLocale sets LC_ALL=C, so output parsed by the library, such as dates or numbers, is not localized.
+	CLocale bool
+	// NoColor removes ZFS_COLOR from the environment, so output is not colored.
+	NoColor bool
+}
+
+// NewExecRunner returns an ExecRunner running commands as configured by opts.
+func NewExecRunner(opts ExecOptions) ExecRunner {
+	return ExecRunner{opts: &opts}
+}
+
+// Run implements Runner.
+func (r ExecRunner) Run(ctx context.Context, name string, args ...string) ([]byte, []byte, error) {
+	var stdout bytes.Buffer
+	stderr, err := r.RunStream(ctx, nil, &stdout, name, args...)
+	return stdout.Bytes(), stderr, err
+}
+
+// RunStream implements StreamRunner.
+// The child process is killed if ctx becomes done before the command completes.
+func (r ExecRunner) RunStream(ctx context.Context, stdin io.Reader, stdout io.Writer, name string, args ...string) ([]byte, error) {
+	var env []string
+	if o := r.opts; o != nil {
+		if path, ok := o.Paths[name]; ok {
+			name = path
+		}
+		if len(o.Wrapper) > 0 {
+			args = append(append(append([]string{}, o.Wrapper[1:]...), name), args...)
+			name = o.Wrapper[0]
+		}
+		env = o.environ()
+	}
+	cmd := exec.CommandContext(ctx, name, args...)
+
+	var stderr bytes.Buffer
+	cmd.Env = env
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	return stderr.Bytes(), err
+}
+
+// environ returns the environment of the commands, nil for that of the process.
+func (o *ExecOptions) environ() []string {
+	if !o.CLocale && !o.NoColor {
+		return o.Env
+	}
+	env := o.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	out := make([]string, 0, len(env)+1)
+	for _, kv := range env {
+		name := strings.SplitN(kv, "=", 2)[0]
+		if o.CLocale && name == "LC_ALL" || o.NoColor && name == "ZFS_COLOR" {
+			continue
+		}
+		out = append(out, kv)
+	}
+	if o.CLocale {
+		out = append(out, "LC_ALL=C")
+	}
+	return out
+}
+
+var defaultRunner Runner = ExecRunner{}
+
+// SetRunner sets the Runner used for all commands which are not given a Runner by WithRunner.
+func SetRunner(r Runner) {
+	if r != nil {
+		defaultRunner = r
+	}
+}
+
+type runnerKey struct{}
+
+// WithRunner returns a copy of ctx which makes the Context variants of the library's functions use r
+// to execute commands instead of the Runner set by SetRunner.
+func WithRunner(ctx context.Context, r Runner) context.Context {
+	return context.WithValue(ctx, runnerKey{}, r)
+}
+
+func runnerFromContext(ctx context.Context) Runner {
+	if r, ok := ctx.Value(runnerKey{}).(Runner); ok && r != nil {
+		return r
+	}
+	return defaultRunner
+}
+
+// runStream runs a command with the given stdin and stdout on r, falling back to buffering stdout if r
+// does not implement StreamRunner.
+func runStream(ctx context.Context, r Runner, stdin io.Reader, stdout io.Writer, name string, args ...string) ([]byte, []byte, error) {
+	if sr, ok := r.(StreamRunner); ok {
+		var buf bytes.Buffer
+		if stdout == nil {
+			stdout = &buf
+		}
+		stderr, err := sr.RunStream(ctx, stdin, stdout, name, args...)
+		return buf.Bytes(), stderr, err
+	}
+	if stdin != nil {
+		return nil, nil, errors.New("runner does not support streaming stdin")
+	}
+
+	out, stderr, err := r.Run(ctx, name, args...)
+	if err != nil || stdout == nil {
+		return out, stderr, err
+	}
+	_, err = stdout.Write(out)
+	return nil, stderr, err
+}
+
+// streamOutput runs a long-running command, such as zpool events -f, whose output is passed to read as it is produced.
+// The command is stopped if read returns before it completes. The error returned is ctx.Err() if ctx is done,
+// otherwise the error of read or else of the command.
+func streamOutput(ctx context.Context, c command, arg []string, read func(io.Reader) error) error {
+	if _, ok := runnerFromContext(ctx).(StreamRunner); !ok {
+		return errors.New("runner does not support streaming, which is required to follow the output of " + c.Command)
+	}
+
+	cmdCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	pr, pw := io.Pipe()
+	c.Stdout = pw
+	c.stream = true
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.Run(cmdCtx, arg...)
+		done <- err
+		_ = pw.CloseWithError(err)
+	}()
+
+	err := read(pr)
+	var cmdErr error
+	select {
+	case cmdErr = <-done:
+	default:
+		// read stopped early, the error of the command killed in response is of no interest
+		cancel()
+		_ = pr.CloseWithError(io.ErrClosedPipe)
+		<-done
+	}
+	switch {
+	case ctx.Err() != nil:
+		return ctx.Err()
+	case err != nil:
+		return err
+	}
+	return cmdErr
+}
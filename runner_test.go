@@ -0,0 +1,151 @@
+package zfs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeRunner records the commands it is asked to run and answers them with output.
+type fakeRunner struct {
+	calls  [][]string
+	output func(args []string) (stdout string, err error)
+}
+
+func (f *fakeRunner) Run(_ context.Context, name string, args ...string) ([]byte, []byte, error) {
+	call := append([]string{name}, args...)
+	f.calls = append(f.calls, call)
+	if f.output == nil {
+		return nil, nil, nil
+	}
+	out, err := f.output(call)
+	if err != nil {
+		return nil, []byte(err.Error()), err
+	}
+	return []byte(out), nil, nil
+}
+
+// fakeStreamRunner additionally streams stdin to stdout.
+type fakeStreamRunner struct {
+	fakeRunner
+	stdin []byte
+}
+
+func (f *fakeStreamRunner) RunStream(ctx context.Context, stdin io.Reader, stdout io.Writer, name string, args ...string) ([]byte, error) {
+	out, stderr, err := f.Run(ctx, name, args...)
+	if stdin != nil {
+		f.stdin, _ = ioutil.ReadAll(stdin)
+	}
+	if stdout != nil {
+		_, _ = stdout.Write(out)
+	}
+	return stderr, err
+}
+
+// withFakeRunner returns a context using a fakeRunner which answers every command with output.
+func withFakeRunner(output string) (context.Context, *fakeRunner) {
+	r := &fakeRunner{output: func([]string) (string, error) { return output, nil }}
+	return WithRunner(context.Background(), r), r
+}
+
+func TestWithRunner(t *testing.T) {
+	ctx, r := withFakeRunner("tank\tONLINE\n")
+
+	out, err := zpoolOutput(ctx, "list", "-H", "-o", "name,health")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := [][]string{{"tank", "ONLINE"}}; !reflect.DeepEqual(want, out) {
+		t.Fatalf("want: %q, got: %q", want, out)
+	}
+	if want := [][]string{{"zpool", "list", "-H", "-o", "name,health"}}; !reflect.DeepEqual(want, r.calls) {
+		t.Fatalf("want calls: %q, got: %q", want, r.calls)
+	}
+}
+
+func TestSetRunner(t *testing.T) {
+	old := defaultRunner
+	defer func() { defaultRunner = old }()
+
+	r := &fakeRunner{}
+	SetRunner(r)
+	SetRunner(nil)
+	if err := zfs(context.Background(), "destroy", "tank/fs"); err != nil {
+		t.Fatal(err)
+	}
+	if want := [][]string{{"zfs", "destroy", "tank/fs"}}; !reflect.DeepEqual(want, r.calls) {
+		t.Fatalf("want calls: %q, got: %q", want, r.calls)
+	}
+}
+
+func TestRunnerError(t *testing.T) {
+	r := &fakeRunner{output: func([]string) (string, error) {
+		return "", errors.New("cannot open 'tank/fs': dataset does not exist")
+	}}
+	_, err := GetDatasetContext(WithRunner(context.Background(), r), "tank/fs")
+	if !errors.Is(err, ErrDatasetNotFound) {
+		t.Fatalf("expected ErrDatasetNotFound, got %v", err)
+	}
+	var zErr *Error
+	if !errors.As(err, &zErr) || zErr.ExitCode != -1 {
+		t.Fatalf("expected *Error without exit code, got %#v", err)
+	}
+}
+
+func TestRunnerStreaming(t *testing.T) {
+	snap := &Dataset{Name: "tank/fs@a", Type: DatasetSnapshot}
+
+	// runners without streaming support buffer the output of sends
+	ctx, _ := withFakeRunner("stream")
+	var buf bytes.Buffer
+	if err := snap.SendSnapshotContext(ctx, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "stream" {
+		t.Fatalf("unexpected stream: %q", buf.String())
+	}
+
+	// but cannot receive
+	if _, err := ReceiveSnapshotContext(ctx, strings.NewReader("stream"), "tank/recv"); err == nil {
+		t.Fatal("expected error receiving with a runner without streaming support")
+	}
+
+	sr := &fakeStreamRunner{}
+	ctx = WithRunner(context.Background(), sr)
+	if err := zfs(ctx, "list"); err != nil {
+		t.Fatal(err)
+	}
+	c := command{Command: "zfs", Stdin: strings.NewReader("stream")}
+	if _, err := c.Run(ctx, "receive", "tank/recv"); err != nil {
+		t.Fatal(err)
+	}
+	if string(sr.stdin) != "stream" {
+		t.Fatalf("unexpected stdin: %q", sr.stdin)
+	}
+}
+
+func TestExecRunnerOptions(t *testing.T) {
+	r := NewExecRunner(ExecOptions{
+		Paths:   map[string]string{"zfs": "sh"},
+		Wrapper: []string{"env", "WRAPPED=yes"},
+		Env:     []string{"LC_ALL=de_DE.UTF-8", "ZFS_COLOR=1", "PATH=" + os.Getenv("PATH")},
+		CLocale: true,
+		NoColor: true,
+	})
+	out, _, err := r.Run(context.Background(), "zfs", "-c", `echo "$WRAPPED $LC_ALL ${ZFS_COLOR-unset}"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "yes C unset\n"; string(out) != want {
+		t.Fatalf("want: %q, got: %q", want, out)
+	}
+	if (ExecRunner{}) == r {
+		t.Fatal("expected configured runner to differ from the default")
+	}
+}
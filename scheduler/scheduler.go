@@ -0,0 +1,197 @@
+// Package scheduler takes snapshots of datasets at regular intervals, named after the time they are scheduled for,
+// and optionally prunes them with a retention policy, built on go-zfs.
+//
+// Usage:
+//
+//	s, err := scheduler.New([]scheduler.Job{{
+//		Dataset:   "tank/data",
+//		Recursive: true,
+//		Interval:  time.Hour,
+//		Template:  "auto-2006-01-02_15:04",
+//		Retention: &retention.Policy{Prefix: "auto-", Hourly: 24, Daily: 30},
+//	}})
+//	for r := range s.Start(ctx) {
+//		if r.Err != nil {
+//			log.Printf("snapshot of %s failed: %v", r.Dataset, r.Err)
+//		}
+//	}
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	zfs "github.com/mistifyio/go-zfs/v3"
+	"github.com/mistifyio/go-zfs/v3/retention"
+)
+
+// Job configures the snapshots of a filesystem or volume.
+type Job struct {
+	Dataset string
+	// Recursive snapshots all descendents of the dataset atomically as well.
+	Recursive bool
+	// Interval is the time between snapshots. Snapshots are scheduled at multiples of Interval since the zero time,
+	// so hourly snapshots are taken on the hour and daily ones at midnight UTC.
+	Interval time.Duration
+	// Template is the time layout the name of a snapshot is formatted with, such as "auto-2006-01-02_15:04",
+	// using the time it was scheduled for.
+	Template string
+	// Location is the time zone Template is formatted in, UTC if nil.
+	Location *time.Location
+	// Properties are set on the snapshots when they are created.
+	Properties map[string]string
+	// Retention prunes the snapshots of the dataset, or its whole tree if Recursive, after each snapshot if not nil.
+	Retention *retention.Policy
+}
+
+func (j *Job) validate() error {
+	switch {
+	case j.Dataset == "" || strings.Contains(j.Dataset, "@"):
+		return fmt.Errorf("invalid dataset %q", j.Dataset)
+	case j.Interval < time.Second:
+		return fmt.Errorf("interval of %s must be at least one second", j.Dataset)
+	case j.Template == "":
+		return fmt.Errorf("missing snapshot name template of %s", j.Dataset)
+	}
+	if name := j.snapshotName(time.Time{}); strings.ContainsAny(name, "@/# ") {
+		return fmt.Errorf("invalid snapshot name template %q of %s", j.Template, j.Dataset)
+	}
+	if j.Retention != nil {
+		// selecting from no snapshots only validates the policy
+		if _, err := j.Retention.Select(nil); err != nil {
+			return fmt.Errorf("invalid retention policy of %s: %w", j.Dataset, err)
+		}
+	}
+	return nil
+}
+
+func (j *Job) snapshotName(t time.Time) string {
+	loc := j.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	return t.In(loc).Format(j.Template)
+}
+
+// Result reports a scheduled snapshot.
+type Result struct {
+	Dataset string
+	// Time is the time the snapshot was scheduled for.
+	Time time.Time
+	// Snapshots holds the snapshots which were created, the one of Dataset first.
+	Snapshots []*zfs.Dataset
+	// Destroyed holds the names of the snapshots the retention policy destroyed.
+	Destroyed []string
+	// Err is the error of taking the snapshot or of applying the retention policy.
+	Err error
+}
+
+// Scheduler takes the snapshots of its jobs while it runs.
+type Scheduler struct {
+	jobs []Job
+
+	// now and after are replaced by tests
+	now   func() time.Time
+	after func(time.Duration) <-chan time.Time
+}
+
+// New returns a Scheduler for the given jobs.
+func New(jobs []Job) (*Scheduler, error) {
+	if len(jobs) == 0 {
+		return nil, errors.New("no jobs to schedule")
+	}
+	for i := range jobs {
+		if err := jobs[i].validate(); err != nil {
+			return nil, err
+		}
+	}
+	return &Scheduler{jobs: append([]Job(nil), jobs...), now: time.Now, after: time.After}, nil
+}
+
+// Run takes snapshots as scheduled until ctx is done, passing the result of each job to emit, which may be nil.
+// Runs missed while a job was busy, or the host was suspended, are skipped. Run returns ctx.Err().
+func (s *Scheduler) Run(ctx context.Context, emit func(Result)) error {
+	next := make([]time.Time, len(s.jobs))
+	for i, j := range s.jobs {
+		next[i] = nextRun(s.now(), j.Interval)
+	}
+	for {
+		earliest := next[0]
+		for _, t := range next[1:] {
+			if t.Before(earliest) {
+				earliest = t
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-s.after(earliest.Sub(s.now())):
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		for i := range s.jobs {
+			if next[i].After(s.now()) {
+				continue
+			}
+			r := s.run(ctx, &s.jobs[i], next[i])
+			next[i] = nextRun(s.now(), s.jobs[i].Interval)
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if emit != nil {
+				emit(r)
+			}
+		}
+	}
+}
+
+// Start runs the Scheduler in a goroutine and returns a channel receiving the result of each job,
+// which is closed once ctx is done. The channel must be drained, as jobs wait for their result to be received.
+func (s *Scheduler) Start(ctx context.Context) <-chan Result {
+	results := make(chan Result)
+	go func() {
+		defer close(results)
+		_ = s.Run(ctx, func(r Result) {
+			select {
+			case results <- r:
+			case <-ctx.Done():
+			}
+		})
+	}()
+	return results
+}
+
+// nextRun returns the first multiple of interval after now.
+func nextRun(now time.Time, interval time.Duration) time.Time {
+	return now.Truncate(interval).Add(interval)
+}
+
+func (s *Scheduler) run(ctx context.Context, j *Job, scheduled time.Time) Result {
+	r := Result{Dataset: j.Dataset, Time: scheduled}
+	name := j.Dataset + "@" + j.snapshotName(scheduled)
+	r.Snapshots, r.Err = zfs.CreateSnapshotsContext(ctx, []string{name}, j.Recursive, j.Properties)
+	if r.Err != nil || j.Retention == nil {
+		return r
+	}
+
+	plans, err := retention.PlanContext(ctx, j.Dataset, j.Recursive, *j.Retention)
+	if err != nil {
+		r.Err = fmt.Errorf("cannot plan retention: %w", err)
+		return r
+	}
+	if err := retention.ApplyContext(ctx, plans); err != nil {
+		r.Err = fmt.Errorf("cannot apply retention: %w", err)
+		return r
+	}
+	for _, plan := range plans {
+		for _, snap := range plan.Destroy {
+			r.Destroyed = append(r.Destroyed, snap.Name)
+		}
+	}
+	return r
+}
@@ -0,0 +1,130 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	zfs "github.com/mistifyio/go-zfs/v3"
+	"github.com/mistifyio/go-zfs/v3/retention"
+	"github.com/mistifyio/go-zfs/v3/zfstest"
+)
+
+func ok(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func equals(t *testing.T, want, got interface{}) {
+	t.Helper()
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("want: %#v, got: %#v", want, got)
+	}
+}
+
+// withFakeClock makes s wait by advancing its clock instead of sleeping.
+func withFakeClock(s *Scheduler, start time.Time) {
+	now := start
+	s.now = func() time.Time { return now }
+	s.after = func(d time.Duration) <-chan time.Time {
+		now = now.Add(d)
+		c := make(chan time.Time, 1)
+		c <- now
+		return c
+	}
+}
+
+func setup(t *testing.T) context.Context {
+	t.Helper()
+	ctx := zfs.WithRunner(context.Background(), zfstest.New())
+	_, err := zfs.CreateZpoolContext(ctx, "tank", nil, "disk0")
+	ok(t, err)
+	_, err = zfs.CreateFilesystemContext(ctx, "tank/fs", nil)
+	ok(t, err)
+	_, err = zfs.CreateFilesystemContext(ctx, "tank/fs/child", nil)
+	ok(t, err)
+	return ctx
+}
+
+func TestRun(t *testing.T) {
+	ctx := setup(t)
+	s, err := New([]Job{
+		{
+			Dataset:   "tank/fs",
+			Recursive: true,
+			Interval:  time.Minute,
+			Template:  "auto-2006-01-02_15:04",
+			Retention: &retention.Policy{Prefix: "auto-", Latest: 2},
+		},
+		{Dataset: "tank/fs/child", Interval: 2 * time.Minute, Template: "child-15:04"},
+	})
+	ok(t, err)
+	withFakeClock(s, time.Date(2022, time.January, 1, 0, 0, 30, 0, time.UTC))
+
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var results []Result
+	err = s.Run(runCtx, func(r Result) {
+		results = append(results, r)
+		if len(results) == 5 {
+			cancel()
+		}
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+
+	var got []string
+	for _, r := range results {
+		ok(t, r.Err)
+		got = append(got, r.Snapshots[0].Name)
+	}
+	equals(t, []string{
+		"tank/fs@auto-2022-01-01_00:01", "tank/fs@auto-2022-01-01_00:02", "tank/fs/child@child-00:02",
+		"tank/fs@auto-2022-01-01_00:03", "tank/fs@auto-2022-01-01_00:04",
+	}, got)
+	equals(t, time.Date(2022, time.January, 1, 0, 1, 0, 0, time.UTC), results[0].Time)
+	equals(t, 2, len(results[0].Snapshots))
+	equals(t, []string{"tank/fs@auto-2022-01-01_00:01", "tank/fs/child@auto-2022-01-01_00:01"}, results[3].Destroyed)
+
+	snaps, err := zfs.SnapshotsContext(ctx, "tank/fs")
+	ok(t, err)
+	equals(t, 5, len(snaps))
+}
+
+func TestStart(t *testing.T) {
+	ctx := setup(t)
+	s, err := New([]Job{{Dataset: "tank/fs", Interval: time.Hour, Template: "hourly-2006-01-02_15"}})
+	ok(t, err)
+	withFakeClock(s, time.Date(2022, time.January, 1, 0, 30, 0, 0, time.UTC))
+
+	ctx, cancel := context.WithCancel(ctx)
+	results := s.Start(ctx)
+	r := <-results
+	ok(t, r.Err)
+	equals(t, "tank/fs@hourly-2022-01-01_01", r.Snapshots[0].Name)
+	cancel()
+	for range results {
+	}
+}
+
+func TestNew(t *testing.T) {
+	for _, j := range []Job{
+		{Interval: time.Hour, Template: "auto-15"},
+		{Dataset: "tank/fs", Template: "auto-15"},
+		{Dataset: "tank/fs", Interval: time.Hour},
+		{Dataset: "tank/fs", Interval: time.Hour, Template: "auto 15"},
+		{Dataset: "tank/fs", Interval: time.Hour, Template: "auto-15", Retention: &retention.Policy{}},
+	} {
+		if _, err := New([]Job{j}); err == nil {
+			t.Fatalf("expected error for job %+v", j)
+		}
+	}
+	if _, err := New(nil); err == nil {
+		t.Fatal("expected error without jobs")
+	}
+}
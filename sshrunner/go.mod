@@ -0,0 +1,10 @@
+module github.com/mistifyio/go-zfs/v3/sshrunner
+
+go 1.14
+
+require (
+	github.com/mistifyio/go-zfs/v3 v3.0.0-00010101000000-000000000000
+	golang.org/x/crypto v0.31.0
+)
+
+replace github.com/mistifyio/go-zfs/v3 => ../
@@ -0,0 +1,122 @@
+// Package sshrunner provides a zfs.Runner which executes the zfs and zpool commands on a remote host over SSH.
+//
+// Usage:
+//
+//	r, err := sshrunner.Dial("storage1:22", &ssh.ClientConfig{...})
+//	if err != nil {
+//		return err
+//	}
+//	defer r.Close()
+//	pools, err := zfs.ListZpoolsContext(zfs.WithRunner(ctx, r))
+package sshrunner
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Runner executes commands on a remote host over an SSH connection.
+// Every command runs in its own session, so a Runner may be used concurrently.
+type Runner struct {
+	client *ssh.Client
+}
+
+// New returns a Runner executing commands over an established SSH client connection.
+// The connection remains owned by the caller.
+func New(client *ssh.Client) *Runner {
+	return &Runner{client: client}
+}
+
+// Dial connects to the SSH server at addr and returns a Runner executing commands over the connection.
+// The connection is closed by Runner.Close.
+func Dial(addr string, config *ssh.ClientConfig) (*Runner, error) {
+	client, err := ssh.Dial("tcp", addr, config)
+	if err != nil {
+		return nil, err
+	}
+	return New(client), nil
+}
+
+// Close closes the underlying SSH connection.
+func (r *Runner) Close() error {
+	return r.client.Close()
+}
+
+// Run implements zfs.Runner.
+func (r *Runner) Run(ctx context.Context, name string, args ...string) ([]byte, []byte, error) {
+	var stdout bytes.Buffer
+	stderr, err := r.RunStream(ctx, nil, &stdout, name, args...)
+	return stdout.Bytes(), stderr, err
+}
+
+// RunStream implements zfs.StreamRunner, streaming stdin and stdout over the SSH session.
+// The remote command is killed and the session closed if ctx becomes done before the command completes.
+func (r *Runner) RunStream(ctx context.Context, stdin io.Reader, stdout io.Writer, name string, args ...string) ([]byte, error) {
+	session, err := r.client.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	var stderr bytes.Buffer
+	session.Stdin = stdin
+	session.Stdout = stdout
+	session.Stderr = &stderr
+
+	done := make(chan error, 1)
+	go func() {
+		done <- session.Run(Command(name, args...))
+	}()
+
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		_ = session.Signal(ssh.SIGKILL)
+		session.Close()
+		<-done
+		return stderr.Bytes(), ctx.Err()
+	}
+
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) {
+		err = &ExitError{ExitError: exitErr}
+	}
+	return stderr.Bytes(), err
+}
+
+// ExitError is returned when the remote command exits with a non-zero exit status.
+type ExitError struct {
+	*ssh.ExitError
+}
+
+// ExitCode returns the exit status of the remote command, which is reported as zfs.Error.ExitCode.
+func (e *ExitError) ExitCode() int {
+	return e.ExitStatus()
+}
+
+// Unwrap returns the underlying *ssh.ExitError.
+func (e *ExitError) Unwrap() error {
+	return e.ExitError
+}
+
+// Command renders name and args as a single command line for the remote shell, quoting every argument.
+func Command(name string, args ...string) string {
+	quoted := make([]string, 0, len(args)+1)
+	for _, arg := range append([]string{name}, args...) {
+		quoted = append(quoted, quote(arg))
+	}
+	return strings.Join(quoted, " ")
+}
+
+// quote quotes s for a POSIX shell, unless it only consists of characters which are safe unquoted.
+func quote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_=+,.:/@%#") == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
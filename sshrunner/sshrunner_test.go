@@ -0,0 +1,180 @@
+package sshrunner
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"net"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	zfs "github.com/mistifyio/go-zfs/v3"
+	"golang.org/x/crypto/ssh"
+)
+
+var _ zfs.StreamRunner = (*Runner)(nil)
+
+func TestCommand(t *testing.T) {
+	for _, test := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"zfs", "list", "-Hp", "-o", "name,used", "tank/fs@snap"}, "zfs list -Hp -o name,used tank/fs@snap"},
+		{[]string{"zfs", "set", "com.example:note=it's here", "tank/my fs"}, `zfs set 'com.example:note=it'\''s here' 'tank/my fs'`},
+		{[]string{"zfs", "set", "mountpoint=", ""}, "zfs set mountpoint= ''"},
+		{[]string{"zfs", "list", "$(reboot)", "a;b"}, "zfs list '$(reboot)' 'a;b'"},
+	} {
+		if got := Command(test.args[0], test.args[1:]...); got != test.want {
+			t.Fatalf("want: %s, got: %s", test.want, got)
+		}
+	}
+}
+
+// startServer starts an SSH server on localhost which executes commands with the local shell.
+func startServer(t *testing.T) string {
+	t.Helper()
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &ssh.ServerConfig{NoClientAuth: true}
+	config.AddHostKey(signer)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serveConn(conn, config)
+		}
+	}()
+	return l.Addr().String()
+}
+
+func serveConn(conn net.Conn, config *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for newChan := range chans {
+		ch, reqs, err := newChan.Accept()
+		if err != nil {
+			continue
+		}
+		go serveSession(ch, reqs)
+	}
+}
+
+func serveSession(ch ssh.Channel, reqs <-chan *ssh.Request) {
+	defer ch.Close()
+	var cmd *exec.Cmd
+	for req := range reqs {
+		switch req.Type {
+		case "exec":
+			command := string(req.Payload[4:])
+			cmd = exec.Command("sh", "-c", command)
+			cmd.Stdin = ch
+			cmd.Stdout = ch
+			cmd.Stderr = ch.Stderr()
+			_ = req.Reply(true, nil)
+			go func() {
+				status := uint32(0)
+				var exitErr *exec.ExitError
+				if err := cmd.Run(); errors.As(err, &exitErr) {
+					status = uint32(exitErr.ExitCode())
+				}
+				payload := make([]byte, 4)
+				binary.BigEndian.PutUint32(payload, status)
+				_, _ = ch.SendRequest("exit-status", false, payload)
+				ch.Close()
+			}()
+		case "signal":
+			if cmd != nil && cmd.Process != nil {
+				_ = cmd.Process.Kill()
+			}
+		default:
+			_ = req.Reply(false, nil)
+		}
+	}
+}
+
+func dial(t *testing.T) *Runner {
+	t.Helper()
+	r, err := Dial(startServer(t), &ssh.ClientConfig{
+		User:            "test",
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(), // nolint:gosec // test server with ephemeral key
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { r.Close() })
+	return r
+}
+
+func TestRun(t *testing.T) {
+	r := dial(t)
+
+	stdout, stderr, err := r.Run(context.Background(), "printf", `%s\t%s\n`, "tank/my fs", "it's")
+	if err != nil {
+		t.Fatalf("unexpected error: %v: %s", err, stderr)
+	}
+	if string(stdout) != "tank/my fs\tit's\n" {
+		t.Fatalf("unexpected stdout: %q", stdout)
+	}
+
+	_, stderr, err = r.Run(context.Background(), "sh", "-c", "echo 'dataset does not exist' >&2; exit 3")
+	var exitErr interface{ ExitCode() int }
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 3 {
+		t.Fatalf("expected exit code 3, got %v", err)
+	}
+	if strings.TrimSpace(string(stderr)) != "dataset does not exist" {
+		t.Fatalf("unexpected stderr: %q", stderr)
+	}
+}
+
+func TestRunStream(t *testing.T) {
+	r := dial(t)
+
+	var out bytes.Buffer
+	stderr, err := r.RunStream(context.Background(), strings.NewReader("zfs stream"), &out, "cat")
+	if err != nil {
+		t.Fatalf("unexpected error: %v: %s", err, stderr)
+	}
+	if out.String() != "zfs stream" {
+		t.Fatalf("unexpected stdout: %q", out.String())
+	}
+}
+
+func TestRunContextCancel(t *testing.T) {
+	r := dial(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, _, err := r.Run(ctx, "sleep", "10")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("command was not cancelled, took %v", elapsed)
+	}
+}
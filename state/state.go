@@ -0,0 +1,323 @@
+// Package state reconciles a tree of datasets with a declared state, with the plan and apply steps of
+// infrastructure as code tools, built on go-zfs.
+//
+// Usage:
+//
+//	spec := state.Spec{
+//		Root:  "tank/apps",
+//		Prune: true,
+//		Datasets: []state.Dataset{
+//			{Name: "tank/apps"},
+//			{Name: "tank/apps/db", Properties: map[string]string{"recordsize": "16384"}},
+//			{Name: "tank/apps/vm", Type: zfs.DatasetVolume, Size: 10 << 30},
+//		},
+//	}
+//	plan, err := state.Plan(spec)
+//	if err != nil {
+//		return err
+//	}
+//	fmt.Print(plan)
+//	err = state.Apply(plan)
+package state
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	zfs "github.com/mistifyio/go-zfs/v3"
+)
+
+// Dataset is the desired state of a filesystem or volume.
+type Dataset struct {
+	Name string
+	// Type is zfs.DatasetFilesystem, the default if empty, or zfs.DatasetVolume.
+	Type string
+	// Size is the size of a volume in bytes. Volumes are grown to Size but never shrunk.
+	Size uint64
+	// Properties are the values the properties of the dataset must have. Values are compared as printed by
+	// zfs get -p, so sizes should be given in bytes. Properties which are not listed are left as they are.
+	Properties map[string]string
+}
+
+// Spec is the desired state of a tree of datasets.
+type Spec struct {
+	// Root is the dataset all Datasets are in, including Root itself.
+	Root string
+	// Datasets are the filesystems and volumes which must exist. The parents of those which do not exist yet must
+	// exist or be declared as well, they are not created implicitly.
+	Datasets []Dataset
+	// Prune destroys the filesystems and volumes below Root which are not in Datasets. Datasets with snapshots or
+	// clones are not destroyed, applying the plan fails at them.
+	Prune bool
+}
+
+// Actions of changes.
+const (
+	ActionCreate  = "create"
+	ActionSet     = "set"
+	ActionResize  = "resize"
+	ActionDestroy = "destroy"
+)
+
+// Change is a single step of a plan.
+type Change struct {
+	// Action is one of the Action constants.
+	Action  string
+	Dataset string
+	// Type is the type of datasets which are created or destroyed.
+	Type string
+	// Size is the size of volumes which are created or resized, FromSize the current size of resized ones.
+	Size     uint64
+	FromSize uint64
+	// Properties are set on created datasets, or set on existing ones, with From holding their current values.
+	Properties map[string]string
+	From       map[string]string
+}
+
+// String describes the change, e.g. "~ set tank/apps/db recordsize: 131072 -> 16384".
+func (c Change) String() string {
+	var b strings.Builder
+	switch c.Action {
+	case ActionCreate:
+		fmt.Fprintf(&b, "+ create %s %s", c.Type, c.Dataset)
+		if c.Type == zfs.DatasetVolume {
+			fmt.Fprintf(&b, " size=%d", c.Size)
+		}
+		for _, k := range sortedKeys(c.Properties) {
+			fmt.Fprintf(&b, " %s=%s", k, c.Properties[k])
+		}
+	case ActionSet:
+		fmt.Fprintf(&b, "~ set %s", c.Dataset)
+		for i, k := range sortedKeys(c.Properties) {
+			if i > 0 {
+				b.WriteString(",")
+			}
+			fmt.Fprintf(&b, " %s: %s -> %s", k, c.From[k], c.Properties[k])
+		}
+	case ActionResize:
+		fmt.Fprintf(&b, "~ resize %s: %d -> %d", c.Dataset, c.FromSize, c.Size)
+	case ActionDestroy:
+		fmt.Fprintf(&b, "- destroy %s %s", c.Type, c.Dataset)
+	}
+	return b.String()
+}
+
+// Changes are the steps which reconcile the datasets with a Spec, in the order they are applied: datasets are
+// created and changed parents first, then destroyed children first.
+type Changes []Change
+
+// String describes the changes, one per line.
+func (c Changes) String() string {
+	var b strings.Builder
+	for _, change := range c {
+		b.WriteString(change.String())
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func (s *Spec) validate() error {
+	if err := zfs.ValidateDatasetName(s.Root); err != nil {
+		return err
+	}
+	seen := map[string]bool{}
+	for _, d := range s.Datasets {
+		if d.Name != s.Root && !strings.HasPrefix(d.Name, s.Root+"/") {
+			return fmt.Errorf("dataset %s is not in %s", d.Name, s.Root)
+		}
+		if n, err := zfs.ParseDatasetName(d.Name); err != nil {
+			return err
+		} else if n.Snapshot != "" || n.Bookmark != "" {
+			return fmt.Errorf("invalid dataset %s: must be a filesystem or volume", d.Name)
+		}
+		if seen[d.Name] {
+			return fmt.Errorf("duplicate dataset %s", d.Name)
+		}
+		seen[d.Name] = true
+		switch d.Type {
+		case "", zfs.DatasetFilesystem:
+		case zfs.DatasetVolume:
+			if d.Size == 0 {
+				return fmt.Errorf("volume %s has no size", d.Name)
+			}
+		default:
+			return fmt.Errorf("invalid type %q of %s", d.Type, d.Name)
+		}
+	}
+	return nil
+}
+
+// Plan compares the datasets below spec.Root with spec and returns the changes which reconcile them, without
+// applying them, which makes it the dry run of Apply.
+func Plan(spec Spec) (Changes, error) {
+	return PlanContext(context.Background(), spec)
+}
+
+// PlanContext is like Plan but includes a context.
+func PlanContext(ctx context.Context, spec Spec) (Changes, error) {
+	if err := spec.validate(); err != nil {
+		return nil, err
+	}
+	props := map[string]string{}
+	for _, d := range spec.Datasets {
+		for k := range d.Properties {
+			props[k] = ""
+		}
+	}
+	actual, err := zfs.ListDatasetsContext(ctx, zfs.ListOptions{
+		Root:       spec.Root,
+		Recursive:  true,
+		Types:      []string{zfs.DatasetFilesystem, zfs.DatasetVolume},
+		Properties: append([]string{"type", "volsize"}, sortedKeys(props)...),
+	})
+	if errors.Is(err, zfs.ErrDatasetNotFound) {
+		actual, err = nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	existing := make(map[string]*zfs.DatasetProperties, len(actual))
+	for _, ds := range actual {
+		existing[ds.Name] = ds
+	}
+
+	desired := append([]Dataset(nil), spec.Datasets...)
+	sort.Slice(desired, func(i, j int) bool {
+		return desired[i].Name < desired[j].Name
+	})
+	declared := make(map[string]string, len(desired))
+	for _, d := range desired {
+		declared[d.Name] = datasetType(d)
+	}
+	var changes Changes
+	wanted := map[string]bool{}
+	for _, d := range desired {
+		wanted[d.Name] = true
+		typ := datasetType(d)
+		ds, ok := existing[d.Name]
+		if !ok {
+			if d.Name != spec.Root {
+				if err := checkParent(d.Name, declared, existing); err != nil {
+					return nil, err
+				}
+			}
+			changes = append(changes, Change{Action: ActionCreate, Dataset: d.Name, Type: typ, Size: d.Size, Properties: d.Properties})
+			continue
+		}
+		if ds.Type != typ {
+			return nil, fmt.Errorf("dataset %s is a %s instead of a %s", d.Name, ds.Type, typ)
+		}
+		if typ == zfs.DatasetVolume && ds.VolSize != d.Size {
+			if ds.VolSize > d.Size {
+				return nil, fmt.Errorf("volume %s is larger than %d bytes and is not shrunk", d.Name, d.Size)
+			}
+			changes = append(changes, Change{Action: ActionResize, Dataset: d.Name, Size: d.Size, FromSize: ds.VolSize})
+		}
+		set := Change{Action: ActionSet, Dataset: d.Name, Properties: map[string]string{}, From: map[string]string{}}
+		for k, v := range d.Properties {
+			if current := ds.Raw[k].Value; current != v {
+				set.Properties[k], set.From[k] = v, current
+			}
+		}
+		if len(set.Properties) > 0 {
+			changes = append(changes, set)
+		}
+	}
+
+	if spec.Prune {
+		// zfs list prints parents before their children
+		for i := len(actual) - 1; i >= 0; i-- {
+			ds := actual[i]
+			if !wanted[ds.Name] && ds.Name != spec.Root && !hasWantedChild(wanted, ds.Name) {
+				changes = append(changes, Change{Action: ActionDestroy, Dataset: ds.Name, Type: ds.Type})
+			}
+		}
+	}
+	return changes, nil
+}
+
+// Apply applies the changes of a plan in order, stopping at the first which fails. Changes already applied are
+// not rolled back, planning again yields the remaining ones.
+func Apply(changes Changes) error {
+	return ApplyContext(context.Background(), changes)
+}
+
+// ApplyContext is like Apply but includes a context.
+func ApplyContext(ctx context.Context, changes Changes) error {
+	for _, c := range changes {
+		if err := apply(ctx, c); err != nil {
+			return fmt.Errorf("cannot %s %s: %w", c.Action, c.Dataset, err)
+		}
+	}
+	return nil
+}
+
+func apply(ctx context.Context, c Change) error {
+	ds := &zfs.Dataset{Name: c.Dataset, Type: c.Type}
+	var err error
+	switch c.Action {
+	case ActionCreate:
+		if c.Type == zfs.DatasetVolume {
+			_, err = zfs.CreateVolumeContext(ctx, c.Dataset, c.Size, c.Properties)
+		} else {
+			_, err = zfs.CreateFilesystemContext(ctx, c.Dataset, c.Properties)
+		}
+	case ActionSet:
+		err = ds.SetPropertiesContext(ctx, c.Properties)
+	case ActionResize:
+		ds.Type = zfs.DatasetVolume
+		err = ds.ResizeVolumeContext(ctx, c.Size, false)
+	case ActionDestroy:
+		err = ds.DestroyContext(ctx, zfs.DestroyDefault)
+	default:
+		err = fmt.Errorf("unknown action %q", c.Action)
+	}
+	return err
+}
+
+func datasetType(d Dataset) string {
+	if d.Type == "" {
+		return zfs.DatasetFilesystem
+	}
+	return d.Type
+}
+
+// checkParent fails unless the parent of a dataset to create is declared or exists, and is a filesystem. Parents
+// are not created implicitly, so Apply does not fail at them after applying earlier changes.
+func checkParent(name string, declared map[string]string, existing map[string]*zfs.DatasetProperties) error {
+	parent := name[:strings.LastIndex(name, "/")]
+	typ, ok := declared[parent]
+	if !ok {
+		ds, ok := existing[parent]
+		if !ok {
+			return fmt.Errorf("parent %s of %s is neither declared nor existing", parent, name)
+		}
+		typ = ds.Type
+	}
+	if typ != zfs.DatasetFilesystem {
+		return fmt.Errorf("parent %s of %s is a %s instead of a filesystem", parent, name, typ)
+	}
+	return nil
+}
+
+// hasWantedChild reports whether a descendent of the dataset is wanted, which keeps it from being destroyed.
+func hasWantedChild(wanted map[string]bool, name string) bool {
+	for w := range wanted {
+		if strings.HasPrefix(w, name+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,117 @@
+package state_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	zfs "github.com/mistifyio/go-zfs/v3"
+	"github.com/mistifyio/go-zfs/v3/state"
+	"github.com/mistifyio/go-zfs/v3/zfstest"
+)
+
+func ok(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func equals(t *testing.T, want, got interface{}) {
+	t.Helper()
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("want: %#v, got: %#v", want, got)
+	}
+}
+
+func TestPlanApply(t *testing.T) {
+	ctx := zfs.WithRunner(context.Background(), zfstest.New())
+	_, err := zfs.CreateZpoolContext(ctx, "tank", nil, "disk0")
+	ok(t, err)
+	for _, name := range []string{"tank/apps", "tank/apps/db", "tank/apps/old", "tank/apps/old/cache", "tank/apps/keep"} {
+		_, err := zfs.CreateFilesystemContext(ctx, name, nil)
+		ok(t, err)
+	}
+	_, err = zfs.CreateFilesystemContext(ctx, "tank/apps/keep/data", nil)
+	ok(t, err)
+
+	spec := state.Spec{
+		Root:  "tank/apps",
+		Prune: true,
+		Datasets: []state.Dataset{
+			{Name: "tank/apps/vm", Type: zfs.DatasetVolume, Size: 1 << 30},
+			{Name: "tank/apps"},
+			{Name: "tank/apps/db", Properties: map[string]string{"recordsize": "16384", "compression": "lz4"}},
+			{Name: "tank/apps/web", Properties: map[string]string{"compression": "lz4"}},
+			{Name: "tank/apps/keep/data"},
+		},
+	}
+	plan, err := state.PlanContext(ctx, spec)
+	ok(t, err)
+	equals(t, "~ set tank/apps/db compression: off -> lz4, recordsize: 131072 -> 16384\n"+
+		"+ create volume tank/apps/vm size=1073741824\n"+
+		"+ create filesystem tank/apps/web compression=lz4\n"+
+		"- destroy filesystem tank/apps/old/cache\n"+
+		"- destroy filesystem tank/apps/old\n", plan.String())
+
+	ok(t, state.ApplyContext(ctx, plan))
+	plan, err = state.PlanContext(ctx, spec)
+	ok(t, err)
+	equals(t, 0, len(plan))
+
+	spec.Datasets[0].Size = 2 << 30
+	plan, err = state.PlanContext(ctx, spec)
+	ok(t, err)
+	equals(t, "~ resize tank/apps/vm: 1073741824 -> 2147483648\n", plan.String())
+	ok(t, state.ApplyContext(ctx, plan))
+
+	spec.Datasets[0].Size = 1 << 30
+	if _, err := state.PlanContext(ctx, spec); err == nil {
+		t.Fatal("expected error shrinking a volume")
+	}
+	spec.Datasets[0].Type = zfs.DatasetFilesystem
+	if _, err := state.PlanContext(ctx, spec); err == nil {
+		t.Fatal("expected error changing the type of a dataset")
+	}
+}
+
+func TestSpecErrors(t *testing.T) {
+	for _, spec := range []state.Spec{
+		{Root: "tank/apps", Datasets: []state.Dataset{{Name: "tank/other"}}},
+		{Root: "tank/apps", Datasets: []state.Dataset{{Name: "tank/apps/vm", Type: zfs.DatasetVolume}}},
+		{Root: "tank/apps", Datasets: []state.Dataset{{Name: "tank/apps/a"}, {Name: "tank/apps/a"}}},
+		{Root: "tank/apps", Datasets: []state.Dataset{{Name: "tank/apps@snap"}}},
+		{Root: "tank/apps", Datasets: []state.Dataset{{Name: "tank/apps/a", Type: zfs.DatasetSnapshot}}},
+		{Root: "tank//apps"},
+	} {
+		if _, err := state.Plan(spec); err == nil {
+			t.Fatalf("expected error for %+v", spec)
+		}
+	}
+}
+
+func TestPlanParents(t *testing.T) {
+	ctx := zfs.WithRunner(context.Background(), zfstest.New())
+	_, err := zfs.CreateZpoolContext(ctx, "tank", nil, "disk0")
+	ok(t, err)
+	_, err = zfs.CreateFilesystemContext(ctx, "tank/apps", nil)
+	ok(t, err)
+
+	spec := state.Spec{Root: "tank/apps", Datasets: []state.Dataset{{Name: "tank/apps/a/b"}}}
+	if _, err := state.PlanContext(ctx, spec); err == nil {
+		t.Fatal("expected error for undeclared missing parent")
+	}
+	spec.Datasets = append(spec.Datasets, state.Dataset{Name: "tank/apps/a", Type: zfs.DatasetVolume, Size: 1 << 20})
+	if _, err := state.PlanContext(ctx, spec); err == nil {
+		t.Fatal("expected error for volume parent")
+	}
+
+	// declared parents are created first
+	spec.Datasets[1] = state.Dataset{Name: "tank/apps/a"}
+	plan, err := state.PlanContext(ctx, spec)
+	ok(t, err)
+	equals(t, "+ create filesystem tank/apps/a\n+ create filesystem tank/apps/a/b\n", plan.String())
+	ok(t, state.ApplyContext(ctx, plan))
+	_, err = zfs.GetDatasetContext(ctx, "tank/apps/a/b")
+	ok(t, err)
+}
@@ -2,14 +2,16 @@ package zfs
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
-	"os/exec"
+	"io/ioutil"
 	"regexp"
 	"runtime"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
 )
@@ -18,35 +20,140 @@ type command struct {
 	Command string
 	Stdin   io.Reader
 	Stdout  io.Writer
+	// stream marks commands which transfer a stream or follow output, to which the command timeout does not apply.
+	stream bool
+	// blocking marks commands which block until an activity finishes, such as zpool wait, and are given their
+	// own timeout, to which the command timeout does not apply either.
+	blocking bool
 }
 
-func (c *command) Run(arg ...string) ([][]string, error) {
-	cmd := exec.Command(c.Command, arg...)
-
-	var stdout, stderr bytes.Buffer
-
-	if c.Stdout == nil {
-		cmd.Stdout = &stdout
-	} else {
-		cmd.Stdout = c.Stdout
+// Run executes the command with the given arguments and returns its output split into lines of tab separated fields.
+// The command is executed by the Runner of ctx (see WithRunner), or the default Runner if ctx has none.
+// The output of read-only commands is cached if SetCacheTTL enabled caching.
+func (c *command) Run(ctx context.Context, arg ...string) ([][]string, error) {
+	cache := currentCache()
+	if cache == nil {
+		return c.runRetrying(ctx, arg...)
+	}
+	key, ok := cache.key(runnerFromContext(ctx), c, arg)
+	if !ok {
+		return c.runRetrying(ctx, arg...)
+	}
+	out, hit := cache.get(key)
+	if !hit || cacheBypassed(ctx) {
+		var buf bytes.Buffer
+		cached := *c
+		cached.Stdout = &buf
+		if _, err := cached.runRetrying(ctx, arg...); err != nil {
+			return nil, err
+		}
+		out = buf.Bytes()
+		pool, _ := commandTarget(c.Command, arg)
+		cache.put(key, pool, out)
 	}
+	if c.Stdout != nil {
+		_, err := c.Stdout.Write(out)
+		return nil, err
+	}
+	return splitOutput(out), nil
+}
 
-	if c.Stdin != nil {
-		cmd.Stdin = c.Stdin
+// runRetrying executes the command, retrying it according to the RetryPolicy of ctx if it fails.
+func (c *command) runRetrying(ctx context.Context, arg ...string) ([][]string, error) {
+	policy := retryPolicyFromContext(ctx)
+	// the output written to a caller's writer cannot be taken back, only buffers are reset before a retry
+	buf, buffered := c.Stdout.(*bytes.Buffer)
+	retry := c.Stdin == nil && !c.stream && (c.Stdout == nil || buffered)
+	for attempt := 1; ; attempt++ {
+		out, err := c.run(ctx, arg...)
+		if err == nil || !retry || attempt >= policy.MaxAttempts || !policy.retryable(err) {
+			return out, err
+		}
+		if buffered {
+			buf.Reset()
+		}
+		timer := time.NewTimer(policy.delay(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, err
+		case <-timer.C:
+		}
 	}
-	cmd.Stderr = &stderr
+}
+
+// run executes the command once.
+func (c *command) run(ctx context.Context, arg ...string) ([][]string, error) {
+	r := runnerFromContext(ctx)
 
 	id := uuid.New().String()
-	joinedArgs := strings.Join(cmd.Args, " ")
+	cmdArgs := append([]string{c.Command}, arg...)
+	joinedArgs := strings.Join(cmdArgs, " ")
 
+	mutating := IsMutatingCommand(c.Command, arg)
+	dryRun := mutating && dryRunFromContext(ctx)
+	if !dryRun {
+		release, err := currentLimiter().acquire(ctx, c, mutating, arg)
+		if err != nil {
+			return nil, &Error{Err: err, Debug: joinedArgs, Args: cmdArgs, ExitCode: -1}
+		}
+		defer release()
+	}
+	runCtx := ctx
+	if timeout := commandTimeoutFromContext(ctx); timeout > 0 && !c.stream && !c.blocking {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	var stdout, stderr []byte
+	var err error
 	logger.Log([]string{"ID:" + id, "START", joinedArgs})
-	if err := cmd.Run(); err != nil {
-		return nil, &Error{
-			Err:    err,
-			Debug:  strings.Join([]string{cmd.Path, joinedArgs[1:]}, " "),
-			Stderr: stderr.String(),
+	rec := &CommandRecord{Command: c.Command, Args: arg, Start: time.Now(), Mutating: mutating}
+	switch {
+	case dryRun:
+		rec.DryRun = true
+		// the input of a skipped command, such as the stream of zfs receive, is consumed so its writer does not block
+		if c.Stdin != nil {
+			_, err = io.Copy(ioutil.Discard, c.Stdin)
+		}
+	case c.Stdin == nil && c.Stdout == nil:
+		stdout, stderr, err = r.Run(runCtx, c.Command, arg...)
+	default:
+		stdout, stderr, err = runStream(runCtx, r, c.Stdin, c.Stdout, c.Command, arg...)
+	}
+	if !rec.DryRun {
+		rec.Duration = time.Since(rec.Start)
+	}
+	if mutating && !dryRun {
+		if cache := currentCache(); cache != nil {
+			pool, _ := commandTarget(c.Command, arg)
+			cache.invalidate(r, pool)
+		}
+	}
+	if err != nil {
+		exitCode := -1
+		var exitErr interface{ ExitCode() int }
+		if errors.As(err, &exitErr) {
+			exitCode = exitErr.ExitCode()
 		}
+		if ctxErr := runCtx.Err(); ctxErr != nil {
+			err = ctxErr
+		}
+		zerr := &Error{
+			Err:      err,
+			Debug:    joinedArgs,
+			Stderr:   string(stderr),
+			Args:     cmdArgs,
+			ExitCode: exitCode,
+		}
+		rec.ExitCode, rec.Err = exitCode, zerr
+		audit(rec)
+		logCommand(ctx, rec, stderr)
+		return nil, zerr
 	}
+	audit(rec)
+	logCommand(ctx, rec, nil)
 	logger.Log([]string{"ID:" + id, "FINISH"})
 
 	// assume if you passed in something for stdout, that you know what to do with it
@@ -54,17 +161,24 @@ func (c *command) Run(arg ...string) ([][]string, error) {
 		return nil, nil
 	}
 
-	lines := strings.Split(stdout.String(), "\n")
+	return splitOutput(stdout), nil
+}
 
-	// last line is always blank
-	lines = lines[0 : len(lines)-1]
+// splitOutput splits the output of a command into lines of tab separated fields.
+// Tabs are the only separator of the output of -H, so names, mountpoints and other values may contain spaces.
+func splitOutput(stdout []byte) [][]string {
+	out := strings.TrimSuffix(string(stdout), "\n")
+	if out == "" {
+		return [][]string{}
+	}
+	lines := strings.Split(out, "\n")
 	output := make([][]string, len(lines))
 
 	for i, l := range lines {
 		output[i] = strings.Split(l, "\t")
 	}
 
-	return output, nil
+	return output
 }
 
 func setString(field *string, value string) {
@@ -195,7 +309,37 @@ func parseReferenceCount(field string) (int, error) {
 	return strconv.Atoi(matches[1])
 }
 
-func parseInodeChange(line []string) (*InodeChange, error) {
+// parseInodeChangeTime parses the inode change time printed by zfs diff -t as seconds.nanoseconds.
+func parseInodeChangeTime(field string) (time.Time, error) {
+	parts := strings.SplitN(field, ".", 2)
+	secs, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	var nsecs int64
+	if len(parts) == 2 {
+		nsecs, err = strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+	}
+	return time.Unix(secs, nsecs), nil
+}
+
+func parseInodeChange(line []string, timestamps bool) (*InodeChange, error) {
+	var changeTime time.Time
+	if timestamps {
+		if len(line) < 1 {
+			return nil, fmt.Errorf("empty line passed")
+		}
+		var err error
+		changeTime, err = parseInodeChangeTime(line[0])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse change time: %w", err)
+		}
+		line = line[1:]
+	}
+
 	llen := len(line) // nolint:ifshort // llen *is* actually used
 	if llen < 1 {
 		return nil, fmt.Errorf("empty line passed")
@@ -256,6 +400,7 @@ func parseInodeChange(line []string) (*InodeChange, error) {
 		Path:                 path,
 		NewPath:              newPath,
 		ReferenceCountChange: referenceCount,
+		Time:                 changeTime,
 	}, nil
 }
 
@@ -264,12 +409,15 @@ func parseInodeChange(line []string) (*InodeChange, error) {
 // +       F       /testpool/bar/hello.txt
 // M       /       /testpool/bar/hello.txt (+1)
 // M       /       /testpool/bar/hello-hardlink
+//
+// with timestamps, every line is prefixed with the inode change time
+// 1627207200.123456789    +       F       /testpool/bar/hello.txt
 
-func parseInodeChanges(lines [][]string) ([]*InodeChange, error) {
+func parseInodeChanges(lines [][]string, timestamps bool) ([]*InodeChange, error) {
 	changes := make([]*InodeChange, len(lines))
 
 	for i, line := range lines {
-		c, err := parseInodeChange(line)
+		c, err := parseInodeChange(line, timestamps)
 		if err != nil {
 			return nil, fmt.Errorf("failed to parse line %d of zfs diff: %w, got: '%s'", i, err, line)
 		}
@@ -278,13 +426,13 @@ func parseInodeChanges(lines [][]string) ([]*InodeChange, error) {
 	return changes, nil
 }
 
-func listByType(t, filter string) ([]*Dataset, error) {
+func listByType(ctx context.Context, t, filter string) ([]*Dataset, error) {
 	args := []string{"list", "-rHp", "-t", t, "-o", dsPropListOptions}
 
 	if filter != "" {
 		args = append(args, filter)
 	}
-	out, err := zfsOutput(args...)
+	out, err := zfsListOutput(ctx, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -346,6 +494,10 @@ func (z *Zpool) parseLine(line []string) error {
 		err = setUint(&z.Freeing, val)
 	case "leaked":
 		err = setUint(&z.Leaked, val)
+	case "checkpoint":
+		err = setUint(&z.CheckpointSize, val)
+	case "guid":
+		err = setUint(&z.GUID, val)
 	case "dedupratio":
 		// Trim trailing "x" before parsing float64
 		z.DedupRatio, err = strconv.ParseFloat(val[:len(val)-1], 64)
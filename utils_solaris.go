@@ -12,7 +12,7 @@ var (
 	dsPropListOptions = strings.Join(dsPropList, ",")
 
 	// List of Zpool properties to retrieve from zpool list command on a non-Solaris platform
-	zpoolPropList = []string{"name", "health", "allocated", "size", "free", "readonly", "dedupratio"}
+	zpoolPropList = []string{"name", "health", "allocated", "size", "free", "readonly", "dedupratio", "guid"}
 
 	zpoolPropListOptions = strings.Join(zpoolPropList, ",")
 	zpoolArgs            = []string{"get", "-Hp", zpoolPropListOptions}
@@ -1,8 +1,11 @@
 package zfs
 
 import (
+	"context"
+	"errors"
 	"reflect"
 	"testing"
+	"time"
 )
 
 func TestParseLine(t *testing.T) {
@@ -36,3 +39,74 @@ func TestParseLine(t *testing.T) {
 		})
 	}
 }
+
+func TestSplitOutputSpaces(t *testing.T) {
+	line := "tank/my data\t-\t1024\t2048\t/mnt/my data \toff\tfilesystem\t-\t0\t1024\t0\t1024\t1024\n"
+	ctx, _ := withFakeRunner(line)
+	ds, err := GetDatasetContext(ctx, "tank/my data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ds.Name != "tank/my data" || ds.Mountpoint != "/mnt/my data " || ds.Compression != "off" || ds.Used != 1024 {
+		t.Fatalf("unexpected dataset: %+v", ds)
+	}
+
+	want := [][]string{{"a b", " c"}, {"d"}}
+	if got := splitOutput([]byte("a b\t c\nd")); !reflect.DeepEqual(want, got) {
+		t.Fatalf("want: %q, got: %q", want, got)
+	}
+}
+
+func TestCommandRunContextCancel(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	c := command{Command: "sleep"}
+	_, err := c.Run(ctx, "10")
+	if err == nil {
+		t.Fatal("expected error from cancelled command, got nil")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("command was not killed on context cancellation, took %v", elapsed)
+	}
+
+	var zErr *Error
+	if !errors.As(err, &zErr) {
+		t.Fatalf("expected *Error, got %T", err)
+	}
+	if zErr.Err != context.DeadlineExceeded {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", zErr.Err)
+	}
+}
+
+func TestParseInodeChanges(t *testing.T) {
+	got, err := parseInodeChanges([][]string{
+		{"1627207200.000000500", "M", "/", "/testpool/bar/"},
+		{"1627207201.000000000", "R", "F", "/testpool/bar/a", "/testpool/bar/b"},
+		{"1627207202.000000000", "M", "F", "/testpool/bar/hello.txt", "(+1)"},
+	}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*InodeChange{
+		{Change: Modified, Type: Directory, Path: "/testpool/bar/", Time: time.Unix(1627207200, 500)},
+		{Change: Renamed, Type: File, Path: "/testpool/bar/a", NewPath: "/testpool/bar/b", Time: time.Unix(1627207201, 0)},
+		{Change: Modified, Type: File, Path: "/testpool/bar/hello.txt", ReferenceCountChange: 1, Time: time.Unix(1627207202, 0)},
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("want: %+v, got: %+v", want, got)
+	}
+
+	got, err = parseInodeChanges([][]string{{"+", "F", "/testpool/bar/hello.txt"}}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual([]*InodeChange{{Change: Created, Type: File, Path: "/testpool/bar/hello.txt"}}, got) {
+		t.Fatalf("unexpected changes without timestamps: %+v", got)
+	}
+
+	if _, err := parseInodeChanges([][]string{{"yesterday", "+", "F", "/a"}}, true); err == nil {
+		t.Fatal("expected error for invalid change time")
+	}
+}
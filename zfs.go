@@ -2,18 +2,21 @@
 package zfs
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"strconv"
 	"strings"
+	"time"
 )
 
-// ZFS dataset types, which can indicate if a dataset is a filesystem, snapshot, or volume.
+// ZFS dataset types, which can indicate if a dataset is a filesystem, snapshot, volume, or bookmark.
 const (
 	DatasetFilesystem = "filesystem"
 	DatasetSnapshot   = "snapshot"
 	DatasetVolume     = "volume"
+	DatasetBookmark   = "bookmark"
 )
 
 // Dataset is a ZFS dataset.  A dataset could be a clone, filesystem, snapshot, or volume.
@@ -85,6 +88,8 @@ type InodeChange struct {
 	Path                 string
 	NewPath              string
 	ReferenceCountChange int
+	// Time is the inode change time of the changed file.
+	Time time.Time
 }
 
 // Logger can be used to log commands/actions.
@@ -100,52 +105,83 @@ func (*defaultLogger) Log([]string) {
 var logger Logger = &defaultLogger{}
 
 // SetLogger set a log handler to log all commands including arguments before they are executed.
+// If l also implements StructuredLogger, it receives the leveled messages of all commands whose context has no
+// logger set by WithLogger, see NewSlogLogger.
 func SetLogger(l Logger) {
 	if l != nil {
 		logger = l
+		structuredLogger, _ = l.(StructuredLogger)
 	}
 }
 
 // zfs is a helper function to wrap typical calls to zfs that ignores stdout.
-func zfs(arg ...string) error {
-	_, err := zfsOutput(arg...)
+func zfs(ctx context.Context, arg ...string) error {
+	_, err := zfsOutput(ctx, arg...)
 	return err
 }
 
 // zfs is a helper function to wrap typical calls to zfs.
-func zfsOutput(arg ...string) ([][]string, error) {
+func zfsOutput(ctx context.Context, arg ...string) ([][]string, error) {
 	c := command{Command: "zfs"}
-	return c.Run(arg...)
+	return c.Run(ctx, arg...)
 }
 
 // Datasets returns a slice of ZFS datasets, regardless of type.
 // A filter argument may be passed to select a dataset with the matching name, or empty string ("") may be used to select all datasets.
+// All properties of a Dataset are fetched for all descendents, use ListDatasets to select the datasets, properties and order.
 func Datasets(filter string) ([]*Dataset, error) {
-	return listByType("all", filter)
+	return DatasetsContext(context.Background(), filter)
+}
+
+// DatasetsContext is like Datasets but includes a context.
+//
+// The provided context is used to kill the zfs process if the context becomes done before the command completes on its own.
+func DatasetsContext(ctx context.Context, filter string) ([]*Dataset, error) {
+	return listByType(ctx, "all", filter)
 }
 
 // Snapshots returns a slice of ZFS snapshots.
 // A filter argument may be passed to select a snapshot with the matching name, or empty string ("") may be used to select all snapshots.
 func Snapshots(filter string) ([]*Dataset, error) {
-	return listByType(DatasetSnapshot, filter)
+	return SnapshotsContext(context.Background(), filter)
+}
+
+// SnapshotsContext is like Snapshots but includes a context.
+func SnapshotsContext(ctx context.Context, filter string) ([]*Dataset, error) {
+	return listByType(ctx, DatasetSnapshot, filter)
 }
 
 // Filesystems returns a slice of ZFS filesystems.
 // A filter argument may be passed to select a filesystem with the matching name, or empty string ("") may be used to select all filesystems.
 func Filesystems(filter string) ([]*Dataset, error) {
-	return listByType(DatasetFilesystem, filter)
+	return FilesystemsContext(context.Background(), filter)
+}
+
+// FilesystemsContext is like Filesystems but includes a context.
+func FilesystemsContext(ctx context.Context, filter string) ([]*Dataset, error) {
+	return listByType(ctx, DatasetFilesystem, filter)
 }
 
 // Volumes returns a slice of ZFS volumes.
 // A filter argument may be passed to select a volume with the matching name, or empty string ("") may be used to select all volumes.
 func Volumes(filter string) ([]*Dataset, error) {
-	return listByType(DatasetVolume, filter)
+	return VolumesContext(context.Background(), filter)
+}
+
+// VolumesContext is like Volumes but includes a context.
+func VolumesContext(ctx context.Context, filter string) ([]*Dataset, error) {
+	return listByType(ctx, DatasetVolume, filter)
 }
 
 // GetDataset retrieves a single ZFS dataset by name.
 // This dataset could be any valid ZFS dataset type, such as a clone, filesystem, snapshot, or volume.
 func GetDataset(name string) (*Dataset, error) {
-	out, err := zfsOutput("list", "-Hp", "-o", dsPropListOptions, name)
+	return GetDatasetContext(context.Background(), name)
+}
+
+// GetDatasetContext is like GetDataset but includes a context.
+func GetDatasetContext(ctx context.Context, name string) (*Dataset, error) {
+	out, err := zfsListOutput(ctx, "list", "-Hp", "-o", dsPropListOptions, name)
 	if err != nil {
 		return nil, err
 	}
@@ -163,9 +199,17 @@ func GetDataset(name string) (*Dataset, error) {
 // Clone clones a ZFS snapshot and returns a clone dataset.
 // An error will be returned if the input dataset is not of snapshot type.
 func (d *Dataset) Clone(dest string, properties map[string]string) (*Dataset, error) {
+	return d.CloneContext(context.Background(), dest, properties)
+}
+
+// CloneContext is like Clone but includes a context.
+func (d *Dataset) CloneContext(ctx context.Context, dest string, properties map[string]string) (*Dataset, error) {
 	if d.Type != DatasetSnapshot {
 		return nil, errors.New("can only clone snapshots")
 	}
+	if err := validateProperties(ctx, properties); err != nil {
+		return nil, err
+	}
 	args := make([]string, 2, 4)
 	args[0] = "clone"
 	args[1] = "-p"
@@ -173,14 +217,19 @@ func (d *Dataset) Clone(dest string, properties map[string]string) (*Dataset, er
 		args = append(args, propsSlice(properties)...)
 	}
 	args = append(args, []string{d.Name, dest}...)
-	if err := zfs(args...); err != nil {
+	if err := zfs(ctx, args...); err != nil {
 		return nil, err
 	}
-	return GetDataset(dest)
+	return GetDatasetContext(ctx, dest)
 }
 
 // Unmount unmounts currently mounted ZFS file systems.
 func (d *Dataset) Unmount(force bool) (*Dataset, error) {
+	return d.UnmountContext(context.Background(), force)
+}
+
+// UnmountContext is like Unmount but includes a context.
+func (d *Dataset) UnmountContext(ctx context.Context, force bool) (*Dataset, error) {
 	if d.Type == DatasetSnapshot {
 		return nil, errors.New("cannot unmount snapshots")
 	}
@@ -190,63 +239,69 @@ func (d *Dataset) Unmount(force bool) (*Dataset, error) {
 		args = append(args, "-f")
 	}
 	args = append(args, d.Name)
-	if err := zfs(args...); err != nil {
+	if err := zfs(ctx, args...); err != nil {
 		return nil, err
 	}
-	return GetDataset(d.Name)
+	return GetDatasetContext(ctx, d.Name)
 }
 
 // Mount mounts ZFS file systems.
 func (d *Dataset) Mount(overlay bool, options []string) (*Dataset, error) {
-	if d.Type == DatasetSnapshot {
-		return nil, errors.New("cannot mount snapshots")
-	}
-	args := make([]string, 1, 5)
-	args[0] = "mount"
-	if overlay {
-		args = append(args, "-O")
-	}
-	if options != nil {
-		args = append(args, "-o")
-		args = append(args, strings.Join(options, ","))
-	}
-	args = append(args, d.Name)
-	if err := zfs(args...); err != nil {
-		return nil, err
-	}
-	return GetDataset(d.Name)
+	return d.MountContext(context.Background(), overlay, options)
+}
+
+// MountContext is like Mount but includes a context.
+func (d *Dataset) MountContext(ctx context.Context, overlay bool, options []string) (*Dataset, error) {
+	return d.MountWithOptionsContext(ctx, MountOptions{Overlay: overlay, Options: options})
 }
 
 // ReceiveSnapshot receives a ZFS stream from the input io.Reader.
 // A new snapshot is created with the specified name, and streams the input data into the newly-created snapshot.
 func ReceiveSnapshot(input io.Reader, name string) (*Dataset, error) {
-	c := command{Command: "zfs", Stdin: input}
-	if _, err := c.Run("receive", name); err != nil {
+	return ReceiveSnapshotContext(context.Background(), input, name)
+}
+
+// ReceiveSnapshotContext is like ReceiveSnapshot but includes a context.
+//
+// Cancelling the context kills the receiving zfs process, leaving the partially received state to be cleaned up by zfs.
+func ReceiveSnapshotContext(ctx context.Context, input io.Reader, name string) (*Dataset, error) {
+	c := command{Command: "zfs", Stdin: input, stream: true}
+	if _, err := c.Run(ctx, "receive", name); err != nil {
 		return nil, err
 	}
-	return GetDataset(name)
+	return GetDatasetContext(ctx, name)
 }
 
 // SendSnapshot sends a ZFS stream of a snapshot to the input io.Writer.
 // An error will be returned if the input dataset is not of snapshot type.
 func (d *Dataset) SendSnapshot(output io.Writer) error {
+	return d.SendSnapshotContext(context.Background(), output)
+}
+
+// SendSnapshotContext is like SendSnapshot but includes a context.
+func (d *Dataset) SendSnapshotContext(ctx context.Context, output io.Writer) error {
 	if d.Type != DatasetSnapshot {
 		return errors.New("can only send snapshots")
 	}
 
-	c := command{Command: "zfs", Stdout: output}
-	_, err := c.Run("send", d.Name)
+	c := command{Command: "zfs", Stdout: output, stream: true}
+	_, err := c.Run(ctx, "send", d.Name)
 	return err
 }
 
 // IncrementalSend sends a ZFS stream of a snapshot to the input io.Writer using the baseSnapshot as the starting point.
 // An error will be returned if the input dataset is not of snapshot type.
 func (d *Dataset) IncrementalSend(baseSnapshot *Dataset, output io.Writer) error {
+	return d.IncrementalSendContext(context.Background(), baseSnapshot, output)
+}
+
+// IncrementalSendContext is like IncrementalSend but includes a context.
+func (d *Dataset) IncrementalSendContext(ctx context.Context, baseSnapshot *Dataset, output io.Writer) error {
 	if d.Type != DatasetSnapshot || baseSnapshot.Type != DatasetSnapshot {
 		return errors.New("can only send snapshots")
 	}
-	c := command{Command: "zfs", Stdout: output}
-	_, err := c.Run("send", "-i", baseSnapshot.Name, d.Name)
+	c := command{Command: "zfs", Stdout: output, stream: true}
+	_, err := c.Run(ctx, "send", "-i", baseSnapshot.Name, d.Name)
 	return err
 }
 
@@ -255,6 +310,14 @@ func (d *Dataset) IncrementalSend(baseSnapshot *Dataset, output io.Writer) error
 // A full list of available ZFS properties may be found in the ZFS manual:
 // https://openzfs.github.io/openzfs-docs/man/7/zfsprops.7.html.
 func CreateVolume(name string, size uint64, properties map[string]string) (*Dataset, error) {
+	return CreateVolumeContext(context.Background(), name, size, properties)
+}
+
+// CreateVolumeContext is like CreateVolume but includes a context.
+func CreateVolumeContext(ctx context.Context, name string, size uint64, properties map[string]string) (*Dataset, error) {
+	if err := validateProperties(ctx, properties); err != nil {
+		return nil, err
+	}
 	args := make([]string, 4, 5)
 	args[0] = "create"
 	args[1] = "-p"
@@ -264,37 +327,45 @@ func CreateVolume(name string, size uint64, properties map[string]string) (*Data
 		args = append(args, propsSlice(properties)...)
 	}
 	args = append(args, name)
-	if err := zfs(args...); err != nil {
+	if err := zfs(ctx, args...); err != nil {
 		return nil, err
 	}
-	return GetDataset(name)
+	return GetDatasetContext(ctx, name)
 }
 
 // Destroy destroys a ZFS dataset.
+// Bookmarks are destroyed the same way, but do not accept any of the recursive flags.
 // If the destroy bit flag is set, any descendents of the dataset will be recursively destroyed, including snapshots.
 // If the deferred bit flag is set, the snapshot is marked for deferred deletion.
 func (d *Dataset) Destroy(flags DestroyFlag) error {
-	args := make([]string, 1, 3)
-	args[0] = "destroy"
-	if flags&DestroyRecursive != 0 {
+	return d.DestroyContext(context.Background(), flags)
+}
+
+// DestroyContext is like Destroy but includes a context.
+func (d *Dataset) DestroyContext(ctx context.Context, flags DestroyFlag) error {
+	args := append(append([]string{"destroy"}, flags.args()...), d.Name)
+	err := zfs(ctx, args...)
+	return err
+}
+
+func (f DestroyFlag) args() []string {
+	var args []string
+	if f&DestroyRecursive != 0 {
 		args = append(args, "-r")
 	}
 
-	if flags&DestroyRecursiveClones != 0 {
+	if f&DestroyRecursiveClones != 0 {
 		args = append(args, "-R")
 	}
 
-	if flags&DestroyDeferDeletion != 0 {
+	if f&DestroyDeferDeletion != 0 {
 		args = append(args, "-d")
 	}
 
-	if flags&DestroyForceUmount != 0 {
+	if f&DestroyForceUmount != 0 {
 		args = append(args, "-f")
 	}
-
-	args = append(args, d.Name)
-	err := zfs(args...)
-	return err
+	return args
 }
 
 // SetProperty sets a ZFS property on the receiving dataset.
@@ -302,8 +373,16 @@ func (d *Dataset) Destroy(flags DestroyFlag) error {
 // A full list of available ZFS properties may be found in the ZFS manual:
 // https://openzfs.github.io/openzfs-docs/man/7/zfsprops.7.html.
 func (d *Dataset) SetProperty(key, val string) error {
+	return d.SetPropertyContext(context.Background(), key, val)
+}
+
+// SetPropertyContext is like SetProperty but includes a context.
+func (d *Dataset) SetPropertyContext(ctx context.Context, key, val string) error {
+	if err := validateProperties(ctx, map[string]string{key: val}); err != nil {
+		return err
+	}
 	prop := strings.Join([]string{key, val}, "=")
-	err := zfs("set", prop, d.Name)
+	err := zfs(ctx, "set", prop, d.Name)
 	return err
 }
 
@@ -312,7 +391,12 @@ func (d *Dataset) SetProperty(key, val string) error {
 // A full list of available ZFS properties may be found in the ZFS manual:
 // https://openzfs.github.io/openzfs-docs/man/7/zfsprops.7.html.
 func (d *Dataset) GetProperty(key string) (string, error) {
-	out, err := zfsOutput("get", "-H", key, d.Name)
+	return d.GetPropertyContext(context.Background(), key)
+}
+
+// GetPropertyContext is like GetProperty but includes a context.
+func (d *Dataset) GetPropertyContext(ctx context.Context, key string) (string, error) {
+	out, err := zfsOutput(ctx, "get", "-H", key, d.Name)
 	if err != nil {
 		return "", err
 	}
@@ -322,6 +406,11 @@ func (d *Dataset) GetProperty(key string) (string, error) {
 
 // Rename renames a dataset.
 func (d *Dataset) Rename(name string, createParent, recursiveRenameSnapshots bool) (*Dataset, error) {
+	return d.RenameContext(context.Background(), name, createParent, recursiveRenameSnapshots)
+}
+
+// RenameContext is like Rename but includes a context.
+func (d *Dataset) RenameContext(ctx context.Context, name string, createParent, recursiveRenameSnapshots bool) (*Dataset, error) {
 	args := make([]string, 3, 5)
 	args[0] = "rename"
 	args[1] = d.Name
@@ -332,16 +421,84 @@ func (d *Dataset) Rename(name string, createParent, recursiveRenameSnapshots boo
 	if recursiveRenameSnapshots {
 		args = append(args, "-r")
 	}
-	if err := zfs(args...); err != nil {
+	if err := zfs(ctx, args...); err != nil {
 		return d, err
 	}
 
-	return GetDataset(name)
+	return GetDatasetContext(ctx, renameTarget(d.Name, name))
+}
+
+// RenameOptions are the options which can be passed to RenameWithOptions.
+//
+// A full description of the options may be found in the ZFS manual:
+// https://openzfs.github.io/openzfs-docs/man/8/zfs-rename.8.html.
+type RenameOptions struct {
+	// CreateParent creates the missing parent datasets of the new name (-p), it does not apply to snapshots.
+	CreateParent bool
+	// Force unmounts the filesystem and its descendents even if they are busy (-f).
+	Force bool
+	// Recursive renames the snapshots of the same name of all descendent filesystems (-r), it only applies to snapshots.
+	Recursive bool
+	// NoRemount keeps the filesystem mounted at its old mountpoint rather than remounting it (-u).
+	NoRemount bool
+}
+
+func (o *RenameOptions) args() []string {
+	var args []string
+	if o.CreateParent {
+		args = append(args, "-p")
+	}
+	if o.Force {
+		args = append(args, "-f")
+	}
+	if o.Recursive {
+		args = append(args, "-r")
+	}
+	if o.NoRemount {
+		args = append(args, "-u")
+	}
+	return args
+}
+
+// RenameWithOptions renames the dataset as configured by opts.
+// Snapshots may be renamed within their filesystem, name may then be given as "@newsnap".
+func (d *Dataset) RenameWithOptions(name string, opts RenameOptions) (*Dataset, error) {
+	return d.RenameWithOptionsContext(context.Background(), name, opts)
+}
+
+// RenameWithOptionsContext is like RenameWithOptions but includes a context.
+func (d *Dataset) RenameWithOptionsContext(ctx context.Context, name string, opts RenameOptions) (*Dataset, error) {
+	switch {
+	case d.Type == DatasetSnapshot && opts.CreateParent:
+		return nil, errors.New("cannot create parents when renaming snapshots")
+	case d.Type != DatasetSnapshot && d.Type != "" && opts.Recursive:
+		return nil, errors.New("can only rename snapshots recursively")
+	}
+	args := append(append([]string{"rename"}, opts.args()...), d.Name, name)
+	if err := zfs(ctx, args...); err != nil {
+		return nil, err
+	}
+	return GetDatasetContext(ctx, renameTarget(d.Name, name))
+}
+
+// renameTarget returns the full new name of a dataset, expanding the short form "@newsnap" of snapshot renames.
+func renameTarget(from, to string) string {
+	if strings.HasPrefix(to, "@") {
+		if i := strings.IndexByte(from, '@'); i >= 0 {
+			return from[:i] + to
+		}
+	}
+	return to
 }
 
 // Snapshots returns a slice of all ZFS snapshots of a given dataset.
 func (d *Dataset) Snapshots() ([]*Dataset, error) {
-	return Snapshots(d.Name)
+	return d.SnapshotsContext(context.Background())
+}
+
+// SnapshotsContext is like Snapshots but includes a context.
+func (d *Dataset) SnapshotsContext(ctx context.Context) ([]*Dataset, error) {
+	return SnapshotsContext(ctx, d.Name)
 }
 
 // CreateFilesystem creates a new ZFS filesystem with the specified name and properties.
@@ -349,6 +506,14 @@ func (d *Dataset) Snapshots() ([]*Dataset, error) {
 // A full list of available ZFS properties may be found in the ZFS manual:
 // https://openzfs.github.io/openzfs-docs/man/7/zfsprops.7.html.
 func CreateFilesystem(name string, properties map[string]string) (*Dataset, error) {
+	return CreateFilesystemContext(context.Background(), name, properties)
+}
+
+// CreateFilesystemContext is like CreateFilesystem but includes a context.
+func CreateFilesystemContext(ctx context.Context, name string, properties map[string]string) (*Dataset, error) {
+	if err := validateProperties(ctx, properties); err != nil {
+		return nil, err
+	}
 	args := make([]string, 1, 4)
 	args[0] = "create"
 
@@ -357,15 +522,20 @@ func CreateFilesystem(name string, properties map[string]string) (*Dataset, erro
 	}
 
 	args = append(args, name)
-	if err := zfs(args...); err != nil {
+	if err := zfs(ctx, args...); err != nil {
 		return nil, err
 	}
-	return GetDataset(name)
+	return GetDatasetContext(ctx, name)
 }
 
 // Snapshot creates a new ZFS snapshot of the receiving dataset, using the specified name.
 // Optionally, the snapshot can be taken recursively, creating snapshots of all descendent filesystems in a single, atomic operation.
 func (d *Dataset) Snapshot(name string, recursive bool) (*Dataset, error) {
+	return d.SnapshotContext(context.Background(), name, recursive)
+}
+
+// SnapshotContext is like Snapshot but includes a context.
+func (d *Dataset) SnapshotContext(ctx context.Context, name string, recursive bool) (*Dataset, error) {
 	args := make([]string, 1, 4)
 	args[0] = "snapshot"
 	if recursive {
@@ -373,10 +543,62 @@ func (d *Dataset) Snapshot(name string, recursive bool) (*Dataset, error) {
 	}
 	snapName := fmt.Sprintf("%s@%s", d.Name, name)
 	args = append(args, snapName)
-	if err := zfs(args...); err != nil {
+	if err := zfs(ctx, args...); err != nil {
 		return nil, err
 	}
-	return GetDataset(snapName)
+	return GetDatasetContext(ctx, snapName)
+}
+
+// CreateSnapshots creates the given snapshots, e.g. "pool/a@backup" and "pool/b@backup", in a single, atomic operation,
+// with the specified properties, and returns all created snapshots.
+// Optionally, the snapshots can be taken recursively, also creating snapshots of all descendent filesystems.
+func CreateSnapshots(snapshots []string, recursive bool, properties map[string]string) ([]*Dataset, error) {
+	return CreateSnapshotsContext(context.Background(), snapshots, recursive, properties)
+}
+
+// CreateSnapshotsContext is like CreateSnapshots but includes a context.
+func CreateSnapshotsContext(ctx context.Context, snapshots []string, recursive bool, properties map[string]string) ([]*Dataset, error) {
+	if len(snapshots) == 0 {
+		return nil, errors.New("no snapshots to create")
+	}
+	for _, snap := range snapshots {
+		if !strings.Contains(snap, "@") {
+			return nil, fmt.Errorf("invalid snapshot name %q", snap)
+		}
+	}
+	args := []string{"snapshot"}
+	if recursive {
+		args = append(args, "-r")
+	}
+	if properties != nil {
+		args = append(args, propsSlice(properties)...)
+	}
+	if err := zfs(ctx, append(args, snapshots...)...); err != nil {
+		return nil, err
+	}
+
+	var created []*Dataset
+	for _, snap := range snapshots {
+		if !recursive {
+			ds, err := GetDatasetContext(ctx, snap)
+			if err != nil {
+				return nil, err
+			}
+			created = append(created, ds)
+			continue
+		}
+		i := strings.IndexByte(snap, '@')
+		descendents, err := SnapshotsContext(ctx, snap[:i])
+		if err != nil {
+			return nil, err
+		}
+		for _, ds := range descendents {
+			if strings.HasSuffix(ds.Name, snap[i:]) {
+				created = append(created, ds)
+			}
+		}
+	}
+	return created, nil
 }
 
 // Rollback rolls back the receiving ZFS dataset to a previous snapshot.
@@ -384,6 +606,11 @@ func (d *Dataset) Snapshot(name string, recursive bool) (*Dataset, error) {
 // A ZFS snapshot rollback cannot be completed without this option, if more recent snapshots exist.
 // An error will be returned if the input dataset is not of snapshot type.
 func (d *Dataset) Rollback(destroyMoreRecent bool) error {
+	return d.RollbackContext(context.Background(), destroyMoreRecent)
+}
+
+// RollbackContext is like Rollback but includes a context.
+func (d *Dataset) RollbackContext(ctx context.Context, destroyMoreRecent bool) error {
 	if d.Type != DatasetSnapshot {
 		return errors.New("can only rollback snapshots")
 	}
@@ -395,13 +622,19 @@ func (d *Dataset) Rollback(destroyMoreRecent bool) error {
 	}
 	args = append(args, d.Name)
 
-	err := zfs(args...)
+	err := zfs(ctx, args...)
 	return err
 }
 
 // Children returns a slice of children of the receiving ZFS dataset.
 // A recursion depth may be specified, or a depth of 0 allows unlimited recursion.
+// See Parent and Pool to navigate up the hierarchy.
 func (d *Dataset) Children(depth uint64) ([]*Dataset, error) {
+	return d.ChildrenContext(context.Background(), depth)
+}
+
+// ChildrenContext is like Children but includes a context.
+func (d *Dataset) ChildrenContext(ctx context.Context, depth uint64) ([]*Dataset, error) {
 	args := []string{"list"}
 	if depth > 0 {
 		args = append(args, "-d")
@@ -412,7 +645,7 @@ func (d *Dataset) Children(depth uint64) ([]*Dataset, error) {
 	args = append(args, "-t", "all", "-Hp", "-o", dsPropListOptions)
 	args = append(args, d.Name)
 
-	out, err := zfsOutput(args...)
+	out, err := zfsListOutput(ctx, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -430,18 +663,27 @@ func (d *Dataset) Children(depth uint64) ([]*Dataset, error) {
 			return nil, err
 		}
 	}
+	if len(datasets) == 0 {
+		return nil, nil
+	}
 	return datasets[1:], nil
 }
 
 // Diff returns changes between a snapshot and the given ZFS dataset.
 // The snapshot name must include the filesystem part as it is possible to compare clones with their origin snapshots.
+// The given dataset may itself be a later snapshot, in which case the changes between both snapshots are returned.
 func (d *Dataset) Diff(snapshot string) ([]*InodeChange, error) {
-	args := []string{"diff", "-FH", snapshot, d.Name}
-	out, err := zfsOutput(args...)
+	return d.DiffContext(context.Background(), snapshot)
+}
+
+// DiffContext is like Diff but includes a context.
+func (d *Dataset) DiffContext(ctx context.Context, snapshot string) ([]*InodeChange, error) {
+	args := []string{"diff", "-FHt", snapshot, d.Name}
+	out, err := zfsOutput(ctx, args...)
 	if err != nil {
 		return nil, err
 	}
-	inodeChanges, err := parseInodeChanges(out)
+	inodeChanges, err := parseInodeChanges(out, true)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,143 @@
+package zfs
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// CompressionZstdFast is the fast variant of zstd with its default level, zstd-fast-1.
+const CompressionZstdFast CompressionAlgorithm = "zstd-fast"
+
+// CompressionGzipLevel returns gzip compression with the given level, from 1 to 9.
+func CompressionGzipLevel(level int) CompressionAlgorithm {
+	return CompressionAlgorithm("gzip-" + strconv.Itoa(level))
+}
+
+// CompressionZstdLevel returns zstd compression with the given level, from 1 to 19.
+func CompressionZstdLevel(level int) CompressionAlgorithm {
+	return CompressionAlgorithm("zstd-" + strconv.Itoa(level))
+}
+
+// CompressionZstdFastLevel returns zstd compression with the given negative level, from 1 to 10, a multiple of 10
+// up to 100, 500 or 1000.
+func CompressionZstdFastLevel(level int) CompressionAlgorithm {
+	return CompressionAlgorithm("zstd-fast-" + strconv.Itoa(level))
+}
+
+// Validate returns an error if c is not a known value of the compression property, e.g. for a typo or a level
+// which is out of range. The compression of properties passed to the functions which create datasets or set
+// their properties is validated before zfs is run.
+func (c CompressionAlgorithm) Validate() error {
+	switch c {
+	case CompressionOff, CompressionOn, CompressionLZ4, CompressionLZJB, CompressionGzip, CompressionZLE,
+		CompressionZstd, CompressionZstdFast:
+		return nil
+	}
+	s := string(c)
+	valid := false
+	switch {
+	case strings.HasPrefix(s, "zstd-fast-"):
+		level := strings.TrimPrefix(s, "zstd-fast-")
+		n, _ := strconv.Atoi(level)
+		valid = validLevel(level, 10) || validLevel(level, 100) && n%10 == 0 || level == "500" || level == "1000"
+	case strings.HasPrefix(s, "zstd-"):
+		valid = validLevel(strings.TrimPrefix(s, "zstd-"), 19)
+	case strings.HasPrefix(s, "gzip-"):
+		valid = validLevel(strings.TrimPrefix(s, "gzip-"), 9)
+	}
+	if !valid {
+		return fmt.Errorf("invalid compression %q", c)
+	}
+	return nil
+}
+
+func validLevel(s string, max int) bool {
+	level, err := strconv.Atoi(s)
+	return err == nil && level >= 1 && level <= max && strconv.Itoa(level) == s
+}
+
+// Validate returns an error if c is not a known value of the checksum property.
+func (c ChecksumAlgorithm) Validate() error {
+	switch c {
+	case ChecksumOn, ChecksumOff, ChecksumFletcher2, ChecksumFletcher4, ChecksumSHA256, ChecksumSHA512,
+		ChecksumSkein, ChecksumEdonR, ChecksumBLAKE3, ChecksumNoParity:
+		return nil
+	}
+	return fmt.Errorf("invalid checksum %q", c)
+}
+
+// checksumFeatures are the pool features the checksums require and the versions which introduced them, which are
+// checked if the features could not be listed.
+var checksumFeatures = map[ChecksumAlgorithm]struct {
+	feature      string
+	major, minor int
+}{
+	ChecksumSHA512: {"sha512", 0, 7},
+	ChecksumSkein:  {"skein", 0, 7},
+	ChecksumEdonR:  {"edonr", 0, 7},
+	ChecksumBLAKE3: {"blake3", 2, 2},
+}
+
+// validateProperties checks the compression, checksum and block sizes of properties before they are passed to
+// zfs. If capabilities were detected, algorithms which are known not to be supported fail with ErrNotSupported.
+func validateProperties(ctx context.Context, properties map[string]string) error {
+	for _, key := range []string{"recordsize", "volblocksize"} {
+		if value, ok := properties[key]; ok {
+			size, err := parseBlockSize(key, value)
+			if err != nil {
+				return err
+			}
+			warnLargeBlocks(ctx, key, size)
+		}
+	}
+	caps := knownCapabilities(ctx)
+	if value, ok := properties["compression"]; ok {
+		c := CompressionAlgorithm(value)
+		if err := c.Validate(); err != nil {
+			return err
+		}
+		if caps != nil && !caps.Zstd && strings.HasPrefix(value, "zstd") {
+			return fmt.Errorf("compression %s: %w", c, ErrNotSupported)
+		}
+	}
+	if value, ok := properties["checksum"]; ok {
+		c := ChecksumAlgorithm(value)
+		if err := c.Validate(); err != nil {
+			return err
+		}
+		if f, ok := checksumFeatures[c]; ok && caps != nil {
+			supported := caps.Userland.AtLeast(f.major, f.minor, 0)
+			if caps.Features != nil {
+				supported = caps.HasFeature(f.feature)
+			}
+			if !supported {
+				return fmt.Errorf("checksum %s: %w", c, ErrNotSupported)
+			}
+		}
+	}
+	return nil
+}
+
+// SetCompression sets the compression property of the dataset, which applies to data written afterwards.
+// If capabilities were detected, zstd fails with ErrNotSupported before OpenZFS 2.0.
+func (d *Dataset) SetCompression(c CompressionAlgorithm) error {
+	return d.SetCompressionContext(context.Background(), c)
+}
+
+// SetCompressionContext is like SetCompression but includes a context.
+func (d *Dataset) SetCompressionContext(ctx context.Context, c CompressionAlgorithm) error {
+	return d.SetPropertyContext(ctx, "compression", string(c))
+}
+
+// SetChecksum sets the checksum property of the dataset, which applies to data written afterwards.
+// If capabilities were detected, checksums whose pool feature is not supported fail with ErrNotSupported.
+func (d *Dataset) SetChecksum(c ChecksumAlgorithm) error {
+	return d.SetChecksumContext(context.Background(), c)
+}
+
+// SetChecksumContext is like SetChecksum but includes a context.
+func (d *Dataset) SetChecksumContext(ctx context.Context, c ChecksumAlgorithm) error {
+	return d.SetPropertyContext(ctx, "checksum", string(c))
+}
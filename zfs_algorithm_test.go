@@ -0,0 +1,79 @@
+package zfs
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestAlgorithmValidate(t *testing.T) {
+	for _, c := range []CompressionAlgorithm{
+		CompressionLZ4, CompressionZstd, CompressionZstdFast, CompressionGzipLevel(9), CompressionZstdLevel(19),
+		CompressionZstdFastLevel(7), CompressionZstdFastLevel(40), CompressionZstdFastLevel(1000),
+	} {
+		if err := c.Validate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, c := range []CompressionAlgorithm{
+		"", "lz5", "gzip-0", "gzip-10", "zstd-20", "zstd-03", "zstd-fast-0", "zstd-fast-15", "zstd-fast-200", "zstd-x",
+	} {
+		if err := c.Validate(); err == nil {
+			t.Fatalf("expected error for compression %q", c)
+		}
+	}
+	if err := ChecksumBLAKE3.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ChecksumAlgorithm("sha265").Validate(); err == nil {
+		t.Fatal("expected error for checksum sha265")
+	}
+}
+
+func TestSetAlgorithms(t *testing.T) {
+	ctx, r := withFakeRunner("")
+	d := &Dataset{Name: "tank/fs"}
+	if err := d.SetCompressionContext(ctx, CompressionZstdLevel(3)); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetChecksumContext(ctx, ChecksumBLAKE3); err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"zfs", "set", "compression=zstd-3", "tank/fs"},
+		{"zfs", "set", "checksum=blake3", "tank/fs"},
+	}
+	if !reflect.DeepEqual(want, r.calls) {
+		t.Fatalf("want: %q, got: %q", want, r.calls)
+	}
+
+	r.calls = nil
+	if err := d.SetCompressionContext(ctx, "lz5"); err == nil {
+		t.Fatal("expected error for invalid compression")
+	}
+	if _, err := CreateFilesystemContext(ctx, "tank/new", map[string]string{"checksum": "sha-256"}); err == nil {
+		t.Fatal("expected error for invalid checksum")
+	}
+	if err := d.SetPropertiesContext(ctx, map[string]string{"atime": "off", "compression": "gzip-12"}); err == nil {
+		t.Fatal("expected error for invalid compression")
+	}
+	if len(r.calls) != 0 {
+		t.Fatalf("unexpected commands: %q", r.calls)
+	}
+
+	// zstd_compress and sha512 are not among the supported features
+	ctx = WithRunner(context.Background(), capabilitiesRunner("zfs-2.1.5-1\n"))
+	if _, err := DetectCapabilitiesContext(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetCompressionContext(ctx, CompressionZstd); !errors.Is(err, ErrNotSupported) {
+		t.Fatalf("want ErrNotSupported, got: %v", err)
+	}
+	if err := d.SetChecksumContext(ctx, ChecksumSHA512); !errors.Is(err, ErrNotSupported) {
+		t.Fatalf("want ErrNotSupported, got: %v", err)
+	}
+	if err := d.SetChecksumContext(ctx, ChecksumSHA256); err != nil {
+		t.Fatal(err)
+	}
+}
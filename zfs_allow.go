@@ -0,0 +1,338 @@
+package zfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Types of principals permissions are delegated to.
+const (
+	PermissionUser     = "user"
+	PermissionGroup    = "group"
+	PermissionEveryone = "everyone"
+)
+
+// AllowOptions are the options which can be passed to Allow and Unallow.
+//
+// A full description of the options may be found in the ZFS manual:
+// https://openzfs.github.io/openzfs-docs/man/8/zfs-allow.8.html.
+type AllowOptions struct {
+	// Type selects how who is interpreted, as one of the Permission constants (-u, -g or -e).
+	// If empty, who may name users and groups, or be "everyone". With PermissionEveryone who must be empty.
+	Type string
+	// Local delegates the permissions on the dataset only (-l), Descendent on its descendents only (-d).
+	// If neither is set, the permissions are delegated on both.
+	Local      bool
+	Descendent bool
+	// Create delegates the permissions to the creators of descendent datasets (-c), who must be empty.
+	Create bool
+	// Set defines the permission set with this name, e.g. "@backup", instead of delegating (-s), who must be empty.
+	Set string
+	// Recursive removes the permissions from the descendents of the dataset as well, it only applies to Unallow (-r).
+	Recursive bool
+}
+
+func (o *AllowOptions) args(who string, perms []string) ([]string, error) {
+	var args []string
+	if o.Recursive {
+		args = append(args, "-r")
+	}
+	switch {
+	case o.Create:
+		args = append(args, "-c")
+	case o.Set != "":
+		if !strings.HasPrefix(o.Set, "@") {
+			return nil, fmt.Errorf("invalid permission set name %q", o.Set)
+		}
+		args = append(args, "-s", o.Set)
+	}
+	if (o.Create || o.Set != "" || o.Type == PermissionEveryone) && who != "" {
+		return nil, errors.New("permissions of creators, sets and everyone cannot be delegated to a principal")
+	}
+	switch o.Type {
+	case "":
+	case PermissionUser:
+		args = append(args, "-u")
+	case PermissionGroup:
+		args = append(args, "-g")
+	case PermissionEveryone:
+		args = append(args, "-e")
+	default:
+		return nil, fmt.Errorf("invalid permission type %q", o.Type)
+	}
+	if o.Local {
+		args = append(args, "-l")
+	}
+	if o.Descendent {
+		args = append(args, "-d")
+	}
+	if who != "" {
+		args = append(args, who)
+	}
+	if len(perms) > 0 {
+		args = append(args, strings.Join(perms, ","))
+	}
+	return args, nil
+}
+
+// Allow delegates permissions on the dataset, such as "create", "mount", "snapshot" or a permission set like "@backup",
+// to who, a comma separated list of users and groups, as configured by opts.
+func (d *Dataset) Allow(who string, perms []string, opts AllowOptions) error {
+	return d.AllowContext(context.Background(), who, perms, opts)
+}
+
+// AllowContext is like Allow but includes a context.
+func (d *Dataset) AllowContext(ctx context.Context, who string, perms []string, opts AllowOptions) error {
+	if len(perms) == 0 {
+		return errors.New("no permissions to delegate")
+	}
+	if opts.Recursive {
+		return errors.New("permissions cannot be delegated recursively")
+	}
+	args, err := opts.args(who, perms)
+	if err != nil {
+		return err
+	}
+	return zfs(ctx, append(append([]string{"allow"}, args...), d.Name)...)
+}
+
+// Unallow removes permissions on the dataset from who, as configured by opts.
+// All permissions of who are removed if perms is empty.
+func (d *Dataset) Unallow(who string, perms []string, opts AllowOptions) error {
+	return d.UnallowContext(context.Background(), who, perms, opts)
+}
+
+// UnallowContext is like Unallow but includes a context.
+func (d *Dataset) UnallowContext(ctx context.Context, who string, perms []string, opts AllowOptions) error {
+	args, err := opts.args(who, perms)
+	if err != nil {
+		return err
+	}
+	return zfs(ctx, append(append([]string{"unallow"}, args...), d.Name)...)
+}
+
+// DefinePermissionSet defines the permission set name, e.g. "@backup", on the dataset, or adds perms to it if it
+// is already defined. Sets may include other sets, they apply to the dataset and its descendents once delegated
+// with Allow like any other permission.
+func (d *Dataset) DefinePermissionSet(name string, perms []string) error {
+	return d.DefinePermissionSetContext(context.Background(), name, perms)
+}
+
+// DefinePermissionSetContext is like DefinePermissionSet but includes a context.
+func (d *Dataset) DefinePermissionSetContext(ctx context.Context, name string, perms []string) error {
+	if name == "" {
+		return errors.New("no permission set name")
+	}
+	return d.AllowContext(ctx, "", perms, AllowOptions{Set: name})
+}
+
+// RemovePermissionSet removes perms from the permission set name defined on the dataset, or the whole set if
+// perms is empty.
+func (d *Dataset) RemovePermissionSet(name string, perms []string) error {
+	return d.RemovePermissionSetContext(context.Background(), name, perms)
+}
+
+// RemovePermissionSetContext is like RemovePermissionSet but includes a context.
+func (d *Dataset) RemovePermissionSetContext(ctx context.Context, name string, perms []string) error {
+	if name == "" {
+		return errors.New("no permission set name")
+	}
+	return d.UnallowContext(ctx, "", perms, AllowOptions{Set: name})
+}
+
+// DatasetPermissions are the permissions delegated on a dataset, as reported by zfs allow.
+type DatasetPermissions struct {
+	// Dataset is the name of the dataset the permissions were delegated on.
+	Dataset string
+	// Sets holds the permissions of the permission sets defined on the dataset by name, e.g. "@backup".
+	Sets map[string][]string
+	// Create holds the permissions delegated to the creators of descendent datasets.
+	Create []string
+	// Local holds the permissions delegated on the dataset only, Descendent on its descendents only,
+	// and LocalDescendent on both.
+	Local           []Permission
+	Descendent      []Permission
+	LocalDescendent []Permission
+}
+
+// Permission is a set of permissions delegated to a principal.
+type Permission struct {
+	// Type is one of the Permission constants.
+	Type string
+	// Name is the name of the user or group, empty for PermissionEveryone.
+	Name        string
+	Permissions []string
+}
+
+// Permissions returns the permissions delegated on the dataset, followed by those delegated on its ancestors
+// which apply to it.
+func (d *Dataset) Permissions() ([]*DatasetPermissions, error) {
+	return d.PermissionsContext(context.Background())
+}
+
+// PermissionsContext is like Permissions but includes a context.
+func (d *Dataset) PermissionsContext(ctx context.Context) ([]*DatasetPermissions, error) {
+	out, err := zfsRawOutput(ctx, "allow", d.Name)
+	if err != nil {
+		return nil, err
+	}
+	return parsePermissions(string(out))
+}
+
+// example input for parsePermissions
+// ---- Permissions on tank/fs ------------------------------------------
+// Permission sets:
+// 	@backup create,destroy,mount,snapshot
+// Create time permissions:
+// 	destroy,mount
+// Local+Descendent permissions:
+// 	user repl receive,create,mount
+// 	everyone hold
+
+func parsePermissions(out string) ([]*DatasetPermissions, error) {
+	var perms []*DatasetPermissions
+	var current *DatasetPermissions
+	section := ""
+	for _, line := range strings.Split(out, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+			continue
+		case strings.HasPrefix(trimmed, "---- Permissions on "):
+			// the name may contain spaces, it is followed by a space and a line of dashes
+			name := strings.TrimSuffix(strings.TrimRight(strings.TrimPrefix(trimmed, "---- Permissions on "), "-"), " ")
+			if name == "" {
+				return nil, fmt.Errorf("invalid permissions header %q", line)
+			}
+			current = &DatasetPermissions{Dataset: name, Sets: map[string][]string{}}
+			perms = append(perms, current)
+			section = ""
+			continue
+		case current == nil:
+			return nil, fmt.Errorf("unexpected permissions line %q", line)
+		case strings.HasSuffix(trimmed, ":"):
+			section = strings.TrimSuffix(trimmed, ":")
+			continue
+		}
+
+		fields := strings.Fields(trimmed)
+		switch section {
+		case "Permission sets":
+			if len(fields) != 2 {
+				return nil, fmt.Errorf("invalid permission set %q", line)
+			}
+			current.Sets[fields[0]] = strings.Split(fields[1], ",")
+		case "Create time permissions":
+			current.Create = strings.Split(trimmed, ",")
+		case "Local permissions", "Descendent permissions", "Local+Descendent permissions":
+			p, err := parsePermission(fields)
+			if err != nil {
+				return nil, fmt.Errorf("invalid permission %q: %w", line, err)
+			}
+			switch section {
+			case "Local permissions":
+				current.Local = append(current.Local, p)
+			case "Descendent permissions":
+				current.Descendent = append(current.Descendent, p)
+			default:
+				current.LocalDescendent = append(current.LocalDescendent, p)
+			}
+		default:
+			return nil, fmt.Errorf("unexpected permissions line %q", line)
+		}
+	}
+	return perms, nil
+}
+
+func parsePermission(fields []string) (Permission, error) {
+	switch {
+	case len(fields) == 2 && fields[0] == PermissionEveryone:
+		return Permission{Type: PermissionEveryone, Permissions: strings.Split(fields[1], ",")}, nil
+	case len(fields) == 3 && (fields[0] == PermissionUser || fields[0] == PermissionGroup):
+		return Permission{Type: fields[0], Name: fields[1], Permissions: strings.Split(fields[2], ",")}, nil
+	}
+	return Permission{}, errors.New("unknown principal")
+}
+
+// EffectivePermissions returns the permissions user, a member of groups, has on the dataset in order of their
+// names. These are the permissions delegated to the user, one of the groups or everyone, locally on the dataset
+// or on its ancestors for their descendents, with permission sets expanded. Sets are resolved like zfs does, from
+// the dataset they are delegated on upwards. Create time permissions are not included as they depend on who
+// created the dataset, nor are the permissions root has without any delegation.
+func (d *Dataset) EffectivePermissions(user string, groups []string) ([]string, error) {
+	return d.EffectivePermissionsContext(context.Background(), user, groups)
+}
+
+// EffectivePermissionsContext is like EffectivePermissions but includes a context.
+func (d *Dataset) EffectivePermissionsContext(ctx context.Context, user string, groups []string) ([]string, error) {
+	perms, err := d.PermissionsContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return effectivePermissions(d.Name, perms, user, groups), nil
+}
+
+// effectivePermissions resolves the permissions of user on dataset from perms, which are ordered from the dataset
+// to its ancestors as returned by Permissions.
+func effectivePermissions(dataset string, perms []*DatasetPermissions, user string, groups []string) []string {
+	applies := func(p Permission) bool {
+		switch p.Type {
+		case PermissionEveryone:
+			return true
+		case PermissionUser:
+			return p.Name == user
+		case PermissionGroup:
+			for _, g := range groups {
+				if p.Name == g {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	granted := map[string]bool{}
+	var expand func(names []string, from int, seen map[string]bool)
+	expand = func(names []string, from int, seen map[string]bool) {
+		for _, name := range names {
+			if !strings.HasPrefix(name, "@") {
+				granted[name] = true
+				continue
+			}
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			for i := from; i < len(perms); i++ {
+				if set, ok := perms[i].Sets[name]; ok {
+					expand(set, i, seen)
+					break
+				}
+			}
+		}
+	}
+
+	for i, dp := range perms {
+		entries := dp.LocalDescendent
+		if dp.Dataset == dataset {
+			entries = append(entries[:len(entries):len(entries)], dp.Local...)
+		} else {
+			entries = append(entries[:len(entries):len(entries)], dp.Descendent...)
+		}
+		for _, p := range entries {
+			if applies(p) {
+				expand(p.Permissions, i, map[string]bool{})
+			}
+		}
+	}
+
+	names := make([]string, 0, len(granted))
+	for name := range granted {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,172 @@
+package zfs
+
+import (
+	"reflect"
+	"testing"
+)
+
+const allowOutput = `---- Permissions on tank/fs ------------------------------------------
+Permission sets:
+	@backup create,destroy,mount,snapshot
+Create time permissions:
+	destroy,mount
+Local permissions:
+	user bob create,mount
+	group staff snapshot
+Descendent permissions:
+	user alice send
+---- Permissions on tank ---------------------------------------------
+Local+Descendent permissions:
+	user repl receive,create,mount
+	everyone hold
+`
+
+func TestParsePermissions(t *testing.T) {
+	perms, err := parsePermissions(allowOutput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*DatasetPermissions{
+		{
+			Dataset:    "tank/fs",
+			Sets:       map[string][]string{"@backup": {"create", "destroy", "mount", "snapshot"}},
+			Create:     []string{"destroy", "mount"},
+			Local:      []Permission{{Type: PermissionUser, Name: "bob", Permissions: []string{"create", "mount"}}, {Type: PermissionGroup, Name: "staff", Permissions: []string{"snapshot"}}},
+			Descendent: []Permission{{Type: PermissionUser, Name: "alice", Permissions: []string{"send"}}},
+		},
+		{
+			Dataset: "tank",
+			Sets:    map[string][]string{},
+			LocalDescendent: []Permission{
+				{Type: PermissionUser, Name: "repl", Permissions: []string{"receive", "create", "mount"}},
+				{Type: PermissionEveryone, Permissions: []string{"hold"}},
+			},
+		},
+	}
+	if !reflect.DeepEqual(want, perms) {
+		t.Fatalf("want: %+v, got: %+v", want, perms)
+	}
+
+	if perms, err := parsePermissions(""); err != nil || len(perms) != 0 {
+		t.Fatalf("want no permissions, got: %+v, %v", perms, err)
+	}
+	perms, err = parsePermissions("---- Permissions on tank/my data- -------\nLocal permissions:\n\tuser bob mount\n")
+	if err != nil || len(perms) != 1 || perms[0].Dataset != "tank/my data-" {
+		t.Fatalf("want permissions of tank/my data-, got: %+v, %v", perms, err)
+	}
+	if _, err := parsePermissions("Local permissions:\n\tuser bob mount\n"); err == nil {
+		t.Fatal("expected error for permissions without dataset")
+	}
+}
+
+func TestAllow(t *testing.T) {
+	ctx, r := withFakeRunner("")
+	d := &Dataset{Name: "tank/fs"}
+	for _, call := range []func() error{
+		func() error {
+			return d.AllowContext(ctx, "repl", []string{"receive", "mount"}, AllowOptions{Type: PermissionUser, Local: true})
+		},
+		func() error { return d.AllowContext(ctx, "", []string{"destroy"}, AllowOptions{Create: true}) },
+		func() error { return d.AllowContext(ctx, "", []string{"send", "hold"}, AllowOptions{Set: "@backup"}) },
+		func() error { return d.UnallowContext(ctx, "repl", nil, AllowOptions{Recursive: true}) },
+	} {
+		if err := call(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := [][]string{
+		{"zfs", "allow", "-u", "-l", "repl", "receive,mount", "tank/fs"},
+		{"zfs", "allow", "-c", "destroy", "tank/fs"},
+		{"zfs", "allow", "-s", "@backup", "send,hold", "tank/fs"},
+		{"zfs", "unallow", "-r", "repl", "tank/fs"},
+	}
+	if !reflect.DeepEqual(want, r.calls) {
+		t.Fatalf("want calls: %q, got: %q", want, r.calls)
+	}
+
+	for _, opts := range []AllowOptions{{Set: "backup"}, {Create: true}, {Type: PermissionEveryone}, {Type: "nobody"}, {Recursive: true}} {
+		if err := d.AllowContext(ctx, "bob", []string{"mount"}, opts); err == nil {
+			t.Fatalf("expected error allowing with %+v", opts)
+		}
+	}
+	if err := d.AllowContext(ctx, "bob", nil, AllowOptions{}); err == nil {
+		t.Fatal("expected error allowing no permissions")
+	}
+}
+
+const allowSetsOutput = `---- Permissions on tank/fs/home ------------------------------------
+Permission sets:
+	@backup @snap,send
+	@loop @loop,@backup
+Local permissions:
+	user bob @loop
+---- Permissions on tank/fs ------------------------------------------
+Local permissions:
+	user carol destroy
+Descendent permissions:
+	group staff @backup
+---- Permissions on tank ---------------------------------------------
+Permission sets:
+	@backup destroy
+	@snap snapshot,hold
+Local+Descendent permissions:
+	everyone mount
+`
+
+func TestEffectivePermissions(t *testing.T) {
+	perms, err := parsePermissions(allowSetsOutput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		dataset, user string
+		groups        []string
+		want          []string
+	}{
+		// sets are resolved from the dataset they are delegated on, nested sets from where they are defined upwards
+		{"tank/fs/home", "bob", nil, []string{"hold", "mount", "send", "snapshot"}},
+		{"tank/fs/home", "alice", []string{"staff"}, []string{"destroy", "mount"}},
+		{"tank/fs/home", "carol", nil, []string{"mount"}},
+		{"tank/fs", "carol", []string{"staff"}, []string{"destroy", "mount"}},
+	} {
+		got := effectivePermissions(test.dataset, perms, test.user, test.groups)
+		if !reflect.DeepEqual(test.want, got) {
+			t.Fatalf("%s of %s: want: %q, got: %q", test.user, test.dataset, test.want, got)
+		}
+	}
+
+	ctx, r := withFakeRunner(allowSetsOutput)
+	got, err := (&Dataset{Name: "tank/fs/home"}).EffectivePermissionsContext(ctx, "bob", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"hold", "mount", "send", "snapshot"}; !reflect.DeepEqual(want, got) {
+		t.Fatalf("want: %q, got: %q", want, got)
+	}
+	if want := [][]string{{"zfs", "allow", "tank/fs/home"}}; !reflect.DeepEqual(want, r.calls) {
+		t.Fatalf("want calls: %q, got: %q", want, r.calls)
+	}
+}
+
+func TestPermissionSets(t *testing.T) {
+	ctx, r := withFakeRunner("")
+	d := &Dataset{Name: "tank"}
+	if err := d.DefinePermissionSetContext(ctx, "@backup", []string{"send", "@snap"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.RemovePermissionSetContext(ctx, "@backup", nil); err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"zfs", "allow", "-s", "@backup", "send,@snap", "tank"},
+		{"zfs", "unallow", "-s", "@backup", "tank"},
+	}
+	if !reflect.DeepEqual(want, r.calls) {
+		t.Fatalf("want calls: %q, got: %q", want, r.calls)
+	}
+	for _, name := range []string{"", "backup"} {
+		if err := d.DefinePermissionSetContext(ctx, name, []string{"send"}); err == nil {
+			t.Fatalf("expected error defining set %q", name)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package zfs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"syscall"
+)
+
+// batchBytes limits the length of the snapshot names passed to a single invocation of zfs,
+// staying well below the limits of the kernel on the length of a single argument and of all arguments.
+const batchBytes = 64 << 10
+
+// destroySnapshotsScript is a channel program destroying the snapshots passed as its arguments,
+// it returns the error codes of those which could not be destroyed by name.
+const destroySnapshotsScript = `local args = ...
+local ENOENT = 2
+local failed = {}
+for _, snap in ipairs(args["argv"]) do
+	local err = zfs.sync.destroy(snap)
+	if err ~= 0 and err ~= ENOENT then
+		failed[snap] = err
+	end
+end
+return failed
+`
+
+// DestroySnapshotsBatch destroys the given snapshots, which may belong to any filesystems and volumes,
+// with as few invocations of zfs as possible.
+//
+// The snapshots of each pool are destroyed by a channel program run with zfs program in batches.
+// If channel programs cannot be run, e.g. because zfs does not support them or the caller is not root,
+// the snapshots of each filesystem are destroyed with a single zfs destroy fs@a,b,c instead.
+// Snapshots which do not exist are ignored. If some snapshots cannot be destroyed, e.g. because they are held,
+// the others may have been destroyed anyway.
+func DestroySnapshotsBatch(names []string) error {
+	return DestroySnapshotsBatchContext(context.Background(), names)
+}
+
+// DestroySnapshotsBatchContext is like DestroySnapshotsBatch but includes a context.
+func DestroySnapshotsBatchContext(ctx context.Context, names []string) error {
+	var pools []string
+	byPool := map[string][]string{}
+	for _, name := range names {
+		if !strings.Contains(name, "@") || strings.ContainsAny(name, "%,") {
+			return fmt.Errorf("invalid snapshot name %q", name)
+		}
+		pool := strings.SplitN(strings.SplitN(name, "@", 2)[0], "/", 2)[0]
+		if byPool[pool] == nil {
+			pools = append(pools, pool)
+		}
+		byPool[pool] = append(byPool[pool], name)
+	}
+
+	for _, pool := range pools {
+		for _, batch := range batches(byPool[pool]) {
+			var zfsErr *Error
+			switch err := destroySnapshotsProgram(ctx, pool, batch); {
+			case err == nil:
+			case errors.As(err, &zfsErr) && ctx.Err() == nil:
+				// the channel program could not be run at all
+				if err := destroySnapshotsByFilesystem(ctx, batch); err != nil {
+					return err
+				}
+			default:
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// batches splits names into batches whose total length, counting a separator between names, does not exceed batchBytes.
+func batches(names []string) [][]string {
+	var all [][]string
+	start, size := 0, 0
+	for i, name := range names {
+		if i > start && size+1+len(name) > batchBytes {
+			all = append(all, names[start:i])
+			start, size = i, 0
+		}
+		if i > start {
+			size++
+		}
+		size += len(name)
+	}
+	if start < len(names) {
+		all = append(all, names[start:])
+	}
+	return all
+}
+
+func destroySnapshotsProgram(ctx context.Context, pool string, snapshots []string) error {
+	var stdout bytes.Buffer
+	c := command{Command: "zfs", Stdin: strings.NewReader(destroySnapshotsScript), Stdout: &stdout}
+	args := append([]string{"program", "-j", pool, "-"}, snapshots...)
+	if _, err := c.Run(ctx, args...); err != nil {
+		return err
+	}
+	// the program was skipped in dry-run mode
+	if stdout.Len() == 0 && dryRunFromContext(ctx) {
+		return nil
+	}
+
+	var out struct {
+		Return map[string]int64 `json:"return"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &out); err != nil {
+		return fmt.Errorf("invalid channel program output: %w", err)
+	}
+	if len(out.Return) == 0 {
+		return nil
+	}
+	failed := make([]string, 0, len(out.Return))
+	for name := range out.Return {
+		failed = append(failed, name)
+	}
+	sort.Strings(failed)
+	err := fmt.Errorf("cannot destroy snapshot %s: %w", failed[0], syscall.Errno(out.Return[failed[0]]))
+	if len(failed) > 1 {
+		others := make([]string, len(failed)-1)
+		for i, name := range failed[1:] {
+			others[i] = fmt.Sprintf("%s: %s", name, syscall.Errno(out.Return[name]))
+		}
+		err = fmt.Errorf("%w; also %s", err, strings.Join(others, ", "))
+	}
+	return err
+}
+
+// destroySnapshotsByFilesystem destroys snapshots with one zfs destroy fs@a,b,c per filesystem and batch.
+func destroySnapshotsByFilesystem(ctx context.Context, snapshots []string) error {
+	var filesystems []string
+	byFilesystem := map[string][]string{}
+	for _, name := range snapshots {
+		parts := strings.SplitN(name, "@", 2)
+		if byFilesystem[parts[0]] == nil {
+			filesystems = append(filesystems, parts[0])
+		}
+		byFilesystem[parts[0]] = append(byFilesystem[parts[0]], parts[1])
+	}
+	for _, fs := range filesystems {
+		for _, batch := range batches(byFilesystem[fs]) {
+			err := zfs(ctx, "destroy", fs+"@"+strings.Join(batch, ","))
+			if err != nil && !errors.Is(err, ErrDatasetNotFound) {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package zfs
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestDestroySnapshotsBatch(t *testing.T) {
+	r := &fakeStreamRunner{fakeRunner: fakeRunner{output: func([]string) (string, error) {
+		return `{"return": {}}`, nil
+	}}}
+	ctx := WithRunner(context.Background(), r)
+	if err := DestroySnapshotsBatchContext(ctx, []string{"tank/a@1", "tank/b@1", "other@1"}); err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"zfs", "program", "-j", "tank", "-", "tank/a@1", "tank/b@1"},
+		{"zfs", "program", "-j", "other", "-", "other@1"},
+	}
+	if !reflect.DeepEqual(want, r.calls) {
+		t.Fatalf("want calls: %q, got: %q", want, r.calls)
+	}
+	if !strings.Contains(string(r.stdin), "zfs.sync.destroy") {
+		t.Fatalf("unexpected channel program: %q", r.stdin)
+	}
+
+	if err := DestroySnapshotsBatchContext(ctx, []string{"tank/a"}); err == nil {
+		t.Fatal("expected error for a name which is not a snapshot")
+	}
+}
+
+func TestDestroySnapshotsBatchDryRun(t *testing.T) {
+	var records []*CommandRecord
+	SetAuditHook(func(rec *CommandRecord) {
+		records = append(records, rec)
+	})
+	defer SetAuditHook(nil)
+
+	r := &fakeStreamRunner{}
+	ctx := WithDryRun(WithRunner(context.Background(), r), true)
+	if err := DestroySnapshotsBatchContext(ctx, []string{"tank/a@1", "tank/b@1"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.calls) != 0 {
+		t.Fatalf("expected no commands to run, got: %q", r.calls)
+	}
+	if len(records) != 1 || !records[0].DryRun || records[0].Args[0] != "program" {
+		t.Fatalf("unexpected records %+v", records)
+	}
+}
+
+func TestDestroySnapshotsBatchFailures(t *testing.T) {
+	r := &fakeStreamRunner{fakeRunner: fakeRunner{output: func([]string) (string, error) {
+		return `{"return": {"tank/a@2": 16, "tank/a@1": 16}}`, nil
+	}}}
+	ctx := WithRunner(context.Background(), r)
+	err := DestroySnapshotsBatchContext(ctx, []string{"tank/a@1", "tank/a@2", "tank/a@3"})
+	if !errors.Is(err, syscall.EBUSY) {
+		t.Fatalf("expected EBUSY, got: %v", err)
+	}
+	if !strings.Contains(err.Error(), "tank/a@1") || !strings.Contains(err.Error(), "tank/a@2") {
+		t.Fatalf("expected both failed snapshots in error, got: %v", err)
+	}
+}
+
+func TestDestroySnapshotsBatchFallback(t *testing.T) {
+	r := &fakeStreamRunner{fakeRunner: fakeRunner{output: func(args []string) (string, error) {
+		if args[1] == "program" {
+			return "", errors.New("unrecognized command 'program'")
+		}
+		return "", nil
+	}}}
+	ctx := WithRunner(context.Background(), r)
+	if err := DestroySnapshotsBatchContext(ctx, []string{"tank/a@1", "tank/b@1", "tank/a@2"}); err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"zfs", "program", "-j", "tank", "-", "tank/a@1", "tank/b@1", "tank/a@2"},
+		{"zfs", "destroy", "tank/a@1,2"},
+		{"zfs", "destroy", "tank/b@1"},
+	}
+	if !reflect.DeepEqual(want, r.calls) {
+		t.Fatalf("want calls: %q, got: %q", want, r.calls)
+	}
+}
+
+func TestBatches(t *testing.T) {
+	name := strings.Repeat("x", batchBytes/4)
+	got := batches([]string{name, name, name, name, name})
+	if len(got) != 2 || len(got[0]) != 3 || len(got[1]) != 2 {
+		t.Fatalf("unexpected batch sizes: %d", len(got))
+	}
+}
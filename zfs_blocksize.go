@@ -0,0 +1,129 @@
+package zfs
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// minBlockSize is the smallest recordsize and volblocksize.
+	minBlockSize = 512
+	// maxBlockSize is the largest recordsize and volblocksize.
+	maxBlockSize = 16 << 20
+	// largeBlockSize is the largest block size without the large_blocks pool feature.
+	largeBlockSize = 128 << 10
+	// maxRecordSize is the default of the zfs_max_recordsize module parameter before OpenZFS 2.2, which limits
+	// larger block sizes.
+	maxRecordSize = 1 << 20
+)
+
+// ValidateRecordSize returns an error if size is not a valid recordsize: a power of two from 512 bytes to 16M.
+// Sizes above 128K require the large_blocks pool feature, and sizes above 1M a raised zfs_max_recordsize module
+// parameter before OpenZFS 2.2.
+func ValidateRecordSize(size uint64) error {
+	return validateBlockSize("recordsize", size)
+}
+
+// ValidateVolBlockSize returns an error if size is not a valid volblocksize: a power of two from 512 bytes to 16M.
+// Sizes above 128K require the large_blocks pool feature, and sizes above 1M a raised zfs_max_recordsize module
+// parameter before OpenZFS 2.2.
+func ValidateVolBlockSize(size uint64) error {
+	return validateBlockSize("volblocksize", size)
+}
+
+func validateBlockSize(property string, size uint64) error {
+	if size < minBlockSize || size > maxBlockSize || size&(size-1) != 0 {
+		return fmt.Errorf("invalid %s %d: must be a power of 2 from 512 to 16M", property, size)
+	}
+	return nil
+}
+
+// parseBlockSize parses a block size as accepted by zfs, in bytes or with a suffix such as 128K, 128k or 128KiB.
+func parseBlockSize(property, value string) (uint64, error) {
+	s := strings.ToUpper(value)
+	if t := strings.TrimSuffix(s, "IB"); t != s {
+		s = t
+	} else if len(s) > 1 && strings.HasSuffix(s, "B") && strings.IndexByte("KMGTPE", s[len(s)-2]) >= 0 {
+		s = s[:len(s)-1]
+	}
+	size, err := parseHumanSize(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q", property, value)
+	}
+	return size, validateBlockSize(property, size)
+}
+
+// warnLargeBlocks logs a warning for block sizes zfs may reject: above 128K if the large_blocks feature is known to
+// be missing, and above 1M unless OpenZFS 2.2 is known to be running, before which zfs_max_recordsize limits them.
+func warnLargeBlocks(ctx context.Context, property string, size uint64) {
+	if size <= largeBlockSize {
+		return
+	}
+	var msg string
+	caps := knownCapabilities(ctx)
+	switch {
+	case caps != nil && caps.Features != nil && !caps.HasFeature("large_blocks"):
+		msg = "block size above 128K without the large_blocks feature"
+	case size > maxRecordSize && (caps == nil || !caps.Userland.AtLeast(2, 2, 0)):
+		msg = "block size above 1M may exceed zfs_max_recordsize"
+	default:
+		return
+	}
+	l := loggerFromContext(ctx)
+	if l == nil || !l.Enabled(ctx, LevelWarn) {
+		return
+	}
+	l.LogFields(ctx, LevelWarn, msg, []Field{
+		{"property", property},
+		{"size", size},
+	})
+}
+
+// RecordSize returns the recordsize of the filesystem in bytes, the largest block size of files written
+// afterwards, which may be inherited.
+func (d *Dataset) RecordSize() (uint64, error) {
+	return d.RecordSizeContext(context.Background())
+}
+
+// RecordSizeContext is like RecordSize but includes a context.
+func (d *Dataset) RecordSizeContext(ctx context.Context) (uint64, error) {
+	return d.uintProperty(ctx, "recordsize")
+}
+
+// SetRecordSize sets the recordsize of the filesystem in bytes, see ValidateRecordSize. Only files written
+// afterwards use it.
+func (d *Dataset) SetRecordSize(size uint64) error {
+	return d.SetRecordSizeContext(context.Background(), size)
+}
+
+// SetRecordSizeContext is like SetRecordSize but includes a context.
+func (d *Dataset) SetRecordSizeContext(ctx context.Context, size uint64) error {
+	return d.SetPropertyContext(ctx, "recordsize", strconv.FormatUint(size, 10))
+}
+
+// VolBlockSize returns the block size of the volume in bytes, which is set when it is created.
+func (d *Dataset) VolBlockSize() (uint64, error) {
+	return d.VolBlockSizeContext(context.Background())
+}
+
+// VolBlockSizeContext is like VolBlockSize but includes a context.
+func (d *Dataset) VolBlockSizeContext(ctx context.Context) (uint64, error) {
+	return d.uintProperty(ctx, "volblocksize")
+}
+
+func (d *Dataset) uintProperty(ctx context.Context, property string) (uint64, error) {
+	out, err := zfsOutput(ctx, "get", "-Hp", "-o", "value", property, d.Name)
+	if err != nil {
+		return 0, err
+	}
+	if len(out) != 1 || len(out[0]) != 1 {
+		return 0, fmt.Errorf("unexpected %s of %s: %q", property, d.Name, out)
+	}
+	var v uint64
+	if err := setUint(&v, out[0][0]); err != nil {
+		return 0, fmt.Errorf("invalid %s of %s: %w", property, d.Name, err)
+	}
+	return v, nil
+}
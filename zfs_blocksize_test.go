@@ -0,0 +1,102 @@
+package zfs
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateBlockSize(t *testing.T) {
+	for _, size := range []uint64{512, 128 << 10, 16 << 20} {
+		if err := ValidateRecordSize(size); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, size := range []uint64{0, 256, 3000, 32 << 20} {
+		if err := ValidateVolBlockSize(size); err == nil {
+			t.Fatalf("expected error for size %d", size)
+		}
+	}
+	for value, want := range map[string]uint64{"131072": 128 << 10, "128K": 128 << 10, "128k": 128 << 10, "128KiB": 128 << 10, "1MB": 1 << 20, "512B": 512} {
+		got, err := parseBlockSize("recordsize", value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Fatalf("%s: want: %d, got: %d", value, want, got)
+		}
+	}
+	for _, value := range []string{"", "128", "1.5M", "big", "32M"} {
+		if _, err := parseBlockSize("recordsize", value); err == nil {
+			t.Fatalf("expected error for %q", value)
+		}
+	}
+}
+
+func TestRecordSize(t *testing.T) {
+	l := &recordingLogger{min: LevelWarn}
+	r := &fakeRunner{output: func(args []string) (string, error) {
+		if args[1] == "get" {
+			return "1048576\n", nil
+		}
+		return "", nil
+	}}
+	ctx := WithLogger(WithRunner(context.Background(), r), l)
+	d := &Dataset{Name: "tank/fs"}
+	size, err := d.RecordSizeContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != 1<<20 {
+		t.Fatalf("unexpected recordsize %d", size)
+	}
+	if err := d.SetRecordSizeContext(ctx, 1<<20); err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"zfs", "get", "-Hp", "-o", "value", "recordsize", "tank/fs"},
+		{"zfs", "set", "recordsize=1048576", "tank/fs"},
+	}
+	if !reflect.DeepEqual(want, r.calls) {
+		t.Fatalf("want: %q, got: %q", want, r.calls)
+	}
+	if len(l.messages) != 0 {
+		t.Fatalf("unexpected warnings: %q", l.messages)
+	}
+
+	if err := d.SetRecordSizeContext(ctx, 100000); err == nil {
+		t.Fatal("expected error for recordsize which is not a power of 2")
+	}
+	if _, err := CreateFilesystemContext(ctx, "tank/new", map[string]string{"recordsize": "4M"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(l.messages) != 1 || l.fields[0]["property"] != "recordsize" || l.fields[0]["size"] != uint64(4<<20) {
+		t.Fatalf("expected warning for large blocks, got: %q %v", l.messages, l.fields)
+	}
+	if _, err := CreateVolumeWithOptionsContext(ctx, "tank/vol", 1<<30, CreateVolumeOptions{VolBlockSize: 2 << 20}); err != nil {
+		t.Fatal(err)
+	}
+	if len(l.messages) != 2 || l.fields[1]["property"] != "volblocksize" {
+		t.Fatalf("expected warning for large blocks, got: %q %v", l.messages, l.fields)
+	}
+
+	// large_blocks is not among the supported features
+	l = &recordingLogger{min: LevelWarn}
+	ctx = WithLogger(WithRunner(context.Background(), capabilitiesRunner("zfs-2.1.5-1\n")), l)
+	if _, err := DetectCapabilitiesContext(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetRecordSizeContext(ctx, 128<<10); err != nil {
+		t.Fatal(err)
+	}
+	if len(l.messages) != 0 {
+		t.Fatalf("unexpected warnings: %q", l.messages)
+	}
+	if err := d.SetRecordSizeContext(ctx, 256<<10); err != nil {
+		t.Fatal(err)
+	}
+	if len(l.messages) != 1 || !strings.Contains(l.messages[0], "128K") {
+		t.Fatalf("expected warning for the missing large_blocks feature, got: %q", l.messages)
+	}
+}
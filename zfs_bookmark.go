@@ -0,0 +1,53 @@
+package zfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Bookmark creates a bookmark of the receiving snapshot, using the specified name.
+// A bookmark records the point in time of a snapshot so it can still be used as the incremental source
+// of a send (see SendOptions.From) after the snapshot itself has been destroyed.
+// An error will be returned if the input dataset is not of snapshot type.
+func (d *Dataset) Bookmark(name string) (*Dataset, error) {
+	return d.BookmarkContext(context.Background(), name)
+}
+
+// BookmarkContext is like Bookmark but includes a context.
+func (d *Dataset) BookmarkContext(ctx context.Context, name string) (*Dataset, error) {
+	if d.Type != DatasetSnapshot {
+		return nil, errors.New("can only bookmark snapshots")
+	}
+	i := strings.IndexByte(d.Name, '@')
+	if i < 0 {
+		return nil, fmt.Errorf("invalid snapshot name %q", d.Name)
+	}
+	bookmarkName := fmt.Sprintf("%s#%s", d.Name[:i], name)
+	if err := zfs(ctx, "bookmark", d.Name, bookmarkName); err != nil {
+		return nil, err
+	}
+	return GetDatasetContext(ctx, bookmarkName)
+}
+
+// ListBookmarks returns a slice of ZFS bookmarks.
+// A filter argument may be passed to select bookmarks of the matching dataset, or empty string ("") may be used to select all bookmarks.
+func ListBookmarks(filter string) ([]*Dataset, error) {
+	return ListBookmarksContext(context.Background(), filter)
+}
+
+// ListBookmarksContext is like ListBookmarks but includes a context.
+func ListBookmarksContext(ctx context.Context, filter string) ([]*Dataset, error) {
+	return listByType(ctx, DatasetBookmark, filter)
+}
+
+// Bookmarks returns a slice of all ZFS bookmarks of a given dataset.
+func (d *Dataset) Bookmarks() ([]*Dataset, error) {
+	return d.BookmarksContext(context.Background())
+}
+
+// BookmarksContext is like Bookmarks but includes a context.
+func (d *Dataset) BookmarksContext(ctx context.Context) ([]*Dataset, error) {
+	return ListBookmarksContext(ctx, d.Name)
+}
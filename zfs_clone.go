@@ -0,0 +1,114 @@
+package zfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Promote promotes the clone, so that it no longer depends on its origin snapshot.
+// The snapshots of the origin filesystem up to the origin snapshot move to the clone,
+// and the origin filesystem becomes a clone of the clone's snapshot instead.
+func (d *Dataset) Promote() (*Dataset, error) {
+	return d.PromoteContext(context.Background())
+}
+
+// PromoteContext is like Promote but includes a context.
+func (d *Dataset) PromoteContext(ctx context.Context) (*Dataset, error) {
+	if d.Type == DatasetSnapshot {
+		return nil, errors.New("cannot promote snapshots")
+	}
+	if err := zfs(ctx, "promote", d.Name); err != nil {
+		return nil, err
+	}
+	return GetDatasetContext(ctx, d.Name)
+}
+
+// OriginGraph holds the dependencies between the filesystems, volumes and snapshots of a pool,
+// which determine the order they can be destroyed in: children depend on their parent,
+// snapshots on their filesystem or volume, and clones on their origin snapshot.
+type OriginGraph struct {
+	// Origins maps the name of each clone to the name of its origin snapshot.
+	Origins map[string]string
+
+	// dependents maps the name of each dataset to those which depend on it directly, in listing order.
+	dependents map[string][]string
+	exists     map[string]bool
+}
+
+// GetOriginGraph returns the origin graph of the datasets in the given pool, or below the given dataset.
+func GetOriginGraph(name string) (*OriginGraph, error) {
+	return GetOriginGraphContext(context.Background(), name)
+}
+
+// GetOriginGraphContext is like GetOriginGraph but includes a context.
+func GetOriginGraphContext(ctx context.Context, name string) (*OriginGraph, error) {
+	out, err := zfsListOutput(ctx, "list", "-rHp", "-t", "filesystem,volume,snapshot", "-o", "name,origin", name)
+	if err != nil {
+		return nil, err
+	}
+	return parseOriginGraph(out)
+}
+
+// example input for parseOriginGraph
+// tank	-
+// tank/base	-
+// tank/base@golden	-
+// tank/vm1	tank/base@golden
+
+func parseOriginGraph(out [][]string) (*OriginGraph, error) {
+	g := &OriginGraph{Origins: map[string]string{}, dependents: map[string][]string{}, exists: map[string]bool{}}
+	for _, line := range out {
+		if len(line) != 2 {
+			return nil, fmt.Errorf("invalid origin %q", strings.Join(line, "\t"))
+		}
+		name, origin := line[0], line[1]
+		g.exists[name] = true
+		if i := strings.IndexByte(name, '@'); i >= 0 {
+			g.dependents[name[:i]] = append(g.dependents[name[:i]], name)
+		} else if i := strings.LastIndexByte(name, '/'); i >= 0 {
+			g.dependents[name[:i]] = append(g.dependents[name[:i]], name)
+		}
+		if origin != "" && origin != "-" {
+			g.Origins[name] = origin
+			g.dependents[origin] = append(g.dependents[origin], name)
+		}
+	}
+	return g, nil
+}
+
+// Clones returns the names of the clones of the given snapshot.
+func (g *OriginGraph) Clones(snapshot string) []string {
+	var clones []string
+	for _, name := range g.dependents[snapshot] {
+		if g.Origins[name] == snapshot {
+			clones = append(clones, name)
+		}
+	}
+	return clones
+}
+
+// DestroyOrder returns the given dataset and all datasets which depend on it, directly or through other datasets,
+// in an order in which destroying them one at a time never fails due to remaining dependents.
+// This is the set of datasets zfs destroy -R removes. The given dataset comes last, nil is returned if it is unknown.
+func (g *OriginGraph) DestroyOrder(name string) []string {
+	if !g.exists[name] {
+		return nil
+	}
+	var order []string
+	visited := map[string]bool{}
+	var visit func(string)
+	visit = func(n string) {
+		if visited[n] {
+			return
+		}
+		visited[n] = true
+		for _, d := range g.dependents[n] {
+			visit(d)
+		}
+		order = append(order, n)
+	}
+	visit(name)
+	return order
+}
@@ -0,0 +1,32 @@
+package zfs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestOriginGraph(t *testing.T) {
+	ctx, r := withFakeRunner("tank\t-\ntank/base\t-\ntank/base@golden\t-\ntank/base/data\t-\ntank/vm1\ttank/base@golden\ntank/vm1@snap\t-\ntank/vm2\ttank/vm1@snap\ntank/other\t-\n")
+	g, err := GetOriginGraphContext(ctx, "tank")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the first call may probe for JSON support
+	if want := []string{"zfs", "list", "-rHp", "-t", "filesystem,volume,snapshot", "-o", "name,origin", "tank"}; !reflect.DeepEqual(want, r.calls[len(r.calls)-1]) {
+		t.Fatalf("want call: %q, got: %q", want, r.calls)
+	}
+	if want := map[string]string{"tank/vm1": "tank/base@golden", "tank/vm2": "tank/vm1@snap"}; !reflect.DeepEqual(want, g.Origins) {
+		t.Fatalf("want origins: %v, got: %v", want, g.Origins)
+	}
+	if want := []string{"tank/vm1"}; !reflect.DeepEqual(want, g.Clones("tank/base@golden")) {
+		t.Fatalf("want clones: %q, got: %q", want, g.Clones("tank/base@golden"))
+	}
+
+	want := []string{"tank/vm2", "tank/vm1@snap", "tank/vm1", "tank/base@golden", "tank/base/data", "tank/base"}
+	if got := g.DestroyOrder("tank/base"); !reflect.DeepEqual(want, got) {
+		t.Fatalf("want destroy order: %q, got: %q", want, got)
+	}
+	if got := g.DestroyOrder("tank/missing"); got != nil {
+		t.Fatalf("expected no destroy order for a missing dataset, got: %q", got)
+	}
+}
@@ -0,0 +1,102 @@
+package zfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// DestroyPreview lists what destroying a dataset destroys, as reported by zfs destroy -nvp.
+type DestroyPreview struct {
+	// Datasets holds the names of the datasets which would be destroyed, in order.
+	// Held snapshots only marked for deferred destruction with DestroyDeferDeletion are not included.
+	Datasets []string
+	// Reclaimed is the space in bytes which would be freed, it is only reported when destroying snapshots.
+	Reclaimed uint64
+}
+
+// DestroyPreview returns what destroying the dataset with the given flags destroys, without changing anything.
+func (d *Dataset) DestroyPreview(flags DestroyFlag) (*DestroyPreview, error) {
+	return d.DestroyPreviewContext(context.Background(), flags)
+}
+
+// DestroyPreviewContext is like DestroyPreview but includes a context.
+func (d *Dataset) DestroyPreviewContext(ctx context.Context, flags DestroyFlag) (*DestroyPreview, error) {
+	args := append(append([]string{"destroy", "-nvp"}, flags.args()...), d.Name)
+	out, err := zfsOutput(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	return parseDestroyPreview(out)
+}
+
+// example input for parseDestroyPreview
+// destroy	tank/fs@a
+// destroy	tank/fs@b
+// reclaim	1048576
+
+func parseDestroyPreview(out [][]string) (*DestroyPreview, error) {
+	p := &DestroyPreview{}
+	for _, line := range out {
+		if len(line) != 2 {
+			return nil, fmt.Errorf("unexpected destroy output %q", strings.Join(line, "\t"))
+		}
+		switch line[0] {
+		case "destroy":
+			p.Datasets = append(p.Datasets, line[1])
+		case "reclaim":
+			if err := setUint(&p.Reclaimed, line[1]); err != nil {
+				return nil, fmt.Errorf("invalid reclaimed space: %w", err)
+			}
+		default:
+			return nil, fmt.Errorf("unexpected destroy output %q", strings.Join(line, "\t"))
+		}
+	}
+	return p, nil
+}
+
+func (d *Dataset) snapshotRange(first, last string) (string, error) {
+	if d.Type == DatasetSnapshot || strings.Contains(d.Name, "@") {
+		return "", errors.New("snapshot ranges can only be selected on filesystems and volumes")
+	}
+	if strings.ContainsAny(first+last, "@%,") {
+		return "", fmt.Errorf("invalid snapshot range %q", first+"%"+last)
+	}
+	return d.Name + "@" + first + "%" + last, nil
+}
+
+// DestroySnapshotRange destroys the snapshots of the filesystem or volume from the snapshot named first
+// up to and including the one named last in one invocation, using the fs@first%last syntax.
+// An empty first or last selects from the oldest or up to the newest snapshot.
+// With DestroyRecursive the snapshots of the same range of all descendent filesystems are destroyed as well.
+func (d *Dataset) DestroySnapshotRange(first, last string, flags DestroyFlag) error {
+	return d.DestroySnapshotRangeContext(context.Background(), first, last, flags)
+}
+
+// DestroySnapshotRangeContext is like DestroySnapshotRange but includes a context.
+func (d *Dataset) DestroySnapshotRangeContext(ctx context.Context, first, last string, flags DestroyFlag) error {
+	name, err := d.snapshotRange(first, last)
+	if err != nil {
+		return err
+	}
+	return zfs(ctx, append(append([]string{"destroy"}, flags.args()...), name)...)
+}
+
+// DestroySnapshotRangePreview returns what DestroySnapshotRange destroys, without changing anything.
+func (d *Dataset) DestroySnapshotRangePreview(first, last string, flags DestroyFlag) (*DestroyPreview, error) {
+	return d.DestroySnapshotRangePreviewContext(context.Background(), first, last, flags)
+}
+
+// DestroySnapshotRangePreviewContext is like DestroySnapshotRangePreview but includes a context.
+func (d *Dataset) DestroySnapshotRangePreviewContext(ctx context.Context, first, last string, flags DestroyFlag) (*DestroyPreview, error) {
+	name, err := d.snapshotRange(first, last)
+	if err != nil {
+		return nil, err
+	}
+	out, err := zfsOutput(ctx, append(append([]string{"destroy", "-nvp"}, flags.args()...), name)...)
+	if err != nil {
+		return nil, err
+	}
+	return parseDestroyPreview(out)
+}
@@ -0,0 +1,41 @@
+package zfs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDestroyPreview(t *testing.T) {
+	ctx, r := withFakeRunner("destroy\ttank/fs@a\ndestroy\ttank/fs/child@a\nreclaim\t1048576\n")
+	p, err := (&Dataset{Name: "tank/fs@a"}).DestroyPreviewContext(ctx, DestroyRecursive|DestroyDeferDeletion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (&DestroyPreview{Datasets: []string{"tank/fs@a", "tank/fs/child@a"}, Reclaimed: 1 << 20}); !reflect.DeepEqual(want, p) {
+		t.Fatalf("want: %+v, got: %+v", want, p)
+	}
+	if want := [][]string{{"zfs", "destroy", "-nvp", "-r", "-d", "tank/fs@a"}}; !reflect.DeepEqual(want, r.calls) {
+		t.Fatalf("want calls: %q, got: %q", want, r.calls)
+	}
+
+	if _, err := parseDestroyPreview([][]string{{"would destroy tank/fs"}}); err == nil {
+		t.Fatal("expected error for output which is not parsable")
+	}
+}
+
+func TestDestroySnapshotRange(t *testing.T) {
+	ctx, r := withFakeRunner("")
+	fs := &Dataset{Name: "tank/fs", Type: DatasetFilesystem}
+	if err := fs.DestroySnapshotRangeContext(ctx, "a", "", DestroyRecursive); err != nil {
+		t.Fatal(err)
+	}
+	if want := [][]string{{"zfs", "destroy", "-r", "tank/fs@a%"}}; !reflect.DeepEqual(want, r.calls) {
+		t.Fatalf("want calls: %q, got: %q", want, r.calls)
+	}
+	if err := fs.DestroySnapshotRangeContext(ctx, "a", "b,c", DestroyDefault); err == nil {
+		t.Fatal("expected error for an invalid snapshot range")
+	}
+	if err := (&Dataset{Name: "tank/fs@a", Type: DatasetSnapshot}).DestroySnapshotRangeContext(ctx, "", "b", DestroyDefault); err == nil {
+		t.Fatal("expected error selecting a snapshot range on a snapshot")
+	}
+}
@@ -0,0 +1,299 @@
+package zfs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Key statuses of a dataset as reported by KeyStatus.
+const (
+	KeyStatusAvailable   = "available"
+	KeyStatusUnavailable = "unavailable"
+	// KeyStatusNone is reported for datasets which are not encrypted.
+	KeyStatusNone = "none"
+)
+
+// Key formats of encrypted datasets.
+const (
+	KeyFormatRaw        = "raw"
+	KeyFormatHex        = "hex"
+	KeyFormatPassphrase = "passphrase"
+)
+
+// KeyLocationPrompt is the key location which reads keys from standard input.
+const KeyLocationPrompt = "prompt"
+
+// EncryptionOptions configure the encryption of a newly created dataset.
+//
+// A full description of the options may be found in the ZFS manual:
+// https://openzfs.github.io/openzfs-docs/man/7/zfsprops.7.html#encryption.
+type EncryptionOptions struct {
+	// Encryption is the cipher, such as "on" or "aes-256-gcm".
+	Encryption string
+	// KeyFormat is one of the KeyFormat constants.
+	KeyFormat string
+	// KeyLocation is either KeyLocationPrompt or a "file://" or "https://" URI.
+	KeyLocation string
+	// PBKDF2Iters is the number of PBKDF2 iterations used for passphrase keys, zero uses the zfs default.
+	PBKDF2Iters uint64
+	// Key is read as the key material when KeyLocation is KeyLocationPrompt.
+	Key io.Reader
+}
+
+func (o *EncryptionOptions) properties() map[string]string {
+	props := map[string]string{}
+	if o.Encryption != "" {
+		props["encryption"] = o.Encryption
+	}
+	if o.KeyFormat != "" {
+		props["keyformat"] = o.KeyFormat
+	}
+	if o.KeyLocation != "" {
+		props["keylocation"] = o.KeyLocation
+	}
+	if o.PBKDF2Iters != 0 {
+		props["pbkdf2iters"] = strconv.FormatUint(o.PBKDF2Iters, 10)
+	}
+	return props
+}
+
+// CreateFilesystemOptions are the options which can be passed to CreateFilesystemWithOptions.
+type CreateFilesystemOptions struct {
+	// Properties are set on the new filesystem, see CreateFilesystem.
+	Properties map[string]string
+	// Encryption, if set, creates an encrypted filesystem.
+	Encryption *EncryptionOptions
+	// SpecialSmallBlocks, if not zero, sets the special_small_blocks property, see Dataset.SetSpecialSmallBlocks.
+	SpecialSmallBlocks uint64
+}
+
+// CreateFilesystemWithOptions creates a new ZFS filesystem with the specified name and options.
+func CreateFilesystemWithOptions(name string, opts CreateFilesystemOptions) (*Dataset, error) {
+	return CreateFilesystemWithOptionsContext(context.Background(), name, opts)
+}
+
+// CreateFilesystemWithOptionsContext is like CreateFilesystemWithOptions but includes a context.
+func CreateFilesystemWithOptionsContext(ctx context.Context, name string, opts CreateFilesystemOptions) (*Dataset, error) {
+	props := make(map[string]string, len(opts.Properties))
+	for k, v := range opts.Properties {
+		props[k] = v
+	}
+	if err := validateProperties(ctx, props); err != nil {
+		return nil, err
+	}
+
+	if opts.SpecialSmallBlocks != 0 {
+		if err := validateSpecialSmallBlocks(opts.SpecialSmallBlocks); err != nil {
+			return nil, err
+		}
+		props["special_small_blocks"] = strconv.FormatUint(opts.SpecialSmallBlocks, 10)
+	}
+
+	c := command{Command: "zfs"}
+	if opts.Encryption != nil {
+		for k, v := range opts.Encryption.properties() {
+			props[k] = v
+		}
+		c.Stdin = opts.Encryption.Key
+	}
+
+	args := append([]string{"create"}, propsSlice(props)...)
+	if _, err := c.Run(ctx, append(args, name)...); err != nil {
+		return nil, err
+	}
+	return GetDatasetContext(ctx, name)
+}
+
+// LoadKeyOptions are the options which can be passed to LoadKey.
+type LoadKeyOptions struct {
+	// Key is read as the key material when the key location is KeyLocationPrompt.
+	Key io.Reader
+	// KeyLocation overrides the keylocation property of the dataset (-L).
+	KeyLocation string
+	// Recursive loads the keys of all encryption roots below the dataset (-r).
+	Recursive bool
+	// DryRun only verifies the key without loading it (-n).
+	DryRun bool
+}
+
+// LoadKey loads the encryption key of the receiving dataset, making it and its descendents accessible.
+func (d *Dataset) LoadKey(opts LoadKeyOptions) error {
+	return d.LoadKeyContext(context.Background(), opts)
+}
+
+// LoadKeyContext is like LoadKey but includes a context.
+func (d *Dataset) LoadKeyContext(ctx context.Context, opts LoadKeyOptions) error {
+	args := []string{"load-key"}
+	if opts.Recursive {
+		args = append(args, "-r")
+	}
+	if opts.DryRun {
+		args = append(args, "-n")
+	}
+	if opts.KeyLocation != "" {
+		args = append(args, "-L", opts.KeyLocation)
+	}
+	c := command{Command: "zfs", Stdin: opts.Key}
+	_, err := c.Run(ctx, append(args, d.Name)...)
+	return err
+}
+
+// UnloadKey unloads the encryption key of the receiving dataset, which must be unmounted.
+func (d *Dataset) UnloadKey(recursive bool) error {
+	return d.UnloadKeyContext(context.Background(), recursive)
+}
+
+// UnloadKeyContext is like UnloadKey but includes a context.
+func (d *Dataset) UnloadKeyContext(ctx context.Context, recursive bool) error {
+	args := make([]string, 1, 3)
+	args[0] = "unload-key"
+	if recursive {
+		args = append(args, "-r")
+	}
+	return zfs(ctx, append(args, d.Name)...)
+}
+
+// ChangeKeyOptions are the options which can be passed to ChangeKey.
+type ChangeKeyOptions struct {
+	// Key is read as the new key material when the new key location is KeyLocationPrompt.
+	Key io.Reader
+	// KeyFormat, KeyLocation and PBKDF2Iters change the respective properties of the encryption root, if set.
+	KeyFormat   string
+	KeyLocation string
+	PBKDF2Iters uint64
+	// Load loads the current key before changing it, if it isn't loaded already (-l).
+	Load bool
+	// Inherit makes the dataset inherit its key from its parent instead of being an encryption root (-i).
+	Inherit bool
+}
+
+// ChangeKey changes the encryption key of the receiving dataset.
+func (d *Dataset) ChangeKey(opts ChangeKeyOptions) error {
+	return d.ChangeKeyContext(context.Background(), opts)
+}
+
+// ChangeKeyContext is like ChangeKey but includes a context.
+func (d *Dataset) ChangeKeyContext(ctx context.Context, opts ChangeKeyOptions) error {
+	args := []string{"change-key"}
+	if opts.Load {
+		args = append(args, "-l")
+	}
+	if opts.Inherit {
+		args = append(args, "-i")
+	} else {
+		enc := EncryptionOptions{KeyFormat: opts.KeyFormat, KeyLocation: opts.KeyLocation, PBKDF2Iters: opts.PBKDF2Iters}
+		args = append(args, propsSlice(enc.properties())...)
+	}
+	c := command{Command: "zfs", Stdin: opts.Key}
+	_, err := c.Run(ctx, append(args, d.Name)...)
+	return err
+}
+
+// KeyStatus returns the status of the encryption key of the receiving dataset, one of the KeyStatus constants.
+func (d *Dataset) KeyStatus() (string, error) {
+	return d.KeyStatusContext(context.Background())
+}
+
+// KeyStatusContext is like KeyStatus but includes a context.
+func (d *Dataset) KeyStatusContext(ctx context.Context) (string, error) {
+	status, err := d.GetPropertyContext(ctx, "keystatus")
+	if err != nil {
+		return "", err
+	}
+	if status == "-" {
+		return KeyStatusNone, nil
+	}
+	return status, nil
+}
+
+// EncryptionInfo describes the encryption of a dataset, as returned by Encryption.
+type EncryptionInfo struct {
+	Dataset string
+	// Encryption is the cipher, such as "aes-256-gcm", or "off" for datasets which are not encrypted.
+	Encryption string
+	// Root is the encryption root the dataset inherits its key from, the dataset itself if it is an encryption root,
+	// and empty if it is not encrypted.
+	Root string
+	// KeyStatus is one of the KeyStatus constants.
+	KeyStatus string
+	// KeyFormat is one of the KeyFormat constants, or "none" for datasets which are not encrypted.
+	KeyFormat string
+}
+
+// Encryption returns the encryption of the receiving dataset with a single invocation of zfs get.
+func (d *Dataset) Encryption() (*EncryptionInfo, error) {
+	return d.EncryptionContext(context.Background())
+}
+
+// EncryptionContext is like Encryption but includes a context.
+func (d *Dataset) EncryptionContext(ctx context.Context) (*EncryptionInfo, error) {
+	out, err := zfsOutput(ctx, "get", "-Hp", "-o", "property,value", "encryption,encryptionroot,keystatus,keyformat", d.Name)
+	if err != nil {
+		return nil, err
+	}
+	return parseEncryptionInfo(d.Name, out)
+}
+
+// example input for parseEncryptionInfo
+// encryption	aes-256-gcm
+// encryptionroot	tank/secure
+// keystatus	unavailable
+// keyformat	passphrase
+
+func parseEncryptionInfo(name string, out [][]string) (*EncryptionInfo, error) {
+	e := &EncryptionInfo{Dataset: name, KeyStatus: KeyStatusNone}
+	for _, line := range out {
+		if len(line) != 2 {
+			return nil, fmt.Errorf("invalid encryption property %q", strings.Join(line, "\t"))
+		}
+		switch line[0] {
+		case "encryption":
+			e.Encryption = line[1]
+		case "encryptionroot":
+			if line[1] != "-" {
+				e.Root = line[1]
+			}
+		case "keystatus":
+			if line[1] != "-" {
+				e.KeyStatus = line[1]
+			}
+		case "keyformat":
+			e.KeyFormat = line[1]
+		}
+	}
+	if e.Encryption == "" {
+		return nil, fmt.Errorf("encryption of %s not listed", name)
+	}
+	return e, nil
+}
+
+// CheckRawIncremental returns an error if a raw incremental stream (SendOptions.Raw) of the source dataset
+// cannot be received into the target, which zfs receive would otherwise only report once the stream is sent.
+//
+// The target must be encrypted with the same cipher, and its encryption root must correspond to that of the source:
+// a target received without its parents is an encryption root of its own, otherwise the source and target must be
+// at the same position below their encryption roots. The target's key does not need to be loaded,
+// as raw streams are received as they are stored on disk.
+func CheckRawIncremental(source, target *EncryptionInfo) error {
+	switch {
+	case source.Encryption == "off":
+		// a raw stream of an unencrypted dataset is an ordinary stream
+		return nil
+	case target.Encryption == "off":
+		return fmt.Errorf("cannot receive raw incremental stream of encrypted %s into unencrypted %s",
+			source.Dataset, target.Dataset)
+	case source.Encryption != target.Encryption:
+		return fmt.Errorf("cannot receive raw incremental stream of %s encrypted with %s into %s encrypted with %s",
+			source.Dataset, source.Encryption, target.Dataset, target.Encryption)
+	}
+	sourceRel := strings.TrimPrefix(source.Dataset, source.Root)
+	targetRel := strings.TrimPrefix(target.Dataset, target.Root)
+	if target.Root != target.Dataset && sourceRel != targetRel {
+		return fmt.Errorf("encryption root %s of %s does not correspond to encryption root %s of %s",
+			target.Root, target.Dataset, source.Root, source.Dataset)
+	}
+	return nil
+}
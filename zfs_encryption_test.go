@@ -0,0 +1,75 @@
+package zfs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEncryptionOptionsProperties(t *testing.T) {
+	opts := EncryptionOptions{
+		Encryption:  "aes-256-gcm",
+		KeyFormat:   KeyFormatPassphrase,
+		KeyLocation: KeyLocationPrompt,
+		PBKDF2Iters: 350000,
+	}
+	want := map[string]string{
+		"encryption":  "aes-256-gcm",
+		"keyformat":   "passphrase",
+		"keylocation": "prompt",
+		"pbkdf2iters": "350000",
+	}
+	if got := opts.properties(); !reflect.DeepEqual(want, got) {
+		t.Fatalf("want: %v, got: %v", want, got)
+	}
+
+	if got := (&EncryptionOptions{KeyLocation: "file:///etc/zfs/key"}).properties(); !reflect.DeepEqual(map[string]string{"keylocation": "file:///etc/zfs/key"}, got) {
+		t.Fatalf("unexpected properties for partial options: %v", got)
+	}
+}
+
+func TestEncryptionInfo(t *testing.T) {
+	ctx, r := withFakeRunner("encryption\taes-256-gcm\nencryptionroot\ttank/secure\nkeystatus\tunavailable\nkeyformat\tpassphrase\n")
+	e, err := (&Dataset{Name: "tank/secure/fs"}).EncryptionContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &EncryptionInfo{Dataset: "tank/secure/fs", Encryption: "aes-256-gcm", Root: "tank/secure", KeyStatus: KeyStatusUnavailable, KeyFormat: KeyFormatPassphrase}
+	if !reflect.DeepEqual(want, e) {
+		t.Fatalf("want: %+v, got: %+v", want, e)
+	}
+	if want := []string{"zfs", "get", "-Hp", "-o", "property,value", "encryption,encryptionroot,keystatus,keyformat", "tank/secure/fs"}; !reflect.DeepEqual(want, r.calls[0]) {
+		t.Fatalf("want call: %q, got: %q", want, r.calls)
+	}
+
+	e, err = parseEncryptionInfo("tank/fs", [][]string{{"encryption", "off"}, {"encryptionroot", "-"}, {"keystatus", "-"}, {"keyformat", "none"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (&EncryptionInfo{Dataset: "tank/fs", Encryption: "off", KeyStatus: KeyStatusNone, KeyFormat: "none"}); !reflect.DeepEqual(want, e) {
+		t.Fatalf("want: %+v, got: %+v", want, e)
+	}
+}
+
+func TestCheckRawIncremental(t *testing.T) {
+	enc := func(name, encryption, root string) *EncryptionInfo {
+		return &EncryptionInfo{Dataset: name, Encryption: encryption, Root: root}
+	}
+	for _, tc := range []struct {
+		source, target *EncryptionInfo
+		valid          bool
+	}{
+		{enc("tank/fs", "off", ""), enc("backup/fs", "off", ""), true},
+		{enc("tank/secure", "aes-256-gcm", "tank/secure"), enc("backup/secure", "aes-256-gcm", "backup/secure"), true},
+		// received without its parent, or with it
+		{enc("tank/secure/fs", "aes-256-gcm", "tank/secure"), enc("backup/fs", "aes-256-gcm", "backup/fs"), true},
+		{enc("tank/secure/fs", "aes-256-gcm", "tank/secure"), enc("backup/secure/fs", "aes-256-gcm", "backup/secure"), true},
+		{enc("tank/secure", "aes-256-gcm", "tank/secure"), enc("backup/secure", "off", ""), false},
+		{enc("tank/secure", "aes-256-gcm", "tank/secure"), enc("backup/secure", "aes-128-ccm", "backup/secure"), false},
+		// the target inherits the key of another encryption root
+		{enc("tank/secure", "aes-256-gcm", "tank/secure"), enc("backup/enc/secure", "aes-256-gcm", "backup/enc"), false},
+	} {
+		if err := CheckRawIncremental(tc.source, tc.target); (err == nil) != tc.valid {
+			t.Fatalf("unexpected result for %+v into %+v: %v", tc.source, tc.target, err)
+		}
+	}
+}
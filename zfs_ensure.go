@@ -0,0 +1,195 @@
+package zfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The Ensure functions provision datasets idempotently, e.g. for the CreateVolume and CreateSnapshot calls of a
+// CSI driver, which are retried until they succeed. They return whether anything was changed, and treat a dataset
+// created concurrently by another caller like one which existed before.
+//
+// Property values are compared as printed by zfs get -p, so sizes should be given in bytes, e.g. "10737418240"
+// rather than "10G", to be recognized as unchanged.
+
+// EnsureFilesystem creates the filesystem with the given properties if it does not exist, otherwise it sets those
+// properties whose values differ. An error is returned if a dataset of another type has the name.
+func EnsureFilesystem(name string, properties map[string]string) (*Dataset, bool, error) {
+	return EnsureFilesystemContext(context.Background(), name, properties)
+}
+
+// EnsureFilesystemContext is like EnsureFilesystem but includes a context.
+func EnsureFilesystemContext(ctx context.Context, name string, properties map[string]string) (*Dataset, bool, error) {
+	return ensureDataset(ctx, name, DatasetFilesystem, properties, func() error {
+		_, err := CreateFilesystemContext(ctx, name, properties)
+		return err
+	})
+}
+
+// EnsureVolume creates the volume with the given size in bytes and properties if it does not exist, otherwise it
+// sets those properties whose values differ. An error is returned if the existing volume has another size, see
+// ExpandDataset to grow it, or if a dataset of another type has the name.
+func EnsureVolume(name string, size uint64, properties map[string]string) (*Dataset, bool, error) {
+	return EnsureVolumeContext(context.Background(), name, size, properties)
+}
+
+// EnsureVolumeContext is like EnsureVolume but includes a context.
+func EnsureVolumeContext(ctx context.Context, name string, size uint64, properties map[string]string) (*Dataset, bool, error) {
+	ds, changed, err := ensureDataset(ctx, name, DatasetVolume, properties, func() error {
+		_, err := CreateVolumeContext(ctx, name, size, properties)
+		return err
+	})
+	if err == nil && ds.Volsize != size {
+		return nil, false, fmt.Errorf("volume %s exists with size %d instead of %d", name, ds.Volsize, size)
+	}
+	return ds, changed, err
+}
+
+// EnsureSnapshot creates the snapshot, named "dataset@snapshot", if it does not exist.
+func EnsureSnapshot(name string) (*Dataset, bool, error) {
+	return EnsureSnapshotContext(context.Background(), name)
+}
+
+// EnsureSnapshotContext is like EnsureSnapshot but includes a context.
+func EnsureSnapshotContext(ctx context.Context, name string) (*Dataset, bool, error) {
+	n, err := ParseDatasetName(name)
+	if err != nil {
+		return nil, false, err
+	}
+	if n.Snapshot == "" {
+		return nil, false, fmt.Errorf("invalid snapshot name %q", name)
+	}
+	return ensureDataset(ctx, name, DatasetSnapshot, nil, func() error {
+		return zfs(ctx, "snapshot", name)
+	})
+}
+
+// EnsureClone creates dest as a clone of the snapshot with the given properties if it does not exist, otherwise it
+// sets those properties whose values differ. An error is returned if dest exists but is not a clone of snapshot.
+func EnsureClone(snapshot, dest string, properties map[string]string) (*Dataset, bool, error) {
+	return EnsureCloneContext(context.Background(), snapshot, dest, properties)
+}
+
+// EnsureCloneContext is like EnsureClone but includes a context.
+func EnsureCloneContext(ctx context.Context, snapshot, dest string, properties map[string]string) (*Dataset, bool, error) {
+	ds, err := GetDatasetContext(ctx, dest)
+	if err != nil && !errors.Is(err, ErrDatasetNotFound) {
+		return nil, false, err
+	}
+	if err != nil {
+		snap := &Dataset{Name: snapshot, Type: DatasetSnapshot}
+		if _, err := snap.CloneContext(ctx, dest, properties); err == nil {
+			ds, err := GetDatasetContext(ctx, dest)
+			return ds, err == nil, err
+		} else if !errors.Is(err, ErrDatasetExists) {
+			return nil, false, err
+		}
+		if ds, err = GetDatasetContext(ctx, dest); err != nil {
+			return nil, false, err
+		}
+	}
+	if ds.Origin != snapshot {
+		return nil, false, fmt.Errorf("dataset %s exists but is not a clone of %s", dest, snapshot)
+	}
+	changed, err := ensureProperties(ctx, ds, properties)
+	return ds, changed, err
+}
+
+// ExpandDataset grows a volume to size bytes, or raises the refquota of a filesystem to size bytes, if it is
+// smaller. Datasets which are already at least that large are not changed.
+func ExpandDataset(name string, size uint64) (bool, error) {
+	return ExpandDatasetContext(context.Background(), name, size)
+}
+
+// ExpandDatasetContext is like ExpandDataset but includes a context.
+func ExpandDatasetContext(ctx context.Context, name string, size uint64) (bool, error) {
+	ds, err := GetDatasetContext(ctx, name)
+	if err != nil {
+		return false, err
+	}
+	switch ds.Type {
+	case DatasetVolume:
+		if ds.Volsize >= size {
+			return false, nil
+		}
+		return true, ds.ResizeVolumeContext(ctx, size, false)
+	case DatasetFilesystem:
+		out, err := zfsOutput(ctx, "get", "-Hp", "-o", "value", "refquota", name)
+		if err != nil {
+			return false, err
+		}
+		var refquota uint64
+		if len(out) != 1 || len(out[0]) != 1 {
+			return false, fmt.Errorf("unexpected refquota of %s: %q", name, out)
+		}
+		if err := setUint(&refquota, out[0][0]); err != nil {
+			return false, fmt.Errorf("invalid refquota of %s: %w", name, err)
+		}
+		// no refquota means the filesystem is not limited
+		if refquota == 0 || refquota >= size {
+			return false, nil
+		}
+		return true, ds.SetPropertyContext(ctx, "refquota", strconv.FormatUint(size, 10))
+	}
+	return false, fmt.Errorf("cannot expand %s of type %s", name, ds.Type)
+}
+
+// ensureDataset returns the dataset of the given type and name after setting the properties which differ,
+// or creates it with create.
+func ensureDataset(ctx context.Context, name, typ string, properties map[string]string, create func() error) (*Dataset, bool, error) {
+	ds, err := GetDatasetContext(ctx, name)
+	if errors.Is(err, ErrDatasetNotFound) {
+		if err = create(); err == nil {
+			ds, err := GetDatasetContext(ctx, name)
+			return ds, err == nil, err
+		}
+		if !errors.Is(err, ErrDatasetExists) {
+			return nil, false, err
+		}
+		ds, err = GetDatasetContext(ctx, name)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if ds.Type != typ {
+		return nil, false, fmt.Errorf("dataset %s exists as a %s instead of a %s", name, ds.Type, typ)
+	}
+	changed, err := ensureProperties(ctx, ds, properties)
+	return ds, changed, err
+}
+
+// ensureProperties sets the properties of the dataset whose values differ.
+func ensureProperties(ctx context.Context, ds *Dataset, properties map[string]string) (bool, error) {
+	if len(properties) == 0 {
+		return false, nil
+	}
+	names := make([]string, 0, len(properties))
+	for k := range properties {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	out, err := zfsOutput(ctx, "get", "-Hp", "-o", "property,value", strings.Join(names, ","), ds.Name)
+	if err != nil {
+		return false, err
+	}
+	current := make(map[string]string, len(out))
+	for _, line := range out {
+		if len(line) == 2 {
+			current[line[0]] = line[1]
+		}
+	}
+	changes := map[string]string{}
+	for _, k := range names {
+		if v, ok := current[k]; !ok || v != properties[k] {
+			changes[k] = properties[k]
+		}
+	}
+	if len(changes) == 0 {
+		return false, nil
+	}
+	return true, ds.SetPropertiesContext(ctx, changes)
+}
@@ -0,0 +1,41 @@
+package zfs
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestEnsureFilesystemConcurrentCreate(t *testing.T) {
+	lists := 0
+	r := &fakeRunner{output: func(args []string) (string, error) {
+		switch args[1] {
+		case "list":
+			if lists++; lists == 1 {
+				return "", errors.New("cannot open 'tank/pv1': dataset does not exist")
+			}
+			return "tank/pv1\t-\t512\t2048\t/tank/pv1\tlz4\tfilesystem\t-\t0\t512\t0\t512\t512\n", nil
+		case "create":
+			return "", errors.New("cannot create 'tank/pv1': dataset already exists")
+		case "get":
+			return "compression\tlz4\nrecordsize\t131072\n", nil
+		}
+		return "", nil
+	}}
+	ctx := WithRunner(context.Background(), r)
+	ds, changed, err := EnsureFilesystemContext(ctx, "tank/pv1", map[string]string{"compression": "lz4", "recordsize": "16384"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ds.Name != "tank/pv1" || !changed {
+		t.Fatalf("unexpected result: %+v, %v", ds, changed)
+	}
+	want := [][]string{
+		{"zfs", "get", "-Hp", "-o", "property,value", "compression,recordsize", "tank/pv1"},
+		{"zfs", "set", "recordsize=16384", "tank/pv1"},
+	}
+	if got := r.calls[len(r.calls)-2:]; !reflect.DeepEqual(want, got) {
+		t.Fatalf("want: %q, got: %q", want, got)
+	}
+}
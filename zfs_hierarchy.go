@@ -0,0 +1,52 @@
+package zfs
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// PoolName returns the name of the zpool the dataset belongs to, the first component of its name. No command is run.
+func (d *Dataset) PoolName() string {
+	if i := strings.IndexAny(d.Name, "/@#"); i >= 0 {
+		return d.Name[:i]
+	}
+	return d.Name
+}
+
+// ParentName returns the name of the parent of the dataset, which for snapshots and bookmarks is the filesystem or
+// volume they belong to, or an empty string for the root dataset of a pool. No command is run.
+func (d *Dataset) ParentName() string {
+	if i := strings.IndexAny(d.Name, "@#"); i >= 0 {
+		return d.Name[:i]
+	}
+	if i := strings.LastIndexByte(d.Name, '/'); i >= 0 {
+		return d.Name[:i]
+	}
+	return ""
+}
+
+// Parent retrieves the parent of the dataset, as named by ParentName. An error is returned for the root dataset of
+// a pool, see Pool to retrieve the pool instead.
+func (d *Dataset) Parent() (*Dataset, error) {
+	return d.ParentContext(context.Background())
+}
+
+// ParentContext is like Parent but includes a context.
+func (d *Dataset) ParentContext(ctx context.Context) (*Dataset, error) {
+	parent := d.ParentName()
+	if parent == "" {
+		return nil, fmt.Errorf("dataset %s has no parent", d.Name)
+	}
+	return GetDatasetContext(ctx, parent)
+}
+
+// Pool retrieves the zpool the dataset belongs to, as named by PoolName.
+func (d *Dataset) Pool() (*Zpool, error) {
+	return d.PoolContext(context.Background())
+}
+
+// PoolContext is like Pool but includes a context.
+func (d *Dataset) PoolContext(ctx context.Context) (*Zpool, error) {
+	return GetZpoolContext(ctx, d.PoolName())
+}
@@ -0,0 +1,47 @@
+package zfs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDatasetHierarchyNames(t *testing.T) {
+	for _, tc := range []struct {
+		name, pool, parent string
+	}{
+		{"tank", "tank", ""},
+		{"tank/fs", "tank", "tank"},
+		{"tank/fs/child", "tank", "tank/fs"},
+		{"tank/fs@snap", "tank", "tank/fs"},
+		{"tank/fs/child@daily-2021", "tank", "tank/fs/child"},
+		{"tank/fs#mark", "tank", "tank/fs"},
+		{"tank@snap", "tank", "tank"},
+	} {
+		d := &Dataset{Name: tc.name}
+		if got := d.PoolName(); got != tc.pool {
+			t.Fatalf("pool of %s: want %q, got %q", tc.name, tc.pool, got)
+		}
+		if got := d.ParentName(); got != tc.parent {
+			t.Fatalf("parent of %s: want %q, got %q", tc.name, tc.parent, got)
+		}
+	}
+}
+
+func TestParent(t *testing.T) {
+	ctx, r := withFakeRunner("tank/fs\t-\t512\t2048\t/tank/fs\tlz4\tfilesystem\t-\t0\t512\t0\t512\t512\n")
+	d := &Dataset{Name: "tank/fs@snap"}
+	parent, err := d.ParentContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parent.Name != "tank/fs" || parent.Mountpoint != "/tank/fs" {
+		t.Fatalf("unexpected parent: %+v", parent)
+	}
+	if want := []string{"zfs", "list", "-Hp", "-o", dsPropListOptions, "tank/fs"}; !reflect.DeepEqual(want, r.calls[len(r.calls)-1]) {
+		t.Fatalf("want: %q, got: %q", want, r.calls[len(r.calls)-1])
+	}
+
+	if _, err := (&Dataset{Name: "tank"}).ParentContext(ctx); err == nil {
+		t.Fatal("expected error for the root dataset")
+	}
+}
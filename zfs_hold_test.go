@@ -0,0 +1,52 @@
+package zfs
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseHolds(t *testing.T) {
+	got, err := parseHolds([][]string{
+		{"test/fs@snap", "backup", "Sun Jul 25 10:00 2021"},
+		{"test/fs@snap", "keep", "1627207200"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*Hold{
+		{Snapshot: "test/fs@snap", Tag: "backup", Created: time.Date(2021, time.July, 25, 10, 0, 0, 0, time.Local)},
+		{Snapshot: "test/fs@snap", Tag: "keep", Created: time.Unix(1627207200, 0)},
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("want: %+v, got: %+v", want, got)
+	}
+
+	if _, err := parseHolds([][]string{{"test/fs@snap", "backup", "yesterday"}}); err == nil {
+		t.Fatal("expected error for invalid timestamp")
+	}
+}
+
+func TestHoldsParsable(t *testing.T) {
+	r := capabilitiesRunner("zfs-2.1.5-1\nzfs-kmod-2.1.5-1\n")
+	ctx := WithRunner(context.Background(), r)
+	snap := &Dataset{Name: "tank/fs@a", Type: DatasetSnapshot}
+	if _, err := snap.HoldsContext(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"zfs", "holds", "-H", "tank/fs@a"}; !reflect.DeepEqual(want, r.calls[len(r.calls)-1]) {
+		t.Fatalf("want: %q, got: %q", want, r.calls[len(r.calls)-1])
+	}
+
+	// timestamps are requested as seconds once zfs is known to support it
+	if _, err := DetectCapabilitiesContext(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := snap.HoldsContext(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"zfs", "holds", "-Hp", "tank/fs@a"}; !reflect.DeepEqual(want, r.calls[len(r.calls)-1]) {
+		t.Fatalf("want: %q, got: %q", want, r.calls[len(r.calls)-1])
+	}
+}
@@ -0,0 +1,64 @@
+package zfs
+
+import (
+	"context"
+	"errors"
+)
+
+// Jail attaches the filesystem to a FreeBSD jail, given by its ID or name, so it can be managed from within the
+// jail. The jailed property of the filesystem must be on, which SetJailed sets.
+//
+// See https://openzfs.github.io/openzfs-docs/man/8/zfs-jail.8.html.
+func (d *Dataset) Jail(jail string) error {
+	return d.JailContext(context.Background(), jail)
+}
+
+// JailContext is like Jail but includes a context.
+func (d *Dataset) JailContext(ctx context.Context, jail string) error {
+	if err := d.checkJail(jail); err != nil {
+		return err
+	}
+	return zfs(ctx, "jail", jail, d.Name)
+}
+
+// Unjail detaches the filesystem from a FreeBSD jail, given by its ID or name.
+func (d *Dataset) Unjail(jail string) error {
+	return d.UnjailContext(context.Background(), jail)
+}
+
+// UnjailContext is like Unjail but includes a context.
+func (d *Dataset) UnjailContext(ctx context.Context, jail string) error {
+	if err := d.checkJail(jail); err != nil {
+		return err
+	}
+	return zfs(ctx, "unjail", jail, d.Name)
+}
+
+// SetJailed sets the jailed property of the filesystem, which allows it to be attached to a FreeBSD jail by Jail.
+// Once a filesystem is jailed its mountpoint is controlled from within the jail and it is no longer mounted
+// by the host.
+func (d *Dataset) SetJailed(jailed bool) error {
+	return d.SetJailedContext(context.Background(), jailed)
+}
+
+// SetJailedContext is like SetJailed but includes a context.
+func (d *Dataset) SetJailedContext(ctx context.Context, jailed bool) error {
+	if d.Type != DatasetFilesystem {
+		return errors.New("only filesystems can be jailed")
+	}
+	value := "off"
+	if jailed {
+		value = "on"
+	}
+	return zfs(ctx, "set", "jailed="+value, d.Name)
+}
+
+func (d *Dataset) checkJail(jail string) error {
+	if d.Type != DatasetFilesystem {
+		return errors.New("only filesystems can be jailed")
+	}
+	if jail == "" {
+		return errors.New("no jail given")
+	}
+	return nil
+}
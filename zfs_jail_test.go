@@ -0,0 +1,36 @@
+package zfs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestJail(t *testing.T) {
+	ctx, r := withFakeRunner("")
+	d := &Dataset{Name: "tank/jails/www", Type: DatasetFilesystem}
+	if err := d.SetJailedContext(ctx, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.JailContext(ctx, "www"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.UnjailContext(ctx, "12"); err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"zfs", "set", "jailed=on", "tank/jails/www"},
+		{"zfs", "jail", "www", "tank/jails/www"},
+		{"zfs", "unjail", "12", "tank/jails/www"},
+	}
+	if !reflect.DeepEqual(want, r.calls) {
+		t.Fatalf("want: %q, got: %q", want, r.calls)
+	}
+
+	if err := d.JailContext(ctx, ""); err == nil {
+		t.Fatal("expected error without jail")
+	}
+	snap := &Dataset{Name: "tank/jails/www@a", Type: DatasetSnapshot}
+	if err := snap.JailContext(ctx, "www"); err == nil {
+		t.Fatal("expected error jailing a snapshot")
+	}
+}
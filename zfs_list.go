@@ -0,0 +1,206 @@
+package zfs
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// ListOptions select the datasets and properties listed by ListDatasets.
+//
+// A full description of zfs list may be found in the ZFS manual:
+// https://openzfs.github.io/openzfs-docs/man/8/zfs-list.8.html.
+type ListOptions struct {
+	// Root lists only this dataset, and its descendents if Recursive or Depth is set. All datasets are listed if empty.
+	Root string
+	// Recursive lists the descendents of Root (-r).
+	Recursive bool
+	// Depth limits recursion to this many levels below Root, e.g. 1 for its children and their snapshots (-d).
+	// Zero means unlimited.
+	Depth int
+	// Types are the types of datasets to list, DatasetFilesystem, DatasetVolume, DatasetSnapshot or
+	// DatasetBookmark (-t). If empty, filesystems and volumes are listed, and snapshots too if the listsnapshots
+	// property of the pool is on.
+	Types []string
+	// Properties are the properties to fetch besides the name (-o), e.g. "creation" and "used" for snapshots.
+	// If empty, the properties of a Dataset are fetched.
+	Properties []string
+	// Sort orders the datasets by these properties (-s), or in descending order for properties prefixed with "-"
+	// (-S), e.g. "-creation" for the most recent snapshots first. Datasets are listed by name otherwise.
+	Sort []string
+	// Match only returns the datasets whose name matches this pattern, in the syntax of path.Match, e.g.
+	// "tank/vm-*@auto-*". The pattern is matched by the library, after all datasets were listed.
+	Match string
+}
+
+func (o *ListOptions) args() ([]string, error) {
+	args := []string{"list", "-Hp"}
+	if o.Depth < 0 {
+		return nil, fmt.Errorf("invalid depth %d", o.Depth)
+	}
+	if o.Depth > 0 {
+		args = append(args, "-d", strconv.Itoa(o.Depth))
+	} else if o.Recursive {
+		args = append(args, "-r")
+	}
+	for _, t := range o.Types {
+		switch t {
+		case DatasetFilesystem, DatasetVolume, DatasetSnapshot, DatasetBookmark, "all":
+		default:
+			return nil, fmt.Errorf("invalid dataset type %q", t)
+		}
+	}
+	if len(o.Types) > 0 {
+		args = append(args, "-t", strings.Join(o.Types, ","))
+	}
+	for _, prop := range append(o.columns(), o.sortProperties()...) {
+		if prop == "" || strings.ContainsAny(prop, ", \t") {
+			return nil, fmt.Errorf("invalid property %q", prop)
+		}
+	}
+	args = append(args, "-o", strings.Join(o.columns(), ","))
+	for _, prop := range o.Sort {
+		if strings.HasPrefix(prop, "-") {
+			args = append(args, "-S", prop[1:])
+		} else {
+			args = append(args, "-s", prop)
+		}
+	}
+	if o.Match != "" {
+		if _, err := path.Match(o.Match, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", o.Match, err)
+		}
+	}
+	if o.Root != "" {
+		args = append(args, o.Root)
+	}
+	return args, nil
+}
+
+// columns returns the properties to list, the name first.
+func (o *ListOptions) columns() []string {
+	props := o.Properties
+	if len(props) == 0 {
+		props = dsPropList[1:]
+	}
+	return append([]string{"name"}, props...)
+}
+
+func (o *ListOptions) sortProperties() []string {
+	props := make([]string, len(o.Sort))
+	for i, prop := range o.Sort {
+		props[i] = strings.TrimPrefix(prop, "-")
+	}
+	return props
+}
+
+// ListDatasets lists the datasets selected by opts along with the selected properties, with a single
+// invocation of zfs list. Only the selected properties are set in the returned DatasetProperties, and in their Raw
+// map, their Sources are nil.
+func ListDatasets(opts ListOptions) ([]*DatasetProperties, error) {
+	return ListDatasetsContext(context.Background(), opts)
+}
+
+// ListDatasetsContext is like ListDatasets but includes a context.
+func ListDatasetsContext(ctx context.Context, opts ListOptions) ([]*DatasetProperties, error) {
+	args, err := opts.args()
+	if err != nil {
+		return nil, err
+	}
+	out, err := zfsListOutput(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	return parseDatasetList(out, opts.columns(), opts.Match)
+}
+
+// example input for parseDatasetList with the properties type and used
+// tank	filesystem	1048576
+// tank/fs	filesystem	512
+// tank/fs@a	snapshot	0
+
+func parseDatasetList(out [][]string, columns []string, match string) ([]*DatasetProperties, error) {
+	datasets := make([]*DatasetProperties, 0, len(out))
+	for _, line := range out {
+		if len(line) != len(columns) {
+			return nil, fmt.Errorf("invalid dataset %q", strings.Join(line, "\t"))
+		}
+		if match != "" {
+			if ok, _ := path.Match(match, line[0]); !ok {
+				continue
+			}
+		}
+		props := make(map[string]Property, len(columns)-1)
+		for i, c := range columns[1:] {
+			props[c] = Property{Name: c, Value: line[i+1], Source: "-"}
+		}
+		p, err := parseDatasetProperties(line[0], props)
+		if err != nil {
+			return nil, err
+		}
+		p.Sources = nil
+		datasets = append(datasets, p)
+	}
+	return datasets, nil
+}
+
+// IterateDatasets lists the datasets selected by opts and calls fn for every dataset as zfs list prints it, so
+// memory use does not grow with the number of datasets, e.g. when walking hundreds of thousands of snapshots.
+// The properties of a Dataset are fetched, opts.Properties must be empty.
+//
+// Iteration stops at the first error returned by fn, which is returned, and the zfs process is killed.
+// Output is only streamed if the Runner of ctx implements StreamRunner, otherwise it is buffered before fn is
+// first called.
+func IterateDatasets(ctx context.Context, opts ListOptions, fn func(*Dataset) error) error {
+	if len(opts.Properties) > 0 {
+		return errors.New("datasets are iterated with their default properties, no properties may be selected")
+	}
+	args, err := opts.args()
+	if err != nil {
+		return err
+	}
+	read := func(r io.Reader) error {
+		return readDatasets(r, opts.Match, fn)
+	}
+	if _, ok := runnerFromContext(ctx).(StreamRunner); ok {
+		return streamOutput(ctx, command{Command: "zfs"}, args, read)
+	}
+	var out bytes.Buffer
+	c := command{Command: "zfs", Stdout: &out}
+	if _, err := c.Run(ctx, args...); err != nil {
+		return err
+	}
+	return read(&out)
+}
+
+// readDatasets parses the dataset lines of zfs list -H -o dsPropListOptions from r and calls fn for every dataset
+// whose name matches match, until r is exhausted or fn returns an error.
+func readDatasets(r io.Reader, match string, fn func(*Dataset) error) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if match != "" {
+			if ok, _ := path.Match(match, fields[0]); !ok {
+				continue
+			}
+		}
+		ds := &Dataset{}
+		if err := ds.parseLine(fields); err != nil {
+			return err
+		}
+		if err := fn(ds); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,87 @@
+package zfs
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestListDatasets(t *testing.T) {
+	ctx, r := withFakeRunner("tank/fs@auto-2\t1700000100\t4096\ntank/fs@manual\t1700000050\t0\ntank/fs@auto-1\t1700000000\t512\n")
+	list, err := ListDatasetsContext(ctx, ListOptions{
+		Root:       "tank/fs",
+		Depth:      1,
+		Types:      []string{DatasetSnapshot},
+		Properties: []string{"creation", "used"},
+		Sort:       []string{"-creation", "name"},
+		Match:      "tank/fs@auto-*",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the first call probes for JSON support
+	want := []string{"zfs", "list", "-Hp", "-d", "1", "-t", "snapshot", "-o", "name,creation,used", "-S", "creation", "-s", "name", "tank/fs"}
+	if got := r.calls[len(r.calls)-1]; !reflect.DeepEqual(want, got) {
+		t.Fatalf("want: %q, got: %q", want, got)
+	}
+	if len(list) != 2 || list[0].Name != "tank/fs@auto-2" || list[1].Name != "tank/fs@auto-1" {
+		t.Fatalf("unexpected datasets: %+v", list)
+	}
+	if list[0].Used != 4096 || list[0].Creation.Unix() != 1700000100 || list[0].Sources != nil {
+		t.Fatalf("unexpected properties: %+v", list[0])
+	}
+
+	ctx, r = withFakeRunner("tank\t-\t1024\t2048\t/tank\tlz4\tfilesystem\t-\t0\t1024\t0\t1024\t512\n")
+	if _, err := ListDatasetsContext(ctx, ListOptions{Recursive: true}); err != nil {
+		t.Fatal(err)
+	}
+	if got := r.calls[len(r.calls)-1]; got[3] != "-r" || got[5] != dsPropListOptions {
+		t.Fatalf("unexpected call: %q", got)
+	}
+}
+
+func TestListOptionsErrors(t *testing.T) {
+	for _, opts := range []ListOptions{
+		{Depth: -1},
+		{Types: []string{"pool"}},
+		{Properties: []string{"used,avail"}},
+		{Sort: []string{"-"}},
+		{Match: "tank/["},
+	} {
+		if _, err := opts.args(); err == nil {
+			t.Fatalf("expected error for %+v", opts)
+		}
+	}
+}
+
+func TestIterateDatasets(t *testing.T) {
+	ctx, r := withFakeRunner("tank\t-\t1024\t2048\t/tank\tlz4\tfilesystem\t-\t0\t1024\t0\t1024\t512\n" +
+		"tank/vol\t-\t4096\t2048\t-\toff\tvolume\t8192\t-\t4096\t0\t4096\t4096\n" +
+		"tank/fs\t-\t512\t2048\t/tank/fs\tlz4\tfilesystem\t-\t0\t512\t0\t512\t512\n")
+	var names []string
+	stop := errors.New("stop")
+	err := IterateDatasets(ctx, ListOptions{Root: "tank", Recursive: true}, func(d *Dataset) error {
+		names = append(names, d.Name)
+		if d.Type == DatasetVolume {
+			if d.Volsize != 8192 {
+				t.Fatalf("unexpected volume: %+v", d)
+			}
+			return stop
+		}
+		return nil
+	})
+	if err != stop {
+		t.Fatalf("expected callback error, got %v", err)
+	}
+	if want := []string{"tank", "tank/vol"}; !reflect.DeepEqual(want, names) {
+		t.Fatalf("want: %q, got: %q", want, names)
+	}
+	want := []string{"zfs", "list", "-Hp", "-r", "-o", dsPropListOptions, "tank"}
+	if !reflect.DeepEqual([][]string{want}, r.calls) {
+		t.Fatalf("want: %q, got: %q", want, r.calls)
+	}
+
+	if err := IterateDatasets(ctx, ListOptions{Properties: []string{"used"}}, func(*Dataset) error { return nil }); err == nil {
+		t.Fatal("expected error for selected properties")
+	}
+}
@@ -0,0 +1,194 @@
+package zfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+// MountOptions are the options which can be passed to MountWithOptions and MountAll.
+//
+// A full description of the options may be found in the ZFS manual:
+// https://openzfs.github.io/openzfs-docs/man/8/zfs-mount.8.html.
+type MountOptions struct {
+	// Overlay allows mounting over a non-empty directory (-O).
+	Overlay bool
+	// LoadKeys loads the keys of encrypted filesystems from their keylocation before mounting (-l).
+	LoadKeys bool
+	// Force mounts filesystems which could not be mounted otherwise, such as redacted ones (-f).
+	Force bool
+	// Options are temporary mount options for the duration of the mount, e.g. "ro" (-o).
+	Options []string
+}
+
+func (o *MountOptions) args() []string {
+	var args []string
+	if o.Overlay {
+		args = append(args, "-O")
+	}
+	if o.LoadKeys {
+		args = append(args, "-l")
+	}
+	if o.Force {
+		args = append(args, "-f")
+	}
+	if len(o.Options) > 0 {
+		args = append(args, "-o", strings.Join(o.Options, ","))
+	}
+	return args
+}
+
+// MountWithOptions mounts the ZFS file system as configured by opts.
+func (d *Dataset) MountWithOptions(opts MountOptions) (*Dataset, error) {
+	return d.MountWithOptionsContext(context.Background(), opts)
+}
+
+// MountWithOptionsContext is like MountWithOptions but includes a context.
+func (d *Dataset) MountWithOptionsContext(ctx context.Context, opts MountOptions) (*Dataset, error) {
+	if d.Type == DatasetSnapshot {
+		return nil, errors.New("cannot mount snapshots")
+	}
+	args := append(append([]string{"mount"}, opts.args()...), d.Name)
+	if err := zfs(ctx, args...); err != nil {
+		return nil, err
+	}
+	return GetDatasetContext(ctx, d.Name)
+}
+
+// MountAt mounts the ZFS file system on dir regardless of its mountpoint property, e.g. to inspect a boot
+// environment whose mountpoint is /, with the given temporary mount options, such as "ro". The mount is done as
+// given by the Platform of the context and removed by Unmount.
+func (d *Dataset) MountAt(dir string, options ...string) error {
+	return d.MountAtContext(context.Background(), dir, options...)
+}
+
+// MountAtContext is like MountAt but includes a context.
+func (d *Dataset) MountAtContext(ctx context.Context, dir string, options ...string) error {
+	if d.Type != DatasetFilesystem {
+		return errors.New("can only mount filesystems")
+	}
+	if dir == "" {
+		return errors.New("no directory to mount on given")
+	}
+	p := platformFromContext(ctx)
+	if p == nil {
+		return fmt.Errorf("mounting on a directory is not supported on %s", runtime.GOOS)
+	}
+	return p.Mount(ctx, d.Name, dir, options)
+}
+
+// MountAll mounts all ZFS file systems which are mounted automatically, as configured by opts.
+func MountAll(opts MountOptions) error {
+	return MountAllContext(context.Background(), opts)
+}
+
+// MountAllContext is like MountAll but includes a context.
+func MountAllContext(ctx context.Context, opts MountOptions) error {
+	return zfs(ctx, append(append([]string{"mount"}, opts.args()...), "-a")...)
+}
+
+// UnmountAll unmounts all mounted ZFS file systems, optionally forcing busy ones to be unmounted.
+func UnmountAll(force bool) error {
+	return UnmountAllContext(context.Background(), force)
+}
+
+// UnmountAllContext is like UnmountAll but includes a context.
+func UnmountAllContext(ctx context.Context, force bool) error {
+	args := []string{"umount"}
+	if force {
+		args = append(args, "-f")
+	}
+	return zfs(ctx, append(args, "-a")...)
+}
+
+// Mounted reports whether the ZFS file system is currently mounted.
+func (d *Dataset) Mounted() (bool, error) {
+	return d.MountedContext(context.Background())
+}
+
+// MountedContext is like Mounted but includes a context.
+func (d *Dataset) MountedContext(ctx context.Context) (bool, error) {
+	mounted, err := d.GetPropertyContext(ctx, "mounted")
+	if err != nil {
+		return false, err
+	}
+	return mounted == "yes", nil
+}
+
+// EffectiveMountpoint returns the directory the ZFS file system is currently mounted on, which differs from the
+// Mountpoint property for legacy mounts, or an empty string if it is not mounted.
+func (d *Dataset) EffectiveMountpoint() (string, error) {
+	return d.EffectiveMountpointContext(context.Background())
+}
+
+// EffectiveMountpointContext is like EffectiveMountpoint but includes a context.
+func (d *Dataset) EffectiveMountpointContext(ctx context.Context) (string, error) {
+	mounts, err := MountsContext(ctx)
+	if err != nil {
+		return "", err
+	}
+	return mounts[d.Name], nil
+}
+
+// Mounts returns the directories all currently mounted ZFS file systems are mounted on, by name of the file system.
+func Mounts() (map[string]string, error) {
+	return MountsContext(context.Background())
+}
+
+// MountsContext is like Mounts but includes a context.
+func MountsContext(ctx context.Context) (map[string]string, error) {
+	// zfs mount prints the directories the file systems are actually mounted on, which differ from their
+	// mountpoint property for legacy mounts and MountAt, but pads the names with spaces, which names may contain
+	// as well. The names of the mounted file systems are listed first to tell where they end.
+	list, err := zfsListOutput(ctx, "list", "-Hp", "-t", "filesystem", "-o", "name,mounted")
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, line := range list {
+		if len(line) != 2 {
+			return nil, fmt.Errorf("invalid filesystem %q", strings.Join(line, "\t"))
+		}
+		if line[1] == "yes" {
+			names = append(names, line[0])
+		}
+	}
+	out, err := zfsRawOutput(ctx, "mount")
+	if err != nil {
+		return nil, err
+	}
+	return parseMounts(string(out), names)
+}
+
+// example input for parseMounts with the mounted file systems tank, tank/home and tank/my data
+// tank                            /tank
+// tank/home                       /home/with space
+// tank/my data                    /mnt/x
+
+// parseMounts parses the output of zfs mount, which separates names and mountpoints by spaces. Each line belongs
+// to the longest of names it starts with, followed by spaces and an absolute path.
+func parseMounts(out string, names []string) (map[string]string, error) {
+	mounts := map[string]string{}
+	for _, line := range strings.Split(out, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		name, dir := "", ""
+		for _, n := range names {
+			if len(n) <= len(name) || !strings.HasPrefix(line, n) {
+				continue
+			}
+			rest := line[len(n):]
+			if d := strings.TrimLeft(rest, " \t"); d != rest && strings.HasPrefix(d, "/") {
+				name, dir = n, d
+			}
+		}
+		if name == "" {
+			return nil, fmt.Errorf("invalid mount %q", line)
+		}
+		mounts[name] = dir
+	}
+	return mounts, nil
+}
@@ -0,0 +1,61 @@
+package zfs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMountOptionsArgs(t *testing.T) {
+	opts := MountOptions{Overlay: true, LoadKeys: true, Force: true, Options: []string{"ro", "noatime"}}
+	if want, got := []string{"-O", "-l", "-f", "-o", "ro,noatime"}, opts.args(); !reflect.DeepEqual(want, got) {
+		t.Fatalf("want: %q, got: %q", want, got)
+	}
+	if got := (&MountOptions{}).args(); got != nil {
+		t.Fatalf("want no args, got: %q", got)
+	}
+}
+
+func TestParseMounts(t *testing.T) {
+	names := []string{"tank", "tank/home", "tank/my", "tank/my data"}
+	mounts, err := parseMounts("tank                            /tank\n"+
+		"tank/home                       /home/with space \n"+
+		"tank/my                         /mnt/my\n"+
+		"tank/my data                    /mnt/x\n", names)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"tank": "/tank", "tank/home": "/home/with space ", "tank/my": "/mnt/my", "tank/my data": "/mnt/x"}
+	if !reflect.DeepEqual(want, mounts) {
+		t.Fatalf("want: %q, got: %q", want, mounts)
+	}
+	if _, err := parseMounts("tank\n", names); err == nil {
+		t.Fatal("expected error for mount without mountpoint")
+	}
+	if _, err := parseMounts("tank/other  /mnt\n", names); err == nil {
+		t.Fatal("expected error for mount of an unlisted file system")
+	}
+}
+
+func TestMounts(t *testing.T) {
+	ctx, r := withFakeRunner("")
+	r.output = func(args []string) (string, error) {
+		if args[1] == "list" {
+			return "tank\tyes\ntank/my data\tyes\ntank/off\tno\n", nil
+		}
+		return "tank                            /tank\ntank/my data                    /mnt/x\n", nil
+	}
+	mounts, err := MountsContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"tank": "/tank", "tank/my data": "/mnt/x"}; !reflect.DeepEqual(want, mounts) {
+		t.Fatalf("want: %q, got: %q", want, mounts)
+	}
+	want := [][]string{
+		{"zfs", "list", "-Hp", "-t", "filesystem", "-o", "name,mounted"},
+		{"zfs", "mount"},
+	}
+	if !reflect.DeepEqual(want, r.calls[len(r.calls)-2:]) {
+		t.Fatalf("want: %q, got: %q", want, r.calls)
+	}
+}
@@ -0,0 +1,151 @@
+package zfs
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MaxNameLen is the maximum length of the full name of a pool, dataset, snapshot or bookmark.
+const MaxNameLen = 255
+
+// NameError describes why a name is invalid. It matches ErrInvalidName with errors.Is.
+type NameError struct {
+	Name   string
+	Reason string
+}
+
+// Error implements error.
+func (e *NameError) Error() string {
+	return fmt.Sprintf("invalid name %q: %s", e.Name, e.Reason)
+}
+
+// Is reports whether target is ErrInvalidName.
+func (e *NameError) Is(target error) bool {
+	return target == ErrInvalidName
+}
+
+// DatasetName is a dataset name decomposed into its parts, see ParseDatasetName.
+type DatasetName struct {
+	// Pool is the name of the pool, the first component of the name.
+	Pool string
+	// Path is the name of the filesystem or volume, including the pool, e.g. "tank/vm/disk0".
+	Path string
+	// Snapshot is the name of the snapshot after the "@", if the name is that of a snapshot.
+	Snapshot string
+	// Bookmark is the name of the bookmark after the "#", if the name is that of a bookmark.
+	Bookmark string
+}
+
+// String returns the full name.
+func (n DatasetName) String() string {
+	switch {
+	case n.Snapshot != "":
+		return n.Path + "@" + n.Snapshot
+	case n.Bookmark != "":
+		return n.Path + "#" + n.Bookmark
+	}
+	return n.Path
+}
+
+// ParseDatasetName checks that name is a valid name of a filesystem, volume, snapshot or bookmark and decomposes it,
+// applying the rules of the zfs command, so invalid names can be rejected before any command is run.
+// A *NameError describing the first problem is returned if the name is invalid.
+func ParseDatasetName(name string) (DatasetName, error) {
+	var n DatasetName
+	if len(name) > MaxNameLen {
+		return n, &NameError{Name: name, Reason: fmt.Sprintf("longer than %d characters", MaxNameLen)}
+	}
+	n.Path = name
+	if i := strings.IndexAny(name, "@#"); i >= 0 {
+		n.Path = name[:i]
+		part := name[i+1:]
+		if strings.ContainsAny(part, "@#") {
+			return n, &NameError{Name: name, Reason: "multiple '@' and/or '#' delimiters"}
+		}
+		if err := checkComponent(name, part); err != nil {
+			return n, err
+		}
+		if name[i] == '@' {
+			n.Snapshot = part
+		} else {
+			n.Bookmark = part
+		}
+	}
+	switch {
+	case n.Path == "":
+		return n, &NameError{Name: name, Reason: "empty name"}
+	case strings.HasPrefix(n.Path, "/"):
+		return n, &NameError{Name: name, Reason: "leading slash"}
+	case strings.HasSuffix(n.Path, "/"):
+		return n, &NameError{Name: name, Reason: "trailing slash"}
+	}
+	components := strings.Split(n.Path, "/")
+	n.Pool = components[0]
+	if err := checkPoolName(name, n.Pool); err != nil {
+		return n, err
+	}
+	for _, c := range components[1:] {
+		if err := checkComponent(name, c); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// ValidateDatasetName returns a *NameError if name is not a valid name of a filesystem, volume, snapshot or bookmark.
+func ValidateDatasetName(name string) error {
+	_, err := ParseDatasetName(name)
+	return err
+}
+
+// ValidatePoolName returns a *NameError if name is not a valid pool name. Pool names must begin with a letter and
+// must not be, or begin with, a word zpool create reserves for vdev types, such as "mirror" or "raidz".
+func ValidatePoolName(name string) error {
+	if len(name) > MaxNameLen {
+		return &NameError{Name: name, Reason: fmt.Sprintf("longer than %d characters", MaxNameLen)}
+	}
+	return checkPoolName(name, name)
+}
+
+// reservedPoolNames are the vdev types which pool names must not begin with.
+var reservedPoolNames = []string{"mirror", "raidz", "draid", "spare"}
+
+func checkPoolName(name, pool string) error {
+	if pool == "" {
+		return &NameError{Name: name, Reason: "empty pool name"}
+	}
+	if c := pool[0]; !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z') {
+		return &NameError{Name: name, Reason: "pool name must begin with a letter"}
+	}
+	if pool == "log" {
+		return &NameError{Name: name, Reason: fmt.Sprintf("pool name %q is reserved", pool)}
+	}
+	for _, reserved := range reservedPoolNames {
+		if strings.HasPrefix(pool, reserved) {
+			return &NameError{Name: name, Reason: fmt.Sprintf("pool name begins with the reserved word %q", reserved)}
+		}
+	}
+	// names such as c0t0d0 are those of disks on illumos
+	if len(pool) > 1 && pool[0] == 'c' && pool[1] >= '0' && pool[1] <= '9' {
+		return &NameError{Name: name, Reason: "pool name is reserved for disk names"}
+	}
+	return checkComponent(name, pool)
+}
+
+// checkComponent checks a single component of a name, between slashes or after the "@" or "#" delimiter.
+func checkComponent(name, component string) error {
+	switch component {
+	case "":
+		return &NameError{Name: name, Reason: "empty component"}
+	case ".", "..":
+		return &NameError{Name: name, Reason: fmt.Sprintf("component %q is not allowed", component)}
+	}
+	for _, r := range component {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', strings.ContainsRune("-_.: ", r):
+		default:
+			return &NameError{Name: name, Reason: fmt.Sprintf("invalid character %q in component %q", r, component)}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package zfs
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseDatasetName(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		want DatasetName
+	}{
+		{"tank", DatasetName{Pool: "tank", Path: "tank"}},
+		{"tank/vm/disk-0_a.b:c", DatasetName{Pool: "tank", Path: "tank/vm/disk-0_a.b:c"}},
+		{"tank/fs@auto 2021", DatasetName{Pool: "tank", Path: "tank/fs", Snapshot: "auto 2021"}},
+		{"tank@snap", DatasetName{Pool: "tank", Path: "tank", Snapshot: "snap"}},
+		{"tank/fs#mark", DatasetName{Pool: "tank", Path: "tank/fs", Bookmark: "mark"}},
+	} {
+		got, err := ParseDatasetName(tc.name)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", tc.name, err)
+		}
+		if got != tc.want {
+			t.Fatalf("want: %+v, got: %+v", tc.want, got)
+		}
+		if got.String() != tc.name {
+			t.Fatalf("want: %q, got: %q", tc.name, got.String())
+		}
+	}
+}
+
+func TestParseDatasetNameErrors(t *testing.T) {
+	for name, reason := range map[string]string{
+		"":            "empty name",
+		"/tank/fs":    "leading slash",
+		"tank/fs/":    "trailing slash",
+		"tank//fs":    "empty component",
+		"tank/../fs":  `component ".." is not allowed`,
+		"tank/a*b":    `invalid character '*' in component "a*b"`,
+		"tank/fs@a@b": "multiple '@' and/or '#' delimiters",
+		"tank/fs@a#b": "multiple '@' and/or '#' delimiters",
+		"tank/fs@":    "empty component",
+		"tank/fs@a/b": `invalid character '/' in component "a/b"`,
+		"1tank/fs":    "pool name must begin with a letter",
+		"mirror0/fs":  `pool name begins with the reserved word "mirror"`,
+		"c0t0d0":      "pool name is reserved for disk names",
+		"tank/" + strings.Repeat("a", MaxNameLen): "longer than 255 characters",
+	} {
+		_, err := ParseDatasetName(name)
+		var nerr *NameError
+		if !errors.As(err, &nerr) {
+			t.Fatalf("expected name error for %q, got %v", name, err)
+		}
+		if nerr.Reason != reason {
+			t.Fatalf("reason for %q: want %q, got %q", name, reason, nerr.Reason)
+		}
+		if !errors.Is(err, ErrInvalidName) {
+			t.Fatalf("expected %v to match ErrInvalidName", err)
+		}
+	}
+}
+
+func TestValidatePoolName(t *testing.T) {
+	for _, name := range []string{"tank", "Data-1", "logs", "c"} {
+		if err := ValidatePoolName(name); err != nil {
+			t.Fatalf("unexpected error for %q: %v", name, err)
+		}
+	}
+	for _, name := range []string{"log", "raidz2", "spare-pool", "draid", "tank/fs", "tank@snap", "_tank"} {
+		if err := ValidatePoolName(name); err == nil {
+			t.Fatalf("expected error for %q", name)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package zfs
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SetProjectQuota limits the space used by the files of the project with the given ID in the dataset, zero removes the quota.
+func (d *Dataset) SetProjectQuota(id, bytes uint64) error {
+	return d.SetProjectQuotaContext(context.Background(), id, bytes)
+}
+
+// SetProjectQuotaContext is like SetProjectQuota but includes a context.
+func (d *Dataset) SetProjectQuotaContext(ctx context.Context, id, bytes uint64) error {
+	return d.setSpaceLimit(ctx, "projectquota@"+strconv.FormatUint(id, 10), bytes)
+}
+
+// SetProjectObjectQuota limits the number of files of the project with the given ID in the dataset, zero removes the quota.
+func (d *Dataset) SetProjectObjectQuota(id, objects uint64) error {
+	return d.SetProjectObjectQuotaContext(context.Background(), id, objects)
+}
+
+// SetProjectObjectQuotaContext is like SetProjectObjectQuota but includes a context.
+func (d *Dataset) SetProjectObjectQuotaContext(ctx context.Context, id, objects uint64) error {
+	return d.setSpaceLimit(ctx, "projectobjquota@"+strconv.FormatUint(id, 10), objects)
+}
+
+// ProjectID is the project of a file or directory, as reported by zfs project.
+type ProjectID struct {
+	Path string
+	ID   uint64
+	// Inherit reports whether files created in the directory are assigned its project.
+	Inherit bool
+}
+
+// ProjectOptions are the options which can be passed to SetProject and ClearProject.
+//
+// A full description of the options may be found in the ZFS manual:
+// https://openzfs.github.io/openzfs-docs/man/8/zfs-project.8.html.
+type ProjectOptions struct {
+	// Recursive applies to all files and directories below the given directory as well (-r).
+	Recursive bool
+	// Inherit sets the flag to assign the project to files created in directories (-s).
+	// It only applies to SetProject.
+	Inherit bool
+	// KeepID only clears the inherit flag, keeping the project ID (-k). It only applies to ClearProject.
+	KeepID bool
+}
+
+// GetProject returns the project of a file or directory in a ZFS file system.
+func GetProject(path string) (*ProjectID, error) {
+	return GetProjectContext(context.Background(), path)
+}
+
+// GetProjectContext is like GetProject but includes a context.
+func GetProjectContext(ctx context.Context, path string) (*ProjectID, error) {
+	out, err := zfsRawOutput(ctx, "project", "-d", path)
+	if err != nil {
+		return nil, err
+	}
+	projects, err := parseProjects(string(out))
+	if err != nil {
+		return nil, err
+	}
+	if len(projects) != 1 {
+		return nil, fmt.Errorf("expected project of one file, got %d", len(projects))
+	}
+	return projects[0], nil
+}
+
+// SetProject assigns the project with the given ID to a file or directory in a ZFS file system, as configured by opts.
+func SetProject(path string, id uint64, opts ProjectOptions) error {
+	return SetProjectContext(context.Background(), path, id, opts)
+}
+
+// SetProjectContext is like SetProject but includes a context.
+func SetProjectContext(ctx context.Context, path string, id uint64, opts ProjectOptions) error {
+	args := []string{"project", "-p", strconv.FormatUint(id, 10)}
+	if opts.Recursive {
+		args = append(args, "-r")
+	}
+	if opts.Inherit {
+		args = append(args, "-s")
+	}
+	return zfs(ctx, append(args, path)...)
+}
+
+// ClearProject clears the project ID and inherit flag of a file or directory in a ZFS file system, as configured by opts.
+func ClearProject(path string, opts ProjectOptions) error {
+	return ClearProjectContext(context.Background(), path, opts)
+}
+
+// ClearProjectContext is like ClearProject but includes a context.
+func ClearProjectContext(ctx context.Context, path string, opts ProjectOptions) error {
+	args := []string{"project", "-C"}
+	if opts.KeepID {
+		args = append(args, "-k")
+	}
+	if opts.Recursive {
+		args = append(args, "-r")
+	}
+	return zfs(ctx, append(args, path)...)
+}
+
+// CheckProject returns the files below a directory in a ZFS file system whose project ID differs from id,
+// or which lack the inherit flag. If id is zero the project ID of the directory is checked against.
+// Optionally, the whole tree below the directory is checked rather than only its direct entries.
+func CheckProject(path string, id uint64, recursive bool) ([]string, error) {
+	return CheckProjectContext(context.Background(), path, id, recursive)
+}
+
+// CheckProjectContext is like CheckProject but includes a context.
+func CheckProjectContext(ctx context.Context, path string, id uint64, recursive bool) ([]string, error) {
+	args := []string{"project", "-c", "-0"}
+	if id != 0 {
+		args = append(args, "-p", strconv.FormatUint(id, 10))
+	}
+	if recursive {
+		args = append(args, "-r")
+	}
+	out, err := zfsRawOutput(ctx, append(args, path)...)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, p := range strings.Split(string(out), "\x00") {
+		if p != "" {
+			paths = append(paths, p)
+		}
+	}
+	return paths, nil
+}
+
+// example input for parseProjects
+//   100 P /tank/shared/dir
+//     0 - /tank/shared/file
+
+func parseProjects(out string) ([]*ProjectID, error) {
+	var projects []*ProjectID
+	for _, line := range strings.Split(out, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		fields := strings.SplitN(strings.TrimLeft(line, " "), " ", 3)
+		if len(fields) != 3 || (fields[1] != "P" && fields[1] != "-") {
+			return nil, fmt.Errorf("invalid project %q", line)
+		}
+		id, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid project ID of %s: %w", fields[2], err)
+		}
+		projects = append(projects, &ProjectID{Path: fields[2], ID: id, Inherit: fields[1] == "P"})
+	}
+	return projects, nil
+}
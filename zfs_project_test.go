@@ -0,0 +1,64 @@
+package zfs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestProjectQuota(t *testing.T) {
+	ctx, r := withFakeRunner("")
+	d := &Dataset{Name: "tank/shared"}
+	if err := d.SetProjectQuotaContext(ctx, 100, 1<<30); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetProjectObjectQuotaContext(ctx, 100, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetProjectContext(ctx, "/tank/shared/dir", 100, ProjectOptions{Recursive: true, Inherit: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ClearProjectContext(ctx, "/tank/shared/dir", ProjectOptions{KeepID: true}); err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"zfs", "set", "projectquota@100=1073741824", "tank/shared"},
+		{"zfs", "set", "projectobjquota@100=none", "tank/shared"},
+		{"zfs", "project", "-p", "100", "-r", "-s", "/tank/shared/dir"},
+		{"zfs", "project", "-C", "-k", "/tank/shared/dir"},
+	}
+	if !reflect.DeepEqual(want, r.calls) {
+		t.Fatalf("want calls: %q, got: %q", want, r.calls)
+	}
+}
+
+func TestGetProject(t *testing.T) {
+	ctx, r := withFakeRunner("  100 P /tank/shared/dir with space\n")
+	p, err := GetProjectContext(ctx, "/tank/shared/dir with space")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (&ProjectID{Path: "/tank/shared/dir with space", ID: 100, Inherit: true}); !reflect.DeepEqual(want, p) {
+		t.Fatalf("want: %+v, got: %+v", want, p)
+	}
+	if want := [][]string{{"zfs", "project", "-d", "/tank/shared/dir with space"}}; !reflect.DeepEqual(want, r.calls) {
+		t.Fatalf("want calls: %q, got: %q", want, r.calls)
+	}
+
+	if _, err := parseProjects("abc - /tank/file\n"); err == nil {
+		t.Fatal("expected error for invalid project ID")
+	}
+}
+
+func TestCheckProject(t *testing.T) {
+	ctx, r := withFakeRunner("/tank/shared/dir/a\x00/tank/shared/dir/b\x00")
+	paths, err := CheckProjectContext(ctx, "/tank/shared/dir", 100, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"/tank/shared/dir/a", "/tank/shared/dir/b"}; !reflect.DeepEqual(want, paths) {
+		t.Fatalf("want: %q, got: %q", want, paths)
+	}
+	if want := [][]string{{"zfs", "project", "-c", "-0", "-p", "100", "-r", "/tank/shared/dir"}}; !reflect.DeepEqual(want, r.calls) {
+		t.Fatalf("want calls: %q, got: %q", want, r.calls)
+	}
+}
@@ -0,0 +1,209 @@
+package zfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// maxUserPropertyLen is the maximum length of a user property name, one less than ZAP_MAXNAMELEN.
+const maxUserPropertyLen = 255
+
+// validateUserPropertyName checks that name is a valid user property name of the form "module:property".
+func validateUserPropertyName(name string) error {
+	if !strings.Contains(name, ":") {
+		return fmt.Errorf("invalid user property %q: must contain a colon", name)
+	}
+	if len(name) > maxUserPropertyLen {
+		return fmt.Errorf("invalid user property %q: longer than %d characters", name, maxUserPropertyLen)
+	}
+	for _, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', strings.ContainsRune(":.-_", r):
+		default:
+			return fmt.Errorf("invalid user property %q: invalid character %q", name, r)
+		}
+	}
+	return nil
+}
+
+// SetUserProperty sets a user property on the receiving dataset.
+// User property names must contain a colon, e.g. "com.example:owner", to distinguish them from native properties.
+func (d *Dataset) SetUserProperty(key, val string) error {
+	return d.SetUserPropertyContext(context.Background(), key, val)
+}
+
+// SetUserPropertyContext is like SetUserProperty but includes a context.
+func (d *Dataset) SetUserPropertyContext(ctx context.Context, key, val string) error {
+	if err := validateUserPropertyName(key); err != nil {
+		return err
+	}
+	return d.SetPropertyContext(ctx, key, val)
+}
+
+// SetProperties sets several properties of the receiving dataset with a single invocation of zfs set,
+// rather than one per property as SetProperty does.
+func (d *Dataset) SetProperties(properties map[string]string) error {
+	return d.SetPropertiesContext(context.Background(), properties)
+}
+
+// SetPropertiesContext is like SetProperties but includes a context.
+func (d *Dataset) SetPropertiesContext(ctx context.Context, properties map[string]string) error {
+	return SetPropertiesBatchContext(ctx, []string{d.Name}, properties)
+}
+
+// SetPropertiesBatch sets the same properties on all of the given datasets with as few invocations of zfs set as
+// possible, each setting all properties on a batch of datasets. It stops at the first batch which fails, the
+// datasets of earlier batches keep their new values.
+//
+// Properties can also be set on creation, e.g. with the properties of CreateFilesystem, which passes them to
+// zfs create.
+func SetPropertiesBatch(datasets []string, properties map[string]string) error {
+	return SetPropertiesBatchContext(context.Background(), datasets, properties)
+}
+
+// SetPropertiesBatchContext is like SetPropertiesBatch but includes a context.
+func SetPropertiesBatchContext(ctx context.Context, datasets []string, properties map[string]string) error {
+	if len(properties) == 0 {
+		return errors.New("no properties to set given")
+	}
+	assignments := make([]string, 0, len(properties))
+	for key, value := range properties {
+		if key == "" || strings.ContainsAny(key, "= \t") {
+			return fmt.Errorf("invalid property %q", key)
+		}
+		assignments = append(assignments, key+"="+value)
+	}
+	if err := validateProperties(ctx, properties); err != nil {
+		return err
+	}
+	sort.Strings(assignments)
+	if len(datasets) == 0 {
+		return errors.New("no datasets given")
+	}
+	for _, name := range datasets {
+		if name == "" {
+			return errors.New("empty dataset name")
+		}
+	}
+	for _, batch := range batches(datasets) {
+		args := append(append([]string{"set"}, assignments...), batch...)
+		if err := zfs(ctx, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InheritProperty clears the local value of a property of the receiving dataset, so it inherits the value of its
+// parent, or the default value if no ancestor sets it. If recursive is set, the property is cleared on all
+// descendents as well (-r), e.g. to reset the mountpoints or compression of a subtree.
+func (d *Dataset) InheritProperty(name string, recursive bool) error {
+	return d.InheritPropertyContext(context.Background(), name, recursive)
+}
+
+// InheritPropertyContext is like InheritProperty but includes a context.
+func (d *Dataset) InheritPropertyContext(ctx context.Context, name string, recursive bool) error {
+	return inheritProperty(ctx, d.Name, name, recursive, false)
+}
+
+// RevertReceivedProperty clears the local value of a property of the receiving dataset, reverting it to the value
+// received with a send stream, or if there is none, to the inherited value (-S).
+// If recursive is set, the property is reverted on all descendents as well (-r).
+func (d *Dataset) RevertReceivedProperty(name string, recursive bool) error {
+	return d.RevertReceivedPropertyContext(context.Background(), name, recursive)
+}
+
+// RevertReceivedPropertyContext is like RevertReceivedProperty but includes a context.
+func (d *Dataset) RevertReceivedPropertyContext(ctx context.Context, name string, recursive bool) error {
+	return inheritProperty(ctx, d.Name, name, recursive, true)
+}
+
+func inheritProperty(ctx context.Context, dataset, name string, recursive, received bool) error {
+	if name == "" || strings.ContainsAny(name, "= \t") {
+		return fmt.Errorf("invalid property %q", name)
+	}
+	args := []string{"inherit"}
+	if recursive {
+		args = append(args, "-r")
+	}
+	if received {
+		args = append(args, "-S")
+	}
+	return zfs(ctx, append(args, name, dataset)...)
+}
+
+// GetPropertySource returns where the value of a property of the receiving dataset comes from, e.g. the ancestor
+// it is inherited from. Dataset.Properties returns the sources of all properties.
+func (d *Dataset) GetPropertySource(name string) (PropertySource, error) {
+	return d.GetPropertySourceContext(context.Background(), name)
+}
+
+// GetPropertySourceContext is like GetPropertySource but includes a context.
+func (d *Dataset) GetPropertySourceContext(ctx context.Context, name string) (PropertySource, error) {
+	out, err := zfsOutput(ctx, "get", "-Hp", "-o", "source", name, d.Name)
+	if err != nil {
+		return PropertySource{}, err
+	}
+	if len(out) != 1 || len(out[0]) != 1 {
+		return PropertySource{}, fmt.Errorf("unexpected output of zfs get: %q", out)
+	}
+	return ParsePropertySource(out[0][0]), nil
+}
+
+// GetUserProperties returns all user properties set on or inherited by the receiving dataset, keyed by property name.
+func (d *Dataset) GetUserProperties() (map[string]Property, error) {
+	return d.GetUserPropertiesContext(context.Background())
+}
+
+// GetUserPropertiesContext is like GetUserProperties but includes a context.
+func (d *Dataset) GetUserPropertiesContext(ctx context.Context) (map[string]Property, error) {
+	out, err := zfsOutput(ctx, "get", "-Hp", "-o", "name,property,value,source", "all", d.Name)
+	if err != nil {
+		return nil, err
+	}
+	props, err := parsePropertyLines(out)
+	if err != nil {
+		return nil, err
+	}
+	for name := range props {
+		if !strings.Contains(name, ":") {
+			delete(props, name)
+		}
+	}
+	return props, nil
+}
+
+// DatasetsByUserProperty returns a slice of ZFS datasets of any type whose user property key has the given value.
+func DatasetsByUserProperty(key, value string) ([]*Dataset, error) {
+	return DatasetsByUserPropertyContext(context.Background(), key, value)
+}
+
+// DatasetsByUserPropertyContext is like DatasetsByUserProperty but includes a context.
+func DatasetsByUserPropertyContext(ctx context.Context, key, value string) ([]*Dataset, error) {
+	if err := validateUserPropertyName(key); err != nil {
+		return nil, err
+	}
+	out, err := zfsListOutput(ctx, "list", "-rHp", "-t", "all", "-o", dsPropListOptions+","+key)
+	if err != nil {
+		return nil, err
+	}
+
+	var datasets []*Dataset
+	for _, line := range out {
+		if len(line) != len(dsPropList)+1 {
+			return nil, errors.New("output does not match what is expected on this platform")
+		}
+		if line[len(dsPropList)] != value {
+			continue
+		}
+		ds := &Dataset{}
+		if err := ds.parseLine(line[:len(dsPropList)]); err != nil {
+			return nil, err
+		}
+		datasets = append(datasets, ds)
+	}
+	return datasets, nil
+}
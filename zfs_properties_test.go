@@ -0,0 +1,85 @@
+package zfs
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateUserPropertyName(t *testing.T) {
+	for _, name := range []string{"com.example:owner", "a:b", "org.foo:retention-days_v2", "a:" + strings.Repeat("b", 253)} {
+		if err := validateUserPropertyName(name); err != nil {
+			t.Fatalf("unexpected error for %q: %v", name, err)
+		}
+	}
+	for _, name := range []string{"compression", "Com.Example:owner", "com.example:own er", ":" + strings.Repeat("a", 255), "com.example:a+b"} {
+		if err := validateUserPropertyName(name); err == nil {
+			t.Fatalf("expected error for %q", name)
+		}
+	}
+}
+
+func TestInheritProperty(t *testing.T) {
+	ctx, r := withFakeRunner("inherited from tank\n")
+	d := &Dataset{Name: "tank/fs"}
+	if err := d.InheritPropertyContext(ctx, "mountpoint", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.InheritPropertyContext(ctx, "compression", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.RevertReceivedPropertyContext(ctx, "com.example:role", true); err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"zfs", "inherit", "mountpoint", "tank/fs"},
+		{"zfs", "inherit", "-r", "compression", "tank/fs"},
+		{"zfs", "inherit", "-r", "-S", "com.example:role", "tank/fs"},
+	}
+	if !reflect.DeepEqual(want, r.calls) {
+		t.Fatalf("want: %q, got: %q", want, r.calls)
+	}
+	if err := d.InheritPropertyContext(ctx, "compression=lz4", false); err == nil {
+		t.Fatal("expected error for invalid property")
+	}
+
+	source, err := d.GetPropertySourceContext(ctx, "compression")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (PropertySource{Kind: SourceInherited, From: "tank"}); source != want {
+		t.Fatalf("want: %+v, got: %+v", want, source)
+	}
+}
+
+func TestSetProperties(t *testing.T) {
+	ctx, r := withFakeRunner("")
+	props := map[string]string{"compression": "lz4", "atime": "off", "com.example:role": "db"}
+	if err := (&Dataset{Name: "tank/fs"}).SetPropertiesContext(ctx, props); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetPropertiesBatchContext(ctx, []string{"tank/a", "tank/b"}, map[string]string{"quota": "1G"}); err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"zfs", "set", "atime=off", "com.example:role=db", "compression=lz4", "tank/fs"},
+		{"zfs", "set", "quota=1G", "tank/a", "tank/b"},
+	}
+	if !reflect.DeepEqual(want, r.calls) {
+		t.Fatalf("want: %q, got: %q", want, r.calls)
+	}
+
+	for _, test := range []struct {
+		datasets []string
+		props    map[string]string
+	}{
+		{[]string{"tank/fs"}, nil},
+		{[]string{"tank/fs"}, map[string]string{"a=b": "c"}},
+		{nil, map[string]string{"atime": "off"}},
+		{[]string{""}, map[string]string{"atime": "off"}},
+	} {
+		if err := SetPropertiesBatchContext(ctx, test.datasets, test.props); err == nil {
+			t.Fatalf("expected error setting %v on %q", test.props, test.datasets)
+		}
+	}
+}
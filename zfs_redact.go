@@ -0,0 +1,89 @@
+package zfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Redact creates a redaction bookmark of the receiving snapshot, using the specified name, for sending redacted
+// streams with SendOptions.Redact. The bookmark records the blocks of the snapshot which were changed or removed
+// in the given redaction snapshots, which must be snapshots of clones of the receiving snapshot, e.g. clones in which
+// sensitive files were overwritten or deleted. A redacted stream omits those blocks.
+// An error will be returned if the input dataset is not of snapshot type.
+//
+// A full description of redaction may be found in the ZFS manual:
+// https://openzfs.github.io/openzfs-docs/man/8/zfs-redact.8.html.
+func (d *Dataset) Redact(name string, redactionSnapshots []string) (*Dataset, error) {
+	return d.RedactContext(context.Background(), name, redactionSnapshots)
+}
+
+// RedactContext is like Redact but includes a context.
+func (d *Dataset) RedactContext(ctx context.Context, name string, redactionSnapshots []string) (*Dataset, error) {
+	if d.Type != DatasetSnapshot {
+		return nil, errors.New("can only redact snapshots")
+	}
+	i := strings.IndexByte(d.Name, '@')
+	if i < 0 {
+		return nil, fmt.Errorf("invalid snapshot name %q", d.Name)
+	}
+	if strings.ContainsAny(name, "@#/") {
+		return nil, fmt.Errorf("invalid bookmark name %q", name)
+	}
+	if len(redactionSnapshots) == 0 {
+		return nil, errors.New("no redaction snapshots given")
+	}
+	for _, snap := range redactionSnapshots {
+		if !strings.Contains(snap, "@") {
+			return nil, fmt.Errorf("invalid redaction snapshot name %q", snap)
+		}
+	}
+	args := append([]string{"redact", d.Name, name}, redactionSnapshots...)
+	if err := zfs(ctx, args...); err != nil {
+		return nil, err
+	}
+	return GetDatasetContext(ctx, d.Name[:i]+"#"+name)
+}
+
+// RedactClones creates a redaction bookmark of the receiving snapshot with Redact, using the most recent snapshot
+// of each clone of the snapshot as the redaction snapshots. This redacts every block which was changed or removed
+// in any of the clones, such as a set of clones each scrubbing a different kind of sensitive data.
+// An error is returned if the snapshot has no clones, or if one of them has no snapshots.
+func (d *Dataset) RedactClones(name string) (*Dataset, error) {
+	return d.RedactClonesContext(context.Background(), name)
+}
+
+// RedactClonesContext is like RedactClones but includes a context.
+func (d *Dataset) RedactClonesContext(ctx context.Context, name string) (*Dataset, error) {
+	if d.Type != DatasetSnapshot {
+		return nil, errors.New("can only redact snapshots")
+	}
+	graph, err := GetOriginGraphContext(ctx, strings.SplitN(d.Name, "/", 2)[0])
+	if err != nil {
+		return nil, err
+	}
+	clones := graph.Clones(d.Name)
+	if len(clones) == 0 {
+		return nil, fmt.Errorf("snapshot %s has no clones", d.Name)
+	}
+	snapshots := make([]string, 0, len(clones))
+	for _, clone := range clones {
+		snaps, err := SnapshotsContext(ctx, clone)
+		if err != nil {
+			return nil, err
+		}
+		latest := ""
+		for _, s := range snaps {
+			// the snapshots of descendents of the clone are listed as well
+			if strings.HasPrefix(s.Name, clone+"@") {
+				latest = s.Name
+			}
+		}
+		if latest == "" {
+			return nil, fmt.Errorf("clone %s of %s has no snapshots", clone, d.Name)
+		}
+		snapshots = append(snapshots, latest)
+	}
+	return d.RedactContext(ctx, name, snapshots)
+}
@@ -0,0 +1,32 @@
+package zfs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	ctx, r := withFakeRunner("")
+	snap := &Dataset{Name: "tank/data@base", Type: DatasetSnapshot}
+	// the fake lists no datasets, so looking up the bookmark fails after redacting
+	_, _ = snap.RedactContext(ctx, "scrubbed", []string{"tank/scrub@s1", "tank/scrub2@s1"})
+	if want := []string{"zfs", "redact", "tank/data@base", "scrubbed", "tank/scrub@s1", "tank/scrub2@s1"}; len(r.calls) == 0 || !reflect.DeepEqual(want, r.calls[0]) {
+		t.Fatalf("want call: %q, got: %q", want, r.calls)
+	}
+
+	for _, test := range []struct {
+		name      string
+		snapshots []string
+	}{
+		{"tank/data#scrubbed", []string{"tank/scrub@s1"}},
+		{"scrubbed", nil},
+		{"scrubbed", []string{"tank/scrub"}},
+	} {
+		if _, err := snap.RedactContext(ctx, test.name, test.snapshots); err == nil {
+			t.Fatalf("expected error redacting into %q with %q", test.name, test.snapshots)
+		}
+	}
+	if _, err := (&Dataset{Name: "tank/data", Type: DatasetFilesystem}).RedactContext(ctx, "scrubbed", []string{"tank/scrub@s1"}); err == nil {
+		t.Fatal("expected error redacting a filesystem")
+	}
+}
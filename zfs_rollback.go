@@ -0,0 +1,123 @@
+package zfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// RollbackOptions are the options which can be passed to RollbackWithOptions.
+//
+// A full description of the options may be found in the ZFS manual:
+// https://openzfs.github.io/openzfs-docs/man/8/zfs-rollback.8.html.
+type RollbackOptions struct {
+	// DestroyMoreRecent destroys the snapshots and bookmarks more recent than the snapshot (-r).
+	DestroyMoreRecent bool
+	// DestroyClones destroys the more recent snapshots and bookmarks as well as their clones (-R).
+	DestroyClones bool
+	// Force unmounts the clones which are destroyed, it only applies with DestroyClones (-f).
+	Force bool
+}
+
+func (o *RollbackOptions) args() []string {
+	var args []string
+	if o.DestroyMoreRecent {
+		args = append(args, "-r")
+	}
+	if o.DestroyClones {
+		args = append(args, "-R")
+	}
+	if o.Force {
+		args = append(args, "-f")
+	}
+	return args
+}
+
+// RollbackWithOptions rolls back the filesystem or volume of the receiving snapshot to it, as configured by opts.
+// RollbackPreview reports what the rollback destroys.
+func (d *Dataset) RollbackWithOptions(opts RollbackOptions) error {
+	return d.RollbackWithOptionsContext(context.Background(), opts)
+}
+
+// RollbackWithOptionsContext is like RollbackWithOptions but includes a context.
+func (d *Dataset) RollbackWithOptionsContext(ctx context.Context, opts RollbackOptions) error {
+	if d.Type != DatasetSnapshot {
+		return errors.New("can only rollback snapshots")
+	}
+	if opts.Force && !opts.DestroyClones {
+		return errors.New("force only applies when destroying clones")
+	}
+	return zfs(ctx, append(append([]string{"rollback"}, opts.args()...), d.Name)...)
+}
+
+// RollbackPreview lists what rolling back to a snapshot destroys.
+type RollbackPreview struct {
+	// MoreRecent holds the snapshots and bookmarks more recent than the snapshot, in listing order.
+	// Rolling back requires DestroyMoreRecent if there are any.
+	MoreRecent []string
+	// Dependents holds the clones of the more recent snapshots, and the datasets depending on them,
+	// in the order they are destroyed. Rolling back requires DestroyClones if there are any.
+	Dependents []string
+}
+
+// RollbackPreview returns what rolling back to the receiving snapshot destroys, without changing anything,
+// so that callers can ask for confirmation before a destructive rollback.
+func (d *Dataset) RollbackPreview() (*RollbackPreview, error) {
+	return d.RollbackPreviewContext(context.Background())
+}
+
+// RollbackPreviewContext is like RollbackPreview but includes a context.
+func (d *Dataset) RollbackPreviewContext(ctx context.Context) (*RollbackPreview, error) {
+	if d.Type != DatasetSnapshot {
+		return nil, errors.New("can only rollback snapshots")
+	}
+	fs := d.Name[:strings.IndexByte(d.Name, '@')]
+	out, err := zfsListOutput(ctx, "list", "-Hp", "-d", "1", "-t", "snapshot,bookmark", "-o", "name,createtxg", fs)
+	if err != nil {
+		return nil, err
+	}
+	txgs := make(map[string]uint64, len(out))
+	for _, line := range out {
+		if len(line) != 2 {
+			return nil, fmt.Errorf("invalid snapshot %q", strings.Join(line, "\t"))
+		}
+		var txg uint64
+		if err := setUint(&txg, line[1]); err != nil {
+			return nil, fmt.Errorf("invalid createtxg of %s: %w", line[0], err)
+		}
+		txgs[line[0]] = txg
+	}
+	txg, ok := txgs[d.Name]
+	if !ok {
+		return nil, fmt.Errorf("snapshot %s not listed", d.Name)
+	}
+	p := &RollbackPreview{}
+	for _, line := range out {
+		if txgs[line[0]] > txg {
+			p.MoreRecent = append(p.MoreRecent, line[0])
+		}
+	}
+
+	var snapshots []string
+	for _, name := range p.MoreRecent {
+		if strings.Contains(name, "@") {
+			snapshots = append(snapshots, name)
+		}
+	}
+	if len(snapshots) == 0 {
+		return p, nil
+	}
+	graph, err := GetOriginGraphContext(ctx, strings.SplitN(fs, "/", 2)[0])
+	if err != nil {
+		return nil, err
+	}
+	for _, snap := range snapshots {
+		order := graph.DestroyOrder(snap)
+		if len(order) > 0 {
+			// the snapshot itself comes last
+			p.Dependents = append(p.Dependents, order[:len(order)-1]...)
+		}
+	}
+	return p, nil
+}
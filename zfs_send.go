@@ -0,0 +1,390 @@
+package zfs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SendOptions are the options which can be passed to SendTo.
+//
+// A full description of the options may be found in the ZFS manual:
+// https://openzfs.github.io/openzfs-docs/man/8/zfs-send.8.html.
+type SendOptions struct {
+	// From is the snapshot (or bookmark) to use as the incremental source, if empty a full stream is sent.
+	From string
+	// Intermediary sends all intermediary snapshots between From and the sent snapshot (-I instead of -i).
+	Intermediary bool
+	// Replicate sends a replication stream of the dataset and all its descendents (-R).
+	Replicate bool
+	// Compressed sends compressed blocks as they are stored on disk (-c).
+	Compressed bool
+	// LargeBlocks allows blocks larger than 128KiB in the stream (-L).
+	LargeBlocks bool
+	// Raw sends encrypted datasets as they are stored on disk (-w).
+	Raw bool
+	// Redact is the redaction bookmark of the sent snapshot, created with Redact, whose redacted blocks are omitted
+	// from the stream (--redact). It cannot be combined with Replicate.
+	Redact string
+	// Progress is called with the bytes sent so far and the estimated size of the stream, as returned by SendEstimate,
+	// at most every second while sending and once more when the stream is complete.
+	Progress func(sent, total uint64)
+}
+
+func (o *SendOptions) args() ([]string, error) {
+	var args []string
+	if o.Replicate {
+		args = append(args, "-R")
+	}
+	if o.Compressed {
+		args = append(args, "-c")
+	}
+	if o.LargeBlocks {
+		args = append(args, "-L")
+	}
+	if o.Raw {
+		args = append(args, "-w")
+	}
+	if o.Redact != "" {
+		if o.Replicate {
+			return nil, errors.New("redacted streams cannot be replication streams")
+		}
+		args = append(args, "--redact", o.Redact)
+	}
+	if o.From != "" {
+		if o.Intermediary {
+			args = append(args, "-I", o.From)
+		} else {
+			args = append(args, "-i", o.From)
+		}
+	} else if o.Intermediary {
+		return nil, errors.New("intermediary snapshots can only be sent with an incremental source")
+	}
+	return args, nil
+}
+
+// ReceiveOptions are the options which can be passed to ReceiveFrom.
+//
+// A full description of the options may be found in the ZFS manual:
+// https://openzfs.github.io/openzfs-docs/man/8/zfs-receive.8.html.
+type ReceiveOptions struct {
+	// Force rolls back the target to its most recent snapshot before receiving (-F).
+	Force bool
+	// Resumable saves the state of an interrupted receive, so it can be resumed with ResumeSend (-s).
+	Resumable bool
+	// Properties override the properties of the received filesystem or volume (-o property=value),
+	// e.g. to receive a backup with canmount=off, readonly=on or a different mountpoint.
+	Properties map[string]string
+	// Exclude lists properties which are not received, so that they are inherited instead (-x).
+	Exclude []string
+	// NoMount does not mount the received filesystems (-u).
+	NoMount bool
+	// DiscardPool receives into the target followed by the name of the sent dataset without its pool (-d).
+	DiscardPool bool
+	// LastElement receives into the target followed by the last element of the name of the sent dataset (-e).
+	LastElement bool
+	// Progress is called with the bytes received so far and Size at most every second while receiving
+	// and once more when the stream is complete.
+	Progress func(received, total uint64)
+	// Size is the expected size of the stream passed to Progress, e.g. from SendEstimate, zero if unknown.
+	Size uint64
+}
+
+func (o *ReceiveOptions) args() ([]string, error) {
+	var args []string
+	if o.Force {
+		args = append(args, "-F")
+	}
+	if o.Resumable {
+		args = append(args, "-s")
+	}
+	if o.NoMount {
+		args = append(args, "-u")
+	}
+	switch {
+	case o.DiscardPool && o.LastElement:
+		return nil, errors.New("cannot receive with both DiscardPool and LastElement")
+	case o.DiscardPool:
+		args = append(args, "-d")
+	case o.LastElement:
+		args = append(args, "-e")
+	}
+	keys := make([]string, 0, len(o.Properties))
+	for k := range o.Properties {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		args = append(args, "-o", k+"="+o.Properties[k])
+	}
+	for _, k := range o.Exclude {
+		if _, ok := o.Properties[k]; ok {
+			return nil, fmt.Errorf("cannot both override and exclude property %s", k)
+		}
+		args = append(args, "-x", k)
+	}
+	return args, nil
+}
+
+// SendTo sends a ZFS stream of a snapshot to the given io.Writer, as configured by opts.
+// The stream is written as it is produced, so w may be a pipe, network connection or compressor.
+// An error will be returned if the input dataset is not of snapshot type.
+func (d *Dataset) SendTo(w io.Writer, opts SendOptions) error {
+	return d.SendToContext(context.Background(), w, opts)
+}
+
+// SendToContext is like SendTo but includes a context.
+func (d *Dataset) SendToContext(ctx context.Context, w io.Writer, opts SendOptions) error {
+	if d.Type != DatasetSnapshot {
+		return errors.New("can only send snapshots")
+	}
+	args, err := opts.args()
+	if err != nil {
+		return err
+	}
+	if caps := knownCapabilities(ctx); caps != nil && opts.Raw && !caps.RawSend {
+		return fmt.Errorf("raw sends: %w", ErrNotSupported)
+	}
+
+	var progress *progressCounter
+	if opts.Progress != nil {
+		estimate, err := d.SendEstimateContext(ctx, opts)
+		if err != nil {
+			return err
+		}
+		progress = &progressCounter{total: estimate.Size, report: opts.Progress}
+		w = &progressWriter{Writer: w, progressCounter: progress}
+	}
+
+	c := command{Command: "zfs", Stdout: w, stream: true}
+	if _, err = c.Run(ctx, append(append([]string{"send"}, args...), d.Name)...); err != nil {
+		return err
+	}
+	progress.done()
+	return nil
+}
+
+// SendEstimate is the estimated size of a send stream, as reported by zfs send -nvP.
+type SendEstimate struct {
+	// Size is the estimated size of the whole stream in bytes.
+	Size uint64
+	// Snapshots holds the estimates of the snapshots in the stream, of which there are several with Replicate or Intermediary.
+	Snapshots []SnapshotEstimate
+}
+
+// SnapshotEstimate is the estimated size of the part of a send stream which holds one snapshot.
+type SnapshotEstimate struct {
+	Snapshot string
+	// From is the incremental source of the snapshot, empty if it is sent in full.
+	From string
+	Size uint64
+}
+
+// SendEstimate returns the estimated size of the stream SendTo would send with opts, without sending it.
+// An error will be returned if the input dataset is not of snapshot type.
+func (d *Dataset) SendEstimate(opts SendOptions) (*SendEstimate, error) {
+	return d.SendEstimateContext(context.Background(), opts)
+}
+
+// SendEstimateContext is like SendEstimate but includes a context.
+func (d *Dataset) SendEstimateContext(ctx context.Context, opts SendOptions) (*SendEstimate, error) {
+	if d.Type != DatasetSnapshot {
+		return nil, errors.New("can only send snapshots")
+	}
+	args, err := opts.args()
+	if err != nil {
+		return nil, err
+	}
+	out, err := zfsOutput(ctx, append(append([]string{"send", "-n", "-v", "-P"}, args...), d.Name)...)
+	if err != nil {
+		return nil, err
+	}
+	return parseSendEstimate(out)
+}
+
+// example input for parseSendEstimate
+// incremental	pool/fs@a	pool/fs@b	4656
+// full	pool/fs/child@b	1234
+// size	5890
+
+func parseSendEstimate(out [][]string) (*SendEstimate, error) {
+	e := &SendEstimate{}
+	for _, line := range out {
+		var s SnapshotEstimate
+		var size string
+		switch {
+		case len(line) == 2 && line[0] == "size":
+			if err := setUint(&e.Size, line[1]); err != nil {
+				return nil, fmt.Errorf("invalid send estimate: %w", err)
+			}
+			continue
+		case len(line) == 3 && line[0] == "full":
+			s.Snapshot, size = line[1], line[2]
+		case len(line) == 4 && line[0] == "incremental":
+			s.From, s.Snapshot, size = line[1], line[2], line[3]
+		default:
+			// skip other verbose output, such as resume tokens
+			continue
+		}
+		if err := setUint(&s.Size, size); err != nil {
+			return nil, fmt.Errorf("invalid send estimate of %s: %w", s.Snapshot, err)
+		}
+		e.Snapshots = append(e.Snapshots, s)
+	}
+	if e.Size == 0 {
+		// sum up the snapshots if no total was printed
+		for _, s := range e.Snapshots {
+			e.Size += s.Size
+		}
+	}
+	return e, nil
+}
+
+// ReceiveFrom receives a ZFS stream from the given io.Reader into the target dataset or snapshot, as configured by opts.
+// The received dataset is returned, which is below the target with DiscardPool or LastElement.
+func ReceiveFrom(r io.Reader, target string, opts ReceiveOptions) (*Dataset, error) {
+	return ReceiveFromContext(context.Background(), r, target, opts)
+}
+
+// ReceiveFromContext is like ReceiveFrom but includes a context.
+func ReceiveFromContext(ctx context.Context, r io.Reader, target string, opts ReceiveOptions) (*Dataset, error) {
+	args, err := opts.args()
+	if err != nil {
+		return nil, err
+	}
+	var progress *progressCounter
+	if opts.Progress != nil {
+		progress = &progressCounter{total: opts.Size, report: opts.Progress}
+		r = &progressReader{Reader: r, progressCounter: progress}
+	}
+
+	c := command{Command: "zfs", Stdin: r, stream: true}
+	var verbose bytes.Buffer
+	if opts.DiscardPool || opts.LastElement {
+		// the name of the received dataset is only known from the verbose output
+		args = append(args, "-v")
+		c.Stdout = &verbose
+	}
+	if _, err := c.Run(ctx, append(append([]string{"receive"}, args...), target)...); err != nil {
+		return nil, err
+	}
+	progress.done()
+	if verbose.Len() > 0 {
+		if name := receivedName(verbose.String()); name != "" {
+			target = name
+		}
+	}
+	return GetDatasetContext(ctx, target)
+}
+
+// example input for receivedName
+// receiving full stream of tank/src/fs@a into backup/src/fs@a
+// received 312B stream in 1 seconds (312B/sec)
+
+// receivedName returns the filesystem or volume the first stream of the verbose output of zfs receive went into.
+func receivedName(out string) string {
+	for _, line := range strings.Split(out, "\n") {
+		if !strings.HasPrefix(line, "receiving ") {
+			continue
+		}
+		if i := strings.LastIndex(line, " into "); i >= 0 {
+			return strings.SplitN(line[i+len(" into "):], "@", 2)[0]
+		}
+	}
+	return ""
+}
+
+// ResumeToken returns the receive_resume_token of a dataset which was partially received with ReceiveOptions.Resumable.
+// An empty string is returned if there is no interrupted receive to resume.
+func (d *Dataset) ResumeToken() (string, error) {
+	return d.ResumeTokenContext(context.Background())
+}
+
+// ResumeTokenContext is like ResumeToken but includes a context.
+func (d *Dataset) ResumeTokenContext(ctx context.Context) (string, error) {
+	token, err := d.GetPropertyContext(ctx, "receive_resume_token")
+	if err != nil {
+		return "", err
+	}
+	if token == "-" {
+		return "", nil
+	}
+	return token, nil
+}
+
+// ResumeSend resumes an interrupted send, writing the remainder of the stream identified by the resume token to w.
+func ResumeSend(token string, w io.Writer) error {
+	return ResumeSendContext(context.Background(), token, w)
+}
+
+// ResumeSendContext is like ResumeSend but includes a context.
+func ResumeSendContext(ctx context.Context, token string, w io.Writer) error {
+	if token == "" {
+		return errors.New("empty resume token")
+	}
+	c := command{Command: "zfs", Stdout: w, stream: true}
+	_, err := c.Run(ctx, "send", "-t", token)
+	return err
+}
+
+// AbortReceive discards the saved state of an interrupted resumable receive into the dataset.
+func AbortReceive(dataset string) error {
+	return AbortReceiveContext(context.Background(), dataset)
+}
+
+// AbortReceiveContext is like AbortReceive but includes a context.
+func AbortReceiveContext(ctx context.Context, dataset string) error {
+	return zfs(ctx, "receive", "-A", dataset)
+}
+
+// progressInterval is the minimum time between two calls of a progress callback while streaming.
+var progressInterval = time.Second
+
+// progressCounter counts the bytes of a stream and reports them to a progress callback.
+type progressCounter struct {
+	n, total uint64
+	report   func(n, total uint64)
+	last     time.Time
+}
+
+func (p *progressCounter) add(n int) {
+	p.n += uint64(n)
+	if now := time.Now(); now.Sub(p.last) >= progressInterval {
+		p.last = now
+		p.report(p.n, p.total)
+	}
+}
+
+// done reports the final count of a complete stream, it does nothing on a nil counter.
+func (p *progressCounter) done() {
+	if p != nil {
+		p.report(p.n, p.total)
+	}
+}
+
+type progressWriter struct {
+	io.Writer
+	*progressCounter
+}
+
+func (w *progressWriter) Write(b []byte) (int, error) {
+	n, err := w.Writer.Write(b)
+	w.add(n)
+	return n, err
+}
+
+type progressReader struct {
+	io.Reader
+	*progressCounter
+}
+
+func (r *progressReader) Read(b []byte) (int, error) {
+	n, err := r.Reader.Read(b)
+	r.add(n)
+	return n, err
+}
@@ -0,0 +1,152 @@
+package zfs
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSendOptionsArgs(t *testing.T) {
+	for name, test := range map[string]struct {
+		opts SendOptions
+		want []string
+	}{
+		"full": {
+			opts: SendOptions{},
+			want: nil,
+		},
+		"incremental": {
+			opts: SendOptions{From: "pool/fs@a"},
+			want: []string{"-i", "pool/fs@a"},
+		},
+		"intermediary replication": {
+			opts: SendOptions{From: "@a", Intermediary: true, Replicate: true, Compressed: true, LargeBlocks: true, Raw: true},
+			want: []string{"-R", "-c", "-L", "-w", "-I", "@a"},
+		},
+		"redacted": {
+			opts: SendOptions{From: "pool/fs#base", Redact: "pool/fs#scrubbed"},
+			want: []string{"--redact", "pool/fs#scrubbed", "-i", "pool/fs#base"},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			got, err := test.opts.args()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(test.want, got) {
+				t.Fatalf("want: %q, got: %q", test.want, got)
+			}
+		})
+	}
+
+	if _, err := (&SendOptions{Intermediary: true}).args(); err == nil {
+		t.Fatal("expected error for intermediary send without incremental source")
+	}
+	if _, err := (&SendOptions{Redact: "pool/fs#scrubbed", Replicate: true}).args(); err == nil {
+		t.Fatal("expected error for redacted replication stream")
+	}
+}
+
+func TestReceiveOptionsArgs(t *testing.T) {
+	opts := ReceiveOptions{
+		Force:       true,
+		NoMount:     true,
+		DiscardPool: true,
+		Properties:  map[string]string{"readonly": "on", "canmount": "off"},
+		Exclude:     []string{"mountpoint"},
+	}
+	got, err := opts.args()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"-F", "-u", "-d", "-o", "canmount=off", "-o", "readonly=on", "-x", "mountpoint"}; !reflect.DeepEqual(want, got) {
+		t.Fatalf("want: %q, got: %q", want, got)
+	}
+
+	if _, err := (&ReceiveOptions{DiscardPool: true, LastElement: true}).args(); err == nil {
+		t.Fatal("expected error for both DiscardPool and LastElement")
+	}
+	if _, err := (&ReceiveOptions{Properties: map[string]string{"mountpoint": "/mnt"}, Exclude: []string{"mountpoint"}}).args(); err == nil {
+		t.Fatal("expected error for property both overridden and excluded")
+	}
+}
+
+func TestReceivedName(t *testing.T) {
+	out := "receiving full stream of tank/src/fs@a into backup/src/fs@a\nreceived 312B stream in 1 seconds (312B/sec)\n"
+	if got := receivedName(out); got != "backup/src/fs" {
+		t.Fatalf("want: backup/src/fs, got: %s", got)
+	}
+	if got := receivedName(""); got != "" {
+		t.Fatalf("want no name, got: %s", got)
+	}
+}
+
+func TestSendEstimate(t *testing.T) {
+	ctx, r := withFakeRunner("incremental\tpool/fs@a\tpool/fs@b\t4656\nfull\tpool/fs/child@b\t1234\nsize\t5890\n")
+	d := &Dataset{Name: "pool/fs@b", Type: DatasetSnapshot}
+	e, err := d.SendEstimateContext(ctx, SendOptions{From: "@a", Replicate: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &SendEstimate{Size: 5890, Snapshots: []SnapshotEstimate{
+		{Snapshot: "pool/fs@b", From: "pool/fs@a", Size: 4656},
+		{Snapshot: "pool/fs/child@b", Size: 1234},
+	}}
+	if !reflect.DeepEqual(want, e) {
+		t.Fatalf("want: %+v, got: %+v", want, e)
+	}
+	if want := [][]string{{"zfs", "send", "-n", "-v", "-P", "-R", "-i", "@a", "pool/fs@b"}}; !reflect.DeepEqual(want, r.calls) {
+		t.Fatalf("want calls: %q, got: %q", want, r.calls)
+	}
+
+	ctx, _ = withFakeRunner("full\tpool/fs@b\t1234\n")
+	if e, err := d.SendEstimateContext(ctx, SendOptions{}); err != nil || e.Size != 1234 {
+		t.Fatalf("want size 1234 without total, got: %+v, %v", e, err)
+	}
+
+	if _, err := (&Dataset{Name: "pool/fs", Type: DatasetFilesystem}).SendEstimateContext(ctx, SendOptions{}); err == nil {
+		t.Fatal("expected error estimating a filesystem")
+	}
+}
+
+func TestSendReceiveProgress(t *testing.T) {
+	defer func(interval time.Duration) { progressInterval = interval }(progressInterval)
+	progressInterval = 0
+
+	stream := strings.Repeat("x", 100)
+	r := &fakeStreamRunner{fakeRunner: fakeRunner{output: func(args []string) (string, error) {
+		switch {
+		case args[1] == "send" && args[2] == "-n":
+			return "full\tpool/fs@a\t120\nsize\t120\n", nil
+		case args[1] == "send":
+			return stream, nil
+		}
+		return "", nil
+	}}}
+	ctx := WithRunner(context.Background(), r)
+
+	type report struct{ n, total uint64 }
+	var reports []report
+	opts := SendOptions{Progress: func(sent, total uint64) { reports = append(reports, report{sent, total}) }}
+	var out bytes.Buffer
+	if err := (&Dataset{Name: "pool/fs@a", Type: DatasetSnapshot}).SendToContext(ctx, &out, opts); err != nil {
+		t.Fatal(err)
+	}
+	if want := []report{{100, 120}, {100, 120}}; !reflect.DeepEqual(want, reports) {
+		t.Fatalf("want reports: %v, got: %v", want, reports)
+	}
+
+	reports = nil
+	recv := ReceiveOptions{Size: 100, Progress: func(received, total uint64) { reports = append(reports, report{received, total}) }}
+	// the received dataset cannot be looked up, as the fake runner has no output for zfs list
+	_, _ = ReceiveFromContext(ctx, strings.NewReader(stream), "pool/dst", recv)
+	if len(reports) == 0 || reports[len(reports)-1] != (report{100, 100}) {
+		t.Fatalf("want final report of 100 bytes, got: %v", reports)
+	}
+	if string(r.stdin) != stream {
+		t.Fatalf("want stream received, got %q", r.stdin)
+	}
+}
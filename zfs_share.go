@@ -0,0 +1,169 @@
+package zfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Share protocols, which select the sharenfs or sharesmb property.
+const (
+	ShareNFS = "nfs"
+	ShareSMB = "smb"
+)
+
+// ShareOptions is the parsed value of the sharenfs or sharesmb property of a dataset.
+//
+// The value is "off", "on", or a comma separated list of options, e.g. "rw=@10.0.0.0/8,no_root_squash",
+// as passed to exportfs on Linux or share on illumos.
+type ShareOptions struct {
+	// Enabled reports whether the dataset is shared with the protocol, it is false if the property is "off".
+	Enabled bool
+	// Options holds the share options in order, it is empty if the property is "on".
+	Options []ShareOption
+}
+
+// ShareOption is a single share option, such as "ro" or "rw=@10.0.0.0/8".
+type ShareOption struct {
+	Name string
+	// Value is empty for options which are flags, such as "no_root_squash".
+	Value string
+}
+
+// ParseShareOptions parses the value of a sharenfs or sharesmb property.
+func ParseShareOptions(value string) (*ShareOptions, error) {
+	switch value {
+	case "", "-", "off":
+		return &ShareOptions{}, nil
+	case "on":
+		return &ShareOptions{Enabled: true}, nil
+	}
+	o := &ShareOptions{Enabled: true}
+	for _, option := range strings.Split(value, ",") {
+		name, val := option, ""
+		if i := strings.IndexByte(option, '='); i >= 0 {
+			name, val = option[:i], option[i+1:]
+		}
+		if name == "" {
+			return nil, fmt.Errorf("invalid share option %q in %q", option, value)
+		}
+		o.Options = append(o.Options, ShareOption{Name: name, Value: val})
+	}
+	return o, nil
+}
+
+// String renders the options as a value of the sharenfs or sharesmb property.
+func (o *ShareOptions) String() string {
+	if !o.Enabled {
+		return "off"
+	}
+	if len(o.Options) == 0 {
+		return "on"
+	}
+	options := make([]string, len(o.Options))
+	for i, option := range o.Options {
+		options[i] = option.Name
+		if option.Value != "" {
+			options[i] += "=" + option.Value
+		}
+	}
+	return strings.Join(options, ",")
+}
+
+// Get returns the value of the first option with the given name, and whether the option is present.
+func (o *ShareOptions) Get(name string) (string, bool) {
+	for _, option := range o.Options {
+		if option.Name == name {
+			return option.Value, true
+		}
+	}
+	return "", false
+}
+
+func shareProperty(protocol string) (string, error) {
+	switch protocol {
+	case ShareNFS, ShareSMB:
+		return "share" + protocol, nil
+	}
+	return "", fmt.Errorf("invalid share protocol %q", protocol)
+}
+
+// GetShareOptions returns the parsed sharenfs or sharesmb property of the dataset, selected by one of the Share constants.
+func (d *Dataset) GetShareOptions(protocol string) (*ShareOptions, error) {
+	return d.GetShareOptionsContext(context.Background(), protocol)
+}
+
+// GetShareOptionsContext is like GetShareOptions but includes a context.
+func (d *Dataset) GetShareOptionsContext(ctx context.Context, protocol string) (*ShareOptions, error) {
+	prop, err := shareProperty(protocol)
+	if err != nil {
+		return nil, err
+	}
+	value, err := d.GetPropertyContext(ctx, prop)
+	if err != nil {
+		return nil, err
+	}
+	return ParseShareOptions(value)
+}
+
+// SetShareOptions sets the sharenfs or sharesmb property of the dataset, selected by one of the Share constants.
+// ZFS shares or unshares a mounted filesystem as soon as the property changes.
+func (d *Dataset) SetShareOptions(protocol string, opts ShareOptions) error {
+	return d.SetShareOptionsContext(context.Background(), protocol, opts)
+}
+
+// SetShareOptionsContext is like SetShareOptions but includes a context.
+func (d *Dataset) SetShareOptionsContext(ctx context.Context, protocol string, opts ShareOptions) error {
+	prop, err := shareProperty(protocol)
+	if err != nil {
+		return err
+	}
+	return d.SetPropertyContext(ctx, prop, opts.String())
+}
+
+// Share shares the ZFS file system with the protocols enabled by its sharenfs and sharesmb properties.
+func (d *Dataset) Share() error {
+	return d.ShareContext(context.Background())
+}
+
+// ShareContext is like Share but includes a context.
+func (d *Dataset) ShareContext(ctx context.Context) error {
+	if d.Type == DatasetSnapshot {
+		return errors.New("cannot share snapshots")
+	}
+	return zfs(ctx, "share", d.Name)
+}
+
+// Unshare stops sharing the ZFS file system with all protocols.
+func (d *Dataset) Unshare() error {
+	return d.UnshareContext(context.Background())
+}
+
+// UnshareContext is like Unshare but includes a context.
+func (d *Dataset) UnshareContext(ctx context.Context) error {
+	if d.Type == DatasetSnapshot {
+		return errors.New("cannot unshare snapshots")
+	}
+	return zfs(ctx, "unshare", d.Name)
+}
+
+// ShareAll shares all mounted ZFS file systems with the protocols enabled by their sharenfs and sharesmb properties.
+func ShareAll() error {
+	return ShareAllContext(context.Background())
+}
+
+// ShareAllContext is like ShareAll but includes a context.
+func ShareAllContext(ctx context.Context) error {
+	return zfs(ctx, "share", "-a")
+}
+
+// UnshareAll stops sharing all shared ZFS file systems.
+func UnshareAll() error {
+	return UnshareAllContext(context.Background())
+}
+
+// UnshareAllContext is like UnshareAll but includes a context.
+func UnshareAllContext(ctx context.Context) error {
+	return zfs(ctx, "unshare", "-a")
+}
@@ -0,0 +1,43 @@
+package zfs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseShareOptions(t *testing.T) {
+	for value, want := range map[string]*ShareOptions{
+		"off": {},
+		"on":  {Enabled: true},
+		"rw=@10.0.0.0/8:@192.168.0.1,no_root_squash,sec=sys": {Enabled: true, Options: []ShareOption{
+			{Name: "rw", Value: "@10.0.0.0/8:@192.168.0.1"},
+			{Name: "no_root_squash"},
+			{Name: "sec", Value: "sys"},
+		}},
+	} {
+		got, err := ParseShareOptions(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(want, got) {
+			t.Fatalf("want: %+v, got: %+v", want, got)
+		}
+		if got.String() != value {
+			t.Fatalf("want %q rendered, got %q", value, got.String())
+		}
+	}
+
+	o, _ := ParseShareOptions("ro,crossmnt")
+	if _, ok := o.Get("crossmnt"); !ok {
+		t.Fatal("expected crossmnt option")
+	}
+	if _, ok := o.Get("rw"); ok {
+		t.Fatal("unexpected rw option")
+	}
+	if _, err := ParseShareOptions("ro,=x"); err == nil {
+		t.Fatal("expected error for option without name")
+	}
+	if _, err := shareProperty("afp"); err == nil {
+		t.Fatal("expected error for unknown protocol")
+	}
+}
@@ -0,0 +1,92 @@
+package zfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// SnapDir is the value of the snapdir property, which selects whether the .zfs directory in the root of a
+// filesystem is listed. It can be accessed by its path either way, unless it is disabled.
+type SnapDir string
+
+// Values of the snapdir property.
+const (
+	SnapDirHidden  SnapDir = "hidden"
+	SnapDirVisible SnapDir = "visible"
+	// SnapDirDisabled removes the .zfs directory, since OpenZFS 2.2.
+	SnapDirDisabled SnapDir = "disabled"
+)
+
+// SetSnapDir sets the snapdir property of the filesystem. If capabilities were detected, SnapDirDisabled fails
+// with ErrNotSupported before OpenZFS 2.2.
+func (d *Dataset) SetSnapDir(snapdir SnapDir) error {
+	return d.SetSnapDirContext(context.Background(), snapdir)
+}
+
+// SetSnapDirContext is like SetSnapDir but includes a context.
+func (d *Dataset) SetSnapDirContext(ctx context.Context, snapdir SnapDir) error {
+	if d.Type != DatasetFilesystem {
+		return errors.New("snapdir can only be set on filesystems")
+	}
+	switch snapdir {
+	case SnapDirHidden, SnapDirVisible:
+	case SnapDirDisabled:
+		if caps := knownCapabilities(ctx); caps != nil && !caps.Userland.AtLeast(2, 2, 0) {
+			return fmt.Errorf("snapdir %s: %w", snapdir, ErrNotSupported)
+		}
+	default:
+		return fmt.Errorf("invalid snapdir %q", snapdir)
+	}
+	return zfs(ctx, "set", "snapdir="+string(snapdir), d.Name)
+}
+
+// SetSnapDev sets the snapdev property of the volume. Devices of its snapshots are created or removed
+// asynchronously, see WaitZvolDevice.
+func (d *Dataset) SetSnapDev(snapdev SnapDev) error {
+	return d.SetSnapDevContext(context.Background(), snapdev)
+}
+
+// SetSnapDevContext is like SetSnapDev but includes a context.
+func (d *Dataset) SetSnapDevContext(ctx context.Context, snapdev SnapDev) error {
+	if d.Type != DatasetVolume {
+		return errors.New("snapdev can only be set on volumes")
+	}
+	switch snapdev {
+	case SnapDevHidden, SnapDevVisible:
+	default:
+		return fmt.Errorf("invalid snapdev %q", snapdev)
+	}
+	return zfs(ctx, "set", "snapdev="+string(snapdev), d.Name)
+}
+
+// SnapshotPath returns the directory the contents of the snapshot can be read from, .zfs/snapshot/<name> below the
+// directory its filesystem is mounted on, unless the snapdir property is disabled. The directory is listed on the
+// host which runs the commands to check it is accessible, which mounts the snapshot if it is not mounted yet.
+func (d *Dataset) SnapshotPath() (string, error) {
+	return d.SnapshotPathContext(context.Background())
+}
+
+// SnapshotPathContext is like SnapshotPath but includes a context.
+func (d *Dataset) SnapshotPathContext(ctx context.Context) (string, error) {
+	parts := strings.SplitN(d.Name, "@", 2)
+	if len(parts) != 2 || d.Type != "" && d.Type != DatasetSnapshot {
+		return "", errors.New("can only get the path of snapshots")
+	}
+	mounts, err := MountsContext(ctx)
+	if err != nil {
+		return "", err
+	}
+	dir, ok := mounts[parts[0]]
+	if !ok {
+		return "", fmt.Errorf("filesystem %s of snapshot %s is not mounted", parts[0], d.Name)
+	}
+	dir = path.Join(dir, ".zfs", "snapshot", parts[1])
+	// stat does not trigger the automount of the snapshot, listing its directory does
+	if _, err := commandOutput(ctx, "ls", "-a", dir); err != nil {
+		return "", fmt.Errorf("snapshot directory %s is not accessible: %w", dir, err)
+	}
+	return dir, nil
+}
@@ -0,0 +1,95 @@
+package zfs
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSnapDir(t *testing.T) {
+	ctx, r := withFakeRunner("")
+	fs := &Dataset{Name: "tank/fs", Type: DatasetFilesystem}
+	vol := &Dataset{Name: "tank/vol", Type: DatasetVolume}
+	if err := fs.SetSnapDirContext(ctx, SnapDirVisible); err != nil {
+		t.Fatal(err)
+	}
+	if err := vol.SetSnapDevContext(ctx, SnapDevHidden); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.SetSnapDirContext(ctx, SnapDirDisabled); err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"zfs", "set", "snapdir=visible", "tank/fs"},
+		{"zfs", "set", "snapdev=hidden", "tank/vol"},
+		{"zfs", "set", "snapdir=disabled", "tank/fs"},
+	}
+	if !reflect.DeepEqual(want, r.calls) {
+		t.Fatalf("want: %q, got: %q", want, r.calls)
+	}
+
+	for _, err := range []error{
+		fs.SetSnapDirContext(ctx, "shown"),
+		vol.SetSnapDirContext(ctx, SnapDirHidden),
+		vol.SetSnapDevContext(ctx, "shown"),
+		fs.SetSnapDevContext(ctx, SnapDevVisible),
+	} {
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+}
+
+func TestSnapDirDisabled(t *testing.T) {
+	fs := &Dataset{Name: "tank/fs", Type: DatasetFilesystem}
+	ctx := WithRunner(context.Background(), capabilitiesRunner("zfs-2.1.5-1\n"))
+	if _, err := DetectCapabilitiesContext(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.SetSnapDirContext(ctx, SnapDirDisabled); !errors.Is(err, ErrNotSupported) {
+		t.Fatalf("want ErrNotSupported, got: %v", err)
+	}
+	ctx = WithRunner(context.Background(), capabilitiesRunner("zfs-2.2.0-1\n"))
+	if _, err := DetectCapabilitiesContext(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.SetSnapDirContext(ctx, SnapDirDisabled); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSnapshotPath(t *testing.T) {
+	r := &fakeRunner{output: func(args []string) (string, error) {
+		switch args[0] {
+		case "zfs":
+			if args[1] == "list" {
+				return "tank\tyes\ntank/home\tyes\ntank/other\tno\n", nil
+			}
+			return "tank                            /tank\ntank/home                       /home/with space\n", nil
+		case "ls":
+			if strings.HasSuffix(args[2], "/missing") {
+				return "", exitError(2)
+			}
+		}
+		return "", nil
+	}}
+	ctx := WithRunner(context.Background(), r)
+	dir, err := (&Dataset{Name: "tank/home@daily", Type: DatasetSnapshot}).SnapshotPathContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dir != "/home/with space/.zfs/snapshot/daily" {
+		t.Fatalf("unexpected path %q", dir)
+	}
+	if want := []string{"ls", "-a", dir}; !reflect.DeepEqual(want, r.calls[len(r.calls)-1]) {
+		t.Fatalf("want: %q, got: %q", want, r.calls)
+	}
+
+	for _, name := range []string{"tank/home@missing", "tank/other@daily", "tank/home"} {
+		if _, err := (&Dataset{Name: name}).SnapshotPathContext(ctx); err == nil {
+			t.Fatalf("expected error for %s", name)
+		}
+	}
+}
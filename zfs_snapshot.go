@@ -0,0 +1,152 @@
+package zfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SnapshotInfo holds the properties of a snapshot which matter for retention and replication, as listed by SnapshotInfos.
+type SnapshotInfo struct {
+	Name string
+	// Created is the creation time of the snapshot, with a resolution of one second.
+	Created time.Time
+	// CreateTXG is the transaction group the snapshot was created in, it orders snapshots created in the same second.
+	CreateTXG uint64
+	// GUID identifies the snapshot across pools, it is kept when the snapshot is sent, received or renamed.
+	GUID uint64
+	// Used is the space in bytes which destroying only this snapshot would free.
+	Used uint64
+	// UserRefs is the number of holds on the snapshot.
+	UserRefs uint64
+	// UserProperties holds the values of the requested user properties, "-" for those which are not set.
+	UserProperties map[string]string
+}
+
+// SnapshotInfos returns the creation time, GUID, space, holds and the given user properties of ZFS snapshots
+// with a single invocation of zfs list, in the order zfs lists them.
+// A filter argument may be passed to select the snapshots of a dataset and its descendents,
+// or empty string ("") may be used to select all snapshots.
+func SnapshotInfos(filter string, userProperties []string) ([]*SnapshotInfo, error) {
+	return SnapshotInfosContext(context.Background(), filter, userProperties)
+}
+
+// SnapshotInfosContext is like SnapshotInfos but includes a context.
+func SnapshotInfosContext(ctx context.Context, filter string, userProperties []string) ([]*SnapshotInfo, error) {
+	return listSnapshotInfos(ctx, []string{"-rHp"}, filter, userProperties)
+}
+
+// SnapshotInfos is like the function SnapshotInfos for the snapshots of the dataset only. The snapshots of its
+// descendents are not listed at all (zfs list -d 1), which keeps the listing small below datasets with many of
+// them, such as the root of a replication.
+func (d *Dataset) SnapshotInfos(userProperties []string) ([]*SnapshotInfo, error) {
+	return d.SnapshotInfosContext(context.Background(), userProperties)
+}
+
+// SnapshotInfosContext is like SnapshotInfos but includes a context.
+func (d *Dataset) SnapshotInfosContext(ctx context.Context, userProperties []string) ([]*SnapshotInfo, error) {
+	if d.Name == "" {
+		return nil, errors.New("no dataset given")
+	}
+	return listSnapshotInfos(ctx, []string{"-Hp", "-d", "1"}, d.Name, userProperties)
+}
+
+func listSnapshotInfos(ctx context.Context, flags []string, filter string, userProperties []string) ([]*SnapshotInfo, error) {
+	for _, prop := range userProperties {
+		if err := validateUserPropertyName(prop); err != nil {
+			return nil, err
+		}
+	}
+	columns := append([]string{"name", "creation", "createtxg", "guid", "used", "userrefs"}, userProperties...)
+	args := append(append([]string{"list"}, flags...), "-t", "snapshot", "-o", strings.Join(columns, ","))
+	if filter != "" {
+		args = append(args, filter)
+	}
+	out, err := zfsListOutput(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	return parseSnapshotInfos(out, userProperties)
+}
+
+// example input for parseSnapshotInfos with the user property com.example:keep
+// tank/fs@a	1640995200	12	9141506320011110189	4096	0	-
+// tank/fs@b	1640998800	37	1569770912024932840	0	1	yes
+
+func parseSnapshotInfos(out [][]string, userProperties []string) ([]*SnapshotInfo, error) {
+	snaps := make([]*SnapshotInfo, 0, len(out))
+	for _, line := range out {
+		if len(line) != 6+len(userProperties) {
+			return nil, fmt.Errorf("invalid snapshot %q", strings.Join(line, "\t"))
+		}
+		s := &SnapshotInfo{Name: line[0], UserProperties: make(map[string]string, len(userProperties))}
+		created, err := strconv.ParseInt(line[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid creation time of %s: %w", s.Name, err)
+		}
+		s.Created = time.Unix(created, 0)
+		for i, field := range []*uint64{&s.CreateTXG, &s.GUID, &s.Used, &s.UserRefs} {
+			if err := setUint(field, line[i+2]); err != nil {
+				return nil, fmt.Errorf("invalid snapshot %s: %w", s.Name, err)
+			}
+		}
+		for i, prop := range userProperties {
+			s.UserProperties[prop] = line[6+i]
+		}
+		snaps = append(snaps, s)
+	}
+	return snaps, nil
+}
+
+// CommonSnapshot is a snapshot which two filesystems or volumes have in common, as returned by CommonSnapshots.
+type CommonSnapshot struct {
+	Source *SnapshotInfo
+	// Target is the same snapshot on the target, whose name may differ if it was renamed.
+	Target *SnapshotInfo
+}
+
+// CommonSnapshots returns the snapshots the source and target filesystems or volumes have in common, oldest first,
+// such as those received by the target from the source. Snapshots are matched by guid rather than by name,
+// so snapshots which were renamed on either side are still found, and unrelated snapshots of the same name are not.
+// The most recent common snapshot is the incremental source for bringing the target up to date.
+func CommonSnapshots(source, target *Dataset) ([]CommonSnapshot, error) {
+	return CommonSnapshotsContext(context.Background(), source, target)
+}
+
+// CommonSnapshotsContext is like CommonSnapshots but includes a context.
+func CommonSnapshotsContext(ctx context.Context, source, target *Dataset) ([]CommonSnapshot, error) {
+	var snaps [2][]*SnapshotInfo
+	for i, d := range []*Dataset{source, target} {
+		if d.Type == DatasetSnapshot {
+			return nil, errors.New("cannot find common snapshots of snapshots")
+		}
+		var err error
+		if snaps[i], err = d.SnapshotInfosContext(ctx, nil); err != nil {
+			return nil, err
+		}
+	}
+	return MatchSnapshots(snaps[0], snaps[1]), nil
+}
+
+// MatchSnapshots returns the snapshots of source which have the guid of a snapshot of target, oldest first.
+// It is the matching of CommonSnapshots, for snapshots listed separately, e.g. with different Runners.
+func MatchSnapshots(source, target []*SnapshotInfo) []CommonSnapshot {
+	byGUID := make(map[uint64]*SnapshotInfo, len(target))
+	for _, s := range target {
+		byGUID[s.GUID] = s
+	}
+	var common []CommonSnapshot
+	for _, s := range source {
+		if t := byGUID[s.GUID]; t != nil {
+			common = append(common, CommonSnapshot{Source: s, Target: t})
+		}
+	}
+	sort.SliceStable(common, func(i, j int) bool {
+		return common[i].Source.CreateTXG < common[j].Source.CreateTXG
+	})
+	return common
+}
@@ -0,0 +1,75 @@
+package zfs
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSnapshotInfos(t *testing.T) {
+	ctx, r := withFakeRunner("tank/fs@a\t1640995200\t12\t9141506320011110189\t4096\t0\t-\ntank/fs@b\t1640998800\t37\t1569770912024932840\t0\t1\tyes\n")
+	snaps, err := SnapshotInfosContext(ctx, "tank/fs", []string{"com.example:keep"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*SnapshotInfo{
+		{Name: "tank/fs@a", Created: time.Unix(1640995200, 0), CreateTXG: 12, GUID: 9141506320011110189, Used: 4096, UserProperties: map[string]string{"com.example:keep": "-"}},
+		{Name: "tank/fs@b", Created: time.Unix(1640998800, 0), CreateTXG: 37, GUID: 1569770912024932840, UserRefs: 1, UserProperties: map[string]string{"com.example:keep": "yes"}},
+	}
+	if !reflect.DeepEqual(want, snaps) {
+		t.Fatalf("want: %+v, got: %+v", want, snaps)
+	}
+	// the first call may probe for JSON support
+	if want := []string{"zfs", "list", "-rHp", "-t", "snapshot", "-o", "name,creation,createtxg,guid,used,userrefs,com.example:keep", "tank/fs"}; !reflect.DeepEqual(want, r.calls[len(r.calls)-1]) {
+		t.Fatalf("want call: %q, got: %q", want, r.calls)
+	}
+
+	if _, err := SnapshotInfosContext(ctx, "", []string{"keep"}); err == nil {
+		t.Fatal("expected error for an invalid user property name")
+	}
+
+	// the snapshots of descendents are not listed
+	if snaps, err = (&Dataset{Name: "tank/fs"}).SnapshotInfosContext(ctx, []string{"com.example:keep"}); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(want, snaps) {
+		t.Fatalf("want: %+v, got: %+v", want, snaps)
+	}
+	if want := []string{"zfs", "list", "-Hp", "-d", "1", "-t", "snapshot", "-o", "name,creation,createtxg,guid,used,userrefs,com.example:keep", "tank/fs"}; !reflect.DeepEqual(want, r.calls[len(r.calls)-1]) {
+		t.Fatalf("want call: %q, got: %q", want, r.calls)
+	}
+}
+
+func TestCommonSnapshots(t *testing.T) {
+	// b was renamed to c on the target, and x of the target is unrelated to that of the source
+	output := map[string]string{
+		"tank/src":   "tank/src@a\t1640995200\t12\t100\t0\t0\ntank/src@b\t1640998800\t37\t200\t0\t0\ntank/src@x\t1641002400\t40\t400\t0\t0\n",
+		"backup/dst": "backup/dst@c\t1641081600\t8\t200\t0\t0\nbackup/dst@a\t1641081000\t5\t100\t0\t0\nbackup/dst@x\t1641085200\t9\t500\t0\t0\n",
+	}
+	r := &fakeRunner{output: func(args []string) (string, error) {
+		if args[1] != "list" {
+			return "", nil
+		}
+		return output[args[len(args)-1]], nil
+	}}
+	ctx := WithRunner(context.Background(), r)
+	common, err := CommonSnapshotsContext(ctx, &Dataset{Name: "tank/src", Type: DatasetFilesystem}, &Dataset{Name: "backup/dst", Type: DatasetFilesystem})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names [][2]string
+	for _, c := range common {
+		names = append(names, [2]string{c.Source.Name, c.Target.Name})
+	}
+	if want := [][2]string{{"tank/src@a", "backup/dst@a"}, {"tank/src@b", "backup/dst@c"}}; !reflect.DeepEqual(want, names) {
+		t.Fatalf("want: %+v, got: %+v", want, names)
+	}
+	if want := []string{"zfs", "list", "-Hp", "-d", "1", "-t", "snapshot", "-o", "name,creation,createtxg,guid,used,userrefs", "tank/src"}; !reflect.DeepEqual(want, r.calls[len(r.calls)-2]) {
+		t.Fatalf("want call: %q, got: %q", want, r.calls)
+	}
+
+	if _, err := CommonSnapshotsContext(ctx, &Dataset{Name: "tank/src@a", Type: DatasetSnapshot}, &Dataset{Name: "backup/dst", Type: DatasetFilesystem}); err == nil {
+		t.Fatal("expected error for a snapshot")
+	}
+}
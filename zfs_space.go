@@ -0,0 +1,166 @@
+package zfs
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SpaceLimits are the quotas and reservations of a dataset in bytes, zero means none is set.
+type SpaceLimits struct {
+	// Quota limits the space used by the dataset and its descendents, RefQuota the space referenced by the dataset.
+	Quota    uint64
+	RefQuota uint64
+	// Reservation guarantees space to the dataset and its descendents, RefReservation to the dataset itself.
+	Reservation    uint64
+	RefReservation uint64
+}
+
+// SpaceLimits returns the quotas and reservations of the dataset.
+func (d *Dataset) SpaceLimits() (*SpaceLimits, error) {
+	return d.SpaceLimitsContext(context.Background())
+}
+
+// SpaceLimitsContext is like SpaceLimits but includes a context.
+func (d *Dataset) SpaceLimitsContext(ctx context.Context) (*SpaceLimits, error) {
+	out, err := zfsOutput(ctx, "get", "-Hp", "-o", "property,value", "quota,refquota,reservation,refreservation", d.Name)
+	if err != nil {
+		return nil, err
+	}
+	l := &SpaceLimits{}
+	fields := map[string]*uint64{"quota": &l.Quota, "refquota": &l.RefQuota, "reservation": &l.Reservation, "refreservation": &l.RefReservation}
+	for _, line := range out {
+		if len(line) != 2 || fields[line[0]] == nil {
+			return nil, fmt.Errorf("unexpected space limit %q", strings.Join(line, "\t"))
+		}
+		value := line[1]
+		if value == "none" {
+			value = "0"
+		}
+		if err := setUint(fields[line[0]], value); err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", line[0], err)
+		}
+	}
+	return l, nil
+}
+
+func (d *Dataset) setSpaceLimit(ctx context.Context, prop string, bytes uint64) error {
+	value := "none"
+	if bytes > 0 {
+		value = strconv.FormatUint(bytes, 10)
+	}
+	return d.SetPropertyContext(ctx, prop, value)
+}
+
+// SetQuota sets the quota of the dataset in bytes, zero removes it.
+func (d *Dataset) SetQuota(bytes uint64) error {
+	return d.SetQuotaContext(context.Background(), bytes)
+}
+
+// SetQuotaContext is like SetQuota but includes a context.
+func (d *Dataset) SetQuotaContext(ctx context.Context, bytes uint64) error {
+	return d.setSpaceLimit(ctx, "quota", bytes)
+}
+
+// SetRefQuota sets the refquota of the dataset in bytes, zero removes it.
+func (d *Dataset) SetRefQuota(bytes uint64) error {
+	return d.SetRefQuotaContext(context.Background(), bytes)
+}
+
+// SetRefQuotaContext is like SetRefQuota but includes a context.
+func (d *Dataset) SetRefQuotaContext(ctx context.Context, bytes uint64) error {
+	return d.setSpaceLimit(ctx, "refquota", bytes)
+}
+
+// SetReservation sets the reservation of the dataset in bytes, zero removes it.
+func (d *Dataset) SetReservation(bytes uint64) error {
+	return d.SetReservationContext(context.Background(), bytes)
+}
+
+// SetReservationContext is like SetReservation but includes a context.
+func (d *Dataset) SetReservationContext(ctx context.Context, bytes uint64) error {
+	return d.setSpaceLimit(ctx, "reservation", bytes)
+}
+
+// SetRefReservation sets the refreservation of the dataset in bytes, zero removes it.
+func (d *Dataset) SetRefReservation(bytes uint64) error {
+	return d.SetRefReservationContext(context.Background(), bytes)
+}
+
+// SetRefReservationContext is like SetRefReservation but includes a context.
+func (d *Dataset) SetRefReservationContext(ctx context.Context, bytes uint64) error {
+	return d.setSpaceLimit(ctx, "refreservation", bytes)
+}
+
+// SpaceBreakdown is the space usage of a dataset broken down by its consumers, as reported by zfs list -o space.
+type SpaceBreakdown struct {
+	Name      string
+	Available uint64
+	// Used is the sum of UsedBySnapshots, UsedByDataset, UsedByRefReservation and UsedByChildren.
+	Used                 uint64
+	UsedBySnapshots      uint64
+	UsedByDataset        uint64
+	UsedByRefReservation uint64
+	UsedByChildren       uint64
+}
+
+// spaceColumns are the columns zfs list -o space selects.
+const spaceColumns = "name,available,used,usedbysnapshots,usedbydataset,usedbyrefreservation,usedbychildren"
+
+// Space returns the space usage of the dataset, broken down by its consumers.
+func (d *Dataset) Space() (*SpaceBreakdown, error) {
+	return d.SpaceContext(context.Background())
+}
+
+// SpaceContext is like Space but includes a context.
+func (d *Dataset) SpaceContext(ctx context.Context) (*SpaceBreakdown, error) {
+	out, err := zfsListOutput(ctx, "list", "-Hp", "-o", spaceColumns, d.Name)
+	if err != nil {
+		return nil, err
+	}
+	spaces, err := parseSpace(out)
+	if err != nil {
+		return nil, err
+	}
+	if len(spaces) != 1 {
+		return nil, fmt.Errorf("expected space usage of one dataset, got %d", len(spaces))
+	}
+	return spaces[0], nil
+}
+
+// SpaceBreakdowns returns the space usage of ZFS filesystems and volumes, broken down by their consumers.
+// A filter argument may be passed to select a dataset and its descendents, or empty string ("") may be used to select all datasets.
+func SpaceBreakdowns(filter string) ([]*SpaceBreakdown, error) {
+	return SpaceBreakdownsContext(context.Background(), filter)
+}
+
+// SpaceBreakdownsContext is like SpaceBreakdowns but includes a context.
+func SpaceBreakdownsContext(ctx context.Context, filter string) ([]*SpaceBreakdown, error) {
+	args := []string{"list", "-rHp", "-t", "filesystem,volume", "-o", spaceColumns}
+	if filter != "" {
+		args = append(args, filter)
+	}
+	out, err := zfsListOutput(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	return parseSpace(out)
+}
+
+func parseSpace(out [][]string) ([]*SpaceBreakdown, error) {
+	spaces := make([]*SpaceBreakdown, 0, len(out))
+	for _, line := range out {
+		if len(line) != 7 {
+			return nil, fmt.Errorf("invalid space usage %q", strings.Join(line, "\t"))
+		}
+		s := &SpaceBreakdown{Name: line[0]}
+		for i, field := range []*uint64{&s.Available, &s.Used, &s.UsedBySnapshots, &s.UsedByDataset, &s.UsedByRefReservation, &s.UsedByChildren} {
+			if err := setUint(field, line[i+1]); err != nil {
+				return nil, fmt.Errorf("invalid space usage of %s: %w", s.Name, err)
+			}
+		}
+		spaces = append(spaces, s)
+	}
+	return spaces, nil
+}
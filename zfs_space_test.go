@@ -0,0 +1,53 @@
+package zfs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSpaceLimits(t *testing.T) {
+	ctx, r := withFakeRunner("quota\t1073741824\nrefquota\t0\nreservation\tnone\nrefreservation\t536870912\n")
+	d := &Dataset{Name: "tank/fs"}
+	l, err := d.SpaceLimitsContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (&SpaceLimits{Quota: 1 << 30, RefReservation: 1 << 29}); !reflect.DeepEqual(want, l) {
+		t.Fatalf("want: %+v, got: %+v", want, l)
+	}
+
+	r.calls = nil
+	if err := d.SetQuotaContext(ctx, 1<<30); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetRefReservationContext(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{{"zfs", "set", "quota=1073741824", "tank/fs"}, {"zfs", "set", "refreservation=none", "tank/fs"}}
+	if !reflect.DeepEqual(want, r.calls) {
+		t.Fatalf("want calls: %q, got: %q", want, r.calls)
+	}
+}
+
+func TestSpace(t *testing.T) {
+	ctx, _ := withFakeRunner("tank\t1000\t600\t0\t100\t0\t500\ntank/fs\t1000\t500\t200\t300\t0\t0\n")
+	spaces, err := SpaceBreakdownsContext(ctx, "tank")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*SpaceBreakdown{
+		{Name: "tank", Available: 1000, Used: 600, UsedByDataset: 100, UsedByChildren: 500},
+		{Name: "tank/fs", Available: 1000, Used: 500, UsedBySnapshots: 200, UsedByDataset: 300},
+	}
+	if !reflect.DeepEqual(want, spaces) {
+		t.Fatalf("want: %+v, got: %+v", want, spaces)
+	}
+
+	if _, err := (&Dataset{Name: "tank"}).SpaceContext(ctx); err == nil {
+		t.Fatal("expected error for space usage of several datasets")
+	}
+	ctx, _ = withFakeRunner("tank\t1000\t600\n")
+	if _, err := SpaceBreakdownsContext(ctx, ""); err == nil {
+		t.Fatal("expected error for missing columns")
+	}
+}
@@ -0,0 +1,53 @@
+package zfs
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+)
+
+// maxSpecialSmallBlocks is the largest block size which can be stored on special vdevs.
+const maxSpecialSmallBlocks = 16 << 20
+
+func validateSpecialSmallBlocks(bytes uint64) error {
+	if bytes != 0 && (bytes < 512 || bytes > maxSpecialSmallBlocks || bytes&(bytes-1) != 0) {
+		return fmt.Errorf("invalid special_small_blocks %d: must be zero or a power of 2 from 512 to 16M", bytes)
+	}
+	return nil
+}
+
+// SpecialSmallBlocks returns the special_small_blocks property of the dataset: blocks of the dataset up to this
+// size in bytes are stored on the special vdevs of the pool along with metadata, zero if only metadata is.
+func (d *Dataset) SpecialSmallBlocks() (uint64, error) {
+	return d.SpecialSmallBlocksContext(context.Background())
+}
+
+// SpecialSmallBlocksContext is like SpecialSmallBlocks but includes a context.
+func (d *Dataset) SpecialSmallBlocksContext(ctx context.Context) (uint64, error) {
+	out, err := zfsOutput(ctx, "get", "-Hp", "-o", "value", "special_small_blocks", d.Name)
+	if err != nil {
+		return 0, err
+	}
+	if len(out) != 1 {
+		return 0, fmt.Errorf("unexpected output of zfs get: %q", out)
+	}
+	var bytes uint64
+	if err := setUint(&bytes, out[0][0]); err != nil {
+		return 0, fmt.Errorf("invalid special_small_blocks: %w", err)
+	}
+	return bytes, nil
+}
+
+// SetSpecialSmallBlocks sets the special_small_blocks property of the dataset, which must be zero or a power of two
+// from 512 bytes to 16M. Only blocks written afterwards are placed according to it.
+func (d *Dataset) SetSpecialSmallBlocks(bytes uint64) error {
+	return d.SetSpecialSmallBlocksContext(context.Background(), bytes)
+}
+
+// SetSpecialSmallBlocksContext is like SetSpecialSmallBlocks but includes a context.
+func (d *Dataset) SetSpecialSmallBlocksContext(ctx context.Context, bytes uint64) error {
+	if err := validateSpecialSmallBlocks(bytes); err != nil {
+		return err
+	}
+	return d.SetPropertyContext(ctx, "special_small_blocks", strconv.FormatUint(bytes, 10))
+}
@@ -0,0 +1,41 @@
+package zfs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSpecialSmallBlocks(t *testing.T) {
+	ctx, r := withFakeRunner("32768\n")
+	d := &Dataset{Name: "tank/fs"}
+
+	bytes, err := d.SpecialSmallBlocksContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes != 32768 {
+		t.Fatalf("want: 32768, got: %d", bytes)
+	}
+	if err := d.SetSpecialSmallBlocksContext(ctx, 64<<10); err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"zfs", "get", "-Hp", "-o", "value", "special_small_blocks", "tank/fs"},
+		{"zfs", "set", "special_small_blocks=65536", "tank/fs"},
+	}
+	if !reflect.DeepEqual(want, r.calls) {
+		t.Fatalf("want: %q, got: %q", want, r.calls)
+	}
+
+	for _, bytes := range []uint64{256, 3000, 32 << 20} {
+		if err := d.SetSpecialSmallBlocksContext(ctx, bytes); err == nil {
+			t.Fatalf("expected error setting special_small_blocks to %d", bytes)
+		}
+	}
+	if _, err := CreateFilesystemWithOptionsContext(ctx, "tank/new", CreateFilesystemOptions{SpecialSmallBlocks: 1000}); err == nil {
+		t.Fatal("expected error creating filesystem with invalid special_small_blocks")
+	}
+	if len(r.calls) != 2 {
+		t.Fatalf("expected no further commands, got: %q", r.calls[2:])
+	}
+}
@@ -1,6 +1,8 @@
 package zfs_test
 
 import (
+	"bytes"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -333,6 +335,8 @@ func TestDiff(t *testing.T) {
 	for _, change := range inodeChanges {
 		want := wants[change.Path]
 		want.Path = change.Path
+		assert(t, !change.Time.IsZero(), "expected change time of %s to be set", change.Path)
+		want.Time = change.Time
 		delete(wants, change.Path)
 
 		equals(t, want, change)
@@ -349,3 +353,216 @@ func TestDiff(t *testing.T) {
 	ok(t, snapshot.Destroy(zfs.DestroyForceUmount))
 	ok(t, fs.Destroy(zfs.DestroyForceUmount))
 }
+
+func TestScrub(t *testing.T) {
+	defer setupZPool(t).cleanUp()
+
+	pool, err := zfs.GetZpool("test")
+	ok(t, err)
+
+	ok(t, pool.Scrub())
+
+	status, err := pool.ScrubStatus()
+	ok(t, err)
+	assert(t, status.State != zfs.ScanStateNone, "expected a scrub to have been started")
+
+	if status.State == zfs.ScanStateInProgress {
+		ok(t, pool.ScrubStop())
+		status, err = pool.ScrubStatus()
+		ok(t, err)
+		equals(t, zfs.ScanStateCanceled, status.State)
+	}
+}
+
+func TestSendToReceiveFrom(t *testing.T) {
+	defer setupZPool(t).cleanUp()
+
+	f, err := zfs.CreateFilesystem("test/send-test", nil)
+	ok(t, err)
+
+	s1, err := f.Snapshot("a", false)
+	ok(t, err)
+	s2, err := f.Snapshot("b", false)
+	ok(t, err)
+
+	r, w := io.Pipe()
+	go func() {
+		w.CloseWithError(s1.SendTo(w, zfs.SendOptions{}))
+	}()
+	_, err = zfs.ReceiveFrom(r, "test/recv-test@a", zfs.ReceiveOptions{})
+	ok(t, err)
+
+	r, w = io.Pipe()
+	go func() {
+		w.CloseWithError(s2.SendTo(w, zfs.SendOptions{From: s1.Name}))
+	}()
+	recv, err := zfs.ReceiveFrom(r, "test/recv-test@b", zfs.ReceiveOptions{Force: true})
+	ok(t, err)
+	equals(t, zfs.DatasetSnapshot, recv.Type)
+
+	ok(t, f.Destroy(zfs.DestroyRecursive))
+	recvFs, err := zfs.GetDataset("test/recv-test")
+	ok(t, err)
+	ok(t, recvFs.Destroy(zfs.DestroyRecursive))
+}
+
+func TestResumableReceive(t *testing.T) {
+	defer setupZPool(t).cleanUp()
+
+	f, err := zfs.CreateFilesystem("test/send-test", nil)
+	ok(t, err)
+	s, err := f.Snapshot("a", false)
+	ok(t, err)
+
+	var stream bytes.Buffer
+	ok(t, s.SendTo(&stream, zfs.SendOptions{}))
+
+	// receive only half of the stream to leave a resumable state behind
+	partial := io.LimitReader(&stream, int64(stream.Len()/2))
+	_, err = zfs.ReceiveFrom(partial, "test/recv-test", zfs.ReceiveOptions{Resumable: true})
+	nok(t, err)
+
+	recv := &zfs.Dataset{Name: "test/recv-test"}
+	token, err := recv.ResumeToken()
+	ok(t, err)
+	assert(t, token != "", "expected a resume token after an interrupted receive")
+
+	ok(t, zfs.AbortReceive("test/recv-test"))
+	ok(t, f.Destroy(zfs.DestroyRecursive))
+}
+
+func TestZpoolProperties(t *testing.T) {
+	defer setupZPool(t).cleanUp()
+
+	pool, err := zfs.GetZpool("test")
+	ok(t, err)
+
+	ok(t, pool.SetProperty("comment", "go-zfs"))
+	comment, err := pool.GetProperty("comment")
+	ok(t, err)
+	equals(t, "go-zfs", comment)
+
+	props, err := pool.GetAllProperties()
+	ok(t, err)
+	equals(t, "local", props["comment"].Source)
+	_, found := props["feature@async_destroy"]
+	assert(t, found, "expected feature flags in pool properties")
+}
+
+func TestUserProperties(t *testing.T) {
+	defer setupZPool(t).cleanUp()
+
+	f, err := zfs.CreateFilesystem("test/userprop-test", nil)
+	ok(t, err)
+
+	ok(t, f.SetUserProperty("com.example:owner", "alice"))
+	nok(t, f.SetUserProperty("owner", "alice"))
+
+	props, err := f.GetUserProperties()
+	ok(t, err)
+	equals(t, 1, len(props))
+	equals(t, "alice", props["com.example:owner"].Value)
+	equals(t, "local", props["com.example:owner"].Source)
+
+	datasets, err := zfs.DatasetsByUserProperty("com.example:owner", "alice")
+	ok(t, err)
+	equals(t, 1, len(datasets))
+	equals(t, f.Name, datasets[0].Name)
+
+	ok(t, f.Destroy(zfs.DestroyDefault))
+}
+
+func TestBookmark(t *testing.T) {
+	defer setupZPool(t).cleanUp()
+
+	f, err := zfs.CreateFilesystem("test/bookmark-test", nil)
+	ok(t, err)
+
+	s1, err := f.Snapshot("a", false)
+	ok(t, err)
+
+	_, err = f.Bookmark("a")
+	nok(t, err)
+
+	b, err := s1.Bookmark("a")
+	ok(t, err)
+	equals(t, "test/bookmark-test#a", b.Name)
+	equals(t, zfs.DatasetBookmark, b.Type)
+
+	bookmarks, err := f.Bookmarks()
+	ok(t, err)
+	equals(t, 1, len(bookmarks))
+
+	// the bookmark remains usable as incremental source once the snapshot is gone
+	ok(t, s1.Destroy(zfs.DestroyDefault))
+	s2, err := f.Snapshot("b", false)
+	ok(t, err)
+	ok(t, s2.SendTo(ioutil.Discard, zfs.SendOptions{From: b.Name}))
+
+	ok(t, b.Destroy(zfs.DestroyDefault))
+	bookmarks, err = zfs.ListBookmarks(f.Name)
+	ok(t, err)
+	equals(t, 0, len(bookmarks))
+
+	ok(t, f.Destroy(zfs.DestroyRecursive))
+}
+
+func TestHolds(t *testing.T) {
+	defer setupZPool(t).cleanUp()
+
+	f, err := zfs.CreateFilesystem("test/hold-test", nil)
+	ok(t, err)
+	s, err := f.Snapshot("a", false)
+	ok(t, err)
+
+	ok(t, s.Hold("backup", false))
+	holds, err := s.Holds()
+	ok(t, err)
+	equals(t, 1, len(holds))
+	equals(t, "backup", holds[0].Tag)
+
+	nok(t, s.Destroy(zfs.DestroyDefault))
+
+	ok(t, s.Release("backup", false))
+	holds, err = s.Holds()
+	ok(t, err)
+	equals(t, 0, len(holds))
+
+	ok(t, f.Destroy(zfs.DestroyRecursive))
+}
+
+func TestEncryption(t *testing.T) {
+	defer setupZPool(t).cleanUp()
+
+	f, err := zfs.CreateFilesystemWithOptions("test/crypt-test", zfs.CreateFilesystemOptions{
+		Encryption: &zfs.EncryptionOptions{
+			Encryption:  "on",
+			KeyFormat:   zfs.KeyFormatPassphrase,
+			KeyLocation: zfs.KeyLocationPrompt,
+			Key:         strings.NewReader("correct horse battery staple"),
+		},
+	})
+	ok(t, err)
+
+	status, err := f.KeyStatus()
+	ok(t, err)
+	equals(t, zfs.KeyStatusAvailable, status)
+
+	_, err = f.Unmount(false)
+	ok(t, err)
+	ok(t, f.UnloadKey(false))
+	status, err = f.KeyStatus()
+	ok(t, err)
+	equals(t, zfs.KeyStatusUnavailable, status)
+
+	ok(t, f.LoadKey(zfs.LoadKeyOptions{Key: strings.NewReader("correct horse battery staple")}))
+	ok(t, f.ChangeKey(zfs.ChangeKeyOptions{Key: strings.NewReader("another passphrase entirely")}))
+
+	parent, err := zfs.GetDataset("test")
+	ok(t, err)
+	status, err = parent.KeyStatus()
+	ok(t, err)
+	equals(t, zfs.KeyStatusNone, status)
+
+	ok(t, f.Destroy(zfs.DestroyDefault))
+}
@@ -0,0 +1,229 @@
+package zfs
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Kinds of property sources.
+const (
+	SourceLocal     = "local"
+	SourceDefault   = "default"
+	SourceInherited = "inherited"
+	SourceReceived  = "received"
+	SourceTemporary = "temporary"
+	// SourceNone is the source of read-only properties, printed as "-".
+	SourceNone = "none"
+)
+
+// PropertySource is where the value of a property comes from, as printed in the source column of zfs get.
+type PropertySource struct {
+	// Kind is one of the Source constants.
+	Kind string
+	// From is the dataset the value is inherited from, if Kind is SourceInherited.
+	From string
+}
+
+// ParsePropertySource parses the source of a property, such as "local" or "inherited from tank".
+// Unknown sources are returned as their Kind.
+func ParsePropertySource(source string) PropertySource {
+	switch {
+	case source == "-" || source == "":
+		return PropertySource{Kind: SourceNone}
+	case strings.HasPrefix(source, "inherited from "):
+		return PropertySource{Kind: SourceInherited, From: strings.TrimPrefix(source, "inherited from ")}
+	}
+	return PropertySource{Kind: source}
+}
+
+// CompressionAlgorithm is the value of the compression property. Levels are part of the value, e.g. "gzip-9",
+// "zstd-19" or "zstd-fast-10".
+type CompressionAlgorithm string
+
+// Values of the compression property.
+const (
+	CompressionOff  CompressionAlgorithm = "off"
+	CompressionOn   CompressionAlgorithm = "on"
+	CompressionLZ4  CompressionAlgorithm = "lz4"
+	CompressionLZJB CompressionAlgorithm = "lzjb"
+	CompressionGzip CompressionAlgorithm = "gzip"
+	CompressionZLE  CompressionAlgorithm = "zle"
+	CompressionZstd CompressionAlgorithm = "zstd"
+)
+
+// ChecksumAlgorithm is the value of the checksum property.
+type ChecksumAlgorithm string
+
+// Values of the checksum property.
+const (
+	ChecksumOn        ChecksumAlgorithm = "on"
+	ChecksumOff       ChecksumAlgorithm = "off"
+	ChecksumFletcher2 ChecksumAlgorithm = "fletcher2"
+	ChecksumFletcher4 ChecksumAlgorithm = "fletcher4"
+	ChecksumSHA256    ChecksumAlgorithm = "sha256"
+	ChecksumSHA512    ChecksumAlgorithm = "sha512"
+	ChecksumSkein     ChecksumAlgorithm = "skein"
+	ChecksumEdonR     ChecksumAlgorithm = "edonr"
+	ChecksumBLAKE3    ChecksumAlgorithm = "blake3"
+	ChecksumNoParity  ChecksumAlgorithm = "noparity"
+)
+
+// SyncPolicy is the value of the sync property.
+type SyncPolicy string
+
+// Values of the sync property.
+const (
+	SyncStandard SyncPolicy = "standard"
+	SyncAlways   SyncPolicy = "always"
+	SyncDisabled SyncPolicy = "disabled"
+)
+
+// RedundantMetadataPolicy is the value of the redundant_metadata property.
+type RedundantMetadataPolicy string
+
+// Values of the redundant_metadata property.
+const (
+	RedundantMetadataAll  RedundantMetadataPolicy = "all"
+	RedundantMetadataMost RedundantMetadataPolicy = "most"
+	RedundantMetadataSome RedundantMetadataPolicy = "some"
+	RedundantMetadataNone RedundantMetadataPolicy = "none"
+)
+
+// DatasetProperties are the native properties of a dataset with typed values, as returned by Dataset.Properties.
+// Properties which do not apply to the type of the dataset have their zero value.
+type DatasetProperties struct {
+	Name   string
+	Type   string
+	Origin string
+	// Creation is the time the dataset was created.
+	Creation time.Time
+	// Used, Available, Referenced, LogicalUsed, LogicalReferenced, Written and the UsedBy properties are in bytes.
+	Used                 uint64
+	Available            uint64
+	Referenced           uint64
+	LogicalUsed          uint64
+	LogicalReferenced    uint64
+	Written              uint64
+	UsedByDataset        uint64
+	UsedBySnapshots      uint64
+	UsedByChildren       uint64
+	UsedByRefReservation uint64
+	// Quota, RefQuota, Reservation and RefReservation are in bytes, zero if none is set.
+	Quota          uint64
+	RefQuota       uint64
+	Reservation    uint64
+	RefReservation uint64
+	// RecordSize, VolSize and VolBlockSize are in bytes.
+	RecordSize   uint64
+	VolSize      uint64
+	VolBlockSize uint64
+	// CompressRatio is the ratio of the logical to the physical size of the referenced data, e.g. 1.5.
+	CompressRatio float64
+	Mountpoint    string
+	// CanMount is "on", "off" or "noauto".
+	CanMount string
+	Mounted  bool
+	ReadOnly bool
+	Atime    bool
+	Relatime bool
+	Exec     bool
+	Setuid   bool
+	Devices  bool
+	// Jailed is set for filesystems which may be attached to a FreeBSD jail, see Dataset.Jail.
+	// It is always false on Linux.
+	Jailed bool
+
+	Compression       CompressionAlgorithm
+	Checksum          ChecksumAlgorithm
+	Sync              SyncPolicy
+	RedundantMetadata RedundantMetadataPolicy
+	SnapDir           SnapDir
+	SnapDev           SnapDev
+
+	// Sources holds the source of every property, keyed by property name.
+	Sources map[string]PropertySource
+	// Raw holds all properties as printed, including user properties and those without a typed field.
+	Raw map[string]Property
+}
+
+// Properties returns all native properties of the dataset with typed values, in exact (parsable) format.
+func (d *Dataset) Properties() (*DatasetProperties, error) {
+	return d.PropertiesContext(context.Background())
+}
+
+// PropertiesContext is like Properties but includes a context.
+func (d *Dataset) PropertiesContext(ctx context.Context) (*DatasetProperties, error) {
+	out, err := zfsOutput(ctx, "get", "-Hp", "-o", "name,property,value,source", "all", d.Name)
+	if err != nil {
+		return nil, err
+	}
+	props, err := parsePropertyLines(out)
+	if err != nil {
+		return nil, err
+	}
+	return parseDatasetProperties(d.Name, props)
+}
+
+func parseDatasetProperties(name string, props map[string]Property) (*DatasetProperties, error) {
+	p := &DatasetProperties{Name: name, Sources: make(map[string]PropertySource, len(props)), Raw: props}
+	uints := map[string]*uint64{
+		"used": &p.Used, "available": &p.Available, "referenced": &p.Referenced,
+		"logicalused": &p.LogicalUsed, "logicalreferenced": &p.LogicalReferenced, "written": &p.Written,
+		"usedbydataset": &p.UsedByDataset, "usedbysnapshots": &p.UsedBySnapshots,
+		"usedbychildren": &p.UsedByChildren, "usedbyrefreservation": &p.UsedByRefReservation,
+		"quota": &p.Quota, "refquota": &p.RefQuota, "reservation": &p.Reservation,
+		"refreservation": &p.RefReservation, "recordsize": &p.RecordSize, "volsize": &p.VolSize,
+		"volblocksize": &p.VolBlockSize,
+	}
+	bools := map[string]*bool{
+		"readonly": &p.ReadOnly, "atime": &p.Atime, "relatime": &p.Relatime, "exec": &p.Exec,
+		"setuid": &p.Setuid, "devices": &p.Devices, "jailed": &p.Jailed,
+	}
+	for key, prop := range props {
+		p.Sources[key] = ParsePropertySource(prop.Source)
+		value := prop.Value
+		var err error
+		if field, ok := uints[key]; ok {
+			err = setUint(field, value)
+		} else if field, ok := bools[key]; ok {
+			*field = value == "on"
+		}
+		switch key {
+		case "type":
+			setString(&p.Type, value)
+		case "origin":
+			setString(&p.Origin, value)
+		case "mountpoint":
+			setString(&p.Mountpoint, value)
+		case "canmount":
+			setString(&p.CanMount, value)
+		case "mounted":
+			p.Mounted = value == "yes"
+		case "creation":
+			var created int64
+			created, err = strconv.ParseInt(value, 10, 64)
+			p.Creation = time.Unix(created, 0)
+		case "compressratio":
+			p.CompressRatio, err = strconv.ParseFloat(strings.TrimSuffix(value, "x"), 64)
+		case "compression":
+			p.Compression = CompressionAlgorithm(value)
+		case "checksum":
+			p.Checksum = ChecksumAlgorithm(value)
+		case "sync":
+			p.Sync = SyncPolicy(value)
+		case "redundant_metadata":
+			p.RedundantMetadata = RedundantMetadataPolicy(value)
+		case "snapdir":
+			p.SnapDir = SnapDir(value)
+		case "snapdev":
+			p.SnapDev = SnapDev(value)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid property %s of %s: %w", key, name, err)
+		}
+	}
+	return p, nil
+}
@@ -0,0 +1,68 @@
+package zfs
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDatasetProperties(t *testing.T) {
+	ctx, r := withFakeRunner("tank/fs\ttype\tfilesystem\t-\n" +
+		"tank/fs\tcreation\t1627207200\t-\n" +
+		"tank/fs\tused\t1048576\t-\n" +
+		"tank/fs\tquota\t0\tdefault\n" +
+		"tank/fs\trecordsize\t1048576\tlocal\n" +
+		"tank/fs\tcompressratio\t1.50x\t-\n" +
+		"tank/fs\tmounted\tyes\t-\n" +
+		"tank/fs\tmountpoint\t/tank/fs\tdefault\n" +
+		"tank/fs\tatime\toff\tinherited from tank\n" +
+		"tank/fs\texec\ton\tdefault\n" +
+		"tank/fs\torigin\t-\t-\n" +
+		"tank/fs\tcompression\tzstd-3\treceived\n" +
+		"tank/fs\tchecksum\tsha256\tlocal\n" +
+		"tank/fs\tsync\tdisabled\ttemporary\n" +
+		"tank/fs\tredundant_metadata\tmost\tlocal\n" +
+		"tank/fs\tsnapdir\tvisible\tlocal\n" +
+		"tank/fs\tcom.example:owner\talice\tlocal\n")
+	got, err := (&Dataset{Name: "tank/fs"}).PropertiesContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"zfs", "get", "-Hp", "-o", "name,property,value,source", "all", "tank/fs"}
+	if call := r.calls[len(r.calls)-1]; !reflect.DeepEqual(want, call) {
+		t.Fatalf("want: %q, got: %q", want, call)
+	}
+
+	if got.Type != DatasetFilesystem || got.Used != 1<<20 || got.RecordSize != 1<<20 || got.Quota != 0 {
+		t.Fatalf("unexpected properties: %+v", got)
+	}
+	if !got.Creation.Equal(time.Unix(1627207200, 0)) || got.CompressRatio != 1.5 {
+		t.Fatalf("unexpected creation or compressratio: %v, %v", got.Creation, got.CompressRatio)
+	}
+	if !got.Mounted || got.Atime || !got.Exec || got.Mountpoint != "/tank/fs" || got.Origin != "" {
+		t.Fatalf("unexpected properties: %+v", got)
+	}
+	if got.Compression != "zstd-3" || got.Checksum != ChecksumSHA256 || got.Sync != SyncDisabled ||
+		got.RedundantMetadata != RedundantMetadataMost || got.SnapDir != SnapDirVisible {
+		t.Fatalf("unexpected properties: %+v", got)
+	}
+	for name, source := range map[string]PropertySource{
+		"used":        {Kind: SourceNone},
+		"quota":       {Kind: SourceDefault},
+		"recordsize":  {Kind: SourceLocal},
+		"atime":       {Kind: SourceInherited, From: "tank"},
+		"compression": {Kind: SourceReceived},
+		"sync":        {Kind: SourceTemporary},
+	} {
+		if got.Sources[name] != source {
+			t.Fatalf("want source of %s: %+v, got: %+v", name, source, got.Sources[name])
+		}
+	}
+	if got.Raw["com.example:owner"].Value != "alice" {
+		t.Fatalf("want raw user property, got: %+v", got.Raw["com.example:owner"])
+	}
+
+	if _, err := parseDatasetProperties("tank/fs", map[string]Property{"used": {Name: "used", Value: "1M"}}); err == nil {
+		t.Fatal("expected error for non-parsable size")
+	}
+}
@@ -0,0 +1,100 @@
+package zfs
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Types of principals reported by UserSpace, GroupSpace and ProjectSpace.
+const (
+	SpacePOSIXUser  = "POSIX User"
+	SpacePOSIXGroup = "POSIX Group"
+	SpaceSMBUser    = "SMB User"
+	SpaceSMBGroup   = "SMB Group"
+	SpaceProject    = "Project"
+)
+
+// PrincipalSpace is the space used by a user, group or project in a dataset, and its quotas.
+// Quotas are zero if none is set, object counts are zero if the pool does not account for them.
+type PrincipalSpace struct {
+	// Type is one of the Space constants.
+	Type        string
+	Name        string
+	Used        uint64
+	Quota       uint64
+	ObjectsUsed uint64
+	ObjectQuota uint64
+}
+
+// UserSpace returns the space used by each user in the dataset, as reported by zfs userspace.
+func (d *Dataset) UserSpace() ([]*PrincipalSpace, error) {
+	return d.UserSpaceContext(context.Background())
+}
+
+// UserSpaceContext is like UserSpace but includes a context.
+func (d *Dataset) UserSpaceContext(ctx context.Context) ([]*PrincipalSpace, error) {
+	return principalSpace(ctx, "userspace", d.Name)
+}
+
+// GroupSpace returns the space used by each group in the dataset, as reported by zfs groupspace.
+func (d *Dataset) GroupSpace() ([]*PrincipalSpace, error) {
+	return d.GroupSpaceContext(context.Background())
+}
+
+// GroupSpaceContext is like GroupSpace but includes a context.
+func (d *Dataset) GroupSpaceContext(ctx context.Context) ([]*PrincipalSpace, error) {
+	return principalSpace(ctx, "groupspace", d.Name)
+}
+
+// ProjectSpace returns the space used by each project in the dataset, as reported by zfs projectspace.
+func (d *Dataset) ProjectSpace() ([]*PrincipalSpace, error) {
+	return d.ProjectSpaceContext(context.Background())
+}
+
+// ProjectSpaceContext is like ProjectSpace but includes a context.
+func (d *Dataset) ProjectSpaceContext(ctx context.Context) ([]*PrincipalSpace, error) {
+	return principalSpace(ctx, "projectspace", d.Name)
+}
+
+func principalSpace(ctx context.Context, subcommand, name string) ([]*PrincipalSpace, error) {
+	// zfs projectspace has no type column
+	columns := "type,name,used,quota,objused,objquota"
+	if subcommand == "projectspace" {
+		columns = "name,used,quota,objused,objquota"
+	}
+	out, err := zfsOutput(ctx, subcommand, "-Hp", "-o", columns, name)
+	if err != nil {
+		return nil, err
+	}
+	return parsePrincipalSpace(out, subcommand == "projectspace")
+}
+
+// example input for parsePrincipalSpace
+// POSIX User	alice	1048576	10737418240	12	none
+// POSIX User	bob	4096	none	1	none
+
+func parsePrincipalSpace(out [][]string, project bool) ([]*PrincipalSpace, error) {
+	spaces := make([]*PrincipalSpace, 0, len(out))
+	for _, line := range out {
+		s := &PrincipalSpace{Type: SpaceProject}
+		if !project && len(line) > 0 {
+			s.Type, line = line[0], line[1:]
+		}
+		if len(line) != 5 {
+			return nil, fmt.Errorf("invalid space usage %q", strings.Join(line, "\t"))
+		}
+		s.Name = line[0]
+		for i, field := range []*uint64{&s.Used, &s.Quota, &s.ObjectsUsed, &s.ObjectQuota} {
+			value := line[i+1]
+			if value == "none" {
+				value = "0"
+			}
+			if err := setUint(field, value); err != nil {
+				return nil, fmt.Errorf("invalid space usage of %s: %w", s.Name, err)
+			}
+		}
+		spaces = append(spaces, s)
+	}
+	return spaces, nil
+}
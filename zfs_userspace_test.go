@@ -0,0 +1,42 @@
+package zfs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUserSpace(t *testing.T) {
+	ctx, r := withFakeRunner("POSIX User\talice\t1048576\t10737418240\t12\tnone\nPOSIX User\tbob\t4096\tnone\t-\t-\n")
+	d := &Dataset{Name: "tank/home"}
+	spaces, err := d.UserSpaceContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*PrincipalSpace{
+		{Type: SpacePOSIXUser, Name: "alice", Used: 1 << 20, Quota: 10 << 30, ObjectsUsed: 12},
+		{Type: SpacePOSIXUser, Name: "bob", Used: 4096},
+	}
+	if !reflect.DeepEqual(want, spaces) {
+		t.Fatalf("want: %+v, got: %+v", want, spaces)
+	}
+	if want := [][]string{{"zfs", "userspace", "-Hp", "-o", "type,name,used,quota,objused,objquota", "tank/home"}}; !reflect.DeepEqual(want, r.calls) {
+		t.Fatalf("want calls: %q, got: %q", want, r.calls)
+	}
+
+	ctx, r = withFakeRunner("100\t8192\t1048576\t2\tnone\n")
+	spaces, err = d.ProjectSpaceContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []*PrincipalSpace{{Type: SpaceProject, Name: "100", Used: 8192, Quota: 1 << 20, ObjectsUsed: 2}}; !reflect.DeepEqual(want, spaces) {
+		t.Fatalf("want: %+v, got: %+v", want, spaces)
+	}
+	if want := [][]string{{"zfs", "projectspace", "-Hp", "-o", "name,used,quota,objused,objquota", "tank/home"}}; !reflect.DeepEqual(want, r.calls) {
+		t.Fatalf("want calls: %q, got: %q", want, r.calls)
+	}
+
+	ctx, _ = withFakeRunner("POSIX Group\tstaff\t4096\n")
+	if _, err := d.GroupSpaceContext(ctx); err == nil {
+		t.Fatal("expected error for missing columns")
+	}
+}
@@ -0,0 +1,296 @@
+package zfs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// VolMode is the value of the volmode property, which selects how a volume is exposed to the operating system.
+type VolMode string
+
+// Values of the volmode property.
+const (
+	// VolModeDefault uses the volmode module parameter of the system, which defaults to VolModeFull.
+	VolModeDefault VolMode = "default"
+	// VolModeFull exposes volumes as block devices with partitions; VolModeGeom is its name on FreeBSD.
+	VolModeFull VolMode = "full"
+	VolModeGeom VolMode = "geom"
+	// VolModeDev exposes volumes as block devices without partitions.
+	VolModeDev VolMode = "dev"
+	// VolModeNone does not expose volumes outside of ZFS, e.g. for volumes which are only replicated.
+	VolModeNone VolMode = "none"
+)
+
+// SnapDev is the value of the snapdev property, which selects whether the snapshots of a volume have devices.
+type SnapDev string
+
+// Values of the snapdev property.
+const (
+	SnapDevHidden  SnapDev = "hidden"
+	SnapDevVisible SnapDev = "visible"
+)
+
+// CreateVolumeOptions are the options which can be passed to CreateVolumeWithOptions.
+//
+// A full description of the options may be found in the ZFS manual:
+// https://openzfs.github.io/openzfs-docs/man/8/zfs-create.8.html.
+type CreateVolumeOptions struct {
+	// Properties are set on the new volume, see CreateVolume.
+	Properties map[string]string
+	// VolBlockSize is the block size of the volume in bytes, a power of two from 512 bytes to 16 MiB which the
+	// size must be a multiple of. Zero uses the zfs default.
+	VolBlockSize uint64
+	// Sparse creates the volume without a reservation (-s).
+	Sparse bool
+	// VolMode selects how the volume is exposed, the zfs default if empty.
+	VolMode VolMode
+	// SnapDev selects whether snapshots of the volume have devices, the zfs default if empty.
+	SnapDev SnapDev
+	// Encryption, if set, creates an encrypted volume.
+	Encryption *EncryptionOptions
+}
+
+func (o *CreateVolumeOptions) args(size uint64) ([]string, error) {
+	if size == 0 {
+		return nil, errors.New("volume size must not be zero")
+	}
+	props := make(map[string]string, len(o.Properties))
+	for k, v := range o.Properties {
+		props[k] = v
+	}
+	if bs := o.VolBlockSize; bs != 0 {
+		if err := ValidateVolBlockSize(bs); err != nil {
+			return nil, err
+		}
+		if size%bs != 0 {
+			return nil, fmt.Errorf("volume size %d is not a multiple of the block size %d", size, bs)
+		}
+		props["volblocksize"] = strconv.FormatUint(bs, 10)
+	}
+	switch o.VolMode {
+	case "":
+	case VolModeDefault, VolModeFull, VolModeGeom, VolModeDev, VolModeNone:
+		props["volmode"] = string(o.VolMode)
+	default:
+		return nil, fmt.Errorf("invalid volmode %q", o.VolMode)
+	}
+	switch o.SnapDev {
+	case "":
+	case SnapDevHidden, SnapDevVisible:
+		props["snapdev"] = string(o.SnapDev)
+	default:
+		return nil, fmt.Errorf("invalid snapdev %q", o.SnapDev)
+	}
+	if o.Encryption != nil {
+		for k, v := range o.Encryption.properties() {
+			props[k] = v
+		}
+	}
+
+	args := []string{"create", "-p"}
+	if o.Sparse {
+		args = append(args, "-s")
+	}
+	args = append(args, "-V", strconv.FormatUint(size, 10))
+	return append(args, propsSlice(props)...), nil
+}
+
+// CreateVolumeWithOptions creates a new ZFS volume with the specified name, size in bytes and options.
+// See WaitZvolDevice to wait for the device of the new volume, which is created asynchronously.
+func CreateVolumeWithOptions(name string, size uint64, opts CreateVolumeOptions) (*Dataset, error) {
+	return CreateVolumeWithOptionsContext(context.Background(), name, size, opts)
+}
+
+// CreateVolumeWithOptionsContext is like CreateVolumeWithOptions but includes a context.
+func CreateVolumeWithOptionsContext(ctx context.Context, name string, size uint64, opts CreateVolumeOptions) (*Dataset, error) {
+	args, err := opts.args(size)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateProperties(ctx, opts.Properties); err != nil {
+		return nil, err
+	}
+	warnLargeBlocks(ctx, "volblocksize", opts.VolBlockSize)
+	c := command{Command: "zfs"}
+	if opts.Encryption != nil {
+		c.Stdin = opts.Encryption.Key
+	}
+	if _, err := c.Run(ctx, append(args, name)...); err != nil {
+		return nil, err
+	}
+	return GetDatasetContext(ctx, name)
+}
+
+// ZvolDevicePath returns the path of the device of the volume, or of the snapshot of a volume, with the given name.
+func ZvolDevicePath(name string) string {
+	return path.Join("/dev/zvol", name)
+}
+
+// zvolPollInterval is the interval in which WaitZvolDevice checks for the device.
+var zvolPollInterval = 100 * time.Millisecond
+
+// WaitZvolDevice waits until the device of the volume with the given name exists and returns its path, e.g. right
+// after the volume was created, renamed or its pool imported, when the device is created asynchronously by udev.
+// Zero waits until ctx becomes done. Devices are looked up with udevadm on the host which runs the commands.
+func WaitZvolDevice(name string, timeout time.Duration) (string, error) {
+	return WaitZvolDeviceContext(context.Background(), name, timeout)
+}
+
+// WaitZvolDeviceContext is like WaitZvolDevice but includes a context.
+func WaitZvolDeviceContext(ctx context.Context, name string, timeout time.Duration) (string, error) {
+	device := ZvolDevicePath(name)
+	var lastErr error
+	err := waitTimeout(ctx, timeout, func(ctx context.Context) error {
+		for {
+			// settle returns once udev processed pending events, which may not yet include those of the volume
+			settle := command{Command: "udevadm"}
+			_, _ = settle.Run(ctx, "settle", "--exit-if-exists="+device)
+			if _, _, lastErr = (UdevLinks{}).DeviceLinks(ctx, device); lastErr == nil {
+				return nil
+			}
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(zvolPollInterval):
+			}
+		}
+	})
+	if err != nil {
+		if lastErr != nil && ctx.Err() == nil {
+			return "", fmt.Errorf("device %s did not appear: %w", device, lastErr)
+		}
+		return "", err
+	}
+	return device, nil
+}
+
+// DevicePath returns the path of the device of the volume, see ZvolDevicePath. No command is run.
+func (d *Dataset) DevicePath() string {
+	return ZvolDevicePath(d.Name)
+}
+
+// ResizeVolume sets the size of the volume to newSize bytes, e.g. to grow the disk of a running VM. Shrinking a
+// volume destroys the data beyond the new size, so it is refused unless allowShrink is set.
+// The Volsize of the receiving dataset is updated.
+func (d *Dataset) ResizeVolume(newSize uint64, allowShrink bool) error {
+	return d.ResizeVolumeContext(context.Background(), newSize, allowShrink)
+}
+
+// ResizeVolumeContext is like ResizeVolume but includes a context.
+func (d *Dataset) ResizeVolumeContext(ctx context.Context, newSize uint64, allowShrink bool) error {
+	if d.Type != "" && d.Type != DatasetVolume {
+		return errors.New("can only resize volumes")
+	}
+	if newSize == 0 {
+		return errors.New("volume size must not be zero")
+	}
+	out, err := zfsOutput(ctx, "get", "-Hp", "-o", "value", "volsize", d.Name)
+	if err != nil {
+		return err
+	}
+	var current uint64
+	if len(out) != 1 || len(out[0]) != 1 {
+		return fmt.Errorf("unexpected volsize of %s: %q", d.Name, out)
+	}
+	if err := setUint(&current, out[0][0]); err != nil {
+		return fmt.Errorf("invalid volsize of %s: %w", d.Name, err)
+	}
+	if newSize < current && !allowShrink {
+		return fmt.Errorf("refusing to shrink volume %s from %d to %d bytes", d.Name, current, newSize)
+	}
+	if newSize != current {
+		if err := zfs(ctx, "set", "volsize="+strconv.FormatUint(newSize, 10), d.Name); err != nil {
+			return err
+		}
+	}
+	d.Volsize = newSize
+	return nil
+}
+
+// ZvolUsage describes what uses the device of a volume, as returned by Dataset.VolumeUsage.
+type ZvolUsage struct {
+	// Device is the kernel name of the device, e.g. /dev/zd0.
+	Device string
+	// PIDs are the processes which have the device open, such as a VM.
+	PIDs []int
+	// Holders are the kernel devices stacked on the device, such as device mapper or md devices.
+	Holders []string
+	// Backstores are the paths of the LIO backstores in configfs backed by the device, which export it over iSCSI
+	// or another fabric, e.g. /sys/kernel/config/target/core/iblock_0/vm-disk0.
+	Backstores []string
+}
+
+// InUse reports whether anything uses the device.
+func (u *ZvolUsage) InUse() bool {
+	return len(u.PIDs) > 0 || len(u.Holders) > 0 || len(u.Backstores) > 0
+}
+
+// lioConfigDir is the configfs directory of the LIO backstores.
+const lioConfigDir = "/sys/kernel/config/target/core"
+
+// VolumeUsage finds out what uses the device of the volume on a Linux host: processes which have it open with
+// fuser, kernel devices stacked on it in sysfs, and LIO backstores in configfs. It is meant to be checked before
+// the volume is destroyed, renamed or shrunk, as a device in use may change at any time.
+func (d *Dataset) VolumeUsage() (*ZvolUsage, error) {
+	return d.VolumeUsageContext(context.Background())
+}
+
+// VolumeUsageContext is like VolumeUsage but includes a context.
+func (d *Dataset) VolumeUsageContext(ctx context.Context) (*ZvolUsage, error) {
+	device := d.DevicePath()
+	kernel, _, err := (UdevLinks{}).DeviceLinks(ctx, device)
+	if err != nil {
+		return nil, err
+	}
+	u := &ZvolUsage{Device: kernel}
+
+	// fuser and grep exit with 1 if nothing matched
+	out, err := commandOutput(ctx, "fuser", kernel)
+	if err != nil && !exitedWith(err, 1) {
+		return nil, err
+	}
+	for _, f := range strings.Fields(out) {
+		// fuser appends the kind of access to the pids, e.g. "1234m"
+		pid, err := strconv.Atoi(strings.TrimRight(f, "cefFmr"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid fuser output %q", out)
+		}
+		u.PIDs = append(u.PIDs, pid)
+	}
+
+	out, err = commandOutput(ctx, "ls", "-1", path.Join("/sys/class/block", path.Base(kernel), "holders"))
+	if err != nil {
+		return nil, err
+	}
+	u.Holders = strings.Fields(out)
+
+	// grep exits with 2 if LIO is not loaded and its configfs directory is missing
+	out, err = commandOutput(ctx, "grep", "-rlsxF", "--include=udev_path", "-e", device, "-e", kernel, lioConfigDir)
+	if err != nil && !exitedWith(err, 1) && !exitedWith(err, 2) {
+		return nil, err
+	}
+	for _, f := range strings.Fields(out) {
+		u.Backstores = append(u.Backstores, path.Dir(f))
+	}
+	return u, nil
+}
+
+// commandOutput runs a command other than zfs and zpool and returns its stdout.
+func commandOutput(ctx context.Context, name string, arg ...string) (string, error) {
+	var out bytes.Buffer
+	c := command{Command: name, Stdout: &out}
+	_, err := c.Run(ctx, arg...)
+	return out.String(), err
+}
+
+// exitedWith reports whether err is the *Error of a command which exited with code.
+func exitedWith(err error, code int) bool {
+	var zerr *Error
+	return errors.As(err, &zerr) && zerr.ExitCode == code
+}
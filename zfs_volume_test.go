@@ -0,0 +1,159 @@
+package zfs
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCreateVolumeWithOptions(t *testing.T) {
+	ctx, r := withFakeRunner("tank/vm/disk0\t-\t8192\t2048\t-\toff\tvolume\t1073741824\t-\t8192\t0\t8192\t8192\n")
+	d, err := CreateVolumeWithOptionsContext(ctx, "tank/vm/disk0", 1<<30, CreateVolumeOptions{
+		VolBlockSize: 16384,
+		Sparse:       true,
+		VolMode:      VolModeDev,
+		SnapDev:      SnapDevVisible,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Volsize != 1<<30 {
+		t.Fatalf("unexpected volume: %+v", d)
+	}
+	call := r.calls[0]
+	if want := []string{"zfs", "create", "-p", "-s", "-V", "1073741824"}; len(call) != 13 || !reflect.DeepEqual(want, call[:6]) || call[12] != "tank/vm/disk0" {
+		t.Fatalf("unexpected call: %q", call)
+	}
+	// properties are passed in no particular order
+	for _, prop := range []string{"volblocksize=16384", "volmode=dev", "snapdev=visible"} {
+		if !strings.Contains(strings.Join(call, " "), "-o "+prop) {
+			t.Fatalf("expected %s in %q", prop, call)
+		}
+	}
+
+	for _, opts := range []CreateVolumeOptions{
+		{VolBlockSize: 3000},
+		{VolBlockSize: 256},
+		{VolBlockSize: 32 << 20},
+		{VolBlockSize: 1 << 21},
+		{VolMode: "block"},
+		{SnapDev: "shown"},
+	} {
+		if _, err := opts.args(1 << 20); err == nil {
+			t.Fatalf("expected error for %+v", opts)
+		}
+	}
+	if _, err := (&CreateVolumeOptions{}).args(0); err == nil {
+		t.Fatal("expected error for zero size")
+	}
+}
+
+func TestWaitZvolDevice(t *testing.T) {
+	defer func(interval time.Duration) { zvolPollInterval = interval }(zvolPollInterval)
+	zvolPollInterval = time.Millisecond
+
+	lookups := 0
+	r := &fakeRunner{output: func(args []string) (string, error) {
+		if args[1] != "info" {
+			return "", nil
+		}
+		if lookups++; lookups < 3 {
+			return "", errors.New("Unknown device")
+		}
+		return "N: zd0\nS: zvol/tank/vm/disk0\n", nil
+	}}
+	ctx := WithRunner(context.Background(), r)
+	device, err := WaitZvolDeviceContext(ctx, "tank/vm/disk0", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if device != "/dev/zvol/tank/vm/disk0" || lookups != 3 {
+		t.Fatalf("unexpected device %q after %d lookups", device, lookups)
+	}
+	if want := []string{"udevadm", "settle", "--exit-if-exists=/dev/zvol/tank/vm/disk0"}; !reflect.DeepEqual(want, r.calls[0]) {
+		t.Fatalf("want: %q, got: %q", want, r.calls[0])
+	}
+
+	lookups = -1 << 30
+	_, err = WaitZvolDeviceContext(ctx, "tank/vm/disk0", 10*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "did not appear") {
+		t.Fatalf("expected timeout error, got %v", err)
+	}
+}
+
+func TestResizeVolume(t *testing.T) {
+	ctx, r := withFakeRunner("1073741824\n")
+	d := &Dataset{Name: "tank/vm/disk0", Type: DatasetVolume}
+	if err := d.ResizeVolumeContext(ctx, 2<<30, false); err != nil {
+		t.Fatal(err)
+	}
+	if d.Volsize != 2<<30 {
+		t.Fatalf("unexpected volsize %d", d.Volsize)
+	}
+	want := [][]string{
+		{"zfs", "get", "-Hp", "-o", "value", "volsize", "tank/vm/disk0"},
+		{"zfs", "set", "volsize=2147483648", "tank/vm/disk0"},
+	}
+	if !reflect.DeepEqual(want, r.calls) {
+		t.Fatalf("want: %q, got: %q", want, r.calls)
+	}
+
+	if err := d.ResizeVolumeContext(ctx, 1<<29, false); err == nil || !strings.Contains(err.Error(), "refusing to shrink") {
+		t.Fatalf("expected shrink error, got %v", err)
+	}
+	if err := d.ResizeVolumeContext(ctx, 1<<29, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := (&Dataset{Name: "tank/fs", Type: DatasetFilesystem}).ResizeVolumeContext(ctx, 1<<30, false); err == nil {
+		t.Fatal("expected error resizing a filesystem")
+	}
+}
+
+func TestVolumeUsage(t *testing.T) {
+	outputs := map[string]string{
+		"udevadm": "N: zd16\nS: zvol/tank/vm/disk0\n",
+		"fuser":   " 1234 5678m\n",
+		"ls":      "dm-3\n",
+		"grep":    "/sys/kernel/config/target/core/iblock_0/disk0/udev_path\n",
+	}
+	r := &fakeRunner{output: func(args []string) (string, error) {
+		return outputs[args[0]], nil
+	}}
+	ctx := WithRunner(context.Background(), r)
+	d := &Dataset{Name: "tank/vm/disk0"}
+	u, err := d.VolumeUsageContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &ZvolUsage{
+		Device:     "/dev/zd16",
+		PIDs:       []int{1234, 5678},
+		Holders:    []string{"dm-3"},
+		Backstores: []string{"/sys/kernel/config/target/core/iblock_0/disk0"},
+	}
+	if !reflect.DeepEqual(want, u) || !u.InUse() {
+		t.Fatalf("want: %+v, got: %+v", want, u)
+	}
+	if want := []string{"grep", "-rlsxF", "--include=udev_path", "-e", "/dev/zvol/tank/vm/disk0", "-e", "/dev/zd16", lioConfigDir}; !reflect.DeepEqual(want, r.calls[3]) {
+		t.Fatalf("want: %q, got: %q", want, r.calls[3])
+	}
+
+	r.output = func(args []string) (string, error) {
+		switch args[0] {
+		case "udevadm":
+			return outputs["udevadm"], nil
+		case "fuser", "grep":
+			return "", exitError(1)
+		}
+		return "", nil
+	}
+	if u, err = d.VolumeUsageContext(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if u.InUse() {
+		t.Fatalf("unexpected usage: %+v", u)
+	}
+}
@@ -0,0 +1,10 @@
+module github.com/mistifyio/go-zfs/v3/zfsmetrics
+
+go 1.14
+
+require (
+	github.com/mistifyio/go-zfs/v3 v3.0.0-00010101000000-000000000000
+	github.com/prometheus/client_golang v1.11.1
+)
+
+replace github.com/mistifyio/go-zfs/v3 => ../
@@ -0,0 +1,304 @@
+// Package zfsmetrics provides a Prometheus collector of ZFS pool, vdev, scrub, dataset and ARC metrics,
+// built on the parsing of go-zfs.
+//
+// Usage:
+//
+//	prometheus.MustRegister(zfsmetrics.NewCollector(zfsmetrics.Options{Datasets: true, Arc: true}))
+//	http.Handle("/metrics", promhttp.Handler())
+package zfsmetrics
+
+import (
+	"context"
+	"time"
+
+	zfs "github.com/mistifyio/go-zfs/v3"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "zfs"
+
+// Options configure a Collector.
+type Options struct {
+	// Runner executes the zfs and zpool commands, the Runner set with zfs.SetRunner is used if nil.
+	Runner zfs.Runner
+	// Timeout limits the time taken by a single collection, zero means no limit.
+	Timeout time.Duration
+	// Datasets enables the usage metrics of filesystems and volumes, which may be expensive on pools with many datasets.
+	Datasets bool
+	// Arc enables the metrics of the ARC, L2ARC and prefetcher.
+	// On Linux these are read from the local host even if Runner executes commands on a remote one.
+	Arc bool
+}
+
+// Collector is a prometheus.Collector gathering metrics of all pools, and optionally datasets, on every scrape.
+type Collector struct {
+	opts Options
+
+	poolHealth        *prometheus.Desc
+	poolSize          *prometheus.Desc
+	poolAllocated     *prometheus.Desc
+	poolFree          *prometheus.Desc
+	poolFragmentation *prometheus.Desc
+	poolDedupRatio    *prometheus.Desc
+	poolReadOnly      *prometheus.Desc
+	poolFreeing       *prometheus.Desc
+	poolLeaked        *prometheus.Desc
+
+	vdevState  *prometheus.Desc
+	vdevErrors *prometheus.Desc
+
+	scrubState    *prometheus.Desc
+	scrubProgress *prometheus.Desc
+	scrubErrors   *prometheus.Desc
+	scrubEnd      *prometheus.Desc
+
+	datasetUsed       *prometheus.Desc
+	datasetAvailable  *prometheus.Desc
+	datasetReferenced *prometheus.Desc
+	datasetLogical    *prometheus.Desc
+	datasetWritten    *prometheus.Desc
+	datasetQuota      *prometheus.Desc
+
+	arcSize      *prometheus.Desc
+	arcTarget    *prometheus.Desc
+	arcMin       *prometheus.Desc
+	arcMax       *prometheus.Desc
+	arcHits      *prometheus.Desc
+	arcMisses    *prometheus.Desc
+	l2Hits       *prometheus.Desc
+	l2Misses     *prometheus.Desc
+	l2Size       *prometheus.Desc
+	l2Allocated  *prometheus.Desc
+	zfetchHits   *prometheus.Desc
+	zfetchMisses *prometheus.Desc
+
+	scrapeSuccess *prometheus.Desc
+}
+
+// poolStates are the states reported by the zfs_pool_health and zfs_vdev_state metrics.
+var poolStates = []string{zfs.ZpoolOnline, zfs.ZpoolDegraded, zfs.ZpoolFaulted, zfs.ZpoolOffline, zfs.ZpoolUnavail, zfs.ZpoolRemoved}
+
+// scanStates are the states reported by the zfs_pool_scrub_state metric.
+var scanStates = []string{zfs.ScanStateNone, zfs.ScanStateInProgress, zfs.ScanStatePaused, zfs.ScanStateFinished, zfs.ScanStateCanceled}
+
+// NewCollector returns a Collector configured by opts.
+func NewCollector(opts Options) *Collector {
+	pool := []string{"pool"}
+	vdev := []string{"pool", "vdev"}
+	dataset := []string{"dataset", "type"}
+	desc := func(subsystem, name, help string, labels []string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, subsystem, name), help, labels, nil)
+	}
+	return &Collector{
+		opts: opts,
+
+		poolHealth:        desc("pool", "health", "Whether the pool is in the given state.", []string{"pool", "state"}),
+		poolSize:          desc("pool", "size_bytes", "Total size of the pool.", pool),
+		poolAllocated:     desc("pool", "allocated_bytes", "Space allocated in the pool.", pool),
+		poolFree:          desc("pool", "free_bytes", "Free space in the pool.", pool),
+		poolFragmentation: desc("pool", "fragmentation_ratio", "Fragmentation of the free space of the pool.", pool),
+		poolDedupRatio:    desc("pool", "dedup_ratio", "Deduplication ratio of the pool.", pool),
+		poolReadOnly:      desc("pool", "readonly", "Whether the pool is imported read-only.", pool),
+		poolFreeing:       desc("pool", "freeing_bytes", "Space being freed in the background from destroyed datasets.", pool),
+		poolLeaked:        desc("pool", "leaked_bytes", "Space leaked while freeing destroyed datasets.", pool),
+
+		vdevState:  desc("vdev", "state", "Whether the vdev is in the given state.", []string{"pool", "vdev", "state"}),
+		vdevErrors: desc("vdev", "errors_total", "I/O errors of the vdev since the pool was imported or cleared.", append(vdev, "type")),
+
+		scrubState:    desc("pool", "scrub_state", "Whether the most recent scrub of the pool is in the given state.", []string{"pool", "state"}),
+		scrubProgress: desc("pool", "scrub_progress_ratio", "Progress of the scrub of the pool.", pool),
+		scrubErrors:   desc("pool", "scrub_errors", "Errors found by the most recent scrub of the pool.", pool),
+		scrubEnd:      desc("pool", "scrub_end_timestamp_seconds", "Time the most recent scrub of the pool ended.", pool),
+
+		datasetUsed:       desc("dataset", "used_bytes", "Space used by the dataset and its descendents.", dataset),
+		datasetAvailable:  desc("dataset", "available_bytes", "Space available to the dataset.", dataset),
+		datasetReferenced: desc("dataset", "referenced_bytes", "Space referenced by the dataset.", dataset),
+		datasetLogical:    desc("dataset", "logical_used_bytes", "Space used by the dataset before compression.", dataset),
+		datasetWritten:    desc("dataset", "written_bytes", "Space written to the dataset since its most recent snapshot.", dataset),
+		datasetQuota:      desc("dataset", "quota_bytes", "Quota of the dataset, zero if it has none.", dataset),
+
+		arcSize:      desc("arc", "size_bytes", "Current size of the ARC.", nil),
+		arcTarget:    desc("arc", "target_size_bytes", "Size the ARC is adapting to.", nil),
+		arcMin:       desc("arc", "min_size_bytes", "Minimum size of the ARC.", nil),
+		arcMax:       desc("arc", "max_size_bytes", "Maximum size of the ARC.", nil),
+		arcHits:      desc("arc", "hits_total", "Lookups satisfied by the ARC.", nil),
+		arcMisses:    desc("arc", "misses_total", "Lookups not satisfied by the ARC.", nil),
+		l2Hits:       desc("l2arc", "hits_total", "Lookups satisfied by the L2ARC.", nil),
+		l2Misses:     desc("l2arc", "misses_total", "Lookups not satisfied by the L2ARC.", nil),
+		l2Size:       desc("l2arc", "size_bytes", "Size of the data cached in the L2ARC.", nil),
+		l2Allocated:  desc("l2arc", "allocated_bytes", "Space the data cached in the L2ARC takes on the cache vdevs.", nil),
+		zfetchHits:   desc("zfetch", "hits_total", "Prefetcher stream hits.", nil),
+		zfetchMisses: desc("zfetch", "misses_total", "Prefetcher stream misses.", nil),
+
+		scrapeSuccess: desc("scrape", "collector_success", "Whether the metrics of the collector were gathered.", []string{"collector"}),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{
+		c.poolHealth, c.poolSize, c.poolAllocated, c.poolFree, c.poolFragmentation, c.poolDedupRatio, c.poolReadOnly,
+		c.poolFreeing, c.poolLeaked, c.vdevState, c.vdevErrors, c.scrubState, c.scrubProgress, c.scrubErrors, c.scrubEnd,
+		c.datasetUsed, c.datasetAvailable, c.datasetReferenced, c.datasetLogical, c.datasetWritten, c.datasetQuota,
+		c.arcSize, c.arcTarget, c.arcMin, c.arcMax, c.arcHits, c.arcMisses, c.l2Hits, c.l2Misses, c.l2Size, c.l2Allocated,
+		c.zfetchHits, c.zfetchMisses, c.scrapeSuccess,
+	} {
+		ch <- d
+	}
+}
+
+// Collect implements prometheus.Collector.
+// Failures are reported by the zfs_scrape_collector_success metric rather than failing the scrape.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	ctx := context.Background()
+	if c.opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.opts.Timeout)
+		defer cancel()
+	}
+	if c.opts.Runner != nil {
+		ctx = zfs.WithRunner(ctx, c.opts.Runner)
+	}
+
+	c.success(ch, "pools", c.collectPools(ctx, ch))
+	if c.opts.Datasets {
+		c.success(ch, "datasets", c.collectDatasets(ctx, ch))
+	}
+	if c.opts.Arc {
+		c.success(ch, "arc", c.collectArc(ctx, ch))
+	}
+}
+
+func (c *Collector) success(ch chan<- prometheus.Metric, collector string, err error) {
+	v := 1.0
+	if err != nil {
+		v = 0
+	}
+	ch <- prometheus.MustNewConstMetric(c.scrapeSuccess, prometheus.GaugeValue, v, collector)
+}
+
+func (c *Collector) collectPools(ctx context.Context, ch chan<- prometheus.Metric) error {
+	pools, err := zfs.ListZpoolsContext(ctx)
+	if err != nil {
+		return err
+	}
+	for _, p := range pools {
+		gauge := func(desc *prometheus.Desc, v float64) {
+			ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, v, p.Name)
+		}
+		enum(ch, c.poolHealth, poolStates, p.Health, p.Name)
+		gauge(c.poolSize, float64(p.Size))
+		gauge(c.poolAllocated, float64(p.Allocated))
+		gauge(c.poolFree, float64(p.Free))
+		gauge(c.poolFragmentation, float64(p.Fragmentation)/100)
+		gauge(c.poolDedupRatio, p.DedupRatio)
+		gauge(c.poolReadOnly, boolValue(p.ReadOnly))
+		gauge(c.poolFreeing, float64(p.Freeing))
+		gauge(c.poolLeaked, float64(p.Leaked))
+
+		status, err := p.StatusContext(ctx)
+		if err != nil {
+			return err
+		}
+		c.collectVdevs(ch, p.Name, status)
+
+		// A resilver replaces the scrub status, as zpool status only reports the most recent scan.
+		scrub := status.Scan
+		if scrub.Function != zfs.ScanFunctionScrub {
+			scrub = zfs.ScanStatus{State: zfs.ScanStateNone}
+		}
+		if scrub.State == zfs.ScanStateFinished {
+			scrub.PercentDone = 100
+		}
+		enum(ch, c.scrubState, scanStates, scrub.State, p.Name)
+		gauge(c.scrubProgress, scrub.PercentDone/100)
+		gauge(c.scrubErrors, float64(scrub.Errors))
+		if !scrub.End.IsZero() {
+			gauge(c.scrubEnd, float64(scrub.End.Unix()))
+		}
+	}
+	return nil
+}
+
+// collectVdevs reports the state and error counters of the root vdev and all other vdevs of the pool but spares.
+func (c *Collector) collectVdevs(ch chan<- prometheus.Metric, pool string, status *zfs.ZpoolStatus) {
+	var walk func(vdevs []*zfs.Vdev)
+	walk = func(vdevs []*zfs.Vdev) {
+		for _, v := range vdevs {
+			enum(ch, c.vdevState, poolStates, v.State, pool, v.Name)
+			for typ, n := range map[string]uint64{"read": v.Read, "write": v.Write, "checksum": v.Checksum} {
+				ch <- prometheus.MustNewConstMetric(c.vdevErrors, prometheus.CounterValue, float64(n), pool, v.Name, typ)
+			}
+			walk(v.Children)
+		}
+	}
+	if status.Config != nil {
+		walk([]*zfs.Vdev{status.Config})
+	}
+	walk(status.Logs)
+	walk(status.Cache)
+	walk(status.Special)
+	walk(status.Dedup)
+}
+
+func (c *Collector) collectDatasets(ctx context.Context, ch chan<- prometheus.Metric) error {
+	filesystems, err := zfs.FilesystemsContext(ctx, "")
+	if err != nil {
+		return err
+	}
+	volumes, err := zfs.VolumesContext(ctx, "")
+	if err != nil {
+		return err
+	}
+	for _, d := range append(filesystems, volumes...) {
+		gauge := func(desc *prometheus.Desc, v uint64) {
+			ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, float64(v), d.Name, d.Type)
+		}
+		gauge(c.datasetUsed, d.Used)
+		gauge(c.datasetAvailable, d.Avail)
+		gauge(c.datasetReferenced, d.Referenced)
+		gauge(c.datasetLogical, d.Logicalused)
+		gauge(c.datasetWritten, d.Written)
+		gauge(c.datasetQuota, d.Quota)
+	}
+	return nil
+}
+
+func (c *Collector) collectArc(ctx context.Context, ch chan<- prometheus.Metric) error {
+	s, err := zfs.GetArcStatsContext(ctx)
+	if err != nil {
+		return err
+	}
+	for desc, v := range map[*prometheus.Desc]uint64{
+		c.arcSize: s.Size, c.arcTarget: s.Target, c.arcMin: s.Min, c.arcMax: s.Max, c.l2Size: s.L2.Size, c.l2Allocated: s.L2.AllocatedSize,
+	} {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, float64(v))
+	}
+	for desc, v := range map[*prometheus.Desc]uint64{
+		c.arcHits: s.Hits, c.arcMisses: s.Misses, c.l2Hits: s.L2.Hits, c.l2Misses: s.L2.Misses,
+		c.zfetchHits: s.Zfetch.Hits, c.zfetchMisses: s.Zfetch.Misses,
+	} {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, float64(v))
+	}
+	return nil
+}
+
+// enum reports a gauge for every one of states, which is 1 for the current state and 0 for the others.
+// A current state which is not one of states is reported as well.
+func enum(ch chan<- prometheus.Metric, desc *prometheus.Desc, states []string, current string, labels ...string) {
+	known := false
+	for _, s := range states {
+		known = known || s == current
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, boolValue(s == current), append(labels, s)...)
+	}
+	if !known && current != "" {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, 1, append(labels, current)...)
+	}
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,90 @@
+package zfsmetrics_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	zfs "github.com/mistifyio/go-zfs/v3"
+	"github.com/mistifyio/go-zfs/v3/zfsmetrics"
+	"github.com/mistifyio/go-zfs/v3/zfstest"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func ok(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestCollector(t *testing.T) {
+	b := zfstest.New()
+	ctx := zfs.WithRunner(context.Background(), b)
+	_, err := zfs.CreateZpoolContext(ctx, "tank", nil, "mirror", "disk0", "disk1")
+	ok(t, err)
+	_, err = zfs.CreateFilesystemContext(ctx, "tank/home", nil)
+	ok(t, err)
+
+	c := zfsmetrics.NewCollector(zfsmetrics.Options{Runner: b, Datasets: true})
+	problems, err := testutil.CollectAndLint(c)
+	ok(t, err)
+	if len(problems) > 0 {
+		t.Fatalf("lint problems: %+v", problems)
+	}
+
+	want := `
+# HELP zfs_pool_health Whether the pool is in the given state.
+# TYPE zfs_pool_health gauge
+zfs_pool_health{pool="tank",state="DEGRADED"} 0
+zfs_pool_health{pool="tank",state="FAULTED"} 0
+zfs_pool_health{pool="tank",state="OFFLINE"} 0
+zfs_pool_health{pool="tank",state="ONLINE"} 1
+zfs_pool_health{pool="tank",state="REMOVED"} 0
+zfs_pool_health{pool="tank",state="UNAVAIL"} 0
+# HELP zfs_pool_scrub_state Whether the most recent scrub of the pool is in the given state.
+# TYPE zfs_pool_scrub_state gauge
+zfs_pool_scrub_state{pool="tank",state="canceled"} 0
+zfs_pool_scrub_state{pool="tank",state="finished"} 0
+zfs_pool_scrub_state{pool="tank",state="in progress"} 0
+zfs_pool_scrub_state{pool="tank",state="none"} 1
+zfs_pool_scrub_state{pool="tank",state="paused"} 0
+# HELP zfs_scrape_collector_success Whether the metrics of the collector were gathered.
+# TYPE zfs_scrape_collector_success gauge
+zfs_scrape_collector_success{collector="datasets"} 1
+zfs_scrape_collector_success{collector="pools"} 1
+`
+	ok(t, testutil.CollectAndCompare(c, strings.NewReader(want), "zfs_pool_health", "zfs_pool_scrub_state", "zfs_scrape_collector_success"))
+
+	// tank, mirror-0, disk0 and disk1 report three error counters each.
+	if n := testutil.CollectAndCount(c, "zfs_vdev_errors_total"); n != 12 {
+		t.Fatalf("want 12 vdev error counters, got %d", n)
+	}
+	// tank and tank/home report a used gauge each.
+	if n := testutil.CollectAndCount(c, "zfs_dataset_used_bytes"); n != 2 {
+		t.Fatalf("want 2 dataset used gauges, got %d", n)
+	}
+}
+
+type failingRunner struct{}
+
+func (failingRunner) Run(context.Context, string, ...string) ([]byte, []byte, error) {
+	return nil, []byte("no pools"), errors.New("exit status 1")
+}
+
+func TestCollectorFailure(t *testing.T) {
+	c := zfsmetrics.NewCollector(zfsmetrics.Options{Runner: failingRunner{}})
+	want := `
+# HELP zfs_scrape_collector_success Whether the metrics of the collector were gathered.
+# TYPE zfs_scrape_collector_success gauge
+zfs_scrape_collector_success{collector="pools"} 0
+`
+	ok(t, testutil.CollectAndCompare(c, strings.NewReader(want)))
+
+	// The ARC is reported by its own collector, whether or not the host has ZFS loaded.
+	c = zfsmetrics.NewCollector(zfsmetrics.Options{Runner: failingRunner{}, Arc: true})
+	if n := testutil.CollectAndCount(c, "zfs_scrape_collector_success"); n != 2 {
+		t.Fatalf("want 2 collector success gauges, got %d", n)
+	}
+}
@@ -0,0 +1,373 @@
+// Package zfstest provides an in-memory fake of the zfs and zpool commands, so that applications using go-zfs
+// can be tested without root privileges or a ZFS kernel module.
+//
+// The fake is a zfs.Runner which emulates the subset of the command line tools used by the library:
+// pools, filesystems, volumes, snapshots, bookmarks, clones, properties (including user properties and
+// inheritance), holds, and send/receive of placeholder streams. No data is stored, and sizes are nominal.
+//
+// Usage:
+//
+//	b := zfstest.New()
+//	ctx := zfs.WithRunner(context.Background(), b)
+//	pool, err := zfs.CreateZpoolContext(ctx, "tank", nil, "disk0")
+//	fs, err := zfs.CreateFilesystemContext(ctx, "tank/data", nil)
+package zfstest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// deviceSize is the nominal size of every device of a fake pool.
+const deviceSize = 1 << 30
+
+// Backend is an in-memory fake of the zfs and zpool commands, implementing zfs.StreamRunner.
+// A Backend is safe for concurrent use.
+type Backend struct {
+	mu       sync.Mutex
+	pools    map[string]*pool
+	datasets map[string]*dataset
+	txg      uint64
+	seed     uint64 // distinguishes the guids of different backends
+	commands [][]string
+}
+
+// backends counts the backends created, seeding their guids.
+var backends uint64
+
+type pool struct {
+	name     string
+	layout   []vdevGroup
+	props    map[string]string
+	guid     uint64
+	vdevSeed uint64 // the vdev guids are derived from it, unlike the pool guid it is not changed by reguid
+	scrubbed uint64 // txg at which the last scrub finished, 0 if never scrubbed
+}
+
+// vdevGroup is a top-level vdev of a pool.
+type vdevGroup struct {
+	class   string // "" for data vdevs, otherwise logs, cache, spares, special or dedup
+	typ     string // "" for single disks, otherwise mirror, raidz1-3 or a draid specification
+	devices []string
+}
+
+// Dataset types, as printed by the zfs command.
+const (
+	typeFilesystem = "filesystem"
+	typeVolume     = "volume"
+	typeSnapshot   = "snapshot"
+	typeBookmark   = "bookmark"
+)
+
+type dataset struct {
+	name    string
+	typ     string
+	origin  string // snapshot a clone or bookmark was created from
+	volsize uint64
+	props   map[string]string
+	holds   map[string]uint64 // tag to txg at which the hold was placed
+	mounted bool
+	shared  bool
+	txg     uint64
+	guid    uint64
+
+	// key is the encryption key of an encryption root, nil for unencrypted datasets or those inheriting their key
+	key       []byte
+	keyLoaded bool
+
+	// deferDestroy marks a held snapshot for destruction once its last hold is released
+	deferDestroy bool
+	// resumeToken is set on datasets with an interrupted resumable receive,
+	// partial marks those which were created by it
+	resumeToken string
+	partial     bool
+
+	// redactionSnaps are the redaction snapshots of a redaction bookmark,
+	// redacted marks filesystems received from a redacted stream, which are not mounted
+	redactionSnaps []string
+	redacted       bool
+}
+
+// New returns an empty Backend without any pools.
+func New() *Backend {
+	return &Backend{
+		pools:    map[string]*pool{},
+		datasets: map[string]*dataset{},
+		seed:     atomic.AddUint64(&backends, 1),
+	}
+}
+
+// Commands returns all commands run on the backend so far, each including the command name.
+func (b *Backend) Commands() [][]string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	commands := make([][]string, len(b.commands))
+	for i, c := range b.commands {
+		commands[i] = append([]string(nil), c...)
+	}
+	return commands
+}
+
+// Run implements zfs.Runner.
+func (b *Backend) Run(ctx context.Context, name string, args ...string) ([]byte, []byte, error) {
+	var stdout bytes.Buffer
+	stderr, err := b.RunStream(ctx, nil, &stdout, name, args...)
+	return stdout.Bytes(), stderr, err
+}
+
+// RunStream implements zfs.StreamRunner.
+func (b *Backend) RunStream(ctx context.Context, stdin io.Reader, stdout io.Writer, name string, args ...string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if stdin != nil {
+		// stdin is read before locking the backend, so that the stdout of one command may be piped into another.
+		// What was read before an error is kept, commands see it as a stream which was cut short.
+		data, _ := ioutil.ReadAll(stdin)
+		stdin = bytes.NewReader(data)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.commands = append(b.commands, append([]string{path.Base(name)}, args...))
+
+	if len(args) == 0 {
+		return usage(name)
+	}
+	inv := &invocation{stdin: stdin, stdout: stdout}
+	var err error
+	switch path.Base(name) {
+	case "zfs":
+		err = b.zfs(inv, args[0], args[1:])
+	case "zpool":
+		err = b.zpool(inv, args[0], args[1:])
+	default:
+		return []byte(fmt.Sprintf("%s: command not found\n", name)), &ExitError{Code: 127}
+	}
+	if err != nil {
+		return []byte(err.Error() + "\n"), &ExitError{Code: 1}
+	}
+	return nil, nil
+}
+
+func usage(name string) ([]byte, error) {
+	return []byte(fmt.Sprintf("usage: %s command args ...\n", path.Base(name))), &ExitError{Code: 2}
+}
+
+// ExitError is returned by the Backend when an emulated command fails.
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+// ExitCode returns the exit code of the failed command.
+func (e *ExitError) ExitCode() int {
+	return e.Code
+}
+
+type invocation struct {
+	stdin  io.Reader
+	stdout io.Writer
+}
+
+func (inv *invocation) printRow(fields ...string) {
+	if inv.stdout != nil {
+		fmt.Fprintln(inv.stdout, strings.Join(fields, "\t"))
+	}
+}
+
+// flags are the parsed options of a command line.
+type flags map[byte][]string
+
+func (f flags) has(c byte) bool {
+	_, ok := f[c]
+	return ok
+}
+
+func (f flags) last(c byte) string {
+	v := f[c]
+	if len(v) == 0 {
+		return ""
+	}
+	return v[len(v)-1]
+}
+
+// parseFlags parses getopt style options described by optstring, in which options followed by a colon take an
+// argument. Like GNU getopt, options may follow the operands, unless they are separated by "--".
+func parseFlags(args []string, optstring string) (flags, []string, error) {
+	f := flags{}
+	var operands []string
+	for len(args) > 0 {
+		arg := args[0]
+		args = args[1:]
+		if arg == "--" {
+			return f, append(operands, args...), nil
+		}
+		if len(arg) < 2 || arg[0] != '-' {
+			operands = append(operands, arg)
+			continue
+		}
+		for i := 1; i < len(arg); i++ {
+			c := arg[i]
+			j := strings.IndexByte(optstring, c)
+			if j < 0 || c == ':' {
+				return nil, nil, fmt.Errorf("invalid option '%c'", c)
+			}
+			if j+1 >= len(optstring) || optstring[j+1] != ':' {
+				f[c] = append(f[c], "")
+				continue
+			}
+			value := arg[i+1:]
+			if value == "" {
+				if len(args) == 0 {
+					return nil, nil, fmt.Errorf("missing argument for '%c' option", c)
+				}
+				value, args = args[0], args[1:]
+			}
+			f[c] = append(f[c], value)
+			break
+		}
+	}
+	return f, operands, nil
+}
+
+// nextTxg returns a new, increasing transaction group number, which orders the creation of datasets.
+func (b *Backend) nextTxg() uint64 {
+	b.txg++
+	return b.txg
+}
+
+// txgTime returns the nominal wall clock time of a transaction group.
+func txgTime(txg uint64) time.Time {
+	return epoch.Add(time.Duration(txg) * time.Second)
+}
+
+// newDataset adds an empty dataset of the given type.
+func (b *Backend) newDataset(name, typ string) *dataset {
+	txg := b.nextTxg()
+	ds := &dataset{
+		name:  name,
+		typ:   typ,
+		props: map[string]string{},
+		holds: map[string]uint64{},
+		txg:   txg,
+		guid:  (b.seed<<40 | txg) * 0x9e3779b97f4a7c15,
+	}
+	b.datasets[name] = ds
+	return ds
+}
+
+func notFound(name string) error {
+	return fmt.Errorf("cannot open '%s': dataset does not exist", name)
+}
+
+// lookup returns the named dataset, or the error zfs prints if it does not exist.
+func (b *Backend) lookup(name string) (*dataset, error) {
+	ds := b.datasets[name]
+	if ds == nil {
+		return nil, notFound(name)
+	}
+	return ds, nil
+}
+
+// descendants returns ds and all datasets below it in listing order.
+func (b *Backend) descendants(ds *dataset) []*dataset {
+	var all []*dataset
+	for _, d := range b.sortedDatasets() {
+		if isDescendant(d.name, ds.name) {
+			all = append(all, d)
+		}
+	}
+	return all
+}
+
+// snapshotsOf returns the snapshots of the filesystem or volume fs in creation order.
+func (b *Backend) snapshotsOf(fs string) []*dataset {
+	var snaps []*dataset
+	for _, d := range b.sortedDatasets() {
+		if d.typ == typeSnapshot && fsName(d.name) == fs {
+			snaps = append(snaps, d)
+		}
+	}
+	return snaps
+}
+
+// splitProp splits a property assignment of the form key=value.
+func splitProp(s string) (string, string, error) {
+	i := strings.IndexByte(s, '=')
+	if i <= 0 {
+		return "", "", fmt.Errorf("missing '=' for property=value argument")
+	}
+	return s[:i], s[i+1:], nil
+}
+
+// sortedDatasets returns the datasets in the order zfs lists them:
+// every filesystem or volume is followed by its snapshots and bookmarks in creation order, then its children.
+func (b *Backend) sortedDatasets() []*dataset {
+	all := make([]*dataset, 0, len(b.datasets))
+	for _, ds := range b.datasets {
+		all = append(all, ds)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		fi, fj := fsName(all[i].name), fsName(all[j].name)
+		if fi != fj {
+			return fi < fj
+		}
+		si, sj := fi == all[i].name, fj == all[j].name
+		if si != sj {
+			return si
+		}
+		if all[i].txg != all[j].txg {
+			return all[i].txg < all[j].txg
+		}
+		return all[i].name < all[j].name
+	})
+	return all
+}
+
+// fsName returns the filesystem or volume part of a dataset name, stripping any snapshot or bookmark.
+func fsName(name string) string {
+	if i := strings.IndexAny(name, "@#"); i >= 0 {
+		return name[:i]
+	}
+	return name
+}
+
+// parentName returns the name of the parent filesystem of a dataset, or "" for the root dataset of a pool.
+// The parent of a snapshot or bookmark is the dataset it belongs to.
+func parentName(name string) string {
+	if fs := fsName(name); fs != name {
+		return fs
+	}
+	if i := strings.LastIndexByte(name, '/'); i >= 0 {
+		return name[:i]
+	}
+	return ""
+}
+
+// isDescendant reports whether name is below (or equal to) root in the dataset hierarchy.
+func isDescendant(name, root string) bool {
+	return name == root || strings.HasPrefix(name, root+"/") || strings.HasPrefix(name, root+"@") || strings.HasPrefix(name, root+"#")
+}
+
+// depth returns how many levels name is below root, snapshots and bookmarks count as one level below their dataset.
+func depth(name, root string) int {
+	d := strings.Count(fsName(name), "/") - strings.Count(root, "/")
+	if fsName(name) != name {
+		d++
+	}
+	return d
+}
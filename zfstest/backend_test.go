@@ -0,0 +1,1257 @@
+package zfstest_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	zfs "github.com/mistifyio/go-zfs/v3"
+	"github.com/mistifyio/go-zfs/v3/zfstest"
+)
+
+var _ zfs.StreamRunner = (*zfstest.Backend)(nil)
+
+func ok(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func equals(t *testing.T, want, got interface{}) {
+	t.Helper()
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("want: %#v, got: %#v", want, got)
+	}
+}
+
+// setup returns a context using a new backend, which has a pool named tank.
+func setup(t *testing.T) (context.Context, *zfstest.Backend) {
+	t.Helper()
+	b := zfstest.New()
+	ctx := zfs.WithRunner(context.Background(), b)
+	_, err := zfs.CreateZpoolContext(ctx, "tank", nil, "mirror", "disk0", "disk1")
+	ok(t, err)
+	return ctx, b
+}
+
+func datasetNames(datasets []*zfs.Dataset) []string {
+	names := make([]string, len(datasets))
+	for i, d := range datasets {
+		names[i] = d.Name
+	}
+	return names
+}
+
+func TestZpool(t *testing.T) {
+	ctx, _ := setup(t)
+
+	_, err := zfs.CreateZpoolContext(ctx, "tank", nil, "disk2")
+	if err == nil || !strings.Contains(err.Error(), "pool already exists") {
+		t.Fatalf("expected error creating existing pool, got %v", err)
+	}
+	_, err = zfs.CreateZpoolContext(ctx, "other", nil, "disk1")
+	if err == nil || !strings.Contains(err.Error(), "part of active pool 'tank'") {
+		t.Fatalf("expected error reusing a device, got %v", err)
+	}
+	_, err = zfs.CreateZpoolWithTopologyContext(ctx, "other", nil, zfs.VdevSpec{
+		Data:   []zfs.VdevGroup{zfs.Raidz(1, "disk2", "disk3", "disk4")},
+		Logs:   []zfs.VdevGroup{zfs.Disk("disk5")},
+		Spares: []string{"disk6"},
+	})
+	ok(t, err)
+
+	pools, err := zfs.ListZpoolsContext(ctx)
+	ok(t, err)
+	equals(t, 2, len(pools))
+	equals(t, "other", pools[0].Name)
+	equals(t, uint64(2<<30), pools[0].Size)
+	equals(t, "tank", pools[1].Name)
+	equals(t, uint64(1<<30), pools[1].Size)
+	if pools[0].GUID == 0 || pools[0].GUID == pools[1].GUID {
+		t.Fatalf("expected distinct pool guids, got %d and %d", pools[0].GUID, pools[1].GUID)
+	}
+
+	z, err := zfs.GetZpoolContext(ctx, "tank")
+	ok(t, err)
+	equals(t, zfs.ZpoolOnline, z.Health)
+	equals(t, uint64(1<<30), z.Free)
+	equals(t, 1.0, z.DedupRatio)
+	equals(t, pools[1].GUID, z.GUID)
+
+	ok(t, z.SetPropertyContext(ctx, "comment", "fake"))
+	comment, err := z.GetPropertyContext(ctx, "comment")
+	ok(t, err)
+	equals(t, "fake", comment)
+	props, err := z.GetAllPropertiesContext(ctx)
+	ok(t, err)
+	equals(t, zfs.Property{Name: "autotrim", Value: "off", Source: "default"}, props["autotrim"])
+	if err := z.SetPropertyContext(ctx, "size", "1"); err == nil {
+		t.Fatal("expected error setting a read-only property")
+	}
+
+	status, err := z.StatusContext(ctx)
+	ok(t, err)
+	equals(t, "tank", status.Config.Name)
+	equals(t, 1, len(status.Config.Children))
+	equals(t, "mirror-0", status.Config.Children[0].Name)
+	equals(t, 2, len(status.Config.Children[0].Children))
+
+	status, err = z.StatusWithOptionsContext(ctx, zfs.StatusOptions{GUIDs: true, FullPaths: true})
+	ok(t, err)
+	mirror := status.Config.Children[0]
+	equals(t, "/dev/disk0", mirror.Children[0].Name)
+	equals(t, mirror, status.Parent(mirror.Children[1]))
+	if mirror.GUID == 0 || mirror.Children[0].GUID == mirror.Children[1].GUID {
+		t.Fatalf("expected distinct guids, got %d, %d and %d", mirror.GUID, mirror.Children[0].GUID, mirror.Children[1].GUID)
+	}
+	equals(t, mirror.Children[1], status.VdevByGUID(mirror.Children[1].GUID))
+
+	other := &zfs.Zpool{Name: "other"}
+	status, err = other.StatusContext(ctx)
+	ok(t, err)
+	equals(t, "raidz1-0", status.Config.Children[0].Name)
+	equals(t, 1, len(status.Logs))
+	equals(t, 1, len(status.Spares))
+
+	vdevs, err := other.VdevCapacityContext(ctx)
+	ok(t, err)
+	equals(t, 3, len(vdevs))
+	equals(t, "raidz1-0", vdevs[0].Name)
+	equals(t, uint64(2<<30), vdevs[0].Free)
+	equals(t, 3, len(vdevs[0].Children))
+	equals(t, &zfs.VdevCapacity{Name: "disk5", Class: zfs.VdevSectionLogs, Size: 1 << 30, Free: 1 << 30, Health: zfs.ZpoolOnline}, vdevs[1])
+	equals(t, &zfs.VdevCapacity{Name: "disk6", Class: zfs.VdevSectionSpares, Size: 1 << 30, Health: "AVAIL"}, vdevs[2])
+
+	scrub, err := z.ScrubStatusContext(ctx)
+	ok(t, err)
+	equals(t, zfs.ScanStateNone, scrub.State)
+	ok(t, z.ScrubContext(ctx))
+	scrub, err = z.ScrubStatusContext(ctx)
+	ok(t, err)
+	equals(t, zfs.ScanStateFinished, scrub.State)
+	if scrub.End.IsZero() {
+		t.Fatal("expected scrub end time")
+	}
+
+	ok(t, other.DestroyContext(ctx))
+	_, err = zfs.GetZpoolContext(ctx, "other")
+	if !errors.Is(err, zfs.ErrPoolNotFound) {
+		t.Fatalf("expected ErrPoolNotFound, got %v", err)
+	}
+	_, err = zfs.GetDatasetContext(ctx, "other")
+	if !errors.Is(err, zfs.ErrDatasetNotFound) {
+		t.Fatalf("expected ErrDatasetNotFound, got %v", err)
+	}
+}
+
+func TestDraid(t *testing.T) {
+	ctx, _ := setup(t)
+	z, err := zfs.CreateZpoolWithTopologyContext(ctx, "other", nil, zfs.VdevSpec{
+		Data:   []zfs.VdevGroup{zfs.Draid(1, 2, 1, "disk2", "disk3", "disk4", "disk5", "disk6")},
+		Spares: []string{"disk7"},
+	})
+	ok(t, err)
+
+	status, err := z.StatusContext(ctx)
+	ok(t, err)
+	draid := status.Config.Children[0]
+	equals(t, "draid1:2d:5c:1s-0", draid.Name)
+	equals(t, zfs.VdevDraid1, zfs.VdevType(draid.Name))
+	equals(t, 5, len(draid.Children))
+	spares, err := z.SparesContext(ctx)
+	ok(t, err)
+	equals(t, []*zfs.Spare{
+		{Name: "draid1-0-0", State: zfs.SpareAvail, Draid: draid.Name},
+		{Name: "disk7", State: zfs.SpareAvail},
+	}, spares)
+}
+
+func TestAllocationClasses(t *testing.T) {
+	ctx, _ := setup(t)
+	z, err := zfs.CreateZpoolWithTopologyContext(ctx, "fast", nil, zfs.VdevSpec{
+		Data:    []zfs.VdevGroup{zfs.Mirror("disk2", "disk3"), zfs.Mirror("disk4", "disk5")},
+		Special: []zfs.VdevGroup{zfs.Mirror("nvme0", "nvme1")},
+		Dedup:   []zfs.VdevGroup{zfs.Disk("nvme2")},
+	})
+	ok(t, err)
+
+	usage, err := z.ClassUsageContext(ctx)
+	ok(t, err)
+	equals(t, []*zfs.ClassUsage{
+		{Vdevs: 2, Size: 2 << 30, Free: 2 << 30},
+		{Class: zfs.VdevSectionSpecial, Vdevs: 1, Size: 1 << 30, Free: 1 << 30},
+		{Class: zfs.VdevSectionDedup, Vdevs: 1, Size: 1 << 30, Free: 1 << 30},
+	}, usage)
+
+	fs, err := zfs.CreateFilesystemWithOptionsContext(ctx, "fast/db", zfs.CreateFilesystemOptions{SpecialSmallBlocks: 32 << 10})
+	ok(t, err)
+	bytes, err := fs.SpecialSmallBlocksContext(ctx)
+	ok(t, err)
+	equals(t, uint64(32<<10), bytes)
+}
+
+func TestCreateDryRun(t *testing.T) {
+	ctx, _ := setup(t)
+	spec := zfs.VdevSpec{
+		Data:   []zfs.VdevGroup{zfs.Raidz(1, "disk2", "disk3", "disk4")},
+		Dedup:  []zfs.VdevGroup{zfs.Disk("nvme2")},
+		Logs:   []zfs.VdevGroup{zfs.Mirror("nvme0", "nvme1")},
+		Cache:  []string{"nvme3"},
+		Spares: []string{"disk5"},
+	}
+	got, err := zfs.CreateZpoolDryRunContext(ctx, "other", nil, spec)
+	ok(t, err)
+	equals(t, &spec, got)
+	if _, err := zfs.GetZpoolContext(ctx, "other"); err == nil {
+		t.Fatal("expected dry run not to create the pool")
+	}
+}
+
+func TestCreateWithOptions(t *testing.T) {
+	ctx, _ := setup(t)
+	z, err := zfs.CreateZpoolWithOptionsContext(ctx, "other", zfs.VdevSpec{Data: []zfs.VdevGroup{zfs.Disk("disk2")}}, zfs.CreateZpoolOptions{
+		Ashift:               12,
+		AutoTrim:             true,
+		Mountpoint:           "/srv/other",
+		FilesystemProperties: map[string]string{"compression": "lz4"},
+	})
+	ok(t, err)
+	autotrim, err := z.GetPropertyContext(ctx, "autotrim")
+	ok(t, err)
+	equals(t, "on", autotrim)
+	root, err := zfs.GetDatasetContext(ctx, "other")
+	ok(t, err)
+	equals(t, "/srv/other", root.Mountpoint)
+	equals(t, "lz4", root.Compression)
+}
+
+func TestFeatures(t *testing.T) {
+	ctx, _ := setup(t)
+	z := &zfs.Zpool{Name: "tank"}
+	ok(t, z.EnableFeatureContext(ctx, "draid"))
+	features, err := z.FeaturesContext(ctx)
+	ok(t, err)
+	states := map[string]string{}
+	for _, f := range features {
+		states[f.Name] = f.State
+	}
+	equals(t, zfs.FeatureEnabled, states["draid"])
+	equals(t, zfs.FeatureActive, states["lz4_compress"])
+
+	legacy, err := zfs.CreateZpoolContext(ctx, "legacy", map[string]string{"compatibility": zfs.CompatibilityLegacy}, "disk2")
+	ok(t, err)
+	compat, err := legacy.CompatibilityContext(ctx)
+	ok(t, err)
+	equals(t, []string{zfs.CompatibilityLegacy}, compat)
+	features, err = legacy.FeaturesContext(ctx)
+	ok(t, err)
+	for _, f := range features {
+		if f.State != zfs.FeatureDisabled {
+			t.Fatalf("expected feature %s of legacy pool to be disabled, got %s", f.Name, f.State)
+		}
+	}
+	if err := legacy.EnableFeatureContext(ctx, "encryption"); err == nil {
+		t.Fatal("expected error enabling a feature of a legacy pool")
+	}
+	ok(t, legacy.SetCompatibilityContext(ctx, zfs.CompatibilityOff))
+	ok(t, legacy.EnableFeatureContext(ctx, "encryption"))
+}
+
+func TestZpoolLayout(t *testing.T) {
+	ctx := zfs.WithRunner(context.Background(), zfstest.New())
+	spec := zfs.VdevSpec{
+		Data:   []zfs.VdevGroup{zfs.Mirror("disk0", "disk1")},
+		Logs:   []zfs.VdevGroup{zfs.Disk("disk2")},
+		Spares: []string{"disk3"},
+	}
+	z, err := zfs.CreateZpoolWithTopologyContext(ctx, "tank", map[string]string{"autotrim": "on"}, spec)
+	ok(t, err)
+	ok(t, z.EnableFeatureContext(ctx, "draid"))
+
+	layout, err := z.LayoutContext(ctx)
+	ok(t, err)
+	data, err := json.Marshal(layout)
+	ok(t, err)
+	layout, err = zfs.ParseZpoolLayout(data)
+	ok(t, err)
+	equals(t, "on", layout.Properties["autotrim"])
+	equals(t, 1, len(layout.Topology.Data))
+	equals(t, zfs.VdevMirror, layout.Topology.Data[0].Type)
+
+	moved := map[string]string{"disk0": "disk4", "disk1": "disk5", "disk2": "disk6", "disk3": "disk7"}
+	devices := map[string]string{}
+	for _, dev := range append(append(layout.Topology.Data[0].Devices, layout.Topology.Logs[0].Devices...), layout.Topology.Spares...) {
+		devices[dev] = moved[filepath.Base(dev)]
+	}
+	copied, err := zfs.CreateZpoolFromLayoutContext(ctx, layout, zfs.CreateFromLayoutOptions{Name: "copy", Devices: devices})
+	ok(t, err)
+	copyLayout, err := copied.LayoutContext(ctx)
+	ok(t, err)
+	equals(t, layout.Properties, copyLayout.Properties)
+	equals(t, layout.Features, copyLayout.Features)
+	equals(t, len(layout.Topology.Data[0].Devices), len(copyLayout.Topology.Data[0].Devices))
+	equals(t, 1, len(copyLayout.Topology.Logs))
+	equals(t, 1, len(copyLayout.Topology.Spares))
+}
+
+func TestUpgrade(t *testing.T) {
+	ctx, _ := setup(t)
+	pending, err := zfs.PendingUpgradesContext(ctx)
+	ok(t, err)
+	equals(t, 0, len(pending))
+
+	_, err = zfs.CreateZpoolContext(ctx, "old", nil, "-d", "disk2")
+	ok(t, err)
+	_, err = zfs.CreateZpoolContext(ctx, "legacy", map[string]string{"compatibility": zfs.CompatibilityLegacy}, "disk3")
+	ok(t, err)
+	supported, err := zfs.SupportedFeaturesContext(ctx)
+	ok(t, err)
+	var names []string
+	for _, f := range supported {
+		names = append(names, f.Name)
+	}
+	pending, err = zfs.PendingUpgradesContext(ctx)
+	ok(t, err)
+	equals(t, []*zfs.PendingUpgrade{{Pool: "old", Features: names}}, pending)
+
+	ok(t, zfs.UpgradeAllContext(ctx))
+	pending, err = zfs.PendingUpgradesContext(ctx)
+	ok(t, err)
+	equals(t, 0, len(pending))
+	features, err := (&zfs.Zpool{Name: "old"}).FeaturesContext(ctx)
+	ok(t, err)
+	for _, f := range features {
+		equals(t, zfs.FeatureEnabled, f.State)
+	}
+}
+
+func TestReguid(t *testing.T) {
+	ctx, _ := setup(t)
+	z, err := zfs.GetZpoolContext(ctx, "tank")
+	ok(t, err)
+	opts := zfs.StatusOptions{GUIDs: true}
+	before, err := z.StatusWithOptionsContext(ctx, opts)
+	ok(t, err)
+
+	ok(t, z.ReguidContext(ctx))
+	ok(t, z.ReopenContext(ctx))
+	reguided, err := zfs.GetZpoolContext(ctx, "tank")
+	ok(t, err)
+	if reguided.GUID == z.GUID {
+		t.Fatalf("expected new pool guid, got %d", reguided.GUID)
+	}
+	after, err := z.StatusWithOptionsContext(ctx, opts)
+	ok(t, err)
+	equals(t, before.Config.Children[0].GUID, after.Config.Children[0].GUID)
+	if err := (&zfs.Zpool{Name: "missing"}).ReguidContext(ctx); err == nil {
+		t.Fatal("expected error for missing pool")
+	}
+}
+
+func TestSyncWait(t *testing.T) {
+	ctx, _ := setup(t)
+	z := &zfs.Zpool{Name: "tank"}
+	ok(t, z.SyncContext(ctx))
+	ok(t, z.ScrubContext(ctx))
+	ok(t, z.WaitContext(ctx, time.Second, zfs.WaitScrub))
+	if err := (&zfs.Zpool{Name: "missing"}).WaitContext(ctx, 0); err == nil {
+		t.Fatal("expected error for missing pool")
+	}
+
+	fs, err := zfs.CreateFilesystemContext(ctx, "tank/fs", nil)
+	ok(t, err)
+	ok(t, fs.WaitDeleteQueueContext(ctx, 0))
+	snap, err := fs.SnapshotContext(ctx, "a", false)
+	ok(t, err)
+	if err := snap.WaitDeleteQueueContext(ctx, 0); err == nil {
+		t.Fatal("expected error waiting for a snapshot")
+	}
+}
+
+func TestDatasets(t *testing.T) {
+	ctx, b := setup(t)
+
+	fs, err := zfs.CreateFilesystemContext(ctx, "tank/fs", map[string]string{"compression": "lz4"})
+	ok(t, err)
+	equals(t, zfs.DatasetFilesystem, fs.Type)
+	equals(t, "/tank/fs", fs.Mountpoint)
+	equals(t, "lz4", fs.Compression)
+	equals(t, uint64(1<<30), fs.Avail)
+
+	_, err = zfs.CreateFilesystemContext(ctx, "tank/fs", nil)
+	if !errors.Is(err, zfs.ErrDatasetExists) {
+		t.Fatalf("expected ErrDatasetExists, got %v", err)
+	}
+	_, err = zfs.CreateFilesystemContext(ctx, "tank/missing/child", nil)
+	if err == nil || !strings.Contains(err.Error(), "parent does not exist") {
+		t.Fatalf("expected missing parent error, got %v", err)
+	}
+
+	child, err := zfs.CreateFilesystemContext(ctx, "tank/fs/child", nil)
+	ok(t, err)
+	equals(t, "lz4", child.Compression)
+	source, err := child.GetPropertyContext(ctx, "compression")
+	ok(t, err)
+	equals(t, "lz4", source)
+
+	vol, err := zfs.CreateVolumeContext(ctx, "tank/vol", 8<<20, nil)
+	ok(t, err)
+	equals(t, zfs.DatasetVolume, vol.Type)
+	equals(t, uint64(8<<20), vol.Volsize)
+
+	snap, err := fs.SnapshotContext(ctx, "a", true)
+	ok(t, err)
+	equals(t, zfs.DatasetSnapshot, snap.Type)
+	_, err = fs.SnapshotContext(ctx, "a", false)
+	if !errors.Is(err, zfs.ErrDatasetExists) {
+		t.Fatalf("expected ErrDatasetExists, got %v", err)
+	}
+
+	filesystems, err := zfs.FilesystemsContext(ctx, "")
+	ok(t, err)
+	equals(t, []string{"tank", "tank/fs", "tank/fs/child"}, datasetNames(filesystems))
+	snapshots, err := zfs.SnapshotsContext(ctx, "tank")
+	ok(t, err)
+	equals(t, []string{"tank/fs@a", "tank/fs/child@a"}, datasetNames(snapshots))
+
+	// a group of snapshots is created atomically, none are if any exists already
+	group, err := zfs.CreateSnapshotsContext(ctx, []string{"tank/fs@group", "tank/vol@group"}, true, map[string]string{"com.example:set": "1"})
+	ok(t, err)
+	equals(t, []string{"tank/fs@group", "tank/fs/child@group", "tank/vol@group"}, datasetNames(group))
+	set, err := group[1].GetPropertyContext(ctx, "com.example:set")
+	ok(t, err)
+	equals(t, "1", set)
+	_, err = zfs.CreateSnapshotsContext(ctx, []string{"tank/vol@other", "tank/fs@a"}, false, nil)
+	if !errors.Is(err, zfs.ErrDatasetExists) {
+		t.Fatalf("expected ErrDatasetExists, got %v", err)
+	}
+	_, err = zfs.GetDatasetContext(ctx, "tank/vol@other")
+	if !errors.Is(err, zfs.ErrDatasetNotFound) {
+		t.Fatalf("expected ErrDatasetNotFound, got %v", err)
+	}
+	ok(t, group[0].DestroyContext(ctx, zfs.DestroyDefault))
+	ok(t, group[1].DestroyContext(ctx, zfs.DestroyDefault))
+	ok(t, group[2].DestroyContext(ctx, zfs.DestroyDefault))
+
+	children, err := fs.ChildrenContext(ctx, 1)
+	ok(t, err)
+	equals(t, []string{"tank/fs@a", "tank/fs/child"}, datasetNames(children))
+
+	clone, err := snap.CloneContext(ctx, "tank/clone", nil)
+	ok(t, err)
+	equals(t, "tank/fs@a", clone.Origin)
+	err = fs.DestroyContext(ctx, zfs.DestroyRecursive)
+	if err == nil || !strings.Contains(err.Error(), "dependent clones") {
+		t.Fatalf("expected dependent clones error, got %v", err)
+	}
+
+	renamed, err := fs.RenameContext(ctx, "tank/renamed", false, false)
+	ok(t, err)
+	equals(t, "/tank/renamed", renamed.Mountpoint)
+	clone, err = zfs.GetDatasetContext(ctx, "tank/clone")
+	ok(t, err)
+	equals(t, "tank/renamed@a", clone.Origin)
+
+	ok(t, renamed.SetPropertyContext(ctx, "mountpoint", "/mnt/data"))
+	child, err = zfs.GetDatasetContext(ctx, "tank/renamed/child")
+	ok(t, err)
+	equals(t, "/mnt/data/child", child.Mountpoint)
+	if err := renamed.SetPropertyContext(ctx, "used", "1"); err == nil {
+		t.Fatal("expected error setting a read-only property")
+	}
+
+	_, err = renamed.SnapshotContext(ctx, "b", false)
+	ok(t, err)
+	snap, err = zfs.GetDatasetContext(ctx, "tank/renamed@a")
+	ok(t, err)
+	err = snap.RollbackContext(ctx, false)
+	if err == nil || !strings.Contains(err.Error(), "more recent snapshots") {
+		t.Fatalf("expected more recent snapshots error, got %v", err)
+	}
+	ok(t, snap.RollbackContext(ctx, true))
+	_, err = zfs.GetDatasetContext(ctx, "tank/renamed@b")
+	if !errors.Is(err, zfs.ErrDatasetNotFound) {
+		t.Fatalf("expected ErrDatasetNotFound, got %v", err)
+	}
+
+	ok(t, renamed.DestroyContext(ctx, zfs.DestroyRecursive|zfs.DestroyRecursiveClones))
+	datasets, err := zfs.DatasetsContext(ctx, "")
+	ok(t, err)
+	equals(t, []string{"tank", "tank/vol"}, datasetNames(datasets))
+
+	if calls := b.Commands(); calls[0][0] != "zpool" || calls[1][0] != "zfs" {
+		t.Fatalf("unexpected commands: %q", calls[:2])
+	}
+}
+
+func TestUserProperties(t *testing.T) {
+	ctx, _ := setup(t)
+
+	fs, err := zfs.CreateFilesystemContext(ctx, "tank/fs", nil)
+	ok(t, err)
+	_, err = zfs.CreateFilesystemContext(ctx, "tank/fs/child", nil)
+	ok(t, err)
+	ok(t, fs.SetUserPropertyContext(ctx, "com.example:role", "db"))
+
+	child := &zfs.Dataset{Name: "tank/fs/child"}
+	props, err := child.GetUserPropertiesContext(ctx)
+	ok(t, err)
+	equals(t, map[string]zfs.Property{
+		"com.example:role": {Name: "com.example:role", Value: "db", Source: "inherited from tank/fs"},
+	}, props)
+
+	datasets, err := zfs.DatasetsByUserPropertyContext(ctx, "com.example:role", "db")
+	ok(t, err)
+	equals(t, []string{"tank/fs", "tank/fs/child"}, datasetNames(datasets))
+
+	ok(t, fs.SetPropertyContext(ctx, "compression", "zstd"))
+	typed, err := child.PropertiesContext(ctx)
+	ok(t, err)
+	equals(t, zfs.CompressionZstd, typed.Compression)
+	equals(t, zfs.PropertySource{Kind: zfs.SourceInherited, From: "tank/fs"}, typed.Sources["compression"])
+	equals(t, "db", typed.Raw["com.example:role"].Value)
+	equals(t, zfs.DatasetFilesystem, typed.Type)
+
+	ok(t, child.SetPropertyContext(ctx, "compression", "lz4"))
+	source, err := child.GetPropertySourceContext(ctx, "compression")
+	ok(t, err)
+	equals(t, zfs.PropertySource{Kind: zfs.SourceLocal}, source)
+	ok(t, fs.InheritPropertyContext(ctx, "compression", true))
+	source, err = child.GetPropertySourceContext(ctx, "compression")
+	ok(t, err)
+	equals(t, zfs.PropertySource{Kind: zfs.SourceDefault}, source)
+
+	ok(t, zfs.SetPropertiesBatchContext(ctx, []string{"tank/fs", "tank/fs/child"}, map[string]string{
+		"atime": "off", "com.example:tier": "gold",
+	}))
+	typed, err = child.PropertiesContext(ctx)
+	ok(t, err)
+	equals(t, false, typed.Atime)
+	equals(t, zfs.PropertySource{Kind: zfs.SourceLocal}, typed.Sources["atime"])
+	equals(t, "gold", typed.Raw["com.example:tier"].Value)
+}
+
+func TestSendReceive(t *testing.T) {
+	ctx, _ := setup(t)
+
+	fs, err := zfs.CreateFilesystemContext(ctx, "tank/src", map[string]string{"com.example:note": "sent"})
+	ok(t, err)
+	a, err := fs.SnapshotContext(ctx, "a", false)
+	ok(t, err)
+	bSnap, err := fs.SnapshotContext(ctx, "b", false)
+	ok(t, err)
+
+	var full bytes.Buffer
+	ok(t, a.SendToContext(ctx, &full, zfs.SendOptions{Replicate: true}))
+	_, err = zfs.ReceiveFromContext(ctx, &full, "tank/dst", zfs.ReceiveOptions{})
+	ok(t, err)
+	var incr bytes.Buffer
+	ok(t, bSnap.SendToContext(ctx, &incr, zfs.SendOptions{From: "tank/src@a"}))
+	estimate, err := bSnap.SendEstimateContext(ctx, zfs.SendOptions{From: "tank/src@a"})
+	ok(t, err)
+	equals(t, uint64(incr.Len()), estimate.Size)
+	equals(t, "tank/src@a", estimate.Snapshots[0].From)
+	_, err = zfs.ReceiveFromContext(ctx, &incr, "tank/dst", zfs.ReceiveOptions{})
+	ok(t, err)
+
+	snapshots, err := zfs.SnapshotsContext(ctx, "tank/dst")
+	ok(t, err)
+	equals(t, []string{"tank/dst@a", "tank/dst@b"}, datasetNames(snapshots))
+	note, err := (&zfs.Dataset{Name: "tank/dst"}).GetPropertyContext(ctx, "com.example:note")
+	ok(t, err)
+	equals(t, "sent", note)
+
+	// an interrupted resumable receive leaves a token to resume the send from
+	var stream bytes.Buffer
+	ok(t, bSnap.SendToContext(ctx, &stream, zfs.SendOptions{}))
+	partial := stream.Bytes()[:stream.Len()-len("end\n")]
+	_, err = zfs.ReceiveFromContext(ctx, bytes.NewReader(partial), "tank/resumed", zfs.ReceiveOptions{Resumable: true})
+	if err == nil {
+		t.Fatal("expected error receiving interrupted stream")
+	}
+	resumed := &zfs.Dataset{Name: "tank/resumed"}
+	token, err := resumed.ResumeTokenContext(ctx)
+	ok(t, err)
+	if token == "" {
+		t.Fatal("expected resume token")
+	}
+	stream.Reset()
+	ok(t, zfs.ResumeSendContext(ctx, token, &stream))
+	_, err = zfs.ReceiveFromContext(ctx, &stream, "tank/resumed", zfs.ReceiveOptions{Resumable: true})
+	ok(t, err)
+	token, err = resumed.ResumeTokenContext(ctx)
+	ok(t, err)
+	equals(t, "", token)
+	_, err = zfs.GetDatasetContext(ctx, "tank/resumed@b")
+	ok(t, err)
+
+	_, err = zfs.ReceiveFromContext(ctx, strings.NewReader("garbage\n"), "tank/bad", zfs.ReceiveOptions{})
+	if err == nil || !strings.Contains(err.Error(), "invalid stream") {
+		t.Fatalf("expected invalid stream error, got %v", err)
+	}
+}
+
+func TestHoldsAndBookmarks(t *testing.T) {
+	ctx, _ := setup(t)
+
+	fs, err := zfs.CreateFilesystemContext(ctx, "tank/fs", nil)
+	ok(t, err)
+	snap, err := fs.SnapshotContext(ctx, "a", false)
+	ok(t, err)
+
+	ok(t, snap.HoldContext(ctx, "keep", false))
+	holds, err := snap.HoldsContext(ctx)
+	ok(t, err)
+	equals(t, 1, len(holds))
+	equals(t, "keep", holds[0].Tag)
+	if holds[0].Created.IsZero() {
+		t.Fatal("expected hold creation time")
+	}
+	err = snap.DestroyContext(ctx, zfs.DestroyDefault)
+	if !errors.Is(err, zfs.ErrDatasetBusy) {
+		t.Fatalf("expected ErrDatasetBusy, got %v", err)
+	}
+
+	bm, err := snap.BookmarkContext(ctx, "mark")
+	ok(t, err)
+	equals(t, "tank/fs#mark", bm.Name)
+	equals(t, zfs.DatasetBookmark, bm.Type)
+
+	ok(t, snap.ReleaseContext(ctx, "keep", false))
+	ok(t, snap.DestroyContext(ctx, zfs.DestroyDefault))
+	bookmarks, err := fs.BookmarksContext(ctx)
+	ok(t, err)
+	equals(t, []string{"tank/fs#mark"}, datasetNames(bookmarks))
+}
+
+func TestReceiveOptions(t *testing.T) {
+	ctx, _ := setup(t)
+
+	fs, err := zfs.CreateFilesystemContext(ctx, "tank/src", map[string]string{"mountpoint": "/srv", "com.example:note": "sent"})
+	ok(t, err)
+	a, err := fs.SnapshotContext(ctx, "a", false)
+	ok(t, err)
+	_, err = zfs.CreateFilesystemContext(ctx, "tank/backup", nil)
+	ok(t, err)
+
+	var stream bytes.Buffer
+	ok(t, a.SendToContext(ctx, &stream, zfs.SendOptions{Replicate: true}))
+	received, err := zfs.ReceiveFromContext(ctx, &stream, "tank/backup", zfs.ReceiveOptions{
+		NoMount:     true,
+		DiscardPool: true,
+		Properties:  map[string]string{"canmount": "off"},
+		Exclude:     []string{"mountpoint"},
+	})
+	ok(t, err)
+	equals(t, "tank/backup/src", received.Name)
+	equals(t, "/tank/backup/src", received.Mountpoint)
+	for prop, want := range map[string]string{"canmount": "off", "mounted": "no", "com.example:note": "sent"} {
+		value, err := received.GetPropertyContext(ctx, prop)
+		ok(t, err)
+		equals(t, want, value)
+	}
+
+	stream.Reset()
+	ok(t, a.SendToContext(ctx, &stream, zfs.SendOptions{}))
+	_, err = zfs.ReceiveFromContext(ctx, bytes.NewReader(stream.Bytes()), "tank/missing", zfs.ReceiveOptions{LastElement: true})
+	if err == nil || !strings.Contains(err.Error(), "tank/missing") {
+		t.Fatalf("expected error receiving below a missing dataset, got %v", err)
+	}
+	_, err = zfs.CreateFilesystemContext(ctx, "tank/other", nil)
+	ok(t, err)
+	received, err = zfs.ReceiveFromContext(ctx, &stream, "tank/other", zfs.ReceiveOptions{LastElement: true})
+	ok(t, err)
+	equals(t, "tank/other/src", received.Name)
+}
+
+func TestEncryption(t *testing.T) {
+	ctx, _ := setup(t)
+
+	fs, err := zfs.CreateFilesystemWithOptionsContext(ctx, "tank/secret", zfs.CreateFilesystemOptions{
+		Encryption: &zfs.EncryptionOptions{
+			Encryption: "on",
+			KeyFormat:  zfs.KeyFormatPassphrase,
+			Key:        strings.NewReader("correct horse"),
+		},
+	})
+	ok(t, err)
+	status, err := fs.KeyStatusContext(ctx)
+	ok(t, err)
+	equals(t, zfs.KeyStatusAvailable, status)
+
+	_, err = fs.UnmountContext(ctx, false)
+	ok(t, err)
+	ok(t, fs.UnloadKeyContext(ctx, false))
+	status, err = fs.KeyStatusContext(ctx)
+	ok(t, err)
+	equals(t, zfs.KeyStatusUnavailable, status)
+
+	err = fs.LoadKeyContext(ctx, zfs.LoadKeyOptions{Key: strings.NewReader("wrong horse")})
+	if err == nil {
+		t.Fatal("expected error loading incorrect key")
+	}
+	ok(t, fs.LoadKeyContext(ctx, zfs.LoadKeyOptions{Key: strings.NewReader("correct horse")}))
+	_, err = fs.MountContext(ctx, false, nil)
+	ok(t, err)
+}
+
+func TestRawSend(t *testing.T) {
+	ctx, _ := setup(t)
+
+	fs, err := zfs.CreateFilesystemWithOptionsContext(ctx, "tank/secret", zfs.CreateFilesystemOptions{
+		Encryption: &zfs.EncryptionOptions{
+			Encryption: "on",
+			KeyFormat:  zfs.KeyFormatPassphrase,
+			Key:        strings.NewReader("correct horse"),
+		},
+	})
+	ok(t, err)
+	a, err := fs.SnapshotContext(ctx, "a", false)
+	ok(t, err)
+	var stream bytes.Buffer
+	ok(t, a.SendToContext(ctx, &stream, zfs.SendOptions{Raw: true}))
+	copied, err := zfs.ReceiveFromContext(ctx, &stream, "tank/copy", zfs.ReceiveOptions{})
+	ok(t, err)
+	enc, err := copied.EncryptionContext(ctx)
+	ok(t, err)
+	equals(t, &zfs.EncryptionInfo{
+		Dataset:    "tank/copy",
+		Encryption: "aes-256-gcm",
+		Root:       "tank/copy",
+		KeyStatus:  zfs.KeyStatusUnavailable,
+		KeyFormat:  zfs.KeyFormatPassphrase,
+	}, enc)
+	mounted, err := copied.MountedContext(ctx)
+	ok(t, err)
+	equals(t, false, mounted)
+
+	// the key stays that of the source
+	b, err := fs.SnapshotContext(ctx, "b", false)
+	ok(t, err)
+	stream.Reset()
+	ok(t, b.SendToContext(ctx, &stream, zfs.SendOptions{Raw: true, From: "@a"}))
+	_, err = zfs.ReceiveFromContext(ctx, &stream, "tank/copy", zfs.ReceiveOptions{})
+	ok(t, err)
+	ok(t, copied.LoadKeyContext(ctx, zfs.LoadKeyOptions{Key: strings.NewReader("correct horse")}))
+
+	// streams of datasets whose key is not loaded must be raw
+	_, err = fs.UnmountContext(ctx, false)
+	ok(t, err)
+	ok(t, fs.UnloadKeyContext(ctx, false))
+	if err := b.SendToContext(ctx, ioutil.Discard, zfs.SendOptions{}); err == nil || !strings.Contains(err.Error(), "key of tank/secret is not loaded") {
+		t.Fatalf("expected error sending without key, got %v", err)
+	}
+
+	// a raw incremental stream cannot be received into an unencrypted dataset
+	plain, err := zfs.CreateFilesystemContext(ctx, "tank/plain", nil)
+	ok(t, err)
+	_, err = plain.SnapshotContext(ctx, "a", false)
+	ok(t, err)
+	stream.Reset()
+	ok(t, b.SendToContext(ctx, &stream, zfs.SendOptions{Raw: true, From: "@a"}))
+	_, err = zfs.ReceiveFromContext(ctx, &stream, "tank/plain", zfs.ReceiveOptions{})
+	if err == nil || !strings.Contains(err.Error(), "raw encrypted stream into unencrypted") {
+		t.Fatalf("expected error receiving raw stream into unencrypted dataset, got %v", err)
+	}
+}
+
+func TestRedact(t *testing.T) {
+	ctx, b := setup(t)
+
+	fs, err := zfs.CreateFilesystemContext(ctx, "tank/data", nil)
+	ok(t, err)
+	base, err := fs.SnapshotContext(ctx, "base", false)
+	ok(t, err)
+	for _, name := range []string{"tank/scrub1", "tank/scrub2"} {
+		clone, err := base.CloneContext(ctx, name, nil)
+		ok(t, err)
+		_, err = clone.SnapshotContext(ctx, "old", false)
+		ok(t, err)
+		_, err = clone.SnapshotContext(ctx, "scrubbed", false)
+		ok(t, err)
+	}
+	bm, err := base.RedactClonesContext(ctx, "redacted")
+	ok(t, err)
+	equals(t, "tank/data#redacted", bm.Name)
+	for _, c := range b.Commands() {
+		if c[1] == "redact" {
+			equals(t, []string{"zfs", "redact", "tank/data@base", "redacted", "tank/scrub1@scrubbed", "tank/scrub2@scrubbed"}, c)
+		}
+	}
+
+	var stream bytes.Buffer
+	ok(t, base.SendToContext(ctx, &stream, zfs.SendOptions{Redact: "#redacted"}))
+	copied, err := zfs.ReceiveFromContext(ctx, &stream, "tank/copy", zfs.ReceiveOptions{})
+	ok(t, err)
+	mounted, err := copied.MountedContext(ctx)
+	ok(t, err)
+	equals(t, false, mounted)
+
+	// only redaction bookmarks of the sent snapshot redact it
+	_, err = base.BookmarkContext(ctx, "plain")
+	ok(t, err)
+	err = base.SendToContext(ctx, ioutil.Discard, zfs.SendOptions{Redact: "tank/data#plain"})
+	if err == nil || !strings.Contains(err.Error(), "is not a redaction bookmark") {
+		t.Fatalf("expected error sending with a plain bookmark, got %v", err)
+	}
+	unrelated, err := fs.SnapshotContext(ctx, "later", false)
+	ok(t, err)
+	_, err = unrelated.RedactContext(ctx, "other", []string{"tank/scrub1@scrubbed"})
+	if err == nil || !strings.Contains(err.Error(), "is not a snapshot of a clone of it") {
+		t.Fatalf("expected error redacting with snapshots of unrelated clones, got %v", err)
+	}
+	_, err = unrelated.RedactClonesContext(ctx, "other")
+	if err == nil || !strings.Contains(err.Error(), "has no clones") {
+		t.Fatalf("expected error redacting a snapshot without clones, got %v", err)
+	}
+}
+
+func TestMount(t *testing.T) {
+	ctx, _ := setup(t)
+
+	fs, err := zfs.CreateFilesystemContext(ctx, "tank/fs", nil)
+	ok(t, err)
+	mounted, err := fs.MountedContext(ctx)
+	ok(t, err)
+	equals(t, true, mounted)
+	mountpoint, err := fs.EffectiveMountpointContext(ctx)
+	ok(t, err)
+	equals(t, "/tank/fs", mountpoint)
+
+	ok(t, zfs.UnmountAllContext(ctx, false))
+	mounts, err := zfs.MountsContext(ctx)
+	ok(t, err)
+	equals(t, map[string]string{}, mounts)
+	ok(t, zfs.MountAllContext(ctx, zfs.MountOptions{}))
+	mounts, err = zfs.MountsContext(ctx)
+	ok(t, err)
+	equals(t, map[string]string{"tank": "/tank", "tank/fs": "/tank/fs"}, mounts)
+
+	_, err = fs.UnmountContext(ctx, false)
+	ok(t, err)
+	mountpoint, err = fs.EffectiveMountpointContext(ctx)
+	ok(t, err)
+	equals(t, "", mountpoint)
+	_, err = fs.MountWithOptionsContext(ctx, zfs.MountOptions{Options: []string{"ro"}})
+	ok(t, err)
+
+	// filesystems with keys in a file can have their key loaded while mounting
+	dir, err := ioutil.TempDir("", "zfstest")
+	ok(t, err)
+	defer os.RemoveAll(dir)
+	keyFile := filepath.Join(dir, "key")
+	ok(t, ioutil.WriteFile(keyFile, []byte("correct horse\n"), 0o600))
+	secret, err := zfs.CreateFilesystemWithOptionsContext(ctx, "tank/secret", zfs.CreateFilesystemOptions{
+		Encryption: &zfs.EncryptionOptions{Encryption: "on", KeyFormat: zfs.KeyFormatPassphrase, KeyLocation: "file://" + keyFile},
+	})
+	ok(t, err)
+	_, err = secret.UnmountContext(ctx, false)
+	ok(t, err)
+	ok(t, secret.UnloadKeyContext(ctx, false))
+	if _, err = secret.MountContext(ctx, false, nil); err == nil {
+		t.Fatal("expected error mounting without key")
+	}
+	_, err = secret.MountWithOptionsContext(ctx, zfs.MountOptions{LoadKeys: true})
+	ok(t, err)
+	mounted, err = secret.MountedContext(ctx)
+	ok(t, err)
+	equals(t, true, mounted)
+}
+
+func TestShare(t *testing.T) {
+	ctx, _ := setup(t)
+
+	fs, err := zfs.CreateFilesystemContext(ctx, "tank/export", nil)
+	ok(t, err)
+	if err := fs.ShareContext(ctx); err == nil {
+		t.Fatal("expected error sharing with sharing disabled")
+	}
+
+	nfs := zfs.ShareOptions{Enabled: true, Options: []zfs.ShareOption{{Name: "rw", Value: "@10.0.0.0/8"}, {Name: "no_root_squash"}}}
+	ok(t, fs.SetShareOptionsContext(ctx, zfs.ShareNFS, nfs))
+	got, err := fs.GetShareOptionsContext(ctx, zfs.ShareNFS)
+	ok(t, err)
+	equals(t, &nfs, got)
+	smb, err := fs.GetShareOptionsContext(ctx, zfs.ShareSMB)
+	ok(t, err)
+	equals(t, false, smb.Enabled)
+
+	// setting the property shares the mounted filesystem right away
+	ok(t, fs.UnshareContext(ctx))
+	if err := fs.UnshareContext(ctx); err == nil {
+		t.Fatal("expected error unsharing a filesystem which is not shared")
+	}
+	ok(t, fs.ShareContext(ctx))
+	ok(t, zfs.UnshareAllContext(ctx))
+	ok(t, zfs.ShareAllContext(ctx))
+	ok(t, fs.UnshareContext(ctx))
+}
+
+func TestSpaceLimits(t *testing.T) {
+	ctx, _ := setup(t)
+
+	fs, err := zfs.CreateFilesystemContext(ctx, "tank/fs", nil)
+	ok(t, err)
+	ok(t, fs.SetQuotaContext(ctx, 1<<30))
+	ok(t, fs.SetRefReservationContext(ctx, 1<<20))
+	limits, err := fs.SpaceLimitsContext(ctx)
+	ok(t, err)
+	equals(t, &zfs.SpaceLimits{Quota: 1 << 30, RefReservation: 1 << 20}, limits)
+	ok(t, fs.SetQuotaContext(ctx, 0))
+	limits, err = fs.SpaceLimitsContext(ctx)
+	ok(t, err)
+	equals(t, uint64(0), limits.Quota)
+
+	spaces, err := zfs.SpaceBreakdownsContext(ctx, "tank")
+	ok(t, err)
+	equals(t, 2, len(spaces))
+	space, err := fs.SpaceContext(ctx)
+	ok(t, err)
+	equals(t, "tank/fs", space.Name)
+}
+
+func TestRenameWithOptions(t *testing.T) {
+	ctx, _ := setup(t)
+
+	fs, err := zfs.CreateFilesystemContext(ctx, "tank/fs", nil)
+	ok(t, err)
+	_, err = zfs.CreateFilesystemContext(ctx, "tank/fs/child", nil)
+	ok(t, err)
+	snaps, err := zfs.CreateSnapshotsContext(ctx, []string{"tank/fs@a"}, true, nil)
+	ok(t, err)
+
+	renamed, err := snaps[0].RenameWithOptionsContext(ctx, "@b", zfs.RenameOptions{Recursive: true})
+	ok(t, err)
+	equals(t, "tank/fs@b", renamed.Name)
+	_, err = zfs.GetDatasetContext(ctx, "tank/fs/child@b")
+	ok(t, err)
+	if _, err := renamed.RenameWithOptionsContext(ctx, "@c", zfs.RenameOptions{CreateParent: true}); err == nil {
+		t.Fatal("expected error creating parents of a snapshot")
+	}
+
+	if _, err := fs.RenameWithOptionsContext(ctx, "tank/a/b", zfs.RenameOptions{}); err == nil {
+		t.Fatal("expected error renaming to a missing parent")
+	}
+	renamed, err = fs.RenameWithOptionsContext(ctx, "tank/a/b", zfs.RenameOptions{CreateParent: true, Force: true})
+	ok(t, err)
+	equals(t, "/tank/a/b", renamed.Mountpoint)
+	_, err = zfs.GetDatasetContext(ctx, "tank/a/b/child@b")
+	ok(t, err)
+}
+
+func TestPromote(t *testing.T) {
+	ctx, _ := setup(t)
+
+	base, err := zfs.CreateFilesystemContext(ctx, "tank/base", nil)
+	ok(t, err)
+	_, err = base.SnapshotContext(ctx, "old", false)
+	ok(t, err)
+	golden, err := base.SnapshotContext(ctx, "golden", false)
+	ok(t, err)
+	_, err = base.SnapshotContext(ctx, "new", false)
+	ok(t, err)
+	vm1, err := golden.CloneContext(ctx, "tank/vm1", nil)
+	ok(t, err)
+	vm2, err := golden.CloneContext(ctx, "tank/vm2", nil)
+	ok(t, err)
+
+	graph, err := zfs.GetOriginGraphContext(ctx, "tank")
+	ok(t, err)
+	equals(t, []string{"tank/vm1", "tank/vm2"}, graph.Clones("tank/base@golden"))
+	equals(t, []string{"tank/base@old", "tank/vm1", "tank/vm2", "tank/base@golden", "tank/base@new", "tank/base"}, graph.DestroyOrder("tank/base"))
+
+	if _, err := base.PromoteContext(ctx); err == nil {
+		t.Fatal("expected error promoting a filesystem which is not a clone")
+	}
+	vm1, err = vm1.PromoteContext(ctx)
+	ok(t, err)
+	equals(t, "", vm1.Origin)
+	base, err = zfs.GetDatasetContext(ctx, "tank/base")
+	ok(t, err)
+	equals(t, "tank/vm1@golden", base.Origin)
+	vm2, err = zfs.GetDatasetContext(ctx, vm2.Name)
+	ok(t, err)
+	equals(t, "tank/vm1@golden", vm2.Origin)
+	snaps, err := vm1.SnapshotsContext(ctx)
+	ok(t, err)
+	equals(t, []string{"tank/vm1@old", "tank/vm1@golden"}, datasetNames(snaps))
+	snaps, err = base.SnapshotsContext(ctx)
+	ok(t, err)
+	equals(t, []string{"tank/base@new"}, datasetNames(snaps))
+}
+
+func TestRollbackPreview(t *testing.T) {
+	ctx, _ := setup(t)
+
+	fs, err := zfs.CreateFilesystemContext(ctx, "tank/fs", nil)
+	ok(t, err)
+	a, err := fs.SnapshotContext(ctx, "a", false)
+	ok(t, err)
+	b, err := fs.SnapshotContext(ctx, "b", false)
+	ok(t, err)
+	_, err = fs.SnapshotContext(ctx, "c", false)
+	ok(t, err)
+	_, err = b.CloneContext(ctx, "tank/clone", nil)
+	ok(t, err)
+
+	preview, err := a.RollbackPreviewContext(ctx)
+	ok(t, err)
+	equals(t, &zfs.RollbackPreview{MoreRecent: []string{"tank/fs@b", "tank/fs@c"}, Dependents: []string{"tank/clone"}}, preview)
+
+	if err := a.RollbackWithOptionsContext(ctx, zfs.RollbackOptions{DestroyMoreRecent: true}); err == nil {
+		t.Fatal("expected error rolling back past a snapshot with clones")
+	}
+	ok(t, a.RollbackWithOptionsContext(ctx, zfs.RollbackOptions{DestroyClones: true, Force: true}))
+	_, err = zfs.GetDatasetContext(ctx, "tank/clone")
+	if !errors.Is(err, zfs.ErrDatasetNotFound) {
+		t.Fatalf("expected ErrDatasetNotFound, got %v", err)
+	}
+	preview, err = a.RollbackPreviewContext(ctx)
+	ok(t, err)
+	equals(t, &zfs.RollbackPreview{}, preview)
+}
+
+func TestDestroyPreview(t *testing.T) {
+	ctx, _ := setup(t)
+
+	fs, err := zfs.CreateFilesystemContext(ctx, "tank/fs", nil)
+	ok(t, err)
+	_, err = zfs.CreateFilesystemContext(ctx, "tank/fs/child", nil)
+	ok(t, err)
+	snaps, err := zfs.CreateSnapshotsContext(ctx, []string{"tank/fs@a"}, true, nil)
+	ok(t, err)
+	_, err = snaps[0].CloneContext(ctx, "tank/clone", nil)
+	ok(t, err)
+
+	preview, err := fs.DestroyPreviewContext(ctx, zfs.DestroyRecursive|zfs.DestroyRecursiveClones)
+	ok(t, err)
+	equals(t, &zfs.DestroyPreview{Datasets: []string{"tank/fs", "tank/fs@a", "tank/fs/child", "tank/fs/child@a", "tank/clone"}}, preview)
+	if _, err := fs.DestroyPreviewContext(ctx, zfs.DestroyRecursive); err == nil {
+		t.Fatal("expected error previewing the destruction of a snapshot with clones")
+	}
+
+	preview, err = snaps[1].DestroyPreviewContext(ctx, zfs.DestroyDefault)
+	ok(t, err)
+	equals(t, &zfs.DestroyPreview{Datasets: []string{"tank/fs/child@a"}}, preview)
+	_, err = zfs.GetDatasetContext(ctx, "tank/fs/child@a")
+	ok(t, err)
+}
+
+func TestDestroySnapshotRange(t *testing.T) {
+	ctx, _ := setup(t)
+
+	fs, err := zfs.CreateFilesystemContext(ctx, "tank/fs", nil)
+	ok(t, err)
+	for _, name := range []string{"a", "b", "c", "d"} {
+		_, err = fs.SnapshotContext(ctx, name, false)
+		ok(t, err)
+	}
+
+	preview, err := fs.DestroySnapshotRangePreviewContext(ctx, "b", "c", zfs.DestroyDefault)
+	ok(t, err)
+	equals(t, &zfs.DestroyPreview{Datasets: []string{"tank/fs@b", "tank/fs@c"}}, preview)
+	preview, err = fs.DestroySnapshotRangePreviewContext(ctx, "", "b", zfs.DestroyDefault)
+	ok(t, err)
+	equals(t, &zfs.DestroyPreview{Datasets: []string{"tank/fs@a", "tank/fs@b"}}, preview)
+
+	ok(t, fs.DestroySnapshotRangeContext(ctx, "b", "", zfs.DestroyDefault))
+	snaps, err := fs.SnapshotsContext(ctx)
+	ok(t, err)
+	equals(t, []string{"tank/fs@a"}, datasetNames(snaps))
+}
+
+func TestDestroySnapshotsBatch(t *testing.T) {
+	ctx, _ := setup(t)
+
+	fs, err := zfs.CreateFilesystemContext(ctx, "tank/fs", nil)
+	ok(t, err)
+	var names []string
+	for _, name := range []string{"a", "b", "c"} {
+		snap, err := fs.SnapshotContext(ctx, name, false)
+		ok(t, err)
+		names = append(names, snap.Name)
+	}
+
+	// the backend does not run channel programs, so snapshots are destroyed with zfs destroy
+	ok(t, zfs.DestroySnapshotsBatchContext(ctx, append(names[1:], "tank/fs@missing")))
+	snaps, err := fs.SnapshotsContext(ctx)
+	ok(t, err)
+	equals(t, []string{"tank/fs@a"}, datasetNames(snaps))
+}
+
+func TestListDatasets(t *testing.T) {
+	ctx, _ := setup(t)
+
+	fs, err := zfs.CreateFilesystemContext(ctx, "tank/fs", nil)
+	ok(t, err)
+	_, err = zfs.CreateFilesystemContext(ctx, "tank/fs/child", nil)
+	ok(t, err)
+	for _, name := range []string{"auto-1", "manual", "auto-2"} {
+		_, err := fs.SnapshotContext(ctx, name, false)
+		ok(t, err)
+	}
+
+	names := func(list []*zfs.DatasetProperties) []string {
+		n := make([]string, len(list))
+		for i, p := range list {
+			n[i] = p.Name
+		}
+		return n
+	}
+	list, err := zfs.ListDatasetsContext(ctx, zfs.ListOptions{Root: "tank", Depth: 1, Types: []string{zfs.DatasetFilesystem}})
+	ok(t, err)
+	equals(t, []string{"tank", "tank/fs"}, names(list))
+
+	list, err = zfs.ListDatasetsContext(ctx, zfs.ListOptions{
+		Root:       "tank/fs",
+		Depth:      1,
+		Types:      []string{zfs.DatasetSnapshot},
+		Properties: []string{"creation", "used"},
+		Sort:       []string{"-creation"},
+		Match:      "tank/fs@auto-*",
+	})
+	ok(t, err)
+	equals(t, []string{"tank/fs@auto-2", "tank/fs@auto-1"}, names(list))
+	if !list[0].Creation.After(list[1].Creation) {
+		t.Fatalf("expected newest snapshot first, got %v and %v", list[0].Creation, list[1].Creation)
+	}
+	equals(t, "", list[0].Mountpoint)
+}
+
+func TestIterateDatasets(t *testing.T) {
+	ctx, _ := setup(t)
+
+	fs, err := zfs.CreateFilesystemContext(ctx, "tank/fs", nil)
+	ok(t, err)
+	for _, name := range []string{"a", "b", "c"} {
+		_, err := fs.SnapshotContext(ctx, name, false)
+		ok(t, err)
+	}
+
+	var names []string
+	err = zfs.IterateDatasets(ctx, zfs.ListOptions{Root: "tank/fs", Depth: 1, Types: []string{zfs.DatasetSnapshot}, Sort: []string{"-createtxg"}},
+		func(d *zfs.Dataset) error {
+			names = append(names, d.Name)
+			return nil
+		})
+	ok(t, err)
+	equals(t, []string{"tank/fs@c", "tank/fs@b", "tank/fs@a"}, names)
+}
+
+func TestDatasetHierarchy(t *testing.T) {
+	ctx, _ := setup(t)
+
+	fs, err := zfs.CreateFilesystemContext(ctx, "tank/fs", nil)
+	ok(t, err)
+	_, err = zfs.CreateFilesystemContext(ctx, "tank/fs/child", nil)
+	ok(t, err)
+	snap, err := fs.SnapshotContext(ctx, "a", false)
+	ok(t, err)
+
+	parent, err := snap.ParentContext(ctx)
+	ok(t, err)
+	equals(t, "tank/fs", parent.Name)
+	children, err := parent.ChildrenContext(ctx, 1)
+	ok(t, err)
+	equals(t, []string{"tank/fs@a", "tank/fs/child"}, datasetNames(children))
+	pool, err := snap.PoolContext(ctx)
+	ok(t, err)
+	equals(t, "tank", pool.Name)
+}
+
+func TestCreateVolumeWithOptions(t *testing.T) {
+	ctx, _ := setup(t)
+
+	vol, err := zfs.CreateVolumeWithOptionsContext(ctx, "tank/vm/disk0", 1<<30, zfs.CreateVolumeOptions{
+		VolBlockSize: 8192, Sparse: true, VolMode: zfs.VolModeDev,
+	})
+	ok(t, err)
+	equals(t, uint64(1<<30), vol.Volsize)
+	props, err := vol.PropertiesContext(ctx)
+	ok(t, err)
+	equals(t, uint64(8192), props.VolBlockSize)
+	equals(t, "dev", props.Raw["volmode"].Value)
+}
+
+func TestResizeVolume(t *testing.T) {
+	ctx, _ := setup(t)
+
+	vol, err := zfs.CreateVolumeContext(ctx, "tank/vol", 1<<30, nil)
+	ok(t, err)
+	ok(t, vol.ResizeVolumeContext(ctx, 2<<30, false))
+	if err := vol.ResizeVolumeContext(ctx, 1<<30, false); err == nil {
+		t.Fatal("expected error shrinking volume")
+	}
+	vol, err = zfs.GetDatasetContext(ctx, "tank/vol")
+	ok(t, err)
+	equals(t, uint64(2<<30), vol.Volsize)
+}
+
+func TestEnsure(t *testing.T) {
+	ctx, _ := setup(t)
+
+	_, err := zfs.CreateFilesystemContext(ctx, "tank/csi", nil)
+	ok(t, err)
+	fs, changed, err := zfs.EnsureFilesystemContext(ctx, "tank/csi/pv1", map[string]string{"refquota": "1073741824"})
+	ok(t, err)
+	equals(t, true, changed)
+	_, changed, err = zfs.EnsureFilesystemContext(ctx, "tank/csi/pv1", map[string]string{"refquota": "1073741824"})
+	ok(t, err)
+	equals(t, false, changed)
+	_, changed, err = zfs.EnsureFilesystemContext(ctx, "tank/csi/pv1", map[string]string{"refquota": "2147483648"})
+	ok(t, err)
+	equals(t, true, changed)
+
+	_, changed, err = zfs.EnsureSnapshotContext(ctx, fs.Name+"@snap1")
+	ok(t, err)
+	equals(t, true, changed)
+	_, changed, err = zfs.EnsureSnapshotContext(ctx, fs.Name+"@snap1")
+	ok(t, err)
+	equals(t, false, changed)
+
+	clone, changed, err := zfs.EnsureCloneContext(ctx, fs.Name+"@snap1", "tank/csi/pv2", nil)
+	ok(t, err)
+	equals(t, true, changed)
+	equals(t, fs.Name+"@snap1", clone.Origin)
+	_, changed, err = zfs.EnsureCloneContext(ctx, fs.Name+"@snap1", "tank/csi/pv2", nil)
+	ok(t, err)
+	equals(t, false, changed)
+	if _, _, err := zfs.EnsureCloneContext(ctx, fs.Name+"@snap1", fs.Name, nil); err == nil {
+		t.Fatal("expected error for a dataset which is not a clone")
+	}
+
+	_, changed, err = zfs.EnsureVolumeContext(ctx, "tank/csi/vol1", 1<<30, nil)
+	ok(t, err)
+	equals(t, true, changed)
+	_, changed, err = zfs.EnsureVolumeContext(ctx, "tank/csi/vol1", 1<<30, nil)
+	ok(t, err)
+	equals(t, false, changed)
+	if _, _, err := zfs.EnsureVolumeContext(ctx, "tank/csi/vol1", 2<<30, nil); err == nil {
+		t.Fatal("expected error for a volume of another size")
+	}
+	if _, _, err := zfs.EnsureVolumeContext(ctx, fs.Name, 1<<30, nil); err == nil {
+		t.Fatal("expected error for a filesystem")
+	}
+
+	changed, err = zfs.ExpandDatasetContext(ctx, "tank/csi/vol1", 2<<30)
+	ok(t, err)
+	equals(t, true, changed)
+	changed, err = zfs.ExpandDatasetContext(ctx, "tank/csi/vol1", 1<<30)
+	ok(t, err)
+	equals(t, false, changed)
+	changed, err = zfs.ExpandDatasetContext(ctx, fs.Name, 4<<30)
+	ok(t, err)
+	equals(t, true, changed)
+	refquota, err := fs.GetPropertyContext(ctx, "refquota")
+	ok(t, err)
+	equals(t, "4G", refquota)
+}
@@ -0,0 +1,414 @@
+package zfstest
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// epoch is the creation time of the first fake dataset, later datasets are created one second apart.
+var epoch = time.Date(2022, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// creationTimeLayout is the format of timestamps printed by zfs get without -p.
+const creationTimeLayout = "Mon Jan _2 15:04 2006"
+
+// inheritableDefaults are the native dataset properties which are inherited from the parent dataset,
+// along with their default value.
+var inheritableDefaults = map[string]string{
+	"aclinherit":           "restricted",
+	"acltype":              "off",
+	"atime":                "on",
+	"checksum":             "on",
+	"compression":          "off",
+	"copies":               "1",
+	"dedup":                "off",
+	"devices":              "on",
+	"dnodesize":            "legacy",
+	"exec":                 "on",
+	"logbias":              "latency",
+	"primarycache":         "all",
+	"readonly":             "off",
+	"recordsize":           "131072",
+	"redundant_metadata":   "all",
+	"relatime":             "off",
+	"secondarycache":       "all",
+	"setuid":               "on",
+	"sharenfs":             "off",
+	"sharesmb":             "off",
+	"snapdev":              "hidden",
+	"snapdir":              "hidden",
+	"special_small_blocks": "0",
+	"sync":                 "standard",
+	"volmode":              "default",
+	"xattr":                "on",
+}
+
+// localDefaults are the native dataset properties which are not inherited, along with their default value.
+var localDefaults = map[string]string{
+	"canmount":       "on",
+	"quota":          "0",
+	"refquota":       "0",
+	"reservation":    "0",
+	"refreservation": "0",
+	"volblocksize":   "16384",
+	"encryption":     "off",
+	"keyformat":      "none",
+	"keylocation":    "none",
+	"pbkdf2iters":    "0",
+}
+
+// readOnlyProps are the native dataset properties which are computed and cannot be set.
+var readOnlyProps = map[string]bool{
+	"available": true, "avail": true, "compressratio": true, "createtxg": true, "creation": true, "encryptionroot": true,
+	"guid":      true,
+	"keystatus": true, "logicalreferenced": true, "logicalused": true, "mounted": true, "name": true,
+	"origin": true, "receive_resume_token": true, "refer": true, "referenced": true, "type": true, "used": true,
+	"usedbychildren": true, "usedbydataset": true, "usedbyrefreservation": true, "usedbysnapshots": true,
+	"userrefs": true, "written": true,
+}
+
+// allProps lists the properties printed by zfs get all, in order.
+var allProps = func() []string {
+	props := []string{
+		"type", "creation", "used", "available", "referenced", "compressratio", "mounted", "origin",
+		"quota", "reservation", "recordsize", "mountpoint", "volsize", "volblocksize", "createtxg", "guid",
+		"usedbysnapshots", "usedbydataset", "usedbychildren", "usedbyrefreservation", "written",
+		"logicalused", "logicalreferenced", "refquota", "refreservation", "encryption", "keylocation",
+		"keyformat", "pbkdf2iters", "encryptionroot", "keystatus", "receive_resume_token", "userrefs", "canmount",
+	}
+	seen := map[string]bool{}
+	for _, p := range props {
+		seen[p] = true
+	}
+	inheritable := make([]string, 0, len(inheritableDefaults))
+	for p := range inheritableDefaults {
+		if !seen[p] {
+			inheritable = append(inheritable, p)
+		}
+	}
+	sort.Strings(inheritable)
+	return append(props, inheritable...)
+}()
+
+func isUserProp(name string) bool {
+	return strings.Contains(name, ":")
+}
+
+// validDatasetProp reports whether name is a property the backend knows.
+func validDatasetProp(name string) bool {
+	if isUserProp(name) || readOnlyProps[name] || name == "mountpoint" || name == "volsize" {
+		return true
+	}
+	_, inheritable := inheritableDefaults[name]
+	_, local := localDefaults[name]
+	return inheritable || local
+}
+
+// prop resolves the value and source of a property of ds.
+// ok is false if the property is not known at all.
+func (b *Backend) prop(ds *dataset, name string, parsable bool) (value, source string, ok bool) {
+	switch name {
+	case "name":
+		return ds.name, "-", true
+	case "type":
+		return ds.typ, "-", true
+	case "origin":
+		if ds.origin == "" {
+			return "-", "-", true
+		}
+		return ds.origin, "-", true
+	case "creation":
+		created := txgTime(ds.txg)
+		if parsable {
+			return strconv.FormatInt(created.Unix(), 10), "-", true
+		}
+		return created.Local().Format(creationTimeLayout), "-", true
+	case "createtxg":
+		return strconv.FormatUint(ds.txg, 10), "-", true
+	case "userrefs":
+		if ds.typ != typeSnapshot {
+			return "-", "-", true
+		}
+		return strconv.Itoa(len(ds.holds)), "-", true
+	case "guid":
+		return strconv.FormatUint(ds.guid, 10), "-", true
+	case "used", "referenced", "refer", "written", "logicalused", "logicalreferenced",
+		"usedbysnapshots", "usedbydataset", "usedbychildren", "usedbyrefreservation":
+		if ds.typ == typeBookmark {
+			return "-", "-", true
+		}
+		return "0", "-", true
+	case "available", "avail":
+		if ds.typ == typeSnapshot || ds.typ == typeBookmark {
+			return "-", "-", true
+		}
+		return strconv.FormatUint(b.poolSize(ds.name), 10), "-", true
+	case "compressratio":
+		return "1.00x", "-", true
+	case "mounted":
+		if ds.typ != typeFilesystem {
+			return "-", "-", true
+		}
+		if ds.mounted {
+			return "yes", "-", true
+		}
+		return "no", "-", true
+	case "volsize":
+		if ds.typ != typeVolume {
+			return "-", "-", true
+		}
+		return strconv.FormatUint(ds.volsize, 10), "local", true
+	case "encryption", "keyformat", "keylocation", "pbkdf2iters", "encryptionroot", "keystatus":
+		return b.encryptionProp(ds, name)
+	case "receive_resume_token":
+		if ds.resumeToken == "" {
+			return "-", "-", true
+		}
+		return ds.resumeToken, "-", true
+	case "mountpoint":
+		if ds.typ != typeFilesystem {
+			return "-", "-", true
+		}
+		return b.mountpoint(ds)
+	}
+
+	if v, ok := ds.props[name]; ok {
+		return v, "local", true
+	}
+	if def, ok := localDefaults[name]; ok {
+		return def, "default", true
+	}
+
+	def, inheritable := inheritableDefaults[name]
+	if !inheritable && !isUserProp(name) {
+		return "", "", false
+	}
+	if ds.typ == typeBookmark && !isUserProp(name) {
+		return "-", "-", true
+	}
+	for parent := b.datasets[parentName(ds.name)]; parent != nil; parent = b.datasets[parentName(parent.name)] {
+		if v, ok := parent.props[name]; ok {
+			return v, "inherited from " + parent.name, true
+		}
+	}
+	if isUserProp(name) {
+		return "-", "-", true
+	}
+	return def, "default", true
+}
+
+// encryptionRoot returns the dataset holding the encryption key of ds, or nil if ds is not encrypted.
+func (b *Backend) encryptionRoot(ds *dataset) *dataset {
+	for d := b.datasets[fsName(ds.name)]; d != nil; d = b.datasets[parentName(d.name)] {
+		if d.key != nil {
+			return d
+		}
+	}
+	return nil
+}
+
+func (b *Backend) encryptionProp(ds *dataset, name string) (string, string, bool) {
+	root := b.encryptionRoot(ds)
+	if root == nil {
+		if name == "encryptionroot" || name == "keystatus" {
+			return "-", "-", true
+		}
+		return localDefaults[name], "default", true
+	}
+	isRoot := root == ds
+	switch name {
+	case "encryption":
+		if v := root.props[name]; v != "on" {
+			return v, "-", true
+		}
+		return "aes-256-gcm", "-", true
+	case "encryptionroot":
+		return root.name, "-", true
+	case "keystatus":
+		if root.keyLoaded {
+			return "available", "-", true
+		}
+		return "unavailable", "-", true
+	case "keylocation":
+		if !isRoot {
+			return "none", "default", true
+		}
+	}
+	v, ok := root.props[name]
+	if !ok {
+		v = localDefaults[name]
+	}
+	if isRoot {
+		return v, "local", true
+	}
+	return v, "-", true
+}
+
+// mountable reports whether a filesystem is mounted automatically.
+func (b *Backend) mountable(ds *dataset) bool {
+	if ds.typ != typeFilesystem || ds.redacted {
+		return false
+	}
+	if canmount, _, _ := b.prop(ds, "canmount", true); canmount != "on" {
+		return false
+	}
+	if mp, _, _ := b.prop(ds, "mountpoint", true); mp == "none" || mp == "legacy" {
+		return false
+	}
+	root := b.encryptionRoot(ds)
+	return root == nil || root.keyLoaded
+}
+
+// mountpoint resolves the mountpoint of a filesystem, which defaults to its name below the parent's mountpoint.
+func (b *Backend) mountpoint(ds *dataset) (string, string, bool) {
+	if v, ok := ds.props["mountpoint"]; ok {
+		return v, "local", true
+	}
+	suffix := ""
+	for cur := ds; cur != nil; cur = b.datasets[parentName(cur.name)] {
+		if v, ok := cur.props["mountpoint"]; ok {
+			if v == "none" || v == "legacy" {
+				return v, "inherited from " + cur.name, true
+			}
+			return strings.TrimSuffix(v, "/") + suffix, "inherited from " + cur.name, true
+		}
+		if parentName(cur.name) == "" {
+			return "/" + cur.name + suffix, "default", true
+		}
+		suffix = "/" + cur.name[strings.LastIndexByte(cur.name, '/')+1:] + suffix
+	}
+	return "-", "-", true
+}
+
+func (b *Backend) poolSize(name string) uint64 {
+	p := b.pools[poolName(name)]
+	if p == nil {
+		return 0
+	}
+	return p.size()
+}
+
+// poolName returns the pool part of a dataset name.
+func poolName(name string) string {
+	if i := strings.IndexAny(name, "/@#"); i >= 0 {
+		return name[:i]
+	}
+	return name
+}
+
+// sizeProps are the properties printed as human readable sizes without -p.
+var sizeProps = map[string]bool{
+	"available": true, "avail": true, "logicalreferenced": true, "logicalused": true, "quota": true,
+	"recordsize": true, "refer": true, "referenced": true, "refquota": true, "refreservation": true,
+	"reservation": true, "used": true, "usedbychildren": true, "usedbydataset": true,
+	"usedbyrefreservation": true, "usedbysnapshots": true, "volblocksize": true, "volsize": true, "written": true,
+}
+
+// filesystemProps are the native properties which only apply to filesystems.
+var filesystemProps = map[string]bool{
+	"aclinherit": true, "acltype": true, "atime": true, "canmount": true, "devices": true, "exec": true,
+	"mounted": true, "mountpoint": true, "quota": true, "recordsize": true, "relatime": true, "setuid": true,
+	"sharenfs": true, "sharesmb": true, "snapdir": true, "xattr": true,
+}
+
+// volumeProps are the native properties which only apply to volumes.
+var volumeProps = map[string]bool{
+	"snapdev": true, "volblocksize": true, "volmode": true, "volsize": true,
+}
+
+// snapshotProps are the native properties which apply to snapshots.
+var snapshotProps = map[string]bool{
+	"compressratio": true, "createtxg": true, "creation": true, "encryption": true, "encryptionroot": true,
+	"guid": true, "keystatus": true, "logicalreferenced": true, "name": true, "referenced": true,
+	"refer": true, "type": true, "used": true, "userrefs": true, "written": true,
+}
+
+// bookmarkProps are the native properties which apply to bookmarks.
+var bookmarkProps = map[string]bool{
+	"createtxg": true, "creation": true, "guid": true, "name": true, "type": true,
+}
+
+// applies reports whether the property is defined for datasets of the type of ds.
+func applies(ds *dataset, name string) bool {
+	if isUserProp(name) {
+		return true
+	}
+	switch ds.typ {
+	case typeSnapshot:
+		return snapshotProps[name]
+	case typeBookmark:
+		return bookmarkProps[name]
+	case typeFilesystem:
+		return !volumeProps[name]
+	default:
+		return !filesystemProps[name]
+	}
+}
+
+// display resolves a property of ds as printed by zfs get and zfs list.
+func (b *Backend) display(ds *dataset, name string, parsable bool) (string, string, error) {
+	if !applies(ds, name) {
+		if !validDatasetProp(name) {
+			return "", "", fmt.Errorf("bad property list: invalid property '%s'", name)
+		}
+		return "-", "-", nil
+	}
+	value, source, ok := b.prop(ds, name, parsable)
+	if !ok {
+		return "", "", fmt.Errorf("bad property list: invalid property '%s'", name)
+	}
+	if parsable || !sizeProps[name] {
+		return value, source, nil
+	}
+	n, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return value, source, nil
+	}
+	if n == 0 && (strings.HasSuffix(name, "quota") || strings.HasSuffix(name, "reservation")) {
+		return "none", source, nil
+	}
+	return humanSize(n), source, nil
+}
+
+// humanSize formats n like the zfs command, e.g. 1.50G.
+func humanSize(n uint64) string {
+	const units = "KMGTPE"
+	if n < 1024 {
+		return strconv.FormatUint(n, 10)
+	}
+	v := float64(n)
+	i := -1
+	for v >= 1024 && i < len(units)-1 {
+		v /= 1024
+		i++
+	}
+	switch {
+	case v == float64(uint64(v)):
+		return fmt.Sprintf("%d%c", uint64(v), units[i])
+	case v < 10:
+		return fmt.Sprintf("%.2f%c", v, units[i])
+	case v < 100:
+		return fmt.Sprintf("%.1f%c", v, units[i])
+	default:
+		return fmt.Sprintf("%.0f%c", v, units[i])
+	}
+}
+
+// parseSize parses a size such as 1048576, 512K or 1.5G.
+func parseSize(s string) (uint64, error) {
+	if s == "" {
+		return 0, fmt.Errorf("bad numeric value '%s'", s)
+	}
+	mult := uint64(1)
+	if i := strings.IndexByte("KMGTPE", strings.ToUpper(s[len(s)-1:])[0]); i >= 0 {
+		mult = 1 << (10 * uint(i+1))
+		s = s[:len(s)-1]
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("bad numeric value '%s'", s)
+	}
+	return uint64(v * float64(mult)), nil
+}
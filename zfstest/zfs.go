@@ -0,0 +1,1587 @@
+package zfstest
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// zfs emulates a zfs subcommand.
+func (b *Backend) zfs(inv *invocation, cmd string, args []string) error {
+	switch cmd {
+	case "list":
+		return b.zfsList(inv, args)
+	case "create":
+		return b.zfsCreate(inv, args)
+	case "destroy":
+		return b.zfsDestroy(inv, args)
+	case "snapshot", "snap":
+		return b.zfsSnapshot(args)
+	case "clone":
+		return b.zfsClone(args)
+	case "rename":
+		return b.zfsRename(args)
+	case "promote":
+		return b.zfsPromote(args)
+	case "rollback":
+		return b.zfsRollback(args)
+	case "set":
+		return b.zfsSet(args)
+	case "get":
+		return b.zfsGet(inv, args)
+	case "inherit":
+		return b.zfsInherit(args)
+	case "mount":
+		return b.zfsMount(inv, args)
+	case "unmount", "umount":
+		return b.zfsUnmount(args)
+	case "share":
+		return b.zfsShare(args)
+	case "unshare":
+		return b.zfsUnshare(args)
+	case "bookmark":
+		return b.zfsBookmark(args)
+	case "redact":
+		return b.zfsRedact(args)
+	case "hold":
+		return b.zfsHold(args)
+	case "release":
+		return b.zfsRelease(args)
+	case "holds":
+		return b.zfsHolds(inv, args)
+	case "diff":
+		return b.zfsDiff(args)
+	case "send":
+		return b.zfsSend(inv, args)
+	case "receive", "recv":
+		return b.zfsReceive(inv, args)
+	case "load-key":
+		return b.zfsLoadKey(inv, args)
+	case "unload-key":
+		return b.zfsUnloadKey(args)
+	case "change-key":
+		return b.zfsChangeKey(inv, args)
+	case "wait":
+		return b.zfsWait(args)
+	}
+	return fmt.Errorf("unrecognized command '%s'", cmd)
+}
+
+// parseTypes parses the argument of -t, returning nil if it is empty.
+func parseTypes(s string) (map[string]bool, error) {
+	if s == "" {
+		return nil, nil
+	}
+	types := map[string]bool{}
+	for _, t := range strings.Split(s, ",") {
+		switch t {
+		case "all":
+			types[typeFilesystem], types[typeVolume], types[typeSnapshot], types[typeBookmark] = true, true, true, true
+		case "filesystem", "fs":
+			types[typeFilesystem] = true
+		case "volume", "vol":
+			types[typeVolume] = true
+		case "snapshot", "snap":
+			types[typeSnapshot] = true
+		case "bookmark":
+			types[typeBookmark] = true
+		default:
+			return nil, fmt.Errorf("invalid type '%s'", t)
+		}
+	}
+	return types, nil
+}
+
+// parseDepth returns the maximum depth selected by -r and -d, or -1 if neither is given.
+func parseDepth(f flags) (int, error) {
+	if f.has('d') {
+		d, err := strconv.Atoi(f.last('d'))
+		if err != nil || d < 0 {
+			return 0, fmt.Errorf("invalid depth '%s'", f.last('d'))
+		}
+		return d, nil
+	}
+	if f.has('r') {
+		return int(^uint(0) >> 1), nil
+	}
+	return -1, nil
+}
+
+// collect selects the datasets named on the command line, and their descendants up to maxDepth,
+// as zfs list and zfs get do. Named datasets are always included, descendants only if their type is in types,
+// which defaults to filesystems and volumes.
+func (b *Backend) collect(names []string, types map[string]bool, maxDepth int) ([]*dataset, error) {
+	if len(names) == 0 {
+		for name := range b.pools {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		if maxDepth < 0 {
+			maxDepth = int(^uint(0) >> 1)
+		}
+	}
+	want := types
+	if want == nil {
+		want = map[string]bool{typeFilesystem: true, typeVolume: true}
+	}
+
+	all := b.sortedDatasets()
+	var selected []*dataset
+	for _, name := range names {
+		ds, err := b.lookup(name)
+		if err != nil {
+			return nil, err
+		}
+		limit := maxDepth
+		if types == nil || types[ds.typ] {
+			selected = append(selected, ds)
+		} else if limit < 0 {
+			// zfs list -t snapshot fs lists the snapshots of fs
+			limit = 1
+		}
+		for _, d := range all {
+			if d != ds && isDescendant(d.name, ds.name) && depth(d.name, ds.name) <= limit && want[d.typ] {
+				selected = append(selected, d)
+			}
+		}
+	}
+	return selected, nil
+}
+
+func (b *Backend) zfsList(inv *invocation, args []string) error {
+	f, names, err := parseFlags(args, "rHpd:o:s:S:t:")
+	if err != nil {
+		return err
+	}
+	types, err := parseTypes(f.last('t'))
+	if err != nil {
+		return err
+	}
+	maxDepth, err := parseDepth(f)
+	if err != nil {
+		return err
+	}
+	columns := []string{"name", "used", "avail", "refer", "mountpoint"}
+	if f.has('o') {
+		columns = strings.Split(f.last('o'), ",")
+	}
+	for _, c := range columns {
+		if !validDatasetProp(c) {
+			return fmt.Errorf("bad property list: invalid property '%s'", c)
+		}
+	}
+
+	datasets, err := b.collect(names, types, maxDepth)
+	if err != nil {
+		return err
+	}
+	if f.has('s') || f.has('S') {
+		if err := b.sortDatasets(datasets, sortKeys(args)); err != nil {
+			return err
+		}
+	}
+	if !f.has('H') {
+		inv.printRow(strings.Split(strings.ToUpper(strings.Join(columns, ",")), ",")...)
+	}
+	for _, ds := range datasets {
+		row := make([]string, len(columns))
+		for i, c := range columns {
+			if row[i], _, err = b.display(ds, c, f.has('p')); err != nil {
+				return err
+			}
+		}
+		inv.printRow(row...)
+	}
+	return nil
+}
+
+// sortKey is a property given to zfs list -s, or -S if descending.
+type sortKey struct {
+	prop       string
+	descending bool
+}
+
+// sortKeys returns the sort properties of zfs list in the order they were given, which the flags parsed by
+// parseFlags do not preserve across -s and -S. Only options given separately from other flags are recognized.
+func sortKeys(args []string) []sortKey {
+	var keys []sortKey
+	for i := 0; i+1 < len(args); i++ {
+		switch args[i] {
+		case "-s", "-S":
+			keys = append(keys, sortKey{prop: args[i+1], descending: args[i] == "-S"})
+			i++
+		}
+	}
+	return keys
+}
+
+// sortDatasets orders datasets by keys like zfs list -s and -S. Numeric values are compared as numbers, datasets
+// without a value for a property sort last and equal datasets keep their order.
+func (b *Backend) sortDatasets(datasets []*dataset, keys []sortKey) error {
+	values := make(map[*dataset][]string, len(datasets))
+	for _, ds := range datasets {
+		for _, k := range keys {
+			v, _, err := b.display(ds, k.prop, true)
+			if err != nil {
+				return err
+			}
+			values[ds] = append(values[ds], v)
+		}
+	}
+	sort.SliceStable(datasets, func(i, j int) bool {
+		a, c := values[datasets[i]], values[datasets[j]]
+		for n, k := range keys {
+			if a[n] == c[n] {
+				continue
+			}
+			if a[n] == "-" || c[n] == "-" {
+				return c[n] == "-"
+			}
+			x, errx := strconv.ParseFloat(a[n], 64)
+			y, erry := strconv.ParseFloat(c[n], 64)
+			less := a[n] < c[n]
+			if errx == nil && erry == nil {
+				less = x < y
+			}
+			return less != k.descending
+		}
+		return false
+	})
+	return nil
+}
+
+// parseProps parses the arguments of -o options into properties which can be set on a dataset.
+func parseProps(name string, opts []string) (map[string]string, error) {
+	props := map[string]string{}
+	for _, o := range opts {
+		k, v, err := splitProp(o)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkSettable(name, k); err != nil {
+			return nil, err
+		}
+		props[k] = v
+	}
+	return props, nil
+}
+
+// checkSettable returns an error if the property k cannot be set on dataset name.
+func checkSettable(name, k string) error {
+	if !validDatasetProp(k) {
+		return fmt.Errorf("cannot set property for '%s': invalid property '%s'", name, k)
+	}
+	if readOnlyProps[k] {
+		return fmt.Errorf("cannot set property for '%s': '%s' is readonly", name, k)
+	}
+	return nil
+}
+
+func (b *Backend) zfsCreate(inv *invocation, args []string) error {
+	f, rest, err := parseFlags(args, "psb:V:o:")
+	if err != nil {
+		return err
+	}
+	if len(rest) != 1 {
+		return fmt.Errorf("expected exactly one dataset argument")
+	}
+	name := rest[0]
+	props, err := parseProps(name, f['o'])
+	if err != nil {
+		return err
+	}
+	typ := typeFilesystem
+	if f.has('V') {
+		typ = typeVolume
+		size, err := parseSize(f.last('V'))
+		if err != nil {
+			return fmt.Errorf("cannot create '%s': %v", name, err)
+		}
+		props["volsize"] = strconv.FormatUint(size, 10)
+	}
+	_, err = b.createDataset(inv, name, typ, props, f.has('p'))
+	return err
+}
+
+// createDataset creates a filesystem or volume with the given local properties.
+// The parent must exist unless parents is set, in which case missing filesystems are created.
+func (b *Backend) createDataset(inv *invocation, name, typ string, props map[string]string, parents bool) (*dataset, error) {
+	if strings.ContainsAny(name, "@#") {
+		return nil, fmt.Errorf("cannot create '%s': snapshot delimiter '@' is not expected here", name)
+	}
+	if b.datasets[name] != nil {
+		return nil, fmt.Errorf("cannot create '%s': dataset already exists", name)
+	}
+	if b.pools[poolName(name)] == nil {
+		return nil, fmt.Errorf("cannot create '%s': no such pool '%s'", name, poolName(name))
+	}
+	parent := b.datasets[parentName(name)]
+	if parent == nil && parentName(name) != "" {
+		if !parents {
+			return nil, fmt.Errorf("cannot create '%s': parent does not exist", name)
+		}
+		var err error
+		if parent, err = b.createDataset(inv, parentName(name), typeFilesystem, map[string]string{}, true); err != nil {
+			return nil, err
+		}
+	}
+	if parent != nil && parent.typ != typeFilesystem {
+		return nil, fmt.Errorf("cannot create '%s': parent is not a filesystem", name)
+	}
+
+	var key []byte
+	if enc, ok := props["encryption"]; ok && enc != "off" {
+		format := props["keyformat"]
+		if format == "" || format == "none" {
+			return nil, fmt.Errorf("cannot create '%s': Keyformat required for new encryption root", name)
+		}
+		location := props["keylocation"]
+		if location == "" {
+			location = "prompt"
+			props["keylocation"] = location
+		}
+		var err error
+		if key, err = readKey(inv, location, format); err != nil {
+			return nil, fmt.Errorf("cannot create '%s': %v", name, err)
+		}
+	} else if parent != nil {
+		if root := b.encryptionRoot(parent); root != nil && !root.keyLoaded {
+			return nil, fmt.Errorf("cannot create '%s': encryption root's key is not loaded or provided", name)
+		}
+	}
+
+	ds := b.newDataset(name, typ)
+	if typ == typeVolume {
+		ds.volsize, _ = strconv.ParseUint(props["volsize"], 10, 64)
+		delete(props, "volsize")
+	}
+	ds.props = props
+	ds.key, ds.keyLoaded = key, key != nil
+	ds.mounted = b.mountable(ds)
+	return ds, nil
+}
+
+// inSnapshotRange reports whether snap is part of the range first%last of snapshots of its filesystem,
+// where an empty first or last selects from the oldest or up to the newest snapshot.
+func (b *Backend) inSnapshotRange(snap *dataset, r string) bool {
+	i := strings.IndexByte(r, '%')
+	if i < 0 {
+		return false
+	}
+	first, last := r[:i], r[i+1:]
+	in := first == ""
+	for _, d := range b.snapshotsOf(fsName(snap.name)) {
+		if d.name == fsName(d.name)+"@"+first {
+			in = true
+		}
+		if in && d == snap {
+			return last == "" || b.datasets[fsName(d.name)+"@"+last] != nil
+		}
+		if d.name == fsName(d.name)+"@"+last {
+			return false
+		}
+	}
+	return false
+}
+
+func (b *Backend) zfsDestroy(inv *invocation, args []string) error {
+	f, rest, err := parseFlags(args, "rRdfnvp")
+	if err != nil {
+		return err
+	}
+	if len(rest) != 1 {
+		return fmt.Errorf("expected exactly one dataset argument")
+	}
+	name := rest[0]
+
+	var targets []*dataset
+	if i := strings.IndexByte(name, '@'); i >= 0 {
+		names := strings.Split(name[i+1:], ",")
+		for _, d := range b.sortedDatasets() {
+			if d.typ != typeSnapshot || !isDescendant(d.name, name[:i]) {
+				continue
+			}
+			if fsName(d.name) != name[:i] && !f.has('r') && !f.has('R') {
+				continue
+			}
+			for _, n := range names {
+				if d.name == fsName(d.name)+"@"+n || b.inSnapshotRange(d, n) {
+					targets = append(targets, d)
+					break
+				}
+			}
+		}
+		if len(targets) == 0 {
+			return fmt.Errorf("could not find any snapshots to destroy; check snapshot names.")
+		}
+	} else {
+		ds, err := b.lookup(name)
+		if err != nil {
+			return err
+		}
+		all := b.descendants(ds)
+		if parentName(name) == "" && !f.has('r') && !f.has('R') {
+			return fmt.Errorf("cannot destroy '%s': operation does not apply to pools\n"+
+				"use 'zfs destroy -r %s' to destroy all datasets in the pool\n"+
+				"use 'zpool destroy %s' to destroy the pool itself", name, name, name)
+		}
+		if len(all) > 1 && !f.has('r') && !f.has('R') {
+			return fmt.Errorf("cannot destroy '%s': filesystem has children\n"+
+				"use '-r' to destroy the following datasets:\n%s", name, names(all[1:]))
+		}
+		targets = all
+		if parentName(name) == "" {
+			// destroying a pool root recursively only destroys its descendants
+			targets = all[1:]
+		}
+	}
+
+	dependents := b.dependents(targets)
+	if len(dependents) > 0 {
+		if !f.has('R') {
+			kind := "filesystem"
+			if targets[0].typ == typeSnapshot {
+				kind = "snapshot"
+			}
+			return fmt.Errorf("cannot destroy '%s': %s has dependent clones\n"+
+				"use '-R' to destroy the following datasets:\n%s", name, kind, names(dependents))
+		}
+		targets = append(targets, dependents...)
+	}
+
+	var destroy []*dataset
+	for _, d := range targets {
+		if len(d.holds) > 0 {
+			if !f.has('d') {
+				return fmt.Errorf("cannot destroy snapshot %s: dataset is busy", d.name)
+			}
+			if !f.has('n') {
+				d.deferDestroy = true
+			}
+			continue
+		}
+		destroy = append(destroy, d)
+	}
+	for _, d := range destroy {
+		switch {
+		case f.has('p'):
+			inv.printRow("destroy", d.name)
+		case f.has('v') && f.has('n'):
+			inv.printRow("would destroy " + d.name)
+		case f.has('v'):
+			inv.printRow("will destroy " + d.name)
+		}
+		if !f.has('n') {
+			delete(b.datasets, d.name)
+		}
+	}
+	// snapshots of the backend hold no data, so destroying them never reclaims any space
+	if f.has('v') && strings.Contains(name, "@") {
+		switch {
+		case f.has('p'):
+			inv.printRow("reclaim", "0")
+		case f.has('n'):
+			inv.printRow("would reclaim 0B")
+		default:
+			inv.printRow("will reclaim 0B")
+		}
+	}
+	return nil
+}
+
+// dependents returns the clones of any snapshot in datasets which are not in datasets themselves,
+// along with all of their descendants and dependent clones.
+func (b *Backend) dependents(datasets []*dataset) []*dataset {
+	in := map[string]bool{}
+	for _, d := range datasets {
+		in[d.name] = true
+	}
+	var deps []*dataset
+	for added := true; added; {
+		added = false
+		for _, d := range b.sortedDatasets() {
+			if d.origin == "" || d.typ == typeBookmark || in[d.name] || !in[d.origin] {
+				continue
+			}
+			for _, c := range b.descendants(d) {
+				if !in[c.name] {
+					in[c.name] = true
+					deps = append(deps, c)
+				}
+			}
+			added = true
+		}
+	}
+	return deps
+}
+
+func names(datasets []*dataset) string {
+	n := make([]string, len(datasets))
+	for i, d := range datasets {
+		n[i] = d.name
+	}
+	return strings.Join(n, "\n")
+}
+
+func (b *Backend) zfsSnapshot(args []string) error {
+	f, rest, err := parseFlags(args, "ro:")
+	if err != nil {
+		return err
+	}
+	if len(rest) == 0 {
+		return fmt.Errorf("missing snapshot argument")
+	}
+
+	var snaps []string
+	for _, name := range rest {
+		i := strings.IndexByte(name, '@')
+		if i < 0 {
+			return fmt.Errorf("cannot create snapshot '%s': missing '@' delimiter in snapshot name", name)
+		}
+		ds := b.datasets[name[:i]]
+		if ds == nil || (ds.typ != typeFilesystem && ds.typ != typeVolume) {
+			return notFound(name[:i])
+		}
+		targets := []*dataset{ds}
+		if f.has('r') {
+			targets = b.descendants(ds)
+		}
+		for _, d := range targets {
+			if d.typ != typeFilesystem && d.typ != typeVolume {
+				continue
+			}
+			snap := d.name + name[i:]
+			if b.datasets[snap] != nil {
+				return fmt.Errorf("cannot create snapshot '%s': dataset already exists", snap)
+			}
+			snaps = append(snaps, snap)
+		}
+	}
+	props, err := parseProps(rest[0], f['o'])
+	if err != nil {
+		return err
+	}
+
+	for _, name := range snaps {
+		snap := b.newDataset(name, typeSnapshot)
+		snap.volsize = b.datasets[fsName(name)].volsize
+		for k, v := range props {
+			snap.props[k] = v
+		}
+	}
+	return nil
+}
+
+func (b *Backend) zfsClone(args []string) error {
+	f, rest, err := parseFlags(args, "po:")
+	if err != nil {
+		return err
+	}
+	if len(rest) != 2 {
+		return fmt.Errorf("expected a snapshot and a target argument")
+	}
+	src, target := rest[0], rest[1]
+	snap, err := b.lookup(src)
+	if err != nil {
+		return err
+	}
+	if snap.typ != typeSnapshot {
+		return fmt.Errorf("cannot open '%s': operation not applicable to datasets of this type", src)
+	}
+	if poolName(src) != poolName(target) {
+		return fmt.Errorf("cannot create '%s': source and target pools differ", target)
+	}
+	props, err := parseProps(target, f['o'])
+	if err != nil {
+		return err
+	}
+	typ := b.datasets[fsName(src)].typ
+	if typ == typeVolume {
+		props["volsize"] = strconv.FormatUint(snap.volsize, 10)
+	}
+	ds, err := b.createDataset(nil, target, typ, props, f.has('p'))
+	if err != nil {
+		return err
+	}
+	ds.origin = src
+	return nil
+}
+
+func (b *Backend) zfsRename(args []string) error {
+	f, rest, err := parseFlags(args, "prfu")
+	if err != nil {
+		return err
+	}
+	if len(rest) != 2 {
+		return fmt.Errorf("expected a source and a target argument")
+	}
+	from, to := rest[0], rest[1]
+	ds, err := b.lookup(from)
+	if err != nil {
+		return err
+	}
+	if strings.HasPrefix(to, "@") {
+		to = fsName(from) + to
+	}
+	if b.datasets[to] != nil {
+		return fmt.Errorf("cannot rename to '%s': dataset already exists", to)
+	}
+
+	if ds.typ == typeSnapshot {
+		if fsName(to) != fsName(from) || !strings.Contains(to, "@") {
+			return fmt.Errorf("cannot rename to '%s': snapshots must be part of same dataset", to)
+		}
+		targets := []*dataset{ds}
+		if f.has('r') {
+			targets = nil
+			fs := b.datasets[fsName(from)]
+			for _, d := range b.descendants(fs) {
+				if snap := b.datasets[d.name+from[len(fs.name):]]; snap != nil && d.typ != typeSnapshot {
+					targets = append(targets, snap)
+				}
+			}
+		}
+		for _, snap := range targets {
+			b.move(snap.name, fsName(snap.name)+to[len(fsName(to)):])
+		}
+		return nil
+	}
+
+	switch {
+	case parentName(from) == "":
+		return fmt.Errorf("cannot rename to '%s': operation not applicable to pools", to)
+	case poolName(from) != poolName(to):
+		return fmt.Errorf("cannot rename to '%s': datasets must be within same pool", to)
+	case isDescendant(to, from):
+		return fmt.Errorf("cannot rename to '%s': New dataset name cannot be a descendant of current dataset name", to)
+	case strings.ContainsAny(to, "@#"):
+		return fmt.Errorf("cannot rename to '%s': snapshot delimiter '@' is not expected here", to)
+	}
+	if b.datasets[parentName(to)] == nil {
+		if !f.has('p') {
+			return fmt.Errorf("cannot rename to '%s': parent does not exist", to)
+		}
+		if _, err := b.createDataset(nil, parentName(to), typeFilesystem, map[string]string{}, true); err != nil {
+			return err
+		}
+	}
+	for _, d := range b.descendants(ds) {
+		b.move(d.name, to+d.name[len(from):])
+	}
+	return nil
+}
+
+// move renames a single dataset, updating the origin of its clones.
+func (b *Backend) move(from, to string) {
+	ds := b.datasets[from]
+	delete(b.datasets, from)
+	ds.name = to
+	b.datasets[to] = ds
+	for _, d := range b.datasets {
+		if d.origin == from {
+			d.origin = to
+		}
+	}
+}
+
+func (b *Backend) zfsPromote(args []string) error {
+	_, rest, err := parseFlags(args, "")
+	if err != nil {
+		return err
+	}
+	if len(rest) != 1 {
+		return fmt.Errorf("expected exactly one filesystem argument")
+	}
+	clone, err := b.lookup(rest[0])
+	if err != nil {
+		return err
+	}
+	if clone.typ == typeSnapshot || clone.origin == "" {
+		return fmt.Errorf("cannot promote '%s': not a cloned filesystem", clone.name)
+	}
+	origin := b.datasets[clone.origin]
+	fs := b.datasets[fsName(origin.name)]
+
+	// the snapshots up to and including the origin move to the clone
+	var moved []*dataset
+	for _, snap := range b.snapshotsOf(fs.name) {
+		if b.datasets[clone.name+snap.name[len(fs.name):]] != nil {
+			return fmt.Errorf("cannot promote '%s': snapshot name '%s' from origin conflicts with '%s' from target", clone.name, snap.name[len(fs.name)+1:], snap.name[len(fs.name)+1:])
+		}
+		moved = append(moved, snap)
+		if snap == origin {
+			break
+		}
+	}
+	clone.origin = fs.origin
+	for _, snap := range moved {
+		b.move(snap.name, clone.name+snap.name[len(fs.name):])
+	}
+	fs.origin = origin.name
+	return nil
+}
+
+func (b *Backend) zfsRollback(args []string) error {
+	f, rest, err := parseFlags(args, "rRf")
+	if err != nil {
+		return err
+	}
+	if len(rest) != 1 {
+		return fmt.Errorf("expected exactly one snapshot argument")
+	}
+	snap, err := b.lookup(rest[0])
+	if err != nil {
+		return err
+	}
+	if snap.typ != typeSnapshot {
+		return fmt.Errorf("cannot rollback '%s': operation not applicable to datasets of this type", snap.name)
+	}
+
+	var later []*dataset
+	for _, d := range b.sortedDatasets() {
+		if d.name != fsName(d.name) && fsName(d.name) == fsName(snap.name) && d.txg > snap.txg {
+			later = append(later, d)
+		}
+	}
+	if len(later) > 0 && !f.has('r') && !f.has('R') {
+		return fmt.Errorf("cannot rollback to '%s': more recent snapshots or bookmarks exist\n"+
+			"use '-r' to force deletion of the following snapshots and bookmarks:\n%s", snap.name, names(later))
+	}
+	dependents := b.dependents(later)
+	if len(dependents) > 0 && !f.has('R') {
+		return fmt.Errorf("cannot rollback to '%s': clones of previous snapshots exist\n"+
+			"use '-R' to force deletion of the following clones and dependents:\n%s", snap.name, names(dependents))
+	}
+	for _, d := range append(later, dependents...) {
+		if len(d.holds) > 0 {
+			return fmt.Errorf("cannot destroy snapshot %s: dataset is busy", d.name)
+		}
+	}
+	for _, d := range append(later, dependents...) {
+		delete(b.datasets, d.name)
+	}
+	return nil
+}
+
+func (b *Backend) zfsSet(args []string) error {
+	var props [][2]string
+	for len(args) > 0 && strings.Contains(args[0], "=") {
+		k, v, err := splitProp(args[0])
+		if err != nil {
+			return err
+		}
+		props = append(props, [2]string{k, v})
+		args = args[1:]
+	}
+	if len(props) == 0 {
+		return fmt.Errorf("missing property=value argument(s)")
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("missing dataset name(s)")
+	}
+
+	var targets []*dataset
+	for _, name := range args {
+		ds, err := b.lookup(name)
+		if err != nil {
+			return err
+		}
+		for _, p := range props {
+			if err := b.checkSet(ds, p[0], p[1]); err != nil {
+				return err
+			}
+		}
+		targets = append(targets, ds)
+	}
+
+	for _, ds := range targets {
+		for _, p := range props {
+			if p[0] == "volsize" {
+				ds.volsize, _ = parseSize(p[1])
+				continue
+			}
+			ds.props[p[0]] = p[1]
+			if p[0] == "mountpoint" || p[0] == "canmount" || p[0] == "sharenfs" || p[0] == "sharesmb" {
+				b.remount(ds)
+			}
+		}
+	}
+	return nil
+}
+
+// createOnlyProps are the native properties which can only be set when a dataset is created.
+var createOnlyProps = map[string]bool{
+	"encryption": true, "keyformat": true, "pbkdf2iters": true, "volblocksize": true,
+}
+
+// checkSet returns an error if the property k cannot be set to v on ds.
+func (b *Backend) checkSet(ds *dataset, k, v string) error {
+	if err := checkSettable(ds.name, k); err != nil {
+		return err
+	}
+	switch {
+	case createOnlyProps[k]:
+		return fmt.Errorf("cannot set property for '%s': '%s' is readonly", ds.name, k)
+	case ds.typ == typeSnapshot && !isUserProp(k), ds.typ == typeBookmark:
+		return fmt.Errorf("cannot set property for '%s': this property can not be modified for snapshots", ds.name)
+	case !applies(ds, k):
+		return fmt.Errorf("cannot set property for '%s': '%s' does not apply to datasets of this type", ds.name, k)
+	case k == "keylocation" && ds.key == nil:
+		return fmt.Errorf("cannot set property for '%s': 'keylocation' can only be set on encryption roots", ds.name)
+	case k == "volsize":
+		if _, err := parseSize(v); err != nil {
+			return fmt.Errorf("cannot set property for '%s': %v", ds.name, err)
+		}
+	}
+	return nil
+}
+
+// remount updates the mount and share state of ds and its descendants after a change of their mount or share properties.
+func (b *Backend) remount(ds *dataset) {
+	for _, d := range b.descendants(ds) {
+		if d.typ == typeFilesystem {
+			d.mounted = b.mountable(d)
+			d.shared = b.shareable(d)
+		}
+	}
+}
+
+func (b *Backend) zfsGet(inv *invocation, args []string) error {
+	f, rest, err := parseFlags(args, "rHpd:o:s:t:")
+	if err != nil {
+		return err
+	}
+	if len(rest) == 0 {
+		return fmt.Errorf("missing property argument")
+	}
+	fields := []string{"name", "property", "value", "source"}
+	if f.has('o') {
+		fields = strings.Split(f.last('o'), ",")
+	}
+	for _, field := range fields {
+		switch field {
+		case "name", "property", "value", "received", "source":
+		default:
+			return fmt.Errorf("invalid column name '%s'", field)
+		}
+	}
+	var sources map[string]bool
+	if f.has('s') {
+		sources = map[string]bool{}
+		for _, s := range strings.Split(f.last('s'), ",") {
+			switch s {
+			case "local", "default", "inherited", "temporary", "received", "none":
+				sources[s] = true
+			default:
+				return fmt.Errorf("invalid source '%s'", s)
+			}
+		}
+	}
+	types, err := parseTypes(f.last('t'))
+	if err != nil {
+		return err
+	}
+	if types == nil {
+		types, _ = parseTypes("all")
+	}
+	maxDepth, err := parseDepth(f)
+	if err != nil {
+		return err
+	}
+
+	var props []string
+	if rest[0] != "all" {
+		props = strings.Split(rest[0], ",")
+		for _, p := range props {
+			if !validDatasetProp(p) {
+				return fmt.Errorf("bad property list: invalid property '%s'", p)
+			}
+		}
+	}
+	datasets, err := b.collect(rest[1:], types, maxDepth)
+	if err != nil {
+		return err
+	}
+
+	if !f.has('H') {
+		inv.printRow(strings.Split(strings.ToUpper(strings.Join(fields, ",")), ",")...)
+	}
+	for _, ds := range datasets {
+		dsProps := props
+		if dsProps == nil {
+			dsProps = b.allProps(ds)
+		}
+		for _, p := range dsProps {
+			value, source, err := b.display(ds, p, f.has('p'))
+			if err != nil {
+				return err
+			}
+			if sources != nil && !sources[sourceKind(source)] {
+				continue
+			}
+			row := make([]string, len(fields))
+			for i, field := range fields {
+				switch field {
+				case "name":
+					row[i] = ds.name
+				case "property":
+					row[i] = p
+				case "value":
+					row[i] = value
+				case "received":
+					row[i] = "-"
+				case "source":
+					row[i] = source
+				}
+			}
+			inv.printRow(row...)
+		}
+	}
+	return nil
+}
+
+// allProps returns the properties printed for ds by zfs get all: the applicable native properties followed by
+// the user properties set on ds or inherited from its ancestors.
+func (b *Backend) allProps(ds *dataset) []string {
+	var props []string
+	for _, p := range allProps {
+		if applies(ds, p) {
+			props = append(props, p)
+		}
+	}
+	seen := map[string]bool{}
+	var user []string
+	for d := ds; d != nil; d = b.datasets[parentName(d.name)] {
+		for p := range d.props {
+			if isUserProp(p) && !seen[p] {
+				seen[p] = true
+				user = append(user, p)
+			}
+		}
+	}
+	sort.Strings(user)
+	return append(props, user...)
+}
+
+// sourceKind maps a property source to the names accepted by zfs get -s.
+func sourceKind(source string) string {
+	switch {
+	case source == "-":
+		return "none"
+	case strings.HasPrefix(source, "inherited"):
+		return "inherited"
+	}
+	return source
+}
+
+func (b *Backend) zfsInherit(args []string) error {
+	f, rest, err := parseFlags(args, "rS")
+	if err != nil {
+		return err
+	}
+	if len(rest) < 2 {
+		return fmt.Errorf("missing property or dataset argument")
+	}
+	prop := rest[0]
+	_, inheritable := inheritableDefaults[prop]
+	switch {
+	case !validDatasetProp(prop):
+		return fmt.Errorf("invalid property '%s'", prop)
+	case readOnlyProps[prop]:
+		return fmt.Errorf("'%s' property is read-only", prop)
+	case !inheritable && !isUserProp(prop) && prop != "mountpoint":
+		return fmt.Errorf("'%s' property cannot be inherited", prop)
+	}
+
+	for _, name := range rest[1:] {
+		ds, err := b.lookup(name)
+		if err != nil {
+			return err
+		}
+		targets := []*dataset{ds}
+		if f.has('r') {
+			targets = b.descendants(ds)
+		}
+		for _, d := range targets {
+			delete(d.props, prop)
+		}
+		if prop == "mountpoint" || prop == "canmount" {
+			b.remount(ds)
+		}
+	}
+	return nil
+}
+
+func (b *Backend) zfsMount(inv *invocation, args []string) error {
+	f, rest, err := parseFlags(args, "Oaflvo:")
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		// without arguments the mounted filesystems are listed, separated from their mountpoints by spaces
+		for _, ds := range b.sortedDatasets() {
+			if ds.mounted {
+				mountpoint, _, _ := b.mountpoint(ds)
+				inv.printRow(fmt.Sprintf("%-30s  %s", ds.name, mountpoint))
+			}
+		}
+		return nil
+	}
+	if f.has('a') {
+		for _, ds := range b.datasets {
+			if b.mountable(ds) {
+				ds.mounted = true
+			}
+		}
+		return nil
+	}
+	if len(rest) != 1 {
+		return fmt.Errorf("expected exactly one filesystem argument")
+	}
+	ds, err := b.lookup(rest[0])
+	if err != nil {
+		return err
+	}
+	mountpoint, _, _ := b.prop(ds, "mountpoint", true)
+	root := b.encryptionRoot(ds)
+	if root != nil && !root.keyLoaded && f.has('l') && ds.typ == typeFilesystem {
+		key, err := readKey(inv, root.props["keylocation"], root.props["keyformat"])
+		if err != nil {
+			return fmt.Errorf("cannot mount '%s': %v", ds.name, err)
+		}
+		if string(key) != string(root.key) {
+			return fmt.Errorf("cannot mount '%s': Incorrect key provided for '%s'.", ds.name, root.name)
+		}
+		root.keyLoaded = true
+	}
+	switch {
+	case ds.typ != typeFilesystem:
+		return fmt.Errorf("cannot mount '%s': operation not applicable to datasets of this type", ds.name)
+	case ds.mounted:
+		return fmt.Errorf("cannot mount '%s': filesystem already mounted", ds.name)
+	case mountpoint == "none":
+		return fmt.Errorf("cannot mount '%s': no mountpoint set", ds.name)
+	case mountpoint == "legacy":
+		return fmt.Errorf("cannot mount '%s': legacy mountpoint\nuse mount(8) to mount this filesystem", ds.name)
+	case root != nil && !root.keyLoaded:
+		return fmt.Errorf("cannot mount '%s': encryption key not loaded", ds.name)
+	}
+	ds.mounted = true
+	return nil
+}
+
+func (b *Backend) zfsUnmount(args []string) error {
+	f, rest, err := parseFlags(args, "fau")
+	if err != nil {
+		return err
+	}
+	if f.has('a') {
+		for _, ds := range b.datasets {
+			ds.mounted, ds.shared = false, false
+		}
+		return nil
+	}
+	if len(rest) != 1 {
+		return fmt.Errorf("expected exactly one filesystem argument")
+	}
+	ds, err := b.lookup(rest[0])
+	if err != nil {
+		return err
+	}
+	if !ds.mounted {
+		return fmt.Errorf("cannot unmount '%s': not currently mounted", ds.name)
+	}
+	for _, d := range b.descendants(ds) {
+		d.mounted, d.shared = false, false
+	}
+	return nil
+}
+
+// shareable reports whether a filesystem is shared by zfs share -a.
+func (b *Backend) shareable(ds *dataset) bool {
+	nfs, _, _ := b.prop(ds, "sharenfs", true)
+	smb, _, _ := b.prop(ds, "sharesmb", true)
+	return ds.mounted && (nfs != "off" || smb != "off")
+}
+
+func (b *Backend) zfsShare(args []string) error {
+	f, rest, err := parseFlags(args, "al")
+	if err != nil {
+		return err
+	}
+	if f.has('a') {
+		for _, ds := range b.datasets {
+			if b.shareable(ds) {
+				ds.shared = true
+			}
+		}
+		return nil
+	}
+	if len(rest) != 1 {
+		return fmt.Errorf("expected exactly one filesystem argument")
+	}
+	ds, err := b.lookup(rest[0])
+	if err != nil {
+		return err
+	}
+	switch {
+	case ds.typ != typeFilesystem:
+		return fmt.Errorf("cannot share '%s': operation not applicable to datasets of this type", ds.name)
+	case !ds.mounted:
+		return fmt.Errorf("cannot share '%s': filesystem is not mounted", ds.name)
+	case !b.shareable(ds):
+		return fmt.Errorf("cannot share '%s': 'sharenfs' and 'sharesmb' are both off", ds.name)
+	case ds.shared:
+		return fmt.Errorf("cannot share '%s': filesystem already shared", ds.name)
+	}
+	ds.shared = true
+	return nil
+}
+
+func (b *Backend) zfsUnshare(args []string) error {
+	f, rest, err := parseFlags(args, "a")
+	if err != nil {
+		return err
+	}
+	if f.has('a') {
+		for _, ds := range b.datasets {
+			ds.shared = false
+		}
+		return nil
+	}
+	if len(rest) != 1 {
+		return fmt.Errorf("expected exactly one filesystem argument")
+	}
+	ds, err := b.lookup(rest[0])
+	if err != nil {
+		return err
+	}
+	if !ds.shared {
+		return fmt.Errorf("cannot unshare '%s': not currently shared", ds.name)
+	}
+	ds.shared = false
+	return nil
+}
+
+func (b *Backend) zfsBookmark(args []string) error {
+	_, rest, err := parseFlags(args, "")
+	if err != nil {
+		return err
+	}
+	if len(rest) != 2 {
+		return fmt.Errorf("expected a source and a bookmark argument")
+	}
+	src, err := b.lookup(rest[0])
+	if err != nil {
+		return err
+	}
+	name := rest[1]
+	if strings.HasPrefix(name, "#") {
+		name = fsName(src.name) + name
+	}
+	switch {
+	case src.typ != typeSnapshot && src.typ != typeBookmark:
+		return fmt.Errorf("cannot create bookmark '%s': source must be a snapshot or bookmark", name)
+	case !strings.Contains(name, "#"):
+		return fmt.Errorf("cannot create bookmark '%s': invalid bookmark name", name)
+	case fsName(name) != fsName(src.name):
+		return fmt.Errorf("cannot create bookmark '%s': must be in the same filesystem as the source", name)
+	case b.datasets[name] != nil:
+		return fmt.Errorf("cannot create bookmark '%s': bookmark exists", name)
+	}
+	bm := b.newDataset(name, typeBookmark)
+	// bookmarks share the identity of their snapshot
+	bm.txg, bm.guid, bm.origin = src.txg, src.guid, src.name
+	if src.typ == typeBookmark {
+		bm.origin = src.origin
+	}
+	return nil
+}
+
+func (b *Backend) zfsRedact(args []string) error {
+	_, rest, err := parseFlags(args, "")
+	if err != nil {
+		return err
+	}
+	if len(rest) < 3 {
+		return fmt.Errorf("expected a snapshot, a bookmark and at least one redaction snapshot argument")
+	}
+	snap, err := b.lookup(rest[0])
+	if err != nil {
+		return err
+	}
+	name := fsName(snap.name) + "#" + rest[1]
+	switch {
+	case snap.typ != typeSnapshot:
+		return fmt.Errorf("cannot redact '%s': operation not applicable to datasets of this type", snap.name)
+	case strings.ContainsAny(rest[1], "@#/"):
+		return fmt.Errorf("cannot redact '%s': invalid bookmark name '%s'", snap.name, rest[1])
+	case b.datasets[name] != nil:
+		return fmt.Errorf("cannot redact '%s': bookmark '%s' exists", snap.name, name)
+	}
+	for _, r := range rest[2:] {
+		rs, err := b.lookup(r)
+		if err != nil {
+			return err
+		}
+		if rs.typ != typeSnapshot || !b.descendsFrom(b.datasets[fsName(rs.name)], snap) {
+			return fmt.Errorf("cannot redact '%s': redaction snapshot '%s' is not a snapshot of a clone of it", snap.name, r)
+		}
+	}
+	bm := b.newDataset(name, typeBookmark)
+	bm.txg, bm.guid, bm.origin = snap.txg, snap.guid, snap.name
+	bm.redactionSnaps = append([]string(nil), rest[2:]...)
+	return nil
+}
+
+// descendsFrom reports whether fs is a clone of snap, directly or through clones of its snapshots.
+func (b *Backend) descendsFrom(fs, snap *dataset) bool {
+	for fs != nil && fs.origin != "" {
+		if fs.origin == snap.name {
+			return true
+		}
+		fs = b.datasets[fsName(fs.origin)]
+	}
+	return false
+}
+
+// heldSnapshots resolves the snapshots affected by zfs hold, release and holds.
+func (b *Backend) heldSnapshots(name string, recursive bool) ([]*dataset, error) {
+	snap, err := b.lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	if snap.typ != typeSnapshot {
+		return nil, fmt.Errorf("cannot hold '%s': operation not applicable to datasets of this type", name)
+	}
+	if !recursive {
+		return []*dataset{snap}, nil
+	}
+	fs := b.datasets[fsName(name)]
+	var snaps []*dataset
+	for _, d := range b.descendants(fs) {
+		if s := b.datasets[d.name+name[len(fs.name):]]; s != nil && d.typ != typeSnapshot {
+			snaps = append(snaps, s)
+		}
+	}
+	return snaps, nil
+}
+
+func (b *Backend) zfsHold(args []string) error {
+	f, rest, err := parseFlags(args, "r")
+	if err != nil {
+		return err
+	}
+	if len(rest) < 2 {
+		return fmt.Errorf("missing tag or snapshot argument")
+	}
+	tag := rest[0]
+	var snaps []*dataset
+	for _, name := range rest[1:] {
+		s, err := b.heldSnapshots(name, f.has('r'))
+		if err != nil {
+			return err
+		}
+		for _, snap := range s {
+			if _, ok := snap.holds[tag]; ok {
+				return fmt.Errorf("cannot hold snapshot '%s': tag already exists on this dataset", snap.name)
+			}
+		}
+		snaps = append(snaps, s...)
+	}
+	txg := b.nextTxg()
+	for _, snap := range snaps {
+		snap.holds[tag] = txg
+	}
+	return nil
+}
+
+func (b *Backend) zfsRelease(args []string) error {
+	f, rest, err := parseFlags(args, "r")
+	if err != nil {
+		return err
+	}
+	if len(rest) < 2 {
+		return fmt.Errorf("missing tag or snapshot argument")
+	}
+	tag := rest[0]
+	var snaps []*dataset
+	for _, name := range rest[1:] {
+		s, err := b.heldSnapshots(name, f.has('r'))
+		if err != nil {
+			return err
+		}
+		for _, snap := range s {
+			if _, ok := snap.holds[tag]; !ok {
+				return fmt.Errorf("cannot release hold from snapshot '%s': no such tag on this dataset", snap.name)
+			}
+		}
+		snaps = append(snaps, s...)
+	}
+	for _, snap := range snaps {
+		delete(snap.holds, tag)
+		if len(snap.holds) == 0 && snap.deferDestroy {
+			delete(b.datasets, snap.name)
+		}
+	}
+	return nil
+}
+
+func (b *Backend) zfsHolds(inv *invocation, args []string) error {
+	f, rest, err := parseFlags(args, "rHp")
+	if err != nil {
+		return err
+	}
+	if len(rest) == 0 {
+		return fmt.Errorf("missing snapshot argument")
+	}
+	if !f.has('H') {
+		inv.printRow("NAME", "TAG", "TIMESTAMP")
+	}
+	for _, name := range rest {
+		snaps, err := b.heldSnapshots(name, f.has('r'))
+		if err != nil {
+			return err
+		}
+		for _, snap := range snaps {
+			tags := make([]string, 0, len(snap.holds))
+			for tag := range snap.holds {
+				tags = append(tags, tag)
+			}
+			sort.Strings(tags)
+			for _, tag := range tags {
+				t := txgTime(snap.holds[tag])
+				ts := t.Local().Format(creationTimeLayout)
+				if f.has('p') {
+					ts = strconv.FormatInt(t.Unix(), 10)
+				}
+				inv.printRow(snap.name, tag, ts)
+			}
+		}
+	}
+	return nil
+}
+
+// zfsDiff validates its arguments, but always reports no changes since the backend stores no file data.
+func (b *Backend) zfsDiff(args []string) error {
+	_, rest, err := parseFlags(args, "FHth")
+	if err != nil {
+		return err
+	}
+	if len(rest) < 1 || len(rest) > 2 {
+		return fmt.Errorf("expected a snapshot and an optional target argument")
+	}
+	snap, err := b.lookup(rest[0])
+	if err != nil {
+		return err
+	}
+	if snap.typ != typeSnapshot {
+		return fmt.Errorf("cannot diff '%s': operation not applicable to datasets of this type", snap.name)
+	}
+	if len(rest) == 2 {
+		if _, err := b.lookup(rest[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *Backend) zfsLoadKey(inv *invocation, args []string) error {
+	f, rest, err := parseFlags(args, "anrL:")
+	if err != nil {
+		return err
+	}
+	roots, err := b.encryptionRoots(rest, f.has('a'), f.has('r'))
+	if err != nil {
+		return fmt.Errorf("Key load error: %v", err)
+	}
+	for _, root := range roots {
+		if root.keyLoaded {
+			if f.has('a') || f.has('r') {
+				continue
+			}
+			return fmt.Errorf("Key load error: Key already loaded for '%s'.", root.name)
+		}
+		location := root.props["keylocation"]
+		if f.has('L') {
+			location = f.last('L')
+		}
+		key, err := readKey(inv, location, root.props["keyformat"])
+		if err != nil {
+			return fmt.Errorf("Key load error: %v", err)
+		}
+		if string(key) != string(root.key) {
+			return fmt.Errorf("Key load error: Incorrect key provided for '%s'.", root.name)
+		}
+		if !f.has('n') {
+			root.keyLoaded = true
+		}
+	}
+	return nil
+}
+
+func (b *Backend) zfsUnloadKey(args []string) error {
+	f, rest, err := parseFlags(args, "ar")
+	if err != nil {
+		return err
+	}
+	roots, err := b.encryptionRoots(rest, f.has('a'), f.has('r'))
+	if err != nil {
+		return fmt.Errorf("Key unload error: %v", err)
+	}
+	for _, root := range roots {
+		if !root.keyLoaded {
+			if f.has('a') || f.has('r') {
+				continue
+			}
+			return fmt.Errorf("Key unload error: Key already unloaded for '%s'.", root.name)
+		}
+		for _, d := range b.descendants(root) {
+			if d.mounted && b.encryptionRoot(d) == root {
+				return fmt.Errorf("Key unload error: '%s' is busy.", root.name)
+			}
+		}
+		root.keyLoaded = false
+	}
+	return nil
+}
+
+// encryptionRoots resolves the datasets affected by load-key and unload-key.
+func (b *Backend) encryptionRoots(names []string, all, recursive bool) ([]*dataset, error) {
+	if all {
+		var roots []*dataset
+		for _, d := range b.sortedDatasets() {
+			if d.key != nil {
+				roots = append(roots, d)
+			}
+		}
+		return roots, nil
+	}
+	if len(names) != 1 {
+		return nil, fmt.Errorf("expected exactly one dataset argument")
+	}
+	ds, err := b.lookup(names[0])
+	if err != nil {
+		return nil, err
+	}
+	if !recursive {
+		if ds.key == nil {
+			return nil, fmt.Errorf("'%s' is not an encryption root", ds.name)
+		}
+		return []*dataset{ds}, nil
+	}
+	var roots []*dataset
+	for _, d := range b.descendants(ds) {
+		if d.key != nil {
+			roots = append(roots, d)
+		}
+	}
+	return roots, nil
+}
+
+func (b *Backend) zfsChangeKey(inv *invocation, args []string) error {
+	f, rest, err := parseFlags(args, "lio:")
+	if err != nil {
+		return err
+	}
+	if len(rest) != 1 {
+		return fmt.Errorf("expected exactly one dataset argument")
+	}
+	ds, err := b.lookup(rest[0])
+	if err != nil {
+		return err
+	}
+	root := b.encryptionRoot(ds)
+	if root == nil {
+		return fmt.Errorf("Key change error: Dataset not encrypted.")
+	}
+	if f.has('l') && !root.keyLoaded {
+		location := root.props["keylocation"]
+		key, err := readKey(inv, location, root.props["keyformat"])
+		if err != nil || string(key) != string(root.key) {
+			return fmt.Errorf("Key load error: Incorrect key provided for '%s'.", root.name)
+		}
+		root.keyLoaded = true
+	}
+	if !root.keyLoaded {
+		return fmt.Errorf("Key change error: Key must be loaded.")
+	}
+
+	if f.has('i') {
+		if ds.key == nil {
+			return fmt.Errorf("Key change error: Dataset is not an encryption root.")
+		}
+		parent := b.datasets[parentName(ds.name)]
+		if parent == nil || b.encryptionRoot(parent) == nil {
+			return fmt.Errorf("Key change error: Root dataset cannot inherit key.")
+		}
+		ds.key, ds.keyLoaded = nil, false
+		delete(ds.props, "keyformat")
+		delete(ds.props, "keylocation")
+		delete(ds.props, "pbkdf2iters")
+		return nil
+	}
+
+	props := map[string]string{}
+	for _, o := range f['o'] {
+		k, v, err := splitProp(o)
+		if err != nil {
+			return err
+		}
+		switch k {
+		case "keyformat", "keylocation", "pbkdf2iters":
+			props[k] = v
+		default:
+			return fmt.Errorf("Key change error: invalid property '%s'", k)
+		}
+	}
+	format, location := props["keyformat"], props["keylocation"]
+	if format == "" {
+		format = root.props["keyformat"]
+	}
+	if location == "" {
+		location = root.props["keylocation"]
+		if ds.key == nil {
+			location = "prompt"
+		}
+	}
+	key, err := readKey(inv, location, format)
+	if err != nil {
+		return fmt.Errorf("Key change error: %v", err)
+	}
+	if ds.key == nil {
+		// ds becomes a new encryption root
+		ds.props["encryption"] = root.props["encryption"]
+	}
+	for k, v := range props {
+		ds.props[k] = v
+	}
+	ds.props["keyformat"], ds.props["keylocation"] = format, location
+	ds.key, ds.keyLoaded = key, true
+	return nil
+}
+
+func (b *Backend) zfsWait(args []string) error {
+	f, rest, err := parseFlags(args, "t:")
+	if err != nil {
+		return err
+	}
+	for _, t := range f['t'] {
+		if t != "deleteq" {
+			return fmt.Errorf("invalid activity '%s'", t)
+		}
+	}
+	if len(rest) != 1 {
+		return fmt.Errorf("missing 'filesystem' argument")
+	}
+	ds, err := b.lookup(rest[0])
+	if err != nil {
+		return err
+	}
+	if ds.typ != typeFilesystem {
+		return fmt.Errorf("cannot wait: '%s' is not a filesystem", ds.name)
+	}
+	// files are never held open, so the delete queue is always empty
+	return nil
+}
@@ -0,0 +1,544 @@
+package zfstest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// streamMagic is the first line of the placeholder streams written by zfs send.
+//
+// The stream is a line based description of the sent datasets:
+//
+//	zfstest stream	<name of the sent filesystem>
+//	fs	<relative name>	<type>	<volsize>
+//	enc	<relative name>	<encryption>	<keyformat>	<pbkdf2iters>	<hex encoded key>
+//	redacted	<relative name>
+//	prop	<relative name>	<property>	<value>
+//	snap	<relative name>	<snapshot name>	<incremental source snapshot name, or ->	<guid>
+//	end
+//
+// A stream which was cut short lacks the end line, and its last complete snap record is considered interrupted.
+const streamMagic = "zfstest stream"
+
+type streamFS struct {
+	rel      string
+	typ      string
+	volsize  uint64
+	props    map[string]string
+	enc      *streamEnc // set for encryption roots in raw streams
+	redacted bool       // set for redacted streams
+}
+
+type streamEnc struct {
+	encryption, keyformat, pbkdf2iters string
+	key                                []byte
+}
+
+// encryptionProps are the properties of encryption roots which raw streams carry in enc records.
+var encryptionProps = map[string]bool{"encryption": true, "keyformat": true, "keylocation": true, "pbkdf2iters": true}
+
+type streamSnap struct {
+	rel, name, from string
+	guid            uint64
+}
+
+type stream struct {
+	source   string
+	fss      map[string]*streamFS
+	snaps    []streamSnap
+	complete bool
+}
+
+func (b *Backend) zfsSend(inv *invocation, args []string) error {
+	args = append([]string(nil), args...)
+	for i, arg := range args {
+		if arg == "--redact" {
+			args[i] = "-d"
+		}
+	}
+	f, rest, err := parseFlags(args, "DLPRbcehnpvwd:i:I:t:")
+	if err != nil {
+		return err
+	}
+	if f.has('t') {
+		snap, from, err := decodeToken(f.last('t'))
+		if err != nil {
+			return err
+		}
+		rest = []string{snap}
+		if from != "" {
+			f['i'] = []string{from}
+		}
+	}
+	if len(rest) != 1 {
+		return fmt.Errorf("expected exactly one snapshot argument")
+	}
+	snap, err := b.lookup(rest[0])
+	if err != nil {
+		return err
+	}
+	if snap.typ != typeSnapshot {
+		return fmt.Errorf("cannot send '%s': operation not applicable to datasets of this type", snap.name)
+	}
+
+	top := fsName(snap.name)
+	snapName := snap.name[len(top)+1:]
+	from, intermediary := f.last('i'), false
+	if f.has('I') {
+		from, intermediary = f.last('I'), true
+	}
+	var fromName string
+	if from != "" {
+		if strings.HasPrefix(from, "@") || strings.HasPrefix(from, "#") {
+			from = top + from
+		}
+		fromDs, err := b.lookup(from)
+		if err != nil {
+			return err
+		}
+		if fsName(from) != top {
+			return fmt.Errorf("cannot send '%s': incremental source must be in same filesystem", snap.name)
+		}
+		if fromDs.txg >= snap.txg {
+			return fmt.Errorf("cannot send '%s': incremental source %s is not earlier than it", snap.name, from)
+		}
+		fromName = from[len(top):]
+	}
+
+	if f.has('d') {
+		name := f.last('d')
+		if strings.HasPrefix(name, "#") {
+			name = top + name
+		}
+		bm, err := b.lookup(name)
+		if err != nil {
+			return err
+		}
+		switch {
+		case f.has('R'):
+			return fmt.Errorf("cannot send '%s': redacted sends cannot be replication streams", snap.name)
+		case bm.typ != typeBookmark || bm.redactionSnaps == nil || bm.origin != snap.name:
+			return fmt.Errorf("cannot send '%s': '%s' is not a redaction bookmark of it", snap.name, name)
+		}
+	}
+
+	fss := []*dataset{b.datasets[top]}
+	if f.has('R') {
+		fss = nil
+		for _, d := range b.descendants(b.datasets[top]) {
+			if d.name == fsName(d.name) && b.datasets[d.name+"@"+snapName] != nil {
+				fss = append(fss, d)
+			}
+		}
+	}
+
+	var out bytes.Buffer
+	var estimate [][]string
+	fmt.Fprintf(&out, "%s\t%s\n", streamMagic, top)
+	for _, fs := range fss {
+		rel := fs.name[len(top):]
+		root := b.encryptionRoot(fs)
+		switch {
+		case root == nil || f.has('w'):
+		case f.has('R') || f.has('p'):
+			return fmt.Errorf("cannot send %s: encrypted dataset %s may not be sent with properties without the raw flag",
+				snap.name, fs.name)
+		case !root.keyLoaded:
+			return fmt.Errorf("cannot send %s: encryption key of %s is not loaded", snap.name, root.name)
+		}
+		fmt.Fprintf(&out, "fs\t%s\t%s\t%d\n", rel, fs.typ, fs.volsize)
+		if f.has('d') {
+			fmt.Fprintf(&out, "redacted\t%s\n", rel)
+		}
+		if root != nil && f.has('w') && (root == fs || rel == "") {
+			// a raw stream carries the wrapped key of each encryption root, the sent dataset becomes one when received
+			enc := make([]string, 3)
+			for i, name := range []string{"encryption", "keyformat", "pbkdf2iters"} {
+				enc[i], _, _ = b.encryptionProp(root, name)
+			}
+			fmt.Fprintf(&out, "enc\t%s\t%s\t%s\n", rel, strings.Join(enc, "\t"), hex.EncodeToString(root.key))
+		}
+		if f.has('R') || f.has('p') {
+			for _, k := range sortedKeys(fs.props) {
+				if !encryptionProps[k] {
+					fmt.Fprintf(&out, "prop\t%s\t%s\t%s\n", rel, k, fs.props[k])
+				}
+			}
+		}
+		target := b.datasets[fs.name+"@"+snapName]
+		var base *dataset
+		prev := "-"
+		if fromName != "" {
+			if base = b.datasets[fs.name+fromName]; base != nil {
+				prev = base.name[len(fs.name)+1:]
+				if base.typ == typeBookmark {
+					prev = base.origin[len(fs.name)+1:]
+				}
+			}
+		}
+		for _, s := range b.snapshotsOf(fs.name) {
+			switch {
+			case s.txg > target.txg:
+				continue
+			case s != target && base == nil && !f.has('R'):
+				continue
+			case s != target && base != nil && (!intermediary || s.txg <= base.txg):
+				continue
+			}
+			name := s.name[len(fs.name)+1:]
+			n, _ := fmt.Fprintf(&out, "snap\t%s\t%s\t%s\t%d\n", rel, name, prev, s.guid)
+			if prev == "-" {
+				estimate = append(estimate, []string{"full", s.name, strconv.Itoa(n)})
+			} else {
+				estimate = append(estimate, []string{"incremental", fs.name + "@" + prev, s.name, strconv.Itoa(n)})
+			}
+			prev = name
+		}
+	}
+	out.WriteString("end\n")
+
+	if f.has('n') {
+		// a dry run prints the size of each snapshot record and of the whole placeholder stream as its estimate
+		if f.has('v') && f.has('P') {
+			for _, row := range append(estimate, []string{"size", strconv.Itoa(out.Len())}) {
+				inv.printRow(row...)
+			}
+		}
+		return nil
+	}
+	if inv.stdout == nil {
+		return nil
+	}
+	_, err = inv.stdout.Write(out.Bytes())
+	return err
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// encodeToken returns the resume token of an interrupted receive of snap, incremental from from if not empty.
+func encodeToken(snap, from string) string {
+	return "1-" + hex.EncodeToString([]byte(snap+"\n"+from))
+}
+
+func decodeToken(token string) (string, string, error) {
+	raw, err := hex.DecodeString(strings.TrimPrefix(token, "1-"))
+	parts := strings.Split(string(raw), "\n")
+	if err != nil || !strings.HasPrefix(token, "1-") || len(parts) != 2 {
+		return "", "", fmt.Errorf("cannot resume send: invalid token")
+	}
+	return parts[0], parts[1], nil
+}
+
+func parseStream(data []byte) (*stream, error) {
+	s := &stream{fss: map[string]*streamFS{}}
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	var lines []string
+	for sc.Scan() {
+		lines = append(lines, sc.Text())
+	}
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		// drop a partial last line
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 || !strings.HasPrefix(lines[0], streamMagic+"\t") {
+		return nil, fmt.Errorf("cannot receive: invalid stream (bad magic number)")
+	}
+	s.source = strings.TrimPrefix(lines[0], streamMagic+"\t")
+
+	for _, line := range lines[1:] {
+		fields := strings.Split(line, "\t")
+		switch {
+		case fields[0] == "end" && len(fields) == 1:
+			s.complete = true
+		case fields[0] == "fs" && len(fields) == 4:
+			size, _ := strconv.ParseUint(fields[3], 10, 64)
+			s.fss[fields[1]] = &streamFS{rel: fields[1], typ: fields[2], volsize: size, props: map[string]string{}}
+		case fields[0] == "enc" && len(fields) == 6 && s.fss[fields[1]] != nil:
+			key, err := hex.DecodeString(fields[5])
+			if err != nil {
+				return nil, fmt.Errorf("cannot receive: invalid stream (malformed record)")
+			}
+			s.fss[fields[1]].enc = &streamEnc{encryption: fields[2], keyformat: fields[3], pbkdf2iters: fields[4], key: key}
+		case fields[0] == "redacted" && len(fields) == 2 && s.fss[fields[1]] != nil:
+			s.fss[fields[1]].redacted = true
+		case fields[0] == "prop" && len(fields) == 4 && s.fss[fields[1]] != nil:
+			s.fss[fields[1]].props[fields[2]] = fields[3]
+		case fields[0] == "snap" && len(fields) == 5 && s.fss[fields[1]] != nil:
+			guid, _ := strconv.ParseUint(fields[4], 10, 64)
+			s.snaps = append(s.snaps, streamSnap{rel: fields[1], name: fields[2], from: fields[3], guid: guid})
+		default:
+			return nil, fmt.Errorf("cannot receive: invalid stream (malformed record)")
+		}
+	}
+	return s, nil
+}
+
+func (b *Backend) zfsReceive(inv *invocation, args []string) error {
+	f, rest, err := parseFlags(args, "AFdehnsuvo:x:")
+	if err != nil {
+		return err
+	}
+	if len(rest) != 1 {
+		return fmt.Errorf("expected exactly one target argument")
+	}
+	target := rest[0]
+
+	if f.has('A') {
+		ds, err := b.lookup(target)
+		if err != nil {
+			return err
+		}
+		if ds.resumeToken == "" {
+			return fmt.Errorf("'%s' does not have any resumable receive state to abort", target)
+		}
+		if ds.partial {
+			delete(b.datasets, ds.name)
+		}
+		ds.resumeToken, ds.partial = "", false
+		return nil
+	}
+
+	if inv.stdin == nil {
+		return fmt.Errorf("cannot receive: failed to read from stream")
+	}
+	data, err := ioutil.ReadAll(inv.stdin)
+	if err != nil {
+		return fmt.Errorf("cannot receive: failed to read from stream")
+	}
+	s, err := parseStream(data)
+	if err != nil {
+		return err
+	}
+	overrides, err := parseProps(target, f['o'])
+	if err != nil {
+		return err
+	}
+
+	topFs, snapName := target, ""
+	if i := strings.IndexByte(target, '@'); i >= 0 {
+		if len(s.snaps) != 1 {
+			return fmt.Errorf("cannot receive: cannot specify snapshot name for multi-snapshot stream")
+		}
+		topFs, snapName = target[:i], target[i+1:]
+	}
+	switch {
+	case f.has('d'):
+		if i := strings.IndexByte(s.source, '/'); i >= 0 {
+			topFs = target + s.source[i:]
+		}
+	case f.has('e'):
+		topFs = target + "/" + s.source[strings.LastIndexByte(s.source, '/')+1:]
+	}
+
+	snaps := s.snaps
+	var interrupted *streamSnap
+	if !s.complete {
+		if !f.has('s') || len(snaps) == 0 {
+			return fmt.Errorf("cannot receive: failed to read from stream")
+		}
+		interrupted = &snaps[len(snaps)-1]
+		snaps = snaps[:len(snaps)-1]
+	}
+	if f.has('n') {
+		return nil
+	}
+
+	for _, rec := range snaps {
+		fsTarget := topFs + rec.rel
+		name := rec.name
+		if snapName != "" {
+			name = snapName
+		}
+		if f.has('v') {
+			kind := "full"
+			if rec.from != "-" {
+				kind = "incremental"
+			}
+			inv.printRow(fmt.Sprintf("receiving %s stream of %s%s@%s into %s@%s",
+				kind, s.source, rec.rel, rec.name, fsTarget, name))
+		}
+		fs, err := b.receiveTarget(s.fss[rec.rel], fsTarget, rec.from, f.has('F'))
+		if err != nil {
+			return err
+		}
+		if fs.resumeToken != "" || fs.partial {
+			fs.resumeToken, fs.partial = "", false
+		}
+		if rec.rel == "" {
+			for k, v := range overrides {
+				fs.props[k] = v
+			}
+			for _, k := range f['x'] {
+				delete(fs.props, k)
+			}
+		}
+		if b.datasets[fsTarget+"@"+name] != nil {
+			return fmt.Errorf("cannot restore to %s@%s: destination already exists", fsTarget, name)
+		}
+		snap := b.newDataset(fsTarget+"@"+name, typeSnapshot)
+		// received snapshots keep the guid of their source, which identifies common snapshots
+		snap.volsize, snap.guid = fs.volsize, rec.guid
+		if !f.has('u') && !fs.mounted {
+			fs.mounted = b.mountable(fs)
+		}
+	}
+
+	if interrupted != nil {
+		fsTarget := topFs + interrupted.rel
+		fs := b.datasets[fsTarget]
+		if fs == nil {
+			if interrupted.from != "-" {
+				return fmt.Errorf("cannot receive incremental stream: destination '%s' does not exist", fsTarget)
+			}
+			if fs, err = b.createDataset(nil, fsTarget, s.fss[interrupted.rel].typ, map[string]string{}, false); err != nil {
+				return err
+			}
+			fs.partial, fs.mounted = true, false
+		}
+		source := s.source + interrupted.rel
+		from := ""
+		if interrupted.from != "-" {
+			from = source + "@" + interrupted.from
+		}
+		fs.resumeToken = encodeToken(source+"@"+interrupted.name, from)
+		return fmt.Errorf("cannot receive: failed to read from stream")
+	}
+	return nil
+}
+
+// receiveTarget returns the filesystem into which a snapshot of a stream is received, creating it for full streams.
+// Incremental streams require the destination's most recent snapshot to be the incremental source,
+// unless force is set, in which case later snapshots are destroyed.
+func (b *Backend) receiveTarget(sfs *streamFS, name, from string, force bool) (*dataset, error) {
+	fs := b.datasets[name]
+	if from == "-" {
+		if fs != nil && !fs.partial {
+			if !force {
+				return nil, fmt.Errorf("cannot receive new filesystem stream: destination '%s' exists\n"+
+					"must specify -F to overwrite it", name)
+			}
+			if snaps := b.snapshotsOf(name); len(snaps) > 0 {
+				return nil, fmt.Errorf("cannot receive new filesystem stream: destination has snapshots (eg. %s)\n"+
+					"must destroy them to overwrite it", snaps[0].name)
+			}
+		}
+		if fs == nil {
+			if b.datasets[parentName(name)] == nil {
+				return nil, notFound(parentName(name))
+			}
+			var err error
+			if fs, err = b.createDataset(nil, name, sfs.typ, map[string]string{}, false); err != nil {
+				return nil, err
+			}
+			// mounted once received, unless -u is given
+			fs.mounted = false
+		}
+		fs.volsize = sfs.volsize
+		for k, v := range sfs.props {
+			fs.props[k] = v
+		}
+		if sfs.redacted {
+			fs.redacted = true
+		}
+		if e := sfs.enc; e != nil {
+			// raw streams are received without loading the key
+			fs.props["encryption"], fs.props["keyformat"], fs.props["pbkdf2iters"] = e.encryption, e.keyformat, e.pbkdf2iters
+			fs.props["keylocation"] = "prompt"
+			fs.key, fs.keyLoaded = e.key, false
+		}
+		return fs, nil
+	}
+
+	if fs == nil {
+		return nil, fmt.Errorf("cannot receive incremental stream: destination '%s' does not exist", name)
+	}
+	if e := sfs.enc; e != nil {
+		root := b.encryptionRoot(fs)
+		if root == nil {
+			return nil, fmt.Errorf("cannot receive incremental stream: raw encrypted stream into unencrypted '%s'", name)
+		}
+		if !bytes.Equal(root.key, e.key) {
+			return nil, fmt.Errorf("cannot receive incremental stream: encryption key of '%s' does not match the stream", name)
+		}
+	}
+	base := b.datasets[name+"@"+from]
+	if base == nil {
+		return nil, fmt.Errorf("cannot receive incremental stream: most recent snapshot of %s does not\n"+
+			"match incremental source", name)
+	}
+	var later []*dataset
+	for _, s := range b.snapshotsOf(name) {
+		if s.txg > base.txg {
+			later = append(later, s)
+		}
+	}
+	if len(later) > 0 {
+		if !force {
+			return nil, fmt.Errorf("cannot receive incremental stream: destination %s has been modified\n"+
+				"since most recent snapshot", name)
+		}
+		for _, s := range later {
+			if len(s.holds) > 0 || len(b.dependents([]*dataset{s})) > 0 {
+				return nil, fmt.Errorf("cannot destroy snapshot %s: dataset is busy", s.name)
+			}
+		}
+		for _, s := range later {
+			delete(b.datasets, s.name)
+		}
+	}
+	for k, v := range sfs.props {
+		fs.props[k] = v
+	}
+	return fs, nil
+}
+
+// readKey reads an encryption key from keylocation, which is either prompt for stdin or a file:// URI.
+func readKey(inv *invocation, location, format string) ([]byte, error) {
+	var key []byte
+	var err error
+	switch {
+	case location == "prompt":
+		if inv == nil || inv.stdin == nil {
+			return nil, fmt.Errorf("Failed to read key from stdin")
+		}
+		key, err = ioutil.ReadAll(inv.stdin)
+	case strings.HasPrefix(location, "file://"):
+		key, err = ioutil.ReadFile(strings.TrimPrefix(location, "file://"))
+	default:
+		return nil, fmt.Errorf("Invalid keylocation '%s'", location)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read key: %v", err)
+	}
+	if format != "raw" {
+		key = bytes.TrimSuffix(key, []byte("\n"))
+	}
+	switch format {
+	case "passphrase":
+		if len(key) < 8 {
+			return nil, fmt.Errorf("Passphrase too short (min 8).")
+		}
+	case "hex":
+		if _, err := hex.DecodeString(string(key)); err != nil || len(key) != 64 {
+			return nil, fmt.Errorf("Key incorrect length (expected 64 hex characters).")
+		}
+	case "raw":
+		if len(key) != 32 {
+			return nil, fmt.Errorf("Raw key too short (expected 32).")
+		}
+	}
+	return key, nil
+}
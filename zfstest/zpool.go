@@ -0,0 +1,950 @@
+package zfstest
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// zpool emulates a zpool subcommand.
+func (b *Backend) zpool(inv *invocation, cmd string, args []string) error {
+	switch cmd {
+	case "create":
+		return b.zpoolCreate(inv, args)
+	case "destroy":
+		return b.zpoolDestroy(args)
+	case "list":
+		return b.zpoolList(inv, args)
+	case "get":
+		return b.zpoolGet(inv, args)
+	case "set":
+		return b.zpoolSet(args)
+	case "status":
+		return b.zpoolStatus(inv, args)
+	case "scrub":
+		return b.zpoolScrub(args)
+	case "upgrade":
+		return b.zpoolUpgrade(inv, args)
+	case "reguid":
+		return b.zpoolReguid(args)
+	case "reopen":
+		return b.zpoolReopen(args)
+	case "sync":
+		_, err := b.selectPools(args)
+		return err
+	case "resilver":
+		if len(args) == 0 {
+			return fmt.Errorf("missing pool name argument")
+		}
+		// resilvers of the fake pools finish immediately, like their scrubs
+		_, err := b.selectPools(args)
+		return err
+	case "wait":
+		return b.zpoolWait(args)
+	}
+	return fmt.Errorf("unrecognized command '%s'", cmd)
+}
+
+// poolDefaults are the settable pool properties along with their default value.
+var poolDefaults = map[string]string{
+	"altroot":       "-",
+	"ashift":        "0",
+	"autoexpand":    "off",
+	"autoreplace":   "off",
+	"autotrim":      "off",
+	"bootfs":        "-",
+	"cachefile":     "-",
+	"comment":       "-",
+	"compatibility": "off",
+	"delegation":    "on",
+	"failmode":      "wait",
+	"listsnapshots": "off",
+	"multihost":     "off",
+}
+
+// poolFeatures are the feature flags reported for every pool, along with their state.
+var poolFeatures = map[string]string{
+	"feature@async_destroy":      "enabled",
+	"feature@bookmarks":          "enabled",
+	"feature@empty_bpobj":        "active",
+	"feature@encryption":         "enabled",
+	"feature@large_blocks":       "enabled",
+	"feature@lz4_compress":       "active",
+	"feature@spacemap_histogram": "active",
+}
+
+// featureDescriptions are the descriptions of the supported features printed by zpool upgrade -v.
+var featureDescriptions = map[string]string{
+	"feature@async_destroy":      "Destroy filesystems asynchronously.",
+	"feature@bookmarks":          "\"zfs bookmark\" command",
+	"feature@empty_bpobj":        "Snapshots use less space.",
+	"feature@encryption":         "Support for dataset level encryption",
+	"feature@large_blocks":       "Support for blocks larger than 128KB.",
+	"feature@lz4_compress":       "LZ4 compression algorithm support.",
+	"feature@spacemap_histogram": "Spacemaps maintain space histograms.",
+}
+
+// readOnlyCompatible are the supported features which allow read-only imports by software that does not support them.
+var readOnlyCompatible = map[string]bool{
+	"feature@async_destroy": true, "feature@empty_bpobj": true, "feature@spacemap_histogram": true,
+}
+
+// poolReadOnlyProps lists the read-only pool properties in the order printed by zpool get all.
+var poolReadOnlyProps = []string{
+	"name", "size", "capacity", "health", "guid", "load_guid", "dedupratio", "free", "allocated", "readonly",
+	"expandsize", "freeing", "fragmentation", "leaked", "checkpoint",
+}
+
+// poolPropAliases are the abbreviated property names accepted by zpool list.
+var poolPropAliases = map[string]string{
+	"alloc": "allocated", "cap": "capacity", "ckpoint": "checkpoint", "dedup": "dedupratio",
+	"expandsz": "expandsize", "frag": "fragmentation",
+}
+
+// allPoolProps returns the properties of the pool printed by zpool get all, in order.
+func allPoolProps(p *pool) []string {
+	props := append([]string(nil), poolReadOnlyProps...)
+	var settable, features []string
+	for name := range poolDefaults {
+		settable = append(settable, name)
+	}
+	for name := range poolFeatures {
+		features = append(features, name)
+	}
+	// features which were enabled on the pool
+	for name := range p.props {
+		if _, ok := poolFeatures[name]; !ok && strings.HasPrefix(name, "feature@") {
+			features = append(features, name)
+		}
+	}
+	sort.Strings(settable)
+	sort.Strings(features)
+	return append(append(props, settable...), features...)
+}
+
+// poolProp resolves the value and source of a pool property.
+func (b *Backend) poolProp(p *pool, name string, parsable bool) (string, string, bool) {
+	if alias, ok := poolPropAliases[name]; ok {
+		name = alias
+	}
+	size := p.size()
+	human := func(n uint64) string {
+		if parsable {
+			return strconv.FormatUint(n, 10)
+		}
+		return humanSize(n)
+	}
+	percent := func(v string) string {
+		if parsable {
+			return v
+		}
+		return v + "%"
+	}
+	switch name {
+	case "name":
+		return p.name, "-", true
+	case "size", "free":
+		return human(size), "-", true
+	case "allocated", "freeing", "leaked":
+		return human(0), "-", true
+	case "capacity", "fragmentation":
+		return percent("0"), "-", true
+	case "health":
+		return "ONLINE", "-", true
+	case "guid":
+		return strconv.FormatUint(p.guid, 10), "-", true
+	case "load_guid":
+		return strconv.FormatUint(p.guid^0xffffffff, 10), "-", true
+	case "dedupratio":
+		return "1.00x", "-", true
+	case "readonly":
+		return "off", "-", true
+	case "expandsize", "checkpoint":
+		return "-", "-", true
+	}
+	if v, ok := p.props[name]; ok {
+		return v, "local", true
+	}
+	if v, ok := poolDefaults[name]; ok {
+		return v, "default", true
+	}
+	if v, ok := poolFeatures[name]; ok {
+		return v, "local", true
+	}
+	if strings.HasPrefix(name, "feature@") {
+		return "disabled", "local", true
+	}
+	return "", "", false
+}
+
+// size returns the usable size of the pool, counting one nominal device per mirror and excluding parity.
+func (p *pool) size() uint64 {
+	var size uint64
+	for _, g := range p.layout {
+		if g.class == "" {
+			size += g.size()
+		}
+	}
+	return size
+}
+
+// size returns the usable size of a top-level vdev.
+func (g *vdevGroup) size() uint64 {
+	n := uint64(len(g.devices))
+	switch {
+	case g.typ == "":
+		return n * deviceSize
+	case g.typ == "mirror":
+		return deviceSize
+	}
+	if redundancy := parity(g.typ) + draidSpares(g.typ); n > redundancy {
+		return (n - redundancy) * deviceSize
+	}
+	return deviceSize
+}
+
+// parity returns the parity level of a raidz or draid vdev type, such as raidz2 or draid1:2d:5c:1s.
+func parity(typ string) uint64 {
+	spec := strings.SplitN(strings.TrimPrefix(strings.TrimPrefix(typ, "raidz"), "draid"), ":", 2)[0]
+	n, err := strconv.ParseUint(spec, 10, 64)
+	if err != nil {
+		return 1
+	}
+	return n
+}
+
+// draidSpares returns the number of distributed spares of a draid vdev type.
+func draidSpares(typ string) uint64 {
+	for _, part := range strings.Split(typ, ":")[1:] {
+		if strings.HasSuffix(part, "s") {
+			n, _ := strconv.ParseUint(strings.TrimSuffix(part, "s"), 10, 64)
+			return n
+		}
+	}
+	return 0
+}
+
+// classes maps the class keywords of a vdev specification to the section names printed by zpool status.
+var classes = map[string]string{
+	"log": "logs", "cache": "cache", "spare": "spares", "special": "special", "dedup": "dedup",
+}
+
+// parseLayout parses the vdev specification of zpool create.
+func parseLayout(args []string) ([]vdevGroup, error) {
+	var layout []vdevGroup
+	class := ""
+	grouping := false
+	for _, arg := range args {
+		if c, ok := classes[arg]; ok {
+			class, grouping = c, false
+			continue
+		}
+		typ := arg
+		switch {
+		case arg == "mirror":
+		case arg == "raidz", arg == "draid":
+			typ = arg + "1"
+		case strings.HasPrefix(arg, "raidz") && len(arg) == 6 && arg[5] >= '1' && arg[5] <= '3':
+		case strings.HasPrefix(arg, "draid"):
+		default:
+			typ = ""
+		}
+		if typ != "" {
+			if class == "cache" || class == "spares" {
+				return nil, fmt.Errorf("invalid vdev specification: %s vdevs only support disks", class)
+			}
+			layout = append(layout, vdevGroup{class: class, typ: typ})
+			grouping = true
+			continue
+		}
+		if grouping {
+			layout[len(layout)-1].devices = append(layout[len(layout)-1].devices, arg)
+			continue
+		}
+		layout = append(layout, vdevGroup{class: class, devices: []string{arg}})
+	}
+
+	data := false
+	for _, g := range layout {
+		data = data || g.class == ""
+		min := 1
+		switch {
+		case g.typ == "mirror":
+			min = 2
+		case g.typ != "":
+			min = int(parity(g.typ)) + 1
+		}
+		if len(g.devices) < min {
+			return nil, fmt.Errorf("invalid vdev specification: %s requires at least %d devices", g.typ, min)
+		}
+	}
+	if !data {
+		return nil, fmt.Errorf("invalid vdev specification: at least one toplevel vdev must be specified")
+	}
+	return layout, nil
+}
+
+func (b *Backend) zpoolCreate(inv *invocation, args []string) error {
+	f, rest, err := parseFlags(args, "dfno:O:m:R:t:")
+	if err != nil {
+		return err
+	}
+	if len(rest) == 0 {
+		return fmt.Errorf("missing pool name argument")
+	}
+	name := rest[0]
+	if len(rest) == 1 {
+		return fmt.Errorf("missing vdev specification")
+	}
+	if c := name[0]; !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z') {
+		return fmt.Errorf("cannot create '%s': name must begin with a letter", name)
+	}
+	if _, ok := classes[name]; ok || name == "mirror" || strings.HasPrefix(name, "raidz") || strings.HasPrefix(name, "draid") {
+		return fmt.Errorf("cannot create '%s': name is reserved", name)
+	}
+	if strings.ContainsAny(name, "/@#") {
+		return fmt.Errorf("cannot create '%s': invalid character in pool name", name)
+	}
+	if b.pools[name] != nil {
+		return fmt.Errorf("cannot create '%s': pool already exists", name)
+	}
+
+	layout, err := parseLayout(rest[1:])
+	if err != nil {
+		return err
+	}
+	seen := map[string]bool{}
+	for _, g := range layout {
+		for _, dev := range g.devices {
+			if seen[dev] {
+				return fmt.Errorf("cannot create '%s': one or more vdevs refer to the same device", name)
+			}
+			seen[dev] = true
+			for _, other := range b.pools {
+				for _, og := range other.layout {
+					for _, od := range og.devices {
+						if od == dev {
+							return fmt.Errorf("invalid vdev specification\nuse '-f' to override the following errors:\n"+
+								"%s is part of active pool '%s'", dev, other.name)
+						}
+					}
+				}
+			}
+		}
+	}
+
+	props := map[string]string{}
+	for _, o := range f['o'] {
+		k, v, err := splitProp(o)
+		if err != nil {
+			return err
+		}
+		if _, _, ok := b.poolProp(&pool{}, k, true); !ok || isPoolReadOnly(k) {
+			return fmt.Errorf("property '%s' is not a valid pool property", k)
+		}
+		props[k] = v
+	}
+	if f.has('R') {
+		props["altroot"] = f.last('R')
+	}
+	// -d and the legacy compatibility create pools without features, unless they are enabled with -o
+	if f.has('d') || props["compatibility"] == "legacy" {
+		for feature := range poolFeatures {
+			if _, ok := props[feature]; !ok {
+				props[feature] = "disabled"
+			}
+		}
+	}
+	fsProps, err := parseProps(name, f['O'])
+	if err != nil {
+		return err
+	}
+	if f.has('m') {
+		fsProps["mountpoint"] = f.last('m')
+	}
+
+	if f.has('n') {
+		inv.printRow(fmt.Sprintf("would create '%s' with the following layout:\n\n\t%s", name, name))
+		// vdev groups are not numbered, the pool has not assigned their ids yet
+		for _, class := range []string{"", "dedup", "special", "logs", "cache", "spares"} {
+			header := false
+			for _, g := range layout {
+				if g.class != class {
+					continue
+				}
+				if class != "" && !header {
+					inv.printRow("\t" + class)
+					header = true
+				}
+				indent := "\t  "
+				if g.typ != "" {
+					inv.printRow(indent + g.typ)
+					indent += "  "
+				}
+				for _, dev := range g.devices {
+					inv.printRow(indent + dev)
+				}
+			}
+		}
+		return nil
+	}
+	p := &pool{name: name, layout: layout, props: props}
+	b.pools[name] = p
+	root, err := b.createDataset(inv, name, typeFilesystem, fsProps, false)
+	if err != nil {
+		delete(b.pools, name)
+		return err
+	}
+	p.guid = root.guid ^ 0x5bd1e995
+	p.vdevSeed = p.guid
+	return nil
+}
+
+func isPoolReadOnly(name string) bool {
+	for _, p := range poolReadOnlyProps {
+		if p == name {
+			return true
+		}
+	}
+	_, alias := poolPropAliases[name]
+	return alias
+}
+
+func noPool(name string) error {
+	return fmt.Errorf("cannot open '%s': no such pool", name)
+}
+
+// lookupPool returns the named pool, or the error zpool prints if it does not exist.
+func (b *Backend) lookupPool(name string) (*pool, error) {
+	p := b.pools[name]
+	if p == nil {
+		return nil, noPool(name)
+	}
+	return p, nil
+}
+
+// selectPools returns the named pools, or all pools in name order if names is empty.
+func (b *Backend) selectPools(names []string) ([]*pool, error) {
+	if len(names) == 0 {
+		for name := range b.pools {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+	pools := make([]*pool, 0, len(names))
+	for _, name := range names {
+		p, err := b.lookupPool(name)
+		if err != nil {
+			return nil, err
+		}
+		pools = append(pools, p)
+	}
+	return pools, nil
+}
+
+func (b *Backend) zpoolDestroy(args []string) error {
+	_, rest, err := parseFlags(args, "f")
+	if err != nil {
+		return err
+	}
+	if len(rest) != 1 {
+		return fmt.Errorf("expected exactly one pool argument")
+	}
+	p, err := b.lookupPool(rest[0])
+	if err != nil {
+		return err
+	}
+	for name := range b.datasets {
+		if poolName(name) == p.name {
+			delete(b.datasets, name)
+		}
+	}
+	delete(b.pools, p.name)
+	return nil
+}
+
+func (b *Backend) zpoolList(inv *invocation, args []string) error {
+	f, rest, err := parseFlags(args, "gHLpPvo:T:")
+	if err != nil {
+		return err
+	}
+	columns := []string{"name", "size", "alloc", "free", "ckpoint", "expandsz", "frag", "cap", "dedup", "health", "altroot"}
+	if f.has('o') {
+		columns = strings.Split(f.last('o'), ",")
+	}
+	for _, c := range columns {
+		if _, _, ok := b.poolProp(&pool{}, c, true); !ok {
+			return fmt.Errorf("bad property list: invalid property '%s'", c)
+		}
+	}
+	pools, err := b.selectPools(rest)
+	if err != nil {
+		return err
+	}
+	if !f.has('H') {
+		inv.printRow(strings.Split(strings.ToUpper(strings.Join(columns, ",")), ",")...)
+	}
+	for _, p := range pools {
+		row := make([]string, len(columns))
+		for i, c := range columns {
+			row[i], _, _ = b.poolProp(p, c, f.has('p'))
+		}
+		inv.printRow(row...)
+		if f.has('v') {
+			listVdevs(inv, p, f.has('H'), f.has('p'))
+		}
+	}
+	return nil
+}
+
+// listVdevs prints the vdev rows of zpool list -v, which have fixed columns regardless of -o.
+func listVdevs(inv *invocation, p *pool, scripted, parsable bool) {
+	size := func(n uint64) string {
+		if parsable {
+			return strconv.FormatUint(n, 10)
+		}
+		return humanSize(n)
+	}
+	percent := func(v string) string {
+		if parsable {
+			return v
+		}
+		return v + "%"
+	}
+	row := func(fields ...string) {
+		if scripted {
+			inv.printRow(append([]string{""}, fields...)...)
+		} else {
+			inv.printRow("  " + strings.Join(fields, "  "))
+		}
+	}
+	leaf := func(name, health string) {
+		row(name, size(deviceSize), "-", "-", "-", "-", "-", "-", "-", health)
+	}
+	// the fake pools allocate no space
+	topLevel := func(name string, n uint64) {
+		row(name, size(n), size(0), size(n), "-", "-", percent("0"), percent("0"), "-", "ONLINE")
+	}
+	for _, class := range []string{"", "dedup", "special", "logs", "cache"} {
+		header := false
+		n := 0
+		for _, g := range p.layout {
+			if g.class != class {
+				continue
+			}
+			if class != "" && !header {
+				row(class, "-", "-", "-", "-", "-", "-", "-", "-", "-")
+				header = true
+			}
+			switch {
+			case g.typ == "":
+				topLevel(g.devices[0], deviceSize)
+			default:
+				topLevel(g.name(n), g.size())
+				n++
+				for _, dev := range g.devices {
+					leaf(dev, "ONLINE")
+				}
+			}
+		}
+	}
+	if spares := p.spares(); len(spares) > 0 {
+		row("spare", "-", "-", "-", "-", "-", "-", "-", "-", "-")
+		for _, spare := range spares {
+			leaf(spare, "AVAIL")
+		}
+	}
+}
+
+// spares returns the distributed spares of the draid vdevs of the pool, named after their parity, the index of the
+// vdev and their own index, such as draid1-0-0, followed by the hot spare devices.
+func (p *pool) spares() []string {
+	var spares []string
+	n := 0
+	for _, g := range p.layout {
+		if g.class != "" || g.typ == "" {
+			continue
+		}
+		if strings.HasPrefix(g.typ, "draid") {
+			for i := uint64(0); i < draidSpares(g.typ); i++ {
+				spares = append(spares, fmt.Sprintf("draid%d-%d-%d", parity(g.typ), n, i))
+			}
+		}
+		n++
+	}
+	for _, g := range p.layout {
+		if g.class == "spares" {
+			spares = append(spares, g.devices[0])
+		}
+	}
+	return spares
+}
+
+func (b *Backend) zpoolGet(inv *invocation, args []string) error {
+	f, rest, err := parseFlags(args, "Hpo:")
+	if err != nil {
+		return err
+	}
+	if len(rest) == 0 {
+		return fmt.Errorf("missing property argument")
+	}
+	fields := []string{"name", "property", "value", "source"}
+	if f.has('o') {
+		fields = strings.Split(f.last('o'), ",")
+	}
+	var props []string
+	if rest[0] != "all" {
+		props = strings.Split(rest[0], ",")
+		for _, p := range props {
+			if _, _, ok := b.poolProp(&pool{}, p, true); !ok {
+				return fmt.Errorf("bad property list: invalid property '%s'", p)
+			}
+		}
+	}
+	pools, err := b.selectPools(rest[1:])
+	if err != nil {
+		return err
+	}
+	if !f.has('H') {
+		inv.printRow(strings.Split(strings.ToUpper(strings.Join(fields, ",")), ",")...)
+	}
+	for _, p := range pools {
+		names := props
+		if names == nil {
+			names = allPoolProps(p)
+		}
+		for _, prop := range names {
+			value, source, _ := b.poolProp(p, prop, f.has('p'))
+			row := make([]string, len(fields))
+			for i, field := range fields {
+				switch field {
+				case "name":
+					row[i] = p.name
+				case "property":
+					row[i] = prop
+				case "value":
+					row[i] = value
+				case "source":
+					row[i] = source
+				default:
+					return fmt.Errorf("invalid column name '%s'", field)
+				}
+			}
+			inv.printRow(row...)
+		}
+	}
+	return nil
+}
+
+func (b *Backend) zpoolSet(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("expected a property=value and a pool argument")
+	}
+	k, v, err := splitProp(args[0])
+	if err != nil {
+		return err
+	}
+	p, err := b.lookupPool(args[1])
+	if err != nil {
+		return err
+	}
+	_, _, ok := b.poolProp(p, k, true)
+	switch {
+	case !ok:
+		return fmt.Errorf("cannot set property for '%s': invalid property '%s'", p.name, k)
+	case isPoolReadOnly(k):
+		return fmt.Errorf("cannot set property for '%s': property '%s' is readonly", p.name, k)
+	case strings.HasPrefix(k, "feature@") && v != "enabled":
+		return fmt.Errorf("cannot set property for '%s': property '%s' can only be set to 'enabled'", p.name, k)
+	}
+	if strings.HasPrefix(k, "feature@") {
+		if compat, _, _ := b.poolProp(p, "compatibility", true); compat == "legacy" {
+			return fmt.Errorf("cannot set property for '%s': property '%s' is not compatible with compatibility=legacy", p.name, k)
+		}
+		if current, _, _ := b.poolProp(p, k, true); current == "active" {
+			return nil
+		}
+	}
+	p.props[k] = v
+	return nil
+}
+
+func (b *Backend) zpoolStatus(inv *invocation, args []string) error {
+	f, rest, err := parseFlags(args, "DegiLPpstvxT:")
+	if err != nil {
+		return err
+	}
+	pools, err := b.selectPools(rest)
+	if err != nil {
+		return err
+	}
+	if len(pools) == 0 {
+		inv.printRow("no pools available")
+		return nil
+	}
+	if f.has('x') {
+		inv.printRow("all pools are healthy")
+		return nil
+	}
+
+	for i, p := range pools {
+		if i > 0 {
+			inv.printRow()
+		}
+		inv.printRow("  pool: " + p.name)
+		inv.printRow(" state: ONLINE")
+		if p.scrubbed != 0 {
+			inv.printRow(fmt.Sprintf("  scan: scrub repaired 0B in 00:00:00 with 0 errors on %s",
+				txgTime(p.scrubbed).Local().Format("Mon Jan _2 15:04:05 2006")))
+		}
+		inv.printRow("config:")
+		inv.printRow()
+		inv.printRow(statusRow("", "NAME", "STATE", "READ", "WRITE", "CKSUM"))
+		inv.printRow(statusRow("", p.name, "ONLINE", "0", "0", "0"))
+		// -g names vdevs by guid, -P names devices by path
+		name := func(vdev string, device bool) string {
+			switch {
+			case f.has('g'):
+				return strconv.FormatUint(vdevGUID(p, vdev), 10)
+			case f.has('P') && device && !strings.HasPrefix(vdev, "/"):
+				return "/dev/" + vdev
+			}
+			return vdev
+		}
+		for _, class := range []string{"", "dedup", "special", "logs", "cache"} {
+			indent, header := "  ", false
+			n := 0
+			for _, g := range p.layout {
+				if g.class != class {
+					continue
+				}
+				if class != "" && !header {
+					inv.printRow("\t" + class)
+					header = true
+				}
+				state, counts := "ONLINE", []string{"0", "0", "0"}
+				if g.typ == "" {
+					inv.printRow(statusRow(indent, name(g.devices[0], true), state, counts...))
+					continue
+				}
+				inv.printRow(statusRow(indent, name(g.name(n), false), state, counts...))
+				for _, dev := range g.devices {
+					inv.printRow(statusRow(indent+"  ", name(dev, true), state, counts...))
+				}
+				n++
+			}
+		}
+		if spares := p.spares(); len(spares) > 0 {
+			inv.printRow("\tspares")
+			for _, spare := range spares {
+				inv.printRow(statusRow("  ", name(spare, !strings.HasPrefix(spare, "draid")), "AVAIL"))
+			}
+		}
+		inv.printRow()
+		inv.printRow("errors: No known data errors")
+	}
+	return nil
+}
+
+// name returns the name of a mirror, raidz or draid vdev, which is the nth of its class.
+func (g *vdevGroup) name(n int) string {
+	return fmt.Sprintf("%s-%d", g.typ, n)
+}
+
+// vdevGUID returns the guid of a vdev of the pool, given by its name.
+func vdevGUID(p *pool, vdev string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(vdev))
+	return p.vdevSeed ^ h.Sum64()
+}
+
+// statusRow formats a line of the config section of zpool status.
+func statusRow(indent, name, state string, counts ...string) string {
+	width := 12
+	if len(indent+name) >= width {
+		// zpool widens the name column to fit the longest name, such as a guid
+		width = len(indent+name) + 2
+	}
+	row := fmt.Sprintf("\t%-*s%-9s", width, indent+name, state)
+	for _, c := range counts {
+		row += fmt.Sprintf("%5s ", c)
+	}
+	return strings.TrimRight(row, " ")
+}
+
+func (b *Backend) zpoolScrub(args []string) error {
+	f, rest, err := parseFlags(args, "psw")
+	if err != nil {
+		return err
+	}
+	if len(rest) == 0 {
+		return fmt.Errorf("missing pool name argument")
+	}
+	pools, err := b.selectPools(rest)
+	if err != nil {
+		return err
+	}
+	for _, p := range pools {
+		// scrubs of the fake pools finish immediately, so there is never one to pause or cancel
+		switch {
+		case f.has('p'):
+			return fmt.Errorf("cannot pause scrubbing %s: there is no active scrub", p.name)
+		case f.has('s'):
+			return fmt.Errorf("cannot cancel scrubbing %s: there is no active scrub", p.name)
+		}
+		p.scrubbed = b.nextTxg()
+	}
+	return nil
+}
+
+func (b *Backend) zpoolReguid(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("missing pool name argument")
+	}
+	p, err := b.lookupPool(args[0])
+	if err != nil {
+		return err
+	}
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%d@%d", p.guid, b.nextTxg())
+	p.guid = h.Sum64()
+	return nil
+}
+
+func (b *Backend) zpoolReopen(args []string) error {
+	_, rest, err := parseFlags(args, "n")
+	if err != nil {
+		return err
+	}
+	if len(rest) == 0 {
+		return fmt.Errorf("missing pool name argument")
+	}
+	// the fake devices never go missing, so there is nothing to reopen
+	_, err = b.selectPools(rest)
+	return err
+}
+
+// waitActivities are the activities zpool wait can wait for.
+var waitActivities = map[string]bool{
+	"discard": true, "free": true, "initialize": true, "replace": true,
+	"remove": true, "resilver": true, "scrub": true, "trim": true,
+}
+
+func (b *Backend) zpoolWait(args []string) error {
+	f, rest, err := parseFlags(args, "Hpt:T:")
+	if err != nil {
+		return err
+	}
+	for _, t := range f['t'] {
+		for _, a := range strings.Split(t, ",") {
+			if !waitActivities[a] {
+				return fmt.Errorf("invalid activity '%s'", a)
+			}
+		}
+	}
+	if len(rest) == 0 {
+		return fmt.Errorf("missing 'pool' argument")
+	}
+	// the activities of the fake pools finish immediately, so there is never one to wait for
+	_, err = b.lookupPool(rest[0])
+	return err
+}
+
+func (b *Backend) zpoolUpgrade(inv *invocation, args []string) error {
+	f, rest, err := parseFlags(args, "av")
+	if err != nil {
+		return err
+	}
+	var supported []string
+	for name := range poolFeatures {
+		supported = append(supported, name)
+	}
+	sort.Strings(supported)
+
+	if f.has('v') {
+		inv.printRow("This system supports ZFS pool feature flags.")
+		inv.printRow()
+		inv.printRow("The following features are supported:")
+		inv.printRow()
+		inv.printRow("FEAT DESCRIPTION")
+		inv.printRow(strings.Repeat("-", 61))
+		for _, name := range supported {
+			row := strings.TrimPrefix(name, "feature@")
+			if readOnlyCompatible[name] {
+				row = fmt.Sprintf("%-37s %s", row, "(read-only compatible)")
+			}
+			inv.printRow(row)
+			inv.printRow("     " + featureDescriptions[name])
+		}
+		return nil
+	}
+
+	// disabled returns the supported features which are disabled on the pool and which it may enable
+	disabled := func(p *pool) []string {
+		if compat, _, _ := b.poolProp(p, "compatibility", true); compat == "legacy" {
+			return nil
+		}
+		var names []string
+		for _, name := range supported {
+			if value, _, _ := b.poolProp(p, name, true); value == "disabled" {
+				names = append(names, name)
+			}
+		}
+		return names
+	}
+	if !f.has('a') && len(rest) == 0 {
+		inv.printRow("This system supports ZFS pool feature flags.")
+		inv.printRow()
+		inv.printRow("All pools are formatted using feature flags.")
+		inv.printRow()
+		pools, _ := b.selectPools(nil)
+		header := false
+		for _, p := range pools {
+			names := disabled(p)
+			if len(names) == 0 {
+				continue
+			}
+			if !header {
+				inv.printRow()
+				inv.printRow("Some supported features are not enabled on the following pools. Once a")
+				inv.printRow("feature is enabled the pool may become incompatible with software")
+				inv.printRow("that does not support the feature. See zpool-features(7) for details.")
+				inv.printRow()
+				inv.printRow("POOL  FEATURE")
+				inv.printRow("---------------")
+				header = true
+			}
+			inv.printRow(p.name)
+			for _, name := range names {
+				inv.printRow("      " + strings.TrimPrefix(name, "feature@"))
+			}
+		}
+		if !header {
+			inv.printRow("Every feature flags pool has all supported and requested features enabled.")
+		}
+		return nil
+	}
+
+	if f.has('a') {
+		rest = nil
+	}
+	pools, err := b.selectPools(rest)
+	if err != nil {
+		return err
+	}
+	for _, p := range pools {
+		names := disabled(p)
+		if len(names) == 0 {
+			inv.printRow(fmt.Sprintf("Pool '%s' already has all supported and requested features enabled.", p.name))
+			continue
+		}
+		inv.printRow(fmt.Sprintf("Enabled the following features on '%s':", p.name))
+		for _, name := range names {
+			p.props[name] = "enabled"
+			inv.printRow("  " + strings.TrimPrefix(name, "feature@"))
+		}
+	}
+	return nil
+}
@@ -1,5 +1,13 @@
 package zfs
 
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
 // ZFS zpool states, which can indicate if a pool is online, offline, degraded, etc.
 //
 // More information regarding zpool states can be found in the ZFS manual:
@@ -26,25 +34,36 @@ type Zpool struct {
 	Freeing       uint64
 	Leaked        uint64
 	DedupRatio    float64
+	// CheckpointSize is the space consumed by the checkpoint of the pool, zero if it has none.
+	CheckpointSize uint64
+	// GUID identifies the pool, also when it is imported under another name.
+	GUID uint64
 }
 
 // zpool is a helper function to wrap typical calls to zpool and ignores stdout.
-func zpool(arg ...string) error {
-	_, err := zpoolOutput(arg...)
+func zpool(ctx context.Context, arg ...string) error {
+	_, err := zpoolOutput(ctx, arg...)
 	return err
 }
 
 // zpool is a helper function to wrap typical calls to zpool.
-func zpoolOutput(arg ...string) ([][]string, error) {
+func zpoolOutput(ctx context.Context, arg ...string) ([][]string, error) {
 	c := command{Command: "zpool"}
-	return c.Run(arg...)
+	return c.Run(ctx, arg...)
 }
 
 // GetZpool retrieves a single ZFS zpool by name.
 func GetZpool(name string) (*Zpool, error) {
+	return GetZpoolContext(context.Background(), name)
+}
+
+// GetZpoolContext is like GetZpool but includes a context.
+//
+// The provided context is used to kill the zpool process if the context becomes done before the command completes on its own.
+func GetZpoolContext(ctx context.Context, name string) (*Zpool, error) {
 	args := zpoolArgs
 	args = append(args, name)
-	out, err := zpoolOutput(args...)
+	out, err := zpoolGetOutput(ctx, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -61,12 +80,22 @@ func GetZpool(name string) (*Zpool, error) {
 
 // Datasets returns a slice of all ZFS datasets in a zpool.
 func (z *Zpool) Datasets() ([]*Dataset, error) {
-	return Datasets(z.Name)
+	return z.DatasetsContext(context.Background())
+}
+
+// DatasetsContext is like Datasets but includes a context.
+func (z *Zpool) DatasetsContext(ctx context.Context) ([]*Dataset, error) {
+	return DatasetsContext(ctx, z.Name)
 }
 
 // Snapshots returns a slice of all ZFS snapshots in a zpool.
 func (z *Zpool) Snapshots() ([]*Dataset, error) {
-	return Snapshots(z.Name)
+	return z.SnapshotsContext(context.Background())
+}
+
+// SnapshotsContext is like Snapshots but includes a context.
+func (z *Zpool) SnapshotsContext(ctx context.Context) ([]*Dataset, error) {
+	return SnapshotsContext(ctx, z.Name)
 }
 
 // CreateZpool creates a new ZFS zpool with the specified name, properties, and optional arguments.
@@ -75,6 +104,11 @@ func (z *Zpool) Snapshots() ([]*Dataset, error) {
 // https://openzfs.github.io/openzfs-docs/man/7/zfsprops.7.html.
 // https://openzfs.github.io/openzfs-docs/man/8/zpool-create.8.html
 func CreateZpool(name string, properties map[string]string, args ...string) (*Zpool, error) {
+	return CreateZpoolContext(context.Background(), name, properties, args...)
+}
+
+// CreateZpoolContext is like CreateZpool but includes a context.
+func CreateZpoolContext(ctx context.Context, name string, properties map[string]string, args ...string) (*Zpool, error) {
 	cli := make([]string, 1, 4)
 	cli[0] = "create"
 	if properties != nil {
@@ -82,33 +116,179 @@ func CreateZpool(name string, properties map[string]string, args ...string) (*Zp
 	}
 	cli = append(cli, name)
 	cli = append(cli, args...)
-	if err := zpool(cli...); err != nil {
+	if err := zpool(ctx, cli...); err != nil {
 		return nil, err
 	}
 
 	return &Zpool{Name: name}, nil
 }
 
+// CreateZpoolOptions are the options which can be passed to CreateZpoolWithOptions.
+//
+// A full description of the options may be found in the ZFS manual:
+// https://openzfs.github.io/openzfs-docs/man/8/zpool-create.8.html.
+type CreateZpoolOptions struct {
+	// Ashift sets the ashift property, the base 2 logarithm of the sector size of the vdevs between 9 and 16,
+	// e.g. 12 for 4K sectors (-o ashift=12). Zero uses the sector size the devices report.
+	Ashift int
+	// AutoTrim enables the autotrim property, which trims freed space of the devices automatically (-o autotrim=on).
+	AutoTrim bool
+	// AutoExpand enables the autoexpand property, which grows the pool once its devices are grown (-o autoexpand=on).
+	AutoExpand bool
+	// AltRoot sets the altroot property, under which all mountpoints of the pool are mounted (-R).
+	AltRoot string
+	// Mountpoint is the mountpoint of the root filesystem of the pool, which is /name if empty (-m).
+	// It may be "none" or "legacy".
+	Mountpoint string
+	// CacheFile sets the cachefile property, the file the pool configuration is cached in, "none" to not cache it
+	// (-o cachefile=).
+	CacheFile string
+	// Force uses vdevs even if they appear to be in use or their replication levels do not match (-f).
+	Force bool
+	// Properties are additional pool properties (-o property=value).
+	Properties map[string]string
+	// FilesystemProperties are set on the root filesystem of the pool, e.g. compression or encryption
+	// (-O property=value).
+	FilesystemProperties map[string]string
+}
+
+func (o *CreateZpoolOptions) args() ([]string, error) {
+	var args []string
+	if o.Force {
+		args = append(args, "-f")
+	}
+	props := make(map[string]string, len(o.Properties))
+	for k, v := range o.Properties {
+		props[k] = v
+	}
+	if o.Ashift != 0 {
+		if o.Ashift < 9 || o.Ashift > 16 {
+			return nil, fmt.Errorf("invalid ashift %d", o.Ashift)
+		}
+		props["ashift"] = strconv.Itoa(o.Ashift)
+	}
+	if o.AutoTrim {
+		props["autotrim"] = "on"
+	}
+	if o.AutoExpand {
+		props["autoexpand"] = "on"
+	}
+	if o.CacheFile != "" {
+		props["cachefile"] = o.CacheFile
+	}
+	for _, prop := range []struct {
+		flag  string
+		props map[string]string
+	}{{"-o", props}, {"-O", o.FilesystemProperties}} {
+		keys := make([]string, 0, len(prop.props))
+		for k := range prop.props {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			args = append(args, prop.flag, k+"="+prop.props[k])
+		}
+	}
+	if o.AltRoot != "" {
+		args = append(args, "-R", o.AltRoot)
+	}
+	if o.Mountpoint != "" {
+		args = append(args, "-m", o.Mountpoint)
+	}
+	return args, nil
+}
+
+// CreateZpoolWithOptions creates a new ZFS zpool with the specified name, vdev topology and options.
+// The topology and options are validated before zpool is run.
+func CreateZpoolWithOptions(name string, spec VdevSpec, opts CreateZpoolOptions) (*Zpool, error) {
+	return CreateZpoolWithOptionsContext(context.Background(), name, spec, opts)
+}
+
+// CreateZpoolWithOptionsContext is like CreateZpoolWithOptions but includes a context.
+func CreateZpoolWithOptionsContext(ctx context.Context, name string, spec VdevSpec, opts CreateZpoolOptions) (*Zpool, error) {
+	vdevs, err := spec.Args()
+	if err != nil {
+		return nil, err
+	}
+	if err := requireDraid(ctx, &spec); err != nil {
+		return nil, err
+	}
+	args, err := opts.args()
+	if err != nil {
+		return nil, err
+	}
+	args = append(append([]string{"create"}, args...), name)
+	if err := zpool(ctx, append(args, vdevs...)...); err != nil {
+		return nil, err
+	}
+	return &Zpool{Name: name}, nil
+}
+
 // Destroy destroys a ZFS zpool by name.
 func (z *Zpool) Destroy() error {
-	err := zpool("destroy", z.Name)
+	return z.DestroyContext(context.Background())
+}
+
+// DestroyContext is like Destroy but includes a context.
+func (z *Zpool) DestroyContext(ctx context.Context) error {
+	err := zpool(ctx, "destroy", z.Name)
 	return err
 }
 
+// Reguid generates a new guid for the zpool, e.g. for a pool of a cloned virtual machine, which has the same guid as
+// the pool it was cloned from and cannot be imported on the same host as that pool. The guids of its vdevs are kept.
+// Zpool.GUID is not updated, GetZpool returns the new guid.
+func (z *Zpool) Reguid() error {
+	return z.ReguidContext(context.Background())
+}
+
+// ReguidContext is like Reguid but includes a context.
+func (z *Zpool) ReguidContext(ctx context.Context) error {
+	return zpool(ctx, "reguid", z.Name)
+}
+
+// Reopen reopens all devices of the zpool, e.g. after the paths to its devices were fixed, restarting any scrub
+// in progress.
+func (z *Zpool) Reopen() error {
+	return z.ReopenContext(context.Background())
+}
+
+// ReopenContext is like Reopen but includes a context.
+func (z *Zpool) ReopenContext(ctx context.Context) error {
+	return zpool(ctx, "reopen", z.Name)
+}
+
 // ListZpools list all ZFS zpools accessible on the current system.
 func ListZpools() ([]*Zpool, error) {
-	args := []string{"list", "-Ho", "name"}
-	out, err := zpoolOutput(args...)
+	return ListZpoolsContext(context.Background())
+}
+
+// ListZpoolsContext is like ListZpools but includes a context.
+//
+// All pools are retrieved with a single invocation of zpool list.
+func ListZpoolsContext(ctx context.Context) ([]*Zpool, error) {
+	args := []string{"list", "-Hp", "-o", zpoolPropListOptions}
+	out, err := zpoolListOutput(ctx, args...)
 	if err != nil {
 		return nil, err
 	}
+	return parseZpoolList(out)
+}
 
-	var pools []*Zpool
+// example input for parseZpoolList
+// tank	ONLINE	1073741824	10737418240	9663676416	off	1.00x	3	0	0	-	1234567890123456789
 
-	for _, line := range out {
-		z, err := GetZpool(line[0])
-		if err != nil {
-			return nil, err
+func parseZpoolList(lines [][]string) ([]*Zpool, error) {
+	pools := make([]*Zpool, 0, len(lines))
+	for _, line := range lines {
+		if len(line) != len(zpoolPropList) {
+			return nil, errors.New("output does not match what is expected on this platform")
+		}
+		z := &Zpool{Name: line[0]}
+		for i, prop := range zpoolPropList {
+			if err := z.parseLine([]string{line[0], prop, line[i]}); err != nil {
+				return nil, err
+			}
 		}
 		pools = append(pools, z)
 	}
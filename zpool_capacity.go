@@ -0,0 +1,152 @@
+package zfs
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// VdevCapacity is the space of a vdev of a zpool, as reported by zpool list -v.
+// Allocated, Free, Checkpoint, Fragmentation and Capacity only apply to top-level vdevs, they are zero for the
+// devices of a mirror, raidz or draid group.
+type VdevCapacity struct {
+	Name string
+	// Class is the allocation class of the vdev, empty for data vdevs, otherwise one of the VdevSection constants.
+	Class string
+	// Size, Allocated, Free, Checkpoint and ExpandSize are in bytes. ExpandSize is the unused space of the devices
+	// of the vdev which the pool could grow into.
+	Size       uint64
+	Allocated  uint64
+	Free       uint64
+	Checkpoint uint64
+	ExpandSize uint64
+	// Fragmentation and Capacity are percentages.
+	Fragmentation uint64
+	Capacity      uint64
+	Health        string
+	// Children are the devices of a mirror, raidz or draid group. Vdevs nested deeper, such as those being
+	// replaced, are listed as children of their top-level vdev, as zpool list -H does not print the depth.
+	Children []*VdevCapacity
+}
+
+// VdevCapacity returns the space of each top-level vdev of the zpool, including those of the log, cache, spare,
+// special and dedup classes, with their devices as children.
+func (z *Zpool) VdevCapacity() ([]*VdevCapacity, error) {
+	return z.VdevCapacityContext(context.Background())
+}
+
+// VdevCapacityContext is like VdevCapacity but includes a context.
+func (z *Zpool) VdevCapacityContext(ctx context.Context) ([]*VdevCapacity, error) {
+	out, err := zpoolOutput(ctx, "list", "-v", "-Hp", z.Name)
+	if err != nil {
+		return nil, err
+	}
+	return parseVdevCapacity(out)
+}
+
+// vdevListClasses maps the class headers of zpool list -v to the VdevSection constants.
+var vdevListClasses = map[string]string{
+	"logs": VdevSectionLogs, "cache": VdevSectionCache, "spare": VdevSectionSpares, "spares": VdevSectionSpares,
+	"special": VdevSectionSpecial, "dedup": VdevSectionDedup,
+}
+
+// example input for parseVdevCapacity
+// tank	21474836480	5368709120	16106127360	-	-	3	25	1.00	ONLINE	-
+// 	mirror-0	10737418240	2684354560	8053063680	-	-	3	25	-	ONLINE
+// 	sda	10737418240	-	-	-	-	-	-	-	ONLINE
+// 	sdb	10737418240	-	-	-	-	-	-	-	ONLINE
+// 	sdc	10737418240	2684354560	8053063680	-	10485760	2	25	-	ONLINE
+// 	logs	-	-	-	-	-	-	-	-	-
+// 	nvme0	1073741824	4096	1073737728	-	-	0	0	-	ONLINE
+// 	spare	-	-	-	-	-	-	-	-	-
+// 	sdd	10737418240	-	-	-	-	-	-	-	AVAIL
+
+func parseVdevCapacity(lines [][]string) ([]*VdevCapacity, error) {
+	var vdevs []*VdevCapacity
+	var top *VdevCapacity
+	class := ""
+	for _, line := range lines {
+		if len(line) == 0 || line[0] != "" {
+			// the pool itself
+			continue
+		}
+		line = line[1:]
+		if len(line) < 10 {
+			return nil, fmt.Errorf("invalid vdev %q", strings.Join(line, "\t"))
+		}
+		if c, ok := vdevListClasses[line[0]]; ok && line[1] == "-" {
+			class, top = c, nil
+			continue
+		}
+
+		v := &VdevCapacity{Name: line[0], Class: class, Health: line[9]}
+		fields := []*uint64{&v.Size, &v.Allocated, &v.Free, &v.Checkpoint, &v.ExpandSize, &v.Fragmentation, &v.Capacity}
+		for i, field := range fields {
+			if err := setUint(field, line[i+1]); err != nil {
+				return nil, fmt.Errorf("invalid vdev %s: %w", v.Name, err)
+			}
+		}
+		// only top-level vdevs have allocation stats, spares have none either
+		if line[2] == "-" && top != nil {
+			top.Children = append(top.Children, v)
+			continue
+		}
+		vdevs = append(vdevs, v)
+		if line[2] != "-" {
+			top = v
+		}
+	}
+	return vdevs, nil
+}
+
+// ClassUsage is the space of the vdevs of an allocation class of a zpool, as returned by Zpool.ClassUsage.
+type ClassUsage struct {
+	// Class is empty for the normal class, otherwise VdevSectionSpecial, VdevSectionDedup or VdevSectionLogs.
+	Class string
+	// Vdevs is the number of top-level vdevs of the class.
+	Vdevs int
+	// Size, Allocated and Free are the sums of those of the vdevs in bytes.
+	Size      uint64
+	Allocated uint64
+	Free      uint64
+}
+
+// ClassUsage returns the space of each allocation class of the zpool, the normal class first, followed by the
+// special, dedup and log classes the pool has vdevs of. Metadata and small blocks are stored on special vdevs
+// and deduplication tables on dedup vdevs, which spill over to the normal class once they are full.
+// Cache and spare devices store no data of the pool and are not included.
+func (z *Zpool) ClassUsage() ([]*ClassUsage, error) {
+	return z.ClassUsageContext(context.Background())
+}
+
+// ClassUsageContext is like ClassUsage but includes a context.
+func (z *Zpool) ClassUsageContext(ctx context.Context) ([]*ClassUsage, error) {
+	vdevs, err := z.VdevCapacityContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return classUsage(vdevs), nil
+}
+
+func classUsage(vdevs []*VdevCapacity) []*ClassUsage {
+	usage := []*ClassUsage{{}}
+	for _, class := range []string{VdevSectionSpecial, VdevSectionDedup, VdevSectionLogs} {
+		for _, v := range vdevs {
+			if v.Class == class {
+				usage = append(usage, &ClassUsage{Class: class})
+				break
+			}
+		}
+	}
+	for _, v := range vdevs {
+		for _, u := range usage {
+			if u.Class == v.Class {
+				u.Vdevs++
+				u.Size += v.Size
+				u.Allocated += v.Allocated
+				u.Free += v.Free
+			}
+		}
+	}
+	return usage
+}
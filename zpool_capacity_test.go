@@ -0,0 +1,66 @@
+package zfs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestVdevCapacity(t *testing.T) {
+	ctx, r := withFakeRunner("tank\t21474836480\t5368709120\t16106127360\t-\t-\t3\t25\t1.00\tONLINE\t-\n" +
+		"\tmirror-0\t10737418240\t2684354560\t8053063680\t-\t-\t3\t25\t-\tONLINE\n" +
+		"\tsda\t10737418240\t-\t-\t-\t-\t-\t-\t-\tONLINE\n" +
+		"\tsdb\t10737418240\t-\t-\t-\t-\t-\t-\t-\tONLINE\n" +
+		"\tsdc\t10737418240\t2684354560\t8053063680\t1048576\t10485760\t2\t25\t-\tONLINE\n" +
+		"\tlogs\t-\t-\t-\t-\t-\t-\t-\t-\t-\n" +
+		"\tnvme0\t1073741824\t4096\t1073737728\t-\t-\t0\t0\t-\tONLINE\n" +
+		"\tspare\t-\t-\t-\t-\t-\t-\t-\t-\t-\n" +
+		"\tsdd\t10737418240\t-\t-\t-\t-\t-\t-\t-\tAVAIL\n" +
+		"\tsde\t10737418240\t-\t-\t-\t-\t-\t-\t-\tAVAIL\n")
+	z := &Zpool{Name: "tank"}
+
+	vdevs, err := z.VdevCapacityContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"zpool", "list", "-v", "-Hp", "tank"}; !reflect.DeepEqual(want, r.calls[0]) {
+		t.Fatalf("want: %q, got: %q", want, r.calls[0])
+	}
+	leaf := func(name string) *VdevCapacity {
+		return &VdevCapacity{Name: name, Size: 10737418240, Health: ZpoolOnline}
+	}
+	want := []*VdevCapacity{
+		{
+			Name: "mirror-0", Size: 10737418240, Allocated: 2684354560, Free: 8053063680, Fragmentation: 3, Capacity: 25,
+			Health: ZpoolOnline, Children: []*VdevCapacity{leaf("sda"), leaf("sdb")},
+		},
+		{
+			Name: "sdc", Size: 10737418240, Allocated: 2684354560, Free: 8053063680, Checkpoint: 1048576,
+			ExpandSize: 10485760, Fragmentation: 2, Capacity: 25, Health: ZpoolOnline,
+		},
+		{Name: "nvme0", Class: VdevSectionLogs, Size: 1073741824, Allocated: 4096, Free: 1073737728, Health: ZpoolOnline},
+		{Name: "sdd", Class: VdevSectionSpares, Size: 10737418240, Health: "AVAIL"},
+		{Name: "sde", Class: VdevSectionSpares, Size: 10737418240, Health: "AVAIL"},
+	}
+	if !reflect.DeepEqual(want, vdevs) {
+		t.Fatalf("want: %+v, got: %+v", want, vdevs)
+	}
+}
+
+func TestClassUsage(t *testing.T) {
+	vdevs := []*VdevCapacity{
+		{Name: "mirror-0", Size: 100, Allocated: 40, Free: 60},
+		{Name: "mirror-1", Size: 100, Allocated: 20, Free: 80},
+		{Name: "nvme0", Class: VdevSectionLogs, Size: 10, Free: 10},
+		{Name: "mirror-2", Class: VdevSectionSpecial, Size: 50, Allocated: 5, Free: 45},
+		{Name: "nvme3", Class: VdevSectionCache, Size: 10, Allocated: 10},
+		{Name: "sde", Class: VdevSectionSpares, Size: 100},
+	}
+	want := []*ClassUsage{
+		{Vdevs: 2, Size: 200, Allocated: 60, Free: 140},
+		{Class: VdevSectionSpecial, Vdevs: 1, Size: 50, Allocated: 5, Free: 45},
+		{Class: VdevSectionLogs, Vdevs: 1, Size: 10, Free: 10},
+	}
+	if got := classUsage(vdevs); !reflect.DeepEqual(want, got) {
+		t.Fatalf("want: %+v, got: %+v", want, got)
+	}
+}
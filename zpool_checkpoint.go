@@ -0,0 +1,26 @@
+package zfs
+
+import (
+	"context"
+)
+
+// Checkpoint takes a checkpoint of the zpool, which the pool can be rewound to on import with
+// ImportOptions.RewindToCheckpoint. A pool can only have a single checkpoint.
+func (z *Zpool) Checkpoint() error {
+	return z.CheckpointContext(context.Background())
+}
+
+// CheckpointContext is like Checkpoint but includes a context.
+func (z *Zpool) CheckpointContext(ctx context.Context) error {
+	return zpool(ctx, "checkpoint", z.Name)
+}
+
+// DiscardCheckpoint discards the checkpoint of the zpool, freeing the space it consumes in the background.
+func (z *Zpool) DiscardCheckpoint() error {
+	return z.DiscardCheckpointContext(context.Background())
+}
+
+// DiscardCheckpointContext is like DiscardCheckpoint but includes a context.
+func (z *Zpool) DiscardCheckpointContext(ctx context.Context) error {
+	return zpool(ctx, "checkpoint", "-d", z.Name)
+}
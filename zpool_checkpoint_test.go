@@ -0,0 +1,25 @@
+package zfs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCheckpoint(t *testing.T) {
+	ctx, r := withFakeRunner("")
+	z := &Zpool{Name: "tank"}
+
+	if err := z.CheckpointContext(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := z.DiscardCheckpointContext(ctx); err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"zpool", "checkpoint", "tank"},
+		{"zpool", "checkpoint", "-d", "tank"},
+	}
+	if !reflect.DeepEqual(want, r.calls) {
+		t.Fatalf("want: %q, got: %q", want, r.calls)
+	}
+}
@@ -0,0 +1,119 @@
+package zfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// The device operations of a zpool take a device by its name or path, as printed by zpool status, or by the guid
+// of its vdev in decimal, as returned by Vdev.Device. Unlike names, guids do not change when devices are renamed
+// between boots, and still identify devices which are missing.
+
+// Online brings a device of the zpool online.
+// If expand is set, the device is expanded to use all of its space, e.g. after the underlying disk was grown (-e).
+func (z *Zpool) Online(device string, expand bool) error {
+	return z.OnlineContext(context.Background(), device, expand)
+}
+
+// OnlineContext is like Online but includes a context.
+func (z *Zpool) OnlineContext(ctx context.Context, device string, expand bool) error {
+	args := []string{"online"}
+	if expand {
+		args = append(args, "-e")
+	}
+	return zpool(ctx, append(args, z.Name, device)...)
+}
+
+// Offline takes a device of the zpool offline, no further reads or writes are issued to it.
+// If temporary is set, the device is brought back online when the system is restarted (-t).
+func (z *Zpool) Offline(device string, temporary bool) error {
+	return z.OfflineContext(context.Background(), device, temporary)
+}
+
+// OfflineContext is like Offline but includes a context.
+func (z *Zpool) OfflineContext(ctx context.Context, device string, temporary bool) error {
+	args := []string{"offline"}
+	if temporary {
+		args = append(args, "-t")
+	}
+	return zpool(ctx, append(args, z.Name, device)...)
+}
+
+// Clear clears the error counters of a device of the zpool, or of all its devices if device is empty.
+// A pool suspended because of I/O failures is resumed if its devices are available again.
+func (z *Zpool) Clear(device string) error {
+	return z.ClearContext(context.Background(), device)
+}
+
+// ClearContext is like Clear but includes a context.
+func (z *Zpool) ClearContext(ctx context.Context, device string) error {
+	args := []string{"clear", z.Name}
+	if device != "" {
+		args = append(args, device)
+	}
+	return zpool(ctx, args...)
+}
+
+// Replace replaces a device of the zpool with newDevice, resilvering its data onto the new device.
+// If newDevice is empty, the device is replaced with itself, e.g. after a failed disk was swapped at the same path.
+// If force is set, newDevice is used even if it appears to be in use (-f).
+func (z *Zpool) Replace(device, newDevice string, force bool) error {
+	return z.ReplaceContext(context.Background(), device, newDevice, force)
+}
+
+// ReplaceContext is like Replace but includes a context.
+func (z *Zpool) ReplaceContext(ctx context.Context, device, newDevice string, force bool) error {
+	if device == "" {
+		return errors.New("no device to replace given")
+	}
+	args := []string{"replace"}
+	if force {
+		args = append(args, "-f")
+	}
+	args = append(args, z.Name, device)
+	if newDevice != "" {
+		args = append(args, newDevice)
+	}
+	return zpool(ctx, args...)
+}
+
+var raidzVdevRegex = regexp.MustCompile(`^raidz[123]-\d+$`)
+
+// Attach attaches newDevice to device of the zpool: a disk becomes a mirror, a mirror gets another side, and a
+// raidz vdev such as raidz1-0 is expanded by the new disk, which requires the raidz_expansion feature of OpenZFS 2.3.
+// ErrNotSupported is returned for raidz vdevs if expansion is known not to be supported. The progress of an
+// expansion is reported as ZpoolStatus.Expansion.
+// If force is set, newDevice is used even if it appears to be in use (-f).
+func (z *Zpool) Attach(device, newDevice string, force bool) error {
+	return z.AttachContext(context.Background(), device, newDevice, force)
+}
+
+// AttachContext is like Attach but includes a context.
+func (z *Zpool) AttachContext(ctx context.Context, device, newDevice string, force bool) error {
+	if device == "" || newDevice == "" {
+		return errors.New("no device to attach to or new device given")
+	}
+	if caps := knownCapabilities(ctx); caps != nil && !caps.RaidzExpansion && raidzVdevRegex.MatchString(device) {
+		return fmt.Errorf("raidz expansion: %w", ErrNotSupported)
+	}
+	args := []string{"attach"}
+	if force {
+		args = append(args, "-f")
+	}
+	return zpool(ctx, append(args, z.Name, device, newDevice)...)
+}
+
+// Detach detaches a device from a mirror of the zpool, or the old or new device of a replacement in progress.
+func (z *Zpool) Detach(device string) error {
+	return z.DetachContext(context.Background(), device)
+}
+
+// DetachContext is like Detach but includes a context.
+func (z *Zpool) DetachContext(ctx context.Context, device string) error {
+	if device == "" {
+		return errors.New("no device to detach given")
+	}
+	return zpool(ctx, "detach", z.Name, device)
+}
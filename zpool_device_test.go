@@ -0,0 +1,85 @@
+package zfs
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestDeviceOperations(t *testing.T) {
+	ctx, r := withFakeRunner("")
+	z := &Zpool{Name: "tank"}
+
+	if err := z.OnlineContext(ctx, "sda", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := z.OfflineContext(ctx, "sdb", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := z.OfflineContext(ctx, "sdb", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := z.ClearContext(ctx, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := z.ClearContext(ctx, "sda"); err != nil {
+		t.Fatal(err)
+	}
+	if err := z.ReplaceContext(ctx, "3333333333333333333", "sdc", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := z.ReplaceContext(ctx, "sdb", "", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := z.DetachContext(ctx, "3333333333333333333"); err != nil {
+		t.Fatal(err)
+	}
+	if err := z.AttachContext(ctx, "raidz1-0", "sdd", true); err != nil {
+		t.Fatal(err)
+	}
+
+	want := [][]string{
+		{"zpool", "online", "-e", "tank", "sda"},
+		{"zpool", "offline", "tank", "sdb"},
+		{"zpool", "offline", "-t", "tank", "sdb"},
+		{"zpool", "clear", "tank"},
+		{"zpool", "clear", "tank", "sda"},
+		{"zpool", "replace", "-f", "tank", "3333333333333333333", "sdc"},
+		{"zpool", "replace", "tank", "sdb"},
+		{"zpool", "detach", "tank", "3333333333333333333"},
+		{"zpool", "attach", "-f", "tank", "raidz1-0", "sdd"},
+	}
+	if !reflect.DeepEqual(want, r.calls) {
+		t.Fatalf("want: %q, got: %q", want, r.calls)
+	}
+
+	if err := z.ReplaceContext(ctx, "", "sdc", false); err == nil {
+		t.Fatal("expected error without device")
+	}
+	if err := z.DetachContext(ctx, ""); err == nil {
+		t.Fatal("expected error without device")
+	}
+	if err := z.AttachContext(ctx, "sda", "", false); err == nil {
+		t.Fatal("expected error without new device")
+	}
+}
+
+func TestAttachRaidzExpansion(t *testing.T) {
+	// raidz_expansion is not among the supported features
+	r := capabilitiesRunner("zfs-2.2.7-1\nzfs-kmod-2.2.7-1\n")
+	ctx := WithRunner(context.Background(), r)
+	if _, err := DetectCapabilitiesContext(ctx); err != nil {
+		t.Fatal(err)
+	}
+	z := &Zpool{Name: "tank"}
+	if err := z.AttachContext(ctx, "raidz2-0", "sdd", false); !errors.Is(err, ErrNotSupported) {
+		t.Fatalf("want ErrNotSupported, got: %v", err)
+	}
+	if err := z.AttachContext(ctx, "mirror-0", "sdd", false); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"zpool", "attach", "tank", "mirror-0", "sdd"}; !reflect.DeepEqual(want, r.calls[len(r.calls)-1]) {
+		t.Fatalf("want: %q, got: %q", want, r.calls[len(r.calls)-1])
+	}
+}
@@ -0,0 +1,167 @@
+package zfs
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ZpoolEvent is an event generated by the ZFS kernel module, as reported by zpool events.
+type ZpoolEvent struct {
+	Time time.Time
+	// Class is the class of the event, e.g. "ereport.fs.zfs.checksum" or "sysevent.fs.zfs.scrub_finish".
+	Class    string
+	Pool     string
+	PoolGUID uint64
+	VdevGUID uint64
+	VdevPath string
+	// EID is the event identifier, which increases with every event.
+	EID uint64
+	// Payload holds all name-value pairs of the event as printed by zpool events -v, with strings unquoted.
+	// Pairs of embedded lists are keyed by their path, e.g. "detector.scheme".
+	Payload map[string]string
+}
+
+// WatchZpoolEvents runs zpool events -f, which follows the event log of the ZFS kernel module, and delivers the
+// events of all pools on the returned channel, starting with the ones still in the log, until ctx becomes done.
+//
+// The events channel is closed when watching stops, after which the error channel yields the reason,
+// which is ctx.Err() if ctx became done. The Runner of ctx must implement StreamRunner.
+func WatchZpoolEvents(ctx context.Context) (<-chan *ZpoolEvent, <-chan error) {
+	events := make(chan *ZpoolEvent)
+	errc := make(chan error, 1)
+	go func() {
+		defer close(errc)
+		defer close(events)
+		errc <- streamOutput(ctx, command{Command: "zpool"}, []string{"events", "-f", "-H", "-v"}, func(r io.Reader) error {
+			return readZpoolEvents(r, func(e *ZpoolEvent) bool {
+				select {
+				case events <- e:
+					return true
+				case <-ctx.Done():
+					return false
+				}
+			})
+		})
+	}()
+	return events, errc
+}
+
+// zpoolEventTimeLayout is the time format of zpool events, e.g. "Jul 25 2021 10:00:00.123456789".
+const zpoolEventTimeLayout = "Jan _2 2006 15:04:05.999999999"
+
+// example input for readZpoolEvents
+// Jul 25 2021 10:00:00.123456789	ereport.fs.zfs.checksum
+//         class = "ereport.fs.zfs.checksum"
+//         detector = (embedded nvlist)
+//                 scheme = "zfs"
+//         (end detector)
+//         pool = "tank"
+//         eid = 0x2a
+//
+
+// readZpoolEvents parses the output of zpool events -H -v from r and calls emit for every event,
+// until r is exhausted or emit returns false.
+func readZpoolEvents(r io.Reader, emit func(*ZpoolEvent) bool) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var event *ZpoolEvent
+	var path []string
+	flush := func() bool {
+		if event == nil {
+			return true
+		}
+		e := event
+		event, path = nil, nil
+		return emit(e)
+	}
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+			if !flush() {
+				return nil
+			}
+		case line[0] != ' ' && line[0] != '\t':
+			if !flush() {
+				return nil
+			}
+			e, err := parseZpoolEventHeader(line)
+			if err != nil {
+				return err
+			}
+			event = e
+		case event == nil:
+			return fmt.Errorf("unexpected event payload %q", trimmed)
+		case strings.HasPrefix(trimmed, "(end ") && len(path) > 0:
+			path = path[:len(path)-1]
+		default:
+			if err := event.parsePair(trimmed, &path); err != nil {
+				return err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	flush()
+	return nil
+}
+
+func parseZpoolEventHeader(line string) (*ZpoolEvent, error) {
+	sep := strings.LastIndexAny(line, "\t ")
+	if sep < 0 {
+		return nil, fmt.Errorf("invalid event %q", line)
+	}
+	t, err := time.ParseInLocation(zpoolEventTimeLayout, strings.TrimSpace(line[:sep]), time.Local)
+	if err != nil {
+		return nil, fmt.Errorf("invalid event time: %w", err)
+	}
+	return &ZpoolEvent{Time: t, Class: line[sep+1:], Payload: map[string]string{}}, nil
+}
+
+// parsePair adds a name-value pair of the payload to the event, path holds the names of the enclosing embedded lists.
+func (e *ZpoolEvent) parsePair(pair string, path *[]string) error {
+	i := strings.Index(pair, " = ")
+	if i < 0 {
+		return fmt.Errorf("invalid event payload %q", pair)
+	}
+	name, value := pair[:i], strings.TrimSpace(pair[i+3:])
+	if value == "(embedded nvlist)" {
+		*path = append(*path, name)
+		return nil
+	}
+	if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+		value = value[1 : len(value)-1]
+	}
+	if len(*path) > 0 {
+		e.Payload[strings.Join(append(*path, name), ".")] = value
+		return nil
+	}
+	e.Payload[name] = value
+
+	var err error
+	switch name {
+	case "pool":
+		e.Pool = value
+	case "pool_guid":
+		e.PoolGUID, err = strconv.ParseUint(value, 0, 64)
+	case "vdev_guid":
+		e.VdevGUID, err = strconv.ParseUint(value, 0, 64)
+	case "vdev_path":
+		e.VdevPath = value
+	case "eid":
+		e.EID, err = strconv.ParseUint(value, 0, 64)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid event %s %q: %w", name, value, err)
+	}
+	return nil
+}
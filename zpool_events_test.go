@@ -0,0 +1,116 @@
+package zfs
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const eventsOutput = `Jul 25 2021 10:00:00.123456789	ereport.fs.zfs.checksum
+        class = "ereport.fs.zfs.checksum"
+        ena = 0x1234
+        detector = (embedded nvlist)
+                version = 0x0
+                scheme = "zfs"
+                vdev = 0x9abc
+        (end detector)
+        pool = "tank"
+        pool_guid = 0x5678
+        vdev_guid = 0x9abc
+        vdev_path = "/dev/sda1"
+        time = 0x60fd3a60 0x75bcd15
+        eid = 0x2a
+
+Jul  5 2021 10:00:01.000000000	sysevent.fs.zfs.scrub_finish
+        pool = "tank"
+        eid = 0x2b
+
+`
+
+func TestReadZpoolEvents(t *testing.T) {
+	var events []*ZpoolEvent
+	err := readZpoolEvents(strings.NewReader(eventsOutput), func(e *ZpoolEvent) bool {
+		events = append(events, e)
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("want 2 events, got %d", len(events))
+	}
+
+	want := &ZpoolEvent{
+		Time:     time.Date(2021, time.July, 25, 10, 0, 0, 123456789, time.Local),
+		Class:    "ereport.fs.zfs.checksum",
+		Pool:     "tank",
+		PoolGUID: 0x5678,
+		VdevGUID: 0x9abc,
+		VdevPath: "/dev/sda1",
+		EID:      0x2a,
+		Payload: map[string]string{
+			"class":            "ereport.fs.zfs.checksum",
+			"ena":              "0x1234",
+			"detector.version": "0x0",
+			"detector.scheme":  "zfs",
+			"detector.vdev":    "0x9abc",
+			"pool":             "tank",
+			"pool_guid":        "0x5678",
+			"vdev_guid":        "0x9abc",
+			"vdev_path":        "/dev/sda1",
+			"time":             "0x60fd3a60 0x75bcd15",
+			"eid":              "0x2a",
+		},
+	}
+	if !reflect.DeepEqual(want, events[0]) {
+		t.Fatalf("want: %+v, got: %+v", want, events[0])
+	}
+	if e := events[1]; e.Class != "sysevent.fs.zfs.scrub_finish" || e.EID != 0x2b || e.Time.Day() != 5 {
+		t.Fatalf("unexpected event: %+v", e)
+	}
+
+	stopped := 0
+	if err := readZpoolEvents(strings.NewReader(eventsOutput), func(*ZpoolEvent) bool { stopped++; return false }); err != nil {
+		t.Fatal(err)
+	}
+	if stopped != 1 {
+		t.Fatalf("expected reading to stop after the first event, got %d", stopped)
+	}
+}
+
+func TestWatchZpoolEvents(t *testing.T) {
+	r := &fakeStreamRunner{fakeRunner: fakeRunner{output: func([]string) (string, error) { return eventsOutput, nil }}}
+	events, errc := WatchZpoolEvents(WithRunner(context.Background(), r))
+
+	var classes []string
+	for e := range events {
+		classes = append(classes, e.Class)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"ereport.fs.zfs.checksum", "sysevent.fs.zfs.scrub_finish"}; !reflect.DeepEqual(want, classes) {
+		t.Fatalf("want: %q, got: %q", want, classes)
+	}
+	if want := [][]string{{"zpool", "events", "-f", "-H", "-v"}}; !reflect.DeepEqual(want, r.calls) {
+		t.Fatalf("want calls: %q, got: %q", want, r.calls)
+	}
+
+	ctx, cancel := context.WithCancel(WithRunner(context.Background(), r))
+	events, errc = WatchZpoolEvents(ctx)
+	<-events
+	cancel()
+	for range events {
+	}
+	if err := <-errc; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+
+	_, errc = WatchZpoolEvents(WithRunner(context.Background(), &fakeRunner{}))
+	if err := <-errc; err == nil {
+		t.Fatal("expected error for runner which cannot stream")
+	}
+}
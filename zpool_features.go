@@ -0,0 +1,126 @@
+package zfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Feature flag states, as reported by Zpool.Features.
+//
+// More information regarding feature flags can be found in the ZFS manual:
+// https://openzfs.github.io/openzfs-docs/man/7/zpool-features.7.html.
+const (
+	// FeatureDisabled features are not used by the pool and can be enabled.
+	FeatureDisabled = "disabled"
+	// FeatureEnabled features can be used by the pool, but their on-disk format changes have not been made yet,
+	// so the pool can still be imported by implementations which do not support them read-write.
+	FeatureEnabled = "enabled"
+	// FeatureActive features have changed the on-disk format of the pool.
+	FeatureActive = "active"
+)
+
+// Values of the compatibility property of a zpool, besides the names of feature sets such as "openzfs-2.1-linux".
+const (
+	// CompatibilityOff does not restrict the features of the pool.
+	CompatibilityOff = "off"
+	// CompatibilityLegacy does not allow any features to be enabled.
+	CompatibilityLegacy = "legacy"
+)
+
+// Feature is a feature flag of a zpool.
+type Feature struct {
+	// Name is the name of the feature without the feature@ prefix of its property, such as "encryption".
+	Name string
+	// State is FeatureDisabled, FeatureEnabled or FeatureActive.
+	State string
+}
+
+// Features returns the feature flags of the zpool sorted by name, e.g. to audit which features a fleet of pools uses
+// before importing them with an older version of ZFS.
+func (z *Zpool) Features() ([]*Feature, error) {
+	return z.FeaturesContext(context.Background())
+}
+
+// FeaturesContext is like Features but includes a context.
+func (z *Zpool) FeaturesContext(ctx context.Context) ([]*Feature, error) {
+	props, err := getZpoolProperties(ctx, z.Name, "all")
+	if err != nil {
+		return nil, err
+	}
+	var features []*Feature
+	for name, prop := range props {
+		if strings.HasPrefix(name, "feature@") {
+			features = append(features, &Feature{Name: strings.TrimPrefix(name, "feature@"), State: prop.Value})
+		}
+	}
+	sort.Slice(features, func(i, j int) bool {
+		return features[i].Name < features[j].Name
+	})
+	return features, nil
+}
+
+// EnableFeature enables a feature flag of the zpool, given by its name with or without the feature@ prefix.
+// Enabled features cannot be disabled again. Features become active once they are first used.
+func (z *Zpool) EnableFeature(name string) error {
+	return z.EnableFeatureContext(context.Background(), name)
+}
+
+// EnableFeatureContext is like EnableFeature but includes a context.
+func (z *Zpool) EnableFeatureContext(ctx context.Context, name string) error {
+	name = strings.TrimPrefix(name, "feature@")
+	if name == "" || strings.ContainsAny(name, "@= ") {
+		return fmt.Errorf("invalid feature name %q", name)
+	}
+	return z.SetPropertyContext(ctx, "feature@"+name, FeatureEnabled)
+}
+
+// Compatibility returns the compatibility property of the zpool: the feature sets which restrict the features that
+// can be enabled, such as "openzfs-2.1-linux", or a single CompatibilityOff or CompatibilityLegacy.
+// The property can also be set when creating a pool, e.g. with the properties of CreateZpool, in which case only
+// the features of the sets are enabled.
+func (z *Zpool) Compatibility() ([]string, error) {
+	return z.CompatibilityContext(context.Background())
+}
+
+// CompatibilityContext is like Compatibility but includes a context.
+func (z *Zpool) CompatibilityContext(ctx context.Context) ([]string, error) {
+	value, err := z.GetPropertyContext(ctx, "compatibility")
+	if err != nil {
+		return nil, err
+	}
+	return strings.Split(value, ","), nil
+}
+
+// SetCompatibility sets the compatibility property of the zpool to the given feature sets, which are the names of
+// files in the compatibility.d directories of ZFS or absolute paths, or to a single CompatibilityOff or
+// CompatibilityLegacy. It does not disable features which are already enabled.
+func (z *Zpool) SetCompatibility(sets ...string) error {
+	return z.SetCompatibilityContext(context.Background(), sets...)
+}
+
+// SetCompatibilityContext is like SetCompatibility but includes a context.
+func (z *Zpool) SetCompatibilityContext(ctx context.Context, sets ...string) error {
+	value, err := compatibilityValue(sets)
+	if err != nil {
+		return err
+	}
+	return z.SetPropertyContext(ctx, "compatibility", value)
+}
+
+func compatibilityValue(sets []string) (string, error) {
+	if len(sets) == 0 {
+		return "", errors.New("no feature sets given")
+	}
+	for _, set := range sets {
+		if set == "" || strings.ContainsAny(set, ", \t\n") {
+			return "", fmt.Errorf("invalid feature set %q", set)
+		}
+		if (set == CompatibilityOff || set == CompatibilityLegacy) && len(sets) > 1 {
+			return "", fmt.Errorf("%s cannot be combined with other feature sets", set)
+		}
+	}
+	return strings.Join(sets, ","), nil
+}
@@ -0,0 +1,50 @@
+package zfs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFeatures(t *testing.T) {
+	ctx, r := withFakeRunner("tank\tsize\t10737418240\t-\n" +
+		"tank\tfeature@lz4_compress\tactive\tlocal\n" +
+		"tank\tfeature@encryption\tenabled\tlocal\n" +
+		"tank\tfeature@draid\tdisabled\tlocal\n")
+	z := &Zpool{Name: "tank"}
+
+	features, err := z.FeaturesContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*Feature{
+		{Name: "draid", State: FeatureDisabled},
+		{Name: "encryption", State: FeatureEnabled},
+		{Name: "lz4_compress", State: FeatureActive},
+	}
+	if !reflect.DeepEqual(want, features) {
+		t.Fatalf("want: %+v, got: %+v", want, features)
+	}
+
+	if err := z.EnableFeatureContext(ctx, "feature@draid"); err != nil {
+		t.Fatal(err)
+	}
+	if err := z.SetCompatibilityContext(ctx, "openzfs-2.1-linux", "grub2"); err != nil {
+		t.Fatal(err)
+	}
+	calls := [][]string{
+		{"zpool", "set", "feature@draid=enabled", "tank"},
+		{"zpool", "set", "compatibility=openzfs-2.1-linux,grub2", "tank"},
+	}
+	if got := r.calls[len(r.calls)-2:]; !reflect.DeepEqual(calls, got) {
+		t.Fatalf("want: %q, got: %q", calls, got)
+	}
+
+	for _, sets := range [][]string{nil, {""}, {"a,b"}, {CompatibilityLegacy, "grub2"}} {
+		if err := z.SetCompatibilityContext(ctx, sets...); err == nil {
+			t.Fatalf("expected error setting compatibility to %q", sets)
+		}
+	}
+	if err := z.EnableFeatureContext(ctx, "feature@"); err == nil {
+		t.Fatal("expected error enabling a feature without name")
+	}
+}
@@ -0,0 +1,172 @@
+package zfs
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// PoolHealthChange is a change of the health of a zpool, as reported by WatchPoolHealth.
+type PoolHealthChange struct {
+	Pool string
+	// From and To are the previous and the new health, such as ZpoolOnline and ZpoolDegraded.
+	// From is empty for pools which were not known before, To for pools which were exported or destroyed.
+	From string
+	To   string
+	// Time is when the new health was confirmed.
+	Time time.Time
+}
+
+// healthSettle is the longest time WatchPoolHealth waits to confirm a change of health.
+const healthSettle = time.Second
+
+// WatchPoolHealth polls the health of all zpools every interval and delivers its changes on the returned channel,
+// starting with the health of every pool from an empty From, until ctx becomes done.
+//
+// A change is only reported once a second poll, after at most a second, confirms it, so pools passing through a
+// state briefly, e.g. while a device is reopened, do not cause a pair of changes. If the Runner of ctx implements
+// StreamRunner, zpool events are followed as well and every event, such as a device changing its state,
+// triggers a poll before the interval has elapsed.
+//
+// The changes channel is closed when watching stops, after which the error channel yields the reason,
+// which is ctx.Err() if ctx became done or the error of a failed poll.
+func WatchPoolHealth(ctx context.Context, interval time.Duration) (<-chan *PoolHealthChange, <-chan error) {
+	changes := make(chan *PoolHealthChange)
+	errc := make(chan error, 1)
+	if interval <= 0 {
+		close(changes)
+		errc <- fmt.Errorf("invalid interval %v", interval)
+		close(errc)
+		return changes, errc
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	trigger := make(chan struct{}, 1)
+	if _, ok := runnerFromContext(ctx).(StreamRunner); ok {
+		go func() {
+			// events only speed up noticing changes, polling continues if they are not available
+			events, _ := WatchZpoolEvents(ctx)
+			for range events {
+				select {
+				case trigger <- struct{}{}:
+				default:
+				}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(errc)
+		defer close(changes)
+		defer cancel()
+		errc <- watchPoolHealth(ctx, interval, trigger, func(c *PoolHealthChange) bool {
+			select {
+			case changes <- c:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		})
+	}()
+	return changes, errc
+}
+
+func watchPoolHealth(ctx context.Context, interval time.Duration, trigger <-chan struct{}, emit func(*PoolHealthChange) bool) error {
+	settle := healthSettle
+	if interval < settle {
+		settle = interval
+	}
+	known := map[string]string{}
+	first := true
+	var pending map[string]string
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-trigger:
+			timer.Stop()
+			select {
+			case <-timer.C:
+			default:
+			}
+		case <-timer.C:
+		}
+
+		health, err := poolHealth(ctx)
+		if err != nil {
+			return err
+		}
+		// changes seen by the previous poll which still hold are confirmed
+		var confirmed []*PoolHealthChange
+		for pool, to := range pending {
+			if health[pool] == to && known[pool] != to {
+				confirmed = append(confirmed, &PoolHealthChange{Pool: pool, From: known[pool], To: to, Time: time.Now()})
+				known[pool] = to
+			}
+		}
+		pending = map[string]string{}
+		for _, pool := range healthPools(known, health) {
+			if health[pool] == known[pool] {
+				continue
+			}
+			if first {
+				confirmed = append(confirmed, &PoolHealthChange{Pool: pool, To: health[pool], Time: time.Now()})
+				known[pool] = health[pool]
+				continue
+			}
+			pending[pool] = health[pool]
+		}
+		first = false
+		sort.Slice(confirmed, func(i, j int) bool {
+			return confirmed[i].Pool < confirmed[j].Pool
+		})
+		for _, c := range confirmed {
+			if c.To == "" {
+				delete(known, c.Pool)
+			}
+			if !emit(c) {
+				return ctx.Err()
+			}
+		}
+
+		if len(pending) > 0 {
+			timer.Reset(settle)
+		} else {
+			timer.Reset(interval)
+		}
+	}
+}
+
+// poolHealth returns the health of every zpool.
+func poolHealth(ctx context.Context) (map[string]string, error) {
+	out, err := zpoolListOutput(ctx, "list", "-Hp", "-o", "name,health")
+	if err != nil {
+		return nil, err
+	}
+	health := make(map[string]string, len(out))
+	for _, line := range out {
+		if len(line) != 2 {
+			return nil, fmt.Errorf("unexpected output of zpool list: %q", line)
+		}
+		health[line[0]] = line[1]
+	}
+	return health, nil
+}
+
+// healthPools returns the names of the pools of both a and b in order.
+func healthPools(a, b map[string]string) []string {
+	var pools []string
+	for pool := range a {
+		pools = append(pools, pool)
+	}
+	for pool := range b {
+		if _, ok := a[pool]; !ok {
+			pools = append(pools, pool)
+		}
+	}
+	sort.Strings(pools)
+	return pools
+}
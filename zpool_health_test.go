@@ -0,0 +1,85 @@
+package zfs
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWatchPoolHealth(t *testing.T) {
+	polls := []string{
+		"tank\tONLINE\nbackup\tONLINE\n",
+		"tank\tDEGRADED\nbackup\tONLINE\n",
+		"tank\tDEGRADED\nbackup\tONLINE\n",
+		// a brief change is not reported
+		"tank\tFAULTED\nbackup\tONLINE\n",
+		"tank\tDEGRADED\nbackup\tONLINE\n",
+		"tank\tONLINE\nbackup\tONLINE\n",
+		"tank\tONLINE\nbackup\tONLINE\n",
+		"tank\tONLINE\n",
+		"tank\tONLINE\n",
+	}
+	var mu sync.Mutex
+	n := 0
+	r := &fakeRunner{output: func(args []string) (string, error) {
+		if args[1] != "list" {
+			return "", errors.New("unsupported")
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		out := polls[len(polls)-1]
+		if n < len(polls) {
+			out = polls[n]
+		}
+		n++
+		return out, nil
+	}}
+	ctx, cancel := context.WithCancel(WithRunner(context.Background(), r))
+	defer cancel()
+
+	changes, errc := WatchPoolHealth(ctx, time.Millisecond)
+	var got []PoolHealthChange
+	for c := range changes {
+		if c.Time.IsZero() {
+			t.Fatalf("change without time: %+v", c)
+		}
+		got = append(got, PoolHealthChange{Pool: c.Pool, From: c.From, To: c.To})
+		if len(got) == 5 {
+			cancel()
+		}
+	}
+	want := []PoolHealthChange{
+		{Pool: "backup", To: ZpoolOnline},
+		{Pool: "tank", To: ZpoolOnline},
+		{Pool: "tank", From: ZpoolOnline, To: ZpoolDegraded},
+		{Pool: "tank", From: ZpoolDegraded, To: ZpoolOnline},
+		{Pool: "backup", From: ZpoolOnline},
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("want: %+v, got: %+v", want, got)
+	}
+	if err := <-errc; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestWatchPoolHealthError(t *testing.T) {
+	r := &fakeRunner{output: func(args []string) (string, error) {
+		return "", errors.New("zpool failed")
+	}}
+	changes, errc := WatchPoolHealth(WithRunner(context.Background(), r), time.Millisecond)
+	for range changes {
+		t.Fatal("expected no changes")
+	}
+	if err := <-errc; err == nil {
+		t.Fatal("expected error of the failed poll")
+	}
+
+	_, errc = WatchPoolHealth(context.Background(), 0)
+	if err := <-errc; err == nil {
+		t.Fatal("expected error for invalid interval")
+	}
+}
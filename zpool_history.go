@@ -0,0 +1,158 @@
+package zfs
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HistoryEntry is a single record of the history of a zpool, as reported by zpool history.
+type HistoryEntry struct {
+	Time time.Time
+	// Command is the zfs or zpool command line which modified the pool, empty for internal events.
+	Command string
+	// Internal reports whether the entry is an internal event logged by ZFS rather than a command.
+	Internal bool
+	// Event is the name of an internal event, e.g. "create", "set" or "ioctl".
+	Event string
+	// Txg is the transaction group of an internal event.
+	Txg uint64
+	// Dataset and DatasetID identify the dataset an internal event applies to, if any.
+	Dataset   string
+	DatasetID uint64
+	// Details is the remainder of an internal event, e.g. "compression=lz4" for a property change.
+	Details string
+	// UID and User identify the user who ran the command, UID is -1 if it was not logged.
+	UID  int
+	User string
+	Host string
+	Zone string
+}
+
+// History returns the history of commands which modified the zpool, oldest first.
+// If internal is set, internal events logged by ZFS are included (-i).
+func (z *Zpool) History(internal bool) ([]*HistoryEntry, error) {
+	return z.HistoryContext(context.Background(), internal)
+}
+
+// HistoryContext is like History but includes a context.
+func (z *Zpool) HistoryContext(ctx context.Context, internal bool) ([]*HistoryEntry, error) {
+	flags := "-l"
+	if internal {
+		flags = "-il"
+	}
+	out, err := zpoolRawOutput(ctx, "history", flags, z.Name)
+	if err != nil {
+		return nil, err
+	}
+	return parseHistory(string(out))
+}
+
+const historyTimeLayout = "2006-01-02.15:04:05"
+
+var (
+	historyLongRegex     = regexp.MustCompile(`^(.*?) \[(?:user (\d+) (?:\((\S+)\) )?)?(?:on ([^:\]]*)(?::([^\]]*))?)?\]$`)
+	historyInternalRegex = regexp.MustCompile(`^\[internal (\S+) txg:(\d+)\] ?(.*)$`)
+	historyTxgRegex      = regexp.MustCompile(`^\[txg:(\d+)\] (.*)$`)
+	historyDatasetRegex  = regexp.MustCompile(`^(.+?) (\S+) \((\d+)\)(?: (.*))?$`)
+)
+
+// example input for parseHistory
+// History for 'tank':
+// 2021-07-25.10:00:00 zpool create tank sda [user 0 (root) on host]
+// 2021-07-25.10:00:05 [txg:5] create tank/fs (68)  [user 0 (root) on host]
+// 2021-07-25.10:00:05 zfs create tank/fs [user 1000 (alice) on host:zone]
+
+func parseHistory(out string) ([]*HistoryEntry, error) {
+	var entries []*HistoryEntry
+	for i, line := range strings.Split(out, "\n") {
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "History for ") {
+			continue
+		}
+		// ioctl events of zpool history -i are followed by their indented input and output,
+		// and the user and host on a line of their own
+		if line[0] == ' ' || line[0] == '\t' {
+			if len(entries) == 0 {
+				continue
+			}
+			last := entries[len(entries)-1]
+			if m := historyLongRegex.FindStringSubmatch(line); m != nil && m[1] == "" {
+				if err := last.parseLong(m); err != nil {
+					return nil, fmt.Errorf("failed to parse line %d of history: %w", i, err)
+				}
+				continue
+			}
+			last.Details = strings.TrimSpace(last.Details + "\n" + strings.TrimSpace(line))
+			continue
+		}
+		e, err := parseHistoryLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse line %d of history: %w", i, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+func parseHistoryLine(line string) (*HistoryEntry, error) {
+	sep := strings.IndexByte(line, ' ')
+	if sep < 0 {
+		return nil, fmt.Errorf("invalid history entry %q", line)
+	}
+	t, err := time.ParseInLocation(historyTimeLayout, line[:sep], time.Local)
+	if err != nil {
+		return nil, err
+	}
+	e := &HistoryEntry{Time: t, UID: -1}
+	rest := strings.TrimSpace(line[sep+1:])
+
+	if m := historyLongRegex.FindStringSubmatch(rest); m != nil {
+		rest = strings.TrimSpace(m[1])
+		if err := e.parseLong(m); err != nil {
+			return nil, err
+		}
+	}
+
+	switch {
+	case historyInternalRegex.MatchString(rest):
+		m := historyInternalRegex.FindStringSubmatch(rest)
+		e.Internal, e.Event, e.Details = true, m[1], m[3]
+		e.Txg, err = strconv.ParseUint(m[2], 10, 64)
+	case historyTxgRegex.MatchString(rest):
+		m := historyTxgRegex.FindStringSubmatch(rest)
+		e.Internal = true
+		if e.Txg, err = strconv.ParseUint(m[1], 10, 64); err != nil {
+			return nil, err
+		}
+		if d := historyDatasetRegex.FindStringSubmatch(m[2]); d != nil {
+			e.Event, e.Dataset, e.Details = d[1], d[2], d[4]
+			e.DatasetID, err = strconv.ParseUint(d[3], 10, 64)
+		} else {
+			e.Event = m[2]
+		}
+	case strings.HasPrefix(rest, "ioctl "):
+		e.Internal, e.Event, e.Details = true, "ioctl", strings.TrimPrefix(rest, "ioctl ")
+	default:
+		e.Command = rest
+	}
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// parseLong sets the user, host and zone of the entry from a match of historyLongRegex.
+func (e *HistoryEntry) parseLong(m []string) error {
+	if m[2] != "" {
+		uid, err := strconv.Atoi(m[2])
+		if err != nil {
+			return err
+		}
+		e.UID = uid
+	}
+	e.User, e.Host, e.Zone = m[3], m[4], m[5]
+	return nil
+}
@@ -0,0 +1,65 @@
+package zfs
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+const historyOutput = `History for 'tank':
+2021-07-25.10:00:00 zpool create tank sda [user 0 (root) on host]
+2021-07-25.10:00:05 [txg:5] create tank/fs (68)  [user 0 (root) on host]
+2021-07-25.10:00:05 [txg:6] set tank/fs (68) compression=lz4 [user 0 (root) on host]
+2021-07-25.10:00:06 [internal snapshot txg:7] dataset = 72 [on host]
+2021-07-25.10:00:06 ioctl snapshot
+    input:
+        snaps:
+            tank/fs@snap
+ [user 1000 (alice) on host:zone]
+2021-07-25.10:00:06 zfs snapshot tank/fs@snap [user 1000 (alice) on host:zone]
+`
+
+func TestParseHistory(t *testing.T) {
+	entries, err := parseHistory(historyOutput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(sec int) time.Time { return time.Date(2021, time.July, 25, 10, 0, sec, 0, time.Local) }
+	want := []*HistoryEntry{
+		{Time: at(0), Command: "zpool create tank sda", UID: 0, User: "root", Host: "host"},
+		{Time: at(5), Internal: true, Event: "create", Txg: 5, Dataset: "tank/fs", DatasetID: 68, UID: 0, User: "root", Host: "host"},
+		{Time: at(5), Internal: true, Event: "set", Txg: 6, Dataset: "tank/fs", DatasetID: 68, Details: "compression=lz4", UID: 0, User: "root", Host: "host"},
+		{Time: at(6), Internal: true, Event: "snapshot", Txg: 7, Details: "dataset = 72", UID: -1, Host: "host"},
+		{Time: at(6), Internal: true, Event: "ioctl", Details: "snapshot\ninput:\nsnaps:\ntank/fs@snap",
+			UID: 1000, User: "alice", Host: "host", Zone: "zone"},
+		{Time: at(6), Command: "zfs snapshot tank/fs@snap", UID: 1000, User: "alice", Host: "host", Zone: "zone"},
+	}
+	if len(want) != len(entries) {
+		t.Fatalf("want %d entries, got %d", len(want), len(entries))
+	}
+	for i := range want {
+		if !reflect.DeepEqual(want[i], entries[i]) {
+			t.Errorf("entry %d:\nwant: %+v\ngot:  %+v", i, want[i], entries[i])
+		}
+	}
+
+	if _, err := parseHistory("yesterday zpool create tank sda\n"); err == nil {
+		t.Fatal("expected error for invalid timestamp")
+	}
+}
+
+func TestHistory(t *testing.T) {
+	ctx, r := withFakeRunner(historyOutput)
+	z := &Zpool{Name: "tank"}
+
+	if _, err := z.HistoryContext(ctx, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := z.HistoryContext(ctx, true); err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{{"zpool", "history", "-l", "tank"}, {"zpool", "history", "-il", "tank"}}
+	if !reflect.DeepEqual(want, r.calls) {
+		t.Fatalf("want: %q, got: %q", want, r.calls)
+	}
+}
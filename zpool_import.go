@@ -0,0 +1,155 @@
+package zfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// ImportOptions are the options which can be passed to ImportZpool and ImportAll.
+//
+// A full description of the options may be found in the ZFS manual:
+// https://openzfs.github.io/openzfs-docs/man/8/zpool-import.8.html.
+type ImportOptions struct {
+	// NoMount imports the pool without mounting any of its file systems (-N).
+	NoMount bool
+	// Force imports the pool even if it appears to be in use by another system (-f).
+	Force bool
+	// Destroyed imports a destroyed pool (-D).
+	Destroyed bool
+	// AltRoot sets the altroot property, under which all mountpoints of the pool are mounted (-R).
+	AltRoot string
+	// ReadOnly imports the pool read-only (-o readonly=on).
+	ReadOnly bool
+	// NewName imports the pool under a different name. It cannot be used with ImportAll.
+	NewName string
+	// MissingLog imports the pool even with a missing log device, discarding its contents (-m).
+	MissingLog bool
+	// SearchDirs are the directories or devices searched for pool members instead of the default ones (-d).
+	SearchDirs []string
+	// CacheFile reads the pool configuration from this cache file instead of searching for devices (-c).
+	CacheFile string
+	// Rewind recovers a pool which cannot be opened by discarding its last few transactions (-F).
+	Rewind bool
+	// ExtremeRewind extends the search for a transaction to rewind to, which may take very long (-F -X).
+	ExtremeRewind bool
+	// RewindTxg rewinds the pool to this transaction group (-T). Zero means no specific transaction group.
+	RewindTxg uint64
+	// RewindToCheckpoint rewinds the pool to its checkpoint, discarding all changes made after it was taken
+	// (--rewind-to-checkpoint).
+	RewindToCheckpoint bool
+	// Properties are set on the pool when it is imported (-o property=value).
+	Properties map[string]string
+}
+
+func (o *ImportOptions) args() []string {
+	var args []string
+	if o.NoMount {
+		args = append(args, "-N")
+	}
+	if o.Force {
+		args = append(args, "-f")
+	}
+	if o.Destroyed {
+		args = append(args, "-D")
+	}
+	if o.AltRoot != "" {
+		args = append(args, "-R", o.AltRoot)
+	}
+	if o.ReadOnly {
+		args = append(args, "-o", "readonly=on")
+	}
+	if o.MissingLog {
+		args = append(args, "-m")
+	}
+	for _, dir := range o.SearchDirs {
+		args = append(args, "-d", dir)
+	}
+	if o.CacheFile != "" {
+		args = append(args, "-c", o.CacheFile)
+	}
+	if o.Rewind || o.ExtremeRewind {
+		args = append(args, "-F")
+	}
+	if o.ExtremeRewind {
+		args = append(args, "-X")
+	}
+	if o.RewindTxg != 0 {
+		args = append(args, "-T", strconv.FormatUint(o.RewindTxg, 10))
+	}
+	if o.RewindToCheckpoint {
+		args = append(args, "--rewind-to-checkpoint")
+	}
+	if o.Properties != nil {
+		args = append(args, propsSlice(o.Properties)...)
+	}
+	return args
+}
+
+// ImportZpool imports an exported ZFS zpool, identified by its name or numeric guid, as configured by opts.
+// A pool imported by guid without a NewName keeps its name, which is looked up with zpool list.
+func ImportZpool(name string, opts ImportOptions) (*Zpool, error) {
+	return ImportZpoolContext(context.Background(), name, opts)
+}
+
+// ImportZpoolContext is like ImportZpool but includes a context.
+func ImportZpoolContext(ctx context.Context, name string, opts ImportOptions) (*Zpool, error) {
+	args := append([]string{"import"}, opts.args()...)
+	args = append(args, name)
+	if opts.NewName != "" {
+		args = append(args, opts.NewName)
+		name = opts.NewName
+	}
+	if err := zpool(ctx, args...); err != nil {
+		return nil, err
+	}
+	// pool names begin with a letter, so a number is the guid of a pool imported under its own name
+	if _, err := strconv.ParseUint(name, 10, 64); err == nil {
+		if name, err = zpoolNameByGUID(ctx, name); err != nil {
+			return nil, err
+		}
+	}
+	return GetZpoolContext(ctx, name)
+}
+
+func zpoolNameByGUID(ctx context.Context, guid string) (string, error) {
+	out, err := zpoolOutput(ctx, "list", "-Hp", "-o", "name,guid")
+	if err != nil {
+		return "", err
+	}
+	for _, line := range out {
+		if len(line) == 2 && line[1] == guid {
+			return line[0], nil
+		}
+	}
+	return "", fmt.Errorf("no imported pool with guid %s", guid)
+}
+
+// ImportAll imports all ZFS zpools found in the searched devices, as configured by opts.
+func ImportAll(opts ImportOptions) error {
+	return ImportAllContext(context.Background(), opts)
+}
+
+// ImportAllContext is like ImportAll but includes a context.
+func ImportAllContext(ctx context.Context, opts ImportOptions) error {
+	if opts.NewName != "" {
+		return errors.New("pools cannot be renamed when importing all pools")
+	}
+	return zpool(ctx, append(append([]string{"import"}, opts.args()...), "-a")...)
+}
+
+// Export exports a ZFS zpool, unmounting its file systems, so it can be imported again on this or another system.
+// If force is set, file systems are unmounted even if they are busy (-f).
+func (z *Zpool) Export(force bool) error {
+	return z.ExportContext(context.Background(), force)
+}
+
+// ExportContext is like Export but includes a context.
+func (z *Zpool) ExportContext(ctx context.Context, force bool) error {
+	args := []string{"export"}
+	if force {
+		args = append(args, "-f")
+	}
+	return zpool(ctx, append(args, z.Name)...)
+}
@@ -0,0 +1,78 @@
+package zfs
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestImportOptionsArgs(t *testing.T) {
+	opts := ImportOptions{
+		NoMount:    true,
+		Force:      true,
+		AltRoot:    "/mnt",
+		ReadOnly:   true,
+		MissingLog: true,
+		SearchDirs: []string{"/dev/disk/by-id", "/tmp/files"},
+		CacheFile:  "/etc/zfs/zpool.cache",
+		RewindTxg:  1234,
+		Properties: map[string]string{"cachefile": "none"},
+	}
+	want := []string{"-N", "-f", "-R", "/mnt", "-o", "readonly=on", "-m", "-d", "/dev/disk/by-id", "-d", "/tmp/files",
+		"-c", "/etc/zfs/zpool.cache", "-T", "1234", "-o", "cachefile=none"}
+	if got := opts.args(); !reflect.DeepEqual(want, got) {
+		t.Fatalf("want: %q, got: %q", want, got)
+	}
+
+	opts = ImportOptions{Destroyed: true, ExtremeRewind: true, RewindToCheckpoint: true}
+	if want, got := []string{"-D", "-F", "-X", "--rewind-to-checkpoint"}, opts.args(); !reflect.DeepEqual(want, got) {
+		t.Fatalf("want: %q, got: %q", want, got)
+	}
+}
+
+func TestImportZpool(t *testing.T) {
+	ctx, r := withFakeRunner("")
+
+	if _, err := ImportZpoolContext(ctx, "tank", ImportOptions{NoMount: true, NewName: "restored"}); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"zpool", "import", "-N", "tank", "restored"}; !reflect.DeepEqual(want, r.calls[0]) {
+		t.Fatalf("want: %q, got: %q", want, r.calls[0])
+	}
+	if got := r.calls[len(r.calls)-1]; got[len(got)-1] != "restored" {
+		t.Fatalf("expected the renamed pool to be retrieved, got: %q", got)
+	}
+
+	// the pool imported by guid is looked up by its name
+	r = &fakeRunner{output: func(args []string) (string, error) {
+		if args[1] == "list" {
+			return "other\t42\ntank\t9876543210\n", nil
+		}
+		return "", nil
+	}}
+	ctx = WithRunner(context.Background(), r)
+	z, err := ImportZpoolContext(ctx, "9876543210", ImportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"zpool", "list", "-Hp", "-o", "name,guid"}; !reflect.DeepEqual(want, r.calls[1]) {
+		t.Fatalf("want: %q, got: %q", want, r.calls[1])
+	}
+	if got := r.calls[len(r.calls)-1]; z.Name != "tank" || got[len(got)-1] != "tank" {
+		t.Fatalf("expected pool tank to be retrieved, got %q: %q", z.Name, got)
+	}
+	if _, err := ImportZpoolContext(ctx, "1234", ImportOptions{}); err == nil {
+		t.Fatal("expected error for a guid which was not imported")
+	}
+
+	r.calls = nil
+	if err := ImportAllContext(ctx, ImportOptions{SearchDirs: []string{"/tmp"}}); err != nil {
+		t.Fatal(err)
+	}
+	if want := [][]string{{"zpool", "import", "-d", "/tmp", "-a"}}; !reflect.DeepEqual(want, r.calls) {
+		t.Fatalf("want: %q, got: %q", want, r.calls)
+	}
+	if err := ImportAllContext(ctx, ImportOptions{NewName: "restored"}); err == nil {
+		t.Fatal("expected error renaming all pools")
+	}
+}
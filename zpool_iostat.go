@@ -0,0 +1,265 @@
+package zfs
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// IostatOptions are the options which can be passed to IostatStream.
+//
+// A full description of the options may be found in the ZFS manual:
+// https://openzfs.github.io/openzfs-docs/man/8/zpool-iostat.8.html.
+type IostatOptions struct {
+	// Vdevs reports the statistics of every vdev of the pool after those of the pool itself (-v).
+	Vdevs bool
+	// Latency reports average latencies along with capacity, operations and bandwidth (-l).
+	Latency bool
+	// Histograms reports latency histograms instead of capacity, operations and bandwidth (-w).
+	// It cannot be combined with Latency.
+	Histograms bool
+	// Count stops after this many samples, zero means sampling until the context is done.
+	Count int
+}
+
+// IostatSample is the I/O statistics of a zpool over one interval.
+// The first sample reports averages since the pool was imported.
+type IostatSample struct {
+	Time time.Time
+	// Stats holds the statistics of the pool, followed by its vdevs if IostatOptions.Vdevs is set.
+	Stats []*IostatStats
+}
+
+// IostatStats is the I/O statistics of a pool or vdev. Operations and bandwidth are per second.
+type IostatStats struct {
+	Name       string
+	Allocated  uint64
+	Free       uint64
+	ReadOps    uint64
+	WriteOps   uint64
+	ReadBytes  uint64
+	WriteBytes uint64
+	// Latency holds the average latencies if IostatOptions.Latency is set.
+	Latency *IostatLatency
+	// Histogram holds the latency histogram if IostatOptions.Histograms is set.
+	Histogram []IostatBucket
+}
+
+// IostatLatency is the average latency of I/O operations, as reported by zpool iostat -l.
+// Latencies which are not reported by the installed version of ZFS are zero.
+type IostatLatency struct {
+	TotalWaitRead   time.Duration
+	TotalWaitWrite  time.Duration
+	DiskWaitRead    time.Duration
+	DiskWaitWrite   time.Duration
+	SyncQueueRead   time.Duration
+	SyncQueueWrite  time.Duration
+	AsyncQueueRead  time.Duration
+	AsyncQueueWrite time.Duration
+	Scrub           time.Duration
+	Trim            time.Duration
+	Rebuild         time.Duration
+}
+
+func (l *IostatLatency) fields() []*time.Duration {
+	return []*time.Duration{
+		&l.TotalWaitRead, &l.TotalWaitWrite, &l.DiskWaitRead, &l.DiskWaitWrite, &l.SyncQueueRead, &l.SyncQueueWrite,
+		&l.AsyncQueueRead, &l.AsyncQueueWrite, &l.Scrub, &l.Trim, &l.Rebuild,
+	}
+}
+
+// IostatBucket is a bucket of a latency histogram, as reported by zpool iostat -w.
+type IostatBucket struct {
+	// Latency is the upper bound of the bucket.
+	Latency time.Duration
+	// Counts holds the number of operations in the bucket, in the order of the fields of IostatLatency.
+	Counts []uint64
+}
+
+func (o *IostatOptions) args(pool string, interval time.Duration) ([]string, error) {
+	if interval <= 0 {
+		return nil, errors.New("interval must be positive")
+	}
+	if o.Latency && o.Histograms {
+		return nil, errors.New("latency and histograms cannot be reported together")
+	}
+	if o.Count < 0 {
+		return nil, errors.New("count must not be negative")
+	}
+	args := []string{"iostat", "-T", "u", "-H", "-p"}
+	if o.Vdevs {
+		args = append(args, "-v")
+	}
+	if o.Latency {
+		args = append(args, "-l")
+	}
+	if o.Histograms {
+		args = append(args, "-w")
+	}
+	args = append(args, pool, strconv.FormatFloat(interval.Seconds(), 'f', -1, 64))
+	if o.Count > 0 {
+		args = append(args, strconv.Itoa(o.Count))
+	}
+	return args, nil
+}
+
+// IostatStream runs zpool iostat, which samples the I/O statistics of the zpool every interval, and delivers the
+// samples on the returned channel, as configured by opts, until ctx becomes done or opts.Count samples were taken.
+//
+// The samples channel is closed when sampling stops, after which the error channel yields the reason,
+// which is nil if all samples were taken, or ctx.Err() if ctx became done. The Runner of ctx must implement StreamRunner.
+func (z *Zpool) IostatStream(ctx context.Context, interval time.Duration, opts IostatOptions) (<-chan *IostatSample, <-chan error) {
+	samples := make(chan *IostatSample)
+	errc := make(chan error, 1)
+	go func() {
+		defer close(errc)
+		defer close(samples)
+		args, err := opts.args(z.Name, interval)
+		if err != nil {
+			errc <- err
+			return
+		}
+		errc <- streamOutput(ctx, command{Command: "zpool"}, args, func(r io.Reader) error {
+			return readIostat(r, opts.Histograms, func(s *IostatSample) bool {
+				select {
+				case samples <- s:
+					return true
+				case <-ctx.Done():
+					return false
+				}
+			})
+		})
+	}()
+	return samples, errc
+}
+
+// example input for readIostat
+// 1627207200
+// tank	1073741824	9663676416	3	10	12288	409600
+// mirror-0	1073741824	9663676416	3	10	12288	409600
+//
+// example input for readIostat with histograms
+// 1627207200
+// tank
+// 1	0	0	0	0	0	0	0	0	0	0
+// 3	0	2	0	1	0	0	0	0	0	0
+
+// readIostat parses the output of zpool iostat -T u -H -p from r and calls emit for every sample,
+// until r is exhausted or emit returns false.
+//
+// A sample is emitted once it has as many lines as the first one, or else when the next sample starts.
+func readIostat(r io.Reader, histograms bool, emit func(*IostatSample) bool) error {
+	scanner := bufio.NewScanner(r)
+
+	var sample *IostatSample
+	var lines, expected int
+	flush := func() bool {
+		if sample == nil {
+			return true
+		}
+		s := sample
+		if expected == 0 {
+			expected = lines
+		}
+		sample, lines = nil, 0
+		return emit(s)
+	}
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if secs, err := strconv.ParseInt(line, 10, 64); err == nil {
+			if !flush() {
+				return nil
+			}
+			sample = &IostatSample{Time: time.Unix(secs, 0)}
+			continue
+		}
+		if sample == nil {
+			return fmt.Errorf("unexpected iostat line %q before timestamp", line)
+		}
+		lines++
+
+		fields := strings.Split(line, "\t")
+		var err error
+		switch {
+		case !histograms:
+			if len(fields) < 7 {
+				return fmt.Errorf("invalid iostat line %q", line)
+			}
+			var s *IostatStats
+			if s, err = parseIostatStats(fields); err == nil {
+				sample.Stats = append(sample.Stats, s)
+			}
+		case len(fields) == 1:
+			sample.Stats = append(sample.Stats, &IostatStats{Name: fields[0]})
+		case len(sample.Stats) == 0:
+			return fmt.Errorf("unexpected iostat histogram line %q", line)
+		default:
+			s := sample.Stats[len(sample.Stats)-1]
+			var b IostatBucket
+			if b, err = parseIostatBucket(fields); err == nil {
+				s.Histogram = append(s.Histogram, b)
+			}
+		}
+		if err != nil {
+			return err
+		}
+		if lines == expected && !flush() {
+			return nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	flush()
+	return nil
+}
+
+func parseIostatStats(fields []string) (*IostatStats, error) {
+	s := &IostatStats{Name: fields[0]}
+	for i, field := range []*uint64{&s.Allocated, &s.Free, &s.ReadOps, &s.WriteOps, &s.ReadBytes, &s.WriteBytes} {
+		if err := setUint(field, strings.TrimSpace(fields[i+1])); err != nil {
+			return nil, fmt.Errorf("invalid iostat of %s: %w", s.Name, err)
+		}
+	}
+	if len(fields) == 7 {
+		return s, nil
+	}
+
+	s.Latency = &IostatLatency{}
+	for i, field := range s.Latency.fields() {
+		if 7+i >= len(fields) {
+			break
+		}
+		var ns uint64
+		if err := setUint(&ns, strings.TrimSpace(fields[7+i])); err != nil {
+			return nil, fmt.Errorf("invalid iostat latency of %s: %w", s.Name, err)
+		}
+		*field = time.Duration(ns)
+	}
+	return s, nil
+}
+
+func parseIostatBucket(fields []string) (IostatBucket, error) {
+	var b IostatBucket
+	ns, err := strconv.ParseUint(strings.TrimSpace(fields[0]), 10, 64)
+	if err != nil {
+		return b, fmt.Errorf("invalid iostat histogram bucket %q: %w", fields[0], err)
+	}
+	b.Latency = time.Duration(ns)
+	b.Counts = make([]uint64, len(fields)-1)
+	for i, field := range fields[1:] {
+		if err := setUint(&b.Counts[i], strings.TrimSpace(field)); err != nil {
+			return b, fmt.Errorf("invalid iostat histogram count: %w", err)
+		}
+	}
+	return b, nil
+}
@@ -0,0 +1,89 @@
+package zfs
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const iostatOutput = `1627207200
+tank	1073741824	9663676416	3	10	12288	409600
+mirror-0	1073741824	9663676416	3	10	12288	409600
+1627207205
+tank	1073741824	9663676416	0	2	0	8192
+mirror-0	1073741824	9663676416	0	2	0	8192
+`
+
+func TestReadIostat(t *testing.T) {
+	var samples []*IostatSample
+	collect := func(s *IostatSample) bool {
+		samples = append(samples, s)
+		return true
+	}
+	if err := readIostat(strings.NewReader(iostatOutput), false, collect); err != nil {
+		t.Fatal(err)
+	}
+	want := []*IostatSample{
+		{Time: time.Unix(1627207200, 0), Stats: []*IostatStats{
+			{Name: "tank", Allocated: 1073741824, Free: 9663676416, ReadOps: 3, WriteOps: 10, ReadBytes: 12288, WriteBytes: 409600},
+			{Name: "mirror-0", Allocated: 1073741824, Free: 9663676416, ReadOps: 3, WriteOps: 10, ReadBytes: 12288, WriteBytes: 409600},
+		}},
+		{Time: time.Unix(1627207205, 0), Stats: []*IostatStats{
+			{Name: "tank", Allocated: 1073741824, Free: 9663676416, WriteOps: 2, WriteBytes: 8192},
+			{Name: "mirror-0", Allocated: 1073741824, Free: 9663676416, WriteOps: 2, WriteBytes: 8192},
+		}},
+	}
+	if !reflect.DeepEqual(want, samples) {
+		t.Fatalf("want: %+v, got: %+v", want, samples)
+	}
+
+	samples = nil
+	latency := "1627207200\ntank\t1024\t2048\t1\t2\t3\t4\t100\t200\t50\t150\t-\t-\t10\t20\t0\t0\n"
+	if err := readIostat(strings.NewReader(latency), false, collect); err != nil {
+		t.Fatal(err)
+	}
+	wantLatency := &IostatLatency{TotalWaitRead: 100, TotalWaitWrite: 200, DiskWaitRead: 50, DiskWaitWrite: 150, AsyncQueueRead: 10, AsyncQueueWrite: 20}
+	if got := samples[0].Stats[0].Latency; !reflect.DeepEqual(wantLatency, got) {
+		t.Fatalf("want: %+v, got: %+v", wantLatency, got)
+	}
+
+	samples = nil
+	histograms := "1627207200\ntank\n1\t0\t0\t0\t0\n3\t4\t2\t1\t0\n\n1627207205\ntank\n1\t0\t0\t0\t0\n3\t0\t1\t0\t0\n"
+	if err := readIostat(strings.NewReader(histograms), true, collect); err != nil {
+		t.Fatal(err)
+	}
+	if len(samples) != 2 {
+		t.Fatalf("want 2 samples, got %d", len(samples))
+	}
+	wantHistogram := []IostatBucket{{Latency: 1, Counts: []uint64{0, 0, 0, 0}}, {Latency: 3, Counts: []uint64{4, 2, 1, 0}}}
+	if got := samples[0].Stats[0]; got.Name != "tank" || !reflect.DeepEqual(wantHistogram, got.Histogram) {
+		t.Fatalf("want: %+v, got: %+v", wantHistogram, got.Histogram)
+	}
+}
+
+func TestIostatStream(t *testing.T) {
+	r := &fakeStreamRunner{fakeRunner: fakeRunner{output: func([]string) (string, error) { return iostatOutput, nil }}}
+	z := &Zpool{Name: "tank"}
+	samples, errc := z.IostatStream(WithRunner(context.Background(), r), 5*time.Second, IostatOptions{Vdevs: true, Count: 2})
+
+	n := 0
+	for range samples {
+		n++
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatalf("want 2 samples, got %d", n)
+	}
+	if want := [][]string{{"zpool", "iostat", "-T", "u", "-H", "-p", "-v", "tank", "5", "2"}}; !reflect.DeepEqual(want, r.calls) {
+		t.Fatalf("want calls: %q, got: %q", want, r.calls)
+	}
+
+	_, errc = z.IostatStream(WithRunner(context.Background(), r), time.Second, IostatOptions{Latency: true, Histograms: true})
+	if err := <-errc; err == nil {
+		t.Fatal("expected error combining latency and histograms")
+	}
+}
@@ -0,0 +1,195 @@
+package zfs
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrNoVdevLabel is returned by ReadVdevLabel for devices without a valid ZFS label.
+var ErrNoVdevLabel = errors.New("device has no vdev label")
+
+// Pool states recorded in vdev labels.
+const (
+	LabelStateActive    = "active"
+	LabelStateExported  = "exported"
+	LabelStateDestroyed = "destroyed"
+	LabelStateSpare     = "spare"
+	LabelStateL2Cache   = "l2cache"
+)
+
+var labelStates = []string{LabelStateActive, LabelStateExported, LabelStateDestroyed, LabelStateSpare, LabelStateL2Cache}
+
+// VdevLabel is the on-disk label of a device which is, or was, part of a zpool, as printed by zdb -l.
+// Labels of spare and cache devices only record their state and guid.
+type VdevLabel struct {
+	// Pool and PoolGUID are the name and guid of the pool the device belongs to.
+	Pool     string
+	PoolGUID uint64
+	// State is the state of the pool when the label was written, one of the LabelState constants.
+	State string
+	// TXG is the transaction group in which the label was written.
+	TXG uint64
+	// Hostname and HostID identify the system which last imported the pool.
+	Hostname string
+	HostID   uint64
+	// GUID is the guid of the device itself, TopGUID that of the top-level vdev it is part of.
+	GUID    uint64
+	TopGUID uint64
+	Version uint64
+	// Labels are the indexes of the four copies of the label on the device which were read, a missing
+	// index means that copy is damaged or differs from the others.
+	Labels []int
+}
+
+// ReadVdevLabel reads the label of a device with zdb -l, e.g. to find out whether a disk still belongs to a pool
+// before reusing it. ErrNoVdevLabel is returned if none of the copies of the label could be read.
+//
+// A full description of zdb may be found in the ZFS manual:
+// https://openzfs.github.io/openzfs-docs/man/8/zdb.8.html.
+func ReadVdevLabel(device string) (*VdevLabel, error) {
+	return ReadVdevLabelContext(context.Background(), device)
+}
+
+// ReadVdevLabelContext is like ReadVdevLabel but includes a context.
+func ReadVdevLabelContext(ctx context.Context, device string) (*VdevLabel, error) {
+	var out bytes.Buffer
+	c := command{Command: "zdb", Stdout: &out}
+	if _, err := c.Run(ctx, "-l", device); err != nil {
+		// zdb exits with 2 if it could open the device but found no label on it
+		var zerr *Error
+		if errors.As(err, &zerr) && zerr.ExitCode == 2 {
+			return nil, fmt.Errorf("%s: %w", device, ErrNoVdevLabel)
+		}
+		return nil, err
+	}
+	return parseVdevLabel(out.Bytes())
+}
+
+// example input for parseVdevLabel
+// ------------------------------------
+// LABEL 0
+// ------------------------------------
+//     version: 5000
+//     name: 'tank'
+//     state: 1
+//     txg: 1234
+//     pool_guid: 1234567890123456789
+//     errata: 0
+//     hostid: 2831164162
+//     hostname: 'storage1'
+//     top_guid: 9876543210987654321
+//     guid: 5555555555555555555
+//     vdev_children: 1
+//     vdev_tree:
+//         type: 'mirror'
+//         id: 0
+//         guid: 9876543210987654321
+//     features_for_read:
+//         com.delphix:hole_birth
+//     labels = 0 1 2 3
+
+func parseVdevLabel(out []byte) (*VdevLabel, error) {
+	l := &VdevLabel{}
+	var read, listed []int
+	index, fields := -1, 0
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		line := sc.Text()
+		if strings.HasPrefix(line, "LABEL ") {
+			if i, err := strconv.Atoi(strings.TrimSpace(line[6:])); err == nil {
+				index = i
+			}
+			continue
+		}
+		// nested values, such as those of the vdev tree, are indented further
+		if !strings.HasPrefix(line, "    ") || strings.HasPrefix(line, "     ") {
+			continue
+		}
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "labels = ") {
+			for _, f := range strings.Fields(line[9:]) {
+				i, err := strconv.Atoi(f)
+				if err != nil {
+					return nil, fmt.Errorf("invalid label list %q", line)
+				}
+				listed = append(listed, i)
+			}
+			continue
+		}
+		parts := strings.SplitN(line, ": ", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		if index >= 0 && (len(read) == 0 || read[len(read)-1] != index) {
+			read = append(read, index)
+		}
+		fields++
+		// only the first label is parsed, the others are copies of it
+		if len(read) > 1 {
+			continue
+		}
+
+		key, value := parts[0], strings.Trim(parts[1], "'")
+		var err error
+		switch key {
+		case "name":
+			l.Pool = value
+		case "hostname":
+			l.Hostname = value
+		case "state":
+			var state uint64
+			state, err = strconv.ParseUint(value, 10, 64)
+			if err == nil && state < uint64(len(labelStates)) {
+				l.State = labelStates[state]
+			} else if err == nil {
+				err = fmt.Errorf("unknown state %d", state)
+			}
+		case "pool_guid":
+			err = setUint(&l.PoolGUID, value)
+		case "txg":
+			err = setUint(&l.TXG, value)
+		case "hostid":
+			err = setUint(&l.HostID, value)
+		case "guid":
+			err = setUint(&l.GUID, value)
+		case "top_guid":
+			err = setUint(&l.TopGUID, value)
+		case "version":
+			err = setUint(&l.Version, value)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid label field %s: %w", key, err)
+		}
+	}
+	if fields == 0 {
+		return nil, ErrNoVdevLabel
+	}
+	l.Labels = read
+	if listed != nil {
+		l.Labels = listed
+	}
+	return l, nil
+}
+
+// LabelClear removes the ZFS label from a device, e.g. before reusing a disk of a destroyed or exported pool.
+// Devices which are part of an active pool, or of an exported pool if force is not set, are not cleared (-f).
+func (z *Zpool) LabelClear(device string, force bool) error {
+	return z.LabelClearContext(context.Background(), device, force)
+}
+
+// LabelClearContext is like LabelClear but includes a context.
+func (z *Zpool) LabelClearContext(ctx context.Context, device string, force bool) error {
+	if device == "" {
+		return errors.New("no device to clear given")
+	}
+	args := []string{"labelclear"}
+	if force {
+		args = append(args, "-f")
+	}
+	return zpool(ctx, append(args, device)...)
+}
@@ -0,0 +1,126 @@
+package zfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+const vdevLabel = `------------------------------------
+LABEL 0
+------------------------------------
+    version: 5000
+    name: 'tank'
+    state: 1
+    txg: 1234
+    pool_guid: 1234567890123456789
+    errata: 0
+    hostid: 2831164162
+    hostname: 'storage1'
+    top_guid: 9876543210987654321
+    guid: 5555555555555555555
+    vdev_children: 1
+    vdev_tree:
+        type: 'mirror'
+        id: 0
+        guid: 9876543210987654321
+        children[0]:
+            type: 'disk'
+            guid: 5555555555555555555
+            path: '/dev/sda1'
+    features_for_read:
+        com.delphix:hole_birth
+    labels = 0 1 3
+------------------------------------
+LABEL 2
+------------------------------------
+    version: 5000
+    name: 'old'
+    state: 2
+    txg: 10
+    labels = 2
+`
+
+func TestReadVdevLabel(t *testing.T) {
+	ctx, r := withFakeRunner(vdevLabel)
+	got, err := ReadVdevLabelContext(ctx, "/dev/sda1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &VdevLabel{
+		Pool:     "tank",
+		PoolGUID: 1234567890123456789,
+		State:    LabelStateExported,
+		TXG:      1234,
+		Hostname: "storage1",
+		HostID:   2831164162,
+		GUID:     5555555555555555555,
+		TopGUID:  9876543210987654321,
+		Version:  5000,
+		Labels:   []int{0, 1, 3, 2},
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("want: %+v, got: %+v", want, got)
+	}
+	if want := []string{"zdb", "-l", "/dev/sda1"}; !reflect.DeepEqual(want, r.calls[0]) {
+		t.Fatalf("want: %q, got: %q", want, r.calls[0])
+	}
+}
+
+func TestReadVdevLabelSpare(t *testing.T) {
+	ctx, _ := withFakeRunner("------------------------------------\nLABEL 0\n------------------------------------\n" +
+		"    version: 5000\n    state: 3\n    guid: 42\nLABEL 1\n    version: 5000\n    state: 3\n    guid: 42\n")
+	got, err := ReadVdevLabelContext(ctx, "/dev/sdd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &VdevLabel{State: LabelStateSpare, GUID: 42, Version: 5000, Labels: []int{0, 1}}
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("want: %+v, got: %+v", want, got)
+	}
+}
+
+// exitError is an error of a command which exited with the given code.
+type exitError int
+
+func (e exitError) Error() string { return fmt.Sprintf("exit status %d", int(e)) }
+
+func (e exitError) ExitCode() int { return int(e) }
+
+func TestReadVdevLabelMissing(t *testing.T) {
+	r := &fakeRunner{output: func(args []string) (string, error) {
+		return "", exitError(2)
+	}}
+	_, err := ReadVdevLabelContext(WithRunner(context.Background(), r), "/dev/sde")
+	if !errors.Is(err, ErrNoVdevLabel) {
+		t.Fatalf("want ErrNoVdevLabel, got: %v", err)
+	}
+
+	r.output = func(args []string) (string, error) {
+		return "", exitError(1)
+	}
+	_, err = ReadVdevLabelContext(WithRunner(context.Background(), r), "/dev/missing")
+	if err == nil || errors.Is(err, ErrNoVdevLabel) {
+		t.Fatalf("want error opening device, got: %v", err)
+	}
+}
+
+func TestLabelClear(t *testing.T) {
+	ctx, r := withFakeRunner("")
+	z := &Zpool{Name: "tank"}
+	if err := z.LabelClearContext(ctx, "/dev/sda1", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := z.LabelClearContext(ctx, "/dev/sdb1", true); err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{{"zpool", "labelclear", "/dev/sda1"}, {"zpool", "labelclear", "-f", "/dev/sdb1"}}
+	if !reflect.DeepEqual(want, r.calls) {
+		t.Fatalf("want: %q, got: %q", want, r.calls)
+	}
+	if err := z.LabelClearContext(ctx, "", false); err == nil {
+		t.Fatal("expected error without device")
+	}
+}
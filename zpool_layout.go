@@ -0,0 +1,273 @@
+package zfs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ZpoolLayoutVersion is the version of the JSON schema of ZpoolLayout written by this package.
+// Layouts of a later version are rejected by ParseZpoolLayout.
+const ZpoolLayoutVersion = 1
+
+// ZpoolLayout is a machine-readable description of a zpool, sufficient to create a pool of the same layout on
+// another machine, e.g. as part of a disaster-recovery runbook. Its JSON encoding is stable, fields are only
+// added in later versions.
+type ZpoolLayout struct {
+	Version int    `json:"version"`
+	Name    string `json:"name"`
+	// Topology holds the vdevs of the pool by their full device paths.
+	Topology VdevSpec `json:"topology"`
+	// Properties are the pool properties set locally, such as ashift or autotrim, without feature flags and
+	// without those which only apply to the current import: altroot, cachefile and readonly.
+	Properties map[string]string `json:"properties,omitempty"`
+	// Features are the names of the enabled or active feature flags, without the feature@ prefix, sorted by name.
+	Features []string `json:"features"`
+}
+
+// importProperties are the pool properties which are set locally by importing a pool rather than its creation.
+var importProperties = map[string]bool{"altroot": true, "cachefile": true, "readonly": true}
+
+// Layout returns the layout of the zpool, from zpool status and the properties of the pool.
+// Devices which are being replaced are recorded by the name of their replacement, devices replaced by a hot
+// spare by their own name.
+func (z *Zpool) Layout() (*ZpoolLayout, error) {
+	return z.LayoutContext(context.Background())
+}
+
+// LayoutContext is like Layout but includes a context.
+func (z *Zpool) LayoutContext(ctx context.Context) (*ZpoolLayout, error) {
+	status, err := z.StatusWithOptionsContext(ctx, StatusOptions{FullPaths: true})
+	if err != nil {
+		return nil, err
+	}
+	topology, err := statusTopology(status)
+	if err != nil {
+		return nil, err
+	}
+	props, err := z.GetAllPropertiesContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	l := &ZpoolLayout{Version: ZpoolLayoutVersion, Name: z.Name, Topology: *topology, Features: []string{}}
+	for name, prop := range props {
+		if strings.HasPrefix(name, "feature@") {
+			if prop.Value == FeatureEnabled || prop.Value == FeatureActive {
+				l.Features = append(l.Features, strings.TrimPrefix(name, "feature@"))
+			}
+			continue
+		}
+		if prop.Source != SourceLocal || importProperties[name] {
+			continue
+		}
+		if l.Properties == nil {
+			l.Properties = map[string]string{}
+		}
+		l.Properties[name] = prop.Value
+	}
+	sort.Strings(l.Features)
+	return l, nil
+}
+
+// statusTopology returns the vdevs of the pool of status as a VdevSpec.
+func statusTopology(status *ZpoolStatus) (*VdevSpec, error) {
+	if status.Config == nil {
+		return nil, fmt.Errorf("status of %s has no vdevs", status.Name)
+	}
+	spec := &VdevSpec{}
+	var err error
+	if spec.Data, err = vdevGroups(status.Config.Children); err != nil {
+		return nil, err
+	}
+	if spec.Logs, err = vdevGroups(status.Logs); err != nil {
+		return nil, err
+	}
+	if spec.Special, err = vdevGroups(status.Special); err != nil {
+		return nil, err
+	}
+	if spec.Dedup, err = vdevGroups(status.Dedup); err != nil {
+		return nil, err
+	}
+	for _, v := range status.Cache {
+		spec.Cache = append(spec.Cache, v.Name)
+	}
+	for _, v := range status.Spares {
+		// distributed spares are part of their draid vdev
+		if !IsDistributedSpare(v.Name) {
+			spec.Spares = append(spec.Spares, v.Name)
+		}
+	}
+	return spec, nil
+}
+
+// vdevGroups returns the top-level vdevs as VdevGroups.
+func vdevGroups(vdevs []*Vdev) ([]VdevGroup, error) {
+	var groups []VdevGroup
+	for _, v := range vdevs {
+		g := VdevGroup{Type: VdevType(v.Name)}
+		if g.Type == VdevDisk && len(v.Children) > 0 {
+			// zpool create -n does not number the vdevs, e.g. mirror rather than mirror-0
+			g.Type = VdevType(v.Name + "-0")
+		}
+		switch g.Type {
+		case VdevSpare, VdevReplacing:
+			groups = append(groups, Disk(leafDevice(v)))
+			continue
+		case VdevDraid1, VdevDraid2, VdevDraid3:
+			c, err := ParseDraidName(v.Name)
+			if err != nil {
+				return nil, err
+			}
+			g.DraidData, g.DraidSpares = c.Data, c.Spares
+		}
+		if g.Type == VdevDisk {
+			g.Devices = []string{v.Name}
+		} else {
+			for _, child := range v.Children {
+				g.Devices = append(g.Devices, leafDevice(child))
+			}
+		}
+		groups = append(groups, g)
+	}
+	return groups, nil
+}
+
+// leafDevice returns the device a leaf vdev, or a vdev grouping a device with its replacement, stands for:
+// the original device of a spare vdev, which the hot spare only stands in for, or the new device of a replacing vdev.
+func leafDevice(v *Vdev) string {
+	if len(v.Children) == 0 {
+		return v.Name
+	}
+	switch VdevType(v.Name) {
+	case VdevSpare:
+		return leafDevice(v.Children[0])
+	case VdevReplacing:
+		return leafDevice(v.Children[len(v.Children)-1])
+	}
+	return v.Name
+}
+
+// ParseZpoolLayout parses the JSON encoding of a ZpoolLayout and validates its topology.
+func ParseZpoolLayout(data []byte) (*ZpoolLayout, error) {
+	l := &ZpoolLayout{}
+	if err := json.Unmarshal(data, l); err != nil {
+		return nil, fmt.Errorf("invalid pool layout: %w", err)
+	}
+	if l.Version < 1 || l.Version > ZpoolLayoutVersion {
+		return nil, fmt.Errorf("unsupported pool layout version %d", l.Version)
+	}
+	if err := l.Topology.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid pool layout: %w", err)
+	}
+	return l, nil
+}
+
+// CreateFromLayoutOptions are the options of CreateZpoolFromLayout.
+//
+// A full description of these options may be found in the ZFS manual:
+// https://openzfs.github.io/openzfs-docs/man/8/zpool-create.8.html.
+type CreateFromLayoutOptions struct {
+	// Name is the name of the new pool, that of the layout if empty.
+	Name string
+	// Devices maps the devices of the layout to those of the new pool. If set, every device must be mapped,
+	// otherwise the devices of the layout are used as they are.
+	Devices map[string]string
+	// DefaultFeatures enables all features supported by the new pool, rather than only the features of the layout
+	// (-d), which keeps the pool importable by the ZFS version it was described on.
+	DefaultFeatures bool
+	// Force uses devices which appear to be in use (-f).
+	Force bool
+}
+
+// CreateZpoolFromLayout creates a new zpool with the topology, properties and features of a layout, e.g. one
+// written by Layout on another machine.
+func CreateZpoolFromLayout(layout *ZpoolLayout, opts CreateFromLayoutOptions) (*Zpool, error) {
+	return CreateZpoolFromLayoutContext(context.Background(), layout, opts)
+}
+
+// CreateZpoolFromLayoutContext is like CreateZpoolFromLayout but includes a context.
+func CreateZpoolFromLayoutContext(ctx context.Context, layout *ZpoolLayout, opts CreateFromLayoutOptions) (*Zpool, error) {
+	name := opts.Name
+	if name == "" {
+		name = layout.Name
+	}
+	if name == "" {
+		return nil, errors.New("no pool name given")
+	}
+	spec, err := layout.Topology.mapDevices(opts.Devices)
+	if err != nil {
+		return nil, err
+	}
+	vdevs, err := spec.Args()
+	if err != nil {
+		return nil, err
+	}
+	if err := requireDraid(ctx, spec); err != nil {
+		return nil, err
+	}
+
+	args := []string{"create"}
+	if opts.Force {
+		args = append(args, "-f")
+	}
+	props := make(map[string]string, len(layout.Properties)+len(layout.Features))
+	for k, v := range layout.Properties {
+		props[k] = v
+	}
+	if !opts.DefaultFeatures {
+		args = append(args, "-d")
+		for _, f := range layout.Features {
+			props["feature@"+f] = FeatureEnabled
+		}
+	}
+	args = append(args, propsSlice(props)...)
+	args = append(append(args, name), vdevs...)
+	if err := zpool(ctx, args...); err != nil {
+		return nil, err
+	}
+	return &Zpool{Name: name}, nil
+}
+
+// mapDevices returns a copy of the topology with its devices renamed by devices, which must map every device.
+// The topology itself is returned if devices is nil.
+func (s *VdevSpec) mapDevices(devices map[string]string) (*VdevSpec, error) {
+	if devices == nil {
+		return s, nil
+	}
+	var err error
+	names := func(ds []string) []string {
+		mapped := make([]string, 0, len(ds))
+		for _, d := range ds {
+			to, ok := devices[d]
+			if !ok && err == nil {
+				err = fmt.Errorf("no device given for %s", d)
+			}
+			mapped = append(mapped, to)
+		}
+		return mapped
+	}
+	groups := func(gs []VdevGroup) []VdevGroup {
+		var mapped []VdevGroup
+		for _, g := range gs {
+			g.Devices = names(g.Devices)
+			mapped = append(mapped, g)
+		}
+		return mapped
+	}
+	m := &VdevSpec{
+		Data:    groups(s.Data),
+		Logs:    groups(s.Logs),
+		Special: groups(s.Special),
+		Dedup:   groups(s.Dedup),
+	}
+	if len(s.Cache) > 0 {
+		m.Cache = names(s.Cache)
+	}
+	if len(s.Spares) > 0 {
+		m.Spares = names(s.Spares)
+	}
+	return m, err
+}
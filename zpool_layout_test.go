@@ -0,0 +1,100 @@
+package zfs
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStatusTopology(t *testing.T) {
+	status := &ZpoolStatus{
+		Name: "tank",
+		Config: &Vdev{Name: "tank", Children: []*Vdev{
+			{Name: "mirror-0", Children: []*Vdev{
+				{Name: "/dev/sda"},
+				{Name: "spare-1", Children: []*Vdev{{Name: "/dev/sdb"}, {Name: "/dev/sdz"}}},
+			}},
+			{Name: "draid2:4d:7c:1s-1", Children: []*Vdev{
+				{Name: "/dev/sdc"}, {Name: "/dev/sdd"}, {Name: "/dev/sde"}, {Name: "/dev/sdf"},
+				{Name: "/dev/sdg"}, {Name: "/dev/sdh"},
+				{Name: "replacing-6", Children: []*Vdev{{Name: "/dev/sdi"}, {Name: "/dev/sdj"}}},
+			}},
+		}},
+		Logs:   []*Vdev{{Name: "/dev/nvme0n1"}},
+		Cache:  []*Vdev{{Name: "/dev/nvme1n1"}},
+		Spares: []*Vdev{{Name: "draid2-1-0"}, {Name: "/dev/sdz"}},
+	}
+	got, err := statusTopology(status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &VdevSpec{
+		Data: []VdevGroup{
+			Mirror("/dev/sda", "/dev/sdb"),
+			Draid(2, 4, 1, "/dev/sdc", "/dev/sdd", "/dev/sde", "/dev/sdf", "/dev/sdg", "/dev/sdh", "/dev/sdj"),
+		},
+		Logs:   []VdevGroup{Disk("/dev/nvme0n1")},
+		Cache:  []string{"/dev/nvme1n1"},
+		Spares: []string{"/dev/sdz"},
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("want: %+v, got: %+v", want, got)
+	}
+}
+
+func TestParseZpoolLayout(t *testing.T) {
+	l, err := ParseZpoolLayout([]byte(`{"version":1,"name":"tank","topology":{"data":[{"type":"mirror","devices":["a","b"]}]},"features":["encryption"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &ZpoolLayout{
+		Version:  1,
+		Name:     "tank",
+		Topology: VdevSpec{Data: []VdevGroup{Mirror("a", "b")}},
+		Features: []string{"encryption"},
+	}
+	if !reflect.DeepEqual(want, l) {
+		t.Fatalf("want: %+v, got: %+v", want, l)
+	}
+
+	for _, data := range []string{
+		`{"version":2,"name":"tank","topology":{"data":[{"devices":["a"]}]}}`,
+		`{"version":1,"name":"tank","topology":{}}`,
+		`{"version":1,`,
+	} {
+		if _, err := ParseZpoolLayout([]byte(data)); err == nil {
+			t.Fatalf("expected error parsing %s", data)
+		}
+	}
+}
+
+func TestCreateZpoolFromLayout(t *testing.T) {
+	ctx, r := withFakeRunner("")
+	l := &ZpoolLayout{
+		Version:    1,
+		Name:       "tank",
+		Topology:   VdevSpec{Data: []VdevGroup{Mirror("a", "b")}, Spares: []string{"c"}},
+		Properties: map[string]string{"ashift": "12"},
+		Features:   []string{"encryption"},
+	}
+	devices := map[string]string{"a": "x", "b": "y", "c": "z"}
+	z, err := CreateZpoolFromLayoutContext(ctx, l, CreateFromLayoutOptions{Name: "copy", Devices: devices})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if z.Name != "copy" {
+		t.Fatalf("unexpected pool %s", z.Name)
+	}
+	got := strings.Join(r.calls[len(r.calls)-1], " ")
+	for _, part := range []string{"zpool create -d -o ", "-o ashift=12", "-o feature@encryption=enabled", " copy mirror x y spare z"} {
+		if !strings.Contains(got, part) {
+			t.Fatalf("expected %q in %q", part, got)
+		}
+	}
+
+	delete(devices, "c")
+	if _, err := CreateZpoolFromLayoutContext(ctx, l, CreateFromLayoutOptions{Devices: devices}); err == nil ||
+		!strings.Contains(err.Error(), "no device given for c") {
+		t.Fatalf("expected error for unmapped device, got %v", err)
+	}
+}
@@ -0,0 +1,103 @@
+package zfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// Multihost returns whether the multihost property of the zpool is on. Pools with multihost on are protected
+// against being imported by two systems at once, such as the nodes of a cluster sharing their disks,
+// by multihost protection (MMP), which requires every system to have a unique hostid, see SetHostID.
+func (z *Zpool) Multihost() (bool, error) {
+	return z.MultihostContext(context.Background())
+}
+
+// MultihostContext is like Multihost but includes a context.
+func (z *Zpool) MultihostContext(ctx context.Context) (bool, error) {
+	value, err := z.GetPropertyContext(ctx, "multihost")
+	if err != nil {
+		return false, err
+	}
+	return value == "on", nil
+}
+
+// SetMultihost turns the multihost property of the zpool on or off.
+func (z *Zpool) SetMultihost(enabled bool) error {
+	return z.SetMultihostContext(context.Background(), enabled)
+}
+
+// SetMultihostContext is like SetMultihost but includes a context.
+func (z *Zpool) SetMultihostContext(ctx context.Context, enabled bool) error {
+	value := "off"
+	if enabled {
+		value = "on"
+	}
+	return z.SetPropertyContext(ctx, "multihost", value)
+}
+
+// HostID returns the hostid of the system, as printed by hostid, which identifies it in the labels of the pools it
+// imports.
+func HostID() (uint32, error) {
+	return HostIDContext(context.Background())
+}
+
+// HostIDContext is like HostID but includes a context.
+func HostIDContext(ctx context.Context) (uint32, error) {
+	c := command{Command: "hostid"}
+	out, err := c.Run(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if len(out) != 1 || len(out[0]) != 1 {
+		return 0, fmt.Errorf("unexpected output of hostid: %q", out)
+	}
+	id, err := strconv.ParseUint(out[0][0], 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid hostid %q", out[0][0])
+	}
+	return uint32(id), nil
+}
+
+// SetHostID writes hostid to /etc/hostid with zgenhostid, or a random one if hostid is zero.
+// If force is set, an existing /etc/hostid is overwritten (-f), otherwise it is an error if there is one.
+func SetHostID(hostid uint32, force bool) error {
+	return SetHostIDContext(context.Background(), hostid, force)
+}
+
+// SetHostIDContext is like SetHostID but includes a context.
+func SetHostIDContext(ctx context.Context, hostid uint32, force bool) error {
+	var args []string
+	if force {
+		args = append(args, "-f")
+	}
+	if hostid != 0 {
+		args = append(args, fmt.Sprintf("0x%08x", hostid))
+	}
+	c := command{Command: "zgenhostid"}
+	_, err := c.Run(ctx, args...)
+	return err
+}
+
+var poolInUseRegex = regexp.MustCompile(`(?:on host '([^']*)'|accessed by (\S+)) \(hostid=(?:0x)?([0-9a-fA-F]+)\)`)
+
+// PoolInUseBy returns the host name and hostid of the other system a pool is in use on,
+// from an error of ImportZpool matching ErrPoolInUse or ErrPoolActive. It reports false for other errors.
+func PoolInUseBy(err error) (host string, hostid uint32, ok bool) {
+	var zerr *Error
+	if !errors.As(err, &zerr) || !(zerr.Is(ErrPoolInUse) || zerr.Is(ErrPoolActive)) {
+		return "", 0, false
+	}
+	m := poolInUseRegex.FindStringSubmatch(zerr.Stderr)
+	if m == nil {
+		return "", 0, true
+	}
+	host = m[1] + m[2]
+	if host == "<unknown>" {
+		host = ""
+	}
+	id, _ := strconv.ParseUint(m[3], 16, 32)
+	return host, uint32(id), true
+}
@@ -0,0 +1,72 @@
+package zfs
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestMultihost(t *testing.T) {
+	ctx, r := withFakeRunner("tank\tmultihost\ton\tlocal\n")
+	z := &Zpool{Name: "tank"}
+	on, err := z.MultihostContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !on {
+		t.Fatal("expected multihost on")
+	}
+	if err := z.SetMultihostContext(ctx, false); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"zpool", "set", "multihost=off", "tank"}; !reflect.DeepEqual(want, r.calls[len(r.calls)-1]) {
+		t.Fatalf("want: %q, got: %q", want, r.calls[len(r.calls)-1])
+	}
+}
+
+func TestHostID(t *testing.T) {
+	ctx, r := withFakeRunner("007f0101\n")
+	id, err := HostIDContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 0x007f0101 {
+		t.Fatalf("want hostid 007f0101, got: %08x", id)
+	}
+	if err := SetHostIDContext(ctx, 0x1a2b3c4d, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetHostIDContext(ctx, 0, false); err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{{"hostid"}, {"zgenhostid", "-f", "0x1a2b3c4d"}, {"zgenhostid"}}
+	if !reflect.DeepEqual(want, r.calls) {
+		t.Fatalf("want: %q, got: %q", want, r.calls)
+	}
+}
+
+func TestPoolInUseBy(t *testing.T) {
+	for _, test := range []struct {
+		stderr string
+		host   string
+		hostid uint32
+		ok     bool
+	}{
+		{"cannot import 'tank': pool is imported on host 'node2' (hostid=1a2b3c4d).\n" +
+			"Export the pool on the other system, then run 'zpool import'.\n", "node2", 0x1a2b3c4d, true},
+		{"cannot import 'tank': pool was previously in use from another system.\n" +
+			"Last accessed by node3 (hostid=ff) at Tue Jul 27 10:00:00 2021\n", "node3", 0xff, true},
+		{"cannot import 'tank': pool was previously in use from another system.\n" +
+			"Last accessed by <unknown> (hostid=0) at Tue Jul 27 10:00:00 2021\n", "", 0, true},
+		{"cannot import 'tank': no such pool available\n", "", 0, false},
+	} {
+		err := error(&Error{Err: errors.New("exit status 1"), Stderr: test.stderr, ExitCode: 1})
+		host, hostid, ok := PoolInUseBy(err)
+		if host != test.host || hostid != test.hostid || ok != test.ok {
+			t.Fatalf("want %q, %x, %v for %q, got: %q, %x, %v", test.host, test.hostid, test.ok, test.stderr, host, hostid, ok)
+		}
+	}
+	if _, _, ok := PoolInUseBy(errors.New("pool is imported on host 'node2' (hostid=1)")); ok {
+		t.Fatal("expected no match for other errors")
+	}
+}
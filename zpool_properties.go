@@ -0,0 +1,89 @@
+package zfs
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Property is a single ZFS property of a pool or dataset along with the source of its value,
+// such as "local", "default" or "-" for read-only properties.
+type Property struct {
+	Name   string
+	Value  string
+	Source string
+}
+
+// GetProperty returns the current value of a zpool property, in exact (parsable) format.
+// Feature flags can be queried as "feature@<name>".
+//
+// A full list of available zpool properties may be found in the ZFS manual:
+// https://openzfs.github.io/openzfs-docs/man/7/zpoolprops.7.html.
+func (z *Zpool) GetProperty(name string) (string, error) {
+	return z.GetPropertyContext(context.Background(), name)
+}
+
+// GetPropertyContext is like GetProperty but includes a context.
+func (z *Zpool) GetPropertyContext(ctx context.Context, name string) (string, error) {
+	props, err := getZpoolProperties(ctx, z.Name, name)
+	if err != nil {
+		return "", err
+	}
+	prop, ok := props[name]
+	if !ok {
+		return "", fmt.Errorf("property %s not found on pool %s", name, z.Name)
+	}
+	return prop.Value, nil
+}
+
+// GetAllProperties returns all properties of the zpool, including feature flags, keyed by property name.
+func (z *Zpool) GetAllProperties() (map[string]Property, error) {
+	return z.GetAllPropertiesContext(context.Background())
+}
+
+// GetAllPropertiesContext is like GetAllProperties but includes a context.
+func (z *Zpool) GetAllPropertiesContext(ctx context.Context) (map[string]Property, error) {
+	return getZpoolProperties(ctx, z.Name, "all")
+}
+
+// SetProperty sets a zpool property.
+//
+// A full list of available zpool properties may be found in the ZFS manual:
+// https://openzfs.github.io/openzfs-docs/man/7/zpoolprops.7.html.
+func (z *Zpool) SetProperty(name, value string) error {
+	return z.SetPropertyContext(context.Background(), name, value)
+}
+
+// SetPropertyContext is like SetProperty but includes a context.
+func (z *Zpool) SetPropertyContext(ctx context.Context, name, value string) error {
+	prop := strings.Join([]string{name, value}, "=")
+	return zpool(ctx, "set", prop, z.Name)
+}
+
+func getZpoolProperties(ctx context.Context, pool, props string) (map[string]Property, error) {
+	out, err := zpoolGetOutput(ctx, "get", "-Hp", props, pool)
+	if err != nil {
+		return nil, err
+	}
+	return parsePropertyLines(out)
+}
+
+// example input for parsePropertyLines
+// tank	size	10737418240	-
+// tank	autotrim	off	default
+// tank	feature@async_destroy	enabled	local
+
+func parsePropertyLines(lines [][]string) (map[string]Property, error) {
+	props := make(map[string]Property, len(lines))
+	for i, line := range lines {
+		if len(line) != 4 {
+			return nil, fmt.Errorf("failed to parse line %d of property output: expected 4 fields, got %d", i, len(line))
+		}
+		props[line[1]] = Property{
+			Name:   line[1],
+			Value:  line[2],
+			Source: line[3],
+		}
+	}
+	return props, nil
+}
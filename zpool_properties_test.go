@@ -0,0 +1,29 @@
+package zfs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePropertyLines(t *testing.T) {
+	got, err := parsePropertyLines([][]string{
+		{"tank", "size", "10737418240", "-"},
+		{"tank", "comment", "", "default"},
+		{"tank", "feature@async_destroy", "enabled", "local"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]Property{
+		"size":                  {Name: "size", Value: "10737418240", Source: "-"},
+		"comment":               {Name: "comment", Value: "", Source: "default"},
+		"feature@async_destroy": {Name: "feature@async_destroy", Value: "enabled", Source: "local"},
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("want: %v, got: %v", want, got)
+	}
+
+	if _, err := parsePropertyLines([][]string{{"tank", "size"}}); err == nil {
+		t.Fatal("expected error for short line")
+	}
+}
@@ -0,0 +1,114 @@
+package zfs
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ResilverStatus is the progress of the most recent resilver of a zpool.
+// State is one of the ScanState constants, ScanStateNone is reported if the pool has never been resilvered
+// or if the most recent scan of the pool was a scrub.
+type ResilverStatus struct {
+	State         string
+	Start         time.Time
+	End           time.Time
+	Scanned       uint64
+	Issued        uint64
+	Total         uint64
+	ScanRate      uint64
+	IssueRate     uint64
+	Resilvered    uint64
+	PercentDone   float64
+	TimeRemaining time.Duration
+	// EstimatedEnd is the time the resilver in progress is estimated to finish at, zero if it is not known.
+	EstimatedEnd time.Time
+	Errors       uint64
+	// Devices are the names of the leaf vdevs being resilvered.
+	Devices []string
+	// Deferred is set if devices are awaiting a resilver, which starts once the one in progress is finished
+	// or when it is restarted with Resilver. Deferred devices are not included in Devices.
+	Deferred bool
+}
+
+// Resilver starts a resilver of the zpool, restarting the resilver in progress from the beginning along with any
+// deferred resilver. It requires the resilver_defer feature, ErrNotSupported is returned if it is known to be
+// missing.
+func (z *Zpool) Resilver() error {
+	return z.ResilverContext(context.Background())
+}
+
+// ResilverContext is like Resilver but includes a context.
+func (z *Zpool) ResilverContext(ctx context.Context) error {
+	if caps := knownCapabilities(ctx); caps != nil && !caps.ResilverDefer {
+		return fmt.Errorf("zpool resilver: %w", ErrNotSupported)
+	}
+	return zpool(ctx, "resilver", z.Name)
+}
+
+// ResilverStatus returns the progress of the most recent resilver of the zpool. The devices being resilvered are
+// known from the notes zpool status prints for them, so the columnar output is parsed even if JSON output is
+// supported.
+func (z *Zpool) ResilverStatus() (*ResilverStatus, error) {
+	return z.ResilverStatusContext(context.Background())
+}
+
+// ResilverStatusContext is like ResilverStatus but includes a context.
+func (z *Zpool) ResilverStatusContext(ctx context.Context) (*ResilverStatus, error) {
+	out, err := zpoolRawOutput(ctx, "status", "-v", "-p", "-t", z.Name)
+	if err != nil {
+		return nil, err
+	}
+	statuses, err := parseZpoolStatus(string(out))
+	if err != nil {
+		return nil, err
+	}
+	if len(statuses) != 1 {
+		return nil, fmt.Errorf("expected status of 1 pool, got %d", len(statuses))
+	}
+	return newResilverStatus(statuses[0], time.Now()), nil
+}
+
+func newResilverStatus(status *ZpoolStatus, now time.Time) *ResilverStatus {
+	r := &ResilverStatus{State: ScanStateNone}
+	var walk func(vdevs []*Vdev)
+	walk = func(vdevs []*Vdev) {
+		for _, v := range vdevs {
+			switch {
+			case strings.Contains(v.Message, "(awaiting resilver)"):
+				r.Deferred = true
+			case strings.Contains(v.Message, "(resilvering)") && len(v.Children) == 0:
+				r.Devices = append(r.Devices, v.Name)
+			}
+			walk(v.Children)
+		}
+	}
+	if status.Config != nil {
+		walk([]*Vdev{status.Config})
+	}
+	walk(status.Logs)
+	walk(status.Special)
+	walk(status.Dedup)
+
+	scan := &status.Scan
+	if scan.Function != ScanFunctionResilver {
+		return r
+	}
+	r.State = scan.State
+	r.Start = scan.Start
+	r.End = scan.End
+	r.Scanned = scan.Scanned
+	r.Issued = scan.Issued
+	r.Total = scan.Total
+	r.ScanRate = scan.ScanRate
+	r.IssueRate = scan.IssueRate
+	r.Resilvered = scan.Repaired
+	r.PercentDone = scan.PercentDone
+	r.TimeRemaining = scan.TimeRemaining
+	r.Errors = scan.Errors
+	if scan.State == ScanStateInProgress && scan.TimeRemaining > 0 {
+		r.EstimatedEnd = now.Add(scan.TimeRemaining)
+	}
+	return r
+}
@@ -0,0 +1,102 @@
+package zfs
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const statusResilvering = `  pool: tank
+ state: DEGRADED
+status: One or more devices is currently being resilvered.  The pool will
+	continue to function, possibly in a degraded state.
+action: Wait for the resilver to complete.
+  scan: resilver in progress since Sun Jul 25 10:00:00 2021
+	1.50G scanned at 100M/s, 512M issued at 50M/s, 10G total
+	500M resilvered, 5.00% done, 00:10:00 to go
+config:
+
+	NAME             STATE     READ WRITE CKSUM
+	tank             DEGRADED     0     0     0
+	  mirror-0       DEGRADED     0     0     0
+	    sda          ONLINE       0     0     0
+	    replacing-1  DEGRADED     0     0     0
+	      sdb        UNAVAIL      0     0     0  was /dev/sdb1
+	      sdc        ONLINE       0     0     0  (resilvering)
+	  mirror-1       ONLINE       0     0     0
+	    sdd          ONLINE       0     0     0
+	    sde          ONLINE       0     0     0  (awaiting resilver)
+
+errors: No known data errors
+`
+
+func TestResilverStatus(t *testing.T) {
+	ctx, r := withFakeRunner(statusResilvering)
+	got, err := (&Zpool{Name: "tank"}).ResilverStatusContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := [][]string{{"zpool", "status", "-v", "-p", "-t", "tank"}}; !reflect.DeepEqual(want, r.calls) {
+		t.Fatalf("want calls: %q, got: %q", want, r.calls)
+	}
+	if got.State != ScanStateInProgress || got.PercentDone != 5 || got.Resilvered != 500<<20 || !got.Deferred ||
+		!reflect.DeepEqual([]string{"sdc"}, got.Devices) || got.TimeRemaining != 10*time.Minute {
+		t.Fatalf("unexpected resilver status: %+v", got)
+	}
+	if d := time.Until(got.EstimatedEnd); d <= 9*time.Minute || d > 10*time.Minute {
+		t.Fatalf("expected resilver to finish in 10 minutes, got: %s", got.EstimatedEnd)
+	}
+
+	statuses, err := parseZpoolStatus(statusScrubFinished)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := newResilverStatus(statuses[0], time.Now()); !reflect.DeepEqual(&ResilverStatus{State: ScanStateNone}, got) {
+		t.Fatalf("a scrub should not be reported as a resilver, got: %+v", got)
+	}
+	finished := strings.Replace(statusResilvering, "resilver in progress since Sun Jul 25 10:00:00 2021\n\t1.50G scanned at 100M/s, 512M issued at 50M/s, 10G total\n\t500M resilvered, 5.00% done, 00:10:00 to go",
+		"resilvered 10G in 00:20:00 with 0 errors on Sun Jul 25 10:20:00 2021", 1)
+	if statuses, err = parseZpoolStatus(finished); err != nil {
+		t.Fatal(err)
+	}
+	if got := newResilverStatus(statuses[0], time.Now()); got.State != ScanStateFinished || got.Resilvered != 10<<30 || !got.EstimatedEnd.IsZero() {
+		t.Fatalf("unexpected resilver status: %+v", got)
+	}
+}
+
+func TestResilverStatusTotal(t *testing.T) {
+	// OpenZFS 2.2 prints the total after the scanned and the issued size
+	out := strings.Replace(statusResilvering, "1.50G scanned at 100M/s, 512M issued at 50M/s, 10G total",
+		"1.50G / 10G scanned at 100M/s, 512M / 10G issued at 50M/s", 1)
+	ctx, _ := withFakeRunner(out)
+	got, err := (&Zpool{Name: "tank"}).ResilverStatusContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.State != ScanStateInProgress || got.Scanned != 1536<<20 || got.Issued != 512<<20 || got.Total != 10<<30 ||
+		got.ScanRate != 100<<20 || got.IssueRate != 50<<20 || got.Resilvered != 500<<20 || got.PercentDone != 5 {
+		t.Fatalf("unexpected resilver status: %+v", got)
+	}
+}
+
+func TestResilver(t *testing.T) {
+	ctx, r := withFakeRunner("")
+	if err := (&Zpool{Name: "tank"}).ResilverContext(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if want := [][]string{{"zpool", "resilver", "tank"}}; !reflect.DeepEqual(want, r.calls) {
+		t.Fatalf("want calls: %q, got: %q", want, r.calls)
+	}
+
+	// resilver_defer is not among the supported features
+	ctx = WithRunner(context.Background(), capabilitiesRunner("zfs-0.7.13-1\n"))
+	if _, err := DetectCapabilitiesContext(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := (&Zpool{Name: "tank"}).ResilverContext(ctx); !errors.Is(err, ErrNotSupported) {
+		t.Fatalf("want ErrNotSupported, got: %v", err)
+	}
+}
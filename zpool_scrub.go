@@ -0,0 +1,89 @@
+package zfs
+
+import (
+	"context"
+	"time"
+)
+
+// ScrubStatus is the progress of the most recent scrub of a zpool.
+// State is one of the ScanState constants, ScanStateNone is reported if the pool has never been scrubbed
+// or if the most recent scan of the pool was a resilver.
+type ScrubStatus struct {
+	State         string
+	Start         time.Time
+	End           time.Time
+	Scanned       uint64
+	Issued        uint64
+	Total         uint64
+	ScanRate      uint64
+	IssueRate     uint64
+	Repaired      uint64
+	PercentDone   float64
+	TimeRemaining time.Duration
+	Errors        uint64
+}
+
+// Scrub starts a scrub of the zpool, or resumes a paused one.
+func (z *Zpool) Scrub() error {
+	return z.ScrubContext(context.Background())
+}
+
+// ScrubContext is like Scrub but includes a context.
+func (z *Zpool) ScrubContext(ctx context.Context) error {
+	return zpool(ctx, "scrub", z.Name)
+}
+
+// ScrubPause pauses the scrub in progress on the zpool.
+// A paused scrub can be resumed with Scrub.
+func (z *Zpool) ScrubPause() error {
+	return z.ScrubPauseContext(context.Background())
+}
+
+// ScrubPauseContext is like ScrubPause but includes a context.
+func (z *Zpool) ScrubPauseContext(ctx context.Context) error {
+	return zpool(ctx, "scrub", "-p", z.Name)
+}
+
+// ScrubStop cancels the scrub in progress on the zpool.
+func (z *Zpool) ScrubStop() error {
+	return z.ScrubStopContext(context.Background())
+}
+
+// ScrubStopContext is like ScrubStop but includes a context.
+func (z *Zpool) ScrubStopContext(ctx context.Context) error {
+	return zpool(ctx, "scrub", "-s", z.Name)
+}
+
+// ScrubStatus returns the progress of the most recent scrub of the zpool.
+func (z *Zpool) ScrubStatus() (*ScrubStatus, error) {
+	return z.ScrubStatusContext(context.Background())
+}
+
+// ScrubStatusContext is like ScrubStatus but includes a context.
+func (z *Zpool) ScrubStatusContext(ctx context.Context) (*ScrubStatus, error) {
+	status, err := z.StatusContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return newScrubStatus(&status.Scan), nil
+}
+
+func newScrubStatus(scan *ScanStatus) *ScrubStatus {
+	if scan.Function != ScanFunctionScrub {
+		return &ScrubStatus{State: ScanStateNone}
+	}
+	return &ScrubStatus{
+		State:         scan.State,
+		Start:         scan.Start,
+		End:           scan.End,
+		Scanned:       scan.Scanned,
+		Issued:        scan.Issued,
+		Total:         scan.Total,
+		ScanRate:      scan.ScanRate,
+		IssueRate:     scan.IssueRate,
+		Repaired:      scan.Repaired,
+		PercentDone:   scan.PercentDone,
+		TimeRemaining: scan.TimeRemaining,
+		Errors:        scan.Errors,
+	}
+}
@@ -0,0 +1,344 @@
+package zfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// scrubPollInterval is the interval at which a ScrubScheduler checks its schedules and the scrubs it started.
+const scrubPollInterval = time.Minute
+
+// CronSchedule is a schedule in the format of crontab(5): the five fields minute, hour, day of month, month and
+// day of week, each * or a list of numbers and ranges with optional steps, such as "0 2 * * 0" for 2:00 on
+// Sundays or "30 1 1-7 * *" for 1:30 on the first seven days of each month. The shortcuts @hourly, @daily,
+// @weekly and @monthly are supported as well. As in cron, a time matches if both the day of month and the day of
+// week match, or either if neither is *.
+type CronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	domStar, dowStar              bool
+}
+
+var cronShortcuts = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+}
+
+// ParseCronSchedule parses a schedule in the format of crontab(5), see CronSchedule.
+func ParseCronSchedule(spec string) (*CronSchedule, error) {
+	if s, ok := cronShortcuts[spec]; ok {
+		spec = s
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid schedule %q: expected 5 fields", spec)
+	}
+	s := &CronSchedule{domStar: fields[2] == "*", dowStar: fields[4] == "*"}
+	for i, f := range []struct {
+		bits     *uint64
+		min, max int
+	}{{&s.minute, 0, 59}, {&s.hour, 0, 23}, {&s.dom, 1, 31}, {&s.month, 1, 12}, {&s.dow, 0, 7}} {
+		var err error
+		if *f.bits, err = parseCronField(fields[i], f.min, f.max); err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: %w", spec, err)
+		}
+	}
+	// Sunday is both 0 and 7
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	return s, nil
+}
+
+func parseCronField(field string, min, max int) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step %q", part)
+			}
+			rng = part[:i]
+		}
+		lo, hi := min, max
+		if rng != "*" {
+			bounds := strings.SplitN(rng, "-", 2)
+			var err error
+			if lo, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("invalid value %q", part)
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				if hi, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, fmt.Errorf("invalid value %q", part)
+				}
+			} else if step > 1 {
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("value %q out of range %d-%d", part, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+	return set, nil
+}
+
+func (s *CronSchedule) matchesDay(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	switch {
+	case s.domStar || s.dowStar:
+		return dom && dow
+	default:
+		return dom || dow
+	}
+}
+
+// Next returns the first time matching the schedule after t, in the time zone of t. It returns the zero time if
+// nothing matches within five years, e.g. for February 30.
+func (s *CronSchedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.Year() + 5
+	for t.Year() <= limit {
+		switch {
+		case s.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !s.matchesDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			// skip to the next minute of the schedule in this hour, or else to the next hour
+			rest := s.minute >> uint(t.Minute())
+			if rest == 0 {
+				t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			} else {
+				t = t.Add(time.Duration(bits.TrailingZeros64(rest)) * time.Minute)
+			}
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// ScrubWindow is a period of each day, such as business hours, in the time zone of its ScrubJob.
+type ScrubWindow struct {
+	// Weekdays are the days the window starts on, every day if empty.
+	Weekdays []time.Weekday
+	// Start and End are the times of day the window starts and ends as the time since midnight, e.g. 9 * time.Hour.
+	// A window which ends before it starts ends on the next day.
+	Start time.Duration
+	End   time.Duration
+}
+
+func (w *ScrubWindow) startsOn(day time.Weekday) bool {
+	if len(w.Weekdays) == 0 {
+		return true
+	}
+	for _, d := range w.Weekdays {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *ScrubWindow) contains(t time.Time) bool {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	since := t.Sub(midnight)
+	if w.Start < w.End {
+		return w.startsOn(t.Weekday()) && since >= w.Start && since < w.End
+	}
+	return w.startsOn(t.Weekday()) && since >= w.Start || w.startsOn(midnight.AddDate(0, 0, -1).Weekday()) && since < w.End
+}
+
+// ScrubJob configures the scrubs of a zpool.
+type ScrubJob struct {
+	Pool string
+	// Schedule is the time scrubs are started at, as a crontab(5) schedule, see CronSchedule.
+	Schedule string
+	// Location is the time zone of Schedule and Pause, the local time zone if nil.
+	Location *time.Location
+	// Pause holds the windows in which scrubs are not started and scrubs the scheduler started are paused, to be
+	// resumed once the window ends. Scrubs scheduled within a window start when it ends.
+	Pause []ScrubWindow
+}
+
+// Types of ScrubEvent.
+const (
+	// ScrubEventStarted reports a scheduled scrub was started.
+	ScrubEventStarted = "started"
+	// ScrubEventSkipped reports a scheduled scrub was skipped as the pool was resilvering or already scrubbing.
+	ScrubEventSkipped = "skipped"
+	// ScrubEventPaused and ScrubEventResumed report a scrub was paused at the start of a pause window and resumed at
+	// its end.
+	ScrubEventPaused  = "paused"
+	ScrubEventResumed = "resumed"
+	// ScrubEventFinished reports a scrub finished, the errors it found are in ScanStatus.Errors.
+	ScrubEventFinished = "finished"
+	// ScrubEventCanceled reports a scrub was canceled, e.g. by zpool scrub -s or a resilver.
+	ScrubEventCanceled = "canceled"
+	// ScrubEventError reports a command failed, the scheduler tries again with its next check.
+	ScrubEventError = "error"
+)
+
+// ScrubEvent reports what a ScrubScheduler did with the scrubs of a pool.
+type ScrubEvent struct {
+	Pool string
+	// Type is one of the ScrubEvent constants.
+	Type string
+	Time time.Time
+	// Scan is the scan status of the pool which caused the event, nil for ScrubEventError.
+	Scan *ScanStatus
+	// Err is the error of ScrubEventError.
+	Err error
+}
+
+type scrubJob struct {
+	ScrubJob
+	schedule *CronSchedule
+	next     time.Time
+	// running is set while the scrub the scheduler started is not finished, paused while it paused it.
+	running bool
+	paused  bool
+}
+
+// ScrubScheduler scrubs zpools on a schedule while it runs.
+type ScrubScheduler struct {
+	jobs []*scrubJob
+
+	// now and after are replaced by tests
+	now   func() time.Time
+	after func(time.Duration) <-chan time.Time
+}
+
+// NewScrubScheduler returns a ScrubScheduler for the given jobs.
+func NewScrubScheduler(jobs []ScrubJob) (*ScrubScheduler, error) {
+	if len(jobs) == 0 {
+		return nil, errors.New("no scrubs to schedule")
+	}
+	s := &ScrubScheduler{now: time.Now, after: time.After}
+	for _, j := range jobs {
+		if err := ValidatePoolName(j.Pool); err != nil {
+			return nil, err
+		}
+		schedule, err := ParseCronSchedule(j.Schedule)
+		if err != nil {
+			return nil, fmt.Errorf("invalid scrub schedule of %s: %w", j.Pool, err)
+		}
+		for _, w := range j.Pause {
+			if w.Start < 0 || w.Start >= 24*time.Hour || w.End < 0 || w.End > 24*time.Hour || w.Start == w.End {
+				return nil, fmt.Errorf("invalid pause window %s-%s of %s", w.Start, w.End, j.Pool)
+			}
+		}
+		if j.Location == nil {
+			j.Location = time.Local
+		}
+		j.Pause = append([]ScrubWindow(nil), j.Pause...)
+		s.jobs = append(s.jobs, &scrubJob{ScrubJob: j, schedule: schedule})
+	}
+	return s, nil
+}
+
+// Run checks the schedules and the scrubs it started every minute until ctx is done, passing what it did to
+// report, which may be nil. Scrubs missed while the host was suspended are started once, scrubs already in
+// progress are left alone. Run returns ctx.Err().
+func (s *ScrubScheduler) Run(ctx context.Context, report func(ScrubEvent)) error {
+	if report == nil {
+		report = func(ScrubEvent) {}
+	}
+	for _, j := range s.jobs {
+		j.next = j.schedule.Next(s.now().In(j.Location))
+	}
+	for {
+		for _, j := range s.jobs {
+			s.check(ctx, j, report)
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-s.after(scrubPollInterval):
+		}
+	}
+}
+
+func (j *scrubJob) inPause(t time.Time) bool {
+	for i := range j.Pause {
+		if j.Pause[i].contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *ScrubScheduler) check(ctx context.Context, j *scrubJob, report func(ScrubEvent)) {
+	now := s.now().In(j.Location)
+	pause := j.inPause(now)
+	if !j.running && (j.next.IsZero() || now.Before(j.next) || pause) {
+		return
+	}
+
+	event := func(typ string, scan *ScanStatus, err error) {
+		report(ScrubEvent{Pool: j.Pool, Type: typ, Time: now, Scan: scan, Err: err})
+	}
+	z := &Zpool{Name: j.Pool}
+	status, err := z.StatusContext(ctx)
+	if err != nil {
+		event(ScrubEventError, nil, err)
+		return
+	}
+	scan := &status.Scan
+
+	if !j.running {
+		j.next = j.schedule.Next(now)
+		if scan.State == ScanStateInProgress || scan.State == ScanStatePaused {
+			event(ScrubEventSkipped, scan, nil)
+			return
+		}
+		if err := z.ScrubContext(ctx); err != nil {
+			event(ScrubEventError, nil, err)
+			return
+		}
+		j.running = true
+		event(ScrubEventStarted, scan, nil)
+		return
+	}
+
+	switch {
+	case scan.Function != ScanFunctionScrub || scan.State == ScanStateCanceled:
+		j.running, j.paused = false, false
+		event(ScrubEventCanceled, scan, nil)
+	case scan.State == ScanStateFinished:
+		j.running, j.paused = false, false
+		event(ScrubEventFinished, scan, nil)
+	case scan.State == ScanStateInProgress && pause:
+		if err := z.ScrubPauseContext(ctx); err != nil {
+			event(ScrubEventError, nil, err)
+			return
+		}
+		j.paused = true
+		event(ScrubEventPaused, scan, nil)
+	case scan.State == ScanStatePaused && j.paused && !pause:
+		if err := z.ScrubContext(ctx); err != nil {
+			event(ScrubEventError, nil, err)
+			return
+		}
+		j.paused = false
+		event(ScrubEventResumed, scan, nil)
+	}
+}
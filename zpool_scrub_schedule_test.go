@@ -0,0 +1,154 @@
+package zfs
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCronSchedule(t *testing.T) {
+	// Saturday
+	from := time.Date(2022, time.January, 1, 10, 30, 15, 0, time.UTC)
+	for spec, want := range map[string]time.Time{
+		"*/15 * * * *":   time.Date(2022, time.January, 1, 10, 45, 0, 0, time.UTC),
+		"0 2 * * 0":      time.Date(2022, time.January, 2, 2, 0, 0, 0, time.UTC),
+		"0 2 * * 7":      time.Date(2022, time.January, 2, 2, 0, 0, 0, time.UTC),
+		"@daily":         time.Date(2022, time.January, 2, 0, 0, 0, 0, time.UTC),
+		"@monthly":       time.Date(2022, time.February, 1, 0, 0, 0, 0, time.UTC),
+		"5,35 10 * * *":  time.Date(2022, time.January, 1, 10, 35, 0, 0, time.UTC),
+		"0 0 10-12 * 1":  time.Date(2022, time.January, 3, 0, 0, 0, 0, time.UTC),
+		"0 3 15 6 *":     time.Date(2022, time.June, 15, 3, 0, 0, 0, time.UTC),
+		"30 1 29 2 *":    time.Date(2024, time.February, 29, 1, 30, 0, 0, time.UTC),
+		"0 0 30 2 *":     {},
+		"0 9-17/4 * * *": time.Date(2022, time.January, 1, 13, 0, 0, 0, time.UTC),
+	} {
+		s, err := ParseCronSchedule(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := s.Next(from); !got.Equal(want) {
+			t.Fatalf("%s: want: %s, got: %s", spec, want, got)
+		}
+	}
+
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "a * * * *", "@yearly"} {
+		if _, err := ParseCronSchedule(spec); err == nil {
+			t.Fatalf("expected error for schedule %q", spec)
+		}
+	}
+}
+
+func TestScrubWindow(t *testing.T) {
+	business := ScrubWindow{Weekdays: []time.Weekday{time.Monday, time.Friday}, Start: 9 * time.Hour, End: 17 * time.Hour}
+	night := ScrubWindow{Weekdays: []time.Weekday{time.Friday}, Start: 22 * time.Hour, End: 6 * time.Hour}
+	for _, test := range []struct {
+		w    ScrubWindow
+		t    time.Time
+		want bool
+	}{
+		{business, time.Date(2022, time.January, 3, 9, 0, 0, 0, time.UTC), true},
+		{business, time.Date(2022, time.January, 3, 17, 0, 0, 0, time.UTC), false},
+		{business, time.Date(2022, time.January, 4, 12, 0, 0, 0, time.UTC), false},
+		{night, time.Date(2022, time.January, 7, 23, 0, 0, 0, time.UTC), true},
+		{night, time.Date(2022, time.January, 8, 5, 59, 0, 0, time.UTC), true},
+		{night, time.Date(2022, time.January, 8, 23, 0, 0, 0, time.UTC), false},
+	} {
+		if got := test.w.contains(test.t); got != test.want {
+			t.Fatalf("%+v contains %s: want: %t, got: %t", test.w, test.t, test.want, got)
+		}
+	}
+}
+
+const scrubScheduleStatus = `  pool: tank
+ state: ONLINE
+  scan: %s
+config:
+
+	NAME        STATE     READ WRITE CKSUM
+	tank        ONLINE       0     0     0
+	  sda       ONLINE       0     0     0
+
+errors: No known data errors
+`
+
+func TestScrubScheduler(t *testing.T) {
+	scan := "none requested"
+	r := &fakeRunner{output: func(args []string) (string, error) {
+		switch strings.Join(args, " ") {
+		case "zpool status -v -p -t tank":
+			return strings.Replace(scrubScheduleStatus, "%s", scan, 1), nil
+		case "zpool scrub tank":
+			scan = "scrub in progress since Mon Jan  3 02:00:00 2022"
+		case "zpool scrub -p tank":
+			scan = "scrub paused since Mon Jan  3 09:00:00 2022"
+		}
+		return "", nil
+	}}
+	ctx := WithRunner(context.Background(), r)
+
+	s, err := NewScrubScheduler([]ScrubJob{{
+		Pool:     "tank",
+		Schedule: "0 2 * * 1",
+		Location: time.UTC,
+		Pause:    []ScrubWindow{{Start: 9 * time.Hour, End: 17 * time.Hour}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var now time.Time
+	s.now = func() time.Time { return now }
+	j := s.jobs[0]
+	j.next = j.schedule.Next(time.Date(2022, time.January, 3, 1, 0, 0, 0, time.UTC))
+
+	for _, step := range []struct {
+		day, hour int
+		scan      string
+		want      string
+	}{
+		{3, 1, "", ""},
+		{3, 2, "", ScrubEventStarted},
+		{3, 3, "", ""},
+		{3, 9, "", ScrubEventPaused},
+		{3, 12, "", ""},
+		{3, 17, "", ScrubEventResumed},
+		{3, 18, "scrub repaired 0B in 16:00:00 with 3 errors on Mon Jan  3 18:00:00 2022", ScrubEventFinished},
+		{10, 2, "resilver in progress since Mon Jan 10 01:00:00 2022", ScrubEventSkipped},
+		// a scrub scheduled within a pause window starts once it ends
+		{17, 10, "resilvered 1.50G in 00:01:00 with 0 errors on Mon Jan 10 03:00:00 2022", ""},
+		{17, 17, "", ScrubEventStarted},
+	} {
+		if step.scan != "" {
+			scan = step.scan
+		}
+		now = time.Date(2022, time.January, step.day, step.hour, 0, 0, 0, time.UTC)
+		var events []ScrubEvent
+		s.check(ctx, j, func(e ScrubEvent) { events = append(events, e) })
+		switch {
+		case step.want == "" && len(events) == 0:
+			continue
+		case len(events) != 1 || events[0].Type != step.want || events[0].Err != nil:
+			t.Fatalf("%s: want event %q, got: %+v", now, step.want, events)
+		case step.want == ScrubEventFinished && events[0].Scan.Errors != 3:
+			t.Fatalf("want scrub errors, got: %+v", events[0].Scan)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := s.Run(ctx, nil); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+
+	for _, job := range []ScrubJob{
+		{Pool: "", Schedule: "@daily"},
+		{Pool: "tank", Schedule: "daily"},
+		{Pool: "tank", Schedule: "@daily", Pause: []ScrubWindow{{Start: 9 * time.Hour, End: 9 * time.Hour}}},
+		{Pool: "tank", Schedule: "@daily", Pause: []ScrubWindow{{Start: 25 * time.Hour, End: 9 * time.Hour}}},
+	} {
+		if _, err := NewScrubScheduler([]ScrubJob{job}); err == nil {
+			t.Fatalf("expected error for job %+v", job)
+		}
+	}
+}
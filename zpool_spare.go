@@ -0,0 +1,132 @@
+package zfs
+
+import (
+	"context"
+	"strconv"
+	"strings"
+)
+
+// Hot spare states, as reported by zpool status.
+const (
+	SpareAvail = "AVAIL"
+	SpareInUse = "INUSE"
+)
+
+// Spare is a hot spare device of a zpool.
+type Spare struct {
+	Name string
+	// State is SpareAvail if the spare can be used, or SpareInUse while it replaces another device.
+	State string
+	// Replacing is the device the spare is replacing, if it is in use by this pool.
+	Replacing string
+	// Draid is the name of the draid vdev a distributed spare, such as draid1-0-0, belongs to and can only replace
+	// devices of, empty for other spares.
+	Draid string
+}
+
+// AddSpares adds hot spare devices to the zpool.
+func (z *Zpool) AddSpares(devices ...string) error {
+	return z.AddSparesContext(context.Background(), devices...)
+}
+
+// AddSparesContext is like AddSpares but includes a context.
+func (z *Zpool) AddSparesContext(ctx context.Context, devices ...string) error {
+	return z.AddVdevsContext(ctx, VdevSpec{Spares: devices}, false)
+}
+
+// RemoveSpare removes a hot spare device from the zpool. A spare can only be removed while it is not in use.
+func (z *Zpool) RemoveSpare(device string) error {
+	return z.RemoveSpareContext(context.Background(), device)
+}
+
+// RemoveSpareContext is like RemoveSpare but includes a context.
+func (z *Zpool) RemoveSpareContext(ctx context.Context, device string) error {
+	return z.RemoveVdevContext(ctx, device)
+}
+
+// Spares lists the hot spare devices of the zpool along with their state and the devices they are replacing.
+func (z *Zpool) Spares() ([]*Spare, error) {
+	return z.SparesContext(context.Background())
+}
+
+// SparesContext is like Spares but includes a context.
+func (z *Zpool) SparesContext(ctx context.Context) ([]*Spare, error) {
+	status, err := z.StatusContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return status.spares(), nil
+}
+
+// spares returns the spares of the pool. A spare in use is listed in the configuration as a child of a spare vdev,
+// e.g. spare-0, after the device it replaces.
+func (z *ZpoolStatus) spares() []*Spare {
+	replacing := map[string]string{}
+	var walk func(vdevs []*Vdev)
+	walk = func(vdevs []*Vdev) {
+		for _, v := range vdevs {
+			if strings.HasPrefix(v.Name, "spare-") && len(v.Children) > 1 {
+				for _, spare := range v.Children[1:] {
+					replacing[spare.Name] = v.Children[0].Name
+				}
+			}
+			walk(v.Children)
+		}
+	}
+	if z.Config != nil {
+		walk(z.Config.Children)
+	}
+	walk(z.Logs)
+	walk(z.Special)
+	walk(z.Dedup)
+
+	spares := make([]*Spare, len(z.Spares))
+	for i, v := range z.Spares {
+		spares[i] = &Spare{Name: v.Name, State: v.State, Replacing: replacing[v.Name], Draid: z.draidOf(v.Name)}
+	}
+	return spares
+}
+
+// draidOf returns the name of the draid vdev of a distributed spare, as the spare is named after its parity
+// and the index of the vdev.
+func (z *ZpoolStatus) draidOf(spare string) string {
+	m := distributedSpareRegex.FindStringSubmatch(spare)
+	if m == nil || z.Config == nil {
+		return ""
+	}
+	for _, v := range z.Config.Children {
+		if c, err := ParseDraidName(v.Name); err == nil && strconv.Itoa(c.Parity) == m[1] && strconv.Itoa(c.Index) == m[2] {
+			return v.Name
+		}
+	}
+	return ""
+}
+
+// Autoreplace reports whether a new device found in the physical location of a device of the zpool
+// is automatically formatted and used to replace it.
+func (z *Zpool) Autoreplace() (bool, error) {
+	return z.AutoreplaceContext(context.Background())
+}
+
+// AutoreplaceContext is like Autoreplace but includes a context.
+func (z *Zpool) AutoreplaceContext(ctx context.Context) (bool, error) {
+	value, err := z.GetPropertyContext(ctx, "autoreplace")
+	if err != nil {
+		return false, err
+	}
+	return value == "on", nil
+}
+
+// SetAutoreplace sets the autoreplace property of the zpool.
+func (z *Zpool) SetAutoreplace(enabled bool) error {
+	return z.SetAutoreplaceContext(context.Background(), enabled)
+}
+
+// SetAutoreplaceContext is like SetAutoreplace but includes a context.
+func (z *Zpool) SetAutoreplaceContext(ctx context.Context, enabled bool) error {
+	value := "off"
+	if enabled {
+		value = "on"
+	}
+	return z.SetPropertyContext(ctx, "autoreplace", value)
+}
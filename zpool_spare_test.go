@@ -0,0 +1,97 @@
+package zfs
+
+import (
+	"reflect"
+	"testing"
+)
+
+const statusSpareInUse = `  pool: tank
+ state: DEGRADED
+  scan: resilvered 1.50G in 00:01:00 with 0 errors on Sun Jul 25 10:01:00 2021
+config:
+
+	NAME         STATE     READ WRITE CKSUM
+	tank         DEGRADED     0     0     0
+	  mirror-0   DEGRADED     0     0     0
+	    spare-0  DEGRADED     0     0     0
+	      sda    FAULTED      0     0     0  too many errors
+	      sde    ONLINE       0     0     0
+	    sdb      ONLINE       0     0     0
+	spares
+	  sde        INUSE     currently in use
+	  sdf        AVAIL
+
+errors: No known data errors
+`
+
+func TestSpares(t *testing.T) {
+	statuses, err := parseZpoolStatus(statusSpareInUse)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*Spare{
+		{Name: "sde", State: SpareInUse, Replacing: "sda"},
+		{Name: "sdf", State: SpareAvail},
+	}
+	if got := statuses[0].spares(); !reflect.DeepEqual(want, got) {
+		t.Fatalf("want: %+v, got: %+v", want, got)
+	}
+}
+
+func TestSpareOperations(t *testing.T) {
+	ctx, r := withFakeRunner("")
+	z := &Zpool{Name: "tank"}
+
+	if err := z.AddSparesContext(ctx, "sde", "sdf"); err != nil {
+		t.Fatal(err)
+	}
+	if err := z.RemoveSpareContext(ctx, "sdf"); err != nil {
+		t.Fatal(err)
+	}
+	if err := z.SetAutoreplaceContext(ctx, true); err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"zpool", "add", "tank", "spare", "sde", "sdf"},
+		{"zpool", "remove", "tank", "sdf"},
+		{"zpool", "set", "autoreplace=on", "tank"},
+	}
+	if !reflect.DeepEqual(want, r.calls) {
+		t.Fatalf("want: %q, got: %q", want, r.calls)
+	}
+}
+
+const statusDraidSpareInUse = `  pool: tank
+ state: DEGRADED
+config:
+
+	NAME                  STATE     READ WRITE CKSUM
+	tank                  DEGRADED     0     0     0
+	  draid1:2d:5c:1s-0   DEGRADED     0     0     0
+	    sda               ONLINE       0     0     0
+	    spare-1           DEGRADED     0     0     0
+	      sdb             UNAVAIL      0     0     0  was /dev/sdb1
+	      draid1-0-0      ONLINE       0     0     0
+	    sdc               ONLINE       0     0     0
+	    sdd               ONLINE       0     0     0
+	    sde               ONLINE       0     0     0
+	spares
+	  draid1-0-0          INUSE     currently in use
+
+errors: No known data errors
+`
+
+func TestDraidSpares(t *testing.T) {
+	statuses, err := parseZpoolStatus(statusDraidSpareInUse)
+	if err != nil {
+		t.Fatal(err)
+	}
+	draid := statuses[0].Config.Children[0]
+	if len(draid.Children) != 5 || draid.Children[1].Name != "spare-1" {
+		t.Fatalf("unexpected draid vdev: %+v", draid)
+	}
+	want := []*Spare{{Name: "draid1-0-0", State: SpareInUse, Replacing: "sdb", Draid: "draid1:2d:5c:1s-0"}}
+	if got := statuses[0].spares(); !reflect.DeepEqual(want, got) {
+		t.Fatalf("want: %+v, got: %+v", want, got)
+	}
+}
@@ -0,0 +1,63 @@
+package zfs
+
+import (
+	"context"
+	"errors"
+)
+
+// SplitOptions configure how a zpool is split with Zpool.Split.
+//
+// A full description of zpool split may be found in the ZFS manual:
+// https://openzfs.github.io/openzfs-docs/man/8/zpool-split.8.html.
+type SplitOptions struct {
+	// Devices are the devices which go to the new pool, one of each mirror. If empty, the last device of each mirror
+	// goes to the new pool. Devices may be given by guid, see Vdev.Device.
+	Devices []string
+	// AltRoot imports the new pool right away, with the altroot property set, under which all mountpoints of the
+	// pool are mounted (-R). If empty, the new pool is left exported, to be imported with ImportZpool.
+	AltRoot string
+	// LoadKeys loads the keys of encrypted datasets to mount them when importing the new pool (-l).
+	LoadKeys bool
+	// Properties are set on the new pool (-o property=value).
+	Properties map[string]string
+}
+
+func (o *SplitOptions) args() []string {
+	var args []string
+	if o.AltRoot != "" {
+		args = append(args, "-R", o.AltRoot)
+	}
+	if o.LoadKeys {
+		args = append(args, "-l")
+	}
+	if o.Properties != nil {
+		args = append(args, propsSlice(o.Properties)...)
+	}
+	return args
+}
+
+// Split splits a zpool whose data vdevs are all mirrors into two, detaching a device from each mirror to create a
+// new pool named newPoolName with the same contents. The new pool is exported, unless SplitOptions.AltRoot imports it,
+// only then is it returned with its properties retrieved.
+func (z *Zpool) Split(newPoolName string, opts SplitOptions) (*Zpool, error) {
+	return z.SplitContext(context.Background(), newPoolName, opts)
+}
+
+// SplitContext is like Split but includes a context.
+func (z *Zpool) SplitContext(ctx context.Context, newPoolName string, opts SplitOptions) (*Zpool, error) {
+	if newPoolName == "" {
+		return nil, errors.New("no name for the new pool given")
+	}
+	if opts.LoadKeys && opts.AltRoot == "" {
+		return nil, errors.New("keys can only be loaded when importing the new pool")
+	}
+	args := append([]string{"split"}, opts.args()...)
+	args = append(append(args, z.Name, newPoolName), opts.Devices...)
+	if err := zpool(ctx, args...); err != nil {
+		return nil, err
+	}
+	if opts.AltRoot == "" {
+		return &Zpool{Name: newPoolName}, nil
+	}
+	return GetZpoolContext(ctx, newPoolName)
+}
@@ -0,0 +1,42 @@
+package zfs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplit(t *testing.T) {
+	ctx, r := withFakeRunner("")
+	z := &Zpool{Name: "tank"}
+
+	split, err := z.SplitContext(ctx, "copy", SplitOptions{Devices: []string{"sdb", "sdd"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if split.Name != "copy" {
+		t.Fatalf("want pool copy, got: %s", split.Name)
+	}
+	if want := []string{"zpool", "split", "tank", "copy", "sdb", "sdd"}; !reflect.DeepEqual(want, r.calls[0]) {
+		t.Fatalf("want: %q, got: %q", want, r.calls[0])
+	}
+
+	opts := SplitOptions{AltRoot: "/mnt", LoadKeys: true, Properties: map[string]string{"comment": "copy"}}
+	if _, err := z.SplitContext(ctx, "copy", opts); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"zpool", "split", "-R", "/mnt", "-l", "-o", "comment=copy", "tank", "copy"}
+	if !reflect.DeepEqual(want, r.calls[1]) {
+		t.Fatalf("want: %q, got: %q", want, r.calls[1])
+	}
+	// the imported pool is retrieved
+	if got := r.calls[len(r.calls)-1]; got[1] != "get" || got[len(got)-1] != "copy" {
+		t.Fatalf("want zpool get of copy, got: %q", got)
+	}
+
+	if _, err := z.SplitContext(ctx, "", SplitOptions{}); err == nil {
+		t.Fatal("expected error without new pool name")
+	}
+	if _, err := z.SplitContext(ctx, "copy", SplitOptions{LoadKeys: true}); err == nil {
+		t.Fatal("expected error loading keys without import")
+	}
+}
@@ -0,0 +1,828 @@
+package zfs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Scan functions, which indicate what kind of scan has been run on a pool.
+const (
+	ScanFunctionScrub    = "scrub"
+	ScanFunctionResilver = "resilver"
+)
+
+// Scan states, which indicate the progress of the most recent scan of a pool.
+const (
+	ScanStateNone       = "none"
+	ScanStateInProgress = "in progress"
+	ScanStatePaused     = "paused"
+	ScanStateFinished   = "finished"
+	ScanStateCanceled   = "canceled"
+)
+
+// Vdev sections of a pool's configuration as reported by zpool status.
+const (
+	VdevSectionLogs    = "logs"
+	VdevSectionCache   = "cache"
+	VdevSectionSpares  = "spares"
+	VdevSectionSpecial = "special"
+	VdevSectionDedup   = "dedup"
+)
+
+// Vdev is a virtual device of a zpool, as reported by zpool status.
+// A vdev may either be a leaf device (disk, file, ...) or a group of other vdevs (mirror, raidz, ...).
+type Vdev struct {
+	Name     string
+	State    string
+	Read     uint64
+	Write    uint64
+	Checksum uint64
+	// GUID identifies the vdev, also once its device is missing. It is set with JSON output or StatusOptions.GUIDs.
+	GUID uint64
+	// Message holds any additional text zpool prints after the error counters, e.g. "(resilvering)".
+	Message string
+	// StateDetail is the reason for the state of the vdev, which is part of Message without the notes in parentheses,
+	// e.g. "was /dev/sdb1" for a missing device or "too many errors", empty if there is none.
+	StateDetail string
+	// Trim and Initialize are the progress of trimming and initializing a leaf vdev.
+	Trim       VdevProgress
+	Initialize VdevProgress
+	Children   []*Vdev
+}
+
+// ScanStatus is the state of the most recent scrub or resilver of a zpool.
+type ScanStatus struct {
+	Function      string
+	State         string
+	Start         time.Time
+	End           time.Time
+	Scanned       uint64
+	Issued        uint64
+	Total         uint64
+	ScanRate      uint64
+	IssueRate     uint64
+	Repaired      uint64
+	PercentDone   float64
+	TimeRemaining time.Duration
+	Duration      time.Duration
+	Errors        uint64
+	// Raw is the unparsed scan text as printed by zpool status, or its JSON object if zpool status -j is supported.
+	Raw string
+}
+
+// RemovalStatus is the state of the most recent removal of a top-level vdev from a zpool.
+// State is one of the ScanState constants other than ScanStatePaused.
+type RemovalStatus struct {
+	State string
+	// Device is the name of the removed vdev as reported by zpool status.
+	Device        string
+	Start         time.Time
+	End           time.Time
+	Copied        uint64
+	Total         uint64
+	Rate          uint64
+	PercentDone   float64
+	TimeRemaining time.Duration
+	Duration      time.Duration
+	// MappingMemory is the memory used for mappings of the blocks of removed vdevs.
+	MappingMemory uint64
+	// Raw is the unparsed removal text as printed by zpool status, or its JSON object if zpool status -j is supported.
+	Raw string
+}
+
+// ExpansionStatus is the state of the most recent expansion of a raidz vdev of a zpool by an attached device.
+// State is one of ScanStateNone, ScanStateInProgress, ScanStatePaused while the expansion waits for a resilver
+// or for the errors of the pool to be cleared, or ScanStateFinished.
+type ExpansionStatus struct {
+	State string
+	// Vdev is the name of the expanded vdev as reported by zpool status, e.g. raidz1-0. The columnar output does not
+	// number the vdev while the expansion is in progress, e.g. raidz1.
+	Vdev          string
+	Start         time.Time
+	End           time.Time
+	Copied        uint64
+	Total         uint64
+	Rate          uint64
+	PercentDone   float64
+	TimeRemaining time.Duration
+	Duration      time.Duration
+	// Raw is the unparsed expansion text as printed by zpool status, or its JSON object if zpool status -j is supported.
+	Raw string
+}
+
+// ZpoolStatus is the detailed status of a zpool, as reported by zpool status.
+type ZpoolStatus struct {
+	Name    string
+	State   string
+	Status  string
+	Action  string
+	See     string
+	Scan    ScanStatus
+	Removal RemovalStatus
+	Config  *Vdev
+	Logs    []*Vdev
+	Cache   []*Vdev
+	Spares  []*Vdev
+	Special []*Vdev
+	Dedup   []*Vdev
+	// Expansion is the progress of the expansion of a raidz vdev, see Zpool.Attach.
+	Expansion ExpansionStatus
+	// Errata holds the numbers of any errata zpool status has detected for the pool.
+	Errata []int
+	// Errors is the summary line of the errors section, e.g. "No known data errors".
+	Errors string
+	// ErrorFiles lists the files with permanent errors.
+	ErrorFiles []string
+}
+
+// zpoolRawOutput is a helper function to wrap calls to zpool whose output is not tab separated.
+func zpoolRawOutput(ctx context.Context, arg ...string) ([]byte, error) {
+	var out bytes.Buffer
+	c := command{Command: "zpool", Stdout: &out}
+	if _, err := c.Run(ctx, arg...); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// Status returns the detailed status of the zpool, including its vdev configuration, scan progress and data errors.
+func (z *Zpool) Status() (*ZpoolStatus, error) {
+	return z.StatusContext(context.Background())
+}
+
+// StatusContext is like Status but includes a context.
+func (z *Zpool) StatusContext(ctx context.Context) (*ZpoolStatus, error) {
+	return z.StatusWithOptionsContext(ctx, StatusOptions{})
+}
+
+// StatusOptions are options for Zpool.StatusWithOptions.
+//
+// A full description of these options may be found in the ZFS manual:
+// https://openzfs.github.io/openzfs-docs/man/8/zpool-status.8.html.
+type StatusOptions struct {
+	// GUIDs sets Vdev.GUID of every vdev (-g). Vdevs keep their names, so without JSON output a second zpool status
+	// is run, which lists the vdevs by guid. With JSON output the guids are always set.
+	GUIDs bool
+	// FullPaths names leaf vdevs by their full path, e.g. /dev/sda1 rather than sda (-P).
+	FullPaths bool
+}
+
+// StatusWithOptions is like Status, but with options, such as those needed to identify vdevs by guid,
+// e.g. to replace a missing device whose name is no longer known.
+func (z *Zpool) StatusWithOptions(opts StatusOptions) (*ZpoolStatus, error) {
+	return z.StatusWithOptionsContext(context.Background(), opts)
+}
+
+// StatusWithOptionsContext is like StatusWithOptions but includes a context.
+func (z *Zpool) StatusWithOptionsContext(ctx context.Context, opts StatusOptions) (*ZpoolStatus, error) {
+	var paths []string
+	if opts.FullPaths {
+		paths = []string{"-P"}
+	}
+	var statuses []*ZpoolStatus
+	if useJSON(ctx) {
+		args := append(append([]string{"status", "-j", "-v", "-p", "-t", "-i"}, paths...), z.Name)
+		out, err := zpoolRawOutput(ctx, args...)
+		if err != nil {
+			return nil, err
+		}
+		if statuses, err = parseZpoolStatusJSON(out); err != nil {
+			return nil, err
+		}
+	} else {
+		args := append(append([]string{"status", "-v", "-p", "-t"}, paths...), z.Name)
+		out, err := zpoolRawOutput(ctx, args...)
+		if err != nil {
+			return nil, err
+		}
+		if statuses, err = parseZpoolStatus(string(out)); err != nil {
+			return nil, err
+		}
+		if opts.GUIDs && len(statuses) == 1 {
+			if err := statuses[0].setGUIDs(ctx); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(statuses) != 1 {
+		return nil, fmt.Errorf("expected status of 1 pool, got %d", len(statuses))
+	}
+	return statuses[0], nil
+}
+
+// setGUIDs sets the guids of the vdevs from the output of zpool status -g, whose vdevs are in the same order.
+func (z *ZpoolStatus) setGUIDs(ctx context.Context) error {
+	out, err := zpoolRawOutput(ctx, "status", "-g", z.Name)
+	if err != nil {
+		return err
+	}
+	statuses, err := parseZpoolStatus(string(out))
+	if err != nil {
+		return err
+	}
+	if len(statuses) != 1 || statuses[0].Config == nil || z.Config == nil {
+		return fmt.Errorf("failed to list the vdevs of pool %s by guid", z.Name)
+	}
+	g := statuses[0]
+
+	var set func(names, guids []*Vdev) error
+	set = func(names, guids []*Vdev) error {
+		if len(names) != len(guids) {
+			return fmt.Errorf("the vdevs of pool %s changed while listing them by guid", z.Name)
+		}
+		for i, v := range names {
+			guid, err := strconv.ParseUint(guids[i].Name, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid guid of vdev %s: %w", v.Name, err)
+			}
+			v.GUID = guid
+			if err := set(v.Children, guids[i].Children); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	// the root vdev is listed by the name of the pool
+	for _, section := range [][2][]*Vdev{
+		{z.Config.Children, g.Config.Children}, {z.Logs, g.Logs}, {z.Cache, g.Cache},
+		{z.Spares, g.Spares}, {z.Special, g.Special}, {z.Dedup, g.Dedup},
+	} {
+		if err := set(section[0], section[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Parent returns the vdev whose child the given vdev is, such as the mirror of a disk, or nil for top-level vdevs,
+// including those of the logs, cache, spares, special and dedup sections, and for vdevs not part of the pool.
+func (z *ZpoolStatus) Parent(vdev *Vdev) *Vdev {
+	var find func(parent *Vdev, vdevs []*Vdev) *Vdev
+	find = func(parent *Vdev, vdevs []*Vdev) *Vdev {
+		for _, v := range vdevs {
+			if v == vdev {
+				return parent
+			}
+			if p := find(v, v.Children); p != nil {
+				return p
+			}
+		}
+		return nil
+	}
+	if z.Config == nil || vdev == z.Config {
+		return nil
+	}
+	for _, section := range [][]*Vdev{z.Config.Children, z.Logs, z.Cache, z.Spares, z.Special, z.Dedup} {
+		for _, v := range section {
+			if p := find(v, v.Children); p != nil {
+				return p
+			}
+		}
+	}
+	return nil
+}
+
+// VdevByGUID returns the vdev of the zpool with the given guid, or nil if there is none or the guids of the vdevs
+// are not known, see Vdev.GUID.
+func (z *ZpoolStatus) VdevByGUID(guid uint64) *Vdev {
+	var find func(vdevs []*Vdev) *Vdev
+	find = func(vdevs []*Vdev) *Vdev {
+		for _, v := range vdevs {
+			if v.GUID == guid {
+				return v
+			}
+			if c := find(v.Children); c != nil {
+				return c
+			}
+		}
+		return nil
+	}
+	if guid == 0 || z.Config == nil {
+		return nil
+	}
+	for _, section := range [][]*Vdev{{z.Config}, z.Logs, z.Cache, z.Spares, z.Special, z.Dedup} {
+		if v := find(section); v != nil {
+			return v
+		}
+	}
+	return nil
+}
+
+// Device returns how to address the vdev in device operations such as Zpool.Offline and Zpool.Replace:
+// its guid if it is known, which does not change when the device is renamed, and otherwise its name.
+func (v *Vdev) Device() string {
+	if v.GUID != 0 {
+		return strconv.FormatUint(v.GUID, 10)
+	}
+	return v.Name
+}
+
+var (
+	statusKeyRegex     = regexp.MustCompile(`^ *([a-z]+): ?(.*)$`)
+	errataRegex        = regexp.MustCompile(`Errata #(\d+) detected`)
+	scanStartRegex     = regexp.MustCompile(`^(scrub|resilver) (in progress|paused) since (.+)$`)
+	scanCanceledRegex  = regexp.MustCompile(`^(scrub|resilver) canceled on (.+)$`)
+	scanFinishedRegex  = regexp.MustCompile(`^(scrub repaired|resilvered) (\S+) in (.+) with (\d+) errors on (.+)$`)
+	scanStartedRegex   = regexp.MustCompile(`^(?:scrub|resilver) started on (.+)$`)
+	scanProgressRegex  = regexp.MustCompile(`^(\S+) scanned(?: at (\S+)/s)?, (\S+) issued(?: at (\S+)/s)?, (\S+) total$`)
+	scanTotalRegex     = regexp.MustCompile(`^(\S+) / (\S+) scanned(?: at (\S+)/s)?, (\S+) / \S+ issued(?: at (\S+)/s)?$`)
+	scanCompletedRegex = regexp.MustCompile(`^(\S+) (?:repaired|resilvered), ([\d.]+)% done(?:, (.+))?$`)
+	scanDurationRegex  = regexp.MustCompile(`^(?:(\d+) days )?(\d+):(\d+):(\d+)$`)
+
+	removalStartRegex    = regexp.MustCompile(`^Evacuation of (.+) in progress since (.+)$`)
+	removalFinishedRegex = regexp.MustCompile(`^Removal of (.+) copied (\S+) in (\S+), completed on (.+)$`)
+	removalCanceledRegex = regexp.MustCompile(`^Removal of (.+) canceled on (.+)$`)
+	removalProgressRegex = regexp.MustCompile(`^(\S+) copied out of (\S+) at (\S+)/s, ([\d.]+)% done(?:, (\S+) to go|, \(copy is slow, no estimated time\))?$`)
+	removalMemoryRegex   = regexp.MustCompile(`^(\S+) memory used for removed device mappings$`)
+	removalDurationRegex = regexp.MustCompile(`^(\d+)h(\d+)m$`)
+
+	expansionStartRegex    = regexp.MustCompile(`^expansion of (.+) in progress since (.+)$`)
+	expansionFinishedRegex = regexp.MustCompile(`^expanded (.+) copied (\S+) in (.+), on (.+)$`)
+	expansionProgressRegex = regexp.MustCompile(`^(\S+) / (\S+) copied at (\S+)/s, ([\d.]+)% done(?:, (paused for resilver or clear)|, \(copy is slow, no estimated time\)|, (.+) to go)?$`)
+
+	vdevNoteRegex = regexp.MustCompile(`\([^)]*\)`)
+)
+
+// example input for parseZpoolStatus
+//   pool: tank
+//  state: ONLINE
+//   scan: scrub repaired 0B in 00:00:01 with 0 errors on Sun Jul 25 10:00:01 2021
+// config:
+//
+//	NAME        STATE     READ WRITE CKSUM
+//	tank        ONLINE       0     0     0
+//	  mirror-0  ONLINE       0     0     0
+//	    sda     ONLINE       0     0     0
+//	    sdb     ONLINE       0     0     0
+//
+// errors: No known data errors
+
+func parseZpoolStatus(out string) ([]*ZpoolStatus, error) {
+	var statuses []*ZpoolStatus
+	var status *ZpoolStatus
+	var key string
+	var scan, removal, expansion, config []string
+
+	finish := func() error {
+		if status == nil {
+			return nil
+		}
+		if err := status.Scan.parse(scan); err != nil {
+			return fmt.Errorf("failed to parse scan status of pool %s: %w", status.Name, err)
+		}
+		if err := status.Removal.parse(removal); err != nil {
+			return fmt.Errorf("failed to parse removal status of pool %s: %w", status.Name, err)
+		}
+		if err := status.Expansion.parse(expansion); err != nil {
+			return fmt.Errorf("failed to parse expansion status of pool %s: %w", status.Name, err)
+		}
+		if err := status.parseConfig(config); err != nil {
+			return fmt.Errorf("failed to parse config of pool %s: %w", status.Name, err)
+		}
+		for _, m := range errataRegex.FindAllStringSubmatch(status.Status, -1) {
+			n, _ := strconv.Atoi(m[1])
+			status.Errata = append(status.Errata, n)
+		}
+		statuses = append(statuses, status)
+		return nil
+	}
+
+	for _, line := range strings.Split(out, "\n") {
+		if m := statusKeyRegex.FindStringSubmatch(line); m != nil && !strings.HasPrefix(line, "\t") {
+			key = m[1]
+			value := strings.TrimSpace(m[2])
+			if key == "pool" {
+				if err := finish(); err != nil {
+					return nil, err
+				}
+				status = &ZpoolStatus{Name: value}
+				scan, removal, expansion, config = nil, nil, nil, nil
+				continue
+			}
+			if status == nil {
+				return nil, fmt.Errorf("unexpected %q before pool name", key)
+			}
+			switch key {
+			case "state":
+				status.State = value
+			case "status":
+				status.Status = value
+			case "action":
+				status.Action = value
+			case "see":
+				status.See = value
+			case "scan":
+				scan = append(scan, value)
+			case "remove":
+				removal = append(removal, value)
+			case "expand":
+				expansion = append(expansion, value)
+			case "errors":
+				status.Errors = value
+			}
+			continue
+		}
+
+		trimmed := strings.TrimSpace(line)
+		if status == nil || trimmed == "" {
+			continue
+		}
+		switch key {
+		case "status":
+			status.Status += " " + trimmed
+		case "action":
+			status.Action += " " + trimmed
+		case "scan":
+			scan = append(scan, trimmed)
+		case "remove":
+			removal = append(removal, trimmed)
+		case "expand":
+			expansion = append(expansion, trimmed)
+		case "config":
+			config = append(config, line)
+		case "errors":
+			status.ErrorFiles = append(status.ErrorFiles, trimmed)
+		}
+	}
+	if err := finish(); err != nil {
+		return nil, err
+	}
+	return statuses, nil
+}
+
+func (z *ZpoolStatus) parseConfig(lines []string) error {
+	var section *[]*Vdev
+	var stack []*Vdev
+
+	for _, line := range lines {
+		line = strings.TrimPrefix(line, "\t")
+		fields := strings.Fields(line)
+		if len(fields) == 0 || (fields[0] == "NAME" && len(stack) == 0 && z.Config == nil) {
+			continue
+		}
+		depth := (len(line) - len(strings.TrimLeft(line, " "))) / 2
+
+		if depth == 0 {
+			stack = stack[:0]
+			// the root vdev comes first, zpool create -n prints it without a state
+			if len(fields) == 1 && z.Config != nil {
+				switch fields[0] {
+				case VdevSectionLogs:
+					section = &z.Logs
+				case VdevSectionCache:
+					section = &z.Cache
+				case VdevSectionSpares:
+					section = &z.Spares
+				case VdevSectionSpecial:
+					section = &z.Special
+				case VdevSectionDedup:
+					section = &z.Dedup
+				default:
+					return fmt.Errorf("unknown vdev section %q", fields[0])
+				}
+				stack = append(stack, nil)
+				continue
+			}
+			section = nil
+		}
+
+		vdev, err := parseVdev(fields)
+		if err != nil {
+			return err
+		}
+
+		if depth > len(stack) {
+			return fmt.Errorf("unexpected indentation of vdev %q", vdev.Name)
+		}
+		stack = stack[:depth]
+		if depth == 0 {
+			z.Config = vdev
+		} else if parent := stack[depth-1]; parent != nil {
+			parent.Children = append(parent.Children, vdev)
+		} else if section != nil {
+			*section = append(*section, vdev)
+		}
+		stack = append(stack, vdev)
+	}
+	return nil
+}
+
+func parseVdev(fields []string) (*Vdev, error) {
+	vdev := &Vdev{Name: fields[0]}
+	if len(fields) < 2 {
+		return vdev, nil
+	}
+	vdev.State = fields[1]
+	rest := fields[2:]
+
+	if len(rest) >= 3 && isCount(rest[0]) && isCount(rest[1]) && isCount(rest[2]) {
+		for i, field := range []*uint64{&vdev.Read, &vdev.Write, &vdev.Checksum} {
+			v, err := parseHumanSize(rest[i])
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse error count of vdev %q: %w", vdev.Name, err)
+			}
+			*field = v
+		}
+		rest = rest[3:]
+	}
+	vdev.Message = strings.Join(rest, " ")
+	vdev.StateDetail = strings.Join(strings.Fields(vdevNoteRegex.ReplaceAllString(vdev.Message, "")), " ")
+	if err := vdev.parseProgress(); err != nil {
+		return nil, fmt.Errorf("failed to parse progress of vdev %q: %w", vdev.Name, err)
+	}
+	return vdev, nil
+}
+
+func isCount(s string) bool {
+	_, err := parseHumanSize(s)
+	return err == nil
+}
+
+func (s *ScanStatus) parse(lines []string) error {
+	s.Raw = strings.Join(lines, "\n")
+	if len(lines) == 0 || lines[0] == "none requested" {
+		s.State = ScanStateNone
+		return nil
+	}
+
+	var err error
+	first := lines[0]
+	switch {
+	case scanStartRegex.MatchString(first):
+		m := scanStartRegex.FindStringSubmatch(first)
+		s.Function = m[1]
+		s.State = ScanStateInProgress
+		if m[2] == "paused" {
+			s.State = ScanStatePaused
+		}
+		if s.State == ScanStateInProgress {
+			s.Start, err = parseStatusTime(m[3])
+		}
+	case scanCanceledRegex.MatchString(first):
+		m := scanCanceledRegex.FindStringSubmatch(first)
+		s.Function = m[1]
+		s.State = ScanStateCanceled
+		s.End, err = parseStatusTime(m[2])
+	case scanFinishedRegex.MatchString(first):
+		m := scanFinishedRegex.FindStringSubmatch(first)
+		s.Function = ScanFunctionScrub
+		if m[1] == "resilvered" {
+			s.Function = ScanFunctionResilver
+		}
+		s.State = ScanStateFinished
+		if s.Repaired, err = parseHumanSize(m[2]); err != nil {
+			return err
+		}
+		if s.Duration, err = parseScanDuration(m[3]); err != nil {
+			return err
+		}
+		if s.Errors, err = strconv.ParseUint(m[4], 10, 64); err != nil {
+			return err
+		}
+		s.End, err = parseStatusTime(m[5])
+	default:
+		return fmt.Errorf("unknown scan status %q", first)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, line := range lines[1:] {
+		if err := s.parseProgress(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *ScanStatus) parseProgress(line string) error {
+	var err error
+	switch {
+	case scanStartedRegex.MatchString(line):
+		s.Start, err = parseStatusTime(scanStartedRegex.FindStringSubmatch(line)[1])
+	case scanProgressRegex.MatchString(line):
+		m := scanProgressRegex.FindStringSubmatch(line)
+		return parseSizes(m[1:], &s.Scanned, &s.ScanRate, &s.Issued, &s.IssueRate, &s.Total)
+	// since OpenZFS 2.2 the total follows both the scanned and the issued size
+	case scanTotalRegex.MatchString(line):
+		m := scanTotalRegex.FindStringSubmatch(line)
+		return parseSizes(m[1:], &s.Scanned, &s.Total, &s.ScanRate, &s.Issued, &s.IssueRate)
+	case scanCompletedRegex.MatchString(line):
+		m := scanCompletedRegex.FindStringSubmatch(line)
+		if s.Repaired, err = parseHumanSize(m[1]); err != nil {
+			return err
+		}
+		if s.PercentDone, err = strconv.ParseFloat(m[2], 64); err != nil {
+			return err
+		}
+		if strings.HasSuffix(m[3], " to go") {
+			s.TimeRemaining, err = parseScanDuration(strings.TrimSuffix(m[3], " to go"))
+		}
+	}
+	return err
+}
+
+// parseSizes parses the human readable sizes into the fields in the same order, skipping empty sizes.
+func parseSizes(sizes []string, fields ...*uint64) error {
+	var err error
+	for i, field := range fields {
+		if sizes[i] == "" {
+			continue
+		}
+		if *field, err = parseHumanSize(sizes[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *RemovalStatus) parse(lines []string) error {
+	r.Raw = strings.Join(lines, "\n")
+	r.State = ScanStateNone
+	if len(lines) == 0 {
+		return nil
+	}
+
+	var err error
+	first := lines[0]
+	switch {
+	case removalStartRegex.MatchString(first):
+		m := removalStartRegex.FindStringSubmatch(first)
+		r.State = ScanStateInProgress
+		r.Device = m[1]
+		r.Start, err = parseStatusTime(m[2])
+	case removalFinishedRegex.MatchString(first):
+		m := removalFinishedRegex.FindStringSubmatch(first)
+		r.State = ScanStateFinished
+		r.Device = m[1]
+		if r.Copied, err = parseHumanSize(m[2]); err != nil {
+			return err
+		}
+		r.Total = r.Copied
+		r.PercentDone = 100
+		if r.Duration, err = parseRemovalDuration(m[3]); err != nil {
+			return err
+		}
+		r.End, err = parseStatusTime(m[4])
+	case removalCanceledRegex.MatchString(first):
+		m := removalCanceledRegex.FindStringSubmatch(first)
+		r.State = ScanStateCanceled
+		r.Device = m[1]
+		r.End, err = parseStatusTime(m[2])
+	default:
+		return fmt.Errorf("unknown removal status %q", first)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, line := range lines[1:] {
+		switch {
+		case removalProgressRegex.MatchString(line):
+			m := removalProgressRegex.FindStringSubmatch(line)
+			for i, field := range []*uint64{&r.Copied, &r.Total, &r.Rate} {
+				if *field, err = parseHumanSize(m[i+1]); err != nil {
+					return err
+				}
+			}
+			if r.PercentDone, err = strconv.ParseFloat(m[4], 64); err != nil {
+				return err
+			}
+			if m[5] != "" {
+				if r.TimeRemaining, err = parseRemovalDuration(m[5]); err != nil {
+					return err
+				}
+			}
+		case removalMemoryRegex.MatchString(line):
+			if r.MappingMemory, err = parseHumanSize(removalMemoryRegex.FindStringSubmatch(line)[1]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (e *ExpansionStatus) parse(lines []string) error {
+	e.Raw = strings.Join(lines, "\n")
+	e.State = ScanStateNone
+	if len(lines) == 0 {
+		return nil
+	}
+
+	var err error
+	first := lines[0]
+	switch {
+	case expansionStartRegex.MatchString(first):
+		m := expansionStartRegex.FindStringSubmatch(first)
+		e.State = ScanStateInProgress
+		e.Vdev = m[1]
+		e.Start, err = parseStatusTime(m[2])
+	case expansionFinishedRegex.MatchString(first):
+		m := expansionFinishedRegex.FindStringSubmatch(first)
+		e.State = ScanStateFinished
+		e.Vdev = m[1]
+		if e.Copied, err = parseHumanSize(m[2]); err != nil {
+			return err
+		}
+		e.Total = e.Copied
+		e.PercentDone = 100
+		if e.Duration, err = parseScanDuration(m[3]); err != nil {
+			return err
+		}
+		e.End, err = parseStatusTime(m[4])
+	default:
+		return fmt.Errorf("unknown expansion status %q", first)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, line := range lines[1:] {
+		m := expansionProgressRegex.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		for i, field := range []*uint64{&e.Copied, &e.Total, &e.Rate} {
+			if *field, err = parseHumanSize(m[i+1]); err != nil {
+				return err
+			}
+		}
+		if e.PercentDone, err = strconv.ParseFloat(m[4], 64); err != nil {
+			return err
+		}
+		if m[5] != "" {
+			e.State = ScanStatePaused
+		}
+		if m[6] != "" {
+			if e.TimeRemaining, err = parseScanDuration(m[6]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// parseRemovalDuration parses durations as printed by zpool status for removals, e.g. "2h30m".
+func parseRemovalDuration(s string) (time.Duration, error) {
+	m := removalDurationRegex.FindStringSubmatch(s)
+	if m == nil {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	hours, _ := strconv.ParseUint(m[1], 10, 64)
+	mins, _ := strconv.ParseUint(m[2], 10, 64)
+	return time.Duration(hours)*time.Hour + time.Duration(mins)*time.Minute, nil
+}
+
+// parseStatusTime parses a timestamp as printed by zpool status, which uses the local time zone of the host.
+func parseStatusTime(s string) (time.Time, error) {
+	return time.ParseInLocation(time.ANSIC, s, time.Local)
+}
+
+// parseScanDuration parses durations as printed by zpool status, e.g. "00:03:20" or "1 days 02:03:04".
+func parseScanDuration(s string) (time.Duration, error) {
+	m := scanDurationRegex.FindStringSubmatch(s)
+	if m == nil {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	var d time.Duration
+	for i, unit := range []time.Duration{24 * time.Hour, time.Hour, time.Minute, time.Second} {
+		if m[i+1] == "" {
+			continue
+		}
+		v, err := strconv.ParseUint(m[i+1], 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		d += time.Duration(v) * unit
+	}
+	return d, nil
+}
+
+// parseHumanSize parses sizes as printed by the zfs tools without -p, e.g. "1.23G" or "0B", as well as exact values.
+func parseHumanSize(s string) (uint64, error) {
+	if v, err := strconv.ParseUint(s, 10, 64); err == nil {
+		return v, nil
+	}
+	if s == "" {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+
+	suffixes := "BKMGTPE"
+	i := strings.IndexByte(suffixes, s[len(s)-1])
+	if i < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	v, err := strconv.ParseFloat(s[:len(s)-1], 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	for ; i > 0; i-- {
+		v *= 1024
+	}
+	return uint64(v), nil
+}
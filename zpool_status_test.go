@@ -0,0 +1,483 @@
+package zfs
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const statusScrubInProgress = `  pool: tank
+ state: DEGRADED
+status: One or more devices could not be used because the label is missing or
+	invalid.  Sufficient replicas exist for the pool to continue
+	functioning in a degraded state.
+action: Replace the device using 'zpool replace'.
+   see: https://openzfs.github.io/openzfs-docs/msg/ZFS-8000-4J
+  scan: scrub in progress since Sun Jul 25 10:00:00 2021
+	1.50G scanned at 100M/s, 512M issued at 50M/s, 10G total
+	0B repaired, 5.00% done, 1 days 00:03:20 to go
+config:
+
+	NAME        STATE     READ WRITE CKSUM
+	tank        DEGRADED     0     0     0
+	  mirror-0  DEGRADED     0     0     0
+	    sda     ONLINE       0     0     3
+	    sdb     UNAVAIL      0     0     0  was /dev/sdb1
+	logs
+	  sdc       ONLINE       0     0     0
+	cache
+	  sdd       ONLINE       0     0     0
+	spares
+	  sde       AVAIL
+
+errors: Permanent errors have been detected in the following files:
+
+        /tank/file
+        tank/fs@snap:/path
+`
+
+const statusScrubFinished = `  pool: tank
+ state: ONLINE
+status: Errata #4 detected.
+action: To correct the issue run 'zpool scrub'.
+  scan: scrub repaired 1K in 00:00:01 with 2 errors on Sun Jul 25 10:00:01 2021
+config:
+
+	NAME        STATE     READ WRITE CKSUM
+	tank        ONLINE       0     0     0
+	  sda       ONLINE       0     0     0
+
+errors: No known data errors
+
+  pool: other
+ state: ONLINE
+  scan: none requested
+config:
+
+	NAME        STATE     READ WRITE CKSUM
+	other       ONLINE       0     0     0
+	  /tmp/f    ONLINE       0     0     0
+
+errors: No known data errors
+`
+
+func TestParseZpoolStatus(t *testing.T) {
+	statuses, err := parseZpoolStatus(statusScrubInProgress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 1 {
+		t.Fatalf("expected 1 status, got %d", len(statuses))
+	}
+	s := statuses[0]
+
+	if s.Name != "tank" || s.State != ZpoolDegraded {
+		t.Fatalf("unexpected pool %q state %q", s.Name, s.State)
+	}
+	wantStatus := "One or more devices could not be used because the label is missing or invalid.  " +
+		"Sufficient replicas exist for the pool to continue functioning in a degraded state."
+	if s.Status != wantStatus {
+		t.Fatalf("unexpected status: %q", s.Status)
+	}
+	if s.See != "https://openzfs.github.io/openzfs-docs/msg/ZFS-8000-4J" {
+		t.Fatalf("unexpected see: %q", s.See)
+	}
+
+	wantScan := ScanStatus{
+		Function:      ScanFunctionScrub,
+		State:         ScanStateInProgress,
+		Start:         time.Date(2021, time.July, 25, 10, 0, 0, 0, time.Local),
+		Scanned:       1536 << 20,
+		ScanRate:      100 << 20,
+		Issued:        512 << 20,
+		IssueRate:     50 << 20,
+		Total:         10 << 30,
+		PercentDone:   5,
+		TimeRemaining: 24*time.Hour + 3*time.Minute + 20*time.Second,
+	}
+	wantScan.Raw = s.Scan.Raw
+	if !reflect.DeepEqual(wantScan, s.Scan) {
+		t.Fatalf("unexpected scan status:\nwant: %+v\ngot:  %+v", wantScan, s.Scan)
+	}
+
+	wantConfig := &Vdev{Name: "tank", State: ZpoolDegraded, Children: []*Vdev{
+		{Name: "mirror-0", State: ZpoolDegraded, Children: []*Vdev{
+			{Name: "sda", State: ZpoolOnline, Checksum: 3},
+			{Name: "sdb", State: ZpoolUnavail, Message: "was /dev/sdb1", StateDetail: "was /dev/sdb1"},
+		}},
+	}}
+	if !reflect.DeepEqual(wantConfig, s.Config) {
+		t.Fatalf("unexpected config:\nwant: %+v\ngot:  %+v", wantConfig, s.Config)
+	}
+	equalVdevs(t, []*Vdev{{Name: "sdc", State: ZpoolOnline}}, s.Logs)
+	equalVdevs(t, []*Vdev{{Name: "sdd", State: ZpoolOnline}}, s.Cache)
+	equalVdevs(t, []*Vdev{{Name: "sde", State: "AVAIL"}}, s.Spares)
+
+	if !reflect.DeepEqual([]string{"/tank/file", "tank/fs@snap:/path"}, s.ErrorFiles) {
+		t.Fatalf("unexpected error files: %q", s.ErrorFiles)
+	}
+}
+
+func TestParseZpoolStatusMultiple(t *testing.T) {
+	statuses, err := parseZpoolStatus(statusScrubFinished)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 2 {
+		t.Fatalf("expected 2 statuses, got %d", len(statuses))
+	}
+
+	s := statuses[0]
+	if !reflect.DeepEqual([]int{4}, s.Errata) {
+		t.Fatalf("unexpected errata: %v", s.Errata)
+	}
+	if s.Errors != "No known data errors" || s.ErrorFiles != nil {
+		t.Fatalf("unexpected errors: %q %q", s.Errors, s.ErrorFiles)
+	}
+	if s.Scan.State != ScanStateFinished || s.Scan.Repaired != 1024 || s.Scan.Errors != 2 || s.Scan.Duration != time.Second {
+		t.Fatalf("unexpected scan status: %+v", s.Scan)
+	}
+
+	s = statuses[1]
+	if s.Name != "other" || s.Scan.State != ScanStateNone {
+		t.Fatalf("unexpected pool %q scan state %q", s.Name, s.Scan.State)
+	}
+	equalVdevs(t, []*Vdev{{Name: "/tmp/f", State: ZpoolOnline}}, s.Config.Children)
+}
+
+const statusScrubInProgressTotal = `  pool: tank
+ state: ONLINE
+  scan: scrub in progress since Sun Oct  1 10:00:00 2023
+	1.50G / 10G scanned at 100M/s, 512M / 10G issued at 50M/s
+	0B repaired, 5.00% done, 00:03:20 to go
+config:
+
+	NAME        STATE     READ WRITE CKSUM
+	tank        ONLINE       0     0     0
+	  sda       ONLINE       0     0     0
+
+errors: No known data errors
+`
+
+func TestParseZpoolStatusScanTotal(t *testing.T) {
+	statuses, err := parseZpoolStatus(statusScrubInProgressTotal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantScan := ScanStatus{
+		Function:      ScanFunctionScrub,
+		State:         ScanStateInProgress,
+		Start:         time.Date(2023, time.October, 1, 10, 0, 0, 0, time.Local),
+		Scanned:       1536 << 20,
+		ScanRate:      100 << 20,
+		Issued:        512 << 20,
+		IssueRate:     50 << 20,
+		Total:         10 << 30,
+		PercentDone:   5,
+		TimeRemaining: 3*time.Minute + 20*time.Second,
+	}
+	wantScan.Raw = statuses[0].Scan.Raw
+	if !reflect.DeepEqual(wantScan, statuses[0].Scan) {
+		t.Fatalf("unexpected scan status:\nwant: %+v\ngot:  %+v", wantScan, statuses[0].Scan)
+	}
+
+	// the scan rate is omitted once all metadata was scanned
+	scanned := strings.Replace(statusScrubInProgressTotal, "1.50G / 10G scanned at 100M/s", "10G / 10G scanned", 1)
+	if statuses, err = parseZpoolStatus(scanned); err != nil {
+		t.Fatal(err)
+	}
+	if s := statuses[0].Scan; s.Scanned != 10<<30 || s.ScanRate != 0 || s.Issued != 512<<20 || s.Total != 10<<30 {
+		t.Fatalf("unexpected scan status: %+v", s)
+	}
+}
+
+const statusRemoval = `  pool: tank
+ state: ONLINE
+  scan: none requested
+remove: Evacuation of sdb in progress since Mon Jul 26 10:00:00 2021
+	1.50G copied out of 10G at 100M/s, 15.00% done, 0h1m to go
+	1.23M memory used for removed device mappings
+config:
+
+	NAME        STATE     READ WRITE CKSUM
+	tank        ONLINE       0     0     0
+	  sda       ONLINE       0     0     0
+	  sdb       ONLINE       0     0     0  (removing)
+
+errors: No known data errors
+
+  pool: other
+ state: ONLINE
+remove: Removal of vdev 1 copied 2G in 1h30m, completed on Mon Jul 26 11:30:00 2021
+	512K memory used for removed device mappings
+config:
+
+	NAME        STATE     READ WRITE CKSUM
+	other       ONLINE       0     0     0
+	  sdc       ONLINE       0     0     0
+
+errors: No known data errors
+`
+
+func TestParseRemovalStatus(t *testing.T) {
+	statuses, err := parseZpoolStatus(statusRemoval)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 2 {
+		t.Fatalf("expected 2 statuses, got %d", len(statuses))
+	}
+
+	want := RemovalStatus{
+		State:         ScanStateInProgress,
+		Device:        "sdb",
+		Start:         time.Date(2021, time.July, 26, 10, 0, 0, 0, time.Local),
+		Copied:        1536 << 20,
+		Total:         10 << 30,
+		Rate:          100 << 20,
+		PercentDone:   15,
+		TimeRemaining: time.Minute,
+		MappingMemory: 1289748,
+	}
+	want.Raw = statuses[0].Removal.Raw
+	if !reflect.DeepEqual(want, statuses[0].Removal) {
+		t.Fatalf("unexpected removal status:\nwant: %+v\ngot:  %+v", want, statuses[0].Removal)
+	}
+	if msg := statuses[0].Config.Children[1].Message; msg != "(removing)" {
+		t.Fatalf("unexpected message: %q", msg)
+	}
+
+	want = RemovalStatus{
+		State:         ScanStateFinished,
+		Device:        "vdev 1",
+		End:           time.Date(2021, time.July, 26, 11, 30, 0, 0, time.Local),
+		Copied:        2 << 30,
+		Total:         2 << 30,
+		PercentDone:   100,
+		Duration:      90 * time.Minute,
+		MappingMemory: 512 << 10,
+	}
+	want.Raw = statuses[1].Removal.Raw
+	if !reflect.DeepEqual(want, statuses[1].Removal) {
+		t.Fatalf("unexpected removal status:\nwant: %+v\ngot:  %+v", want, statuses[1].Removal)
+	}
+}
+
+const statusExpansion = `  pool: tank
+ state: ONLINE
+expand: expansion of raidz1 in progress since Mon Jul 26 10:00:00 2021
+	1.50G / 10G copied at 100M/s, 15.00% done, 00:01:27 to go
+config:
+
+	NAME        STATE     READ WRITE CKSUM
+	tank        ONLINE       0     0     0
+	  raidz1-0  ONLINE       0     0     0
+	    sda     ONLINE       0     0     0
+	    sdb     ONLINE       0     0     0
+	    sdc     ONLINE       0     0     0
+
+errors: No known data errors
+
+  pool: other
+ state: ONLINE
+expand: expanded raidz2-1 copied 2G in 01:30:00, on Mon Jul 26 11:30:00 2021
+
+config:
+
+	NAME        STATE     READ WRITE CKSUM
+	other       ONLINE       0     0     0
+
+errors: No known data errors
+`
+
+func TestParseExpansionStatus(t *testing.T) {
+	statuses, err := parseZpoolStatus(statusExpansion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 2 {
+		t.Fatalf("expected 2 statuses, got %d", len(statuses))
+	}
+
+	want := ExpansionStatus{
+		State:         ScanStateInProgress,
+		Vdev:          "raidz1",
+		Start:         time.Date(2021, time.July, 26, 10, 0, 0, 0, time.Local),
+		Copied:        1536 << 20,
+		Total:         10 << 30,
+		Rate:          100 << 20,
+		PercentDone:   15,
+		TimeRemaining: 87 * time.Second,
+	}
+	want.Raw = statuses[0].Expansion.Raw
+	if !reflect.DeepEqual(want, statuses[0].Expansion) {
+		t.Fatalf("unexpected expansion status:\nwant: %+v\ngot:  %+v", want, statuses[0].Expansion)
+	}
+
+	want = ExpansionStatus{
+		State:       ScanStateFinished,
+		Vdev:        "raidz2-1",
+		End:         time.Date(2021, time.July, 26, 11, 30, 0, 0, time.Local),
+		Copied:      2 << 30,
+		Total:       2 << 30,
+		PercentDone: 100,
+		Duration:    90 * time.Minute,
+	}
+	want.Raw = statuses[1].Expansion.Raw
+	if !reflect.DeepEqual(want, statuses[1].Expansion) {
+		t.Fatalf("unexpected expansion status:\nwant: %+v\ngot:  %+v", want, statuses[1].Expansion)
+	}
+
+	paused := strings.Replace(statusExpansion, "00:01:27 to go", "paused for resilver or clear", 1)
+	if statuses, err = parseZpoolStatus(paused); err != nil {
+		t.Fatal(err)
+	}
+	if e := statuses[0].Expansion; e.State != ScanStatePaused || e.TimeRemaining != 0 {
+		t.Fatalf("unexpected expansion status: %+v", e)
+	}
+}
+
+func TestParseHumanSize(t *testing.T) {
+	for in, want := range map[string]uint64{
+		"0":     0,
+		"0B":    0,
+		"123":   123,
+		"1K":    1024,
+		"1.50G": 1536 << 20,
+		"2T":    2 << 40,
+	} {
+		got, err := parseHumanSize(in)
+		if err != nil {
+			t.Fatalf("unexpected error parsing %q: %v", in, err)
+		}
+		if got != want {
+			t.Fatalf("parsing %q: want %d, got %d", in, want, got)
+		}
+	}
+	for _, in := range []string{"", "G", "x", "-1K", "1.2.3M"} {
+		if _, err := parseHumanSize(in); err == nil {
+			t.Fatalf("expected error parsing %q", in)
+		}
+	}
+}
+
+func equalVdevs(t *testing.T, want, got []*Vdev) {
+	t.Helper()
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("unexpected vdevs:\nwant: %+v\ngot:  %+v", want, got)
+	}
+}
+
+func TestNewScrubStatus(t *testing.T) {
+	got := newScrubStatus(&ScanStatus{Function: ScanFunctionResilver, State: ScanStateInProgress})
+	if got.State != ScanStateNone {
+		t.Fatalf("resilver should not be reported as a scrub, got state %q", got.State)
+	}
+
+	got = newScrubStatus(&ScanStatus{Function: ScanFunctionScrub, State: ScanStatePaused, Issued: 10, PercentDone: 50})
+	want := &ScrubStatus{State: ScanStatePaused, Issued: 10, PercentDone: 50}
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("want: %+v, got: %+v", want, got)
+	}
+}
+
+const statusGUIDs = `  pool: tank
+ state: DEGRADED
+config:
+
+	NAME                      STATE     READ WRITE CKSUM
+	tank                      DEGRADED     0     0     0
+	  1111111111111111111     DEGRADED     0     0     0
+	    2222222222222222222   ONLINE       0     0     3
+	    3333333333333333333   UNAVAIL      0     0     0  was /dev/sdb1
+	logs
+	  4444444444444444444     ONLINE       0     0     0
+	cache
+	  5555555555555555555     ONLINE       0     0     0
+	spares
+	  6666666666666666666     AVAIL
+
+errors: No known data errors
+`
+
+func TestStatusWithOptions(t *testing.T) {
+	r := &fakeRunner{output: func(args []string) (string, error) {
+		for _, arg := range args {
+			if arg == "-g" {
+				return statusGUIDs, nil
+			}
+		}
+		return statusScrubInProgress, nil
+	}}
+	ctx := WithRunner(context.Background(), r)
+	z := &Zpool{Name: "tank"}
+
+	s, err := z.StatusWithOptionsContext(ctx, StatusOptions{GUIDs: true, FullPaths: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{{"zpool", "status", "-v", "-p", "-t", "-P", "tank"}, {"zpool", "status", "-g", "tank"}}
+	if got := r.calls[len(r.calls)-2:]; !reflect.DeepEqual(want, got) {
+		t.Fatalf("want: %q, got: %q", want, got)
+	}
+	mirror := s.Config.Children[0]
+	var guids []uint64
+	for _, v := range []*Vdev{mirror, mirror.Children[0], mirror.Children[1], s.Logs[0], s.Cache[0], s.Spares[0]} {
+		guids = append(guids, v.GUID)
+	}
+	wantGUIDs := []uint64{
+		1111111111111111111, 2222222222222222222, 3333333333333333333,
+		4444444444444444444, 5555555555555555555, 6666666666666666666,
+	}
+	if !reflect.DeepEqual(wantGUIDs, guids) {
+		t.Fatalf("want: %v, got: %v", wantGUIDs, guids)
+	}
+	if mirror.Children[1].Name != "sdb" || mirror.Children[1].StateDetail != "was /dev/sdb1" {
+		t.Fatalf("unexpected vdev: %+v", mirror.Children[1])
+	}
+
+	if p := s.Parent(mirror.Children[1]); p != mirror {
+		t.Fatalf("want parent: %+v, got: %+v", mirror, p)
+	}
+	for _, v := range []*Vdev{s.Config, mirror, s.Logs[0], {Name: "sdb"}} {
+		if p := s.Parent(v); p != nil {
+			t.Fatalf("want no parent of %s, got: %+v", v.Name, p)
+		}
+	}
+
+	if v := s.VdevByGUID(3333333333333333333); v != mirror.Children[1] {
+		t.Fatalf("want vdev: %+v, got: %+v", mirror.Children[1], v)
+	}
+	if v := s.VdevByGUID(6666666666666666666); v != s.Spares[0] {
+		t.Fatalf("want vdev: %+v, got: %+v", s.Spares[0], v)
+	}
+	if v := s.VdevByGUID(42); v != nil {
+		t.Fatalf("want no vdev, got: %+v", v)
+	}
+	if d := mirror.Children[1].Device(); d != "3333333333333333333" {
+		t.Fatalf("want device: 3333333333333333333, got: %s", d)
+	}
+	if d := (&Vdev{Name: "sdb"}).Device(); d != "sdb" {
+		t.Fatalf("want device: sdb, got: %s", d)
+	}
+}
+
+func TestParseVdevStateDetail(t *testing.T) {
+	for message, want := range map[string]string{
+		"":                             "",
+		"(resilvering)":                "",
+		"too many errors  (repairing)": "too many errors",
+		"(100% trimmed, completed at Sun Jul 25 10:00:00 2021)": "",
+		"was /dev/sdb1": "was /dev/sdb1",
+	} {
+		v, err := parseVdev(append([]string{"sda", ZpoolFaulted, "0", "0", "0"}, strings.Fields(message)...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v.StateDetail != want {
+			t.Fatalf("want state detail of %q: %q, got: %q", message, want, v.StateDetail)
+		}
+	}
+}
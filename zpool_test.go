@@ -0,0 +1,89 @@
+package zfs
+
+import (
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestParseZpoolList(t *testing.T) {
+	if runtime.GOOS == "solaris" {
+		t.Skip("zpool list columns differ on solaris")
+	}
+
+	got, err := parseZpoolList([][]string{
+		{"tank", "ONLINE", "1073741824", "10737418240", "9663676416", "off", "1.50x", "3", "0", "0", "-", "1234567890123456789"},
+		{"backup", "DEGRADED", "0", "1048576", "1048576", "on", "1.00x", "-", "4096", "0", "8192", "42"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*Zpool{
+		{Name: "tank", Health: ZpoolOnline, Allocated: 1073741824, Size: 10737418240, Free: 9663676416, DedupRatio: 1.5, Fragmentation: 3, GUID: 1234567890123456789},
+		{Name: "backup", Health: ZpoolDegraded, Size: 1048576, Free: 1048576, ReadOnly: true, DedupRatio: 1, Freeing: 4096, CheckpointSize: 8192, GUID: 42},
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("want: %+v, got: %+v", want, got)
+	}
+
+	if _, err := parseZpoolList([][]string{{"tank", "ONLINE"}}); err == nil {
+		t.Fatal("expected error for short line")
+	}
+}
+
+func TestReguidReopen(t *testing.T) {
+	ctx, r := withFakeRunner("")
+	z := &Zpool{Name: "tank"}
+	if err := z.ReguidContext(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := z.ReopenContext(ctx); err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{{"zpool", "reguid", "tank"}, {"zpool", "reopen", "tank"}}
+	if !reflect.DeepEqual(want, r.calls) {
+		t.Fatalf("want: %q, got: %q", want, r.calls)
+	}
+}
+
+func TestCreateZpoolWithOptions(t *testing.T) {
+	ctx, r := withFakeRunner("")
+	spec := VdevSpec{Data: []VdevGroup{Mirror("sda", "sdb")}}
+	z, err := CreateZpoolWithOptionsContext(ctx, "tank", spec, CreateZpoolOptions{
+		Ashift:               12,
+		AutoTrim:             true,
+		AutoExpand:           true,
+		AltRoot:              "/mnt",
+		Mountpoint:           "none",
+		CacheFile:            "none",
+		Force:                true,
+		Properties:           map[string]string{"comment": "backup", "ashift": "9"},
+		FilesystemProperties: map[string]string{"compression": "lz4", "atime": "off"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if z.Name != "tank" {
+		t.Fatalf("unexpected pool: %+v", z)
+	}
+	want := [][]string{{
+		"zpool", "create", "-f", "-o", "ashift=12", "-o", "autoexpand=on", "-o", "autotrim=on", "-o", "cachefile=none",
+		"-o", "comment=backup", "-O", "atime=off", "-O", "compression=lz4", "-R", "/mnt", "-m", "none",
+		"tank", "mirror", "sda", "sdb",
+	}}
+	if !reflect.DeepEqual(want, r.calls) {
+		t.Fatalf("want: %q, got: %q", want, r.calls)
+	}
+
+	for _, opts := range []CreateZpoolOptions{{Ashift: 8}, {Ashift: 17}} {
+		if _, err := CreateZpoolWithOptionsContext(ctx, "tank", spec, opts); err == nil {
+			t.Fatalf("expected error for options %+v", opts)
+		}
+	}
+	if _, err := CreateZpoolWithOptionsContext(ctx, "tank", VdevSpec{}, CreateZpoolOptions{}); err == nil {
+		t.Fatal("expected error without vdevs")
+	}
+	if len(r.calls) != 1 {
+		t.Fatalf("zpool was run for invalid options: %q", r.calls[1:])
+	}
+}
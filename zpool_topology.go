@@ -0,0 +1,401 @@
+package zfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Vdev group types which can be used in a VdevGroup.
+//
+// More information regarding vdev types can be found in the ZFS manual:
+// https://openzfs.github.io/openzfs-docs/man/7/zpoolconcepts.7.html#Virtual_Devices_(vdevs)
+const (
+	VdevDisk   = ""
+	VdevMirror = "mirror"
+	VdevRaidz1 = "raidz1"
+	VdevRaidz2 = "raidz2"
+	VdevRaidz3 = "raidz3"
+	VdevDraid1 = "draid1"
+	VdevDraid2 = "draid2"
+	VdevDraid3 = "draid3"
+)
+
+// VdevGroup is a single top-level vdev: either a plain disk, or a mirror, raidz or draid group of devices.
+type VdevGroup struct {
+	Type    string   `json:"type,omitempty"`
+	Devices []string `json:"devices"`
+
+	// DraidData is the number of data devices per redundancy group of a draid vdev, zero uses the zpool default.
+	DraidData int `json:"draid_data,omitempty"`
+	// DraidSpares is the number of distributed spares of a draid vdev.
+	DraidSpares int `json:"draid_spares,omitempty"`
+}
+
+// Disk returns a VdevGroup consisting of a single device.
+func Disk(device string) VdevGroup {
+	return VdevGroup{Type: VdevDisk, Devices: []string{device}}
+}
+
+// Mirror returns a VdevGroup mirroring the given devices.
+func Mirror(devices ...string) VdevGroup {
+	return VdevGroup{Type: VdevMirror, Devices: devices}
+}
+
+// Raidz returns a raidz VdevGroup of the given parity (1, 2 or 3) over the given devices.
+func Raidz(parity int, devices ...string) VdevGroup {
+	return VdevGroup{Type: "raidz" + strconv.Itoa(parity), Devices: devices}
+}
+
+// Draid returns a draid VdevGroup of the given parity (1, 2 or 3) with the given number of data devices per
+// redundancy group and distributed spares over the given devices.
+func Draid(parity, data, spares int, devices ...string) VdevGroup {
+	return VdevGroup{Type: "draid" + strconv.Itoa(parity), Devices: devices, DraidData: data, DraidSpares: spares}
+}
+
+// VdevSpec describes the vdev topology of a pool, as passed to CreateZpoolWithTopology.
+type VdevSpec struct {
+	Data    []VdevGroup `json:"data"`
+	Logs    []VdevGroup `json:"logs,omitempty"`
+	Special []VdevGroup `json:"special,omitempty"`
+	Dedup   []VdevGroup `json:"dedup,omitempty"`
+	Cache   []string    `json:"cache,omitempty"`
+	Spares  []string    `json:"spares,omitempty"`
+}
+
+// Validate checks that the topology is well formed and can be rendered to zpool arguments.
+func (s *VdevSpec) Validate() error {
+	if len(s.Data) == 0 {
+		return errors.New("at least one data vdev is required")
+	}
+	return s.validate()
+}
+
+// validate checks the vdevs of the topology, which need not contain data vdevs when they are added to a pool.
+func (s *VdevSpec) validate() error {
+	seen := map[string]bool{}
+	checkDevices := func(devices []string) error {
+		for _, dev := range devices {
+			if dev == "" {
+				return errors.New("empty device name")
+			}
+			if seen[dev] {
+				return fmt.Errorf("device %q is used more than once", dev)
+			}
+			seen[dev] = true
+		}
+		return nil
+	}
+
+	classes := []struct {
+		name   string
+		groups []VdevGroup
+	}{{"data", s.Data}, {"log", s.Logs}, {"special", s.Special}, {"dedup", s.Dedup}}
+	for _, class := range classes {
+		for _, g := range class.groups {
+			if err := g.validate(); err != nil {
+				return fmt.Errorf("invalid %s vdev: %w", class.name, err)
+			}
+			if class.name == "log" && g.Type != VdevDisk && g.Type != VdevMirror {
+				return fmt.Errorf("invalid log vdev: %s is not supported for logs", g.Type)
+			}
+			if err := checkDevices(g.Devices); err != nil {
+				return err
+			}
+		}
+	}
+	if err := checkDevices(s.Cache); err != nil {
+		return err
+	}
+	return checkDevices(s.Spares)
+}
+
+func (g *VdevGroup) validate() error {
+	n := len(g.Devices)
+	switch g.Type {
+	case VdevDisk:
+		if n != 1 {
+			return fmt.Errorf("a disk vdev takes exactly 1 device, got %d", n)
+		}
+	case VdevMirror:
+		if n < 2 {
+			return fmt.Errorf("a mirror requires at least 2 devices, got %d", n)
+		}
+	case VdevRaidz1, VdevRaidz2, VdevRaidz3:
+		parity := int(g.Type[len(g.Type)-1] - '0')
+		if n < parity+1 {
+			return fmt.Errorf("%s requires at least %d devices, got %d", g.Type, parity+1, n)
+		}
+	case VdevDraid1, VdevDraid2, VdevDraid3:
+		parity := int(g.Type[len(g.Type)-1] - '0')
+		if g.DraidData < 0 || g.DraidSpares < 0 {
+			return fmt.Errorf("%s data and spare counts must not be negative", g.Type)
+		}
+		data := g.DraidData
+		if data == 0 {
+			data = 1
+		}
+		if n < parity+data+g.DraidSpares {
+			return fmt.Errorf("%s with %d data and %d spares requires at least %d devices, got %d",
+				g.Type, data, g.DraidSpares, parity+data+g.DraidSpares, n)
+		}
+	default:
+		return fmt.Errorf("unknown vdev type %q", g.Type)
+	}
+	return nil
+}
+
+func (g *VdevGroup) args() []string {
+	args := make([]string, 0, len(g.Devices)+1)
+	switch g.Type {
+	case VdevDisk:
+	case VdevDraid1, VdevDraid2, VdevDraid3:
+		t := g.Type
+		if g.DraidData > 0 {
+			t += ":" + strconv.Itoa(g.DraidData) + "d"
+		}
+		t += ":" + strconv.Itoa(len(g.Devices)) + "c"
+		if g.DraidSpares > 0 {
+			t += ":" + strconv.Itoa(g.DraidSpares) + "s"
+		}
+		args = append(args, t)
+	default:
+		args = append(args, g.Type)
+	}
+	return append(args, g.Devices...)
+}
+
+// Args validates the topology and renders it as zpool create/add arguments.
+func (s *VdevSpec) Args() ([]string, error) {
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	return s.args(), nil
+}
+
+func (s *VdevSpec) args() []string {
+	var args []string
+	groups := func(class string, gs []VdevGroup) {
+		if len(gs) == 0 {
+			return
+		}
+		if class != "" {
+			args = append(args, class)
+		}
+		for i := range gs {
+			args = append(args, gs[i].args()...)
+		}
+	}
+	groups("", s.Data)
+	groups("log", s.Logs)
+	groups("special", s.Special)
+	groups("dedup", s.Dedup)
+	if len(s.Cache) > 0 {
+		args = append(append(args, "cache"), s.Cache...)
+	}
+	if len(s.Spares) > 0 {
+		args = append(append(args, "spare"), s.Spares...)
+	}
+	return args
+}
+
+// CreateZpoolWithTopology creates a new ZFS zpool with the specified name, properties and vdev topology.
+// The topology is validated before zpool is run.
+func CreateZpoolWithTopology(name string, properties map[string]string, spec VdevSpec) (*Zpool, error) {
+	return CreateZpoolWithTopologyContext(context.Background(), name, properties, spec)
+}
+
+// CreateZpoolWithTopologyContext is like CreateZpoolWithTopology but includes a context.
+func CreateZpoolWithTopologyContext(ctx context.Context, name string, properties map[string]string, spec VdevSpec) (*Zpool, error) {
+	args, err := spec.Args()
+	if err != nil {
+		return nil, err
+	}
+	if err := requireDraid(ctx, &spec); err != nil {
+		return nil, err
+	}
+	return CreateZpoolContext(ctx, name, properties, args...)
+}
+
+// CreateZpoolDryRun checks that a zpool with the specified name, properties and vdev topology can be created, without
+// creating it (zpool create -n). It returns the topology the pool would have as reported by zpool, e.g. to preview it.
+// The checks are those of creating the pool, e.g. vdevs of different redundancy fail with ErrMismatchedReplication.
+func CreateZpoolDryRun(name string, properties map[string]string, spec VdevSpec) (*VdevSpec, error) {
+	return CreateZpoolDryRunContext(context.Background(), name, properties, spec)
+}
+
+// CreateZpoolDryRunContext is like CreateZpoolDryRun but includes a context.
+func CreateZpoolDryRunContext(ctx context.Context, name string, properties map[string]string, spec VdevSpec) (*VdevSpec, error) {
+	args, err := spec.Args()
+	if err != nil {
+		return nil, err
+	}
+	if err := requireDraid(ctx, &spec); err != nil {
+		return nil, err
+	}
+	cli := []string{"create", "-n"}
+	if properties != nil {
+		cli = append(cli, propsSlice(properties)...)
+	}
+	out, err := zpoolRawOutput(ctx, append(append(cli, name), args...)...)
+	if err != nil {
+		return nil, err
+	}
+	return parseDryRunLayout(string(out))
+}
+
+// example input for parseDryRunLayout
+// would create 'tank' with the following layout:
+//
+//	tank
+//	  mirror
+//	    sda
+//	    sdb
+//	logs
+//	  sdc
+
+func parseDryRunLayout(out string) (*VdevSpec, error) {
+	var config []string
+	for _, line := range strings.Split(out, "\n") {
+		if strings.HasPrefix(line, "\t") {
+			config = append(config, line)
+		}
+	}
+	status := &ZpoolStatus{}
+	if err := status.parseConfig(config); err != nil {
+		return nil, fmt.Errorf("failed to parse layout: %w", err)
+	}
+	if status.Config == nil {
+		return nil, fmt.Errorf("invalid zpool create output %q", out)
+	}
+	status.Name = status.Config.Name
+	return statusTopology(status)
+}
+
+// AddVdevs adds the vdevs of spec to the zpool, any of its classes may be empty.
+// The vdevs are validated before zpool is run.
+// If force is set, vdevs are added even if their replication level does not match the pool's or devices appear to be in use (-f).
+func (z *Zpool) AddVdevs(spec VdevSpec, force bool) error {
+	return z.AddVdevsContext(context.Background(), spec, force)
+}
+
+// AddVdevsContext is like AddVdevs but includes a context.
+func (z *Zpool) AddVdevsContext(ctx context.Context, spec VdevSpec, force bool) error {
+	if err := spec.validate(); err != nil {
+		return err
+	}
+	if err := requireDraid(ctx, &spec); err != nil {
+		return err
+	}
+	vdevs := spec.args()
+	if len(vdevs) == 0 {
+		return errors.New("no vdevs to add")
+	}
+	args := []string{"add"}
+	if force {
+		args = append(args, "-f")
+	}
+	args = append(args, z.Name)
+	return zpool(ctx, append(args, vdevs...)...)
+}
+
+// RemoveVdev removes a device or top-level vdev from the zpool.
+// Removing a top-level data vdev evacuates its data to the remaining vdevs in the background,
+// its progress is reported as ZpoolStatus.Removal.
+func (z *Zpool) RemoveVdev(device string) error {
+	return z.RemoveVdevContext(context.Background(), device)
+}
+
+// RemoveVdevContext is like RemoveVdev but includes a context.
+func (z *Zpool) RemoveVdevContext(ctx context.Context, device string) error {
+	return zpool(ctx, "remove", z.Name, device)
+}
+
+// CancelRemoval stops the evacuation of a top-level vdev in progress on the zpool.
+func (z *Zpool) CancelRemoval() error {
+	return z.CancelRemovalContext(context.Background())
+}
+
+// CancelRemovalContext is like CancelRemoval but includes a context.
+func (z *Zpool) CancelRemovalContext(ctx context.Context) error {
+	return zpool(ctx, "remove", "-s", z.Name)
+}
+
+// Types of the vdevs which zpool status temporarily groups a device and its replacement in, as returned by VdevType.
+const (
+	VdevSpare     = "spare"
+	VdevReplacing = "replacing"
+)
+
+var (
+	vdevGroupRegex        = regexp.MustCompile(`^(mirror|raidz[123]|draid[123](?::\d+[dcs])*|spare|replacing)-\d+$`)
+	draidRegex            = regexp.MustCompile(`^draid([123])((?::\d+[dcs])*)(?:-(\d+))?$`)
+	distributedSpareRegex = regexp.MustCompile(`^draid([123])-(\d+)-(\d+)$`)
+)
+
+// VdevType returns the type of a vdev from its name as reported by zpool status: VdevMirror for mirror-0,
+// VdevRaidz1 to VdevRaidz3 for raidz vdevs, VdevDraid1 to VdevDraid3 for draid vdevs such as draid2:4d:11c:1s-0,
+// VdevSpare or VdevReplacing for the vdevs grouping a device with its replacement, and VdevDisk for leaf vdevs,
+// including the distributed spares of draid vdevs.
+func VdevType(name string) string {
+	m := vdevGroupRegex.FindStringSubmatch(name)
+	if m == nil {
+		return VdevDisk
+	}
+	return strings.SplitN(m[1], ":", 2)[0]
+}
+
+// IsVdevGroup reports whether the vdev of the given name, as reported by zpool status, is a group of other vdevs.
+func IsVdevGroup(name string) bool {
+	return VdevType(name) != VdevDisk
+}
+
+// IsDistributedSpare reports whether the vdev of the given name is a distributed spare of a draid vdev, such as
+// draid1-0-0, the first spare of the first draid vdev of the pool. Distributed spares are listed as spares of the pool.
+func IsDistributedSpare(name string) bool {
+	return distributedSpareRegex.MatchString(name)
+}
+
+// DraidConfig is the layout of a draid vdev.
+type DraidConfig struct {
+	Parity int
+	// Data is the number of data devices per redundancy group.
+	Data int
+	// Children is the number of devices of the vdev, including those reserved for Spares distributed spares.
+	Children int
+	Spares   int
+	// Index is the number of the vdev among the top-level vdevs of the pool, -1 if the name has none.
+	Index int
+}
+
+// ParseDraidName parses the name of a draid vdev, as reported by zpool status, such as draid2:4d:11c:1s-0,
+// or a draid vdev type as passed to zpool create, such as draid2:4d:1s.
+// Parts missing from the vdev type are zero.
+func ParseDraidName(name string) (*DraidConfig, error) {
+	m := draidRegex.FindStringSubmatch(name)
+	if m == nil {
+		return nil, fmt.Errorf("invalid draid vdev %q", name)
+	}
+	c := &DraidConfig{Parity: int(m[1][0] - '0'), Index: -1}
+	for _, part := range strings.Split(m[2], ":")[1:] {
+		n, err := strconv.Atoi(part[:len(part)-1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid draid vdev %q: %w", name, err)
+		}
+		switch part[len(part)-1] {
+		case 'd':
+			c.Data = n
+		case 'c':
+			c.Children = n
+		case 's':
+			c.Spares = n
+		}
+	}
+	if m[3] != "" {
+		c.Index, _ = strconv.Atoi(m[3])
+	}
+	return c, nil
+}
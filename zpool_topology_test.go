@@ -0,0 +1,211 @@
+package zfs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestVdevSpecArgs(t *testing.T) {
+	for name, test := range map[string]struct {
+		spec VdevSpec
+		want []string
+	}{
+		"stripe": {
+			spec: VdevSpec{Data: []VdevGroup{Disk("sda"), Disk("sdb")}},
+			want: []string{"sda", "sdb"},
+		},
+		"mirrors with classes": {
+			spec: VdevSpec{
+				Data:    []VdevGroup{Mirror("sda", "sdb"), Mirror("sdc", "sdd")},
+				Logs:    []VdevGroup{Mirror("nvme0", "nvme1")},
+				Special: []VdevGroup{Mirror("nvme2", "nvme3")},
+				Dedup:   []VdevGroup{Disk("nvme4")},
+				Cache:   []string{"nvme5"},
+				Spares:  []string{"sde", "sdf"},
+			},
+			want: []string{
+				"mirror", "sda", "sdb", "mirror", "sdc", "sdd",
+				"log", "mirror", "nvme0", "nvme1",
+				"special", "mirror", "nvme2", "nvme3",
+				"dedup", "nvme4",
+				"cache", "nvme5",
+				"spare", "sde", "sdf",
+			},
+		},
+		"raidz2": {
+			spec: VdevSpec{Data: []VdevGroup{Raidz(2, "a", "b", "c", "d")}},
+			want: []string{"raidz2", "a", "b", "c", "d"},
+		},
+		"draid": {
+			spec: VdevSpec{Data: []VdevGroup{Draid(1, 2, 1, "a", "b", "c", "d", "e")}},
+			want: []string{"draid1:2d:5c:1s", "a", "b", "c", "d", "e"},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			got, err := test.spec.Args()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(test.want, got) {
+				t.Fatalf("want: %q, got: %q", test.want, got)
+			}
+		})
+	}
+}
+
+func TestVdevSpecValidate(t *testing.T) {
+	for name, spec := range map[string]VdevSpec{
+		"no data":          {Cache: []string{"sda"}},
+		"single mirror":    {Data: []VdevGroup{Mirror("sda")}},
+		"small raidz3":     {Data: []VdevGroup{Raidz(3, "a", "b", "c")}},
+		"unknown type":     {Data: []VdevGroup{{Type: "raidz7", Devices: []string{"a", "b"}}}},
+		"raidz log":        {Data: []VdevGroup{Disk("a")}, Logs: []VdevGroup{Raidz(1, "b", "c")}},
+		"duplicate device": {Data: []VdevGroup{Disk("a")}, Spares: []string{"a"}},
+		"small draid":      {Data: []VdevGroup{Draid(2, 4, 1, "a", "b", "c", "d")}},
+		"multi-disk disk":  {Data: []VdevGroup{{Devices: []string{"a", "b"}}}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if err := spec.Validate(); err == nil {
+				t.Fatal("expected validation error")
+			}
+		})
+	}
+}
+
+func TestAddRemoveVdevs(t *testing.T) {
+	ctx, r := withFakeRunner("")
+	z := &Zpool{Name: "tank"}
+
+	if err := z.AddVdevsContext(ctx, VdevSpec{Data: []VdevGroup{Mirror("sdc", "sdd")}}, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := z.AddVdevsContext(ctx, VdevSpec{Cache: []string{"nvme0"}}, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := z.RemoveVdevContext(ctx, "mirror-1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := z.CancelRemovalContext(ctx); err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"zpool", "add", "tank", "mirror", "sdc", "sdd"},
+		{"zpool", "add", "-f", "tank", "cache", "nvme0"},
+		{"zpool", "remove", "tank", "mirror-1"},
+		{"zpool", "remove", "-s", "tank"},
+	}
+	if !reflect.DeepEqual(want, r.calls) {
+		t.Fatalf("want: %q, got: %q", want, r.calls)
+	}
+
+	if err := z.AddVdevsContext(ctx, VdevSpec{}, false); err == nil {
+		t.Fatal("expected error adding no vdevs")
+	}
+	if err := z.AddVdevsContext(ctx, VdevSpec{Data: []VdevGroup{Mirror("sda")}}, false); err == nil {
+		t.Fatal("expected error adding invalid vdev")
+	}
+	if len(r.calls) != len(want) {
+		t.Fatalf("zpool was run for invalid vdevs: %q", r.calls[len(want):])
+	}
+}
+
+func TestVdevType(t *testing.T) {
+	for name, want := range map[string]string{
+		"sda":                VdevDisk,
+		"/dev/sda1":          VdevDisk,
+		"mirror-0":           VdevMirror,
+		"raidz2-1":           VdevRaidz2,
+		"draid2:4d:11c:1s-0": VdevDraid2,
+		"draid1-0-0":         VdevDisk,
+		"spare-1":            VdevSpare,
+		"replacing-0":        VdevReplacing,
+		"mirror":             VdevDisk,
+	} {
+		if got := VdevType(name); got != want {
+			t.Errorf("VdevType(%q): want: %q, got: %q", name, want, got)
+		}
+		if got := IsVdevGroup(name); got != (want != VdevDisk) {
+			t.Errorf("IsVdevGroup(%q): got: %v", name, got)
+		}
+	}
+	if !IsDistributedSpare("draid1-0-0") || IsDistributedSpare("draid1:2d:5c:1s-0") || IsDistributedSpare("sda") {
+		t.Fatal("unexpected distributed spares")
+	}
+}
+
+func TestParseDraidName(t *testing.T) {
+	for name, want := range map[string]*DraidConfig{
+		"draid2:4d:11c:1s-0": {Parity: 2, Data: 4, Children: 11, Spares: 1, Index: 0},
+		"draid1:2d:5c:0s-3":  {Parity: 1, Data: 2, Children: 5, Index: 3},
+		"draid3:1s":          {Parity: 3, Spares: 1, Index: -1},
+	} {
+		got, err := ParseDraidName(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(want, got) {
+			t.Fatalf("ParseDraidName(%q): want: %+v, got: %+v", name, want, got)
+		}
+	}
+	for _, name := range []string{"draid4:2d-0", "raidz1-0", "draid1-0-0"} {
+		if _, err := ParseDraidName(name); err == nil {
+			t.Fatalf("expected error parsing %q", name)
+		}
+	}
+}
+
+const createDryRunOutput = `would create 'tank' with the following layout:
+
+	tank
+	  mirror
+	    sda
+	    sdb
+	  draid1:4d:6c:1s
+	    sdc
+	    sdd
+	    sde
+	    sdf
+	    sdg
+	    sdh
+	special
+	  mirror
+	    nvme0
+	    nvme1
+	logs
+	  sdi
+	cache
+	  nvme2
+	spares
+	  sdj
+`
+
+func TestCreateZpoolDryRun(t *testing.T) {
+	ctx, r := withFakeRunner(createDryRunOutput)
+	spec := VdevSpec{
+		Data:    []VdevGroup{Mirror("sda", "sdb"), Draid(1, 4, 1, "sdc", "sdd", "sde", "sdf", "sdg", "sdh")},
+		Special: []VdevGroup{Mirror("nvme0", "nvme1")},
+		Logs:    []VdevGroup{Disk("sdi")},
+		Cache:   []string{"nvme2"},
+		Spares:  []string{"sdj"},
+	}
+	got, err := CreateZpoolDryRunContext(ctx, "tank", map[string]string{"ashift": "12"}, spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&spec, got) {
+		t.Fatalf("want: %+v, got: %+v", spec, got)
+	}
+	want := []string{"zpool", "create", "-n", "-o", "ashift=12", "tank", "mirror", "sda", "sdb", "draid1:4d:6c:1s",
+		"sdc", "sdd", "sde", "sdf", "sdg", "sdh", "log", "sdi", "special", "mirror", "nvme0", "nvme1", "cache", "nvme2",
+		"spare", "sdj"}
+	if !reflect.DeepEqual([][]string{want}, r.calls) {
+		t.Fatalf("want: %q, got: %q", want, r.calls)
+	}
+
+	if _, err := CreateZpoolDryRunContext(ctx, "tank", nil, VdevSpec{Data: []VdevGroup{Mirror("sda")}}); err == nil {
+		t.Fatal("expected error for invalid vdev")
+	}
+	if _, err := parseDryRunLayout("invalid vdev specification\n"); err == nil {
+		t.Fatal("expected error for output without layout")
+	}
+}
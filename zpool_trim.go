@@ -0,0 +1,174 @@
+package zfs
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Trim and initialize states of a vdev, as reported by zpool status.
+const (
+	VdevProgressNone        = "none"
+	VdevProgressActive      = "active"
+	VdevProgressSuspended   = "suspended"
+	VdevProgressComplete    = "complete"
+	VdevProgressUnsupported = "unsupported"
+)
+
+// VdevProgress is the progress of trimming or initializing a leaf vdev.
+type VdevProgress struct {
+	// State is one of the VdevProgress constants, or empty if zpool status did not report it.
+	State       string
+	PercentDone float64
+	// Done and Total are the bytes processed and to be processed, which are only reported in JSON output.
+	Done  uint64
+	Total uint64
+	// Time is when the operation was started or, once it is complete, when it completed.
+	Time time.Time
+}
+
+// TrimOptions are the options which can be passed to Trim.
+//
+// A full description of the options may be found in the ZFS manual:
+// https://openzfs.github.io/openzfs-docs/man/8/zpool-trim.8.html.
+type TrimOptions struct {
+	// Devices are the devices to trim, all devices of the pool are trimmed if empty.
+	Devices []string
+	// Rate limits how fast each device is trimmed, in bytes per second (-r). Zero means no limit.
+	Rate uint64
+	// Secure issues secure TRIM commands, which guarantee the data cannot be read back (-d).
+	Secure bool
+	// Cancel cancels the trim in progress, discarding its progress (-c).
+	Cancel bool
+	// Suspend suspends the trim in progress, it is resumed by trimming again (-s).
+	Suspend bool
+}
+
+func (o *TrimOptions) args() ([]string, error) {
+	var args []string
+	switch {
+	case o.Cancel && o.Suspend:
+		return nil, errors.New("a trim cannot be both canceled and suspended")
+	case (o.Cancel || o.Suspend) && (o.Rate != 0 || o.Secure):
+		return nil, errors.New("rate and secure can only be set when starting a trim")
+	case o.Cancel:
+		args = append(args, "-c")
+	case o.Suspend:
+		args = append(args, "-s")
+	}
+	if o.Secure {
+		args = append(args, "-d")
+	}
+	if o.Rate != 0 {
+		args = append(args, "-r", strconv.FormatUint(o.Rate, 10))
+	}
+	return args, nil
+}
+
+// InitializeOptions are the options which can be passed to Initialize.
+//
+// A full description of the options may be found in the ZFS manual:
+// https://openzfs.github.io/openzfs-docs/man/8/zpool-initialize.8.html.
+type InitializeOptions struct {
+	// Devices are the devices to initialize, all devices of the pool are initialized if empty.
+	Devices []string
+	// Cancel cancels the initialization in progress, discarding its progress (-c).
+	Cancel bool
+	// Suspend suspends the initialization in progress, it is resumed by initializing again (-s).
+	Suspend bool
+}
+
+func (o *InitializeOptions) args() ([]string, error) {
+	switch {
+	case o.Cancel && o.Suspend:
+		return nil, errors.New("an initialization cannot be both canceled and suspended")
+	case o.Cancel:
+		return []string{"-c"}, nil
+	case o.Suspend:
+		return []string{"-s"}, nil
+	}
+	return nil, nil
+}
+
+// Trim starts, resumes, suspends or cancels trimming the unallocated space of devices of the zpool, as configured by opts.
+// The progress of each device is reported as Vdev.Trim in ZpoolStatus.
+func (z *Zpool) Trim(opts TrimOptions) error {
+	return z.TrimContext(context.Background(), opts)
+}
+
+// TrimContext is like Trim but includes a context.
+func (z *Zpool) TrimContext(ctx context.Context, opts TrimOptions) error {
+	args, err := opts.args()
+	if err != nil {
+		return err
+	}
+	args = append(append([]string{"trim"}, args...), z.Name)
+	return zpool(ctx, append(args, opts.Devices...)...)
+}
+
+// Initialize starts, resumes, suspends or cancels writing to all unallocated space of devices of the zpool,
+// as configured by opts. The progress of each device is reported as Vdev.Initialize in ZpoolStatus.
+func (z *Zpool) Initialize(opts InitializeOptions) error {
+	return z.InitializeContext(context.Background(), opts)
+}
+
+// InitializeContext is like Initialize but includes a context.
+func (z *Zpool) InitializeContext(ctx context.Context, opts InitializeOptions) error {
+	args, err := opts.args()
+	if err != nil {
+		return err
+	}
+	args = append(append([]string{"initialize"}, args...), z.Name)
+	return zpool(ctx, append(args, opts.Devices...)...)
+}
+
+var (
+	vdevProgressRegex = regexp.MustCompile(`\((\d+)% (trimmed|initialized)(?:, (suspended, )?(started|completed) at ([^)]+))?\)`)
+	vdevNoneRegex     = regexp.MustCompile(`\((untrimmed|uninitialized|trim unsupported)\)`)
+)
+
+// example messages for parseProgress
+// (15% trimmed, started at Mon Jul 26 10:00:00 2021)
+// (40% initialized, suspended, started at Mon Jul 26 10:00:00 2021)
+// (100% trimmed, completed at Mon Jul 26 11:00:00 2021)
+// (untrimmed)
+
+// parseProgress sets the trim and initialize progress of the vdev from its message.
+func (v *Vdev) parseProgress() error {
+	for _, m := range vdevNoneRegex.FindAllStringSubmatch(v.Message, -1) {
+		switch m[1] {
+		case "untrimmed":
+			v.Trim.State = VdevProgressNone
+		case "uninitialized":
+			v.Initialize.State = VdevProgressNone
+		case "trim unsupported":
+			v.Trim.State = VdevProgressUnsupported
+		}
+	}
+	for _, m := range vdevProgressRegex.FindAllStringSubmatch(v.Message, -1) {
+		p := &v.Trim
+		if m[2] == "initialized" {
+			p = &v.Initialize
+		}
+		var err error
+		if p.PercentDone, err = strconv.ParseFloat(m[1], 64); err != nil {
+			return err
+		}
+		switch {
+		case m[3] != "":
+			p.State = VdevProgressSuspended
+		case m[4] == "completed":
+			p.State = VdevProgressComplete
+		default:
+			p.State = VdevProgressActive
+		}
+		if m[5] != "" {
+			if p.Time, err = parseStatusTime(m[5]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package zfs
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTrimInitialize(t *testing.T) {
+	ctx, r := withFakeRunner("")
+	z := &Zpool{Name: "tank"}
+
+	if err := z.TrimContext(ctx, TrimOptions{Rate: 1 << 20, Secure: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := z.TrimContext(ctx, TrimOptions{Devices: []string{"sda", "sdb"}, Suspend: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := z.InitializeContext(ctx, InitializeOptions{Devices: []string{"sda"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := z.InitializeContext(ctx, InitializeOptions{Cancel: true}); err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"zpool", "trim", "-d", "-r", "1048576", "tank"},
+		{"zpool", "trim", "-s", "tank", "sda", "sdb"},
+		{"zpool", "initialize", "tank", "sda"},
+		{"zpool", "initialize", "-c", "tank"},
+	}
+	if !reflect.DeepEqual(want, r.calls) {
+		t.Fatalf("want: %q, got: %q", want, r.calls)
+	}
+
+	for _, opts := range []TrimOptions{{Cancel: true, Suspend: true}, {Cancel: true, Rate: 1}} {
+		if err := z.TrimContext(ctx, opts); err == nil {
+			t.Fatalf("expected error for %+v", opts)
+		}
+	}
+	if err := z.InitializeContext(ctx, InitializeOptions{Cancel: true, Suspend: true}); err == nil {
+		t.Fatal("expected error canceling and suspending")
+	}
+}
+
+const statusTrim = `  pool: tank
+ state: ONLINE
+  scan: none requested
+config:
+
+	NAME        STATE     READ WRITE CKSUM
+	tank        ONLINE       0     0     0
+	  mirror-0  ONLINE       0     0     0
+	    sda     ONLINE       0     0     0  (15% trimmed, started at Mon Jul 26 10:00:00 2021)
+	    sdb     ONLINE       0     0     0  (40% initialized, suspended, started at Mon Jul 26 10:00:00 2021)
+	    sdc     ONLINE       0     0     0  (100% trimmed, completed at Mon Jul 26 11:00:00 2021)
+	    sdd     ONLINE       0     0     0  (trim unsupported)
+
+errors: No known data errors
+`
+
+func TestParseVdevProgress(t *testing.T) {
+	statuses, err := parseZpoolStatus(statusTrim)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vdevs := statuses[0].Config.Children[0].Children
+	start := time.Date(2021, time.July, 26, 10, 0, 0, 0, time.Local)
+
+	for i, want := range []struct {
+		trim, initialize VdevProgress
+	}{
+		{trim: VdevProgress{State: VdevProgressActive, PercentDone: 15, Time: start}},
+		{initialize: VdevProgress{State: VdevProgressSuspended, PercentDone: 40, Time: start}},
+		{trim: VdevProgress{State: VdevProgressComplete, PercentDone: 100, Time: start.Add(time.Hour)}},
+		{trim: VdevProgress{State: VdevProgressUnsupported}},
+	} {
+		if !reflect.DeepEqual(want.trim, vdevs[i].Trim) || !reflect.DeepEqual(want.initialize, vdevs[i].Initialize) {
+			t.Errorf("unexpected progress of %s: trim %+v, initialize %+v", vdevs[i].Name, vdevs[i].Trim, vdevs[i].Initialize)
+		}
+	}
+}
+
+func TestParseVdevProgressJSON(t *testing.T) {
+	vdevs, err := parseJSONVdevs([]byte(`{"sda": {"name": "sda", "state": "ONLINE",
+  "trim_state": "ACTIVE", "trimmed": "256", "to_trim": "1024", "trim_time": "1627207200", "trim_notsup": "0",
+  "init_state": "UNINITIALIZED"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := vdevs[0].vdev
+	want := VdevProgress{State: VdevProgressActive, PercentDone: 25, Done: 256, Total: 1024, Time: time.Unix(1627207200, 0)}
+	if !reflect.DeepEqual(want, v.Trim) {
+		t.Fatalf("want trim: %+v, got: %+v", want, v.Trim)
+	}
+	if v.Initialize.State != VdevProgressNone {
+		t.Fatalf("unexpected initialize state %q", v.Initialize.State)
+	}
+}
@@ -0,0 +1,195 @@
+package zfs
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Upgrade enables all features supported by the installed version of ZFS on the zpool, limited by its compatibility
+// property, or upgrades a pool of a legacy version to feature flags. Older versions of ZFS may no longer be able
+// to import the pool afterwards.
+//
+// A full description of zpool upgrade may be found in the ZFS manual:
+// https://openzfs.github.io/openzfs-docs/man/8/zpool-upgrade.8.html.
+func (z *Zpool) Upgrade() error {
+	return z.UpgradeContext(context.Background())
+}
+
+// UpgradeContext is like Upgrade but includes a context.
+func (z *Zpool) UpgradeContext(ctx context.Context) error {
+	return zpool(ctx, "upgrade", z.Name)
+}
+
+// UpgradeAll upgrades all imported zpools like Zpool.Upgrade.
+func UpgradeAll() error {
+	return UpgradeAllContext(context.Background())
+}
+
+// UpgradeAllContext is like UpgradeAll but includes a context.
+func UpgradeAllContext(ctx context.Context) error {
+	return zpool(ctx, "upgrade", "-a")
+}
+
+// PendingUpgrade is a zpool which an upgrade would change, as returned by PendingUpgrades.
+type PendingUpgrade struct {
+	Pool string
+	// Features are the supported features which are not enabled on the pool, and which an upgrade would enable.
+	Features []string
+	// LegacyVersion is the version of a pool which does not use feature flags yet, zero otherwise.
+	LegacyVersion uint64
+}
+
+// PendingUpgrades returns the imported zpools which do not have all supported features enabled, or which use
+// a legacy version, along with the features an upgrade would enable, as listed by zpool upgrade.
+// Pools which are up to date, or whose compatibility property allows no further features, are not returned.
+func PendingUpgrades() ([]*PendingUpgrade, error) {
+	return PendingUpgradesContext(context.Background())
+}
+
+// PendingUpgradesContext is like PendingUpgrades but includes a context.
+func PendingUpgradesContext(ctx context.Context) ([]*PendingUpgrade, error) {
+	out, err := zpoolRawOutput(ctx, "upgrade")
+	if err != nil {
+		return nil, err
+	}
+	return parsePendingUpgrades(out)
+}
+
+// example input for parsePendingUpgrades
+// This system supports ZFS pool feature flags.
+//
+// The following pools are formatted with legacy version numbers and can
+// be upgraded to use feature flags.  After being upgraded, these pools
+// will no longer be accessible by software that does not support feature
+// flags.
+//
+// VER  POOL
+// ---  ------------
+// 28   old
+//
+// Some supported features are not enabled on the following pools. Once a
+// feature is enabled the pool may become incompatible with software
+// that does not support the feature. See zpool-features(7) for details.
+//
+// POOL  FEATURE
+// ---------------
+// tank
+//       redaction_bookmarks
+//       bookmark_written
+
+func parsePendingUpgrades(out []byte) ([]*PendingUpgrade, error) {
+	var pending []*PendingUpgrade
+	var table string
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		line := sc.Text()
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 0:
+			table = ""
+			continue
+		case len(fields) == 2 && (fields[0] == "VER" || fields[0] == "POOL") && (fields[1] == "POOL" || fields[1] == "FEATURE"):
+			table = fields[0]
+			continue
+		case table == "" || strings.Trim(line, "- ") == "":
+			continue
+		}
+
+		switch {
+		case table == "VER":
+			if len(fields) != 2 {
+				return nil, fmt.Errorf("invalid legacy pool %q", line)
+			}
+			version, err := strconv.ParseUint(fields[0], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid version of legacy pool %s: %w", fields[1], err)
+			}
+			pending = append(pending, &PendingUpgrade{Pool: fields[1], LegacyVersion: version})
+		case line[0] != ' ' && line[0] != '\t':
+			// pools are followed by their features, which are indented
+			pending = append(pending, &PendingUpgrade{Pool: fields[0]})
+		case len(pending) == 0:
+			return nil, fmt.Errorf("unexpected feature %q before pool name", line)
+		default:
+			p := pending[len(pending)-1]
+			p.Features = append(p.Features, fields[0])
+		}
+	}
+	return pending, sc.Err()
+}
+
+// SupportedFeature is a feature flag supported by the installed version of ZFS, as returned by SupportedFeatures.
+type SupportedFeature struct {
+	Name        string
+	Description string
+	// ReadOnlyCompatible features still allow pools to be imported read-only by software that does not support them.
+	ReadOnlyCompatible bool
+}
+
+// SupportedFeatures returns the feature flags supported by the installed version of ZFS, as listed by
+// zpool upgrade -v, in the order listed.
+func SupportedFeatures() ([]*SupportedFeature, error) {
+	return SupportedFeaturesContext(context.Background())
+}
+
+// SupportedFeaturesContext is like SupportedFeatures but includes a context.
+func SupportedFeaturesContext(ctx context.Context) ([]*SupportedFeature, error) {
+	out, err := zpoolRawOutput(ctx, "upgrade", "-v")
+	if err != nil {
+		return nil, err
+	}
+	return parseSupportedFeatures(out), nil
+}
+
+// example input for parseSupportedFeatures
+// This system supports ZFS pool feature flags.
+//
+// The following features are supported:
+//
+// FEAT DESCRIPTION
+// -------------------------------------------------------------
+// async_destroy                         (read-only compatible)
+//      Destroy filesystems asynchronously.
+// lz4_compress
+//      LZ4 compression algorithm support.
+//
+// The following legacy versions are also supported:
+//
+// VER  DESCRIPTION
+// ---  --------------------------------------------------------
+//  1   Initial ZFS version
+
+func parseSupportedFeatures(out []byte) []*SupportedFeature {
+	var features []*SupportedFeature
+	table := false
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		line := sc.Text()
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 2 && fields[1] == "DESCRIPTION":
+			// the legacy versions follow the features
+			table = fields[0] == "FEAT"
+			continue
+		case len(fields) == 0:
+			table = false
+			continue
+		case !table || strings.Trim(line, "- ") == "":
+			continue
+		}
+		if line[0] != ' ' && line[0] != '\t' {
+			features = append(features, &SupportedFeature{
+				Name:               fields[0],
+				ReadOnlyCompatible: strings.Contains(line, "(read-only compatible)"),
+			})
+		} else if len(features) > 0 {
+			f := features[len(features)-1]
+			f.Description = strings.TrimSpace(f.Description + " " + strings.TrimSpace(line))
+		}
+	}
+	return features
+}
@@ -0,0 +1,107 @@
+package zfs
+
+import (
+	"reflect"
+	"testing"
+)
+
+const upgradeOutput = `This system supports ZFS pool feature flags.
+
+The following pools are formatted with legacy version numbers and can
+be upgraded to use feature flags.  After being upgraded, these pools
+will no longer be accessible by software that does not support feature
+flags.
+
+VER  POOL
+---  ------------
+28   old
+
+Some supported features are not enabled on the following pools. Once a
+feature is enabled the pool may become incompatible with software
+that does not support the feature. See zpool-features(7) for details.
+
+Note that the pool 'compatibility' feature can be used to inhibit
+feature upgrades.
+
+POOL  FEATURE
+---------------
+tank
+      redaction_bookmarks
+      bookmark_written
+other
+      draid
+`
+
+const upgradeVerboseOutput = `This system supports ZFS pool feature flags.
+
+The following features are supported:
+
+FEAT DESCRIPTION
+-------------------------------------------------------------
+async_destroy                         (read-only compatible)
+     Destroy filesystems asynchronously.
+lz4_compress
+     LZ4 compression algorithm support.
+
+The following legacy versions are also supported:
+
+VER  DESCRIPTION
+---  --------------------------------------------------------
+ 1   Initial ZFS version
+ 2   Ditto blocks (replicated metadata)
+`
+
+func TestPendingUpgrades(t *testing.T) {
+	ctx, r := withFakeRunner(upgradeOutput)
+	pending, err := PendingUpgradesContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*PendingUpgrade{
+		{Pool: "old", LegacyVersion: 28},
+		{Pool: "tank", Features: []string{"redaction_bookmarks", "bookmark_written"}},
+		{Pool: "other", Features: []string{"draid"}},
+	}
+	if !reflect.DeepEqual(want, pending) {
+		t.Fatalf("want: %+v, got: %+v", want, pending)
+	}
+
+	pending, err = parsePendingUpgrades([]byte("This system supports ZFS pool feature flags.\n\n" +
+		"All pools are formatted using feature flags.\n\n" +
+		"Every feature flags pool has all supported and requested features enabled.\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 0 {
+		t.Fatalf("expected no pending upgrades, got: %+v", pending)
+	}
+
+	if err := (&Zpool{Name: "tank"}).UpgradeContext(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := UpgradeAllContext(ctx); err != nil {
+		t.Fatal(err)
+	}
+	calls := [][]string{{"zpool", "upgrade", "tank"}, {"zpool", "upgrade", "-a"}}
+	if got := r.calls[len(r.calls)-2:]; !reflect.DeepEqual(calls, got) {
+		t.Fatalf("want: %q, got: %q", calls, got)
+	}
+}
+
+func TestSupportedFeatures(t *testing.T) {
+	ctx, r := withFakeRunner(upgradeVerboseOutput)
+	features, err := SupportedFeaturesContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*SupportedFeature{
+		{Name: "async_destroy", Description: "Destroy filesystems asynchronously.", ReadOnlyCompatible: true},
+		{Name: "lz4_compress", Description: "LZ4 compression algorithm support."},
+	}
+	if !reflect.DeepEqual(want, features) {
+		t.Fatalf("want: %+v, got: %+v", want, features)
+	}
+	if call := []string{"zpool", "upgrade", "-v"}; !reflect.DeepEqual(call, r.calls[len(r.calls)-1]) {
+		t.Fatalf("want: %q, got: %q", call, r.calls[len(r.calls)-1])
+	}
+}
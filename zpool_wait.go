@@ -0,0 +1,98 @@
+package zfs
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Activities of a zpool which Zpool.Wait can wait for.
+const (
+	// WaitDiscard is the discarding of the checkpoint of the pool.
+	WaitDiscard = "discard"
+	// WaitFree is the freeing of the space of destroyed datasets.
+	WaitFree = "free"
+	// WaitInitialize is the initialization of devices.
+	WaitInitialize = "initialize"
+	// WaitReplace is the replacement of devices.
+	WaitReplace = "replace"
+	// WaitRemove is the removal of devices.
+	WaitRemove = "remove"
+	// WaitResilver is a resilver, including one that is about to start.
+	WaitResilver = "resilver"
+	// WaitScrub is a scrub, paused scrubs are waited for until they are resumed and finished.
+	WaitScrub = "scrub"
+	// WaitTrim is the trimming of devices.
+	WaitTrim = "trim"
+)
+
+var waitActivities = map[string]bool{
+	WaitDiscard: true, WaitFree: true, WaitInitialize: true, WaitReplace: true,
+	WaitRemove: true, WaitResilver: true, WaitScrub: true, WaitTrim: true,
+}
+
+// Sync forces the pending changes of the zpool to be written to disk, ending the current transaction group.
+func (z *Zpool) Sync() error {
+	return z.SyncContext(context.Background())
+}
+
+// SyncContext is like Sync but includes a context.
+func (z *Zpool) SyncContext(ctx context.Context) error {
+	return zpool(ctx, "sync", z.Name)
+}
+
+// Wait blocks until the given activities of the zpool, any of the Wait constants, are finished, or until all
+// activities are finished if none are given. A timeout of zero waits indefinitely, otherwise Wait returns an error
+// matching context.DeadlineExceeded once timeout has elapsed. The command timeout does not apply, see
+// SetCommandTimeout.
+//
+// A full description of zpool wait may be found in the ZFS manual:
+// https://openzfs.github.io/openzfs-docs/man/8/zpool-wait.8.html.
+func (z *Zpool) Wait(timeout time.Duration, activities ...string) error {
+	return z.WaitContext(context.Background(), timeout, activities...)
+}
+
+// WaitContext is like Wait but includes a context.
+func (z *Zpool) WaitContext(ctx context.Context, timeout time.Duration, activities ...string) error {
+	for _, a := range activities {
+		if !waitActivities[a] {
+			return fmt.Errorf("invalid wait activity %q", a)
+		}
+	}
+	args := []string{"wait"}
+	if len(activities) > 0 {
+		args = append(args, "-t", strings.Join(activities, ","))
+	}
+	return waitTimeout(ctx, timeout, func(ctx context.Context) error {
+		c := command{Command: "zpool", blocking: true}
+		_, err := c.Run(ctx, append(args, z.Name)...)
+		return err
+	})
+}
+
+// WaitDeleteQueue blocks until the files of the filesystem which were deleted while still open are freed,
+// which happens in the background once they are closed. A timeout of zero waits indefinitely, otherwise an error
+// matching context.DeadlineExceeded is returned once timeout has elapsed.
+func (d *Dataset) WaitDeleteQueue(timeout time.Duration) error {
+	return d.WaitDeleteQueueContext(context.Background(), timeout)
+}
+
+// WaitDeleteQueueContext is like WaitDeleteQueue but includes a context.
+func (d *Dataset) WaitDeleteQueueContext(ctx context.Context, timeout time.Duration) error {
+	return waitTimeout(ctx, timeout, func(ctx context.Context) error {
+		c := command{Command: "zfs", blocking: true}
+		_, err := c.Run(ctx, "wait", "-t", "deleteq", d.Name)
+		return err
+	})
+}
+
+// waitTimeout runs wait with a context which is done once timeout has elapsed, unless it is zero.
+func waitTimeout(ctx context.Context, timeout time.Duration, wait func(context.Context) error) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return wait(ctx)
+}
@@ -0,0 +1,80 @@
+package zfs
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// blockingRunner blocks every command until its context is done.
+type blockingRunner struct{}
+
+func (blockingRunner) Run(ctx context.Context, name string, args ...string) ([]byte, []byte, error) {
+	<-ctx.Done()
+	return nil, nil, ctx.Err()
+}
+
+func TestSyncWait(t *testing.T) {
+	ctx, r := withFakeRunner("")
+	z := &Zpool{Name: "tank"}
+
+	if err := z.SyncContext(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := z.WaitContext(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := z.WaitContext(ctx, time.Minute, WaitScrub, WaitResilver); err != nil {
+		t.Fatal(err)
+	}
+	if err := (&Dataset{Name: "tank/fs"}).WaitDeleteQueueContext(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"zpool", "sync", "tank"},
+		{"zpool", "wait", "tank"},
+		{"zpool", "wait", "-t", "scrub,resilver", "tank"},
+		{"zfs", "wait", "-t", "deleteq", "tank/fs"},
+	}
+	if !reflect.DeepEqual(want, r.calls) {
+		t.Fatalf("want: %q, got: %q", want, r.calls)
+	}
+
+	if err := z.WaitContext(ctx, 0, "export"); err == nil {
+		t.Fatal("expected error for invalid activity")
+	}
+}
+
+// slowRunner runs every command for the given duration, unless its context is done first.
+type slowRunner time.Duration
+
+func (r slowRunner) Run(ctx context.Context, name string, args ...string) ([]byte, []byte, error) {
+	select {
+	case <-ctx.Done():
+		return nil, nil, ctx.Err()
+	case <-time.After(time.Duration(r)):
+		return nil, nil, nil
+	}
+}
+
+func TestWaitTimeout(t *testing.T) {
+	ctx := WithRunner(context.Background(), blockingRunner{})
+	err := (&Zpool{Name: "tank"}).WaitContext(ctx, 10*time.Millisecond, WaitTrim)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+
+	// waiting indefinitely outlasts the command timeout
+	ctx = WithCommandTimeout(WithRunner(context.Background(), slowRunner(50*time.Millisecond)), 10*time.Millisecond)
+	if err := (&Zpool{Name: "tank"}).WaitContext(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := (&Dataset{Name: "tank/fs"}).WaitDeleteQueueContext(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := zpool(ctx, "status", "tank"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+}
@@ -0,0 +1,284 @@
+package zfs
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StreamDump is the summary of a send stream as printed by zstream dump.
+//
+// A full description of zstream may be found in the ZFS manual:
+// https://openzfs.github.io/openzfs-docs/man/8/zstream.8.html.
+type StreamDump struct {
+	// Begins holds the BEGIN record of each snapshot in the stream, of which replication streams have several.
+	Begins []StreamBegin
+	// Records maps record types, such as "DRR_WRITE", to their number and size.
+	Records map[string]StreamRecords
+	// TotalRecords is the number of records of all types.
+	TotalRecords uint64
+	// PayloadSize, HeaderOverhead and Length are the sizes in bytes of the payload of the records, of their headers
+	// and of the whole stream.
+	PayloadSize    uint64
+	HeaderOverhead uint64
+	Length         uint64
+}
+
+// StreamBegin is the BEGIN record of a snapshot in a send stream.
+type StreamBegin struct {
+	// ToName is the name of the sent snapshot.
+	ToName string
+	// ToGUID is the guid of the sent snapshot, FromGUID that of the incremental source, zero for full streams.
+	ToGUID   uint64
+	FromGUID uint64
+	// Created is the creation time of the sent snapshot.
+	Created time.Time
+	// Type is the type of the sent dataset, 2 for filesystems and 3 for volumes.
+	Type uint64
+	// Flags and Features are the stream flags and feature flags of the record.
+	Flags    uint64
+	Features uint64
+}
+
+// StreamRecords are the number of records of a type in a send stream, and the size of their payload in bytes.
+type StreamRecords struct {
+	Count uint64
+	Bytes uint64
+}
+
+// DumpStream reads a send stream, e.g. one written by SendTo to a file, and returns its summary from zstream dump,
+// without receiving it.
+func DumpStream(r io.Reader) (*StreamDump, error) {
+	return DumpStreamContext(context.Background(), r)
+}
+
+// DumpStreamContext is like DumpStream but includes a context.
+func DumpStreamContext(ctx context.Context, r io.Reader) (*StreamDump, error) {
+	var out bytes.Buffer
+	c := command{Command: "zstream", Stdin: r, Stdout: &out, stream: true}
+	if _, err := c.Run(ctx, "dump"); err != nil {
+		return nil, err
+	}
+	return parseStreamDump(out.Bytes())
+}
+
+// example input for parseStreamDump
+// BEGIN record
+// 	hdrtype = 1
+// 	features = 4
+// 	magic = 2f5bacbac
+// 	creation_time = 61cf9980
+// 	type = 2
+// 	flags = 0x4
+// 	toguid = 7ea1e8b0c4d1a5b3
+// 	fromguid = 0
+// 	toname = tank/fs@a
+// 	payloadlen = 0
+// END checksum = 1d6a4e3f6b/7b3c1e2a4f10/1a1e6c1f0e2b8/3b9d0e4d3c2a1f
+// SUMMARY:
+// 	Total DRR_BEGIN records = 1 (0 bytes)
+// 	Total DRR_END records = 1 (0 bytes)
+// 	Total DRR_OBJECT records = 7 (960 bytes)
+// 	Total DRR_WRITE records = 2 (1024 bytes)
+// 	Total DRR_FREE records = 9 (0 bytes)
+// 	Total records = 20
+// 	Total payload size = 1984 (0x7c0)
+// 	Total header overhead = 6240 (0x1860)
+// 	Total stream length = 8224 (0x2020)
+
+var streamRecordsLine = regexp.MustCompile(`^Total (DRR_\w+) records = (\d+)(?: \((\d+) bytes\))?$`)
+
+func parseStreamDump(out []byte) (*StreamDump, error) {
+	d := &StreamDump{Records: map[string]StreamRecords{}}
+	var begin *StreamBegin
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		switch {
+		case line == "BEGIN record":
+			d.Begins = append(d.Begins, StreamBegin{})
+			begin = &d.Begins[len(d.Begins)-1]
+			continue
+		case strings.HasPrefix(line, "END ") || line == "SUMMARY:":
+			begin = nil
+			continue
+		}
+
+		if m := streamRecordsLine.FindStringSubmatch(line); m != nil {
+			var rec StreamRecords
+			if err := setUint(&rec.Count, m[2]); err != nil {
+				return nil, fmt.Errorf("invalid stream summary %q: %w", line, err)
+			}
+			if m[3] != "" {
+				if err := setUint(&rec.Bytes, m[3]); err != nil {
+					return nil, fmt.Errorf("invalid stream summary %q: %w", line, err)
+				}
+			}
+			d.Records[m[1]] = rec
+			continue
+		}
+		parts := strings.SplitN(line, " = ", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		key, value := parts[0], parts[1]
+		if begin == nil {
+			var field *uint64
+			switch key {
+			case "Total records":
+				field = &d.TotalRecords
+			case "Total payload size":
+				field = &d.PayloadSize
+			case "Total header overhead":
+				field = &d.HeaderOverhead
+			case "Total stream length":
+				field = &d.Length
+			default:
+				continue
+			}
+			// sizes are followed by their hexadecimal value
+			if err := setUint(field, strings.Fields(value)[0]); err != nil {
+				return nil, fmt.Errorf("invalid stream summary %q: %w", line, err)
+			}
+			continue
+		}
+
+		var err error
+		switch key {
+		case "toname":
+			begin.ToName = value
+		case "toguid":
+			begin.ToGUID, err = strconv.ParseUint(value, 16, 64)
+		case "fromguid":
+			begin.FromGUID, err = strconv.ParseUint(value, 16, 64)
+		case "creation_time":
+			var created int64
+			created, err = strconv.ParseInt(value, 16, 64)
+			begin.Created = time.Unix(created, 0)
+		case "type":
+			begin.Type, err = strconv.ParseUint(value, 10, 64)
+		case "flags":
+			begin.Flags, err = strconv.ParseUint(value, 0, 64)
+		case "features":
+			begin.Features, err = strconv.ParseUint(value, 16, 64)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid BEGIN record %q: %w", line, err)
+		}
+	}
+	if len(d.Begins) == 0 {
+		return nil, errors.New("no BEGIN record in stream dump")
+	}
+	return d, nil
+}
+
+// ResumeTokenInfo holds the fields of a resume token, as decoded by zstream token.
+type ResumeTokenInfo struct {
+	// ToName and ToGUID identify the snapshot whose send was interrupted,
+	// FromGUID its incremental source, zero for full streams.
+	ToName   string
+	ToGUID   uint64
+	FromGUID uint64
+	// Object and Offset are the position in the stream at which the send resumes.
+	Object uint64
+	Offset uint64
+	// Bytes is the number of bytes of the stream which were received.
+	Bytes uint64
+	// Flags lists the stream features the resumed send must use, such as "largeblockok", "compressok" or "rawok".
+	Flags []string
+	// Fields holds all fields of the token, as printed.
+	Fields map[string]string
+}
+
+// DecodeResumeToken decodes a resume token, as returned by ResumeToken, with zstream token,
+// e.g. to find out which snapshot an interrupted receive into a dataset was receiving.
+func DecodeResumeToken(token string) (*ResumeTokenInfo, error) {
+	return DecodeResumeTokenContext(context.Background(), token)
+}
+
+// DecodeResumeTokenContext is like DecodeResumeToken but includes a context.
+func DecodeResumeTokenContext(ctx context.Context, token string) (*ResumeTokenInfo, error) {
+	if token == "" {
+		return nil, errors.New("empty resume token")
+	}
+	var out bytes.Buffer
+	c := command{Command: "zstream", Stdout: &out}
+	if _, err := c.Run(ctx, "token", token); err != nil {
+		return nil, err
+	}
+	return parseResumeToken(out.Bytes())
+}
+
+// example input for parseResumeToken
+// nvlist version: 0
+// 	object = 0x2
+// 	offset = 0x40000
+// 	bytes = 0x40e48
+// 	toguid = 0x7ea1e8b0c4d1a5b3
+// 	toname = tank/fs@a
+// 	largeblockok = 1
+// 	compressok = 1
+
+func parseResumeToken(out []byte) (*ResumeTokenInfo, error) {
+	t := &ResumeTokenInfo{Fields: map[string]string{}}
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		parts := strings.SplitN(strings.TrimSpace(sc.Text()), " = ", 2)
+		if len(parts) != 2 || strings.HasPrefix(parts[0], "nvlist version") {
+			continue
+		}
+		key, value := parts[0], parts[1]
+		t.Fields[key] = value
+
+		var field *uint64
+		switch key {
+		case "toname":
+			t.ToName = value
+		case "toguid":
+			field = &t.ToGUID
+		case "fromguid":
+			field = &t.FromGUID
+		case "object":
+			field = &t.Object
+		case "offset":
+			field = &t.Offset
+		case "bytes":
+			field = &t.Bytes
+		default:
+			if strings.HasSuffix(key, "ok") {
+				t.Flags = append(t.Flags, key)
+			}
+		}
+		if field != nil {
+			v, err := strconv.ParseUint(value, 0, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid resume token field %s: %w", key, err)
+			}
+			*field = v
+		}
+	}
+	if t.ToName == "" {
+		return nil, errors.New("resume token without snapshot name")
+	}
+	return t, nil
+}
+
+// RedupStream converts the deduplicated send stream in file, on the host zstream runs on, into a regular stream
+// written to w, which can be received by versions of ZFS which no longer support deduplicated streams.
+func RedupStream(file string, w io.Writer) error {
+	return RedupStreamContext(context.Background(), file, w)
+}
+
+// RedupStreamContext is like RedupStream but includes a context.
+func RedupStreamContext(ctx context.Context, file string, w io.Writer) error {
+	c := command{Command: "zstream", Stdout: w, stream: true}
+	_, err := c.Run(ctx, "redup", file)
+	return err
+}
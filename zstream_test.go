@@ -0,0 +1,118 @@
+package zfs
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const streamDumpOutput = `BEGIN record
+	hdrtype = 1
+	features = 4
+	magic = 2f5bacbac
+	creation_time = 61cf9980
+	type = 2
+	flags = 0x4
+	toguid = 7ea1e8b0c4d1a5b3
+	fromguid = 0
+	toname = tank/fs@a
+	payloadlen = 0
+END checksum = 1d6a4e3f6b/7b3c1e2a4f10/1a1e6c1f0e2b8/3b9d0e4d3c2a1f
+SUMMARY:
+	Total DRR_BEGIN records = 1 (0 bytes)
+	Total DRR_END records = 1 (0 bytes)
+	Total DRR_OBJECT records = 7 (960 bytes)
+	Total DRR_WRITE records = 2 (1024 bytes)
+	Total DRR_FREE records = 9 (0 bytes)
+	Total records = 20
+	Total payload size = 1984 (0x7c0)
+	Total header overhead = 6240 (0x1860)
+	Total stream length = 8224 (0x2020)
+`
+
+func TestDumpStream(t *testing.T) {
+	r := &fakeStreamRunner{fakeRunner: fakeRunner{output: func([]string) (string, error) {
+		return streamDumpOutput, nil
+	}}}
+	d, err := DumpStreamContext(WithRunner(context.Background(), r), strings.NewReader("stream"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &StreamDump{
+		Begins: []StreamBegin{{
+			ToName:   "tank/fs@a",
+			ToGUID:   0x7ea1e8b0c4d1a5b3,
+			Created:  time.Unix(0x61cf9980, 0),
+			Type:     2,
+			Flags:    4,
+			Features: 4,
+		}},
+		Records: map[string]StreamRecords{
+			"DRR_BEGIN":  {Count: 1},
+			"DRR_END":    {Count: 1},
+			"DRR_OBJECT": {Count: 7, Bytes: 960},
+			"DRR_WRITE":  {Count: 2, Bytes: 1024},
+			"DRR_FREE":   {Count: 9},
+		},
+		TotalRecords:   20,
+		PayloadSize:    1984,
+		HeaderOverhead: 6240,
+		Length:         8224,
+	}
+	if !reflect.DeepEqual(want, d) {
+		t.Fatalf("want: %+v, got: %+v", want, d)
+	}
+	if want := []string{"zstream", "dump"}; !reflect.DeepEqual(want, r.calls[0]) || string(r.stdin) != "stream" {
+		t.Fatalf("want call: %q with the stream on stdin, got: %q with %q", want, r.calls, r.stdin)
+	}
+
+	if _, err := parseStreamDump([]byte("SUMMARY:\n\tTotal records = 0\n")); err == nil {
+		t.Fatal("expected error for dump without BEGIN record")
+	}
+}
+
+func TestDecodeResumeToken(t *testing.T) {
+	ctx, r := withFakeRunner("nvlist version: 0\n\tobject = 0x2\n\toffset = 0x40000\n\tbytes = 0x40e48\n\ttoguid = 0x7ea1e8b0c4d1a5b3\n\ttoname = tank/fs@a\n\tlargeblockok = 1\n\tcompressok = 1\n")
+	info, err := DecodeResumeTokenContext(ctx, "1-e3f6a4b2c-c0-789c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &ResumeTokenInfo{
+		ToName: "tank/fs@a",
+		ToGUID: 0x7ea1e8b0c4d1a5b3,
+		Object: 2,
+		Offset: 0x40000,
+		Bytes:  0x40e48,
+		Flags:  []string{"largeblockok", "compressok"},
+		Fields: map[string]string{
+			"object": "0x2", "offset": "0x40000", "bytes": "0x40e48", "toguid": "0x7ea1e8b0c4d1a5b3",
+			"toname": "tank/fs@a", "largeblockok": "1", "compressok": "1",
+		},
+	}
+	if !reflect.DeepEqual(want, info) {
+		t.Fatalf("want: %+v, got: %+v", want, info)
+	}
+	if want := []string{"zstream", "token", "1-e3f6a4b2c-c0-789c"}; !reflect.DeepEqual(want, r.calls[0]) {
+		t.Fatalf("want call: %q, got: %q", want, r.calls)
+	}
+
+	if _, err := DecodeResumeTokenContext(ctx, ""); err == nil {
+		t.Fatal("expected error for empty token")
+	}
+}
+
+func TestRedupStream(t *testing.T) {
+	r := &fakeStreamRunner{fakeRunner: fakeRunner{output: func([]string) (string, error) {
+		return "regular stream", nil
+	}}}
+	var out bytes.Buffer
+	if err := RedupStreamContext(WithRunner(context.Background(), r), "/backup/dedup.zstream", &out); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"zstream", "redup", "/backup/dedup.zstream"}; !reflect.DeepEqual(want, r.calls[0]) || out.String() != "regular stream" {
+		t.Fatalf("want call: %q writing the stream, got: %q writing %q", want, r.calls, out.String())
+	}
+}